@@ -0,0 +1,157 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/repository"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/service"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/types"
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/events"
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/search"
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/storage"
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/utils"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+func runTenantExport(args []string) error {
+	fs := flag.NewFlagSet("tenant export", flag.ContinueOnError)
+	output := fs.String("o", "", "archive path (default <namespace>.tar.gz)")
+	if err := fs.Parse(reorderFlags(args)); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("usage: cmsctl tenant export <namespace> [-o file]")
+	}
+	namespace := fs.Arg(0)
+	if *output == "" {
+		*output = namespace + ".tar.gz"
+	}
+
+	log := newLogger()
+	conn, db, err := connect(log)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	svc, err := newTenantService(log, db)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(*output, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	manifest, err := svc.ExportTenant(namespace, f)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(*output)
+		return err
+	}
+
+	rows := 0
+	for _, t := range manifest.Tables {
+		rows += t.Rows
+	}
+	fmt.Printf("exported %s (schema version %d): %d tables, %d rows, %d files -> %s\n",
+		manifest.Namespace, manifest.SchemaVersion, len(manifest.Tables), rows, len(manifest.Files), *output)
+	return nil
+}
+
+func runTenantImport(args []string) error {
+	fs := flag.NewFlagSet("tenant import", flag.ContinueOnError)
+	namespace := fs.String("namespace", "", "namespace to import into (default: the exported namespace)")
+	owner := fs.String("owner", "", "ID of the CMS user owning the new tenant (default: the exported owner's email)")
+	mode := fs.String("isolation", "", "isolation mode of the new tenant: schema or shared (default: TENANT_DEFAULT_ISOLATION)")
+	if err := fs.Parse(reorderFlags(args)); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("usage: cmsctl tenant import <archive> [--namespace ns] [--owner id] [--isolation mode]")
+	}
+
+	req := &types.ImportTenantRequest{Namespace: *namespace, Isolation: types.IsolationMode(*mode)}
+	if *owner != "" {
+		id, err := uuid.Parse(*owner)
+		if err != nil {
+			return fmt.Errorf("invalid --owner: %w", err)
+		}
+		req.OwnerID = &id
+	}
+
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	log := newLogger()
+	conn, db, err := connect(log)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	svc, err := newTenantService(log, db)
+	if err != nil {
+		return err
+	}
+
+	tenant, err := svc.ImportTenant(f, req)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("imported into %s (tenant %s)\n", tenant.Namespace, tenant.TenantID)
+	return nil
+}
+
+// newTenantService builds the tenant service the way the server does, minus
+// the background job runner.
+func newTenantService(log *logrus.Logger, db *gorm.DB) (*service.TenantSvc, error) {
+	selector, err := newSelector(log, db)
+	if err != nil {
+		return nil, err
+	}
+
+	return service.NewTenantService(log, service.TenantDeps{
+		Repo:      repository.NewTenantRepo(log, db),
+		Users:     repository.NewRepo(log, db),
+		Audit:     repository.NewAuditRepo(log, db),
+		DB:        db,
+		Isolation: selector,
+		Bus:       events.NewInProcessBus(log),
+		Files:     storage.NewLocalStore(utils.GetEnv("TENANT_STORAGE_ROOT", "data/tenants")),
+		Indexer:   search.NoopIndexer{},
+	}, service.TenantConfig{
+		ImportMaxBytes: int64(utils.GetEnvAsInt("TENANT_IMPORT_MAX_MB", 2048)) << 20,
+	}), nil
+}
+
+// reorderFlags moves flags in front of positional arguments, since the flag
+// package stops at the first positional one. Every flag of the archive
+// commands takes a value.
+func reorderFlags(args []string) []string {
+	var flags, positional []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if len(arg) > 1 && arg[0] == '-' {
+			flags = append(flags, arg)
+			if !strings.Contains(arg, "=") && i+1 < len(args) {
+				flags = append(flags, args[i+1])
+				i++
+			}
+			continue
+		}
+		positional = append(positional, arg)
+	}
+	return append(flags, positional...)
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"text/tabwriter"
+	"time"
+
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/migration"
+)
+
+func runDB(args []string) error {
+	if len(args) == 0 || args[0] != "check" {
+		return errors.New("usage: cmsctl db check [--set cms|lms|all]")
+	}
+	return runDBCheck(args[1:])
+}
+
+// runDBCheck connects, reports the server it reached and fails unless every
+// checked schema is at the latest version of its set with no migration edited
+// after it was applied.
+func runDBCheck(args []string) error {
+	fs := flag.NewFlagSet("db check", flag.ContinueOnError)
+	setName := fs.String("set", "cms", "migration set to check: cms, lms or all")
+	lmsSchema := fs.String("lms-schema", migrationSets["lms"].schema, "schema holding the standalone LMS set")
+	dbConfig := databaseFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var sets []migrationSet
+	switch *setName {
+	case "all":
+		sets = []migrationSet{migrationSets["cms"], migrationSets["lms"]}
+	default:
+		set, err := lookupSet(*setName)
+		if err != nil {
+			return err
+		}
+		sets = []migrationSet{set}
+	}
+
+	log := newLogger()
+	started := time.Now()
+	conn, db, err := connectWith(log, *dbConfig)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	var version string
+	if err := db.WithContext(ctx).Raw("SHOW server_version").Scan(&version).Error; err != nil {
+		return err
+	}
+	fmt.Printf("connected to %s at %s:%d as %s in %s (PostgreSQL %s)\n\n",
+		dbConfig.DBName, dbConfig.Host, dbConfig.Port, dbConfig.User,
+		time.Since(started).Round(time.Millisecond), version)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "SET\tSCHEMA\tCURRENT\tLATEST\tPENDING\tSTATE")
+
+	unhealthy := 0
+	for _, set := range sets {
+		schema := set.schema
+		if set.name == "lms" {
+			schema = *lmsSchema
+		}
+		runner, err := newSetRunner(log, db, set)
+		if err != nil {
+			return err
+		}
+
+		state, current, pending, err := checkSchema(ctx, runner, schema)
+		if err != nil {
+			state = "ERROR: " + err.Error()
+		}
+		if state != "ok" {
+			unhealthy++
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%d\t%s\n", set.name, schema, current, runner.Latest(), pending, state)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if unhealthy > 0 {
+		return fmt.Errorf("%d of %d schemas need attention", unhealthy, len(sets))
+	}
+	return nil
+}
+
+func checkSchema(ctx context.Context, runner *migration.Runner, schema string) (string, int64, int, error) {
+	statuses, err := runner.Status(ctx, schema)
+	if err != nil {
+		return "", 0, 0, err
+	}
+
+	var current int64
+	pending, modified, unknown := 0, 0, 0
+	for _, st := range statuses {
+		switch {
+		case st.Unknown:
+			unknown++
+		case st.Modified:
+			modified++
+		case !st.Applied:
+			pending++
+		}
+		if st.Applied && st.Version > current {
+			current = st.Version
+		}
+	}
+
+	switch {
+	case modified > 0:
+		return fmt.Sprintf("%d modified after being applied", modified), current, pending, nil
+	case unknown > 0:
+		return fmt.Sprintf("%d applied versions missing from this build", unknown), current, pending, nil
+	case pending > 0:
+		return "pending migrations", current, pending, nil
+	default:
+		return "ok", current, pending, nil
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/utils"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+const usage = `cmsctl - operational tooling for the CMS multi-tenant platform
+
+Usage:
+  cmsctl migrate <up|down|status> [--set cms|lms] [--schema name] [--target N] [--steps N] [--dry-run]
+  cmsctl migrate create <name> [--set cms|lms] [--dir path]
+  cmsctl seed [--profile base|demo|small|load|file] [--password pw] [--seed N]
+  cmsctl db check [--set cms|lms|all]
+  cmsctl tenant migrate <up|down|status|plan> [flags]
+  cmsctl tenant export <namespace> [-o file]
+  cmsctl tenant import <archive> [--namespace ns] [--owner user-id] [--isolation schema|shared]
+  cmsctl tenant isolate <namespace>
+
+Database settings are read from the same DB_* environment variables as the server.
+The migrate, seed and db commands also accept --db-host, --db-port, --db-user,
+--db-password, --db-name and --db-sslmode, which take precedence.
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "migrate":
+		err = runMigrate(os.Args[2:])
+	case "seed":
+		err = runSeed(os.Args[2:])
+	case "db":
+		err = runDB(os.Args[2:])
+	case "tenant":
+		err = runTenant(os.Args[2:])
+	case "help", "-h", "--help":
+		fmt.Print(usage)
+		return
+	default:
+		err = fmt.Errorf("unknown command %q", os.Args[1])
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
+
+func newLogger() *logrus.Logger {
+	log := utils.NewLogger(utils.LogConfig{
+		Level:   utils.GetEnv("LOG_LEVEL", "warn"),
+		Console: true,
+	})
+	log.SetOutput(os.Stderr)
+	return log
+}
+
+func connect(log *logrus.Logger) (*utils.DatabaseConnection, *gorm.DB, error) {
+	return connectWith(log, utils.LoadDatabaseConfig())
+}
+
+// databaseFlags registers flags that override the DB_* environment for one
+// command. The returned config holds the result once fs is parsed.
+func databaseFlags(fs *flag.FlagSet) *utils.DatabaseConfig {
+	cfg := utils.LoadDatabaseConfig()
+	fs.StringVar(&cfg.Host, "db-host", cfg.Host, "database host (DB_HOST)")
+	fs.IntVar(&cfg.Port, "db-port", cfg.Port, "database port (DB_PORT)")
+	fs.StringVar(&cfg.User, "db-user", cfg.User, "database user (DB_USER)")
+	// A Func flag keeps the password out of the usage text.
+	fs.Func("db-password", "database password (DB_PASSWORD)", func(v string) error {
+		cfg.Password = v
+		return nil
+	})
+	fs.StringVar(&cfg.DBName, "db-name", cfg.DBName, "database name (DB_NAME)")
+	fs.StringVar(&cfg.SSLMode, "db-sslmode", cfg.SSLMode, "SSL mode (DB_SSL_MODE)")
+	return &cfg
+}
+
+func connectWith(log *logrus.Logger, cfg utils.DatabaseConfig) (*utils.DatabaseConnection, *gorm.DB, error) {
+	cfg.LogLevel = logger.Warn
+	cfg.RetryAttempts = utils.GetEnvAsInt("DB_RETRY_ATTEMPTS", 1)
+
+	conn := utils.NewDatabaseConnection(cfg, log)
+	if err := conn.Connect(); err != nil {
+		return nil, nil, err
+	}
+	return conn, conn.DB, nil
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/migration"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// migrationSet is a migration set cmsctl manages outside of tenants.
+type migrationSet struct {
+	name string
+	// schema is where the set is applied unless --schema says otherwise.
+	schema string
+	// dir is the source directory of the SQL files, relative to the module
+	// root, where migrate create writes new ones.
+	dir  string
+	load func() ([]migration.Migration, error)
+	// note is printed after migrate create.
+	note string
+	// adopt is the SQL the runner adopts an unmigrated database with.
+	adopt string
+}
+
+// migrationSets are the platform schema and a standalone LMS schema, built
+// from the same migrations as a tenant schema.
+var migrationSets = map[string]migrationSet{
+	"cms": {
+		name:   "cms",
+		schema: "public",
+		dir:    "internal/migration/sql/cms",
+		load:   migration.CMSMigrations,
+		adopt:  migration.CMSAdoption(),
+	},
+	"lms": {
+		name:   "lms",
+		schema: "learning_management",
+		dir:    "internal/migration/sql/tenant",
+		load:   migration.TenantMigrations,
+		note:   "tenant schemas pick this up too; add the matching migration under internal/migration/sql/shared",
+	},
+}
+
+var migrationNamePattern = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+func runMigrate(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: cmsctl migrate <up|down|status|create> [flags]")
+	}
+	if args[0] == "create" {
+		return runMigrateCreate(args[1:])
+	}
+	action := args[0]
+
+	fs := flag.NewFlagSet("migrate "+action, flag.ContinueOnError)
+	setName := fs.String("set", "cms", "migration set: cms or lms")
+	schema := fs.String("schema", "", "schema to migrate (default public for cms, learning_management for lms)")
+	target := fs.Int64("target", 0, "highest version to migrate up to (0 = latest)")
+	steps := fs.Int("steps", 1, "number of migrations to revert with down")
+	dryRun := fs.Bool("dry-run", false, "print the SQL that would run instead of running it")
+	dbConfig := databaseFlags(fs)
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	set, err := lookupSet(*setName)
+	if err != nil {
+		return err
+	}
+	if *schema == "" {
+		*schema = set.schema
+	}
+
+	log := newLogger()
+	conn, db, err := connectWith(log, *dbConfig)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	runner, err := newSetRunner(log, db, set)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	switch action {
+	case "up":
+		if *dryRun {
+			adoption, err := runner.AdoptionSQL(ctx, *schema)
+			if err != nil {
+				return err
+			}
+			pending, err := runner.Plan(ctx, *schema, *target)
+			if err != nil {
+				return err
+			}
+			printSQL(*schema, adoption, pending, true)
+			return nil
+		}
+		done, err := runner.Up(ctx, *schema, *target)
+		return reportResults([]migration.SchemaResult{{Schema: *schema, Migrations: done, Err: err}})
+	case "down":
+		if *dryRun {
+			planned, err := runner.PlanDown(ctx, *schema, *steps)
+			printSQL(*schema, "", planned, false)
+			return err
+		}
+		done, err := runner.Down(ctx, *schema, *steps)
+		return reportResults([]migration.SchemaResult{{Schema: *schema, Migrations: done, Err: err}})
+	case "status":
+		return printStatus(ctx, runner, []string{*schema})
+	default:
+		return fmt.Errorf("unknown migrate action %q", action)
+	}
+}
+
+// runMigrateCreate writes an empty pair of SQL files numbered after the
+// highest version in the set. The name may come before or after the flags.
+func runMigrateCreate(args []string) error {
+	var name string
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+
+	fs := flag.NewFlagSet("migrate create", flag.ContinueOnError)
+	setName := fs.String("set", "cms", "migration set: cms or lms")
+	dir := fs.String("dir", "", "directory to write to (default the set's source directory)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if name == "" && fs.NArg() > 0 {
+		name = fs.Arg(0)
+		if err := fs.Parse(fs.Args()[1:]); err != nil {
+			return err
+		}
+	}
+	if name == "" || fs.NArg() > 0 {
+		return errors.New("usage: cmsctl migrate create <name> [--set cms|lms] [--dir path]")
+	}
+	name = strings.ToLower(strings.NewReplacer("-", "_", " ", "_").Replace(name))
+	if !migrationNamePattern.MatchString(name) {
+		return fmt.Errorf("migration name %q may only use letters, digits and underscores", name)
+	}
+
+	set, err := lookupSet(*setName)
+	if err != nil {
+		return err
+	}
+	if *dir == "" {
+		*dir = set.dir
+	}
+
+	// The embedded set counts as well as the files on disk, so a --dir
+	// elsewhere cannot reuse a version the binary already holds.
+	embedded, err := set.load()
+	if err != nil {
+		return err
+	}
+	var latest int64
+	for _, m := range embedded {
+		latest = max(latest, m.Version)
+	}
+	onDisk, err := highestVersionIn(*dir)
+	if err != nil {
+		return err
+	}
+	version := max(latest, onDisk) + 1
+
+	base := filepath.Join(*dir, fmt.Sprintf("%04d_%s", version, name))
+	for _, suffix := range []string{".up.sql", ".down.sql"} {
+		body := fmt.Sprintf("-- %s\n", strings.ReplaceAll(name, "_", " "))
+		if err := writeNewFile(base+suffix, body); err != nil {
+			return err
+		}
+		fmt.Println("created", base+suffix)
+	}
+	if set.note != "" {
+		fmt.Println("note:", set.note)
+	}
+	fmt.Println("rebuild cmsctl and the server to embed the new migration")
+	return nil
+}
+
+func lookupSet(name string) (migrationSet, error) {
+	set, ok := migrationSets[name]
+	if !ok {
+		return migrationSet{}, fmt.Errorf("unknown migration set %q (want cms or lms)", name)
+	}
+	return set, nil
+}
+
+func newSetRunner(log *logrus.Logger, db *gorm.DB, set migrationSet) (*migration.Runner, error) {
+	migrations, err := set.load()
+	if err != nil {
+		return nil, err
+	}
+	runner, err := migration.NewRunner(db, log, migrations)
+	if err != nil {
+		return nil, err
+	}
+	return runner.Adopt(set.adopt), nil
+}
+
+// printSQL writes what a dry run would execute, starting with the adoption of
+// an unmigrated database. Every embedded set is plain SQL; a Go migration
+// would have nothing to show and is only named.
+func printSQL(schema, adoption string, migrations []migration.Migration, up bool) {
+	if len(migrations) == 0 && adoption == "" {
+		fmt.Printf("-- %s: nothing to run\n", schema)
+		return
+	}
+
+	direction := "down"
+	if up {
+		direction = "up"
+	}
+	fmt.Printf("SET search_path TO %s, public;\n", schema)
+	if adoption != "" {
+		fmt.Printf("\n-- adopting existing objects\n%s\n", strings.TrimRight(adoption, "\n"))
+	}
+	for _, m := range migrations {
+		fmt.Printf("\n-- %d_%s (%s)\n", m.Version, m.Name, direction)
+		sql := m.DownSQL
+		if up {
+			sql = m.UpSQL
+		}
+		if sql == "" {
+			fmt.Println("-- Go migration; its statements depend on the live schema")
+			continue
+		}
+		fmt.Println(strings.TrimRight(sql, "\n"))
+	}
+}
+
+func highestVersionIn(dir string) (int64, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, err
+	}
+	var highest int64
+	for _, entry := range entries {
+		prefix, _, ok := strings.Cut(entry.Name(), "_")
+		if !ok {
+			continue
+		}
+		if version, err := strconv.ParseInt(prefix, 10, 64); err == nil {
+			highest = max(highest, version)
+		}
+	}
+	return highest, nil
+}
+
+func writeNewFile(path, body string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(body); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/repository"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/seed"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/types"
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/utils"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+const minSeedPasswordLength = 8
+
+// demoAccount is a user the demo profile creates, with the systems it has
+// bought and how many days ago.
+type demoAccount struct {
+	name      string
+	email     string
+	role      types.RoleType
+	verified  bool
+	purchases map[types.SystemType]int
+}
+
+var demoAccounts = []demoAccount{
+	{name: "System Administrator", email: "admin@example.com", role: types.RootAdmin, verified: true},
+	{
+		name:      "John Doe",
+		email:     "john.doe@example.com",
+		role:      types.CMSCustomer,
+		verified:  true,
+		purchases: map[types.SystemType]int{types.LMS: 30, types.EMS: 15},
+	},
+	{
+		name:      "Jane Smith",
+		email:     "jane.smith@example.com",
+		role:      types.CMSCustomer,
+		purchases: map[types.SystemType]int{types.LMS: 7},
+	},
+}
+
+// runSeed fills the database with the rows a profile asks for. The base and
+// demo profiles can be run again without creating duplicates; any other
+// profile is a generator profile, built in or read from a file, that loads
+// fake data in bulk once per seed.
+func runSeed(args []string) error {
+	fs := flag.NewFlagSet("seed", flag.ContinueOnError)
+	profile := fs.String("profile", "base", fmt.Sprintf(
+		"base: roles and the system catalog; demo: base plus demo accounts and purchases; "+
+			"%s or a profile file: base plus generated data", strings.Join(seed.BuiltinProfiles(), ", ")))
+	password := fs.String("password", utils.GetEnv("SEED_PASSWORD", ""), "password of the demo and generated accounts (SEED_PASSWORD)")
+	seedOverride := fs.Uint64("seed", 0, "seed of a generator profile, replacing the profile's own (0 keeps it)")
+	dbConfig := databaseFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var generated *seed.Profile
+	if *profile != "base" && *profile != "demo" {
+		p, err := seed.LoadProfile(*profile)
+		if err != nil {
+			return fmt.Errorf("unknown seed profile %q (want base, demo, one of %s or a profile file): %w",
+				*profile, strings.Join(seed.BuiltinProfiles(), ", "), err)
+		}
+		if *seedOverride != 0 {
+			p.Seed = *seedOverride
+		}
+		generated = p
+	}
+	if *profile != "base" && len(*password) < minSeedPasswordLength {
+		return fmt.Errorf("the %s profile needs --password or SEED_PASSWORD of at least %d characters", *profile, minSeedPasswordLength)
+	}
+
+	log := newLogger()
+	conn, db, err := connectWith(log, *dbConfig)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if err := requireMigrated(log, db); err != nil {
+		return err
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := seedBase(log, tx); err != nil {
+			return err
+		}
+		if *profile == "demo" {
+			return seedDemo(tx, *password)
+		}
+		return nil
+	})
+	if err != nil || generated == nil {
+		return err
+	}
+	return seedGenerated(log, db, generated, *password)
+}
+
+// seedGenerated runs the fake-data generator and prints the rows it loaded.
+func seedGenerated(log *logrus.Logger, db *gorm.DB, p *seed.Profile, password string) error {
+	selector, err := newSelector(log, db)
+	if err != nil {
+		return err
+	}
+	generator := seed.NewGenerator(log, db, selector, repository.NewTenantRepo(log, db))
+
+	started := time.Now()
+	report, err := generator.Run(context.Background(), p, password)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TABLE\tROWS")
+	total := 0
+	for _, table := range report.Tables {
+		fmt.Fprintf(w, "%s\t%d\n", table.Table, table.Rows)
+		total += table.Rows
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	fmt.Printf("%d rows generated from seed %d in %s\n", total, p.Seed, time.Since(started).Round(time.Second))
+	if len(report.Tenants) > 0 {
+		fmt.Printf("tenants: %s\n", strings.Join(report.Tenants, ", "))
+	}
+	return nil
+}
+
+// requireMigrated refuses to seed a platform schema the CMS set has not fully
+// built, since the seeders write to tables it creates.
+func requireMigrated(log *logrus.Logger, db *gorm.DB) error {
+	runner, err := newSetRunner(log, db, migrationSets["cms"])
+	if err != nil {
+		return err
+	}
+	pending, err := runner.Plan(context.Background(), migrationSets["cms"].schema, 0)
+	if err != nil {
+		return err
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("%d cms migrations are pending; run cmsctl migrate up first", len(pending))
+	}
+	return nil
+}
+
+func seedBase(log *logrus.Logger, tx *gorm.DB) error {
+	for _, role := range []types.RoleType{types.RootAdmin, types.CMSCustomer} {
+		record := types.CMSWholeSysRole{RoleName: string(role)}
+		if err := tx.Where("role_name = ?", record.RoleName).FirstOrCreate(&record).Error; err != nil {
+			return err
+		}
+	}
+
+	added, err := repository.NewCatalogRepo(log, tx).SeedSystems(types.BuiltinSystems())
+	if err != nil {
+		return err
+	}
+	fmt.Printf("roles ready, %d systems added to the catalog\n", added)
+	return nil
+}
+
+// seedDemo creates the demo accounts with a real hash of password so they can
+// sign in. Existing accounts keep their password. The demo purchases have no
+// subscription, so they are granted by the demo admin to entitle.
+func seedDemo(tx *gorm.DB, password string) error {
+	hash, err := utils.HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	var admin *uuid.UUID
+	for _, account := range demoAccounts {
+		user := types.CMSUser{
+			CMSUserName:  account.name,
+			CMSUserEmail: account.email,
+			Password:     hash,
+			CMSUserRole:  string(account.role),
+			Verified:     account.verified,
+		}
+		if err := tx.Where("cms_user_email = ?", account.email).FirstOrCreate(&user).Error; err != nil {
+			return err
+		}
+		if account.role == types.RootAdmin {
+			admin = &user.CMSUserID
+		}
+
+		for system, daysAgo := range account.purchases {
+			purchase := types.CMSCusPurchase{
+				CMSCusID:     user.CMSUserID,
+				SystemName:   string(system),
+				PurchaseDate: now.AddDate(0, 0, -daysAgo),
+				GrantedBy:    admin,
+			}
+			err := tx.Where("cms_cus_id = ? AND system_name = ?", user.CMSUserID, string(system)).
+				FirstOrCreate(&purchase).Error
+			if err != nil {
+				return err
+			}
+			// Demo purchases seeded before they were granted.
+			if purchase.GrantedBy == nil && purchase.SubscriptionID == nil {
+				if err := tx.Model(&purchase).Update("granted_by", admin).Error; err != nil {
+					return err
+				}
+			}
+		}
+	}
+	fmt.Printf("%d demo accounts ready\n", len(demoAccounts))
+	return nil
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"text/tabwriter"
+
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/isolation"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/migration"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/repository"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/types"
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/utils"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+func runTenant(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: cmsctl tenant <migrate|export|import|isolate> ...")
+	}
+
+	switch args[0] {
+	case "migrate":
+		return runTenantMigrate(args[1:])
+	case "export":
+		return runTenantExport(args[1:])
+	case "import":
+		return runTenantImport(args[1:])
+	case "isolate":
+		return runTenantIsolate(args[1:])
+	default:
+		return fmt.Errorf("unknown tenant command %q", args[0])
+	}
+}
+
+func runTenantMigrate(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: cmsctl tenant migrate <up|down|status|plan> [--tenant ns | --all]")
+	}
+	action := args[0]
+
+	fs := flag.NewFlagSet("tenant migrate "+action, flag.ContinueOnError)
+	namespace := fs.String("tenant", "", "namespace of a single tenant")
+	all := fs.Bool("all", false, "run against every registered tenant")
+	target := fs.Int64("target", 0, "highest version to migrate up to (0 = latest)")
+	steps := fs.Int("steps", 1, "number of migrations to revert with down")
+	concurrency := fs.Int("concurrency", 4, "tenant schemas migrated in parallel")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if (*namespace == "") == !*all {
+		return errors.New("pass exactly one of --tenant or --all")
+	}
+
+	log := newLogger()
+	conn, db, err := connect(log)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	selector, err := newSelector(log, db)
+	if err != nil {
+		return err
+	}
+	targets, err := migrationTargets(log, db, *namespace)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	// Dedicated schemas and the shared schema have their own migration sets,
+	// so each mode runs with its own runner.
+	var results []migration.SchemaResult
+	for _, mode := range []types.IsolationMode{types.IsolationSchema, types.IsolationShared} {
+		schemas := targets[mode]
+		if len(schemas) == 0 {
+			continue
+		}
+		strategy, err := selector.Mode(mode)
+		if err != nil {
+			return err
+		}
+		runner := strategy.Migrator()
+
+		switch action {
+		case "up":
+			results = append(results, runner.UpAll(ctx, schemas, *target, *concurrency)...)
+		case "down":
+			results = append(results, runner.DownAll(ctx, schemas, *steps, *concurrency)...)
+		case "plan":
+			results = append(results, runner.PlanAll(ctx, schemas, *target, *concurrency)...)
+		case "status":
+			if err := printStatus(ctx, runner, schemas); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unknown migrate action %q", action)
+		}
+	}
+	if action == "status" {
+		return nil
+	}
+	return reportResults(results)
+}
+
+// migrationTargets groups the schemas to migrate by isolation mode. Tenants
+// in shared mode all map to the one shared schema.
+func migrationTargets(log *logrus.Logger, db *gorm.DB, namespace string) (map[types.IsolationMode][]string, error) {
+	repo := repository.NewTenantRepo(log, db)
+	var tenants []types.Tenant
+	if namespace != "" {
+		ns, err := utils.NormalizeNamespace(namespace)
+		if err != nil {
+			return nil, err
+		}
+		tenant, err := repo.GetTenantByNamespace(ns)
+		if err != nil {
+			return nil, err
+		}
+		tenants = []types.Tenant{*tenant}
+	} else {
+		var err error
+		if tenants, err = repo.ListTenants(); err != nil {
+			return nil, err
+		}
+	}
+
+	targets := make(map[types.IsolationMode][]string)
+	for _, t := range tenants {
+		if t.Status == types.TenantPurged {
+			continue
+		}
+		if t.Isolation == types.IsolationShared {
+			targets[types.IsolationShared] = []string{isolation.SharedSchema}
+			continue
+		}
+		targets[types.IsolationSchema] = append(targets[types.IsolationSchema], t.SchemaName)
+	}
+	return targets, nil
+}
+
+// newSelector builds the isolation strategies the way the server does.
+func newSelector(log *logrus.Logger, db *gorm.DB) (*isolation.Selector, error) {
+	tenantMigrations, err := migration.TenantMigrations()
+	if err != nil {
+		return nil, err
+	}
+	tenantRunner, err := migration.NewRunner(db, log, tenantMigrations)
+	if err != nil {
+		return nil, err
+	}
+	sharedMigrations, err := migration.SharedMigrations()
+	if err != nil {
+		return nil, err
+	}
+	sharedRunner, err := migration.NewRunner(db, log, sharedMigrations)
+	if err != nil {
+		return nil, err
+	}
+
+	return isolation.NewSelector(
+		types.IsolationMode(utils.GetEnv("TENANT_DEFAULT_ISOLATION", string(types.IsolationSchema))),
+		isolation.NewSchemaStrategy(db, tenantRunner),
+		isolation.NewSharedStrategy(db, sharedRunner),
+	)
+}
+
+func runTenantIsolate(args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: cmsctl tenant isolate <namespace>")
+	}
+
+	log := newLogger()
+	conn, db, err := connect(log)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	svc, err := newTenantService(log, db)
+	if err != nil {
+		return err
+	}
+	tenant, err := svc.IsolateTenant(args[0], nil)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("moved %s to a dedicated schema\n", tenant.Namespace)
+	return nil
+}
+
+func reportResults(results []migration.SchemaResult) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "SCHEMA\tMIGRATIONS\tRESULT")
+
+	failed := 0
+	for _, res := range results {
+		names := "-"
+		if len(res.Migrations) > 0 {
+			names = ""
+			for i, m := range res.Migrations {
+				if i > 0 {
+					names += ", "
+				}
+				names += fmt.Sprintf("%d_%s", m.Version, m.Name)
+			}
+		}
+
+		result := "ok"
+		if res.Err != nil {
+			result = "FAILED: " + res.Err.Error()
+			failed++
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", res.Schema, names, result)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d schemas failed", failed, len(results))
+	}
+	return nil
+}
+
+func printStatus(ctx context.Context, runner *migration.Runner, schemas []string) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "SCHEMA\tVERSION\tNAME\tSTATE\tAPPLIED AT")
+
+	for _, schema := range schemas {
+		statuses, err := runner.Status(ctx, schema)
+		if err != nil {
+			fmt.Fprintf(w, "%s\t-\t-\tERROR: %s\t-\n", schema, err)
+			continue
+		}
+		for _, st := range statuses {
+			state, appliedAt := "pending", "-"
+			if st.Applied {
+				state = "applied"
+				appliedAt = st.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			if st.Modified {
+				state = "modified"
+			}
+			if st.Unknown {
+				state = "unknown"
+			}
+			fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\n", schema, st.Version, st.Name, state, appliedAt)
+		}
+	}
+	return w.Flush()
+}
@@ -1,31 +1,111 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"github.com/multi-tenants-cms-golang/cms-sys/internal/types"
 	"gorm.io/gorm"
+	"math"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/gofiber/fiber/v2/middleware/cors"
 	loggMiddleware "github.com/gofiber/fiber/v2/middleware/logger"
 	"github.com/gofiber/fiber/v2/middleware/recover"
 	"github.com/multi-tenants-cms-golang/cms-sys/internal/handler"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/isolation"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/middleware"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/migration"
 	"github.com/multi-tenants-cms-golang/cms-sys/internal/repository"
 	"github.com/multi-tenants-cms-golang/cms-sys/internal/routes"
 	"github.com/multi-tenants-cms-golang/cms-sys/internal/service"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/settings"
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/dns"
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/events"
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/hooks"
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/mailer"
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/payments"
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/search"
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/storage"
 	"github.com/multi-tenants-cms-golang/cms-sys/pkg/utils"
 	"github.com/sirupsen/logrus"
-	"gorm.io/gorm/logger"
 )
 
 type DISection struct {
 	repo    repository.AuthRepository
 	srv     service.AuthService
 	handler handler.AuthHandle
+
+	tenantRepo    repository.TenantRepository
+	tenantSrv     service.TenantService
+	tenantHandler handler.TenantHandle
+
+	meteringSrv  service.MeteringService
+	usageHandler handler.UsageHandle
+
+	settingsSrv     service.SettingsService
+	settingsHandler handler.SettingsHandle
+
+	domainSrv     service.DomainService
+	domainHandler handler.DomainHandle
+
+	memberSrv     service.MemberService
+	memberHandler handler.MemberHandle
+
+	invitationSrv     service.InvitationService
+	invitationHandler handler.InvitationHandle
+
+	catalogSrv     service.CatalogService
+	catalogHandler handler.CatalogHandle
+
+	purchaseSrv     service.PurchaseService
+	entitlementSrv  service.EntitlementService
+	purchaseHandler handler.PurchaseHandle
+	systemGate      *middleware.SystemGate
+
+	planHandler         handler.PlanHandle
+	subscriptionSrv     service.SubscriptionService
+	subscriptionHandler handler.SubscriptionHandle
+
+	invoiceSrv     service.InvoiceService
+	invoiceHandler handler.InvoiceHandle
+
+	couponSrv     service.CouponService
+	couponHandler handler.CouponHandle
+
+	paymentSrv        service.PaymentService
+	paymentHandler    handler.PaymentHandle
+	paymentSimHandler handler.PaymentSimHandle
+
+	analyticsSrv     service.AnalyticsService
+	analyticsHandler handler.AnalyticsHandle
+	growthSrv        service.GrowthService
+	growthHandler    handler.GrowthHandle
+
+	reportSrv     service.ReportService
+	reportHandler handler.ReportHandle
+}
+
+// Infra groups the shared infrastructure handed to the services.
+type Infra struct {
+	isolation *isolation.Selector
+	bus       events.Bus
+	files     storage.TenantFiles
+	indexer   search.Indexer
+	jobs      *service.JobRunner
+	resolver  dns.Resolver
+	mailer    mailer.Mailer
+	// payments is nil when no provider is configured; paymentSim is only
+	// set for the fake provider.
+	payments   payments.PaymentProvider
+	paymentSim *payments.Simulator
+
+	// baseDomain is the shared parent domain of tenant subdomains.
+	baseDomain string
 }
 
 func main() {
@@ -41,31 +121,31 @@ func main() {
 
 	appLogger.Info("Starting CMS Multi-Tenant System")
 
-	dbConfig := utils.DatabaseConfig{
-		Host:            utils.GetEnv("DB_HOST", "localhost"),
-		Port:            utils.GetEnvAsInt("DB_PORT", 5432),
-		User:            utils.GetEnv("DB_USER", "postgres"),
-		Password:        utils.GetEnv("DB_PASSWORD", "Swanhtet12@"),
-		DBName:          utils.GetEnv("DB_NAME", "cms_db"),
-		SSLMode:         utils.GetEnv("DB_SSL_MODE", "disable"),
-		MaxOpenConns:    utils.GetEnvAsInt("DB_MAX_OPEN_CONNS", 25),
-		MaxIdleConns:    utils.GetEnvAsInt("DB_MAX_IDLE_CONNS", 10),
-		ConnMaxLifetime: utils.GetEnvAsDuration("DB_CONN_MAX_LIFETIME", 5*time.Minute),
-		ConnMaxIdleTime: utils.GetEnvAsDuration("DB_CONN_MAX_IDLE_TIME", 2*time.Minute),
-		RetryAttempts:   utils.GetEnvAsInt("DB_RETRY_ATTEMPTS", 5),
-		RetryDelay:      utils.GetEnvAsDuration("DB_RETRY_DELAY", 2*time.Second),
-		LogLevel:        logger.Info,
-	}
+	dbConfig := utils.LoadDatabaseConfig()
 
 	dbConnection := utils.NewDatabaseConnection(dbConfig, appLogger)
 	if err := dbConnection.Connect(); err != nil {
 		appLogger.WithError(err).Fatal("Failed to initialize database connection")
 	}
 
-	err := dbConnection.DB.AutoMigrate(&types.CMSWholeSysRole{}, &types.CMSUser{}, &types.CMSCusPurchase{}, &types.UserPageRequest{})
+	cmsMigrations, err := migration.CMSMigrations()
 	if err != nil {
+		appLogger.WithError(err).Fatal("Failed to load CMS migrations")
+	}
+	cmsMigrator, err := migration.NewRunner(dbConnection.DB, appLogger, cmsMigrations)
+	if err != nil {
+		appLogger.WithError(err).Fatal("Invalid CMS migration set")
+	}
+	cmsMigrator.Adopt(migration.CMSAdoption())
+	if done, err := cmsMigrator.Up(utils.GetContext(), "public", 0); err != nil {
 		appLogger.WithError(err).Fatal("Failed to migrate database")
-		return
+	} else if len(done) > 0 {
+		appLogger.WithField("applied", len(done)).Info("Applied CMS migrations")
+	}
+	if added, err := repository.NewCatalogRepo(appLogger, dbConnection.DB).SeedSystems(types.BuiltinSystems()); err != nil {
+		appLogger.WithError(err).Fatal("Failed to seed system catalog")
+	} else if added > 0 {
+		appLogger.WithField("added", added).Info("Added systems to the catalog")
 	}
 	//if err := utils.InitJWTKeysFromVault(); err != nil {
 	//	log.Fatalf("Vault key init failed: %v", err)
@@ -110,11 +190,6 @@ func main() {
 	}))
 
 	app.Use(recover.New())
-	app.Use(cors.New(cors.Config{
-		AllowOrigins: "*",
-		AllowMethods: "GET,POST,HEAD,PUT,DELETE,PATCH,OPTIONS",
-		AllowHeaders: "Origin,Content-Type,Accept,Authorization",
-	}))
 
 	app.Get("/", func(c *fiber.Ctx) error {
 		return c.JSON(fiber.Map{
@@ -143,9 +218,172 @@ func main() {
 		})
 	})
 
-	di := DependencyInjectionSection(appLogger, dbConnection.DB)
+	tenantMigrations, err := migration.TenantMigrations()
+	if err != nil {
+		appLogger.WithError(err).Fatal("Failed to load tenant migrations")
+	}
+	migrator, err := migration.NewRunner(dbConnection.DB, appLogger, tenantMigrations)
+	if err != nil {
+		appLogger.WithError(err).Fatal("Invalid tenant migration set")
+	}
+	sharedMigrations, err := migration.SharedMigrations()
+	if err != nil {
+		appLogger.WithError(err).Fatal("Failed to load shared schema migrations")
+	}
+	sharedMigrator, err := migration.NewRunner(dbConnection.DB, appLogger, sharedMigrations)
+	if err != nil {
+		appLogger.WithError(err).Fatal("Invalid shared schema migration set")
+	}
+	shared := isolation.NewSharedStrategy(dbConnection.DB, sharedMigrator)
+	selector, err := isolation.NewSelector(
+		types.IsolationMode(utils.GetEnv("TENANT_DEFAULT_ISOLATION", string(types.IsolationSchema))),
+		isolation.NewSchemaStrategy(dbConnection.DB, migrator),
+		shared,
+	)
+	if err != nil {
+		appLogger.WithError(err).Fatal("Invalid tenant isolation configuration")
+	}
+	// Row-level security is the only thing separating shared tenants, so a
+	// role that bypasses it cannot serve them. Shared operations are refused
+	// either way; a shared default would refuse every new tenant.
+	if err := shared.CheckRole(utils.GetContext()); err != nil {
+		if selector.Default() == types.IsolationShared {
+			appLogger.WithError(err).Fatal("Shared isolation is the default but cannot be used")
+		}
+		appLogger.WithError(err).Warn("Shared isolation is unavailable; shared tenants will be refused")
+	}
+
+	infra := &Infra{
+		isolation: selector,
+		bus:       events.NewInProcessBus(appLogger),
+		files:     storage.NewLocalStore(utils.GetEnv("TENANT_STORAGE_ROOT", "data/tenants")),
+		indexer:   newSearchIndexer(),
+		jobs:      service.NewJobRunner(appLogger, repository.NewJobRepo(appLogger, dbConnection.DB), utils.GetEnvAsInt("JOB_CONCURRENCY", 2)),
+		resolver:  dns.NewNetResolver(utils.GetEnv("DNS_SERVER", ""), utils.GetEnvAsDuration("DNS_TIMEOUT", 5*time.Second)),
+		mailer:    newMailer(appLogger),
+
+		baseDomain: utils.GetEnv("TENANT_BASE_DOMAIN", ""),
+	}
+	infra.payments, infra.paymentSim = newPaymentProvider(appLogger)
+	infra.jobs.Recover()
+
+	di := DependencyInjectionSection(appLogger, dbConnection.DB, infra)
+
+	// CORS is registered once the services it consults exist; routes added
+	// above it are not meant for browsers.
+	app.Use(middleware.CORS(middleware.CORSConfig{
+		Origins:    utils.GetEnvAsList("CORS_ALLOWED_ORIGINS", nil),
+		BaseDomain: infra.baseDomain,
+		Domains:    di.domainSrv,
+		Settings:   di.settingsSrv,
+	}))
 	routes.SetupRoutes(app, di.handler)
 
+	tenantScope := middleware.TenantScope(di.tenantSrv, dbConnection.DB, middleware.TenantConfig{
+		BaseDomain: infra.baseDomain,
+		Domains:    di.domainSrv,
+		Isolation:  infra.isolation,
+		Members:    di.memberSrv,
+		Log:        appLogger,
+	})
+	routes.SetupTenantRoutes(app, tenantScope, middleware.MeterAPICalls(di.meteringSrv), di.memberSrv, routes.TenantHandlers{
+		Tenant:      di.tenantHandler,
+		Usage:       di.usageHandler,
+		Settings:    di.settingsHandler,
+		Domains:     di.domainHandler,
+		Members:     di.memberHandler,
+		Invitations: di.invitationHandler,
+	})
+	routes.SetupAnalyticsRoutes(app, di.analyticsHandler, di.growthHandler)
+	routes.SetupReportRoutes(app, di.reportHandler)
+	routes.SetupPurchaseRoutes(app, di.purchaseHandler)
+	routes.SetupSystemRoutes(app, di.systemGate, di.catalogHandler, di.purchaseHandler)
+	routes.SetupBillingRoutes(app, routes.BillingHandlers{
+		Plans:         di.planHandler,
+		Subscriptions: di.subscriptionHandler,
+		Invoices:      di.invoiceHandler,
+		Coupons:       di.couponHandler,
+	})
+	routes.SetupPaymentRoutes(app, di.paymentHandler, di.paymentSimHandler)
+
+	jobsCtx, stopJobs := utils.GetContextWithCancel()
+	go runEvery(jobsCtx, utils.GetEnvAsDuration("TENANT_PURGE_INTERVAL", time.Hour), func() {
+		if purged := di.tenantSrv.PurgeExpired(); purged > 0 {
+			appLogger.WithField("purged", purged).Info("Purged tenants past their retention period")
+		}
+	})
+	go runEvery(jobsCtx, utils.GetEnvAsDuration("USAGE_RECONCILE_INTERVAL", 15*time.Minute), func() {
+		di.meteringSrv.ReconcileAll()
+	})
+	go runEvery(jobsCtx, utils.GetEnvAsDuration("ANALYTICS_COLLECT_INTERVAL", time.Hour), func() {
+		report, err := di.analyticsSrv.Collect(jobsCtx)
+		if err != nil {
+			appLogger.WithError(err).Error("Failed to collect platform analytics")
+			return
+		}
+		appLogger.WithFields(logrus.Fields{
+			"collected": report.Collected,
+			"failed":    len(report.Failed),
+		}).Info("Collected platform analytics")
+	})
+	go runEvery(jobsCtx, utils.GetEnvAsDuration("GROWTH_REFRESH_INTERVAL", time.Hour), func() {
+		report, err := di.growthSrv.Refresh(jobsCtx)
+		if err != nil {
+			appLogger.WithError(err).Error("Failed to refresh growth analytics")
+			return
+		}
+		if len(report.Failed) > 0 {
+			appLogger.WithField("failed", report.Failed).Warn("Refreshed growth analytics with failures")
+		}
+	})
+	go runEvery(jobsCtx, utils.GetEnvAsDuration("DOMAIN_VERIFY_INTERVAL", 5*time.Minute), func() {
+		if verified := di.domainSrv.VerifyPending(); verified > 0 {
+			appLogger.WithField("verified", verified).Info("Verified custom domains")
+		}
+	})
+	go runEvery(jobsCtx, utils.GetEnvAsDuration("DOMAIN_RECHECK_INTERVAL", 6*time.Hour), func() {
+		if unverified := di.domainSrv.RecheckVerified(); unverified > 0 {
+			appLogger.WithField("unverified", unverified).Warn("Custom domains lost their verification record")
+		}
+	})
+	go runEvery(jobsCtx, utils.GetEnvAsDuration("SUBSCRIPTION_PROCESS_INTERVAL", 15*time.Minute), func() {
+		report, err := di.subscriptionSrv.ProcessDue(time.Now())
+		if err != nil {
+			appLogger.WithError(err).Error("Failed to process subscriptions")
+			return
+		}
+		if *report != (types.SubscriptionRunReport{}) {
+			appLogger.WithFields(logrus.Fields{
+				"renewed":  report.Renewed,
+				"past_due": report.PastDue,
+				"canceled": report.Canceled,
+				"expired":  report.Expired,
+				"failed":   report.Failed,
+			}).Info("Processed due subscriptions")
+		}
+	})
+	go runEvery(jobsCtx, utils.GetEnvAsDuration("REPORT_SCHEDULER_INTERVAL", time.Minute), func() {
+		report, err := di.reportSrv.RunDue(jobsCtx, time.Now())
+		if err != nil {
+			appLogger.WithError(err).Error("Failed to run report schedules")
+			return
+		}
+		if *report != (types.ReportScheduleRunReport{}) {
+			appLogger.WithFields(logrus.Fields{
+				"ran":    report.Ran,
+				"failed": report.Failed,
+			}).Info("Ran due report schedules")
+		}
+	})
+	go runEvery(jobsCtx, utils.GetEnvAsDuration("TRANSFER_EXPIRE_INTERVAL", time.Hour), func() {
+		if expired := di.memberSrv.ExpireTransfers(); expired > 0 {
+			appLogger.WithField("expired", expired).Info("Expired ownership transfers")
+		}
+		if expired := di.invitationSrv.ExpireInvitations(); expired > 0 {
+			appLogger.WithField("expired", expired).Info("Expired invitations")
+		}
+	})
+
 	port := utils.GetEnv("PORT", "8080")
 
 	go func() {
@@ -160,6 +398,8 @@ func main() {
 	<-quit
 
 	appLogger.Info("Shutting down server...")
+	stopJobs()
+	infra.jobs.Shutdown()
 
 	if err := app.Shutdown(); err != nil {
 		appLogger.WithError(err).Error("Server forced to shutdown")
@@ -172,14 +412,429 @@ func main() {
 	appLogger.Info("Server exited")
 }
 
-func DependencyInjectionSection(logger *logrus.Logger, db *gorm.DB) *DISection {
+func DependencyInjectionSection(logger *logrus.Logger, db *gorm.DB, infra *Infra) *DISection {
 	repo := repository.NewRepo(logger, db)
-	srv := service.NewService(logger, repo)
+	tenantRepo := repository.NewTenantRepo(logger, db)
+	auditRepo := repository.NewAuditRepo(logger, db)
+	usageRepo := repository.NewUsageRepo(logger, db)
+	settingsRepo := repository.NewSettingsRepo(logger, db)
+	domainRepo := repository.NewDomainRepo(logger, db)
+	analyticsRepo := repository.NewAnalyticsRepo(logger, db)
+	growthRepo := repository.NewGrowthRepo(logger, db)
+	reportRepo := repository.NewReportRepo(logger, db)
+	reportScheduleRepo := repository.NewReportScheduleRepo(logger, db)
+	memberRepo := repository.NewMemberRepo(logger, db)
+	invitationRepo := repository.NewInvitationRepo(logger, db)
+	purchaseRepo := repository.NewPurchaseRepo(logger, db)
+	planRepo := repository.NewPlanRepo(logger, db)
+	subscriptionRepo := repository.NewSubscriptionRepo(logger, db)
+	invoiceRepo := repository.NewInvoiceRepo(logger, db)
+	paymentRepo := repository.NewPaymentRepo(logger, db)
+	couponRepo := repository.NewCouponRepo(logger, db)
+	catalogRepo := repository.NewCatalogRepo(logger, db)
+
+	catalogSrv := service.NewCatalogService(logger, service.CatalogDeps{
+		Repo:  catalogRepo,
+		Audit: auditRepo,
+		Bus:   infra.bus,
+		Jobs:  infra.jobs,
+		Hooks: hooks.NewSender([]byte(utils.GetEnv("SYSTEM_HOOK_SECRET", "")), utils.GetEnvAsDuration("SYSTEM_HOOK_TIMEOUT", 10*time.Second)),
+	}, service.CatalogConfig{
+		CacheTTL: utils.GetEnvAsDuration("CATALOG_CACHE_TTL", time.Minute),
+	})
+	catalogHandler := handler.NewCatalogHandler(catalogSrv)
+
+	entitlementSrv := service.NewEntitlementService(logger, service.EntitlementDeps{
+		Catalog:       catalogSrv,
+		Purchases:     purchaseRepo,
+		Subscriptions: subscriptionRepo,
+		Bus:           infra.bus,
+	}, service.EntitlementConfig{
+		CacheTTL: utils.GetEnvAsDuration("ENTITLEMENT_CACHE_TTL", time.Minute),
+	})
+
+	srv := service.NewService(logger, repo, tenantRepo, entitlementSrv)
+
+	tenantSrv := service.NewTenantService(logger, service.TenantDeps{
+		Repo:      tenantRepo,
+		Users:     repo,
+		Audit:     auditRepo,
+		DB:        db,
+		Isolation: infra.isolation,
+		Bus:       infra.bus,
+		Files:     infra.files,
+		Indexer:   infra.indexer,
+		Jobs:      infra.jobs,
+	}, service.TenantConfig{
+		DeletionGrace:    time.Duration(utils.GetEnvAsInt("TENANT_DELETION_GRACE_DAYS", 30)) * 24 * time.Hour,
+		ReportSigningKey: []byte(utils.GetEnv("DELETION_REPORT_SIGNING_KEY", "")),
+		ExportDir:        utils.GetEnv("EXPORT_DIR", "data/exports"),
+		ImportMaxBytes:   int64(utils.GetEnvAsInt("TENANT_IMPORT_MAX_MB", 2048)) << 20,
+	})
+	tenantHandler := handler.NewTenantHandler(tenantSrv)
+
+	planSrv := service.NewPlanService(logger, service.PlanDeps{
+		Catalog: catalogSrv,
+		Repo:    planRepo,
+		Audit:   auditRepo,
+		Bus:     infra.bus,
+	})
+	planHandler := handler.NewPlanHandler(planSrv)
+
+	couponSrv := service.NewCouponService(logger, service.CouponDeps{
+		Catalog:   catalogSrv,
+		Repo:      couponRepo,
+		Plans:     planRepo,
+		Purchases: purchaseRepo,
+		Audit:     auditRepo,
+		Bus:       infra.bus,
+	})
+	couponHandler := handler.NewCouponHandler(couponSrv)
+
+	paymentSrv := service.NewPaymentService(logger, service.PaymentDeps{
+		Repo:          paymentRepo,
+		Provider:      infra.payments,
+		DB:            db,
+		Plans:         planRepo,
+		Subscriptions: subscriptionRepo,
+		Users:         repo,
+		Audit:         auditRepo,
+		Bus:           infra.bus,
+		Coupons:       couponSrv,
+	}, service.PaymentConfig{
+		SuccessURL: utils.GetEnv("PAYMENT_SUCCESS_URL", ""),
+		CancelURL:  utils.GetEnv("PAYMENT_CANCEL_URL", ""),
+	})
+	paymentHandler := handler.NewPaymentHandler(paymentSrv)
+	// The simulator pays and expires any checkout, so it is only mounted on
+	// request and even then only for the root admin.
+	var paymentSimHandler handler.PaymentSimHandle
+	fake, ok := infra.payments.(*payments.FakeProvider)
+	if ok && infra.paymentSim != nil && utils.GetEnvAsBool("PAYMENT_SIMULATOR_ENABLED", false) {
+		paymentSimHandler = handler.NewPaymentSimHandler(fake, infra.paymentSim)
+	}
+	// Without a provider every charge succeeds, as before payments existed.
+	var charger service.Charger
+	if infra.payments != nil {
+		charger = paymentSrv
+	}
+
+	subscriptionSrv := service.NewSubscriptionService(logger, service.SubscriptionDeps{
+		Repo:      subscriptionRepo,
+		Plans:     planRepo,
+		Purchases: purchaseRepo,
+		Users:     repo,
+		Audit:     auditRepo,
+		Bus:       infra.bus,
+		Charger:   charger,
+		Coupons:   couponSrv,
+	}, service.SubscriptionConfig{
+		GracePeriod:   time.Duration(utils.GetEnvAsInt("SUBSCRIPTION_GRACE_DAYS", 7)) * 24 * time.Hour,
+		RetryInterval: utils.GetEnvAsDuration("SUBSCRIPTION_RETRY_INTERVAL", 24*time.Hour),
+	})
+	subscriptionHandler := handler.NewSubscriptionHandler(subscriptionSrv)
+
+	invoiceSrv := service.NewInvoiceService(logger, service.InvoiceDeps{
+		Repo:          invoiceRepo,
+		Subscriptions: subscriptionRepo,
+		Users:         repo,
+		Audit:         auditRepo,
+		Mailer:        infra.mailer,
+		Jobs:          infra.jobs,
+		Bus:           infra.bus,
+		Coupons:       couponRepo,
+	}, service.InvoiceConfig{
+		Dir:    utils.GetEnv("INVOICE_DIR", "data/invoices"),
+		Taxes:  invoiceTaxes(logger),
+		Brand:  utils.GetEnv("INVOICE_BRAND", "CMS"),
+		Issuer: utils.GetEnvAsList("INVOICE_ISSUER", nil),
+	})
+	invoiceHandler := handler.NewInvoiceHandler(invoiceSrv)
+
+	meteringSrv := service.NewMeteringService(logger, service.MeteringDeps{
+		Usage:     usageRepo,
+		Tenants:   tenantRepo,
+		Audit:     auditRepo,
+		DB:        db,
+		Isolation: infra.isolation,
+		Files:     infra.files,
+		Bus:       infra.bus,
+		Plans:     subscriptionSrv,
+	}, service.MeteringConfig{
+		Defaults:      quotaDefaults(),
+		LimitCacheTTL: utils.GetEnvAsDuration("QUOTA_CACHE_TTL", time.Minute),
+	})
+	usageHandler := handler.NewUsageHandler(meteringSrv)
+
+	settingsSrv := service.NewSettingsService(logger, service.SettingsDeps{
+		Repo:      settingsRepo,
+		Tenants:   tenantRepo,
+		Audit:     auditRepo,
+		DB:        db,
+		Isolation: infra.isolation,
+		Bus:       infra.bus,
+		Registry:  settings.Default(),
+	}, service.SettingsConfig{
+		CacheTTL: utils.GetEnvAsDuration("SETTINGS_CACHE_TTL", 30*time.Second),
+	})
+	settingsHandler := handler.NewSettingsHandler(settingsSrv)
+
+	domainSrv := service.NewDomainService(logger, service.DomainDeps{
+		Repo:     domainRepo,
+		Tenants:  tenantRepo,
+		Audit:    auditRepo,
+		Bus:      infra.bus,
+		Resolver: infra.resolver,
+	}, service.DomainConfig{
+		BaseDomain:   infra.baseDomain,
+		MaxPerTenant: utils.GetEnvAsInt("TENANT_MAX_DOMAINS", 5),
+		PendingTTL:   utils.GetEnvAsDuration("DOMAIN_PENDING_TTL", 7*24*time.Hour),
+		CacheTTL:     utils.GetEnvAsDuration("DOMAIN_CACHE_TTL", 30*time.Second),
+	})
+	domainHandler := handler.NewDomainHandler(domainSrv)
+
+	memberSrv := service.NewMemberService(logger, service.MemberDeps{
+		Repo:      memberRepo,
+		Tenants:   tenantRepo,
+		Users:     repo,
+		Audit:     auditRepo,
+		DB:        db,
+		Isolation: infra.isolation,
+		Bus:       infra.bus,
+	}, service.MemberConfig{
+		TransferTTL: utils.GetEnvAsDuration("TENANT_TRANSFER_TTL", 7*24*time.Hour),
+	})
+	memberHandler := handler.NewMemberHandler(memberSrv)
+
+	invitationSrv := service.NewInvitationService(logger, service.InvitationDeps{
+		Repo:      invitationRepo,
+		Tenants:   tenantRepo,
+		Members:   memberSrv,
+		Metering:  meteringSrv,
+		Audit:     auditRepo,
+		DB:        db,
+		Isolation: infra.isolation,
+		Mailer:    infra.mailer,
+		Bus:       infra.bus,
+	}, service.InvitationConfig{
+		SigningKey: []byte(utils.GetEnv("INVITATION_SIGNING_KEY", "")),
+		TTL:        utils.GetEnvAsDuration("INVITATION_TTL", 7*24*time.Hour),
+		AcceptURL:  utils.GetEnv("INVITATION_ACCEPT_URL", "http://localhost:3000/invitations/accept"),
+	})
+	invitationHandler := handler.NewInvitationHandler(invitationSrv)
+
+	purchaseSrv := service.NewPurchaseService(logger, service.PurchaseDeps{
+		Catalog:       catalogSrv,
+		Repo:          purchaseRepo,
+		Subscriptions: subscriptionRepo,
+		Users:         repo,
+		Audit:         auditRepo,
+		Bus:           infra.bus,
+	})
+	purchaseHandler := handler.NewPurchaseHandler(purchaseSrv, entitlementSrv)
+	systemGate := middleware.NewSystemGate(entitlementSrv, catalogSrv, planSrv, middleware.SystemGateConfig{
+		Gateway: middleware.GatewayConfig{
+			Secret:    []byte(utils.GetEnv("GATEWAY_SHARED_SECRET", "")),
+			Tolerance: utils.GetEnvAsDuration("GATEWAY_SIGNATURE_TOLERANCE", time.Minute),
+		},
+		PlansURL:    utils.GetEnv("UPGRADE_PLANS_URL", "/plans"),
+		CheckoutURL: utils.GetEnv("UPGRADE_CHECKOUT_URL", "/payments/checkout"),
+	})
+
+	analyticsSrv := service.NewAnalyticsService(logger, service.AnalyticsDeps{
+		Repo:      analyticsRepo,
+		Tenants:   tenantRepo,
+		DB:        db,
+		Isolation: infra.isolation,
+		Files:     infra.files,
+	}, service.AnalyticsConfig{
+		Concurrency:  utils.GetEnvAsInt("ANALYTICS_CONCURRENCY", 4),
+		ActiveWindow: utils.GetEnvAsDuration("ANALYTICS_ACTIVE_WINDOW", 30*24*time.Hour),
+		Retention:    time.Duration(utils.GetEnvAsInt("ANALYTICS_RETENTION_DAYS", 730)) * 24 * time.Hour,
+		MaxRange:     utils.GetEnvAsInt("ANALYTICS_MAX_RANGE_DAYS", 366),
+	})
+	analyticsHandler := handler.NewAnalyticsHandler(analyticsSrv)
+
+	growthSrv := service.NewGrowthService(logger, service.GrowthDeps{
+		Repo:    growthRepo,
+		Catalog: catalogSrv,
+	}, service.GrowthConfig{
+		CacheTTL:      utils.GetEnvAsDuration("GROWTH_CACHE_TTL", 2*time.Hour),
+		DefaultMonths: utils.GetEnvAsInt("GROWTH_DEFAULT_MONTHS", 12),
+		MaxMonths:     utils.GetEnvAsInt("GROWTH_MAX_MONTHS", 36),
+		Retention:     utils.GetEnvAsDuration("GROWTH_AGGREGATE_RETENTION", 7*24*time.Hour),
+	})
+	growthHandler := handler.NewGrowthHandler(growthSrv)
+
+	reportSrv := service.NewReportService(logger, service.ReportDeps{
+		Repo:      reportRepo,
+		Catalog:   catalogSrv,
+		Users:     repo,
+		Audit:     auditRepo,
+		Bus:       infra.bus,
+		Mailer:    infra.mailer,
+		Jobs:      infra.jobs,
+		Schedules: reportScheduleRepo,
+		Tenants:   tenantRepo,
+		DB:        db,
+		Isolation: infra.isolation,
+		Hooks:     hooks.NewSender([]byte(utils.GetEnv("REPORT_WEBHOOK_SECRET", "")), utils.GetEnvAsDuration("REPORT_WEBHOOK_TIMEOUT", 10*time.Second)),
+	}, service.ReportConfig{
+		ExportDir:       utils.GetEnv("REPORT_EXPORT_DIR", "data/exports/reports"),
+		SyncRows:        int64(utils.GetEnvAsInt("REPORT_EXPORT_SYNC_ROWS", 10000)),
+		DownloadURL:     utils.GetEnv("REPORT_EXPORT_URL", "/admin/reports/exports"),
+		ScheduleLease:   utils.GetEnvAsDuration("REPORT_SCHEDULE_LEASE", 15*time.Minute),
+		SnapshotMaxRows: utils.GetEnvAsInt("REPORT_SNAPSHOT_MAX_ROWS", 50000),
+		SnapshotKeep:    utils.GetEnvAsInt("REPORT_SNAPSHOT_KEEP", 50),
+	})
+	reportHandler := handler.NewReportHandler(reportSrv)
+
 	handler := handler.NewHandler(srv)
 
 	return &DISection{
 		repo:    repo,
 		srv:     srv,
 		handler: handler,
+
+		tenantRepo:    tenantRepo,
+		tenantSrv:     tenantSrv,
+		tenantHandler: tenantHandler,
+
+		meteringSrv:  meteringSrv,
+		usageHandler: usageHandler,
+
+		settingsSrv:     settingsSrv,
+		settingsHandler: settingsHandler,
+
+		domainSrv:     domainSrv,
+		domainHandler: domainHandler,
+
+		memberSrv:     memberSrv,
+		memberHandler: memberHandler,
+
+		invitationSrv:     invitationSrv,
+		invitationHandler: invitationHandler,
+
+		catalogSrv:     catalogSrv,
+		catalogHandler: catalogHandler,
+
+		purchaseSrv:     purchaseSrv,
+		entitlementSrv:  entitlementSrv,
+		purchaseHandler: purchaseHandler,
+		systemGate:      systemGate,
+
+		planHandler:         planHandler,
+		subscriptionSrv:     subscriptionSrv,
+		subscriptionHandler: subscriptionHandler,
+
+		invoiceSrv:     invoiceSrv,
+		invoiceHandler: invoiceHandler,
+
+		couponSrv:     couponSrv,
+		couponHandler: couponHandler,
+
+		paymentSrv:        paymentSrv,
+		paymentHandler:    paymentHandler,
+		paymentSimHandler: paymentSimHandler,
+
+		analyticsSrv:     analyticsSrv,
+		analyticsHandler: analyticsHandler,
+		growthSrv:        growthSrv,
+		growthHandler:    growthHandler,
+
+		reportSrv:     reportSrv,
+		reportHandler: reportHandler,
+	}
+}
+
+// quotaDefaults reads the platform-wide limits. Zero or unset means unlimited.
+func quotaDefaults() map[types.UsageMetric]int64 {
+	defaults := map[types.UsageMetric]int64{}
+	set := func(metric types.UsageMetric, limit int64) {
+		if limit > 0 {
+			defaults[metric] = limit
+		}
+	}
+	set(types.MetricUsers, int64(utils.GetEnvAsInt("QUOTA_MAX_USERS", 0)))
+	set(types.MetricCourses, int64(utils.GetEnvAsInt("QUOTA_MAX_COURSES", 0)))
+	set(types.MetricStorageBytes, int64(utils.GetEnvAsInt("QUOTA_MAX_STORAGE_MB", 0))<<20)
+	set(types.MetricAPICalls, int64(utils.GetEnvAsInt("QUOTA_MAX_API_CALLS_MONTHLY", 0)))
+	return defaults
+}
+
+// invoiceTaxes parses INVOICE_TAXES, a comma-separated list of label=percent
+// pairs such as "VAT=7.5". Malformed entries are skipped with a warning.
+func invoiceTaxes(logger *logrus.Logger) []service.InvoiceTax {
+	var taxes []service.InvoiceTax
+	for _, entry := range utils.GetEnvAsList("INVOICE_TAXES", nil) {
+		label, rate, ok := strings.Cut(entry, "=")
+		percent, err := strconv.ParseFloat(strings.TrimSpace(rate), 64)
+		if !ok || err != nil || percent < 0 || strings.TrimSpace(label) == "" {
+			logger.WithField("entry", entry).Warn("Ignoring malformed invoice tax")
+			continue
+		}
+		taxes = append(taxes, service.InvoiceTax{
+			Label:       strings.TrimSpace(label),
+			BasisPoints: int64(math.Round(percent * 100)),
+		})
+	}
+	return taxes
+}
+
+func newSearchIndexer() search.Indexer {
+	if url := utils.GetEnv("SEARCH_URL", ""); url != "" {
+		return search.NewElasticIndexer(url, utils.GetEnv("SEARCH_INDEX_PREFIX", "cms-"))
+	}
+	return search.NoopIndexer{}
+}
+
+// newMailer sends through SMTP_HOST when set and logs messages otherwise.
+func newMailer(logger *logrus.Logger) mailer.Mailer {
+	host := utils.GetEnv("SMTP_HOST", "")
+	if host == "" {
+		return mailer.NewLogMailer(logger)
+	}
+	return mailer.NewSMTPMailer(mailer.SMTPConfig{
+		Host:     host,
+		Port:     utils.GetEnvAsInt("SMTP_PORT", 587),
+		Username: utils.GetEnv("SMTP_USERNAME", ""),
+		Password: utils.GetEnv("SMTP_PASSWORD", ""),
+		From:     utils.GetEnv("MAIL_FROM", "no-reply@localhost"),
+	})
+}
+
+// newPaymentProvider picks the gateway named by PAYMENT_PROVIDER. The fake
+// provider comes with a simulator that posts its webhooks back to this
+// server. An empty or unknown name disables payments.
+func newPaymentProvider(logger *logrus.Logger) (payments.PaymentProvider, *payments.Simulator) {
+	secret := utils.GetEnv("PAYMENT_WEBHOOK_SECRET", "")
+	tolerance := utils.GetEnvAsDuration("PAYMENT_WEBHOOK_TOLERANCE", 5*time.Minute)
+	switch name := utils.GetEnv("PAYMENT_PROVIDER", ""); name {
+	case "":
+		return nil, nil
+	case "fake":
+		if secret == "" {
+			logger.Fatal("PAYMENT_WEBHOOK_SECRET is required for the fake payment provider")
+		}
+		local := "http://localhost:" + utils.GetEnv("PORT", "8080")
+		fake := payments.NewFakeProvider(secret, utils.GetEnv("PAYMENT_FAKE_CHECKOUT_URL", local+"/simulator/checkout"), tolerance)
+		return fake, payments.NewSimulator(logger, fake, utils.GetEnv("PAYMENT_WEBHOOK_URL", local+"/webhooks/payments"))
+	default:
+		logger.WithField("provider", name).Warn("Unknown payment provider; payments are disabled")
+		return nil, nil
+	}
+}
+
+func runEvery(ctx context.Context, interval time.Duration, job func()) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			job()
+		}
 	}
 }
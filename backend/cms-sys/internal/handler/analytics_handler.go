@@ -0,0 +1,118 @@
+package handler
+
+import (
+	"errors"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/service"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/types"
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/utils"
+)
+
+const analyticsDateLayout = "2006-01-02"
+
+type AnalyticsHandle interface {
+	Summary(c *fiber.Ctx) error
+	Series(c *fiber.Ctx) error
+	Tenants(c *fiber.Ctx) error
+	Collect(c *fiber.Ctx) error
+}
+
+type AnalyticsHandler struct {
+	service service.AnalyticsService
+}
+
+var _ AnalyticsHandle = (*AnalyticsHandler)(nil)
+
+func NewAnalyticsHandler(service service.AnalyticsService) *AnalyticsHandler {
+	return &AnalyticsHandler{
+		service: service,
+	}
+}
+
+func (h *AnalyticsHandler) Summary(c *fiber.Ctx) error {
+	from, to, err := dateRange(c)
+	if err != nil {
+		return utils.BadRequestResponse(c, "Invalid date range", err.Error())
+	}
+
+	summary, err := h.service.Summary(from, to)
+	if err != nil {
+		return analyticsErrorResponse(c, err)
+	}
+
+	return utils.SuccessResponse(c, "Analytics summary retrieved successfully", summary)
+}
+
+func (h *AnalyticsHandler) Series(c *fiber.Ctx) error {
+	from, to, err := dateRange(c)
+	if err != nil {
+		return utils.BadRequestResponse(c, "Invalid date range", err.Error())
+	}
+
+	metric := types.PlatformMetricName(c.Query("metric", string(types.AnalyticsUsers)))
+	series, err := h.service.Series(metric, c.Query("namespace"), from, to)
+	if err != nil {
+		return analyticsErrorResponse(c, err)
+	}
+
+	return utils.SuccessResponse(c, "Analytics series retrieved successfully", series)
+}
+
+func (h *AnalyticsHandler) Tenants(c *fiber.Ctx) error {
+	day := time.Now()
+	if raw := c.Query("day"); raw != "" {
+		parsed, err := time.Parse(analyticsDateLayout, raw)
+		if err != nil {
+			return utils.BadRequestResponse(c, "Invalid day", "use YYYY-MM-DD")
+		}
+		day = parsed
+	}
+
+	tenants, err := h.service.Tenants(day)
+	if err != nil {
+		return analyticsErrorResponse(c, err)
+	}
+
+	return utils.SuccessResponse(c, "Tenant analytics retrieved successfully", tenants)
+}
+
+// Collect takes a snapshot now instead of waiting for the next scheduled run.
+func (h *AnalyticsHandler) Collect(c *fiber.Ctx) error {
+	report, err := h.service.Collect(c.UserContext())
+	if err != nil {
+		return analyticsErrorResponse(c, err)
+	}
+
+	return utils.SuccessResponse(c, "Analytics collected", report)
+}
+
+// dateRange reads the optional from and to query parameters as whole days.
+func dateRange(c *fiber.Ctx) (time.Time, time.Time, error) {
+	var from, to time.Time
+	var err error
+	if raw := c.Query("from"); raw != "" {
+		if from, err = time.Parse(analyticsDateLayout, raw); err != nil {
+			return from, to, errors.New("from must be YYYY-MM-DD")
+		}
+	}
+	if raw := c.Query("to"); raw != "" {
+		if to, err = time.Parse(analyticsDateLayout, raw); err != nil {
+			return from, to, errors.New("to must be YYYY-MM-DD")
+		}
+	}
+	return from, to, nil
+}
+
+func analyticsErrorResponse(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, service.ErrInvalidMetric), errors.Is(err, service.ErrInvalidRange):
+		return utils.BadRequestResponse(c, err.Error(), nil)
+	case errors.Is(err, service.ErrUnknownTenant):
+		return utils.NotFoundResponse(c, err.Error())
+	default:
+		return utils.InternalServerErrorResponse(c, err.Error(), nil)
+	}
+}
@@ -0,0 +1,118 @@
+package handler
+
+import (
+	"errors"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/service"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/types"
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/utils"
+)
+
+type CatalogHandle interface {
+	List(c *fiber.Ctx) error
+	AdminList(c *fiber.Ctx) error
+	Get(c *fiber.Ctx) error
+	Create(c *fiber.Ctx) error
+	Update(c *fiber.Ctx) error
+	Disable(c *fiber.Ctx) error
+}
+
+type CatalogHandler struct {
+	service   service.CatalogService
+	validator *validator.Validate
+}
+
+var _ CatalogHandle = (*CatalogHandler)(nil)
+
+func NewCatalogHandler(service service.CatalogService) *CatalogHandler {
+	return &CatalogHandler{
+		service:   service,
+		validator: validator.New(),
+	}
+}
+
+// List shows the systems on sale.
+func (h *CatalogHandler) List(c *fiber.Ctx) error {
+	systems, err := h.service.Listings()
+	if err != nil {
+		return catalogErrorResponse(c, err)
+	}
+
+	return utils.SuccessResponse(c, "Systems retrieved successfully", systems)
+}
+
+func (h *CatalogHandler) AdminList(c *fiber.Ctx) error {
+	systems, err := h.service.ListSystems(true)
+	if err != nil {
+		return catalogErrorResponse(c, err)
+	}
+
+	return utils.SuccessResponse(c, "Systems retrieved successfully", systems)
+}
+
+func (h *CatalogHandler) Get(c *fiber.Ctx) error {
+	system, err := h.service.GetSystem(systemParam(c))
+	if err != nil {
+		return catalogErrorResponse(c, err)
+	}
+
+	return utils.SuccessResponse(c, "System retrieved successfully", system)
+}
+
+func (h *CatalogHandler) Create(c *fiber.Ctx) error {
+	var req types.CreateSystemRequest
+	if err := c.BodyParser(&req); err != nil {
+		return utils.BadRequestResponse(c, "Invalid request body", err.Error())
+	}
+
+	if err := h.validator.Struct(&req); err != nil {
+		return utils.BadRequestResponse(c, "Validation failed", err.Error())
+	}
+
+	system, err := h.service.CreateSystem(actorID(c), &req)
+	if err != nil {
+		return catalogErrorResponse(c, err)
+	}
+
+	return utils.CreatedResponse(c, "System created successfully", system)
+}
+
+func (h *CatalogHandler) Update(c *fiber.Ctx) error {
+	var req types.SystemRequest
+	if err := c.BodyParser(&req); err != nil {
+		return utils.BadRequestResponse(c, "Invalid request body", err.Error())
+	}
+
+	if err := h.validator.Struct(&req); err != nil {
+		return utils.BadRequestResponse(c, "Validation failed", err.Error())
+	}
+
+	system, err := h.service.UpdateSystem(systemParam(c), actorID(c), &req)
+	if err != nil {
+		return catalogErrorResponse(c, err)
+	}
+
+	return utils.SuccessResponse(c, "System updated successfully", system)
+}
+
+func (h *CatalogHandler) Disable(c *fiber.Ctx) error {
+	if err := h.service.DisableSystem(systemParam(c), actorID(c)); err != nil {
+		return catalogErrorResponse(c, err)
+	}
+
+	return utils.SuccessResponse(c, "System disabled successfully", nil)
+}
+
+func catalogErrorResponse(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, service.ErrSystemNotFound):
+		return utils.NotFoundResponse(c, err.Error())
+	case errors.Is(err, service.ErrSystemCodeUsed):
+		return utils.ConflictResponse(c, err.Error(), nil)
+	default:
+		return utils.InternalServerErrorResponse(c, err.Error(), nil)
+	}
+}
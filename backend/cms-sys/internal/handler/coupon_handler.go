@@ -0,0 +1,178 @@
+package handler
+
+import (
+	"errors"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/service"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/types"
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/utils"
+)
+
+type CouponHandle interface {
+	Quote(c *fiber.Ctx) error
+	List(c *fiber.Ctx) error
+	Get(c *fiber.Ctx) error
+	Create(c *fiber.Ctx) error
+	Update(c *fiber.Ctx) error
+	Disable(c *fiber.Ctx) error
+	Report(c *fiber.Ctx) error
+}
+
+type CouponHandler struct {
+	service   service.CouponService
+	validator *validator.Validate
+}
+
+var _ CouponHandle = (*CouponHandler)(nil)
+
+func NewCouponHandler(service service.CouponService) *CouponHandler {
+	return &CouponHandler{
+		service:   service,
+		validator: validator.New(),
+	}
+}
+
+// Quote shows a customer what the coupon takes off ?plan= before they
+// subscribe.
+func (h *CouponHandler) Quote(c *fiber.Ctx) error {
+	actor := actorID(c)
+	if actor == nil {
+		return utils.UnauthorizedResponse(c, "Authentication required")
+	}
+	plan := c.Query("plan")
+	if plan == "" {
+		return utils.BadRequestResponse(c, "plan is required", nil)
+	}
+
+	quote, err := h.service.Quote(*actor, c.Params("code"), plan)
+	if err != nil {
+		return couponErrorResponse(c, err)
+	}
+
+	return utils.SuccessResponse(c, "Coupon applies", quote)
+}
+
+func (h *CouponHandler) List(c *fiber.Ctx) error {
+	coupons, err := h.service.ListCoupons()
+	if err != nil {
+		return couponErrorResponse(c, err)
+	}
+
+	return utils.SuccessResponse(c, "Coupons retrieved successfully", coupons)
+}
+
+func (h *CouponHandler) Get(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return couponErrorResponse(c, service.ErrCouponNotFound)
+	}
+
+	coupon, err := h.service.GetCoupon(id)
+	if err != nil {
+		return couponErrorResponse(c, err)
+	}
+
+	return utils.SuccessResponse(c, "Coupon retrieved successfully", coupon)
+}
+
+func (h *CouponHandler) Create(c *fiber.Ctx) error {
+	var req types.CouponRequest
+	if err := c.BodyParser(&req); err != nil {
+		return utils.BadRequestResponse(c, "Invalid request body", err.Error())
+	}
+
+	if err := h.validator.Struct(&req); err != nil {
+		return utils.BadRequestResponse(c, "Validation failed", err.Error())
+	}
+
+	coupon, err := h.service.CreateCoupon(actorID(c), &req)
+	if err != nil {
+		return couponErrorResponse(c, err)
+	}
+
+	return utils.CreatedResponse(c, "Coupon created successfully", coupon)
+}
+
+func (h *CouponHandler) Update(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return couponErrorResponse(c, service.ErrCouponNotFound)
+	}
+
+	var req types.CouponRequest
+	if err := c.BodyParser(&req); err != nil {
+		return utils.BadRequestResponse(c, "Invalid request body", err.Error())
+	}
+
+	if err := h.validator.Struct(&req); err != nil {
+		return utils.BadRequestResponse(c, "Validation failed", err.Error())
+	}
+
+	coupon, err := h.service.UpdateCoupon(id, actorID(c), &req)
+	if err != nil {
+		return couponErrorResponse(c, err)
+	}
+
+	return utils.SuccessResponse(c, "Coupon updated successfully", coupon)
+}
+
+func (h *CouponHandler) Disable(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return couponErrorResponse(c, service.ErrCouponNotFound)
+	}
+
+	if err := h.service.DisableCoupon(id, actorID(c)); err != nil {
+		return couponErrorResponse(c, err)
+	}
+
+	return utils.SuccessResponse(c, "Coupon disabled successfully", nil)
+}
+
+func (h *CouponHandler) Report(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return couponErrorResponse(c, service.ErrCouponNotFound)
+	}
+
+	report, err := h.service.Report(id)
+	if err != nil {
+		return couponErrorResponse(c, err)
+	}
+
+	return utils.SuccessResponse(c, "Coupon redemptions retrieved successfully", report)
+}
+
+// isCouponError reports errors of redeeming a coupon, which subscription and
+// payment handlers answer through couponErrorResponse.
+func isCouponError(err error) bool {
+	for _, target := range []error{
+		service.ErrCouponNotFound, service.ErrInvalidCoupon, service.ErrCouponCodeUsed,
+		service.ErrCouponExpired, service.ErrCouponUnavailable, service.ErrCouponNotEligible,
+		service.ErrCouponRedeemed,
+	} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+func couponErrorResponse(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, service.ErrCouponNotFound), errors.Is(err, service.ErrPlanNotFound):
+		return utils.NotFoundResponse(c, err.Error())
+	case errors.Is(err, service.ErrInvalidCoupon), errors.Is(err, service.ErrInvalidSystem):
+		return utils.BadRequestResponse(c, err.Error(), nil)
+	case errors.Is(err, service.ErrCouponCodeUsed), errors.Is(err, service.ErrCouponExpired),
+		errors.Is(err, service.ErrCouponUnavailable), errors.Is(err, service.ErrCouponNotEligible),
+		errors.Is(err, service.ErrCouponRedeemed):
+		return utils.ConflictResponse(c, err.Error(), nil)
+	default:
+		return utils.InternalServerErrorResponse(c, err.Error(), nil)
+	}
+}
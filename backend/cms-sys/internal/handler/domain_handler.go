@@ -0,0 +1,92 @@
+package handler
+
+import (
+	"errors"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/service"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/types"
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/utils"
+)
+
+type DomainHandle interface {
+	List(c *fiber.Ctx) error
+	Add(c *fiber.Ctx) error
+	Verify(c *fiber.Ctx) error
+	Remove(c *fiber.Ctx) error
+}
+
+type DomainHandler struct {
+	service   service.DomainService
+	validator *validator.Validate
+}
+
+var _ DomainHandle = (*DomainHandler)(nil)
+
+func NewDomainHandler(service service.DomainService) *DomainHandler {
+	return &DomainHandler{
+		service:   service,
+		validator: validator.New(),
+	}
+}
+
+func (h *DomainHandler) List(c *fiber.Ctx) error {
+	domains, err := h.service.ListDomains(c.Params("namespace"))
+	if err != nil {
+		return domainErrorResponse(c, err)
+	}
+
+	return utils.SuccessResponse(c, "Domains retrieved successfully", domains)
+}
+
+func (h *DomainHandler) Add(c *fiber.Ctx) error {
+	var req types.AddDomainRequest
+	if err := c.BodyParser(&req); err != nil {
+		return utils.BadRequestResponse(c, "Invalid request body", err.Error())
+	}
+
+	if err := h.validator.Struct(&req); err != nil {
+		return utils.BadRequestResponse(c, "Validation failed", err.Error())
+	}
+
+	domain, err := h.service.AddDomain(c.Params("namespace"), req.Domain, actorID(c))
+	if err != nil {
+		return domainErrorResponse(c, err)
+	}
+
+	return utils.CreatedResponse(c, "Domain added, publish the challenge record to verify it", domain)
+}
+
+func (h *DomainHandler) Verify(c *fiber.Ctx) error {
+	domain, err := h.service.VerifyDomain(c.Params("namespace"), c.Params("domain"), actorID(c))
+	if err != nil {
+		return domainErrorResponse(c, err)
+	}
+
+	return utils.SuccessResponse(c, "Domain verified successfully", domain)
+}
+
+func (h *DomainHandler) Remove(c *fiber.Ctx) error {
+	if err := h.service.RemoveDomain(c.Params("namespace"), c.Params("domain"), actorID(c)); err != nil {
+		return domainErrorResponse(c, err)
+	}
+
+	return utils.SuccessResponse(c, "Domain removed successfully", nil)
+}
+
+func domainErrorResponse(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, service.ErrUnknownTenant), errors.Is(err, service.ErrDomainNotFound):
+		return utils.NotFoundResponse(c, err.Error())
+	case errors.Is(err, service.ErrDomainTaken), errors.Is(err, service.ErrDomainLimit):
+		return utils.ConflictResponse(c, "Domain could not be added", err.Error())
+	case errors.Is(err, service.ErrDomainReserved):
+		return utils.BadRequestResponse(c, "Domain could not be added", err.Error())
+	case errors.Is(err, service.ErrChallengeNotFound):
+		return utils.BadRequestResponse(c, "Domain verification failed", err.Error())
+	default:
+		return utils.InternalServerErrorResponse(c, err.Error(), nil)
+	}
+}
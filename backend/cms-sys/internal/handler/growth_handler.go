@@ -0,0 +1,143 @@
+package handler
+
+import (
+	"errors"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/service"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/types"
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/utils"
+)
+
+const growthMonthLayout = "2006-01"
+
+type GrowthHandle interface {
+	Cohorts(c *fiber.Ctx) error
+	Funnel(c *fiber.Ctx) error
+	MRR(c *fiber.Ctx) error
+	Churn(c *fiber.Ctx) error
+	Revenue(c *fiber.Ctx) error
+	Refresh(c *fiber.Ctx) error
+}
+
+type GrowthHandler struct {
+	service service.GrowthService
+}
+
+var _ GrowthHandle = (*GrowthHandler)(nil)
+
+func NewGrowthHandler(service service.GrowthService) *GrowthHandler {
+	return &GrowthHandler{
+		service: service,
+	}
+}
+
+func (h *GrowthHandler) Cohorts(c *fiber.Ctx) error {
+	query, err := growthQuery(c)
+	if err != nil {
+		return utils.BadRequestResponse(c, "Invalid month range", err.Error())
+	}
+
+	matrix, err := h.service.Cohorts(query, c.QueryBool("refresh", false))
+	if err != nil {
+		return growthErrorResponse(c, err)
+	}
+
+	return utils.SuccessResponse(c, "Cohorts retrieved successfully", matrix)
+}
+
+func (h *GrowthHandler) Funnel(c *fiber.Ctx) error {
+	query, err := growthQuery(c)
+	if err != nil {
+		return utils.BadRequestResponse(c, "Invalid month range", err.Error())
+	}
+	query.System = types.SystemType(c.Query("system"))
+
+	funnel, err := h.service.Funnel(query, c.QueryBool("refresh", false))
+	if err != nil {
+		return growthErrorResponse(c, err)
+	}
+
+	return utils.SuccessResponse(c, "Conversion funnel retrieved successfully", funnel)
+}
+
+func (h *GrowthHandler) MRR(c *fiber.Ctx) error {
+	query, err := growthQuery(c)
+	if err != nil {
+		return utils.BadRequestResponse(c, "Invalid month range", err.Error())
+	}
+
+	series, err := h.service.MRR(query, c.QueryBool("refresh", false))
+	if err != nil {
+		return growthErrorResponse(c, err)
+	}
+
+	return utils.SuccessResponse(c, "MRR retrieved successfully", series)
+}
+
+func (h *GrowthHandler) Churn(c *fiber.Ctx) error {
+	query, err := growthQuery(c)
+	if err != nil {
+		return utils.BadRequestResponse(c, "Invalid month range", err.Error())
+	}
+
+	series, err := h.service.Churn(query, c.QueryBool("refresh", false))
+	if err != nil {
+		return growthErrorResponse(c, err)
+	}
+
+	return utils.SuccessResponse(c, "Churn retrieved successfully", series)
+}
+
+func (h *GrowthHandler) Revenue(c *fiber.Ctx) error {
+	query, err := growthQuery(c)
+	if err != nil {
+		return utils.BadRequestResponse(c, "Invalid month range", err.Error())
+	}
+
+	revenue, err := h.service.Revenue(query, c.QueryBool("refresh", false))
+	if err != nil {
+		return growthErrorResponse(c, err)
+	}
+
+	return utils.SuccessResponse(c, "Revenue by system retrieved successfully", revenue)
+}
+
+// Refresh computes the default aggregates now instead of waiting for the next
+// scheduled run.
+func (h *GrowthHandler) Refresh(c *fiber.Ctx) error {
+	report, err := h.service.Refresh(c.UserContext())
+	if err != nil {
+		return growthErrorResponse(c, err)
+	}
+
+	return utils.SuccessResponse(c, "Growth aggregates refreshed", report)
+}
+
+// growthQuery reads the optional from and to query parameters as months.
+func growthQuery(c *fiber.Ctx) (types.GrowthQuery, error) {
+	var query types.GrowthQuery
+	var err error
+	if raw := c.Query("from"); raw != "" {
+		if query.From, err = time.Parse(growthMonthLayout, raw); err != nil {
+			return query, errors.New("from must be YYYY-MM")
+		}
+	}
+	if raw := c.Query("to"); raw != "" {
+		if query.To, err = time.Parse(growthMonthLayout, raw); err != nil {
+			return query, errors.New("to must be YYYY-MM")
+		}
+	}
+	return query, nil
+}
+
+func growthErrorResponse(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, service.ErrInvalidRange), errors.Is(err, service.ErrInvalidSystem):
+		return utils.BadRequestResponse(c, err.Error(), nil)
+	default:
+		return utils.InternalServerErrorResponse(c, err.Error(), nil)
+	}
+}
@@ -0,0 +1,136 @@
+package handler
+
+import (
+	"errors"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/middleware"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/service"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/types"
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/utils"
+)
+
+type InvitationHandle interface {
+	List(c *fiber.Ctx) error
+	Invite(c *fiber.Ctx) error
+	Resend(c *fiber.Ctx) error
+	Revoke(c *fiber.Ctx) error
+	Preview(c *fiber.Ctx) error
+	Accept(c *fiber.Ctx) error
+}
+
+type InvitationHandler struct {
+	service   service.InvitationService
+	validator *validator.Validate
+}
+
+var _ InvitationHandle = (*InvitationHandler)(nil)
+
+func NewInvitationHandler(service service.InvitationService) *InvitationHandler {
+	return &InvitationHandler{
+		service:   service,
+		validator: validator.New(),
+	}
+}
+
+func (h *InvitationHandler) List(c *fiber.Ctx) error {
+	invitations, err := h.service.ListInvitations(c.Params("namespace"), actorID(c))
+	if err != nil {
+		return invitationErrorResponse(c, err)
+	}
+
+	return utils.SuccessResponse(c, "Invitations retrieved successfully", invitations)
+}
+
+func (h *InvitationHandler) Invite(c *fiber.Ctx) error {
+	var req types.InviteMemberRequest
+	if err := c.BodyParser(&req); err != nil {
+		return utils.BadRequestResponse(c, "Invalid request body", err.Error())
+	}
+
+	if err := h.validator.Struct(&req); err != nil {
+		return utils.BadRequestResponse(c, "Validation failed", err.Error())
+	}
+
+	invitation, err := h.service.Invite(c.Params("namespace"), actorID(c), &req)
+	if err != nil {
+		return invitationErrorResponse(c, err)
+	}
+
+	return utils.CreatedResponse(c, "Invitation sent successfully", invitation)
+}
+
+func (h *InvitationHandler) Resend(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return invitationErrorResponse(c, service.ErrInvitationNotFound)
+	}
+
+	invitation, err := h.service.Resend(c.Params("namespace"), id, actorID(c))
+	if err != nil {
+		return invitationErrorResponse(c, err)
+	}
+
+	return utils.SuccessResponse(c, "Invitation resent successfully", invitation)
+}
+
+func (h *InvitationHandler) Revoke(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return invitationErrorResponse(c, service.ErrInvitationNotFound)
+	}
+
+	if err := h.service.Revoke(c.Params("namespace"), id, actorID(c)); err != nil {
+		return invitationErrorResponse(c, err)
+	}
+
+	return utils.SuccessResponse(c, "Invitation revoked successfully", nil)
+}
+
+func (h *InvitationHandler) Preview(c *fiber.Ctx) error {
+	preview, err := h.service.Preview(c.Query("token"))
+	if err != nil {
+		return invitationErrorResponse(c, err)
+	}
+
+	return utils.SuccessResponse(c, "Invitation retrieved successfully", preview)
+}
+
+func (h *InvitationHandler) Accept(c *fiber.Ctx) error {
+	var req types.AcceptInvitationRequest
+	if err := c.BodyParser(&req); err != nil {
+		return utils.BadRequestResponse(c, "Invalid request body", err.Error())
+	}
+
+	if err := h.validator.Struct(&req); err != nil {
+		return utils.BadRequestResponse(c, "Validation failed", err.Error())
+	}
+
+	acceptance, err := h.service.Accept(&req)
+	if err != nil {
+		return invitationErrorResponse(c, err)
+	}
+
+	return utils.SuccessResponse(c, "Invitation accepted successfully", acceptance)
+}
+
+func invitationErrorResponse(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, service.ErrUnknownTenant), errors.Is(err, service.ErrInvitationNotFound):
+		return utils.NotFoundResponse(c, err.Error())
+	case errors.Is(err, service.ErrAccountCredentials):
+		return utils.UnauthorizedResponse(c, err.Error())
+	case errors.Is(err, service.ErrNotTenantOwner), errors.Is(err, service.ErrStudentMembership),
+		errors.Is(err, service.ErrTenantSuspended), errors.Is(err, service.ErrAccountOtherTenant):
+		return utils.ForbiddenResponse(c, err.Error())
+	case errors.Is(err, service.ErrInvitationPending):
+		return utils.ConflictResponse(c, err.Error(), nil)
+	case errors.Is(err, service.ErrInvitationInvalid), errors.Is(err, service.ErrPasswordRequired):
+		return utils.BadRequestResponse(c, err.Error(), nil)
+	default:
+		return middleware.QuotaErrorResponse(c, err)
+	}
+}
@@ -0,0 +1,143 @@
+package handler
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/service"
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/utils"
+)
+
+type InvoiceHandle interface {
+	List(c *fiber.Ctx) error
+	Get(c *fiber.Ctx) error
+	Download(c *fiber.Ctx) error
+	AdminList(c *fiber.Ctx) error
+	AdminGet(c *fiber.Ctx) error
+	AdminDownload(c *fiber.Ctx) error
+	Resend(c *fiber.Ctx) error
+}
+
+type InvoiceHandler struct {
+	service service.InvoiceService
+}
+
+var _ InvoiceHandle = (*InvoiceHandler)(nil)
+
+func NewInvoiceHandler(service service.InvoiceService) *InvoiceHandler {
+	return &InvoiceHandler{
+		service: service,
+	}
+}
+
+func (h *InvoiceHandler) List(c *fiber.Ctx) error {
+	actor := actorID(c)
+	if actor == nil {
+		return utils.UnauthorizedResponse(c, "Authentication required")
+	}
+
+	return h.list(c, actor)
+}
+
+func (h *InvoiceHandler) Get(c *fiber.Ctx) error {
+	actor := actorID(c)
+	if actor == nil {
+		return utils.UnauthorizedResponse(c, "Authentication required")
+	}
+
+	return h.get(c, actor)
+}
+
+func (h *InvoiceHandler) Download(c *fiber.Ctx) error {
+	actor := actorID(c)
+	if actor == nil {
+		return utils.UnauthorizedResponse(c, "Authentication required")
+	}
+
+	return h.download(c, actor)
+}
+
+// AdminList shows every invoice, optionally narrowed by ?customer_id=.
+func (h *InvoiceHandler) AdminList(c *fiber.Ctx) error {
+	var customerID *uuid.UUID
+	if raw := c.Query("customer_id"); raw != "" {
+		id, err := uuid.Parse(raw)
+		if err != nil {
+			return utils.BadRequestResponse(c, "Invalid customer_id", err.Error())
+		}
+		customerID = &id
+	}
+
+	return h.list(c, customerID)
+}
+
+func (h *InvoiceHandler) AdminGet(c *fiber.Ctx) error {
+	return h.get(c, nil)
+}
+
+func (h *InvoiceHandler) AdminDownload(c *fiber.Ctx) error {
+	return h.download(c, nil)
+}
+
+func (h *InvoiceHandler) Resend(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return invoiceErrorResponse(c, service.ErrInvoiceNotFound)
+	}
+
+	if err := h.service.Resend(id, actorID(c)); err != nil {
+		return invoiceErrorResponse(c, err)
+	}
+
+	return utils.SuccessResponse(c, "Invoice sent successfully", nil)
+}
+
+func (h *InvoiceHandler) list(c *fiber.Ctx, customerID *uuid.UUID) error {
+	invoices, err := h.service.ListInvoices(customerID)
+	if err != nil {
+		return invoiceErrorResponse(c, err)
+	}
+
+	return utils.SuccessResponse(c, "Invoices retrieved successfully", invoices)
+}
+
+func (h *InvoiceHandler) get(c *fiber.Ctx, customerID *uuid.UUID) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return invoiceErrorResponse(c, service.ErrInvoiceNotFound)
+	}
+
+	invoice, err := h.service.GetInvoice(id, customerID)
+	if err != nil {
+		return invoiceErrorResponse(c, err)
+	}
+
+	return utils.SuccessResponse(c, "Invoice retrieved successfully", invoice)
+}
+
+func (h *InvoiceHandler) download(c *fiber.Ctx, customerID *uuid.UUID) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return invoiceErrorResponse(c, service.ErrInvoiceNotFound)
+	}
+
+	invoice, path, err := h.service.InvoiceFile(id, customerID)
+	if err != nil {
+		return invoiceErrorResponse(c, err)
+	}
+
+	return c.Download(path, invoice.Number+".pdf")
+}
+
+func invoiceErrorResponse(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, service.ErrInvoiceNotFound):
+		return utils.NotFoundResponse(c, err.Error())
+	case errors.Is(err, service.ErrInvoicesDisabled):
+		return utils.ServiceUnavailableResponse(c, err.Error())
+	default:
+		return utils.InternalServerErrorResponse(c, err.Error(), nil)
+	}
+}
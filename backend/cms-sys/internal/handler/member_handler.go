@@ -0,0 +1,225 @@
+package handler
+
+import (
+	"errors"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/service"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/types"
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/utils"
+)
+
+type MemberHandle interface {
+	List(c *fiber.Ctx) error
+	Add(c *fiber.Ctx) error
+	Update(c *fiber.Ctx) error
+	Remove(c *fiber.Ctx) error
+	ListTransfers(c *fiber.Ctx) error
+	InitiateTransfer(c *fiber.Ctx) error
+	CancelTransfer(c *fiber.Ctx) error
+	Incoming(c *fiber.Ctx) error
+	Accept(c *fiber.Ctx) error
+	Decline(c *fiber.Ctx) error
+	ForceTransfer(c *fiber.Ctx) error
+}
+
+type MemberHandler struct {
+	service   service.MemberService
+	validator *validator.Validate
+}
+
+var _ MemberHandle = (*MemberHandler)(nil)
+
+func NewMemberHandler(service service.MemberService) *MemberHandler {
+	return &MemberHandler{
+		service:   service,
+		validator: validator.New(),
+	}
+}
+
+func (h *MemberHandler) List(c *fiber.Ctx) error {
+	members, err := h.service.ListMembers(c.Params("namespace"))
+	if err != nil {
+		return memberErrorResponse(c, err)
+	}
+
+	return utils.SuccessResponse(c, "Members retrieved successfully", members)
+}
+
+func (h *MemberHandler) Add(c *fiber.Ctx) error {
+	var req types.AddMemberRequest
+	if err := c.BodyParser(&req); err != nil {
+		return utils.BadRequestResponse(c, "Invalid request body", err.Error())
+	}
+
+	if err := h.validator.Struct(&req); err != nil {
+		return utils.BadRequestResponse(c, "Validation failed", err.Error())
+	}
+
+	member, err := h.service.AddMember(c.Params("namespace"), actorID(c), &req)
+	if err != nil {
+		return memberErrorResponse(c, err)
+	}
+
+	return utils.CreatedResponse(c, "Member added successfully", member)
+}
+
+func (h *MemberHandler) Update(c *fiber.Ctx) error {
+	userID, err := uuid.Parse(c.Params("userID"))
+	if err != nil {
+		return memberErrorResponse(c, service.ErrMemberNotFound)
+	}
+
+	var req types.UpdateMemberRequest
+	if err := c.BodyParser(&req); err != nil {
+		return utils.BadRequestResponse(c, "Invalid request body", err.Error())
+	}
+
+	if err := h.validator.Struct(&req); err != nil {
+		return utils.BadRequestResponse(c, "Validation failed", err.Error())
+	}
+
+	member, err := h.service.UpdateMember(c.Params("namespace"), userID, actorID(c), &req)
+	if err != nil {
+		return memberErrorResponse(c, err)
+	}
+
+	return utils.SuccessResponse(c, "Member updated successfully", member)
+}
+
+func (h *MemberHandler) Remove(c *fiber.Ctx) error {
+	userID, err := uuid.Parse(c.Params("userID"))
+	if err != nil {
+		return memberErrorResponse(c, service.ErrMemberNotFound)
+	}
+
+	if err := h.service.RemoveMember(c.Params("namespace"), userID, actorID(c)); err != nil {
+		return memberErrorResponse(c, err)
+	}
+
+	return utils.SuccessResponse(c, "Member removed successfully", nil)
+}
+
+func (h *MemberHandler) ListTransfers(c *fiber.Ctx) error {
+	transfers, err := h.service.ListTransfers(c.Params("namespace"))
+	if err != nil {
+		return memberErrorResponse(c, err)
+	}
+
+	return utils.SuccessResponse(c, "Transfers retrieved successfully", transfers)
+}
+
+func (h *MemberHandler) InitiateTransfer(c *fiber.Ctx) error {
+	req, err := h.transferRequest(c)
+	if err != nil {
+		return utils.BadRequestResponse(c, "Validation failed", err.Error())
+	}
+
+	transfer, err := h.service.InitiateTransfer(c.Params("namespace"), actorID(c), req)
+	if err != nil {
+		return memberErrorResponse(c, err)
+	}
+
+	return utils.CreatedResponse(c, "Transfer offered, waiting for the recipient to accept", transfer)
+}
+
+func (h *MemberHandler) CancelTransfer(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return memberErrorResponse(c, service.ErrTransferNotFound)
+	}
+
+	transfer, err := h.service.CancelTransfer(c.Params("namespace"), id, actorID(c))
+	if err != nil {
+		return memberErrorResponse(c, err)
+	}
+
+	return utils.SuccessResponse(c, "Transfer cancelled successfully", transfer)
+}
+
+func (h *MemberHandler) Incoming(c *fiber.Ctx) error {
+	actor := actorID(c)
+	if actor == nil {
+		return utils.UnauthorizedResponse(c, "Authentication required")
+	}
+
+	transfers, err := h.service.IncomingTransfers(*actor)
+	if err != nil {
+		return memberErrorResponse(c, err)
+	}
+
+	return utils.SuccessResponse(c, "Transfers retrieved successfully", transfers)
+}
+
+func (h *MemberHandler) Accept(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return memberErrorResponse(c, service.ErrTransferNotFound)
+	}
+
+	transfer, err := h.service.AcceptTransfer(id, actorID(c))
+	if err != nil {
+		return memberErrorResponse(c, err)
+	}
+
+	return utils.SuccessResponse(c, "Ownership transferred successfully", transfer)
+}
+
+func (h *MemberHandler) Decline(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return memberErrorResponse(c, service.ErrTransferNotFound)
+	}
+
+	transfer, err := h.service.DeclineTransfer(id, actorID(c))
+	if err != nil {
+		return memberErrorResponse(c, err)
+	}
+
+	return utils.SuccessResponse(c, "Transfer declined successfully", transfer)
+}
+
+func (h *MemberHandler) ForceTransfer(c *fiber.Ctx) error {
+	req, err := h.transferRequest(c)
+	if err != nil {
+		return utils.BadRequestResponse(c, "Validation failed", err.Error())
+	}
+
+	transfer, err := h.service.ForceTransfer(c.Params("namespace"), actorID(c), req)
+	if err != nil {
+		return memberErrorResponse(c, err)
+	}
+
+	return utils.SuccessResponse(c, "Ownership transferred successfully", transfer)
+}
+
+func (h *MemberHandler) transferRequest(c *fiber.Ctx) (*types.TransferOwnershipRequest, error) {
+	var req types.TransferOwnershipRequest
+	if err := c.BodyParser(&req); err != nil {
+		return nil, err
+	}
+	if err := h.validator.Struct(&req); err != nil {
+		return nil, err
+	}
+	return &req, nil
+}
+
+func memberErrorResponse(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, service.ErrUnknownTenant), errors.Is(err, service.ErrMemberNotFound),
+		errors.Is(err, service.ErrTransferNotFound):
+		return utils.NotFoundResponse(c, err.Error())
+	case errors.Is(err, service.ErrUserNotFound), errors.Is(err, service.ErrTransferSelf):
+		return utils.BadRequestResponse(c, err.Error(), nil)
+	case errors.Is(err, service.ErrNotTenantOwner):
+		return utils.ForbiddenResponse(c, err.Error())
+	case errors.Is(err, service.ErrPrimaryOwner), errors.Is(err, service.ErrTransferPending),
+		errors.Is(err, service.ErrTransferClosed):
+		return utils.ConflictResponse(c, err.Error(), nil)
+	default:
+		return utils.InternalServerErrorResponse(c, err.Error(), nil)
+	}
+}
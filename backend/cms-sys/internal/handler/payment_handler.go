@@ -0,0 +1,169 @@
+package handler
+
+import (
+	"errors"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/service"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/types"
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/payments"
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/utils"
+)
+
+type PaymentHandle interface {
+	Checkout(c *fiber.Ctx) error
+	Checkouts(c *fiber.Ctx) error
+	Payments(c *fiber.Ctx) error
+	AdminPayments(c *fiber.Ctx) error
+	Refund(c *fiber.Ctx) error
+	Webhook(c *fiber.Ctx) error
+}
+
+type PaymentHandler struct {
+	service   service.PaymentService
+	validator *validator.Validate
+}
+
+var _ PaymentHandle = (*PaymentHandler)(nil)
+
+func NewPaymentHandler(service service.PaymentService) *PaymentHandler {
+	return &PaymentHandler{
+		service:   service,
+		validator: validator.New(),
+	}
+}
+
+func (h *PaymentHandler) Checkout(c *fiber.Ctx) error {
+	actor := actorID(c)
+	if actor == nil {
+		return utils.UnauthorizedResponse(c, "Authentication required")
+	}
+
+	var req types.SubscribeRequest
+	if err := c.BodyParser(&req); err != nil {
+		return utils.BadRequestResponse(c, "Invalid request body", err.Error())
+	}
+
+	if err := h.validator.Struct(&req); err != nil {
+		return utils.BadRequestResponse(c, "Validation failed", err.Error())
+	}
+
+	checkout, err := h.service.Checkout(*actor, &req)
+	if err != nil {
+		return paymentErrorResponse(c, err)
+	}
+
+	return utils.CreatedResponse(c, "Checkout created successfully", checkout)
+}
+
+func (h *PaymentHandler) Checkouts(c *fiber.Ctx) error {
+	actor := actorID(c)
+	if actor == nil {
+		return utils.UnauthorizedResponse(c, "Authentication required")
+	}
+
+	checkouts, err := h.service.ListCheckouts(*actor)
+	if err != nil {
+		return paymentErrorResponse(c, err)
+	}
+
+	return utils.SuccessResponse(c, "Checkouts retrieved successfully", checkouts)
+}
+
+func (h *PaymentHandler) Payments(c *fiber.Ctx) error {
+	actor := actorID(c)
+	if actor == nil {
+		return utils.UnauthorizedResponse(c, "Authentication required")
+	}
+
+	return h.payments(c, actor)
+}
+
+// AdminPayments shows every payment, optionally narrowed by ?customer_id=.
+func (h *PaymentHandler) AdminPayments(c *fiber.Ctx) error {
+	var customerID *uuid.UUID
+	if raw := c.Query("customer_id"); raw != "" {
+		id, err := uuid.Parse(raw)
+		if err != nil {
+			return utils.BadRequestResponse(c, "Invalid customer_id", err.Error())
+		}
+		customerID = &id
+	}
+
+	return h.payments(c, customerID)
+}
+
+func (h *PaymentHandler) Refund(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return paymentErrorResponse(c, service.ErrPaymentNotFound)
+	}
+
+	var req types.RefundRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return utils.BadRequestResponse(c, "Invalid request body", err.Error())
+		}
+	}
+
+	if err := h.validator.Struct(&req); err != nil {
+		return utils.BadRequestResponse(c, "Validation failed", err.Error())
+	}
+
+	refund, err := h.service.Refund(id, actorID(c), &req)
+	if err != nil {
+		return paymentErrorResponse(c, err)
+	}
+
+	return utils.AcceptedResponse(c, "Refund requested successfully", refund)
+}
+
+// Webhook receives provider events. Anything but a 2xx makes the provider
+// deliver the event again later.
+func (h *PaymentHandler) Webhook(c *fiber.Ctx) error {
+	duplicate, err := h.service.HandleWebhook(c.Body(), c.Get(payments.SignatureHeader))
+	if err != nil {
+		return paymentErrorResponse(c, err)
+	}
+
+	if duplicate {
+		return utils.SuccessResponse(c, "Event already processed", nil)
+	}
+	return utils.SuccessResponse(c, "Event processed successfully", nil)
+}
+
+func (h *PaymentHandler) payments(c *fiber.Ctx, customerID *uuid.UUID) error {
+	list, err := h.service.ListPayments(customerID)
+	if err != nil {
+		return paymentErrorResponse(c, err)
+	}
+
+	return utils.SuccessResponse(c, "Payments retrieved successfully", list)
+}
+
+func paymentErrorResponse(c *fiber.Ctx, err error) error {
+	switch {
+	case isCouponError(err):
+		return couponErrorResponse(c, err)
+	case errors.Is(err, service.ErrInvalidWebhook), errors.Is(err, service.ErrFreePlan),
+		errors.Is(err, service.ErrNothingDue):
+		return utils.BadRequestResponse(c, err.Error(), nil)
+	case errors.Is(err, service.ErrUserNotFound), errors.Is(err, service.ErrPlanNotFound),
+		errors.Is(err, service.ErrPaymentNotFound):
+		return utils.NotFoundResponse(c, err.Error())
+	case errors.Is(err, service.ErrNotCustomer):
+		return utils.ForbiddenResponse(c, err.Error())
+	case errors.Is(err, service.ErrAlreadySubscribed), errors.Is(err, service.ErrPlanRetired),
+		errors.Is(err, service.ErrRefundNotAllowed):
+		return utils.ConflictResponse(c, err.Error(), nil)
+	case errors.Is(err, service.ErrPaymentProvider):
+		return utils.BadGatewayResponse(c, err.Error(), nil)
+	case errors.Is(err, service.ErrPaymentsDisabled):
+		return utils.ServiceUnavailableResponse(c, err.Error())
+	default:
+		return utils.InternalServerErrorResponse(c, err.Error(), nil)
+	}
+}
@@ -0,0 +1,105 @@
+package handler
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/types"
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/payments"
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/utils"
+)
+
+// PaymentSimHandle stands in for the fake provider's hosted pages and lets a
+// developer drive its webhooks. It is only mounted with the fake provider.
+type PaymentSimHandle interface {
+	Session(c *fiber.Ctx) error
+	Complete(c *fiber.Ctx) error
+	Expire(c *fiber.Ctx) error
+	Replay(c *fiber.Ctx) error
+	Decline(c *fiber.Ctx) error
+}
+
+type PaymentSimHandler struct {
+	provider  *payments.FakeProvider
+	simulator *payments.Simulator
+}
+
+var _ PaymentSimHandle = (*PaymentSimHandler)(nil)
+
+func NewPaymentSimHandler(provider *payments.FakeProvider, simulator *payments.Simulator) *PaymentSimHandler {
+	return &PaymentSimHandler{
+		provider:  provider,
+		simulator: simulator,
+	}
+}
+
+// simulatedDelivery is what the simulator reports after posting an event.
+type simulatedDelivery struct {
+	Event         *payments.Event `json:"event"`
+	WebhookStatus int             `json:"webhook_status"`
+}
+
+func (h *PaymentSimHandler) Session(c *fiber.Ctx) error {
+	session, err := h.provider.Session(c.Params("id"))
+	if err != nil {
+		return simErrorResponse(c, err)
+	}
+
+	return utils.SuccessResponse(c, "Checkout session retrieved successfully", session)
+}
+
+// Complete pays the session as the customer would on the hosted page.
+func (h *PaymentSimHandler) Complete(c *fiber.Ctx) error {
+	event, status, err := h.simulator.Complete(c.UserContext(), c.Params("id"))
+	return h.delivered(c, event, status, err)
+}
+
+func (h *PaymentSimHandler) Expire(c *fiber.Ctx) error {
+	event, status, err := h.simulator.Expire(c.UserContext(), c.Params("id"))
+	return h.delivered(c, event, status, err)
+}
+
+// Replay delivers an earlier event again to exercise deduplication.
+func (h *PaymentSimHandler) Replay(c *fiber.Ctx) error {
+	event, status, err := h.simulator.Replay(c.UserContext(), c.Params("id"))
+	return h.delivered(c, event, status, err)
+}
+
+// Decline makes the customer's card decline off-session charges, or work
+// again.
+func (h *PaymentSimHandler) Decline(c *fiber.Ctx) error {
+	var req types.SimulateDeclineRequest
+	if err := c.BodyParser(&req); err != nil {
+		return utils.BadRequestResponse(c, "Invalid request body", err.Error())
+	}
+
+	if err := h.provider.SetDeclining(c.Params("id"), req.Decline); err != nil {
+		return simErrorResponse(c, err)
+	}
+
+	return utils.SuccessResponse(c, "Customer updated successfully", req)
+}
+
+func (h *PaymentSimHandler) delivered(c *fiber.Ctx, event *payments.Event, status int, err error) error {
+	if event == nil {
+		return simErrorResponse(c, err)
+	}
+	delivery := simulatedDelivery{Event: event, WebhookStatus: status}
+	if err != nil {
+		return utils.BadGatewayResponse(c, "Webhook delivery failed", fiber.Map{"delivery": delivery, "error": err.Error()})
+	}
+
+	return utils.SuccessResponse(c, "Event delivered successfully", delivery)
+}
+
+func simErrorResponse(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, payments.ErrNotFound):
+		return utils.NotFoundResponse(c, err.Error())
+	case errors.Is(err, payments.ErrCardDeclined):
+		return utils.PaymentRequiredResponse(c, err.Error(), nil)
+	default:
+		return utils.ConflictResponse(c, err.Error(), nil)
+	}
+}
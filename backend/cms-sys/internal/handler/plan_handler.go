@@ -0,0 +1,136 @@
+package handler
+
+import (
+	"errors"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/service"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/types"
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/utils"
+)
+
+type PlanHandle interface {
+	List(c *fiber.Ctx) error
+	AdminList(c *fiber.Ctx) error
+	Get(c *fiber.Ctx) error
+	Create(c *fiber.Ctx) error
+	Update(c *fiber.Ctx) error
+	Retire(c *fiber.Ctx) error
+}
+
+type PlanHandler struct {
+	service   service.PlanService
+	validator *validator.Validate
+}
+
+var _ PlanHandle = (*PlanHandler)(nil)
+
+func NewPlanHandler(service service.PlanService) *PlanHandler {
+	return &PlanHandler{
+		service:   service,
+		validator: validator.New(),
+	}
+}
+
+// List shows the plans open to new subscriptions.
+func (h *PlanHandler) List(c *fiber.Ctx) error {
+	plans, err := h.service.ListPlans(false)
+	if err != nil {
+		return planErrorResponse(c, err)
+	}
+
+	return utils.SuccessResponse(c, "Plans retrieved successfully", plans)
+}
+
+func (h *PlanHandler) AdminList(c *fiber.Ctx) error {
+	plans, err := h.service.ListPlans(true)
+	if err != nil {
+		return planErrorResponse(c, err)
+	}
+
+	return utils.SuccessResponse(c, "Plans retrieved successfully", plans)
+}
+
+func (h *PlanHandler) Get(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return planErrorResponse(c, service.ErrPlanNotFound)
+	}
+
+	plan, err := h.service.GetPlan(id)
+	if err != nil {
+		return planErrorResponse(c, err)
+	}
+
+	return utils.SuccessResponse(c, "Plan retrieved successfully", plan)
+}
+
+func (h *PlanHandler) Create(c *fiber.Ctx) error {
+	var req types.PlanRequest
+	if err := c.BodyParser(&req); err != nil {
+		return utils.BadRequestResponse(c, "Invalid request body", err.Error())
+	}
+
+	if err := h.validator.Struct(&req); err != nil {
+		return utils.BadRequestResponse(c, "Validation failed", err.Error())
+	}
+
+	plan, err := h.service.CreatePlan(actorID(c), &req)
+	if err != nil {
+		return planErrorResponse(c, err)
+	}
+
+	return utils.CreatedResponse(c, "Plan created successfully", plan)
+}
+
+func (h *PlanHandler) Update(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return planErrorResponse(c, service.ErrPlanNotFound)
+	}
+
+	var req types.PlanRequest
+	if err := c.BodyParser(&req); err != nil {
+		return utils.BadRequestResponse(c, "Invalid request body", err.Error())
+	}
+
+	if err := h.validator.Struct(&req); err != nil {
+		return utils.BadRequestResponse(c, "Validation failed", err.Error())
+	}
+
+	plan, err := h.service.UpdatePlan(id, actorID(c), &req)
+	if err != nil {
+		return planErrorResponse(c, err)
+	}
+
+	return utils.SuccessResponse(c, "Plan updated successfully", plan)
+}
+
+func (h *PlanHandler) Retire(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return planErrorResponse(c, service.ErrPlanNotFound)
+	}
+
+	if err := h.service.RetirePlan(id, actorID(c)); err != nil {
+		return planErrorResponse(c, err)
+	}
+
+	return utils.SuccessResponse(c, "Plan retired successfully", nil)
+}
+
+func planErrorResponse(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, service.ErrPlanNotFound):
+		return utils.NotFoundResponse(c, err.Error())
+	case errors.Is(err, service.ErrInvalidSystem):
+		return utils.BadRequestResponse(c, err.Error(), nil)
+	case errors.Is(err, service.ErrPlanCodeUsed), errors.Is(err, service.ErrSystemNotSold):
+		return utils.ConflictResponse(c, err.Error(), nil)
+	default:
+		return utils.InternalServerErrorResponse(c, err.Error(), nil)
+	}
+}
@@ -0,0 +1,193 @@
+package handler
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/middleware"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/service"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/types"
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/utils"
+)
+
+type PurchaseHandle interface {
+	List(c *fiber.Ctx) error
+	Purchase(c *fiber.Ctx) error
+	Cancel(c *fiber.Ctx) error
+	Entitlement(c *fiber.Ctx) error
+	SystemAccess(c *fiber.Ctx) error
+	CustomerPurchases(c *fiber.Ctx) error
+	Grant(c *fiber.Ctx) error
+	Revoke(c *fiber.Ctx) error
+}
+
+type PurchaseHandler struct {
+	service      service.PurchaseService
+	entitlements service.EntitlementService
+	validator    *validator.Validate
+}
+
+var _ PurchaseHandle = (*PurchaseHandler)(nil)
+
+func NewPurchaseHandler(service service.PurchaseService, entitlements service.EntitlementService) *PurchaseHandler {
+	return &PurchaseHandler{
+		service:      service,
+		entitlements: entitlements,
+		validator:    validator.New(),
+	}
+}
+
+func (h *PurchaseHandler) List(c *fiber.Ctx) error {
+	actor := actorID(c)
+	if actor == nil {
+		return utils.UnauthorizedResponse(c, "Authentication required")
+	}
+
+	purchases, err := h.service.ListPurchases(*actor)
+	if err != nil {
+		return purchaseErrorResponse(c, err)
+	}
+
+	return utils.SuccessResponse(c, "Purchases retrieved successfully", purchases)
+}
+
+func (h *PurchaseHandler) Purchase(c *fiber.Ctx) error {
+	actor := actorID(c)
+	if actor == nil {
+		return utils.UnauthorizedResponse(c, "Authentication required")
+	}
+
+	var req types.PurchaseRequest
+	if err := c.BodyParser(&req); err != nil {
+		return utils.BadRequestResponse(c, "Invalid request body", err.Error())
+	}
+
+	if err := h.validator.Struct(&req); err != nil {
+		return utils.BadRequestResponse(c, "Validation failed", err.Error())
+	}
+
+	purchase, err := h.service.Purchase(*actor, &req)
+	if err != nil {
+		return purchaseErrorResponse(c, err)
+	}
+
+	return utils.CreatedResponse(c, "Purchase completed successfully", purchase)
+}
+
+func (h *PurchaseHandler) Cancel(c *fiber.Ctx) error {
+	actor := actorID(c)
+	if actor == nil {
+		return utils.UnauthorizedResponse(c, "Authentication required")
+	}
+
+	if err := h.service.Cancel(*actor, systemParam(c), actor); err != nil {
+		return purchaseErrorResponse(c, err)
+	}
+
+	return utils.SuccessResponse(c, "Purchase cancelled successfully", nil)
+}
+
+func (h *PurchaseHandler) Entitlement(c *fiber.Ctx) error {
+	actor := actorID(c)
+	if actor == nil {
+		return utils.UnauthorizedResponse(c, "Authentication required")
+	}
+
+	entitlement, err := h.entitlements.Entitlement(*actor, systemParam(c))
+	if err != nil {
+		return purchaseErrorResponse(c, err)
+	}
+
+	return utils.SuccessResponse(c, "Entitlement retrieved successfully", entitlement)
+}
+
+// SystemAccess answers behind middleware.SystemGate so clients and the
+// gateway can probe whether the caller may use a system.
+func (h *PurchaseHandler) SystemAccess(c *fiber.Ctx) error {
+	claims := middleware.Claims(c)
+	if claims == nil {
+		return utils.UnauthorizedResponse(c, "Authentication required")
+	}
+
+	return utils.SuccessResponse(c, "System access granted", types.SystemAccess{
+		System:    middleware.GrantedSystem(c),
+		UserID:    claims.UserID.String(),
+		Role:      claims.Role,
+		Namespace: claims.Namespace,
+	})
+}
+
+func (h *PurchaseHandler) CustomerPurchases(c *fiber.Ctx) error {
+	customerID, err := uuid.Parse(c.Params("userID"))
+	if err != nil {
+		return purchaseErrorResponse(c, service.ErrUserNotFound)
+	}
+
+	purchases, err := h.service.ListPurchases(customerID)
+	if err != nil {
+		return purchaseErrorResponse(c, err)
+	}
+
+	return utils.SuccessResponse(c, "Purchases retrieved successfully", purchases)
+}
+
+func (h *PurchaseHandler) Grant(c *fiber.Ctx) error {
+	customerID, err := uuid.Parse(c.Params("userID"))
+	if err != nil {
+		return purchaseErrorResponse(c, service.ErrUserNotFound)
+	}
+
+	var req types.PurchaseRequest
+	if err := c.BodyParser(&req); err != nil {
+		return utils.BadRequestResponse(c, "Invalid request body", err.Error())
+	}
+
+	if err := h.validator.Struct(&req); err != nil {
+		return utils.BadRequestResponse(c, "Validation failed", err.Error())
+	}
+
+	purchase, err := h.service.Grant(customerID, actorID(c), &req)
+	if err != nil {
+		return purchaseErrorResponse(c, err)
+	}
+
+	return utils.CreatedResponse(c, "Purchase granted successfully", purchase)
+}
+
+func (h *PurchaseHandler) Revoke(c *fiber.Ctx) error {
+	customerID, err := uuid.Parse(c.Params("userID"))
+	if err != nil {
+		return purchaseErrorResponse(c, service.ErrUserNotFound)
+	}
+
+	if err := h.service.Cancel(customerID, systemParam(c), actorID(c)); err != nil {
+		return purchaseErrorResponse(c, err)
+	}
+
+	return utils.SuccessResponse(c, "Purchase revoked successfully", nil)
+}
+
+func systemParam(c *fiber.Ctx) types.SystemType {
+	return types.SystemType(strings.ToUpper(c.Params("system")))
+}
+
+func purchaseErrorResponse(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, service.ErrUserNotFound), errors.Is(err, service.ErrPurchaseNotFound):
+		return utils.NotFoundResponse(c, err.Error())
+	case errors.Is(err, service.ErrInvalidSystem):
+		return utils.BadRequestResponse(c, err.Error(), nil)
+	case errors.Is(err, service.ErrNotCustomer):
+		return utils.ForbiddenResponse(c, err.Error())
+	case errors.Is(err, service.ErrAlreadyPurchased), errors.Is(err, service.ErrSystemNotSold):
+		return utils.ConflictResponse(c, err.Error(), nil)
+	case errors.Is(err, service.ErrSubscriptionRequired):
+		return utils.PaymentRequiredResponse(c, err.Error(), nil)
+	default:
+		return utils.InternalServerErrorResponse(c, err.Error(), nil)
+	}
+}
@@ -0,0 +1,335 @@
+package handler
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/service"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/types"
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/tabular"
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/utils"
+)
+
+type ReportHandle interface {
+	CustomerPurchases(c *fiber.Ctx) error
+	SystemUsage(c *fiber.Ctx) error
+	ExportStatus(c *fiber.Ctx) error
+	DownloadExport(c *fiber.Ctx) error
+
+	ListSchedules(c *fiber.Ctx) error
+	GetSchedule(c *fiber.Ctx) error
+	CreateSchedule(c *fiber.Ctx) error
+	UpdateSchedule(c *fiber.Ctx) error
+	DeleteSchedule(c *fiber.Ctx) error
+	RunSchedule(c *fiber.Ctx) error
+	Snapshots(c *fiber.Ctx) error
+	Snapshot(c *fiber.Ctx) error
+}
+
+type ReportHandler struct {
+	service   service.ReportService
+	validator *validator.Validate
+}
+
+var _ ReportHandle = (*ReportHandler)(nil)
+
+func NewReportHandler(service service.ReportService) *ReportHandler {
+	return &ReportHandler{
+		service:   service,
+		validator: validator.New(),
+	}
+}
+
+func (h *ReportHandler) CustomerPurchases(c *fiber.Ctx) error {
+	filter, err := reportFilter(c)
+	if err != nil {
+		return utils.BadRequestResponse(c, "Invalid report filter", err.Error())
+	}
+	filter.Sort = c.Query("sort")
+	switch strings.ToLower(c.Query("order", "asc")) {
+	case "asc":
+	case "desc":
+		filter.Desc = true
+	default:
+		return utils.BadRequestResponse(c, "Invalid report filter", "order must be asc or desc")
+	}
+	if c.Query("format") != "" {
+		return h.export(c, types.ReportCustomerPurchases, filter)
+	}
+
+	page, limit := paginationParams(c)
+	filter.Limit = limit
+	filter.Offset = (page - 1) * limit
+	rows, total, err := h.service.CustomerPurchases(filter)
+	if err != nil {
+		return reportErrorResponse(c, err)
+	}
+
+	return utils.PaginatedSuccessResponse(c, "Customer purchases retrieved successfully", rows, newPagination(page, limit, total))
+}
+
+func (h *ReportHandler) SystemUsage(c *fiber.Ctx) error {
+	filter, err := reportFilter(c)
+	if err != nil {
+		return utils.BadRequestResponse(c, "Invalid report filter", err.Error())
+	}
+	if c.Query("format") != "" {
+		return h.export(c, types.ReportSystemUsage, filter)
+	}
+
+	rows, err := h.service.SystemUsage(filter)
+	if err != nil {
+		return reportErrorResponse(c, err)
+	}
+
+	return utils.SuccessResponse(c, "System usage retrieved successfully", rows)
+}
+
+func (h *ReportHandler) ExportStatus(c *fiber.Ctx) error {
+	job, err := h.exportJob(c)
+	if err != nil {
+		return reportErrorResponse(c, err)
+	}
+
+	return utils.SuccessResponse(c, "Export retrieved successfully", job)
+}
+
+func (h *ReportHandler) DownloadExport(c *fiber.Ctx) error {
+	job, err := h.exportJob(c)
+	if err != nil {
+		return reportErrorResponse(c, err)
+	}
+	if job.Status != types.JobSucceeded {
+		return utils.ConflictResponse(c, service.ErrExportNotReady.Error(), job.Status)
+	}
+
+	return c.Download(job.ResultPath, filepath.Base(job.ResultPath))
+}
+
+func (h *ReportHandler) ListSchedules(c *fiber.Ctx) error {
+	schedules, err := h.service.ListSchedules()
+	if err != nil {
+		return reportErrorResponse(c, err)
+	}
+
+	return utils.SuccessResponse(c, "Report schedules retrieved successfully", schedules)
+}
+
+func (h *ReportHandler) GetSchedule(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return reportErrorResponse(c, service.ErrReportScheduleNotFound)
+	}
+
+	schedule, err := h.service.GetSchedule(id)
+	if err != nil {
+		return reportErrorResponse(c, err)
+	}
+
+	return utils.SuccessResponse(c, "Report schedule retrieved successfully", schedule)
+}
+
+func (h *ReportHandler) CreateSchedule(c *fiber.Ctx) error {
+	var req types.ReportScheduleRequest
+	if err := c.BodyParser(&req); err != nil {
+		return utils.BadRequestResponse(c, "Invalid request body", err.Error())
+	}
+
+	if err := h.validator.Struct(&req); err != nil {
+		return utils.BadRequestResponse(c, "Validation failed", err.Error())
+	}
+
+	schedule, err := h.service.CreateSchedule(actorID(c), &req)
+	if err != nil {
+		return reportErrorResponse(c, err)
+	}
+
+	return utils.CreatedResponse(c, "Report schedule created successfully", schedule)
+}
+
+func (h *ReportHandler) UpdateSchedule(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return reportErrorResponse(c, service.ErrReportScheduleNotFound)
+	}
+
+	var req types.ReportScheduleRequest
+	if err := c.BodyParser(&req); err != nil {
+		return utils.BadRequestResponse(c, "Invalid request body", err.Error())
+	}
+
+	if err := h.validator.Struct(&req); err != nil {
+		return utils.BadRequestResponse(c, "Validation failed", err.Error())
+	}
+
+	schedule, err := h.service.UpdateSchedule(id, actorID(c), &req)
+	if err != nil {
+		return reportErrorResponse(c, err)
+	}
+
+	return utils.SuccessResponse(c, "Report schedule updated successfully", schedule)
+}
+
+func (h *ReportHandler) DeleteSchedule(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return reportErrorResponse(c, service.ErrReportScheduleNotFound)
+	}
+
+	if err := h.service.DeleteSchedule(id, actorID(c)); err != nil {
+		return reportErrorResponse(c, err)
+	}
+
+	return utils.SuccessResponse(c, "Report schedule deleted successfully", nil)
+}
+
+// RunSchedule runs a schedule now. It answers 202 with the job when the run
+// happens in the background.
+func (h *ReportHandler) RunSchedule(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return reportErrorResponse(c, service.ErrReportScheduleNotFound)
+	}
+
+	job, err := h.service.RunSchedule(id, actorID(c))
+	if err != nil {
+		return reportErrorResponse(c, err)
+	}
+	if job != nil {
+		return utils.AcceptedResponse(c, "Report schedule run started", job)
+	}
+
+	return utils.SuccessResponse(c, "Report schedule ran successfully", nil)
+}
+
+func (h *ReportHandler) Snapshots(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return reportErrorResponse(c, service.ErrReportScheduleNotFound)
+	}
+
+	page, limit := paginationParams(c)
+	snapshots, total, err := h.service.Snapshots(id, page, limit)
+	if err != nil {
+		return reportErrorResponse(c, err)
+	}
+
+	return utils.PaginatedSuccessResponse(c, "Report snapshots retrieved successfully", snapshots, newPagination(page, limit, total))
+}
+
+func (h *ReportHandler) Snapshot(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return reportErrorResponse(c, service.ErrReportScheduleNotFound)
+	}
+	version, err := strconv.Atoi(c.Params("version"))
+	if err != nil {
+		return reportErrorResponse(c, service.ErrReportSnapshotNotFound)
+	}
+
+	snapshot, err := h.service.Snapshot(id, version)
+	if err != nil {
+		return reportErrorResponse(c, err)
+	}
+
+	return utils.SuccessResponse(c, "Report snapshot retrieved successfully", snapshot)
+}
+
+// export answers with the whole report in the requested format. Small reports
+// are streamed; large ones start a job and answer 202 with it.
+func (h *ReportHandler) export(c *fiber.Ctx, report types.ReportName, filter types.ReportFilter) error {
+	format, err := tabular.ParseFormat(c.Query("format"))
+	if err != nil {
+		return utils.BadRequestResponse(c, err.Error(), "use csv, xlsx or ndjson")
+	}
+
+	export, err := h.service.Export(report, filter, format, actorID(c), c.QueryBool("async", false))
+	if err != nil {
+		return reportErrorResponse(c, err)
+	}
+	if export.Job != nil {
+		return utils.AcceptedResponse(c, "Export started", export)
+	}
+
+	c.Attachment(export.Filename)
+	c.Set(fiber.HeaderContentType, export.ContentType)
+	// Errors past this point can only cut the download short; the service
+	// logs them.
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		if err := export.Write(utils.GetContext(), w); err == nil {
+			w.Flush()
+		}
+	})
+	return nil
+}
+
+func (h *ReportHandler) exportJob(c *fiber.Ctx) (*types.Job, error) {
+	jobID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return nil, service.ErrJobNotFound
+	}
+	return h.service.ExportJob(jobID)
+}
+
+// reportFilter reads the filters shared by every report. to is inclusive in
+// the query string and exclusive in the filter.
+func reportFilter(c *fiber.Ctx) (types.ReportFilter, error) {
+	from, to, err := dateRange(c)
+	if err != nil {
+		return types.ReportFilter{}, err
+	}
+	if !to.IsZero() {
+		to = to.AddDate(0, 0, 1)
+	}
+	filter := types.ReportFilter{
+		System: types.SystemType(c.Query("system")),
+		From:   from,
+		To:     to,
+	}
+	if filter.Verified, err = boolQuery(c, "verified"); err != nil {
+		return filter, err
+	}
+	if filter.Active, err = boolQuery(c, "active"); err != nil {
+		return filter, err
+	}
+	return filter, nil
+}
+
+// boolQuery parses an optional true/false query parameter.
+func boolQuery(c *fiber.Ctx, key string) (*bool, error) {
+	raw := c.Query(key)
+	if raw == "" {
+		return nil, nil
+	}
+	value, err := strconv.ParseBool(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be true or false", key)
+	}
+	return &value, nil
+}
+
+func reportErrorResponse(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, service.ErrInvalidSort), errors.Is(err, service.ErrInvalidSystem), errors.Is(err, service.ErrInvalidRange):
+		return utils.BadRequestResponse(c, err.Error(), nil)
+	case errors.Is(err, service.ErrInvalidSchedule), errors.Is(err, service.ErrSnapshotTooLarge):
+		return utils.BadRequestResponse(c, err.Error(), nil)
+	case errors.Is(err, service.ErrJobNotFound), errors.Is(err, service.ErrReportScheduleNotFound),
+		errors.Is(err, service.ErrReportSnapshotNotFound), errors.Is(err, service.ErrUnknownTenant):
+		return utils.NotFoundResponse(c, err.Error())
+	case errors.Is(err, service.ErrScheduleRunning):
+		return utils.ConflictResponse(c, err.Error(), nil)
+	case errors.Is(err, service.ErrExportsDisabled):
+		return utils.ServiceUnavailableResponse(c, err.Error())
+	default:
+		return utils.InternalServerErrorResponse(c, err.Error(), nil)
+	}
+}
@@ -1,2 +1,45 @@
 package handler
 
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/middleware"
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/utils"
+)
+
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+)
+
+func paginationParams(c *fiber.Ctx) (int, int) {
+	page := c.QueryInt("page", 1)
+	if page < 1 {
+		page = 1
+	}
+	limit := c.QueryInt("limit", defaultPageLimit)
+	if limit < 1 || limit > maxPageLimit {
+		limit = defaultPageLimit
+	}
+	return page, limit
+}
+
+func newPagination(page, limit int, total int64) utils.Pagination {
+	return utils.Pagination{
+		Page:       page,
+		Limit:      limit,
+		Total:      total,
+		TotalPages: int((total + int64(limit) - 1) / int64(limit)),
+	}
+}
+
+// actorID returns the authenticated caller, or nil for unauthenticated routes.
+func actorID(c *fiber.Ctx) *uuid.UUID {
+	claims := middleware.Claims(c)
+	if claims == nil {
+		return nil
+	}
+	id := claims.UserID
+	return &id
+}
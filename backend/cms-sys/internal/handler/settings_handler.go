@@ -0,0 +1,125 @@
+package handler
+
+import (
+	"errors"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/service"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/settings"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/types"
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/utils"
+)
+
+type SettingsHandle interface {
+	ListGlobal(c *fiber.Ctx) error
+	SetGlobal(c *fiber.Ctx) error
+	ResetGlobal(c *fiber.Ctx) error
+	ListTenant(c *fiber.Ctx) error
+	SetTenant(c *fiber.Ctx) error
+	ResetTenant(c *fiber.Ctx) error
+}
+
+type SettingsHandler struct {
+	service   service.SettingsService
+	validator *validator.Validate
+}
+
+var _ SettingsHandle = (*SettingsHandler)(nil)
+
+func NewSettingsHandler(service service.SettingsService) *SettingsHandler {
+	return &SettingsHandler{
+		service:   service,
+		validator: validator.New(),
+	}
+}
+
+func (h *SettingsHandler) ListGlobal(c *fiber.Ctx) error {
+	list, err := h.service.ListGlobal()
+	if err != nil {
+		return settingsErrorResponse(c, err)
+	}
+
+	return utils.SuccessResponse(c, "Settings retrieved successfully", list)
+}
+
+func (h *SettingsHandler) SetGlobal(c *fiber.Ctx) error {
+	req, err := h.parse(c)
+	if err != nil {
+		return err
+	}
+
+	setting, err := h.service.SetGlobal(c.Params("key"), req.Value, actorID(c))
+	if err != nil {
+		return settingsErrorResponse(c, err)
+	}
+
+	return utils.SuccessResponse(c, "Setting updated successfully", setting)
+}
+
+func (h *SettingsHandler) ResetGlobal(c *fiber.Ctx) error {
+	setting, err := h.service.ResetGlobal(c.Params("key"), actorID(c))
+	if err != nil {
+		return settingsErrorResponse(c, err)
+	}
+
+	return utils.SuccessResponse(c, "Setting reset to default", setting)
+}
+
+func (h *SettingsHandler) ListTenant(c *fiber.Ctx) error {
+	list, err := h.service.ListTenant(c.Params("namespace"))
+	if err != nil {
+		return settingsErrorResponse(c, err)
+	}
+
+	return utils.SuccessResponse(c, "Settings retrieved successfully", list)
+}
+
+func (h *SettingsHandler) SetTenant(c *fiber.Ctx) error {
+	req, err := h.parse(c)
+	if err != nil {
+		return err
+	}
+
+	setting, err := h.service.SetTenant(c.Params("namespace"), c.Params("key"), req.Value, actorID(c))
+	if err != nil {
+		return settingsErrorResponse(c, err)
+	}
+
+	return utils.SuccessResponse(c, "Setting updated successfully", setting)
+}
+
+func (h *SettingsHandler) ResetTenant(c *fiber.Ctx) error {
+	setting, err := h.service.ResetTenant(c.Params("namespace"), c.Params("key"), actorID(c))
+	if err != nil {
+		return settingsErrorResponse(c, err)
+	}
+
+	return utils.SuccessResponse(c, "Setting reset to inherited value", setting)
+}
+
+// parse writes the error response itself, so a non-nil error must be
+// returned to Fiber unchanged.
+func (h *SettingsHandler) parse(c *fiber.Ctx) (*types.SetSettingRequest, error) {
+	var req types.SetSettingRequest
+	if err := c.BodyParser(&req); err != nil {
+		return nil, utils.BadRequestResponse(c, "Invalid request body", err.Error())
+	}
+
+	if err := h.validator.Struct(&req); err != nil {
+		return nil, utils.BadRequestResponse(c, "Validation failed", err.Error())
+	}
+	return &req, nil
+}
+
+func settingsErrorResponse(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, service.ErrUnknownTenant), errors.Is(err, settings.ErrUnknownKey):
+		return utils.NotFoundResponse(c, err.Error())
+	case errors.Is(err, settings.ErrInvalidValue):
+		return utils.BadRequestResponse(c, "Validation failed", err.Error())
+	default:
+		return utils.InternalServerErrorResponse(c, err.Error(), nil)
+	}
+}
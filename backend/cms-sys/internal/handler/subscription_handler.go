@@ -0,0 +1,226 @@
+package handler
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/service"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/types"
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/utils"
+)
+
+type SubscriptionHandle interface {
+	Get(c *fiber.Ctx) error
+	Subscribe(c *fiber.Ctx) error
+	ChangePlan(c *fiber.Ctx) error
+	Cancel(c *fiber.Ctx) error
+	Resume(c *fiber.Ctx) error
+	List(c *fiber.Ctx) error
+	Process(c *fiber.Ctx) error
+	CustomerSubscription(c *fiber.Ctx) error
+	CustomerSubscribe(c *fiber.Ctx) error
+	CustomerCancel(c *fiber.Ctx) error
+}
+
+type SubscriptionHandler struct {
+	service   service.SubscriptionService
+	validator *validator.Validate
+}
+
+var _ SubscriptionHandle = (*SubscriptionHandler)(nil)
+
+func NewSubscriptionHandler(service service.SubscriptionService) *SubscriptionHandler {
+	return &SubscriptionHandler{
+		service:   service,
+		validator: validator.New(),
+	}
+}
+
+func (h *SubscriptionHandler) Get(c *fiber.Ctx) error {
+	actor := actorID(c)
+	if actor == nil {
+		return utils.UnauthorizedResponse(c, "Authentication required")
+	}
+
+	return h.get(c, *actor)
+}
+
+func (h *SubscriptionHandler) Subscribe(c *fiber.Ctx) error {
+	actor := actorID(c)
+	if actor == nil {
+		return utils.UnauthorizedResponse(c, "Authentication required")
+	}
+
+	return h.subscribe(c, *actor)
+}
+
+func (h *SubscriptionHandler) ChangePlan(c *fiber.Ctx) error {
+	actor := actorID(c)
+	if actor == nil {
+		return utils.UnauthorizedResponse(c, "Authentication required")
+	}
+
+	var req types.SubscribeRequest
+	if err := c.BodyParser(&req); err != nil {
+		return utils.BadRequestResponse(c, "Invalid request body", err.Error())
+	}
+
+	if err := h.validator.Struct(&req); err != nil {
+		return utils.BadRequestResponse(c, "Validation failed", err.Error())
+	}
+
+	sub, err := h.service.ChangePlan(*actor, actor, &req)
+	if err != nil {
+		return subscriptionErrorResponse(c, err)
+	}
+
+	return utils.SuccessResponse(c, "Plan changed successfully", sub)
+}
+
+func (h *SubscriptionHandler) Cancel(c *fiber.Ctx) error {
+	actor := actorID(c)
+	if actor == nil {
+		return utils.UnauthorizedResponse(c, "Authentication required")
+	}
+
+	return h.cancel(c, *actor)
+}
+
+func (h *SubscriptionHandler) Resume(c *fiber.Ctx) error {
+	actor := actorID(c)
+	if actor == nil {
+		return utils.UnauthorizedResponse(c, "Authentication required")
+	}
+
+	sub, err := h.service.Resume(*actor, actor)
+	if err != nil {
+		return subscriptionErrorResponse(c, err)
+	}
+
+	return utils.SuccessResponse(c, "Subscription resumed successfully", sub)
+}
+
+// List shows every subscription, optionally narrowed by ?status= and
+// ?customer_id=.
+func (h *SubscriptionHandler) List(c *fiber.Ctx) error {
+	var customerID *uuid.UUID
+	if raw := c.Query("customer_id"); raw != "" {
+		id, err := uuid.Parse(raw)
+		if err != nil {
+			return utils.BadRequestResponse(c, "Invalid customer_id", err.Error())
+		}
+		customerID = &id
+	}
+	status := types.SubscriptionStatus(strings.ToUpper(c.Query("status")))
+
+	subs, err := h.service.ListSubscriptions(customerID, status)
+	if err != nil {
+		return subscriptionErrorResponse(c, err)
+	}
+
+	return utils.SuccessResponse(c, "Subscriptions retrieved successfully", subs)
+}
+
+// Process runs the renewal scheduler once, outside its interval.
+func (h *SubscriptionHandler) Process(c *fiber.Ctx) error {
+	report, err := h.service.ProcessDue(time.Now())
+	if err != nil {
+		return subscriptionErrorResponse(c, err)
+	}
+
+	return utils.SuccessResponse(c, "Subscriptions processed successfully", report)
+}
+
+func (h *SubscriptionHandler) CustomerSubscription(c *fiber.Ctx) error {
+	customerID, err := uuid.Parse(c.Params("userID"))
+	if err != nil {
+		return subscriptionErrorResponse(c, service.ErrUserNotFound)
+	}
+
+	return h.get(c, customerID)
+}
+
+func (h *SubscriptionHandler) CustomerSubscribe(c *fiber.Ctx) error {
+	customerID, err := uuid.Parse(c.Params("userID"))
+	if err != nil {
+		return subscriptionErrorResponse(c, service.ErrUserNotFound)
+	}
+
+	return h.subscribe(c, customerID)
+}
+
+func (h *SubscriptionHandler) CustomerCancel(c *fiber.Ctx) error {
+	customerID, err := uuid.Parse(c.Params("userID"))
+	if err != nil {
+		return subscriptionErrorResponse(c, service.ErrUserNotFound)
+	}
+
+	return h.cancel(c, customerID)
+}
+
+func (h *SubscriptionHandler) get(c *fiber.Ctx, customerID uuid.UUID) error {
+	sub, err := h.service.GetSubscription(customerID)
+	if err != nil {
+		return subscriptionErrorResponse(c, err)
+	}
+
+	return utils.SuccessResponse(c, "Subscription retrieved successfully", sub)
+}
+
+func (h *SubscriptionHandler) subscribe(c *fiber.Ctx, customerID uuid.UUID) error {
+	var req types.SubscribeRequest
+	if err := c.BodyParser(&req); err != nil {
+		return utils.BadRequestResponse(c, "Invalid request body", err.Error())
+	}
+
+	if err := h.validator.Struct(&req); err != nil {
+		return utils.BadRequestResponse(c, "Validation failed", err.Error())
+	}
+
+	sub, err := h.service.Subscribe(customerID, actorID(c), &req)
+	if err != nil {
+		return subscriptionErrorResponse(c, err)
+	}
+
+	return utils.CreatedResponse(c, "Subscription created successfully", sub)
+}
+
+func (h *SubscriptionHandler) cancel(c *fiber.Ctx, customerID uuid.UUID) error {
+	var req types.CancelSubscriptionRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return utils.BadRequestResponse(c, "Invalid request body", err.Error())
+		}
+	}
+
+	sub, err := h.service.Cancel(customerID, actorID(c), &req)
+	if err != nil {
+		return subscriptionErrorResponse(c, err)
+	}
+
+	return utils.SuccessResponse(c, "Subscription cancelled successfully", sub)
+}
+
+func subscriptionErrorResponse(c *fiber.Ctx, err error) error {
+	switch {
+	case isCouponError(err):
+		return couponErrorResponse(c, err)
+	case errors.Is(err, service.ErrUserNotFound), errors.Is(err, service.ErrPlanNotFound),
+		errors.Is(err, service.ErrNoSubscription):
+		return utils.NotFoundResponse(c, err.Error())
+	case errors.Is(err, service.ErrNotCustomer):
+		return utils.ForbiddenResponse(c, err.Error())
+	case errors.Is(err, service.ErrAlreadySubscribed), errors.Is(err, service.ErrSamePlan),
+		errors.Is(err, service.ErrPlanRetired), errors.Is(err, service.ErrSubscriptionTransition):
+		return utils.ConflictResponse(c, err.Error(), nil)
+	case errors.Is(err, service.ErrPaymentFailed):
+		return utils.PaymentRequiredResponse(c, err.Error(), nil)
+	default:
+		return utils.InternalServerErrorResponse(c, err.Error(), nil)
+	}
+}
@@ -0,0 +1,272 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/middleware"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/service"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/types"
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/utils"
+)
+
+type TenantHandle interface {
+	Current(c *fiber.Ctx) error
+	Create(c *fiber.Ctx) error
+	List(c *fiber.Ctx) error
+	ListTemplates(c *fiber.Ctx) error
+	MarkTemplate(c *fiber.Ctx) error
+	UnmarkTemplate(c *fiber.Ctx) error
+	Suspend(c *fiber.Ctx) error
+	Reactivate(c *fiber.Ctx) error
+	Isolate(c *fiber.Ctx) error
+	ScheduleDeletion(c *fiber.Ctx) error
+	Purge(c *fiber.Ctx) error
+	AuditTrail(c *fiber.Ctx) error
+	StartExport(c *fiber.Ctx) error
+	ExportStatus(c *fiber.Ctx) error
+	DownloadExport(c *fiber.Ctx) error
+}
+
+type TenantHandler struct {
+	service   service.TenantService
+	validator *validator.Validate
+}
+
+var _ TenantHandle = (*TenantHandler)(nil)
+
+func NewTenantHandler(service service.TenantService) *TenantHandler {
+	return &TenantHandler{
+		service:   service,
+		validator: validator.New(),
+	}
+}
+
+func (h *TenantHandler) Current(c *fiber.Ctx) error {
+	tenant := middleware.CurrentTenant(c)
+	if tenant == nil {
+		return utils.NotFoundResponse(c, "Tenant not resolved")
+	}
+
+	content, err := h.service.Content(middleware.TenantDB(c))
+	if err != nil {
+		return utils.InternalServerErrorResponse(c, err.Error(), nil)
+	}
+
+	return utils.SuccessResponse(c, "Tenant resolved", types.TenantResponse{
+		TenantID:  tenant.TenantID,
+		Namespace: tenant.Namespace,
+		Status:    tenant.Status,
+		Isolation: tenant.Isolation,
+		Source:    middleware.TenantSource(c),
+		Content:   content,
+		CreatedAt: tenant.CreatedAt,
+	})
+}
+
+func (h *TenantHandler) Create(c *fiber.Ctx) error {
+	var req types.CreateTenantRequest
+	if err := c.BodyParser(&req); err != nil {
+		return utils.BadRequestResponse(c, "Invalid request body", err.Error())
+	}
+
+	if err := h.validator.Struct(&req); err != nil {
+		return utils.BadRequestResponse(c, "Validation failed", err.Error())
+	}
+
+	tenant, err := h.service.CreateTenant(&req)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrTenantExists), errors.Is(err, service.ErrSourceOutdated):
+			return utils.ConflictResponse(c, err.Error(), nil)
+		case errors.Is(err, utils.ErrInvalidNamespace), errors.Is(err, service.ErrNotTemplate):
+			return utils.BadRequestResponse(c, err.Error(), nil)
+		case errors.Is(err, service.ErrUnknownTenant):
+			return utils.NotFoundResponse(c, "Source tenant not found")
+		default:
+			return utils.InternalServerErrorResponse(c, err.Error(), nil)
+		}
+	}
+
+	return utils.CreatedResponse(c, "Tenant provisioned successfully", tenant)
+}
+
+func (h *TenantHandler) List(c *fiber.Ctx) error {
+	tenants, err := h.service.ListTenants()
+	if err != nil {
+		return utils.InternalServerErrorResponse(c, err.Error(), nil)
+	}
+
+	return utils.SuccessResponse(c, "Tenants retrieved successfully", tenants)
+}
+
+func (h *TenantHandler) ListTemplates(c *fiber.Ctx) error {
+	templates, err := h.service.ListTemplates()
+	if err != nil {
+		return utils.InternalServerErrorResponse(c, err.Error(), nil)
+	}
+
+	return utils.SuccessResponse(c, "Templates retrieved successfully", templates)
+}
+
+func (h *TenantHandler) MarkTemplate(c *fiber.Ctx) error {
+	tenant, err := h.service.SetTemplate(c.Params("namespace"), actorID(c), true)
+	if err != nil {
+		return tenantErrorResponse(c, err)
+	}
+
+	return utils.SuccessResponse(c, "Tenant marked as template", tenant)
+}
+
+func (h *TenantHandler) UnmarkTemplate(c *fiber.Ctx) error {
+	tenant, err := h.service.SetTemplate(c.Params("namespace"), actorID(c), false)
+	if err != nil {
+		return tenantErrorResponse(c, err)
+	}
+
+	return utils.SuccessResponse(c, "Tenant is no longer a template", tenant)
+}
+
+func (h *TenantHandler) Suspend(c *fiber.Ctx) error {
+	var req types.TenantStatusRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return utils.BadRequestResponse(c, "Invalid request body", err.Error())
+		}
+	}
+
+	if err := h.validator.Struct(&req); err != nil {
+		return utils.BadRequestResponse(c, "Validation failed", err.Error())
+	}
+
+	tenant, err := h.service.SuspendTenant(c.Params("namespace"), actorID(c), req.Reason)
+	if err != nil {
+		return tenantErrorResponse(c, err)
+	}
+
+	return utils.SuccessResponse(c, "Tenant suspended", tenant)
+}
+
+func (h *TenantHandler) Reactivate(c *fiber.Ctx) error {
+	tenant, err := h.service.ReactivateTenant(c.Params("namespace"), actorID(c))
+	if err != nil {
+		return tenantErrorResponse(c, err)
+	}
+
+	return utils.SuccessResponse(c, "Tenant reactivated", tenant)
+}
+
+// Isolate moves a suspended tenant from the shared schema to its own schema.
+func (h *TenantHandler) Isolate(c *fiber.Ctx) error {
+	tenant, err := h.service.IsolateTenant(c.Params("namespace"), actorID(c))
+	if err != nil {
+		return tenantErrorResponse(c, err)
+	}
+
+	return utils.SuccessResponse(c, "Tenant moved to a dedicated schema", tenant)
+}
+
+func (h *TenantHandler) ScheduleDeletion(c *fiber.Ctx) error {
+	var req types.ScheduleDeletionRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return utils.BadRequestResponse(c, "Invalid request body", err.Error())
+		}
+	}
+
+	if err := h.validator.Struct(&req); err != nil {
+		return utils.BadRequestResponse(c, "Validation failed", err.Error())
+	}
+
+	tenant, err := h.service.ScheduleDeletion(c.Params("namespace"), actorID(c), &req)
+	if err != nil {
+		return tenantErrorResponse(c, err)
+	}
+
+	return utils.SuccessResponse(c, "Tenant scheduled for deletion", tenant)
+}
+
+func (h *TenantHandler) Purge(c *fiber.Ctx) error {
+	report, err := h.service.PurgeTenant(c.Params("namespace"), actorID(c), c.QueryBool("force", false))
+	if err != nil {
+		return tenantErrorResponse(c, err)
+	}
+
+	return utils.SuccessResponse(c, "Tenant purged", report)
+}
+
+func (h *TenantHandler) AuditTrail(c *fiber.Ctx) error {
+	page, limit := paginationParams(c)
+	entries, total, err := h.service.AuditTrail(c.Params("namespace"), page, limit)
+	if err != nil {
+		return tenantErrorResponse(c, err)
+	}
+
+	return utils.PaginatedSuccessResponse(c, "Audit trail retrieved successfully", entries, newPagination(page, limit, total))
+}
+
+func (h *TenantHandler) StartExport(c *fiber.Ctx) error {
+	tenant := middleware.CurrentTenant(c)
+	if tenant == nil {
+		return utils.NotFoundResponse(c, "Tenant not resolved")
+	}
+
+	job, err := h.service.StartExport(tenant.Namespace, actorID(c))
+	if err != nil {
+		return tenantErrorResponse(c, err)
+	}
+
+	return utils.AcceptedResponse(c, "Export started", job)
+}
+
+func (h *TenantHandler) ExportStatus(c *fiber.Ctx) error {
+	job, err := h.exportJob(c)
+	if err != nil {
+		return tenantErrorResponse(c, err)
+	}
+
+	return utils.SuccessResponse(c, "Export retrieved successfully", job)
+}
+
+func (h *TenantHandler) DownloadExport(c *fiber.Ctx) error {
+	job, err := h.exportJob(c)
+	if err != nil {
+		return tenantErrorResponse(c, err)
+	}
+	if job.Status != types.JobSucceeded {
+		return utils.ConflictResponse(c, service.ErrExportNotReady.Error(), job.Status)
+	}
+
+	filename := fmt.Sprintf("%s-%s.tar.gz", *job.Namespace, job.CreatedAt.UTC().Format("20060102T150405Z"))
+	return c.Download(job.ResultPath, filename)
+}
+
+func (h *TenantHandler) exportJob(c *fiber.Ctx) (*types.Job, error) {
+	tenant := middleware.CurrentTenant(c)
+	if tenant == nil {
+		return nil, service.ErrUnknownTenant
+	}
+	jobID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return nil, service.ErrJobNotFound
+	}
+	return h.service.ExportJob(tenant.Namespace, jobID)
+}
+
+func tenantErrorResponse(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, service.ErrUnknownTenant), errors.Is(err, service.ErrJobNotFound):
+		return utils.NotFoundResponse(c, err.Error())
+	case errors.Is(err, service.ErrInvalidTransition), errors.Is(err, service.ErrPurgeNotDue),
+		errors.Is(err, service.ErrAlreadyDedicated), errors.Is(err, service.ErrSourceOutdated):
+		return utils.ConflictResponse(c, err.Error(), nil)
+	case errors.Is(err, service.ErrExportsDisabled):
+		return utils.ServiceUnavailableResponse(c, err.Error())
+	default:
+		return utils.InternalServerErrorResponse(c, err.Error(), nil)
+	}
+}
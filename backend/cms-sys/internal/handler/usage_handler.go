@@ -0,0 +1,65 @@
+package handler
+
+import (
+	"errors"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/service"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/types"
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/utils"
+)
+
+type UsageHandle interface {
+	Usage(c *fiber.Ctx) error
+	SetQuota(c *fiber.Ctx) error
+}
+
+type UsageHandler struct {
+	service   service.MeteringService
+	validator *validator.Validate
+}
+
+var _ UsageHandle = (*UsageHandler)(nil)
+
+func NewUsageHandler(service service.MeteringService) *UsageHandler {
+	return &UsageHandler{
+		service:   service,
+		validator: validator.New(),
+	}
+}
+
+func (h *UsageHandler) Usage(c *fiber.Ctx) error {
+	report, err := h.service.Usage(c.Params("namespace"))
+	if err != nil {
+		return usageErrorResponse(c, err)
+	}
+
+	return utils.SuccessResponse(c, "Usage retrieved successfully", report)
+}
+
+func (h *UsageHandler) SetQuota(c *fiber.Ctx) error {
+	var req types.SetQuotaRequest
+	if err := c.BodyParser(&req); err != nil {
+		return utils.BadRequestResponse(c, "Invalid request body", err.Error())
+	}
+
+	if err := h.validator.Struct(&req); err != nil {
+		return utils.BadRequestResponse(c, "Validation failed", err.Error())
+	}
+
+	report, err := h.service.SetQuota(c.Params("namespace"), actorID(c), &req)
+	if err != nil {
+		return usageErrorResponse(c, err)
+	}
+
+	return utils.SuccessResponse(c, "Quota updated successfully", report)
+}
+
+func usageErrorResponse(c *fiber.Ctx, err error) error {
+	if errors.Is(err, service.ErrUnknownTenant) {
+		return utils.NotFoundResponse(c, err.Error())
+	}
+	return utils.InternalServerErrorResponse(c, err.Error(), nil)
+}
@@ -0,0 +1,61 @@
+package isolation
+
+import (
+	"context"
+
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/migration"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/types"
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/utils"
+	"gorm.io/gorm"
+)
+
+// SchemaStrategy gives every tenant a dedicated schema built by the tenant
+// migration set.
+type SchemaStrategy struct {
+	db       *gorm.DB
+	migrator *migration.Runner
+}
+
+var _ Strategy = (*SchemaStrategy)(nil)
+
+func NewSchemaStrategy(db *gorm.DB, migrator *migration.Runner) *SchemaStrategy {
+	return &SchemaStrategy{
+		db:       db,
+		migrator: migrator,
+	}
+}
+
+func (s *SchemaStrategy) Mode() types.IsolationMode {
+	return types.IsolationSchema
+}
+
+func (s *SchemaStrategy) Schema(tenant *types.Tenant) string {
+	return tenant.SchemaName
+}
+
+func (s *SchemaStrategy) Migrator() *migration.Runner {
+	return s.migrator
+}
+
+// Scope also sets the tenant setting, which dedicated schemas do not need but
+// keeps a transaction that visits the shared schema from seeing another
+// tenant's rows.
+func (s *SchemaStrategy) Scope(tx *gorm.DB, tenant *types.Tenant) error {
+	if err := utils.SetLocalSearchPath(tx, tenant.SchemaName); err != nil {
+		return err
+	}
+	return setTenant(tx, tenant)
+}
+
+func (s *SchemaStrategy) Columns(*types.Tenant) map[string]interface{} {
+	return nil
+}
+
+func (s *SchemaStrategy) Provision(ctx context.Context, tenant *types.Tenant) error {
+	_, err := s.migrator.Up(ctx, tenant.SchemaName, 0)
+	return err
+}
+
+func (s *SchemaStrategy) Drop(ctx context.Context, tenant *types.Tenant) error {
+	return utils.DropSchema(ctx, s.db, tenant.SchemaName)
+}
@@ -0,0 +1,140 @@
+package isolation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/migration"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/tenantdata"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/types"
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/utils"
+	"gorm.io/gorm"
+)
+
+// SharedSchema holds the rows of every tenant in shared mode.
+const SharedSchema = "shared_tenants"
+
+// ErrRLSBypassed is returned by every scoped operation of the shared mode when
+// the database role would skip its row-level security policies.
+var ErrRLSBypassed = errors.New("the database role is a superuser or has BYPASSRLS, so shared isolation is refused; connect with a role that has neither")
+
+// SharedStrategy keeps small tenants in one schema. Every table has a
+// tenant_id and a row-level security policy comparing it with TenantSetting,
+// so a scoped transaction only sees and writes the rows of its tenant.
+//
+// Postgres superusers and roles with BYPASSRLS ignore the policies, which
+// would let a scoped query or Drop reach every tenant's rows. Scope therefore
+// refuses to run for such a role; see CheckRole.
+type SharedStrategy struct {
+	db       *gorm.DB
+	migrator *migration.Runner
+
+	mu          sync.Mutex
+	roleChecked bool
+	roleErr     error
+}
+
+var _ Strategy = (*SharedStrategy)(nil)
+
+func NewSharedStrategy(db *gorm.DB, migrator *migration.Runner) *SharedStrategy {
+	return &SharedStrategy{
+		db:       db,
+		migrator: migrator,
+	}
+}
+
+func (s *SharedStrategy) Mode() types.IsolationMode {
+	return types.IsolationShared
+}
+
+func (s *SharedStrategy) Schema(*types.Tenant) string {
+	return SharedSchema
+}
+
+func (s *SharedStrategy) Migrator() *migration.Runner {
+	return s.migrator
+}
+
+// CheckRole returns ErrRLSBypassed when the connected role is a superuser or
+// has BYPASSRLS. The answer is kept for the life of the process; a failed
+// query is not.
+func (s *SharedStrategy) CheckRole(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.roleChecked {
+		return s.roleErr
+	}
+
+	var super, bypass bool
+	row := s.db.WithContext(ctx).Raw("SELECT rolsuper, rolbypassrls FROM pg_roles WHERE rolname = current_user").Row()
+	if err := row.Scan(&super, &bypass); err != nil {
+		return fmt.Errorf("failed to check the database role: %w", err)
+	}
+	s.roleChecked = true
+	if super || bypass {
+		s.roleErr = ErrRLSBypassed
+	}
+	return s.roleErr
+}
+
+func (s *SharedStrategy) Scope(tx *gorm.DB, tenant *types.Tenant) error {
+	if err := s.CheckRole(tx.Statement.Context); err != nil {
+		return err
+	}
+	if err := utils.SetLocalSearchPath(tx, SharedSchema); err != nil {
+		return err
+	}
+	return setTenant(tx, tenant)
+}
+
+// Columns makes loaded rows belong to the tenant, whatever tenant_id they
+// carried in the archive or source tenant.
+func (s *SharedStrategy) Columns(tenant *types.Tenant) map[string]interface{} {
+	return map[string]interface{}{"tenant_id": tenant.TenantID.String()}
+}
+
+// Provision brings the shared schema up to date and seeds the tenant's LMS
+// roles, which dedicated schemas get from a migration.
+func (s *SharedStrategy) Provision(ctx context.Context, tenant *types.Tenant) error {
+	if err := s.CheckRole(ctx); err != nil {
+		return err
+	}
+	if _, err := s.migrator.Up(ctx, SharedSchema, 0); err != nil {
+		return err
+	}
+	return s.scoped(ctx, tenant, func(tx *gorm.DB) error {
+		return tx.Exec(`INSERT INTO LMS_USER_Role (lms_role_name)
+			VALUES ('LMS_ADMIN'), ('STUDENT'), ('INSTRUCTOR')
+			ON CONFLICT (tenant_id, lms_role_name) DO NOTHING`).Error
+	})
+}
+
+// Drop deletes the tenant's rows table by table, children first. The policy
+// limits every DELETE to the scoped tenant.
+func (s *SharedStrategy) Drop(ctx context.Context, tenant *types.Tenant) error {
+	return s.scoped(ctx, tenant, func(tx *gorm.DB) error {
+		catalog, err := tenantdata.LoadCatalog(tx, SharedSchema)
+		if err != nil {
+			return err
+		}
+		for i := len(catalog.Tables) - 1; i >= 0; i-- {
+			table := catalog.Tables[i].Name
+			stmt := fmt.Sprintf("DELETE FROM %s.%s", utils.QuoteIdent(SharedSchema), utils.QuoteIdent(table))
+			if err := tx.Exec(stmt).Error; err != nil {
+				return fmt.Errorf("table %s: %w", table, err)
+			}
+		}
+		return nil
+	})
+}
+
+func (s *SharedStrategy) scoped(ctx context.Context, tenant *types.Tenant, fn func(tx *gorm.DB) error) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := s.Scope(tx, tenant); err != nil {
+			return err
+		}
+		return fn(tx)
+	})
+}
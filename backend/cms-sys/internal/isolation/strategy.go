@@ -0,0 +1,101 @@
+package isolation
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/migration"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/types"
+	"gorm.io/gorm"
+)
+
+// TenantSetting is the session setting that carries the scoped tenant ID.
+// Row-level security policies in the shared schema compare against it.
+const TenantSetting = "app.tenant_id"
+
+// Strategy stores and scopes the LMS data of tenants in one isolation mode.
+// Callers do not branch on the mode: they ask the tenant's strategy where its
+// tables are and scope their transactions through it.
+type Strategy interface {
+	Mode() types.IsolationMode
+	// Schema is the schema holding the tenant's tables.
+	Schema(tenant *types.Tenant) string
+	// Migrator manages the schemas of this mode.
+	Migrator() *migration.Runner
+	// Scope pins an open transaction to the tenant. It only uses SET LOCAL
+	// and set_config(..., true), so nothing outlives the transaction.
+	Scope(tx *gorm.DB, tenant *types.Tenant) error
+	// Columns are values every row loaded for the tenant must carry.
+	Columns(tenant *types.Tenant) map[string]interface{}
+	// Provision prepares storage for a new tenant and Drop deletes all of
+	// its data.
+	Provision(ctx context.Context, tenant *types.Tenant) error
+	Drop(ctx context.Context, tenant *types.Tenant) error
+}
+
+// Selector hands out the strategy a tenant is stored with.
+type Selector struct {
+	strategies map[types.IsolationMode]Strategy
+	fallback   types.IsolationMode
+}
+
+// NewSelector registers strategies; fallback is the mode of new tenants that
+// do not ask for one.
+func NewSelector(fallback types.IsolationMode, strategies ...Strategy) (*Selector, error) {
+	s := &Selector{strategies: make(map[types.IsolationMode]Strategy, len(strategies)), fallback: fallback}
+	for _, strategy := range strategies {
+		s.strategies[strategy.Mode()] = strategy
+	}
+	if _, ok := s.strategies[fallback]; !ok {
+		return nil, fmt.Errorf("no strategy for default isolation mode %q", fallback)
+	}
+	return s, nil
+}
+
+func (s *Selector) Default() types.IsolationMode {
+	return s.fallback
+}
+
+// Mode returns the strategy of a mode. Tenants registered before isolation
+// modes existed have an empty mode and live in dedicated schemas.
+func (s *Selector) Mode(mode types.IsolationMode) (Strategy, error) {
+	if mode == "" {
+		mode = types.IsolationSchema
+	}
+	strategy, ok := s.strategies[mode]
+	if !ok {
+		return nil, fmt.Errorf("unknown isolation mode %q", mode)
+	}
+	return strategy, nil
+}
+
+// For returns the strategy of tenant. The mode is read from the tenant's row,
+// so an unknown one is reported rather than trusted.
+func (s *Selector) For(tenant *types.Tenant) (Strategy, error) {
+	strategy, err := s.Mode(tenant.Isolation)
+	if err != nil {
+		return nil, fmt.Errorf("tenant %s: %w", tenant.Namespace, err)
+	}
+	return strategy, nil
+}
+
+// WithTenant runs fn in a transaction scoped to tenant.
+func (s *Selector) WithTenant(ctx context.Context, db *gorm.DB, tenant *types.Tenant, fn func(tx *gorm.DB) error) error {
+	strategy, err := s.For(tenant)
+	if err != nil {
+		return err
+	}
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := strategy.Scope(tx, tenant); err != nil {
+			return err
+		}
+		return fn(tx)
+	})
+}
+
+func setTenant(tx *gorm.DB, tenant *types.Tenant) error {
+	if err := tx.Exec("SELECT set_config(?, ?, true)", TenantSetting, tenant.TenantID.String()).Error; err != nil {
+		return fmt.Errorf("failed to scope transaction to tenant %s: %w", tenant.Namespace, err)
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package isolation
+
+import (
+	"testing"
+
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/types"
+)
+
+type stubStrategy struct {
+	Strategy
+	mode types.IsolationMode
+}
+
+func (s stubStrategy) Mode() types.IsolationMode {
+	return s.mode
+}
+
+func TestSelectorFor(t *testing.T) {
+	selector, err := NewSelector(types.IsolationSchema, stubStrategy{mode: types.IsolationSchema})
+	if err != nil {
+		t.Fatalf("NewSelector: %v", err)
+	}
+
+	// Tenants from before isolation modes have none and use schemas.
+	strategy, err := selector.For(&types.Tenant{Namespace: "legacy"})
+	if err != nil || strategy.Mode() != types.IsolationSchema {
+		t.Fatalf("empty mode: %v, %v", strategy, err)
+	}
+	if _, err := selector.For(&types.Tenant{Namespace: "acme", Isolation: types.IsolationShared}); err == nil {
+		t.Fatal("unregistered mode returned a strategy")
+	}
+	if _, err := selector.For(&types.Tenant{Namespace: "acme", Isolation: "bogus"}); err == nil {
+		t.Fatal("unknown mode returned a strategy")
+	}
+}
@@ -0,0 +1,105 @@
+package middleware
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/types"
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/utils"
+)
+
+const claimsKey = "auth_claims"
+
+var errMissingToken = errors.New("missing bearer token")
+
+// RequireAuth validates the bearer access token and stores its claims on the
+// request so later handlers can read them through Claims.
+func RequireAuth() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		claims, err := bearerClaims(c)
+		if err != nil {
+			return utils.UnauthorizedResponse(c, "Missing or invalid access token")
+		}
+		if claims.TokenType != "access" {
+			return utils.UnauthorizedResponse(c, "Invalid token type")
+		}
+
+		c.Locals(claimsKey, claims)
+		return c.Next()
+	}
+}
+
+// RequireRole must run after RequireAuth.
+func RequireRole(roles ...types.RoleType) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		claims := Claims(c)
+		if claims == nil {
+			return utils.UnauthorizedResponse(c, "Authentication required")
+		}
+		for _, role := range roles {
+			if claims.Role == string(role) {
+				return c.Next()
+			}
+		}
+		return utils.ForbiddenResponse(c, "Insufficient permissions")
+	}
+}
+
+func Claims(c *fiber.Ctx) *utils.Claims {
+	claims, _ := c.Locals(claimsKey).(*utils.Claims)
+	return claims
+}
+
+func bearerClaims(c *fiber.Ctx) (*utils.Claims, error) {
+	header := c.Get(fiber.HeaderAuthorization)
+	token, found := strings.CutPrefix(header, "Bearer ")
+	if !found || token == "" {
+		return nil, errMissingToken
+	}
+	return utils.ValidateToken(token)
+}
+
+// Memberships reports a user's role on a tenant. service.MemberService
+// implements it.
+type Memberships interface {
+	MemberRole(namespace string, userID uuid.UUID) (types.TenantMemberRole, bool)
+}
+
+// RequireNamespaceAccess must run after RequireAuth. It admits the root admin,
+// users whose token is bound to the namespace in the given route param and
+// members of that tenant.
+func RequireNamespaceAccess(param string, members Memberships) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		claims := Claims(c)
+		if claims == nil {
+			return utils.UnauthorizedResponse(c, "Authentication required")
+		}
+		if claims.Role == string(types.RootAdmin) {
+			return c.Next()
+		}
+
+		requested, err := utils.NormalizeNamespace(c.Params(param))
+		if err != nil {
+			return utils.NotFoundResponse(c, "Tenant not found")
+		}
+		if !namespaceAllowed(claims, requested, members) {
+			return utils.ForbiddenResponse(c, "Access to this tenant is not allowed")
+		}
+		return c.Next()
+	}
+}
+
+// namespaceAllowed reports whether the caller may act on the normalized
+// namespace: as root admin, through a token bound to it or as a member.
+func namespaceAllowed(claims *utils.Claims, namespace string, members Memberships) bool {
+	if claims.Role == string(types.RootAdmin) {
+		return true
+	}
+	if own, err := utils.NormalizeNamespace(claims.Namespace); err == nil && own == namespace {
+		return true
+	}
+	_, ok := members.MemberRole(namespace, claims.UserID)
+	return ok
+}
@@ -0,0 +1,97 @@
+package middleware
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/cors"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/service"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/settings"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/types"
+)
+
+type CORSConfig struct {
+	// Origins are always allowed, e.g. the admin frontend.
+	Origins []string
+	// BaseDomain admits https origins on tenant subdomains.
+	BaseDomain string
+	// Domains admits https origins on verified custom domains. It may be nil.
+	Domains service.DomainService
+	// Settings supplies cors.allowed_origins of the tenant the request is
+	// addressed to, or the global value. It may be nil.
+	Settings service.SettingsService
+}
+
+// CORS admits an origin when it is configured statically, is a tenant
+// subdomain or verified custom domain, or is listed in cors.allowed_origins
+// for the tenant the request host belongs to.
+//
+// Fiber's AllowOriginsFunc only sees the origin, so the decision is taken here
+// with the request at hand and one of two preconfigured handlers answers.
+func CORS(cfg CORSConfig) fiber.Handler {
+	static := make(map[string]bool, len(cfg.Origins))
+	for _, o := range cfg.Origins {
+		if o = normalizeOrigin(o); o != "" {
+			static[o] = true
+		}
+	}
+
+	config := func(allow bool) cors.Config {
+		return cors.Config{
+			AllowOriginsFunc: func(string) bool { return allow },
+			AllowMethods:     "GET,POST,HEAD,PUT,DELETE,PATCH,OPTIONS",
+			AllowHeaders:     "Origin,Content-Type,Accept,Authorization," + types.TenantHeader,
+		}
+	}
+	allow, deny := cors.New(config(true)), cors.New(config(false))
+
+	return func(c *fiber.Ctx) error {
+		origin := normalizeOrigin(c.Get(fiber.HeaderOrigin))
+		if origin != "" && allowedOrigin(c, cfg, static, origin) {
+			return allow(c)
+		}
+		return deny(c)
+	}
+}
+
+func allowedOrigin(c *fiber.Ctx, cfg CORSConfig, static map[string]bool, origin string) bool {
+	if static[origin] {
+		return true
+	}
+
+	u, _ := url.Parse(origin)
+	host := u.Hostname()
+	if u.Scheme == "https" {
+		if subdomainNamespace(host, cfg.BaseDomain) != "" {
+			return true
+		}
+		if cfg.Domains != nil && cfg.Domains.ResolveHost(host) != "" {
+			return true
+		}
+	}
+
+	if cfg.Settings == nil {
+		return false
+	}
+	namespace := subdomainNamespace(c.Hostname(), cfg.BaseDomain)
+	if namespace == "" && cfg.Domains != nil {
+		namespace = cfg.Domains.ResolveHost(c.Hostname())
+	}
+	for _, o := range cfg.Settings.Strings(namespace, settings.CORSAllowedOrigins) {
+		if normalizeOrigin(o) == origin {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeOrigin returns "scheme://host[:port]" in lower case, or "" when o
+// is not an http(s) origin.
+func normalizeOrigin(o string) string {
+	u, err := url.Parse(strings.TrimSpace(o))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ""
+	}
+	return strings.ToLower(u.Scheme + "://" + u.Host)
+}
@@ -0,0 +1,49 @@
+package middleware
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/service"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/types"
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/utils"
+)
+
+// MeterAPICalls counts every request against the resolved tenant's monthly
+// API call quota. It must run after TenantScope.
+func MeterAPICalls(metering service.MeteringService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		tenant := CurrentTenant(c)
+		if tenant == nil {
+			return c.Next()
+		}
+
+		if err := metering.Reserve(tenant.Namespace, types.MetricAPICalls, 1); err != nil {
+			return QuotaErrorResponse(c, err)
+		}
+		return c.Next()
+	}
+}
+
+// QuotaErrorResponse maps a quota violation to 402 or 429. Any other error is
+// reported as a server error.
+func QuotaErrorResponse(c *fiber.Ctx, err error) error {
+	var quota *types.QuotaError
+	if !errors.As(err, &quota) {
+		return utils.InternalServerErrorResponse(c, err.Error(), nil)
+	}
+
+	if quota.RateLimited() {
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(secondsUntilNextMonth(time.Now())))
+		return utils.TooManyRequestsResponse(c, quota.Error(), quota)
+	}
+	return utils.PaymentRequiredResponse(c, quota.Error(), quota)
+}
+
+func secondsUntilNextMonth(now time.Time) int {
+	now = now.UTC()
+	next := time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+	return int(next.Sub(now).Seconds()) + 1
+}
@@ -0,0 +1,149 @@
+package middleware
+
+import (
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/service"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/types"
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/utils"
+)
+
+const systemKey = "granted_system"
+
+type SystemGateConfig struct {
+	Gateway GatewayConfig
+	// PlansURL and CheckoutURL are offered to refused callers.
+	PlansURL    string
+	CheckoutURL string
+}
+
+// SystemGate guards the routes of a sold system.
+type SystemGate struct {
+	entitlements service.EntitlementService
+	catalog      service.Catalog
+	plans        service.PlanService
+	cfg          SystemGateConfig
+}
+
+// NewSystemGate checks entitlements through entitlements and resolves
+// systems named in routes through catalog. plans is optional and only used to
+// name the plans in the upgrade hint.
+func NewSystemGate(entitlements service.EntitlementService, catalog service.Catalog, plans service.PlanService, cfg SystemGateConfig) *SystemGate {
+	return &SystemGate{
+		entitlements: entitlements,
+		catalog:      catalog,
+		plans:        plans,
+		cfg:          cfg,
+	}
+}
+
+// RequireSystem admits callers entitled to system. The caller is taken from
+// claims already on the request, a bearer access token, or the gateway's
+// signed forwarded identity, in that order, and stored for Claims. The root
+// admin is always admitted. A customer is admitted when their token lists the
+// system, and otherwise after a cached entitlement lookup, so a system bought
+// after login works without a new token. Everyone else gets a 403 carrying a
+// types.SystemAccessError.
+func (g *SystemGate) RequireSystem(system types.SystemType) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return g.require(c, system)
+	}
+}
+
+// RequireNamedSystem is RequireSystem for the system the route parameter
+// param names, so one route serves every system in the catalog. Systems not
+// in the catalog get a 404.
+func (g *SystemGate) RequireNamedSystem(param string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		system, err := g.catalog.Known(types.SystemType(c.Params(param)))
+		if errors.Is(err, service.ErrInvalidSystem) {
+			return utils.NotFoundResponse(c, "System not found")
+		}
+		if err != nil {
+			return utils.InternalServerErrorResponse(c, "Failed to load system catalog", nil)
+		}
+		return g.require(c, system.Code)
+	}
+}
+
+func (g *SystemGate) require(c *fiber.Ctx, system types.SystemType) error {
+	claims, err := g.identify(c)
+	if err != nil {
+		return utils.UnauthorizedResponse(c, "Missing or invalid credentials")
+	}
+	c.Locals(claimsKey, claims)
+
+	if claims.Role == string(types.RootAdmin) {
+		return g.admit(c, system)
+	}
+	if claims.Role != string(types.CMSCustomer) {
+		return g.refuse(c, system, claims)
+	}
+	if slices.Contains(claims.Systems, string(system)) {
+		return g.admit(c, system)
+	}
+	entitled, err := g.entitlements.HasSystem(claims.UserID, system)
+	if err != nil {
+		return utils.InternalServerErrorResponse(c, "Failed to check entitlement", nil)
+	}
+	if entitled {
+		return g.admit(c, system)
+	}
+	return g.refuse(c, system, claims)
+}
+
+// GrantedSystem returns the system RequireSystem admitted the request to.
+func GrantedSystem(c *fiber.Ctx) types.SystemType {
+	system, _ := c.Locals(systemKey).(types.SystemType)
+	return system
+}
+
+func (g *SystemGate) identify(c *fiber.Ctx) (*utils.Claims, error) {
+	if claims := Claims(c); claims != nil {
+		return claims, nil
+	}
+	if c.Get(fiber.HeaderAuthorization) != "" {
+		claims, err := bearerClaims(c)
+		if err != nil {
+			return nil, err
+		}
+		if claims.TokenType != "access" {
+			return nil, errors.New("invalid token type")
+		}
+		return claims, nil
+	}
+	return gatewayClaims(c, g.cfg.Gateway, time.Now())
+}
+
+func (g *SystemGate) admit(c *fiber.Ctx, system types.SystemType) error {
+	c.Locals(systemKey, system)
+	return c.Next()
+}
+
+func (g *SystemGate) refuse(c *fiber.Ctx, system types.SystemType, claims *utils.Claims) error {
+	denial := &types.SystemAccessError{
+		Code:   "SYSTEM_NOT_ENTITLED",
+		System: system,
+	}
+	if claims.Role != string(types.CMSCustomer) {
+		return utils.ForbiddenErrorResponse(c, "Only customers can hold systems", denial)
+	}
+
+	if entitlement, err := g.entitlements.Entitlement(claims.UserID, system); err == nil {
+		denial.SubscriptionStatus = entitlement.SubscriptionStatus
+	}
+	denial.Upgrade = &types.UpgradeHint{PlansURL: g.cfg.PlansURL, CheckoutURL: g.cfg.CheckoutURL}
+	if g.plans != nil {
+		if plans, err := g.plans.ListPlans(false); err == nil {
+			for _, plan := range plans {
+				if plan.Includes(system) {
+					denial.Upgrade.Plans = append(denial.Upgrade.Plans, plan.Code)
+				}
+			}
+		}
+	}
+	return utils.ForbiddenErrorResponse(c, denial.Error(), denial)
+}
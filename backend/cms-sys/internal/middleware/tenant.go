@@ -0,0 +1,190 @@
+package middleware
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/isolation"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/service"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/types"
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/utils"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+const (
+	tenantKey       = "tenant"
+	tenantDBKey     = "tenant_db"
+	tenantSourceKey = "tenant_source"
+)
+
+// errRollback is returned from the scoped transaction when the handler wrote an
+// error response, so nothing the handler did is committed.
+var errRollback = errors.New("tenant request rolled back")
+
+type TenantConfig struct {
+	// BaseDomain is the shared parent domain, e.g. "cms.example.com" makes
+	// "acme.cms.example.com" resolve to the "acme" namespace.
+	BaseDomain string
+	// Domains resolves verified custom domains. It may be nil.
+	Domains service.DomainService
+	// Isolation scopes the request transaction to the tenant's storage.
+	Isolation *isolation.Selector
+	// Members admits members of the resolved tenant besides the root admin
+	// and users whose token is bound to it.
+	Members Memberships
+	// Log records tenants that cannot be scoped. It may be nil.
+	Log *logrus.Logger
+}
+
+// TenantScope must run after RequireAuth. It resolves the tenant for the
+// request from, in order, the subdomain, a verified custom domain, the
+// X-Tenant header and the namespace claim of the token. Those sources are
+// chosen by the client, so the caller must also be allowed on the tenant, as
+// RequireNamespaceAccess checks, before anything is scoped to it.
+//
+// The handler chain runs inside a transaction on a single pooled connection
+// scoped by the tenant's isolation strategy: SET LOCAL search_path pointing at
+// its schema and the tenant setting the shared schema's row-level security
+// checks. Postgres discards both when the transaction ends, so the connection
+// is returned to the pool owned by utils.DatabaseConnection unscoped even if a
+// handler fails or panics.
+func TenantScope(tenants service.TenantService, db *gorm.DB, cfg TenantConfig) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		claims := Claims(c)
+		if claims == nil {
+			return utils.UnauthorizedResponse(c, "Authentication required")
+		}
+
+		namespace, source := resolveNamespace(c, cfg)
+		if namespace == "" {
+			return utils.BadRequestResponse(c, "Tenant could not be resolved", "provide a tenant subdomain, custom domain, X-Tenant header or namespaced token")
+		}
+		normalized, err := utils.NormalizeNamespace(namespace)
+		if err != nil {
+			return utils.NotFoundResponse(c, service.ErrUnknownTenant.Error())
+		}
+		// Checked before the lookup, so callers cannot probe which tenants exist.
+		if !namespaceAllowed(claims, normalized, cfg.Members) {
+			return utils.ForbiddenResponse(c, "Access to this tenant is not allowed")
+		}
+
+		tenant, err := tenants.ResolveTenant(normalized)
+		if err != nil {
+			switch {
+			case errors.Is(err, service.ErrUnknownTenant):
+				return utils.NotFoundResponse(c, err.Error())
+			case errors.Is(err, service.ErrTenantSuspended):
+				return utils.ForbiddenResponse(c, err.Error())
+			default:
+				return utils.InternalServerErrorResponse(c, err.Error(), nil)
+			}
+		}
+
+		strategy, err := cfg.Isolation.For(tenant)
+		if err != nil {
+			if cfg.Log != nil {
+				cfg.Log.WithError(err).WithField("namespace", tenant.Namespace).Error("Cannot scope request to tenant")
+			}
+			return utils.ServiceUnavailableResponse(c, "Tenant storage is unavailable")
+		}
+
+		err = db.WithContext(c.UserContext()).Transaction(func(tx *gorm.DB) error {
+			if err := strategy.Scope(tx, tenant); err != nil {
+				return err
+			}
+
+			c.Locals(tenantKey, tenant)
+			c.Locals(tenantSourceKey, source)
+			c.Locals(tenantDBKey, tx)
+			defer c.Locals(tenantDBKey, nil)
+
+			if err := c.Next(); err != nil {
+				return err
+			}
+			if c.Response().StatusCode() >= fiber.StatusBadRequest {
+				return errRollback
+			}
+			return nil
+		})
+		if errors.Is(err, errRollback) {
+			return nil
+		}
+		return err
+	}
+}
+
+// TenantDB returns the tenant-scoped handle for the current request. It is
+// only valid until the handler returns and must not be stored.
+func TenantDB(c *fiber.Ctx) *gorm.DB {
+	db, _ := c.Locals(tenantDBKey).(*gorm.DB)
+	return db
+}
+
+func CurrentTenant(c *fiber.Ctx) *types.Tenant {
+	tenant, _ := c.Locals(tenantKey).(*types.Tenant)
+	return tenant
+}
+
+func TenantSource(c *fiber.Ctx) types.TenantSource {
+	source, _ := c.Locals(tenantSourceKey).(types.TenantSource)
+	return source
+}
+
+func resolveNamespace(c *fiber.Ctx, cfg TenantConfig) (string, types.TenantSource) {
+	if ns := subdomainNamespace(c.Hostname(), cfg.BaseDomain); ns != "" {
+		return ns, types.TenantFromSubdomain
+	}
+
+	if cfg.Domains != nil {
+		if ns := cfg.Domains.ResolveHost(c.Hostname()); ns != "" {
+			return ns, types.TenantFromDomain
+		}
+	}
+
+	if ns := strings.TrimSpace(c.Get(types.TenantHeader)); ns != "" {
+		return ns, types.TenantFromHeader
+	}
+
+	if claims := Claims(c); claims != nil && claims.Namespace != "" {
+		return claims.Namespace, types.TenantFromToken
+	}
+
+	return "", ""
+}
+
+func subdomainNamespace(host, baseDomain string) string {
+	if baseDomain == "" {
+		return ""
+	}
+	host = strings.ToLower(host)
+	suffix := "." + strings.ToLower(strings.TrimPrefix(baseDomain, "."))
+	sub, found := strings.CutSuffix(host, suffix)
+	if !found || sub == "" || strings.Contains(sub, ".") {
+		return ""
+	}
+	return sub
+}
+
+// RequireTenantOwner must run after TenantScope and RequireAuth. It admits the
+// owners of the resolved tenant and the root admin.
+func RequireTenantOwner(members Memberships) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		claims := Claims(c)
+		if claims == nil {
+			return utils.UnauthorizedResponse(c, "Authentication required")
+		}
+		tenant := CurrentTenant(c)
+		if tenant == nil {
+			return utils.NotFoundResponse(c, "Tenant not resolved")
+		}
+		if claims.Role == string(types.RootAdmin) || claims.UserID == tenant.OwnerID {
+			return c.Next()
+		}
+		if role, ok := members.MemberRole(tenant.Namespace, claims.UserID); ok && role == types.MemberOwner {
+			return c.Next()
+		}
+		return utils.ForbiddenResponse(c, "Only a tenant owner can perform this action")
+	}
+}
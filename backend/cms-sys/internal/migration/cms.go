@@ -0,0 +1,30 @@
+package migration
+
+import (
+	"embed"
+	"io/fs"
+)
+
+//go:embed sql/cms/*.sql
+var cmsSQL embed.FS
+
+//go:embed sql/cms_adopt.sql
+var cmsAdoptSQL string
+
+// CMSMigrations returns the migrations that build the platform schema: the
+// core CMS tables from infra/schema/cms, then the platform tables. The server
+// applies them on startup, so a change to a platform model ships with a
+// migration here.
+func CMSMigrations() ([]Migration, error) {
+	sub, err := fs.Sub(cmsSQL, "sql/cms")
+	if err != nil {
+		return nil, err
+	}
+	return LoadFS(sub)
+}
+
+// CMSAdoption is the SQL a runner of the CMS set adopts a database with that
+// the server built with AutoMigrate before the set existed. See Runner.Adopt.
+func CMSAdoption() string {
+	return cmsAdoptSQL
+}
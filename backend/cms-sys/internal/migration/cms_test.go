@@ -0,0 +1,56 @@
+package migration
+
+import "testing"
+
+// releasedCMSChecksums are what databases record for CMS migrations that have
+// shipped. Changing one stops those databases from starting; add a migration
+// instead.
+var releasedCMSChecksums = map[int64]string{
+	1: "ac5607c1f4fcdf14ab0b31bfc9b38ec7c9d3fc9b56dfac3540877859189e1f3d",
+	// 2 shipped as a Go migration, before it was written as SQL.
+	2: "8e55330afc830c877074626c1bf9a26c86b90b6ec667d2c264fab2817bde972c",
+}
+
+func TestCMSMigrationsKeepReleasedChecksums(t *testing.T) {
+	migrations, err := CMSMigrations()
+	if err != nil {
+		t.Fatalf("CMSMigrations: %v", err)
+	}
+	runner, err := NewRunner(nil, nil, migrations)
+	if err != nil {
+		t.Fatalf("NewRunner: %v", err)
+	}
+	seen := 0
+	for _, m := range runner.Migrations() {
+		checksum, ok := releasedCMSChecksums[m.Version]
+		if !ok {
+			continue
+		}
+		seen++
+		if !m.matches(checksum) {
+			t.Errorf("released migration %d_%s was edited", m.Version, m.Name)
+		}
+		if !m.Reversible() {
+			t.Errorf("migration %d_%s has no down file", m.Version, m.Name)
+		}
+	}
+	if seen != len(releasedCMSChecksums) {
+		t.Fatalf("found %d of %d released migrations", seen, len(releasedCMSChecksums))
+	}
+}
+
+func TestChecksumMatchesGoRecordOfSameMigration(t *testing.T) {
+	sql := Migration{Version: 2, Name: "platform_tables", UpSQL: "SELECT 1"}
+	if !sql.matches(sql.Checksum()) {
+		t.Fatal("migration does not match its own checksum")
+	}
+	if !sql.matches(Migration{Version: 2, Name: "platform_tables", UpFunc: sql.up}.Checksum()) {
+		t.Fatal("SQL rewrite of a Go migration does not match its record")
+	}
+	if sql.matches(Migration{Version: 2, Name: "other", UpFunc: sql.up}.Checksum()) {
+		t.Fatal("matched the record of a Go migration with another name")
+	}
+	if sql.matches(Migration{Version: 2, Name: "platform_tables", UpSQL: "SELECT 2"}.Checksum()) {
+		t.Fatal("matched an edited SQL migration")
+	}
+}
@@ -0,0 +1,55 @@
+package migration
+
+import (
+	"context"
+
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/utils"
+)
+
+// SchemaResult is the outcome of one schema in a fan-out run. A failure in one
+// schema never stops the others.
+type SchemaResult struct {
+	Schema     string      `json:"schema"`
+	Migrations []Migration `json:"-"`
+	Versions   []int64     `json:"versions"`
+	Error      string      `json:"error,omitempty"`
+	Err        error       `json:"-"`
+}
+
+func (r *Runner) UpAll(ctx context.Context, schemas []string, target int64, concurrency int) []SchemaResult {
+	return forEachSchema(ctx, schemas, concurrency, func(ctx context.Context, schema string) ([]Migration, error) {
+		return r.Up(ctx, schema, target)
+	})
+}
+
+func (r *Runner) DownAll(ctx context.Context, schemas []string, steps, concurrency int) []SchemaResult {
+	return forEachSchema(ctx, schemas, concurrency, func(ctx context.Context, schema string) ([]Migration, error) {
+		return r.Down(ctx, schema, steps)
+	})
+}
+
+func (r *Runner) PlanAll(ctx context.Context, schemas []string, target int64, concurrency int) []SchemaResult {
+	return forEachSchema(ctx, schemas, concurrency, func(ctx context.Context, schema string) ([]Migration, error) {
+		return r.Plan(ctx, schema, target)
+	})
+}
+
+func forEachSchema(ctx context.Context, schemas []string, concurrency int, fn func(context.Context, string) ([]Migration, error)) []SchemaResult {
+	results := make([]SchemaResult, len(schemas))
+	utils.RunBounded(ctx, len(schemas), concurrency, func(ctx context.Context, i int) {
+		res := SchemaResult{Schema: schemas[i]}
+		if err := ctx.Err(); err != nil {
+			res.Err = err
+		} else {
+			res.Migrations, res.Err = fn(ctx, schemas[i])
+		}
+		for _, m := range res.Migrations {
+			res.Versions = append(res.Versions, m.Version)
+		}
+		if res.Err != nil {
+			res.Error = res.Err.Error()
+		}
+		results[i] = res
+	})
+	return results
+}
@@ -0,0 +1,353 @@
+package migration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/utils"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+var ErrChecksumMismatch = errors.New("applied migration checksum does not match")
+
+const createMigrationsTable = `CREATE TABLE IF NOT EXISTS schema_migrations (
+    version BIGINT PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    checksum VARCHAR(64) NOT NULL,
+    applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+)`
+
+type SchemaMigration struct {
+	Version   int64     `gorm:"primaryKey;autoIncrement:false" json:"version"`
+	Name      string    `gorm:"size:255;not null" json:"name"`
+	Checksum  string    `gorm:"size:64;not null" json:"checksum"`
+	AppliedAt time.Time `gorm:"not null;default:CURRENT_TIMESTAMP" json:"applied_at"`
+}
+
+func (SchemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+type Status struct {
+	Version   int64      `json:"version"`
+	Name      string     `json:"name"`
+	Applied   bool       `json:"applied"`
+	AppliedAt *time.Time `json:"applied_at,omitempty"`
+	// Modified marks an applied migration whose source changed afterwards.
+	Modified bool `json:"modified,omitempty"`
+	// Unknown marks a version recorded in the schema but absent from the set.
+	Unknown bool `json:"unknown,omitempty"`
+}
+
+type Runner struct {
+	db         *gorm.DB
+	log        *logrus.Logger
+	migrations []Migration
+	adoptSQL   string
+}
+
+func NewRunner(db *gorm.DB, log *logrus.Logger, migrations []Migration) (*Runner, error) {
+	sorted, err := sortAndValidate(migrations)
+	if err != nil {
+		return nil, err
+	}
+	return &Runner{
+		db:         db,
+		log:        log,
+		migrations: sorted,
+	}, nil
+}
+
+func (r *Runner) Migrations() []Migration {
+	return r.migrations
+}
+
+// Adopt sets SQL that Up runs on a schema with no migrations recorded, before
+// the first one, to bring objects created outside the set in line with what
+// it expects. It must also be safe on an empty schema.
+func (r *Runner) Adopt(sql string) *Runner {
+	r.adoptSQL = sql
+	return r
+}
+
+// AdoptionSQL returns the SQL Up would run to adopt schema, or "" when the
+// schema already records migrations or the set has nothing to adopt with.
+func (r *Runner) AdoptionSQL(ctx context.Context, schema string) (string, error) {
+	if r.adoptSQL == "" {
+		return "", nil
+	}
+	applied, err := r.applied(ctx, schema)
+	if err != nil || len(applied) > 0 {
+		return "", err
+	}
+	return r.adoptSQL, nil
+}
+
+// Plan lists the migrations Up would apply to schema, up to and including
+// target (0 means latest). It refuses to plan over modified migrations.
+func (r *Runner) Plan(ctx context.Context, schema string, target int64) ([]Migration, error) {
+	applied, err := r.applied(ctx, schema)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.verify(applied); err != nil {
+		return nil, err
+	}
+
+	var pending []Migration
+	for _, m := range r.migrations {
+		if target > 0 && m.Version > target {
+			break
+		}
+		if _, ok := applied[m.Version]; !ok {
+			pending = append(pending, m)
+		}
+	}
+	return pending, nil
+}
+
+// Up applies pending migrations to schema, creating the schema if needed.
+// Every migration commits on its own, so a failure keeps earlier progress.
+func (r *Runner) Up(ctx context.Context, schema string, target int64) ([]Migration, error) {
+	if err := r.ensureSchema(ctx, schema); err != nil {
+		return nil, err
+	}
+
+	if err := r.adopt(ctx, schema); err != nil {
+		return nil, fmt.Errorf("adopting %s failed: %w", schema, err)
+	}
+
+	pending, err := r.Plan(ctx, schema, target)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for _, m := range pending {
+		applied, err := r.apply(ctx, schema, m)
+		if err != nil {
+			return done, fmt.Errorf("migration %d_%s failed on %s: %w", m.Version, m.Name, schema, err)
+		}
+		if applied {
+			done = append(done, m)
+		}
+	}
+	return done, nil
+}
+
+// PlanDown lists the migrations Down would revert, newest first. When an
+// irreversible migration is reached it returns those before it with an error.
+func (r *Runner) PlanDown(ctx context.Context, schema string, steps int) ([]Migration, error) {
+	applied, err := r.applied(ctx, schema)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.verify(applied); err != nil {
+		return nil, err
+	}
+
+	var planned []Migration
+	for i := len(r.migrations) - 1; i >= 0 && len(planned) < steps; i-- {
+		m := r.migrations[i]
+		if _, ok := applied[m.Version]; !ok {
+			continue
+		}
+		if !m.Reversible() {
+			return planned, fmt.Errorf("migration %d_%s is not reversible", m.Version, m.Name)
+		}
+		planned = append(planned, m)
+	}
+	return planned, nil
+}
+
+// Down reverts the most recently applied migrations, newest first.
+func (r *Runner) Down(ctx context.Context, schema string, steps int) ([]Migration, error) {
+	planned, planErr := r.PlanDown(ctx, schema, steps)
+
+	var done []Migration
+	for _, m := range planned {
+		if err := r.revert(ctx, schema, m); err != nil {
+			return done, fmt.Errorf("reverting %d_%s failed on %s: %w", m.Version, m.Name, schema, err)
+		}
+		done = append(done, m)
+	}
+	return done, planErr
+}
+
+func (r *Runner) Status(ctx context.Context, schema string) ([]Status, error) {
+	applied, err := r.applied(ctx, schema)
+	if err != nil {
+		return nil, err
+	}
+
+	known := make(map[int64]bool, len(r.migrations))
+	statuses := make([]Status, 0, len(r.migrations))
+	for _, m := range r.migrations {
+		known[m.Version] = true
+		st := Status{Version: m.Version, Name: m.Name}
+		if rec, ok := applied[m.Version]; ok {
+			appliedAt := rec.AppliedAt
+			st.Applied = true
+			st.AppliedAt = &appliedAt
+			st.Modified = !m.matches(rec.Checksum)
+		}
+		statuses = append(statuses, st)
+	}
+
+	for version, rec := range applied {
+		if !known[version] {
+			appliedAt := rec.AppliedAt
+			statuses = append(statuses, Status{
+				Version:   version,
+				Name:      rec.Name,
+				Applied:   true,
+				AppliedAt: &appliedAt,
+				Unknown:   true,
+			})
+		}
+	}
+	return statuses, nil
+}
+
+func (r *Runner) apply(ctx context.Context, schema string, m Migration) (bool, error) {
+	applied := false
+	err := utils.WithSchema(ctx, r.db, schema, func(tx *gorm.DB) error {
+		if err := lockSchema(tx, schema); err != nil {
+			return err
+		}
+		if err := tx.Exec(createMigrationsTable).Error; err != nil {
+			return err
+		}
+
+		// Another runner may have applied it while we waited on the lock.
+		var count int64
+		if err := tx.Model(&SchemaMigration{}).Where("version = ?", m.Version).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return nil
+		}
+
+		if err := m.up(tx); err != nil {
+			return err
+		}
+		applied = true
+		return tx.Create(&SchemaMigration{
+			Version:   m.Version,
+			Name:      m.Name,
+			Checksum:  m.Checksum(),
+			AppliedAt: time.Now().UTC(),
+		}).Error
+	})
+	if err == nil && applied {
+		r.log.WithFields(logrus.Fields{
+			"schema":  schema,
+			"version": m.Version,
+			"name":    m.Name,
+		}).Info("Applied migration")
+	}
+	return applied, err
+}
+
+func (r *Runner) adopt(ctx context.Context, schema string) error {
+	sql, err := r.AdoptionSQL(ctx, schema)
+	if err != nil || sql == "" {
+		return err
+	}
+	return utils.WithSchema(ctx, r.db, schema, func(tx *gorm.DB) error {
+		if err := lockSchema(tx, schema); err != nil {
+			return err
+		}
+		return tx.Exec(sql).Error
+	})
+}
+
+func (r *Runner) revert(ctx context.Context, schema string, m Migration) error {
+	err := utils.WithSchema(ctx, r.db, schema, func(tx *gorm.DB) error {
+		if err := lockSchema(tx, schema); err != nil {
+			return err
+		}
+		if err := m.down(tx); err != nil {
+			return err
+		}
+		return tx.Where("version = ?", m.Version).Delete(&SchemaMigration{}).Error
+	})
+	if err == nil {
+		r.log.WithFields(logrus.Fields{
+			"schema":  schema,
+			"version": m.Version,
+			"name":    m.Name,
+		}).Info("Reverted migration")
+	}
+	return err
+}
+
+func (r *Runner) ensureSchema(ctx context.Context, schema string) error {
+	return r.db.WithContext(ctx).Exec("CREATE SCHEMA IF NOT EXISTS " + utils.QuoteIdent(schema)).Error
+}
+
+// applied reads schema_migrations with a qualified name so a table of the
+// same name in public is never picked up by mistake.
+func (r *Runner) applied(ctx context.Context, schema string) (map[int64]SchemaMigration, error) {
+	var exists bool
+	err := r.db.WithContext(ctx).Raw(
+		"SELECT EXISTS (SELECT 1 FROM information_schema.tables WHERE table_schema = ? AND table_name = 'schema_migrations')",
+		schema,
+	).Scan(&exists).Error
+	if err != nil {
+		return nil, err
+	}
+
+	applied := make(map[int64]SchemaMigration)
+	if !exists {
+		return applied, nil
+	}
+
+	var records []SchemaMigration
+	if err := r.db.WithContext(ctx).Table(utils.QuoteIdent(schema) + ".schema_migrations").Find(&records).Error; err != nil {
+		return nil, err
+	}
+	for _, rec := range records {
+		applied[rec.Version] = rec
+	}
+	return applied, nil
+}
+
+func (r *Runner) verify(applied map[int64]SchemaMigration) error {
+	for _, m := range r.migrations {
+		if rec, ok := applied[m.Version]; ok && !m.matches(rec.Checksum) {
+			return fmt.Errorf("%w: %d_%s", ErrChecksumMismatch, m.Version, m.Name)
+		}
+	}
+	return nil
+}
+
+func lockSchema(tx *gorm.DB, schema string) error {
+	return tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", "schema_migrations:"+schema).Error
+}
+
+// Latest is the highest version in the set, the version Up brings a schema to.
+func (r *Runner) Latest() int64 {
+	if len(r.migrations) == 0 {
+		return 0
+	}
+	return r.migrations[len(r.migrations)-1].Version
+}
+
+// Current is the highest version applied to schema.
+func (r *Runner) Current(ctx context.Context, schema string) (int64, error) {
+	applied, err := r.applied(ctx, schema)
+	if err != nil {
+		return 0, err
+	}
+	var current int64
+	for version := range applied {
+		if version > current {
+			current = version
+		}
+	}
+	return current, nil
+}
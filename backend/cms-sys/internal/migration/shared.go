@@ -0,0 +1,21 @@
+package migration
+
+import (
+	"embed"
+	"io/fs"
+)
+
+//go:embed sql/shared/*.sql
+var sharedSQL embed.FS
+
+// SharedMigrations returns the migrations that build the shared schema used
+// by tenants in shared isolation mode. It mirrors the tenant set with a
+// tenant_id on every table and row-level security on top, so every change to
+// the tenant set needs a matching shared migration.
+func SharedMigrations() ([]Migration, error) {
+	sub, err := fs.Sub(sharedSQL, "sql/shared")
+	if err != nil {
+		return nil, err
+	}
+	return LoadFS(sub)
+}
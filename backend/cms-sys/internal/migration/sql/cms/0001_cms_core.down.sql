@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS mfa_token;
+DROP TABLE IF EXISTS cms_cus_purchase;
+DROP TABLE IF EXISTS system_catalog;
+DROP TABLE IF EXISTS cms_user;
+DROP TABLE IF EXISTS cms_whole_sys_role;
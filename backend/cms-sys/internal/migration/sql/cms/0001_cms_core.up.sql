@@ -0,0 +1,85 @@
+-- Core CMS tables from infra/schema/cms, shaped the way the server's models
+-- declare them: users reference their role by name. Every statement tolerates
+-- objects the server already created with AutoMigrate, so an existing
+-- database can adopt the migration set.
+
+CREATE TABLE IF NOT EXISTS cms_whole_sys_role (
+                                    role_id UUID DEFAULT gen_random_uuid(),
+                                    role_name VARCHAR(15) NOT NULL,
+                                    PRIMARY KEY (role_id),
+                                    CONSTRAINT uni_cms_whole_sys_role_role_name UNIQUE (role_name)
+);
+
+CREATE TABLE IF NOT EXISTS cms_user (
+                          cms_user_id UUID DEFAULT gen_random_uuid(),
+                          cms_user_name VARCHAR(100) NOT NULL,
+                          cms_user_email VARCHAR(150) NOT NULL,
+                          cms_name_space VARCHAR(100),
+                          password VARCHAR(90) NOT NULL,
+                          cms_user_role VARCHAR(15) NOT NULL,
+                          verified BOOLEAN DEFAULT FALSE,
+                          created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+                          updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+                          PRIMARY KEY (cms_user_id),
+                          CONSTRAINT uni_cms_user_cms_user_email UNIQUE (cms_user_email),
+                          CONSTRAINT fk_cms_whole_sys_role_users
+                              FOREIGN KEY (cms_user_role)
+                                  REFERENCES cms_whole_sys_role(role_name)
+);
+
+-- Systems for sale; adding a product is an INSERT, not a type change
+CREATE TABLE IF NOT EXISTS system_catalog (
+                                code VARCHAR(100),
+                                name VARCHAR(100) NOT NULL,
+                                description VARCHAR(500),
+                                base_url VARCHAR(255),
+                                status VARCHAR(20) NOT NULL DEFAULT 'ACTIVE',
+                                provision_hook VARCHAR(255),
+                                deprovision_hook VARCHAR(255),
+                                created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+                                updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+                                PRIMARY KEY (code)
+);
+
+CREATE TABLE IF NOT EXISTS cms_cus_purchase (
+                                  relation_id UUID DEFAULT gen_random_uuid(),
+                                  cms_cus_id UUID NOT NULL,
+                                  system_name VARCHAR(100) NOT NULL,
+                                  namespace VARCHAR(100),
+                                  purchase_date TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                                  granted_by UUID,
+                                  canceled_at TIMESTAMPTZ,
+                                  canceled_by UUID,
+                                  created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+                                  PRIMARY KEY (relation_id),
+                                  CONSTRAINT fk_cms_cus_purchase_catalog
+                                      FOREIGN KEY (system_name)
+                                          REFERENCES system_catalog(code),
+                                  CONSTRAINT fk_cms_user_purchases
+                                      FOREIGN KEY (cms_cus_id)
+                                          REFERENCES cms_user(cms_user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_cms_cus_purchase_namespace ON cms_cus_purchase(namespace);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_purchase_customer_system ON cms_cus_purchase(cms_cus_id, system_name);
+
+CREATE TABLE IF NOT EXISTS mfa_token (
+                           token_id BIGSERIAL,
+                           mfa_token TEXT NOT NULL,
+                           user_id UUID NOT NULL,
+                           expires_at TIMESTAMPTZ,
+                           created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+                           PRIMARY KEY (token_id),
+                           CONSTRAINT fk_cms_user_mfa_tokens
+                               FOREIGN KEY (user_id)
+                                   REFERENCES cms_user(cms_user_id)
+);
+
+-- Users cannot be created before their role exists.
+INSERT INTO cms_whole_sys_role (role_name)
+VALUES ('ROOT_ADMIN'), ('CMS_CUSTOMER')
+ON CONFLICT (role_name) DO NOTHING;
+
+INSERT INTO system_catalog (code, name)
+VALUES ('LMS', 'Learning Management System'), ('EMS', 'EMS')
+ON CONFLICT (code) DO NOTHING;
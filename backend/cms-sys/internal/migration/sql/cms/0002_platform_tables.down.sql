@@ -0,0 +1,31 @@
+DROP TABLE IF EXISTS cms_growth_aggregate;
+DROP TABLE IF EXISTS cms_report_snapshot;
+DROP TABLE IF EXISTS cms_report_schedule;
+DROP TABLE IF EXISTS cms_coupon_redemption;
+DROP TABLE IF EXISTS cms_coupon_plan;
+DROP TABLE IF EXISTS cms_coupon_system;
+DROP TABLE IF EXISTS cms_coupon;
+DROP TABLE IF EXISTS cms_payment_event;
+DROP TABLE IF EXISTS cms_payment;
+DROP TABLE IF EXISTS cms_payment_checkout;
+DROP TABLE IF EXISTS cms_payment_customer;
+DROP TABLE IF EXISTS cms_invoice_sequence;
+DROP TABLE IF EXISTS cms_invoice_line;
+DROP TABLE IF EXISTS cms_invoice;
+DROP TABLE IF EXISTS cms_subscription;
+DROP TABLE IF EXISTS cms_plan_quota;
+DROP TABLE IF EXISTS cms_plan_system;
+DROP TABLE IF EXISTS cms_plan;
+DROP TABLE IF EXISTS cms_tenant_invitation;
+DROP TABLE IF EXISTS cms_tenant_transfer;
+DROP TABLE IF EXISTS cms_tenant_member;
+DROP TABLE IF EXISTS cms_platform_metric;
+DROP TABLE IF EXISTS cms_tenant_domain;
+DROP TABLE IF EXISTS cms_global_setting;
+DROP TABLE IF EXISTS cms_tenant_quota;
+DROP TABLE IF EXISTS cms_usage_counter;
+DROP TABLE IF EXISTS cms_job;
+DROP TABLE IF EXISTS cms_audit_log;
+DROP TABLE IF EXISTS cms_tenant_deletion_report;
+DROP TABLE IF EXISTS cms_tenant;
+DROP TABLE IF EXISTS user_page_request;
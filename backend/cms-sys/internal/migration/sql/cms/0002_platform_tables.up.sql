@@ -0,0 +1,475 @@
+-- Platform tables, shaped the way the models in internal/types declare them.
+-- Every statement tolerates objects the server created when it still
+-- auto-migrated the models on startup, so such a database adopts the set.
+
+CREATE TABLE IF NOT EXISTS user_page_request (
+    user_page_request_id BIGSERIAL,
+    user_id UUID NOT NULL,
+    page_type VARCHAR(20) NOT NULL,
+    status VARCHAR(20) DEFAULT 'PENDING',
+    PRIMARY KEY (user_page_request_id),
+    CONSTRAINT fk_user_page_request_user FOREIGN KEY (user_id) REFERENCES cms_user(cms_user_id),
+    CONSTRAINT uni_user_page_request_user_id UNIQUE (user_id)
+);
+
+CREATE TABLE IF NOT EXISTS cms_tenant (
+    tenant_id UUID DEFAULT gen_random_uuid(),
+    namespace VARCHAR(100) NOT NULL,
+    schema_name VARCHAR(63) NOT NULL,
+    owner_id UUID NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'ACTIVE',
+    isolation VARCHAR(20) NOT NULL DEFAULT 'schema',
+    is_template BOOLEAN NOT NULL DEFAULT FALSE,
+    status_reason VARCHAR(255),
+    suspended_at TIMESTAMPTZ,
+    deletion_scheduled_at TIMESTAMPTZ,
+    purge_after TIMESTAMPTZ,
+    purged_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (tenant_id),
+    CONSTRAINT fk_cms_tenant_owner FOREIGN KEY (owner_id) REFERENCES cms_user(cms_user_id),
+    CONSTRAINT uni_cms_tenant_namespace UNIQUE (namespace),
+    CONSTRAINT uni_cms_tenant_schema_name UNIQUE (schema_name)
+);
+CREATE INDEX IF NOT EXISTS idx_cms_tenant_purge_after ON cms_tenant(purge_after);
+CREATE INDEX IF NOT EXISTS idx_cms_tenant_is_template ON cms_tenant(is_template);
+CREATE INDEX IF NOT EXISTS idx_cms_tenant_owner_id ON cms_tenant(owner_id);
+
+CREATE TABLE IF NOT EXISTS cms_tenant_deletion_report (
+    report_id UUID,
+    tenant_id UUID NOT NULL,
+    namespace VARCHAR(100) NOT NULL,
+    report JSONB NOT NULL,
+    signature VARCHAR(128) NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (report_id)
+);
+CREATE INDEX IF NOT EXISTS idx_cms_tenant_deletion_report_tenant_id ON cms_tenant_deletion_report(tenant_id);
+
+CREATE TABLE IF NOT EXISTS cms_audit_log (
+    audit_id UUID DEFAULT gen_random_uuid(),
+    actor_id UUID,
+    action VARCHAR(100) NOT NULL,
+    target_type VARCHAR(50) NOT NULL,
+    target_id VARCHAR(100) NOT NULL,
+    namespace VARCHAR(100),
+    details JSONB NOT NULL DEFAULT '{}',
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (audit_id)
+);
+CREATE INDEX IF NOT EXISTS idx_cms_audit_log_created_at ON cms_audit_log(created_at);
+CREATE INDEX IF NOT EXISTS idx_cms_audit_log_namespace ON cms_audit_log(namespace);
+CREATE INDEX IF NOT EXISTS idx_cms_audit_log_target_id ON cms_audit_log(target_id);
+CREATE INDEX IF NOT EXISTS idx_cms_audit_log_action ON cms_audit_log(action);
+CREATE INDEX IF NOT EXISTS idx_cms_audit_log_actor_id ON cms_audit_log(actor_id);
+
+CREATE TABLE IF NOT EXISTS cms_job (
+    job_id UUID DEFAULT gen_random_uuid(),
+    kind VARCHAR(50) NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'PENDING',
+    namespace VARCHAR(100),
+    requested_by UUID,
+    result_path VARCHAR(500),
+    result_size BIGINT,
+    error TEXT,
+    started_at TIMESTAMPTZ,
+    finished_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (job_id)
+);
+CREATE INDEX IF NOT EXISTS idx_cms_job_namespace ON cms_job(namespace);
+CREATE INDEX IF NOT EXISTS idx_cms_job_status ON cms_job(status);
+CREATE INDEX IF NOT EXISTS idx_cms_job_kind ON cms_job(kind);
+
+CREATE TABLE IF NOT EXISTS cms_usage_counter (
+    namespace VARCHAR(100),
+    metric VARCHAR(50),
+    period VARCHAR(20),
+    value BIGINT NOT NULL DEFAULT 0,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (namespace, metric, period)
+);
+
+CREATE TABLE IF NOT EXISTS cms_tenant_quota (
+    namespace VARCHAR(100),
+    metric VARCHAR(50),
+    quota_limit BIGINT NOT NULL,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (namespace, metric)
+);
+
+CREATE TABLE IF NOT EXISTS cms_global_setting (
+    setting_key VARCHAR(100),
+    value JSONB NOT NULL,
+    updated_by UUID,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (setting_key)
+);
+
+CREATE TABLE IF NOT EXISTS cms_tenant_domain (
+    domain_id UUID DEFAULT gen_random_uuid(),
+    domain VARCHAR(253) NOT NULL,
+    namespace VARCHAR(100) NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'PENDING',
+    token VARCHAR(64) NOT NULL,
+    verified_at TIMESTAMPTZ,
+    last_checked_at TIMESTAMPTZ,
+    last_error VARCHAR(255),
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (domain_id),
+    CONSTRAINT uni_cms_tenant_domain_domain UNIQUE (domain)
+);
+CREATE INDEX IF NOT EXISTS idx_cms_tenant_domain_status ON cms_tenant_domain(status);
+CREATE INDEX IF NOT EXISTS idx_cms_tenant_domain_namespace ON cms_tenant_domain(namespace);
+
+CREATE TABLE IF NOT EXISTS cms_platform_metric (
+    "day" DATE,
+    namespace VARCHAR(100),
+    metric VARCHAR(50),
+    value BIGINT NOT NULL DEFAULT 0,
+    collected_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY ("day", namespace, metric)
+);
+CREATE INDEX IF NOT EXISTS idx_cms_platform_metric_namespace ON cms_platform_metric(namespace);
+
+CREATE TABLE IF NOT EXISTS cms_tenant_member (
+    namespace VARCHAR(100),
+    user_id UUID,
+    role VARCHAR(20) NOT NULL,
+    added_by UUID,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (namespace, user_id)
+);
+CREATE INDEX IF NOT EXISTS idx_cms_tenant_member_user_id ON cms_tenant_member(user_id);
+
+CREATE TABLE IF NOT EXISTS cms_tenant_transfer (
+    transfer_id UUID DEFAULT gen_random_uuid(),
+    namespace VARCHAR(100) NOT NULL,
+    from_user_id UUID NOT NULL,
+    to_user_id UUID NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'PENDING',
+    keep_access BOOLEAN NOT NULL DEFAULT TRUE,
+    message VARCHAR(500),
+    expires_at TIMESTAMPTZ NOT NULL,
+    resolved_at TIMESTAMPTZ,
+    resolved_by UUID,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (transfer_id)
+);
+CREATE INDEX IF NOT EXISTS idx_cms_tenant_transfer_to_user_id ON cms_tenant_transfer(to_user_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_transfer_pending ON cms_tenant_transfer(namespace) WHERE status = 'PENDING';
+
+CREATE TABLE IF NOT EXISTS cms_tenant_invitation (
+    invitation_id UUID DEFAULT gen_random_uuid(),
+    namespace VARCHAR(100) NOT NULL,
+    email VARCHAR(255) NOT NULL,
+    role VARCHAR(20) NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'PENDING',
+    token_hash VARCHAR(64) NOT NULL,
+    invited_by UUID,
+    send_count BIGINT NOT NULL DEFAULT 0,
+    last_sent_at TIMESTAMPTZ,
+    expires_at TIMESTAMPTZ NOT NULL,
+    accepted_at TIMESTAMPTZ,
+    lms_user_id UUID,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (invitation_id)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_invitation_pending ON cms_tenant_invitation(namespace, email) WHERE status = 'PENDING';
+CREATE INDEX IF NOT EXISTS idx_cms_tenant_invitation_namespace ON cms_tenant_invitation(namespace);
+
+CREATE TABLE IF NOT EXISTS cms_plan (
+    plan_id UUID DEFAULT gen_random_uuid(),
+    code VARCHAR(50) NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    description VARCHAR(500),
+    price_cents BIGINT NOT NULL DEFAULT 0,
+    currency VARCHAR(3) NOT NULL DEFAULT 'USD',
+    "interval" VARCHAR(10) NOT NULL,
+    trial_days BIGINT NOT NULL DEFAULT 0,
+    grace_days BIGINT,
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (plan_id),
+    CONSTRAINT uni_cms_plan_code UNIQUE (code)
+);
+
+CREATE TABLE IF NOT EXISTS cms_plan_system (
+    plan_id UUID,
+    system VARCHAR(100),
+    PRIMARY KEY (plan_id, system),
+    CONSTRAINT fk_cms_plan_system_catalog FOREIGN KEY (system) REFERENCES system_catalog(code),
+    CONSTRAINT fk_cms_plan_systems FOREIGN KEY (plan_id) REFERENCES cms_plan(plan_id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS cms_plan_quota (
+    plan_id UUID,
+    metric VARCHAR(50),
+    quota_limit BIGINT NOT NULL,
+    PRIMARY KEY (plan_id, metric),
+    CONSTRAINT fk_cms_plan_quotas FOREIGN KEY (plan_id) REFERENCES cms_plan(plan_id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS cms_subscription (
+    subscription_id UUID DEFAULT gen_random_uuid(),
+    customer_id UUID NOT NULL,
+    plan_id UUID NOT NULL,
+    status VARCHAR(20) NOT NULL,
+    current_period_start TIMESTAMPTZ NOT NULL,
+    current_period_end TIMESTAMPTZ NOT NULL,
+    trial_ends_at TIMESTAMPTZ,
+    cancel_at_period_end BOOLEAN NOT NULL DEFAULT FALSE,
+    past_due_since TIMESTAMPTZ,
+    next_attempt_at TIMESTAMPTZ,
+    canceled_at TIMESTAMPTZ,
+    ended_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (subscription_id)
+);
+CREATE INDEX IF NOT EXISTS idx_cms_subscription_current_period_end ON cms_subscription(current_period_end);
+CREATE INDEX IF NOT EXISTS idx_cms_subscription_status ON cms_subscription(status);
+CREATE INDEX IF NOT EXISTS idx_cms_subscription_plan_id ON cms_subscription(plan_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_subscription_live ON cms_subscription(customer_id) WHERE status <> 'CANCELED' AND status <> 'EXPIRED';
+CREATE INDEX IF NOT EXISTS idx_cms_subscription_customer_id ON cms_subscription(customer_id);
+
+CREATE TABLE IF NOT EXISTS cms_invoice (
+    invoice_id UUID DEFAULT gen_random_uuid(),
+    number VARCHAR(30) NOT NULL,
+    "year" BIGINT NOT NULL,
+    sequence BIGINT NOT NULL,
+    kind VARCHAR(20) NOT NULL,
+    customer_id UUID NOT NULL,
+    subscription_id UUID,
+    plan_id UUID,
+    bill_to_name VARCHAR(100) NOT NULL,
+    bill_to_email VARCHAR(150) NOT NULL,
+    currency VARCHAR(3) NOT NULL,
+    subtotal_cents BIGINT NOT NULL,
+    tax_cents BIGINT NOT NULL,
+    total_cents BIGINT NOT NULL,
+    period_start TIMESTAMPTZ,
+    period_end TIMESTAMPTZ,
+    issued_at TIMESTAMPTZ NOT NULL,
+    file_path VARCHAR(500),
+    emailed_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (invoice_id),
+    CONSTRAINT uni_cms_invoice_number UNIQUE (number)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_invoice_period ON cms_invoice(subscription_id, period_start);
+CREATE INDEX IF NOT EXISTS idx_cms_invoice_customer_id ON cms_invoice(customer_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_invoice_sequence ON cms_invoice("year", sequence);
+
+CREATE TABLE IF NOT EXISTS cms_invoice_line (
+    line_id UUID DEFAULT gen_random_uuid(),
+    invoice_id UUID NOT NULL,
+    "position" BIGINT NOT NULL,
+    kind VARCHAR(10) NOT NULL,
+    description VARCHAR(255) NOT NULL,
+    quantity BIGINT NOT NULL DEFAULT 1,
+    unit_cents BIGINT NOT NULL,
+    rate_basis_points BIGINT NOT NULL DEFAULT 0,
+    amount_cents BIGINT NOT NULL,
+    PRIMARY KEY (line_id),
+    CONSTRAINT fk_cms_invoice_lines FOREIGN KEY (invoice_id) REFERENCES cms_invoice(invoice_id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_cms_invoice_line_invoice_id ON cms_invoice_line(invoice_id);
+
+CREATE TABLE IF NOT EXISTS cms_invoice_sequence (
+    "year" BIGINT,
+    last_number BIGINT NOT NULL,
+    PRIMARY KEY ("year")
+);
+
+CREATE TABLE IF NOT EXISTS cms_payment_customer (
+    customer_id UUID,
+    provider VARCHAR(30),
+    external_id VARCHAR(100) NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (customer_id, provider)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_payment_customer_external ON cms_payment_customer(provider, external_id);
+
+CREATE TABLE IF NOT EXISTS cms_payment_checkout (
+    checkout_id UUID DEFAULT gen_random_uuid(),
+    customer_id UUID NOT NULL,
+    plan_id UUID NOT NULL,
+    provider VARCHAR(30) NOT NULL,
+    external_id VARCHAR(100) NOT NULL,
+    url VARCHAR(500) NOT NULL,
+    amount_cents BIGINT NOT NULL,
+    currency VARCHAR(3) NOT NULL,
+    status VARCHAR(20) NOT NULL,
+    payment_id UUID,
+    subscription_id UUID,
+    expires_at TIMESTAMPTZ,
+    completed_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (checkout_id)
+);
+CREATE INDEX IF NOT EXISTS idx_cms_payment_checkout_status ON cms_payment_checkout(status);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_checkout_external ON cms_payment_checkout(provider, external_id);
+CREATE INDEX IF NOT EXISTS idx_cms_payment_checkout_customer_id ON cms_payment_checkout(customer_id);
+
+CREATE TABLE IF NOT EXISTS cms_payment (
+    payment_id UUID DEFAULT gen_random_uuid(),
+    customer_id UUID NOT NULL,
+    subscription_id UUID,
+    provider VARCHAR(30) NOT NULL,
+    external_id VARCHAR(100) NOT NULL,
+    amount_cents BIGINT NOT NULL,
+    refunded_cents BIGINT NOT NULL DEFAULT 0,
+    currency VARCHAR(3) NOT NULL,
+    status VARCHAR(20) NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (payment_id)
+);
+CREATE INDEX IF NOT EXISTS idx_cms_payment_created_at ON cms_payment(created_at);
+CREATE INDEX IF NOT EXISTS idx_cms_payment_status ON cms_payment(status);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_payment_external ON cms_payment(provider, external_id);
+CREATE INDEX IF NOT EXISTS idx_cms_payment_subscription_id ON cms_payment(subscription_id);
+CREATE INDEX IF NOT EXISTS idx_cms_payment_customer_id ON cms_payment(customer_id);
+
+CREATE TABLE IF NOT EXISTS cms_payment_event (
+    provider VARCHAR(30),
+    event_id VARCHAR(100),
+    type VARCHAR(50) NOT NULL,
+    received_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (provider, event_id)
+);
+
+CREATE TABLE IF NOT EXISTS cms_coupon (
+    coupon_id UUID DEFAULT gen_random_uuid(),
+    code VARCHAR(50) NOT NULL,
+    description VARCHAR(500),
+    kind VARCHAR(10) NOT NULL,
+    percent_off BIGINT NOT NULL DEFAULT 0,
+    amount_off_cents BIGINT NOT NULL DEFAULT 0,
+    currency VARCHAR(3),
+    max_redemptions BIGINT,
+    redemptions BIGINT NOT NULL DEFAULT 0,
+    expires_at TIMESTAMPTZ,
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (coupon_id),
+    CONSTRAINT uni_cms_coupon_code UNIQUE (code)
+);
+
+CREATE TABLE IF NOT EXISTS cms_coupon_system (
+    coupon_id UUID,
+    system VARCHAR(100),
+    PRIMARY KEY (coupon_id, system),
+    CONSTRAINT fk_cms_coupon_system_catalog FOREIGN KEY (system) REFERENCES system_catalog(code),
+    CONSTRAINT fk_cms_coupon_systems FOREIGN KEY (coupon_id) REFERENCES cms_coupon(coupon_id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS cms_coupon_plan (
+    coupon_id UUID,
+    plan_id UUID,
+    PRIMARY KEY (coupon_id, plan_id),
+    CONSTRAINT fk_cms_coupon_plans FOREIGN KEY (coupon_id) REFERENCES cms_coupon(coupon_id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS cms_coupon_redemption (
+    redemption_id UUID DEFAULT gen_random_uuid(),
+    coupon_id UUID NOT NULL,
+    customer_id UUID NOT NULL,
+    plan_id UUID NOT NULL,
+    system VARCHAR(100),
+    checkout_id UUID,
+    subscription_id UUID,
+    purchase_id UUID,
+    price_cents BIGINT NOT NULL,
+    discount_cents BIGINT NOT NULL,
+    currency VARCHAR(3) NOT NULL,
+    redeemed_at TIMESTAMPTZ NOT NULL,
+    applied_at TIMESTAMPTZ,
+    PRIMARY KEY (redemption_id)
+);
+CREATE INDEX IF NOT EXISTS idx_cms_coupon_redemption_subscription_id ON cms_coupon_redemption(subscription_id);
+CREATE INDEX IF NOT EXISTS idx_cms_coupon_redemption_checkout_id ON cms_coupon_redemption(checkout_id);
+CREATE INDEX IF NOT EXISTS idx_cms_coupon_redemption_customer_id ON cms_coupon_redemption(customer_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_coupon_customer ON cms_coupon_redemption(coupon_id, customer_id);
+
+CREATE TABLE IF NOT EXISTS cms_report_schedule (
+    schedule_id UUID DEFAULT gen_random_uuid(),
+    name VARCHAR(200) NOT NULL,
+    report VARCHAR(50) NOT NULL,
+    filter JSONB NOT NULL,
+    format VARCHAR(10) NOT NULL DEFAULT 'csv',
+    cron VARCHAR(100) NOT NULL,
+    timezone VARCHAR(64) NOT NULL DEFAULT 'UTC',
+    recipients JSONB,
+    webhook_url VARCHAR(500),
+    enabled BOOLEAN NOT NULL,
+    next_run_at TIMESTAMPTZ,
+    last_run_at TIMESTAMPTZ,
+    last_version BIGINT NOT NULL DEFAULT 0,
+    last_error TEXT,
+    locked_by VARCHAR(100),
+    locked_until TIMESTAMPTZ,
+    created_by UUID,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (schedule_id)
+);
+CREATE INDEX IF NOT EXISTS idx_cms_report_schedule_next_run_at ON cms_report_schedule(next_run_at);
+
+CREATE TABLE IF NOT EXISTS cms_report_snapshot (
+    snapshot_id UUID DEFAULT gen_random_uuid(),
+    schedule_id UUID NOT NULL,
+    version BIGINT NOT NULL,
+    generated_at TIMESTAMPTZ NOT NULL,
+    row_count BIGINT NOT NULL,
+    checksum VARCHAR(64) NOT NULL,
+    data JSONB NOT NULL,
+    diff JSONB NOT NULL DEFAULT '{}',
+    delivery_error TEXT,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (snapshot_id),
+    CONSTRAINT fk_cms_report_schedule_snapshots FOREIGN KEY (schedule_id) REFERENCES cms_report_schedule(schedule_id) ON DELETE CASCADE
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_report_snapshot_version ON cms_report_snapshot(schedule_id, version);
+
+CREATE TABLE IF NOT EXISTS cms_growth_aggregate (
+    kind VARCHAR(30),
+    "key" VARCHAR(200),
+    data JSONB NOT NULL,
+    computed_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (kind, "key")
+);
+CREATE INDEX IF NOT EXISTS idx_cms_growth_aggregate_computed_at ON cms_growth_aggregate(computed_at);
+
+-- Databases from before the system catalog name systems with the former
+-- system_type enum and have no foreign keys to the catalog: every system they
+-- name joins the catalog, then the column and its key are brought in line.
+DO $$
+DECLARE
+    ref RECORD;
+BEGIN
+    FOR ref IN
+        SELECT * FROM (VALUES
+            ('cms_cus_purchase', 'system_name', 'fk_cms_cus_purchase_catalog'),
+            ('cms_plan_system', 'system', 'fk_cms_plan_system_catalog'),
+            ('cms_coupon_system', 'system', 'fk_cms_coupon_system_catalog')
+        ) AS r(tbl, col, fk)
+    LOOP
+        IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conrelid = ref.tbl::regclass AND conname = ref.fk) THEN
+            EXECUTE format(
+                'INSERT INTO system_catalog (code, name) SELECT DISTINCT %1$I::text, %1$I::text FROM %2$I ON CONFLICT (code) DO NOTHING',
+                ref.col, ref.tbl);
+            EXECUTE format('ALTER TABLE %1$I ALTER COLUMN %2$I TYPE VARCHAR(100) USING %2$I::text', ref.tbl, ref.col);
+            EXECUTE format('ALTER TABLE %I ADD CONSTRAINT %I FOREIGN KEY (%I) REFERENCES system_catalog(code)',
+                ref.tbl, ref.fk, ref.col);
+        END IF;
+    END LOOP;
+END $$;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_cms_cus_purchase_subscription_id;
+ALTER TABLE cms_cus_purchase DROP COLUMN IF EXISTS subscription_id;
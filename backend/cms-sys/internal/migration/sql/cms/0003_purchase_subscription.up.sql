@@ -0,0 +1,3 @@
+-- Purchases are tied to the subscription that pays for them.
+ALTER TABLE cms_cus_purchase ADD COLUMN IF NOT EXISTS subscription_id UUID;
+CREATE INDEX IF NOT EXISTS idx_cms_cus_purchase_subscription_id ON cms_cus_purchase(subscription_id);
@@ -0,0 +1,3 @@
+ALTER TABLE cms_report_snapshot DROP COLUMN IF EXISTS tenant_report_id;
+DROP INDEX IF EXISTS idx_cms_report_schedule_namespace;
+ALTER TABLE cms_report_schedule DROP COLUMN IF EXISTS namespace;
@@ -0,0 +1,5 @@
+-- A schedule may report on one tenant; its snapshots are then also written to
+-- the tenant's LMS Report table.
+ALTER TABLE cms_report_schedule ADD COLUMN IF NOT EXISTS namespace VARCHAR(100);
+CREATE INDEX IF NOT EXISTS idx_cms_report_schedule_namespace ON cms_report_schedule(namespace);
+ALTER TABLE cms_report_snapshot ADD COLUMN IF NOT EXISTS tenant_report_id UUID;
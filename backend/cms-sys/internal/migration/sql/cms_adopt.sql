@@ -0,0 +1,25 @@
+-- Brings a database the server built with AutoMigrate, before the CMS
+-- migration set existed, in line with what 0001_cms_core expects. Purchase
+-- tables from then may lack the columns it indexes.
+ALTER TABLE IF EXISTS cms_cus_purchase ADD COLUMN IF NOT EXISTS namespace VARCHAR(100);
+ALTER TABLE IF EXISTS cms_cus_purchase ADD COLUMN IF NOT EXISTS granted_by UUID;
+ALTER TABLE IF EXISTS cms_cus_purchase ADD COLUMN IF NOT EXISTS canceled_at TIMESTAMPTZ;
+ALTER TABLE IF EXISTS cms_cus_purchase ADD COLUMN IF NOT EXISTS canceled_by UUID;
+
+-- They may also hold duplicate purchases, which would stop 0001 building its
+-- unique index: keep the oldest purchase of each customer and system,
+-- preferring one attached to a tenant.
+DO $$
+BEGIN
+    IF to_regclass('cms_cus_purchase') IS NOT NULL THEN
+        DELETE FROM cms_cus_purchase WHERE relation_id IN (
+            SELECT relation_id FROM (
+                SELECT relation_id, row_number() OVER (
+                    PARTITION BY cms_cus_id, system_name
+                    ORDER BY (namespace IS NULL), purchase_date, relation_id
+                ) AS n
+                FROM cms_cus_purchase
+            ) ranked WHERE n > 1
+        );
+    END IF;
+END $$;
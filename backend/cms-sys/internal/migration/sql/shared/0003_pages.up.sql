@@ -0,0 +1,14 @@
+-- Static content pages (landing page, about, terms) managed per tenant.
+CREATE TABLE Page (
+                      page_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+                      tenant_id UUID NOT NULL DEFAULT current_tenant_id(),
+                      slug VARCHAR(150) NOT NULL,
+                      title VARCHAR(200) NOT NULL,
+                      content TEXT,
+                      is_published BOOLEAN NOT NULL DEFAULT FALSE,
+                      created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+                      updated_at TIMESTAMP,
+                      UNIQUE(tenant_id, slug)
+);
+
+CREATE INDEX idx_page_published ON Page(is_published);
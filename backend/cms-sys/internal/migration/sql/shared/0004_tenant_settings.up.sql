@@ -0,0 +1,10 @@
+-- Tenant overrides of platform settings. The primary key keeps the name
+-- tenant_setting_pkey used by dedicated schemas, so upserts work in both.
+CREATE TABLE tenant_setting (
+                                tenant_id UUID NOT NULL DEFAULT current_tenant_id(),
+                                setting_key VARCHAR(100) NOT NULL,
+                                value JSONB NOT NULL,
+                                updated_by UUID,
+                                updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                                CONSTRAINT tenant_setting_pkey PRIMARY KEY (tenant_id, setting_key)
+);
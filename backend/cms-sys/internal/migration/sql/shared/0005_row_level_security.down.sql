@@ -0,0 +1,16 @@
+DO $$
+DECLARE
+    t RECORD;
+BEGIN
+    FOR t IN
+        SELECT c.relname
+        FROM pg_class c
+        WHERE c.relnamespace = current_schema()::regnamespace
+          AND c.relkind = 'r'
+          AND c.relrowsecurity
+    LOOP
+        EXECUTE format('DROP POLICY IF EXISTS tenant_isolation ON %I', t.relname);
+        EXECUTE format('ALTER TABLE %I NO FORCE ROW LEVEL SECURITY', t.relname);
+        EXECUTE format('ALTER TABLE %I DISABLE ROW LEVEL SECURITY', t.relname);
+    END LOOP;
+END $$;
@@ -0,0 +1,21 @@
+-- Every tenant table only shows and accepts rows of the tenant the transaction
+-- is scoped to. FORCE applies the policy to the table owner as well, which is
+-- the role the application connects with. An unscoped session sees no rows.
+DO $$
+DECLARE
+    t RECORD;
+BEGIN
+    FOR t IN
+        SELECT c.relname
+        FROM pg_class c
+                 JOIN pg_attribute a ON a.attrelid = c.oid AND a.attname = 'tenant_id' AND NOT a.attisdropped
+        WHERE c.relnamespace = current_schema()::regnamespace
+          AND c.relkind = 'r'
+    LOOP
+        EXECUTE format('ALTER TABLE %I ENABLE ROW LEVEL SECURITY', t.relname);
+        EXECUTE format('ALTER TABLE %I FORCE ROW LEVEL SECURITY', t.relname);
+        EXECUTE format(
+            'CREATE POLICY tenant_isolation ON %I USING (tenant_id = current_tenant_id()) WITH CHECK (tenant_id = current_tenant_id())',
+            t.relname);
+    END LOOP;
+END $$;
@@ -0,0 +1 @@
+DELETE FROM LMS_USER_Role WHERE lms_role_name IN ('LMS_ADMIN', 'STUDENT', 'INSTRUCTOR');
@@ -0,0 +1,3 @@
+INSERT INTO LMS_USER_Role (lms_role_name)
+VALUES ('LMS_ADMIN'), ('STUDENT'), ('INSTRUCTOR')
+ON CONFLICT (lms_role_name) DO NOTHING;
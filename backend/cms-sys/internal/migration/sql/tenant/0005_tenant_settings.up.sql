@@ -0,0 +1,8 @@
+-- Tenant overrides of platform settings. Values are JSON and validated by the
+-- settings registry in the application before they are written.
+CREATE TABLE tenant_setting (
+                                setting_key VARCHAR(100) PRIMARY KEY,
+                                value JSONB NOT NULL,
+                                updated_by UUID,
+                                updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,39 @@
+package migration
+
+import (
+	"embed"
+	"io/fs"
+	"sync"
+)
+
+//go:embed sql/tenant/*.sql
+var tenantSQL embed.FS
+
+var (
+	tenantGoMu         sync.Mutex
+	tenantGoMigrations []Migration
+)
+
+// RegisterTenantMigration adds a Go migration to the tenant set. Call it from
+// an init function so the migration is present before any runner is built.
+func RegisterTenantMigration(m Migration) {
+	tenantGoMu.Lock()
+	defer tenantGoMu.Unlock()
+	tenantGoMigrations = append(tenantGoMigrations, m)
+}
+
+// TenantMigrations returns every migration that makes up a tenant schema.
+func TenantMigrations() ([]Migration, error) {
+	sub, err := fs.Sub(tenantSQL, "sql/tenant")
+	if err != nil {
+		return nil, err
+	}
+	migrations, err := LoadFS(sub)
+	if err != nil {
+		return nil, err
+	}
+
+	tenantGoMu.Lock()
+	defer tenantGoMu.Unlock()
+	return append(migrations, tenantGoMigrations...), nil
+}
@@ -0,0 +1,103 @@
+package repository
+
+import (
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/types"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+type AnalyticsRepository interface {
+	SaveMetrics(metrics []types.PlatformMetric) error
+	Series(metric types.PlatformMetricName, namespace string, from, to time.Time) ([]types.AnalyticsPoint, error)
+	Snapshot(day time.Time) ([]types.PlatformMetric, error)
+	SnapshotDays(from, to time.Time) ([]time.Time, error)
+	DeleteBefore(day time.Time) (int64, error)
+}
+
+type AnalyticsRepo struct {
+	logger *logrus.Logger
+	db     *gorm.DB
+}
+
+var _ AnalyticsRepository = (*AnalyticsRepo)(nil)
+
+func NewAnalyticsRepo(logger *logrus.Logger, db *gorm.DB) *AnalyticsRepo {
+	return &AnalyticsRepo{
+		logger: logger,
+		db:     db,
+	}
+}
+
+func (r *AnalyticsRepo) SaveMetrics(metrics []types.PlatformMetric) error {
+	if len(metrics) == 0 {
+		return nil
+	}
+	err := r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "day"}, {Name: "namespace"}, {Name: "metric"}},
+		DoUpdates: clause.AssignmentColumns([]string{"value", "collected_at"}),
+	}).Create(&metrics).Error
+	if err != nil {
+		r.logger.WithError(err).Error("Failed to save platform metrics")
+		return err
+	}
+	return nil
+}
+
+// Series sums a metric over tenants per day, or returns one tenant's values
+// when namespace is set. The tenants metric counts tenants with a snapshot.
+func (r *AnalyticsRepo) Series(metric types.PlatformMetricName, namespace string, from, to time.Time) ([]types.AnalyticsPoint, error) {
+	query := r.db.Model(&types.PlatformMetric{}).
+		Where("day BETWEEN ? AND ?", from, to).
+		Group("day").
+		Order("day")
+	if metric == types.AnalyticsTenants {
+		query = query.Select("day, COUNT(DISTINCT namespace) AS value")
+	} else {
+		query = query.Select("day, COALESCE(SUM(value), 0) AS value").Where("metric = ?", string(metric))
+	}
+	if namespace != "" {
+		query = query.Where("namespace = ?", namespace)
+	}
+
+	var points []types.AnalyticsPoint
+	if err := query.Scan(&points).Error; err != nil {
+		r.logger.WithError(err).Error("Failed to load analytics series")
+		return nil, err
+	}
+	return points, nil
+}
+
+func (r *AnalyticsRepo) Snapshot(day time.Time) ([]types.PlatformMetric, error) {
+	var metrics []types.PlatformMetric
+	if err := r.db.Where("day = ?", day).Order("namespace, metric").Find(&metrics).Error; err != nil {
+		r.logger.WithError(err).Error("Failed to load analytics snapshot")
+		return nil, err
+	}
+	return metrics, nil
+}
+
+// SnapshotDays lists the days in [from, to] that have any snapshot.
+func (r *AnalyticsRepo) SnapshotDays(from, to time.Time) ([]time.Time, error) {
+	var days []time.Time
+	err := r.db.Model(&types.PlatformMetric{}).
+		Where("day BETWEEN ? AND ?", from, to).
+		Distinct("day").
+		Order("day").
+		Pluck("day", &days).Error
+	if err != nil {
+		r.logger.WithError(err).Error("Failed to list analytics days")
+		return nil, err
+	}
+	return days, nil
+}
+
+func (r *AnalyticsRepo) DeleteBefore(day time.Time) (int64, error) {
+	result := r.db.Where("day < ?", day).Delete(&types.PlatformMetric{})
+	if result.Error != nil {
+		r.logger.WithError(result.Error).Error("Failed to delete old platform metrics")
+		return 0, result.Error
+	}
+	return result.RowsAffected, nil
+}
@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"encoding/json"
+	"github.com/google/uuid"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/types"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+type AuditRepository interface {
+	Record(actorID *uuid.UUID, action, targetType, targetID string, namespace *string, details map[string]interface{}) error
+	ListByNamespace(namespace string, limit, offset int) ([]types.AuditLog, int64, error)
+}
+
+type AuditRepo struct {
+	logger *logrus.Logger
+	db     *gorm.DB
+}
+
+var _ AuditRepository = (*AuditRepo)(nil)
+
+func NewAuditRepo(logger *logrus.Logger, db *gorm.DB) *AuditRepo {
+	return &AuditRepo{
+		logger: logger,
+		db:     db,
+	}
+}
+
+func (r *AuditRepo) Record(actorID *uuid.UUID, action, targetType, targetID string, namespace *string, details map[string]interface{}) error {
+	payload := "{}"
+	if len(details) > 0 {
+		encoded, err := json.Marshal(details)
+		if err != nil {
+			return err
+		}
+		payload = string(encoded)
+	}
+
+	entry := &types.AuditLog{
+		ActorID:    actorID,
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		Namespace:  namespace,
+		Details:    payload,
+	}
+	if err := r.db.Create(entry).Error; err != nil {
+		r.logger.WithError(err).Error("Failed to record audit entry")
+		return err
+	}
+	return nil
+}
+
+func (r *AuditRepo) ListByNamespace(namespace string, limit, offset int) ([]types.AuditLog, int64, error) {
+	var total int64
+	query := r.db.Model(&types.AuditLog{}).Where("namespace = ?", namespace)
+	if err := query.Count(&total).Error; err != nil {
+		r.logger.WithError(err).Error("Failed to count audit entries")
+		return nil, 0, err
+	}
+
+	var entries []types.AuditLog
+	if err := query.Order("created_at DESC").Limit(limit).Offset(offset).Find(&entries).Error; err != nil {
+		r.logger.WithError(err).Error("Failed to list audit entries")
+		return nil, 0, err
+	}
+	return entries, total, nil
+}
@@ -0,0 +1,156 @@
+package repository
+
+import (
+	"errors"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/types"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrSystemNotFound = errors.New("system not found")
+	ErrSystemExists   = errors.New("system already exists")
+)
+
+type CatalogRepository interface {
+	CreateSystem(system *types.SystemCatalog) error
+	GetSystem(code types.SystemType) (*types.SystemCatalog, error)
+	ListSystems(activeOnly bool) ([]types.SystemCatalog, error)
+	UpdateSystem(system *types.SystemCatalog) error
+	SetSystemStatus(code types.SystemType, status types.SystemStatus) (bool, error)
+	SeedSystems(systems []types.SystemCatalog) (int64, error)
+}
+
+type CatalogRepo struct {
+	logger *logrus.Logger
+	db     *gorm.DB
+}
+
+var _ CatalogRepository = (*CatalogRepo)(nil)
+
+func NewCatalogRepo(logger *logrus.Logger, db *gorm.DB) *CatalogRepo {
+	return &CatalogRepo{
+		logger: logger,
+		db:     db,
+	}
+}
+
+// CreateSystem inserts a catalog entry, returning ErrSystemExists when the
+// code is taken.
+func (r *CatalogRepo) CreateSystem(system *types.SystemCatalog) error {
+	result := r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(system)
+	if result.Error != nil {
+		r.logger.WithError(result.Error).Error("Failed to create system")
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrSystemExists
+	}
+	return nil
+}
+
+func (r *CatalogRepo) GetSystem(code types.SystemType) (*types.SystemCatalog, error) {
+	var system types.SystemCatalog
+	if err := r.db.Where("code = ?", string(code)).First(&system).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrSystemNotFound
+		}
+		r.logger.WithError(err).Error("Failed to get system")
+		return nil, err
+	}
+	return &system, nil
+}
+
+func (r *CatalogRepo) ListSystems(activeOnly bool) ([]types.SystemCatalog, error) {
+	var systems []types.SystemCatalog
+	query := r.db.Order("code")
+	if activeOnly {
+		query = query.Where("status = ?", types.SystemActive)
+	}
+	if err := query.Find(&systems).Error; err != nil {
+		r.logger.WithError(err).Error("Failed to list systems")
+		return nil, err
+	}
+	return systems, nil
+}
+
+// UpdateSystem overwrites everything but the code of a catalog entry.
+func (r *CatalogRepo) UpdateSystem(system *types.SystemCatalog) error {
+	result := r.db.Model(&types.SystemCatalog{}).Where("code = ?", string(system.Code)).Updates(map[string]interface{}{
+		"name":             system.Name,
+		"description":      system.Description,
+		"base_url":         system.BaseURL,
+		"status":           system.Status,
+		"provision_hook":   system.ProvisionHook,
+		"deprovision_hook": system.DeprovisionHook,
+		"updated_at":       system.UpdatedAt,
+	})
+	if result.Error != nil {
+		r.logger.WithError(result.Error).Error("Failed to update system")
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrSystemNotFound
+	}
+	return nil
+}
+
+// SetSystemStatus puts the system on or off sale. It reports false when the
+// system does not exist.
+func (r *CatalogRepo) SetSystemStatus(code types.SystemType, status types.SystemStatus) (bool, error) {
+	result := r.db.Model(&types.SystemCatalog{}).Where("code = ?", string(code)).Updates(map[string]interface{}{
+		"status":     status,
+		"updated_at": gorm.Expr("NOW()"),
+	})
+	if result.Error != nil {
+		r.logger.WithError(result.Error).Error("Failed to update system status")
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// SeedSystems adds the given entries when missing, then an active entry named
+// after its code for every system purchases, plans or coupons already refer
+// to. Existing entries are left alone. The catalog table must exist.
+func (r *CatalogRepo) SeedSystems(systems []types.SystemCatalog) (int64, error) {
+	var added int64
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if len(systems) > 0 {
+			result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&systems)
+			if result.Error != nil {
+				return result.Error
+			}
+			added += result.RowsAffected
+		}
+
+		migrator := tx.Migrator()
+		for _, ref := range []struct {
+			model  interface{}
+			table  string
+			column string
+		}{
+			{&types.CMSCusPurchase{}, "cms_cus_purchase", "system_name"},
+			{&types.PlanSystem{}, "cms_plan_system", "system"},
+			{&types.CouponSystem{}, "cms_coupon_system", "system"},
+		} {
+			if !migrator.HasTable(ref.model) {
+				continue
+			}
+			// The cast also reads the column of the former system_type enum.
+			result := tx.Exec(`INSERT INTO system_catalog (code, name, status)
+				SELECT DISTINCT `+ref.column+`::text, `+ref.column+`::text, ? FROM `+ref.table+`
+				ON CONFLICT (code) DO NOTHING`, types.SystemActive)
+			if result.Error != nil {
+				return result.Error
+			}
+			added += result.RowsAffected
+		}
+		return nil
+	})
+	if err != nil {
+		r.logger.WithError(err).Error("Failed to seed system catalog")
+		return 0, err
+	}
+	return added, nil
+}
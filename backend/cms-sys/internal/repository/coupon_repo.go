@@ -0,0 +1,281 @@
+package repository
+
+import (
+	"errors"
+	"github.com/google/uuid"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/types"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+var (
+	ErrCouponNotFound     = errors.New("coupon not found")
+	ErrCouponUnavailable  = errors.New("coupon is disabled, expired or used up")
+	ErrCouponRedeemed     = errors.New("coupon already redeemed by customer")
+	ErrRedemptionNotFound = errors.New("coupon redemption not found")
+)
+
+type CouponRepository interface {
+	CreateCoupon(coupon *types.Coupon) error
+	GetCoupon(id uuid.UUID) (*types.Coupon, error)
+	GetCouponByCode(code string) (*types.Coupon, error)
+	ListCoupons() ([]types.Coupon, error)
+	ReplaceCoupon(coupon *types.Coupon) error
+	SetCouponActive(id uuid.UUID, active bool) (bool, error)
+	Redeem(redemption *types.CouponRedemption) error
+	ReleaseRedemption(id uuid.UUID) (bool, error)
+	AttachRedemption(redemption *types.CouponRedemption) error
+	MarkApplied(id uuid.UUID, at time.Time) (bool, error)
+	GetRedemptionByCheckout(checkoutID uuid.UUID) (*types.CouponRedemption, error)
+	GetSubscriptionRedemption(subscriptionID uuid.UUID) (*types.CouponRedemption, error)
+	GetCustomerRedemption(couponID, customerID uuid.UUID) (*types.CouponRedemption, error)
+	ListRedemptions(couponID uuid.UUID) ([]types.CouponRedemption, error)
+}
+
+type CouponRepo struct {
+	logger *logrus.Logger
+	db     *gorm.DB
+}
+
+var _ CouponRepository = (*CouponRepo)(nil)
+
+func NewCouponRepo(logger *logrus.Logger, db *gorm.DB) *CouponRepo {
+	return &CouponRepo{
+		logger: logger,
+		db:     db,
+	}
+}
+
+// CreateCoupon inserts the coupon together with its systems and plans.
+func (r *CouponRepo) CreateCoupon(coupon *types.Coupon) error {
+	if coupon.CouponID == uuid.Nil {
+		coupon.CouponID = uuid.New()
+	}
+	if err := r.db.Create(coupon).Error; err != nil {
+		r.logger.WithError(err).Error("Failed to create coupon")
+		return err
+	}
+	return nil
+}
+
+func (r *CouponRepo) GetCoupon(id uuid.UUID) (*types.Coupon, error) {
+	return r.getCoupon("coupon_id = ?", id)
+}
+
+func (r *CouponRepo) GetCouponByCode(code string) (*types.Coupon, error) {
+	return r.getCoupon("code = ?", code)
+}
+
+func (r *CouponRepo) getCoupon(query string, arg interface{}) (*types.Coupon, error) {
+	var coupon types.Coupon
+	err := r.db.Preload("Systems").Preload("Plans").Where(query, arg).First(&coupon).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrCouponNotFound
+		}
+		r.logger.WithError(err).Error("Failed to get coupon")
+		return nil, err
+	}
+	return &coupon, nil
+}
+
+func (r *CouponRepo) ListCoupons() ([]types.Coupon, error) {
+	var coupons []types.Coupon
+	if err := r.db.Preload("Systems").Preload("Plans").Order("created_at DESC").Find(&coupons).Error; err != nil {
+		r.logger.WithError(err).Error("Failed to list coupons")
+		return nil, err
+	}
+	return coupons, nil
+}
+
+// ReplaceCoupon overwrites the coupon's terms and swaps its systems and plans
+// for the ones given, in one transaction. The redemption count is kept.
+func (r *CouponRepo) ReplaceCoupon(coupon *types.Coupon) error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&types.Coupon{}).Where("coupon_id = ?", coupon.CouponID).Updates(map[string]interface{}{
+			"code":             coupon.Code,
+			"description":      coupon.Description,
+			"kind":             coupon.Kind,
+			"percent_off":      coupon.PercentOff,
+			"amount_off_cents": coupon.AmountOffCents,
+			"currency":         coupon.Currency,
+			"max_redemptions":  coupon.MaxRedemptions,
+			"expires_at":       coupon.ExpiresAt,
+			"active":           coupon.Active,
+			"updated_at":       coupon.UpdatedAt,
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrCouponNotFound
+		}
+
+		if err := tx.Where("coupon_id = ?", coupon.CouponID).Delete(&types.CouponSystem{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("coupon_id = ?", coupon.CouponID).Delete(&types.CouponPlan{}).Error; err != nil {
+			return err
+		}
+		for i := range coupon.Systems {
+			coupon.Systems[i].CouponID = coupon.CouponID
+		}
+		for i := range coupon.Plans {
+			coupon.Plans[i].CouponID = coupon.CouponID
+		}
+		if len(coupon.Systems) > 0 {
+			if err := tx.Create(&coupon.Systems).Error; err != nil {
+				return err
+			}
+		}
+		if len(coupon.Plans) > 0 {
+			if err := tx.Create(&coupon.Plans).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, ErrCouponNotFound) {
+		r.logger.WithError(err).Error("Failed to replace coupon")
+	}
+	return err
+}
+
+// SetCouponActive enables or disables the coupon. It reports false when the
+// coupon does not exist.
+func (r *CouponRepo) SetCouponActive(id uuid.UUID, active bool) (bool, error) {
+	result := r.db.Model(&types.Coupon{}).Where("coupon_id = ?", id).Updates(map[string]interface{}{
+		"active":     active,
+		"updated_at": gorm.Expr("NOW()"),
+	})
+	if result.Error != nil {
+		r.logger.WithError(result.Error).Error("Failed to update coupon status")
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// Redeem counts a redemption against the coupon and inserts it, in one
+// transaction. The count only moves while the coupon is active, unexpired
+// and under its limit, so concurrent redemptions cannot exceed it; it
+// returns ErrCouponUnavailable otherwise, and ErrCouponRedeemed when the
+// customer has redeemed the coupon before.
+func (r *CouponRepo) Redeem(redemption *types.CouponRedemption) error {
+	if redemption.RedemptionID == uuid.Nil {
+		redemption.RedemptionID = uuid.New()
+	}
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&types.Coupon{}).
+			Where("coupon_id = ? AND active", redemption.CouponID).
+			Where("max_redemptions IS NULL OR redemptions < max_redemptions").
+			Where("expires_at IS NULL OR expires_at > ?", redemption.RedeemedAt).
+			Update("redemptions", gorm.Expr("redemptions + 1"))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrCouponUnavailable
+		}
+
+		result = tx.Clauses(clause.OnConflict{DoNothing: true}).Create(redemption)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrCouponRedeemed
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, ErrCouponUnavailable) && !errors.Is(err, ErrCouponRedeemed) {
+		r.logger.WithError(err).Error("Failed to redeem coupon")
+	}
+	return err
+}
+
+// ReleaseRedemption gives back a redemption whose discount was never
+// charged, freeing its place under the coupon's limit and letting the
+// customer redeem the coupon again. It reports false when there is nothing
+// to release.
+func (r *CouponRepo) ReleaseRedemption(id uuid.UUID) (bool, error) {
+	released := false
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var redemption types.CouponRedemption
+		result := tx.Clauses(clause.Returning{}).
+			Where("redemption_id = ? AND applied_at IS NULL", id).
+			Delete(&redemption)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		released = true
+		return tx.Model(&types.Coupon{}).Where("coupon_id = ?", redemption.CouponID).
+			Update("redemptions", gorm.Expr("GREATEST(redemptions - 1, 0)")).Error
+	})
+	if err != nil {
+		r.logger.WithError(err).Error("Failed to release coupon redemption")
+		return false, err
+	}
+	return released, nil
+}
+
+// AttachRedemption stores the subscription, purchase and applied time of a
+// redemption.
+func (r *CouponRepo) AttachRedemption(redemption *types.CouponRedemption) error {
+	err := r.db.Model(&types.CouponRedemption{}).Where("redemption_id = ?", redemption.RedemptionID).Updates(map[string]interface{}{
+		"subscription_id": redemption.SubscriptionID,
+		"purchase_id":     redemption.PurchaseID,
+		"applied_at":      redemption.AppliedAt,
+	}).Error
+	if err != nil {
+		r.logger.WithError(err).Error("Failed to attach coupon redemption")
+	}
+	return err
+}
+
+// MarkApplied records that a charge used the redemption's discount. It
+// reports false when it was already applied.
+func (r *CouponRepo) MarkApplied(id uuid.UUID, at time.Time) (bool, error) {
+	result := r.db.Model(&types.CouponRedemption{}).
+		Where("redemption_id = ? AND applied_at IS NULL", id).
+		Update("applied_at", at)
+	if result.Error != nil {
+		r.logger.WithError(result.Error).Error("Failed to mark coupon redemption applied")
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+func (r *CouponRepo) GetRedemptionByCheckout(checkoutID uuid.UUID) (*types.CouponRedemption, error) {
+	return r.firstRedemption(r.db.Where("checkout_id = ?", checkoutID))
+}
+
+// GetSubscriptionRedemption returns the coupon redeemed on a subscription.
+func (r *CouponRepo) GetSubscriptionRedemption(subscriptionID uuid.UUID) (*types.CouponRedemption, error) {
+	return r.firstRedemption(r.db.Where("subscription_id = ?", subscriptionID))
+}
+
+func (r *CouponRepo) GetCustomerRedemption(couponID, customerID uuid.UUID) (*types.CouponRedemption, error) {
+	return r.firstRedemption(r.db.Where("coupon_id = ? AND customer_id = ?", couponID, customerID))
+}
+
+func (r *CouponRepo) firstRedemption(query *gorm.DB) (*types.CouponRedemption, error) {
+	var redemption types.CouponRedemption
+	if err := query.First(&redemption).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrRedemptionNotFound
+		}
+		r.logger.WithError(err).Error("Failed to get coupon redemption")
+		return nil, err
+	}
+	return &redemption, nil
+}
+
+func (r *CouponRepo) ListRedemptions(couponID uuid.UUID) ([]types.CouponRedemption, error) {
+	var redemptions []types.CouponRedemption
+	if err := r.db.Where("coupon_id = ?", couponID).Order("redeemed_at DESC").Find(&redemptions).Error; err != nil {
+		r.logger.WithError(err).Error("Failed to list coupon redemptions")
+		return nil, err
+	}
+	return redemptions, nil
+}
@@ -0,0 +1,134 @@
+package repository
+
+import (
+	"errors"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/types"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"time"
+)
+
+var ErrDomainNotFound = errors.New("domain not found")
+
+type DomainRepository interface {
+	ClaimDomain(domain *types.TenantDomain, staleBefore time.Time) (bool, error)
+	GetDomain(domain string) (*types.TenantDomain, error)
+	ListDomains(namespace string) ([]types.TenantDomain, error)
+	ListByStatus(status types.DomainStatus) ([]types.TenantDomain, error)
+	CountDomains(namespace string) (int64, error)
+	UpdateDomain(domain *types.TenantDomain) error
+	DeleteDomain(domain string) error
+	DeleteNamespace(namespace string) error
+	DeletePendingBefore(t time.Time) (int64, error)
+}
+
+type DomainRepo struct {
+	logger *logrus.Logger
+	db     *gorm.DB
+}
+
+var _ DomainRepository = (*DomainRepo)(nil)
+
+func NewDomainRepo(logger *logrus.Logger, db *gorm.DB) *DomainRepo {
+	return &DomainRepo{
+		logger: logger,
+		db:     db,
+	}
+}
+
+// ClaimDomain inserts the domain unless another claim holds it. A pending
+// claim created before staleBefore is abandoned and is taken over in the same
+// statement, so two tenants racing for a domain cannot both get it.
+func (r *DomainRepo) ClaimDomain(domain *types.TenantDomain, staleBefore time.Time) (bool, error) {
+	var created []types.TenantDomain
+	err := r.db.Raw(`INSERT INTO cms_tenant_domain AS d (domain_id, domain, namespace, status, token, created_at, updated_at)
+		VALUES (gen_random_uuid(), ?, ?, ?, ?, NOW(), NOW())
+		ON CONFLICT (domain)
+		DO UPDATE SET domain_id = EXCLUDED.domain_id, namespace = EXCLUDED.namespace, status = EXCLUDED.status,
+			token = EXCLUDED.token, verified_at = NULL, last_checked_at = NULL, last_error = '',
+			created_at = EXCLUDED.created_at, updated_at = EXCLUDED.updated_at
+		WHERE d.status = ? AND d.created_at < ?
+		RETURNING d.*`, domain.Domain, domain.Namespace, types.DomainPending, domain.Token,
+		types.DomainPending, staleBefore).Scan(&created).Error
+	if err != nil {
+		r.logger.WithError(err).Error("Failed to claim domain")
+		return false, err
+	}
+	if len(created) == 0 {
+		return false, nil
+	}
+	*domain = created[0]
+	return true, nil
+}
+
+func (r *DomainRepo) GetDomain(domain string) (*types.TenantDomain, error) {
+	var d types.TenantDomain
+	if err := r.db.Where("domain = ?", domain).First(&d).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrDomainNotFound
+		}
+		r.logger.WithError(err).Error("Failed to get domain")
+		return nil, err
+	}
+	return &d, nil
+}
+
+func (r *DomainRepo) ListDomains(namespace string) ([]types.TenantDomain, error) {
+	var domains []types.TenantDomain
+	if err := r.db.Where("namespace = ?", namespace).Order("domain").Find(&domains).Error; err != nil {
+		r.logger.WithError(err).Error("Failed to list domains")
+		return nil, err
+	}
+	return domains, nil
+}
+
+func (r *DomainRepo) ListByStatus(status types.DomainStatus) ([]types.TenantDomain, error) {
+	var domains []types.TenantDomain
+	if err := r.db.Where("status = ?", status).Order("domain").Find(&domains).Error; err != nil {
+		r.logger.WithError(err).Error("Failed to list domains by status")
+		return nil, err
+	}
+	return domains, nil
+}
+
+func (r *DomainRepo) CountDomains(namespace string) (int64, error) {
+	var n int64
+	if err := r.db.Model(&types.TenantDomain{}).Where("namespace = ?", namespace).Count(&n).Error; err != nil {
+		r.logger.WithError(err).Error("Failed to count domains")
+		return 0, err
+	}
+	return n, nil
+}
+
+func (r *DomainRepo) UpdateDomain(domain *types.TenantDomain) error {
+	if err := r.db.Save(domain).Error; err != nil {
+		r.logger.WithError(err).Error("Failed to update domain")
+		return err
+	}
+	return nil
+}
+
+func (r *DomainRepo) DeleteDomain(domain string) error {
+	if err := r.db.Where("domain = ?", domain).Delete(&types.TenantDomain{}).Error; err != nil {
+		r.logger.WithError(err).Error("Failed to delete domain")
+		return err
+	}
+	return nil
+}
+
+func (r *DomainRepo) DeleteNamespace(namespace string) error {
+	if err := r.db.Where("namespace = ?", namespace).Delete(&types.TenantDomain{}).Error; err != nil {
+		r.logger.WithError(err).Error("Failed to delete tenant domains")
+		return err
+	}
+	return nil
+}
+
+func (r *DomainRepo) DeletePendingBefore(t time.Time) (int64, error) {
+	result := r.db.Where("status = ? AND created_at < ?", types.DomainPending, t).Delete(&types.TenantDomain{})
+	if result.Error != nil {
+		r.logger.WithError(result.Error).Error("Failed to delete stale domain claims")
+		return 0, result.Error
+	}
+	return result.RowsAffected, nil
+}
@@ -0,0 +1,331 @@
+package repository
+
+import (
+	"errors"
+	"github.com/google/uuid"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/types"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"strings"
+	"time"
+)
+
+// Months are grouped on UTC calendar months whatever the session time zone:
+// timestamps are compared as UTC wall times and month bounds passed as dates.
+const monthLayout = "2006-01-02"
+
+// monthsBetween is the number of calendar months from column a to column b.
+func monthsBetween(a, b string) string {
+	return "((EXTRACT(YEAR FROM " + b + ") - EXTRACT(YEAR FROM " + a + ")) * 12 + EXTRACT(MONTH FROM " + b + ") - EXTRACT(MONTH FROM " + a + "))::int"
+}
+
+// paidStatuses are the payments that collected money, refunded or not.
+var paidStatuses = []types.PaymentStatus{types.PaymentSucceeded, types.PaymentPartiallyRefunded, types.PaymentRefunded}
+
+var ErrGrowthAggregateNotFound = errors.New("growth aggregate not found")
+
+type GrowthRepository interface {
+	CohortSizes(from, to time.Time) ([]types.CohortCell, error)
+	CohortConversions(from, to time.Time) ([]types.CohortCell, error)
+	CohortRetention(from, to time.Time) ([]types.CohortCell, error)
+	Funnel(from, to time.Time, system types.SystemType) (*types.FunnelCounts, error)
+	SubscriptionMonths(from, to time.Time) ([]types.SubscriptionMonth, error)
+	RevenueByPlan(from, to time.Time) ([]types.PlanRevenue, error)
+	PlanSystems() (map[uuid.UUID][]types.SystemType, error)
+
+	GetAggregate(kind types.GrowthAggregateKind, key string) (*types.GrowthAggregate, error)
+	SaveAggregate(aggregate *types.GrowthAggregate) error
+	DeleteAggregatesBefore(t time.Time) (int64, error)
+}
+
+type GrowthRepo struct {
+	logger *logrus.Logger
+	db     *gorm.DB
+}
+
+var _ GrowthRepository = (*GrowthRepo)(nil)
+
+func NewGrowthRepo(logger *logrus.Logger, db *gorm.DB) *GrowthRepo {
+	return &GrowthRepo{
+		logger: logger,
+		db:     db,
+	}
+}
+
+// cohortsCTE selects the customers who signed up in the months from through to
+// with their signup month.
+const cohortsCTE = `cohort AS (
+	SELECT cms_user_id AS customer_id, date_trunc('month', created_at AT TIME ZONE 'UTC') AS cohort
+	FROM cms_user
+	WHERE cms_user_role = @role
+		AND created_at AT TIME ZONE 'UTC' >= CAST(@from AS timestamp)
+		AND created_at AT TIME ZONE 'UTC' < CAST(@until AS timestamp)
+)`
+
+// firstPurchaseCTE finds when each customer first bought a system. Purchases
+// that are bought again keep only their latest date, so the start of the
+// customer's first subscription counts too. Granted systems are not
+// purchases.
+const firstPurchaseCTE = `first_purchase AS (
+	SELECT customer_id, MIN(at) AT TIME ZONE 'UTC' AS at FROM (
+		SELECT cms_cus_id AS customer_id, purchase_date AS at FROM cms_cus_purchase
+		WHERE granted_by IS NULL /*purchase_system*/
+		UNION ALL
+		SELECT s.customer_id, s.created_at FROM cms_subscription s /*subscription_system*/
+	) bought
+	GROUP BY customer_id
+)`
+
+func growthArgs(from, to time.Time) map[string]interface{} {
+	return map[string]interface{}{
+		"role":  string(types.CMSCustomer),
+		"from":  from.Format(monthLayout),
+		"to":    to.Format(monthLayout),
+		"until": to.AddDate(0, 1, 0).Format(monthLayout),
+	}
+}
+
+// CohortSizes counts the customers who signed up in each month.
+func (r *GrowthRepo) CohortSizes(from, to time.Time) ([]types.CohortCell, error) {
+	var cells []types.CohortCell
+	err := r.db.Raw(`WITH `+cohortsCTE+`
+		SELECT cohort, 0 AS period, COUNT(*) AS count FROM cohort GROUP BY cohort ORDER BY cohort`,
+		growthArgs(from, to)).Scan(&cells).Error
+	if err != nil {
+		r.logger.WithError(err).Error("Failed to count cohorts")
+		return nil, err
+	}
+	return cells, nil
+}
+
+// CohortConversions counts, per cohort, the customers whose first purchase
+// fell in each month after signing up.
+func (r *GrowthRepo) CohortConversions(from, to time.Time) ([]types.CohortCell, error) {
+	var cells []types.CohortCell
+	err := r.db.Raw(`WITH `+cohortsCTE+`, `+firstPurchase("")+`
+		SELECT c.cohort, `+monthsBetween("c.cohort", "date_trunc('month', f.at)")+` AS period, COUNT(*) AS count
+		FROM cohort c
+		JOIN first_purchase f ON f.customer_id = c.customer_id
+		GROUP BY 1, 2
+		ORDER BY 1, 2`,
+		growthArgs(from, to)).Scan(&cells).Error
+	if err != nil {
+		r.logger.WithError(err).Error("Failed to count cohort conversions")
+		return nil, err
+	}
+	return cells, nil
+}
+
+// CohortRetention counts, per cohort and month up to the last month of the
+// range, the customers who held a purchased system or a paying subscription
+// at some point in the month.
+func (r *GrowthRepo) CohortRetention(from, to time.Time) ([]types.CohortCell, error) {
+	var cells []types.CohortCell
+	err := r.db.Raw(`WITH `+cohortsCTE+`
+		SELECT c.cohort, `+monthsBetween("c.cohort", "m.month")+` AS period, COUNT(*) AS count
+		FROM cohort c
+		JOIN generate_series(CAST(@from AS timestamp), CAST(@to AS timestamp), interval '1 month') m(month) ON m.month >= c.cohort
+		WHERE EXISTS (
+			SELECT 1 FROM cms_cus_purchase p
+			WHERE p.cms_cus_id = c.customer_id AND p.granted_by IS NULL
+				AND p.purchase_date AT TIME ZONE 'UTC' < m.month + interval '1 month'
+				AND (p.canceled_at IS NULL OR p.canceled_at AT TIME ZONE 'UTC' >= m.month)
+		) OR EXISTS (
+			SELECT 1 FROM cms_subscription s
+			WHERE s.customer_id = c.customer_id
+				AND GREATEST(s.created_at, s.trial_ends_at) AT TIME ZONE 'UTC' < m.month + interval '1 month'
+				AND (s.ended_at IS NULL OR s.ended_at AT TIME ZONE 'UTC' >= m.month)
+		)
+		GROUP BY 1, 2
+		ORDER BY 1, 2`,
+		growthArgs(from, to)).Scan(&cells).Error
+	if err != nil {
+		r.logger.WithError(err).Error("Failed to count cohort retention")
+		return nil, err
+	}
+	return cells, nil
+}
+
+// Funnel counts how far the customers who signed up in the range got, each
+// stage among those who reached the one before, and how long everyone who
+// bought took to do so. With a system, purchases, payments and active
+// customers only count for that system.
+func (r *GrowthRepo) Funnel(from, to time.Time, system types.SystemType) (*types.FunnelCounts, error) {
+	args := growthArgs(from, to)
+	args["paid"] = paidStatuses
+	paymentSystem, activeSystem := "", ""
+	if system != "" {
+		args["system"] = string(system)
+		paymentSystem = `AND EXISTS (
+			SELECT 1 FROM cms_subscription s JOIN cms_plan_system ps ON ps.plan_id = s.plan_id
+			WHERE s.subscription_id = pay.subscription_id AND ps.system = @system
+		)`
+		activeSystem = "AND system_name = @system"
+	}
+
+	var counts types.FunnelCounts
+	err := r.db.Raw(`WITH signup AS (
+			SELECT cms_user_id AS customer_id, created_at AT TIME ZONE 'UTC' AS created_at, verified
+			FROM cms_user
+			WHERE cms_user_role = @role
+				AND created_at AT TIME ZONE 'UTC' >= CAST(@from AS timestamp)
+				AND created_at AT TIME ZONE 'UTC' < CAST(@until AS timestamp)
+		), `+firstPurchase(system)+`, first_payment AS (
+			SELECT pay.customer_id FROM cms_payment pay
+			WHERE pay.status IN @paid `+paymentSystem+`
+			GROUP BY pay.customer_id
+		), active AS (
+			SELECT DISTINCT cms_cus_id AS customer_id FROM cms_cus_purchase
+			WHERE granted_by IS NULL AND canceled_at IS NULL `+activeSystem+`
+		), converted AS (
+			SELECT s.*, GREATEST(EXTRACT(EPOCH FROM f.at - s.created_at) / 86400, 0) AS days
+			FROM signup s JOIN first_purchase f ON f.customer_id = s.customer_id
+		)
+		SELECT
+			(SELECT COUNT(*) FROM signup) AS registered,
+			(SELECT COUNT(*) FROM signup WHERE verified) AS verified,
+			(SELECT COUNT(*) FROM converted WHERE verified) AS purchased,
+			(SELECT COUNT(*) FROM converted JOIN first_payment USING (customer_id) WHERE verified) AS paid,
+			(SELECT COUNT(*) FROM converted JOIN first_payment USING (customer_id) JOIN active USING (customer_id) WHERE verified) AS active,
+			percentile_cont(0.5) WITHIN GROUP (ORDER BY days) AS median_days,
+			percentile_cont(0.75) WITHIN GROUP (ORDER BY days) AS p75_days,
+			percentile_cont(0.9) WITHIN GROUP (ORDER BY days) AS p90_days,
+			COUNT(*) FILTER (WHERE days < 1) AS within_day,
+			COUNT(*) FILTER (WHERE days >= 1 AND days < 7) AS within_week,
+			COUNT(*) FILTER (WHERE days >= 7 AND days < 30) AS within_month,
+			COUNT(*) FILTER (WHERE days >= 30 AND days < 90) AS within_quarter,
+			COUNT(*) FILTER (WHERE days >= 90) AS later
+		FROM converted`, args).Scan(&counts).Error
+	if err != nil {
+		r.logger.WithError(err).Error("Failed to count conversion funnel")
+		return nil, err
+	}
+	return &counts, nil
+}
+
+// firstPurchase is firstPurchaseCTE, narrowed to system when it is set.
+func firstPurchase(system types.SystemType) string {
+	if system == "" {
+		return strings.NewReplacer("/*purchase_system*/", "", "/*subscription_system*/", "").Replace(firstPurchaseCTE)
+	}
+	return strings.NewReplacer(
+		"/*purchase_system*/", "AND system_name = @system",
+		"/*subscription_system*/", "JOIN cms_plan_system ps ON ps.plan_id = s.plan_id AND ps.system = @system",
+	).Replace(firstPurchaseCTE)
+}
+
+// SubscriptionMonths sums paying subscriptions per month and currency. Yearly
+// plans count for a twelfth of their price a month and free plans not at all.
+// Months without any subscription in a currency are left out.
+func (r *GrowthRepo) SubscriptionMonths(from, to time.Time) ([]types.SubscriptionMonth, error) {
+	args := growthArgs(from, to)
+	args["year"] = string(types.IntervalYear)
+
+	paying := func(at string) string {
+		return "sub.paying_from < " + at + " AND (sub.ended_at IS NULL OR sub.ended_at >= " + at + ")"
+	}
+	started := "sub.paying_from >= m.month AND sub.paying_from < m.month + interval '1 month' AND (sub.ended_at IS NULL OR sub.ended_at > sub.paying_from)"
+	ended := "sub.ended_at >= m.month AND sub.ended_at < m.month + interval '1 month' AND sub.paying_from < sub.ended_at"
+
+	var months []types.SubscriptionMonth
+	err := r.db.Raw(`WITH sub AS (
+			SELECT s.customer_id, p.currency,
+				GREATEST(s.created_at, s.trial_ends_at) AT TIME ZONE 'UTC' AS paying_from,
+				s.ended_at AT TIME ZONE 'UTC' AS ended_at,
+				CASE WHEN p."interval" = @year THEN p.price_cents / 12.0 ELSE p.price_cents END AS monthly
+			FROM cms_subscription s
+			JOIN cms_plan p ON p.plan_id = s.plan_id
+			WHERE p.price_cents > 0
+		)
+		SELECT m.month, sub.currency,
+			ROUND(COALESCE(SUM(sub.monthly) FILTER (WHERE `+paying("m.month")+`), 0))::bigint AS start_mrr_cents,
+			ROUND(COALESCE(SUM(sub.monthly) FILTER (WHERE `+paying("m.month + interval '1 month'")+`), 0))::bigint AS mrr_cents,
+			ROUND(COALESCE(SUM(sub.monthly) FILTER (WHERE `+started+`), 0))::bigint AS new_mrr_cents,
+			ROUND(COALESCE(SUM(sub.monthly) FILTER (WHERE `+ended+`), 0))::bigint AS churned_mrr_cents,
+			COUNT(DISTINCT sub.customer_id) FILTER (WHERE `+paying("m.month")+`) AS start_customers,
+			COUNT(DISTINCT sub.customer_id) FILTER (WHERE `+paying("m.month + interval '1 month'")+`) AS customers,
+			COUNT(DISTINCT sub.customer_id) FILTER (WHERE `+started+`) AS new_customers,
+			COUNT(DISTINCT sub.customer_id) FILTER (WHERE `+ended+`) AS churned_customers
+		FROM generate_series(CAST(@from AS timestamp), CAST(@to AS timestamp), interval '1 month') m(month)
+		CROSS JOIN sub
+		GROUP BY m.month, sub.currency
+		ORDER BY m.month, sub.currency`, args).Scan(&months).Error
+	if err != nil {
+		r.logger.WithError(err).Error("Failed to sum subscription months")
+		return nil, err
+	}
+	return months, nil
+}
+
+// RevenueByPlan sums the money collected per month, currency and plan, net
+// of refunds. A refund counts against the month of its payment.
+func (r *GrowthRepo) RevenueByPlan(from, to time.Time) ([]types.PlanRevenue, error) {
+	args := growthArgs(from, to)
+	args["paid"] = paidStatuses
+
+	var revenue []types.PlanRevenue
+	err := r.db.Raw(`SELECT date_trunc('month', pay.created_at AT TIME ZONE 'UTC') AS month, pay.currency, s.plan_id,
+			SUM(pay.amount_cents - pay.refunded_cents) AS revenue_cents, COUNT(*) AS payments
+		FROM cms_payment pay
+		LEFT JOIN cms_subscription s ON s.subscription_id = pay.subscription_id
+		WHERE pay.status IN @paid
+			AND pay.created_at AT TIME ZONE 'UTC' >= CAST(@from AS timestamp)
+			AND pay.created_at AT TIME ZONE 'UTC' < CAST(@until AS timestamp)
+		GROUP BY 1, 2, 3
+		ORDER BY 1, 2`, args).Scan(&revenue).Error
+	if err != nil {
+		r.logger.WithError(err).Error("Failed to sum revenue")
+		return nil, err
+	}
+	return revenue, nil
+}
+
+// PlanSystems lists the systems of every plan, in code order.
+func (r *GrowthRepo) PlanSystems() (map[uuid.UUID][]types.SystemType, error) {
+	var rows []types.PlanSystem
+	if err := r.db.Order("plan_id, system").Find(&rows).Error; err != nil {
+		r.logger.WithError(err).Error("Failed to list plan systems")
+		return nil, err
+	}
+	systems := make(map[uuid.UUID][]types.SystemType)
+	for _, row := range rows {
+		systems[row.PlanID] = append(systems[row.PlanID], row.System)
+	}
+	return systems, nil
+}
+
+func (r *GrowthRepo) GetAggregate(kind types.GrowthAggregateKind, key string) (*types.GrowthAggregate, error) {
+	var aggregate types.GrowthAggregate
+	if err := r.db.Where("kind = ? AND key = ?", string(kind), key).First(&aggregate).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrGrowthAggregateNotFound
+		}
+		r.logger.WithError(err).Error("Failed to get growth aggregate")
+		return nil, err
+	}
+	return &aggregate, nil
+}
+
+// SaveAggregate stores an aggregate, replacing the one computed before for
+// the same query.
+func (r *GrowthRepo) SaveAggregate(aggregate *types.GrowthAggregate) error {
+	err := r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "kind"}, {Name: "key"}},
+		DoUpdates: clause.AssignmentColumns([]string{"data", "computed_at"}),
+	}).Create(aggregate).Error
+	if err != nil {
+		r.logger.WithError(err).Error("Failed to save growth aggregate")
+		return err
+	}
+	return nil
+}
+
+func (r *GrowthRepo) DeleteAggregatesBefore(t time.Time) (int64, error) {
+	result := r.db.Where("computed_at < ?", t).Delete(&types.GrowthAggregate{})
+	if result.Error != nil {
+		r.logger.WithError(result.Error).Error("Failed to delete old growth aggregates")
+		return 0, result.Error
+	}
+	return result.RowsAffected, nil
+}
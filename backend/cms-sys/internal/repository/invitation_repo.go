@@ -0,0 +1,167 @@
+package repository
+
+import (
+	"errors"
+	"github.com/google/uuid"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/types"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"time"
+)
+
+var ErrInvitationNotFound = errors.New("invitation not found")
+
+type InvitationRepository interface {
+	CreateInvitation(invitation *types.TenantInvitation) (bool, error)
+	GetInvitation(id uuid.UUID) (*types.TenantInvitation, error)
+	ListInvitations(namespace string) ([]types.TenantInvitation, error)
+	RotateToken(invitation *types.TenantInvitation) (bool, error)
+	MarkSent(id uuid.UUID, at time.Time) error
+	RevokeInvitation(id uuid.UUID) (bool, error)
+	ClaimInvitation(id uuid.UUID, tokenHash string, now time.Time) (bool, error)
+	SetLMSUser(id, lmsUserID uuid.UUID) error
+	ExpireInvitations(now time.Time) (int64, error)
+	DeleteNamespace(namespace string) error
+}
+
+type InvitationRepo struct {
+	logger *logrus.Logger
+	db     *gorm.DB
+}
+
+var _ InvitationRepository = (*InvitationRepo)(nil)
+
+func NewInvitationRepo(logger *logrus.Logger, db *gorm.DB) *InvitationRepo {
+	return &InvitationRepo{
+		logger: logger,
+		db:     db,
+	}
+}
+
+// CreateInvitation inserts a pending invitation unless the address already
+// has one for the tenant.
+func (r *InvitationRepo) CreateInvitation(invitation *types.TenantInvitation) (bool, error) {
+	if invitation.InvitationID == uuid.Nil {
+		invitation.InvitationID = uuid.New()
+	}
+	invitation.Status = types.InvitationPending
+	result := r.db.Exec(`INSERT INTO cms_tenant_invitation
+		(invitation_id, namespace, email, role, status, token_hash, invited_by, send_count, expires_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, 0, ?, NOW())
+		ON CONFLICT (namespace, email) WHERE status = 'PENDING' DO NOTHING`,
+		invitation.InvitationID, invitation.Namespace, invitation.Email, invitation.Role, invitation.Status,
+		invitation.TokenHash, invitation.InvitedBy, invitation.ExpiresAt)
+	if result.Error != nil {
+		r.logger.WithError(result.Error).Error("Failed to create invitation")
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+func (r *InvitationRepo) GetInvitation(id uuid.UUID) (*types.TenantInvitation, error) {
+	var invitation types.TenantInvitation
+	if err := r.db.Where("invitation_id = ?", id).First(&invitation).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvitationNotFound
+		}
+		r.logger.WithError(err).Error("Failed to get invitation")
+		return nil, err
+	}
+	return &invitation, nil
+}
+
+func (r *InvitationRepo) ListInvitations(namespace string) ([]types.TenantInvitation, error) {
+	var invitations []types.TenantInvitation
+	if err := r.db.Where("namespace = ?", namespace).Order("created_at DESC").Find(&invitations).Error; err != nil {
+		r.logger.WithError(err).Error("Failed to list invitations")
+		return nil, err
+	}
+	return invitations, nil
+}
+
+// RotateToken stores a new token hash and expiry. It reports false when the
+// invitation is no longer pending.
+func (r *InvitationRepo) RotateToken(invitation *types.TenantInvitation) (bool, error) {
+	result := r.db.Model(&types.TenantInvitation{}).
+		Where("invitation_id = ? AND status = ?", invitation.InvitationID, types.InvitationPending).
+		Updates(map[string]interface{}{
+			"token_hash": invitation.TokenHash,
+			"expires_at": invitation.ExpiresAt,
+		})
+	if result.Error != nil {
+		r.logger.WithError(result.Error).Error("Failed to rotate invitation token")
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+func (r *InvitationRepo) MarkSent(id uuid.UUID, at time.Time) error {
+	err := r.db.Model(&types.TenantInvitation{}).
+		Where("invitation_id = ?", id).
+		Updates(map[string]interface{}{
+			"last_sent_at": at,
+			"send_count":   gorm.Expr("send_count + 1"),
+		}).Error
+	if err != nil {
+		r.logger.WithError(err).Error("Failed to record invitation send")
+		return err
+	}
+	return nil
+}
+
+func (r *InvitationRepo) RevokeInvitation(id uuid.UUID) (bool, error) {
+	result := r.db.Model(&types.TenantInvitation{}).
+		Where("invitation_id = ? AND status = ?", id, types.InvitationPending).
+		Update("status", types.InvitationRevoked)
+	if result.Error != nil {
+		r.logger.WithError(result.Error).Error("Failed to revoke invitation")
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// ClaimInvitation marks a pending, unexpired invitation accepted if the token
+// hash still matches. Only one caller can claim an invitation.
+func (r *InvitationRepo) ClaimInvitation(id uuid.UUID, tokenHash string, now time.Time) (bool, error) {
+	result := r.db.Model(&types.TenantInvitation{}).
+		Where("invitation_id = ? AND status = ? AND token_hash = ? AND expires_at > ?", id, types.InvitationPending, tokenHash, now).
+		Updates(map[string]interface{}{
+			"status":      types.InvitationAccepted,
+			"accepted_at": now,
+		})
+	if result.Error != nil {
+		r.logger.WithError(result.Error).Error("Failed to claim invitation")
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+func (r *InvitationRepo) SetLMSUser(id, lmsUserID uuid.UUID) error {
+	err := r.db.Model(&types.TenantInvitation{}).
+		Where("invitation_id = ?", id).
+		Update("lms_user_id", lmsUserID).Error
+	if err != nil {
+		r.logger.WithError(err).Error("Failed to link invitation to LMS user")
+		return err
+	}
+	return nil
+}
+
+func (r *InvitationRepo) ExpireInvitations(now time.Time) (int64, error) {
+	result := r.db.Model(&types.TenantInvitation{}).
+		Where("status = ? AND expires_at <= ?", types.InvitationPending, now).
+		Update("status", types.InvitationExpired)
+	if result.Error != nil {
+		r.logger.WithError(result.Error).Error("Failed to expire invitations")
+		return 0, result.Error
+	}
+	return result.RowsAffected, nil
+}
+
+func (r *InvitationRepo) DeleteNamespace(namespace string) error {
+	if err := r.db.Where("namespace = ?", namespace).Delete(&types.TenantInvitation{}).Error; err != nil {
+		r.logger.WithError(err).Error("Failed to delete tenant invitations")
+		return err
+	}
+	return nil
+}
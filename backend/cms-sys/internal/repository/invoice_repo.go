@@ -0,0 +1,140 @@
+package repository
+
+import (
+	"errors"
+	"github.com/google/uuid"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/types"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+var (
+	ErrInvoiceNotFound = errors.New("invoice not found")
+	errInvoiceExists   = errors.New("invoice already issued")
+)
+
+type InvoiceRepository interface {
+	CreateInvoice(invoice *types.Invoice) (bool, error)
+	GetInvoice(id uuid.UUID) (*types.Invoice, error)
+	ListInvoices(customerID *uuid.UUID) ([]types.Invoice, error)
+	CountSubscriptionInvoices(subscriptionID uuid.UUID) (int64, error)
+	SetFile(id uuid.UUID, path string) error
+	MarkEmailed(id uuid.UUID, at time.Time) error
+}
+
+type InvoiceRepo struct {
+	logger *logrus.Logger
+	db     *gorm.DB
+}
+
+var _ InvoiceRepository = (*InvoiceRepo)(nil)
+
+func NewInvoiceRepo(logger *logrus.Logger, db *gorm.DB) *InvoiceRepo {
+	return &InvoiceRepo{
+		logger: logger,
+		db:     db,
+	}
+}
+
+// CreateInvoice numbers and inserts the invoice with its lines in one
+// transaction. It reports false, using up no number, when the subscription
+// period has already been invoiced.
+func (r *InvoiceRepo) CreateInvoice(invoice *types.Invoice) (bool, error) {
+	if invoice.InvoiceID == uuid.Nil {
+		invoice.InvoiceID = uuid.New()
+	}
+	invoice.Year = invoice.IssuedAt.UTC().Year()
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var seq int
+		err := tx.Raw(`INSERT INTO cms_invoice_sequence (year, last_number) VALUES (?, 1)
+			ON CONFLICT (year) DO UPDATE SET last_number = cms_invoice_sequence.last_number + 1
+			RETURNING last_number`, invoice.Year).Scan(&seq).Error
+		if err != nil {
+			return err
+		}
+		invoice.Sequence = seq
+		invoice.Number = types.InvoiceNumber(invoice.Year, seq)
+
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Omit("Lines").Create(invoice)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errInvoiceExists
+		}
+		for i := range invoice.Lines {
+			invoice.Lines[i].InvoiceID = invoice.InvoiceID
+			if invoice.Lines[i].LineID == uuid.Nil {
+				invoice.Lines[i].LineID = uuid.New()
+			}
+		}
+		if len(invoice.Lines) > 0 {
+			return tx.Create(&invoice.Lines).Error
+		}
+		return nil
+	})
+	if errors.Is(err, errInvoiceExists) {
+		return false, nil
+	}
+	if err != nil {
+		r.logger.WithError(err).Error("Failed to create invoice")
+		return false, err
+	}
+	return true, nil
+}
+
+func (r *InvoiceRepo) GetInvoice(id uuid.UUID) (*types.Invoice, error) {
+	var invoice types.Invoice
+	err := r.db.Preload("Lines", func(db *gorm.DB) *gorm.DB {
+		return db.Order("position")
+	}).Where("invoice_id = ?", id).First(&invoice).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvoiceNotFound
+		}
+		r.logger.WithError(err).Error("Failed to get invoice")
+		return nil, err
+	}
+	return &invoice, nil
+}
+
+func (r *InvoiceRepo) ListInvoices(customerID *uuid.UUID) ([]types.Invoice, error) {
+	var invoices []types.Invoice
+	query := r.db.Order("year DESC, sequence DESC")
+	if customerID != nil {
+		query = query.Where("customer_id = ?", *customerID)
+	}
+	if err := query.Find(&invoices).Error; err != nil {
+		r.logger.WithError(err).Error("Failed to list invoices")
+		return nil, err
+	}
+	return invoices, nil
+}
+
+func (r *InvoiceRepo) CountSubscriptionInvoices(subscriptionID uuid.UUID) (int64, error) {
+	var n int64
+	if err := r.db.Model(&types.Invoice{}).Where("subscription_id = ?", subscriptionID).Count(&n).Error; err != nil {
+		r.logger.WithError(err).Error("Failed to count invoices")
+		return 0, err
+	}
+	return n, nil
+}
+
+func (r *InvoiceRepo) SetFile(id uuid.UUID, path string) error {
+	if err := r.db.Model(&types.Invoice{}).Where("invoice_id = ?", id).Update("file_path", path).Error; err != nil {
+		r.logger.WithError(err).Error("Failed to record invoice file")
+		return err
+	}
+	return nil
+}
+
+func (r *InvoiceRepo) MarkEmailed(id uuid.UUID, at time.Time) error {
+	if err := r.db.Model(&types.Invoice{}).Where("invoice_id = ?", id).Update("emailed_at", at).Error; err != nil {
+		r.logger.WithError(err).Error("Failed to mark invoice emailed")
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package repository
+
+import (
+	"errors"
+	"github.com/google/uuid"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/types"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"time"
+)
+
+var ErrJobNotFound = errors.New("job not found")
+
+type JobRepository interface {
+	CreateJob(job *types.Job) error
+	GetJobByID(id uuid.UUID) (*types.Job, error)
+	UpdateJob(job *types.Job) error
+	FailInterrupted(reason string) (int64, error)
+}
+
+type JobRepo struct {
+	logger *logrus.Logger
+	db     *gorm.DB
+}
+
+var _ JobRepository = (*JobRepo)(nil)
+
+func NewJobRepo(logger *logrus.Logger, db *gorm.DB) *JobRepo {
+	return &JobRepo{
+		logger: logger,
+		db:     db,
+	}
+}
+
+func (r *JobRepo) CreateJob(job *types.Job) error {
+	if err := r.db.Create(job).Error; err != nil {
+		r.logger.WithError(err).Error("Failed to create job")
+		return err
+	}
+	return nil
+}
+
+func (r *JobRepo) GetJobByID(id uuid.UUID) (*types.Job, error) {
+	var job types.Job
+	if err := r.db.Where("job_id = ?", id).First(&job).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrJobNotFound
+		}
+		r.logger.WithError(err).Error("Failed to get job by ID")
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (r *JobRepo) UpdateJob(job *types.Job) error {
+	if err := r.db.Save(job).Error; err != nil {
+		r.logger.WithError(err).Error("Failed to update job")
+		return err
+	}
+	return nil
+}
+
+// FailInterrupted marks jobs left pending or running by a previous process as
+// failed. Jobs run in-process, so nothing will pick them up again.
+func (r *JobRepo) FailInterrupted(reason string) (int64, error) {
+	result := r.db.Model(&types.Job{}).
+		Where("status IN ?", []types.JobStatus{types.JobPending, types.JobRunning}).
+		Updates(map[string]interface{}{
+			"status":      types.JobFailed,
+			"error":       reason,
+			"finished_at": time.Now(),
+			"updated_at":  time.Now(),
+		})
+	if result.Error != nil {
+		r.logger.WithError(result.Error).Error("Failed to fail interrupted jobs")
+		return 0, result.Error
+	}
+	return result.RowsAffected, nil
+}
@@ -0,0 +1,243 @@
+package repository
+
+import (
+	"errors"
+	"github.com/google/uuid"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/types"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+var (
+	ErrMemberNotFound   = errors.New("member not found")
+	ErrTransferNotFound = errors.New("transfer not found")
+)
+
+type MemberRepository interface {
+	GetMember(namespace string, userID uuid.UUID) (*types.TenantMember, error)
+	ListMembers(namespace string) ([]types.TenantMember, error)
+	SaveMember(member *types.TenantMember) error
+	DeleteMember(namespace string, userID uuid.UUID) error
+	DeleteNamespace(namespace string) error
+
+	CreateTransfer(transfer *types.OwnershipTransfer) (bool, error)
+	GetTransfer(id uuid.UUID) (*types.OwnershipTransfer, error)
+	ListTransfers(namespace string) ([]types.OwnershipTransfer, error)
+	ListIncoming(userID uuid.UUID) ([]types.OwnershipTransfer, error)
+	ResolveTransfer(transfer *types.OwnershipTransfer, from types.TransferStatus) (bool, error)
+	ExpireTransfers(now time.Time) (int64, error)
+
+	AttachPurchase(namespace string, ownerID uuid.UUID, system types.SystemType) (bool, error)
+	AttachToOwnedTenant(ownerID uuid.UUID, system types.SystemType) (bool, error)
+	MovePurchases(namespace string, to uuid.UUID) (int64, error)
+}
+
+type MemberRepo struct {
+	logger *logrus.Logger
+	db     *gorm.DB
+}
+
+var _ MemberRepository = (*MemberRepo)(nil)
+
+func NewMemberRepo(logger *logrus.Logger, db *gorm.DB) *MemberRepo {
+	return &MemberRepo{
+		logger: logger,
+		db:     db,
+	}
+}
+
+func (r *MemberRepo) GetMember(namespace string, userID uuid.UUID) (*types.TenantMember, error) {
+	var member types.TenantMember
+	err := r.db.Where("namespace = ? AND user_id = ?", namespace, userID).First(&member).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrMemberNotFound
+		}
+		r.logger.WithError(err).Error("Failed to get tenant member")
+		return nil, err
+	}
+	return &member, nil
+}
+
+func (r *MemberRepo) ListMembers(namespace string) ([]types.TenantMember, error) {
+	var members []types.TenantMember
+	if err := r.db.Where("namespace = ?", namespace).Order("created_at").Find(&members).Error; err != nil {
+		r.logger.WithError(err).Error("Failed to list tenant members")
+		return nil, err
+	}
+	return members, nil
+}
+
+func (r *MemberRepo) SaveMember(member *types.TenantMember) error {
+	member.UpdatedAt = time.Now()
+	err := r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "namespace"}, {Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"role", "updated_at"}),
+	}).Create(member).Error
+	if err != nil {
+		r.logger.WithError(err).Error("Failed to save tenant member")
+		return err
+	}
+	return nil
+}
+
+func (r *MemberRepo) DeleteMember(namespace string, userID uuid.UUID) error {
+	if err := r.db.Where("namespace = ? AND user_id = ?", namespace, userID).Delete(&types.TenantMember{}).Error; err != nil {
+		r.logger.WithError(err).Error("Failed to delete tenant member")
+		return err
+	}
+	return nil
+}
+
+func (r *MemberRepo) DeleteNamespace(namespace string) error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("namespace = ?", namespace).Delete(&types.TenantMember{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("namespace = ?", namespace).Delete(&types.OwnershipTransfer{}).Error
+	})
+	if err != nil {
+		r.logger.WithError(err).Error("Failed to delete tenant members")
+		return err
+	}
+	return nil
+}
+
+// CreateTransfer inserts a pending transfer unless the tenant already has
+// one; the partial unique index makes the check race-free.
+func (r *MemberRepo) CreateTransfer(transfer *types.OwnershipTransfer) (bool, error) {
+	if transfer.TransferID == uuid.Nil {
+		transfer.TransferID = uuid.New()
+	}
+	transfer.Status = types.TransferPending
+	result := r.db.Exec(`INSERT INTO cms_tenant_transfer
+		(transfer_id, namespace, from_user_id, to_user_id, status, keep_access, message, expires_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, NOW())
+		ON CONFLICT (namespace) WHERE status = 'PENDING' DO NOTHING`,
+		transfer.TransferID, transfer.Namespace, transfer.FromUserID, transfer.ToUserID, transfer.Status,
+		transfer.KeepAccess, transfer.Message, transfer.ExpiresAt)
+	if result.Error != nil {
+		r.logger.WithError(result.Error).Error("Failed to create ownership transfer")
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+func (r *MemberRepo) GetTransfer(id uuid.UUID) (*types.OwnershipTransfer, error) {
+	var transfer types.OwnershipTransfer
+	if err := r.db.Where("transfer_id = ?", id).First(&transfer).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrTransferNotFound
+		}
+		r.logger.WithError(err).Error("Failed to get ownership transfer")
+		return nil, err
+	}
+	return &transfer, nil
+}
+
+func (r *MemberRepo) ListTransfers(namespace string) ([]types.OwnershipTransfer, error) {
+	var transfers []types.OwnershipTransfer
+	if err := r.db.Where("namespace = ?", namespace).Order("created_at DESC").Find(&transfers).Error; err != nil {
+		r.logger.WithError(err).Error("Failed to list ownership transfers")
+		return nil, err
+	}
+	return transfers, nil
+}
+
+func (r *MemberRepo) ListIncoming(userID uuid.UUID) ([]types.OwnershipTransfer, error) {
+	var transfers []types.OwnershipTransfer
+	err := r.db.Where("to_user_id = ? AND status = ?", userID, types.TransferPending).
+		Order("created_at DESC").
+		Find(&transfers).Error
+	if err != nil {
+		r.logger.WithError(err).Error("Failed to list incoming transfers")
+		return nil, err
+	}
+	return transfers, nil
+}
+
+// ResolveTransfer moves a transfer out of status from. It reports false when
+// another request resolved it first.
+func (r *MemberRepo) ResolveTransfer(transfer *types.OwnershipTransfer, from types.TransferStatus) (bool, error) {
+	result := r.db.Model(&types.OwnershipTransfer{}).
+		Where("transfer_id = ? AND status = ?", transfer.TransferID, from).
+		Updates(map[string]interface{}{
+			"status":      transfer.Status,
+			"resolved_at": transfer.ResolvedAt,
+			"resolved_by": transfer.ResolvedBy,
+		})
+	if result.Error != nil {
+		r.logger.WithError(result.Error).Error("Failed to resolve ownership transfer")
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+func (r *MemberRepo) ExpireTransfers(now time.Time) (int64, error) {
+	result := r.db.Model(&types.OwnershipTransfer{}).
+		Where("status = ? AND expires_at < ?", types.TransferPending, now).
+		Updates(map[string]interface{}{"status": types.TransferExpired, "resolved_at": now})
+	if result.Error != nil {
+		r.logger.WithError(result.Error).Error("Failed to expire ownership transfers")
+		return 0, result.Error
+	}
+	return result.RowsAffected, nil
+}
+
+// AttachPurchase ties the owner's oldest unattached purchase of system to
+// the tenant, if there is one.
+func (r *MemberRepo) AttachPurchase(namespace string, ownerID uuid.UUID, system types.SystemType) (bool, error) {
+	result := r.db.Exec(`UPDATE cms_cus_purchase SET namespace = ?
+		WHERE relation_id = (
+			SELECT relation_id FROM cms_cus_purchase
+			WHERE cms_cus_id = ? AND system_name = ? AND namespace IS NULL AND canceled_at IS NULL
+			ORDER BY purchase_date
+			LIMIT 1
+		)`, namespace, ownerID, string(system))
+	if result.Error != nil {
+		r.logger.WithError(result.Error).Error("Failed to attach purchase to tenant")
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// AttachToOwnedTenant ties the owner's unattached purchase of system to the
+// oldest live tenant they own that has no purchase of it yet, if there is one.
+func (r *MemberRepo) AttachToOwnedTenant(ownerID uuid.UUID, system types.SystemType) (bool, error) {
+	result := r.db.Exec(`UPDATE cms_cus_purchase SET namespace = owned.namespace
+		FROM (
+			SELECT t.namespace FROM cms_tenant t
+			WHERE t.owner_id = ? AND t.status <> ?
+			AND NOT EXISTS (
+				SELECT 1 FROM cms_cus_purchase attached
+				WHERE attached.namespace = t.namespace AND attached.system_name = ?
+			)
+			ORDER BY t.created_at
+			LIMIT 1
+		) owned
+		WHERE cms_cus_purchase.cms_cus_id = ? AND cms_cus_purchase.system_name = ?
+		AND cms_cus_purchase.namespace IS NULL AND cms_cus_purchase.canceled_at IS NULL`,
+		ownerID, types.TenantPurged, string(system), ownerID, string(system))
+	if result.Error != nil {
+		r.logger.WithError(result.Error).Error("Failed to attach purchase to owned tenant")
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// MovePurchases hands the purchases attached to a tenant to its new owner. A
+// customer holds one purchase per system, so a purchase stays with the
+// previous owner when the new owner already has that system.
+func (r *MemberRepo) MovePurchases(namespace string, to uuid.UUID) (int64, error) {
+	result := r.db.Model(&types.CMSCusPurchase{}).
+		Where("namespace = ?", namespace).
+		Where("NOT EXISTS (SELECT 1 FROM cms_cus_purchase owned WHERE owned.cms_cus_id = ? AND owned.system_name = cms_cus_purchase.system_name)", to).
+		Update("cms_cus_id", to)
+	if result.Error != nil {
+		r.logger.WithError(result.Error).Error("Failed to move tenant purchases")
+		return 0, result.Error
+	}
+	return result.RowsAffected, nil
+}
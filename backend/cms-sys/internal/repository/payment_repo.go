@@ -0,0 +1,212 @@
+package repository
+
+import (
+	"errors"
+	"github.com/google/uuid"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/types"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+var (
+	ErrPaymentCustomerNotFound = errors.New("payment customer not found")
+	ErrCheckoutNotFound        = errors.New("checkout not found")
+	ErrPaymentNotFound         = errors.New("payment not found")
+)
+
+type PaymentRepository interface {
+	GetCustomer(customerID uuid.UUID, provider string) (*types.PaymentCustomer, error)
+	CreateCustomer(customer *types.PaymentCustomer) (bool, error)
+	CreateCheckout(checkout *types.Checkout) error
+	GetCheckoutByExternal(provider, externalID string) (*types.Checkout, error)
+	ListCheckouts(customerID uuid.UUID) ([]types.Checkout, error)
+	UpdateCheckout(checkout *types.Checkout, from types.CheckoutStatus) (bool, error)
+	CreatePayment(payment *types.Payment) (bool, error)
+	GetPayment(id uuid.UUID) (*types.Payment, error)
+	GetPaymentByExternal(provider, externalID string) (*types.Payment, error)
+	ListPayments(customerID *uuid.UUID) ([]types.Payment, error)
+	ApplyRefund(payment *types.Payment, refundedCents int64) (bool, error)
+	RecordEvent(event *types.PaymentEvent) (bool, error)
+}
+
+type PaymentRepo struct {
+	logger *logrus.Logger
+	db     *gorm.DB
+}
+
+var _ PaymentRepository = (*PaymentRepo)(nil)
+
+func NewPaymentRepo(logger *logrus.Logger, db *gorm.DB) *PaymentRepo {
+	return &PaymentRepo{
+		logger: logger,
+		db:     db,
+	}
+}
+
+func (r *PaymentRepo) GetCustomer(customerID uuid.UUID, provider string) (*types.PaymentCustomer, error) {
+	var customer types.PaymentCustomer
+	if err := r.db.Where("customer_id = ? AND provider = ?", customerID, provider).First(&customer).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrPaymentCustomerNotFound
+		}
+		r.logger.WithError(err).Error("Failed to get payment customer")
+		return nil, err
+	}
+	return &customer, nil
+}
+
+// CreateCustomer stores the link unless the customer already has one at the
+// provider, in which case it reports false.
+func (r *PaymentRepo) CreateCustomer(customer *types.PaymentCustomer) (bool, error) {
+	result := r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(customer)
+	if result.Error != nil {
+		r.logger.WithError(result.Error).Error("Failed to create payment customer")
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+func (r *PaymentRepo) CreateCheckout(checkout *types.Checkout) error {
+	if checkout.CheckoutID == uuid.Nil {
+		checkout.CheckoutID = uuid.New()
+	}
+	if err := r.db.Create(checkout).Error; err != nil {
+		r.logger.WithError(err).Error("Failed to create checkout")
+		return err
+	}
+	return nil
+}
+
+// GetCheckoutByExternal loads a checkout by the provider's session ID and
+// locks it for the rest of the transaction.
+func (r *PaymentRepo) GetCheckoutByExternal(provider, externalID string) (*types.Checkout, error) {
+	var checkout types.Checkout
+	err := r.db.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("provider = ? AND external_id = ?", provider, externalID).First(&checkout).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrCheckoutNotFound
+		}
+		r.logger.WithError(err).Error("Failed to get checkout")
+		return nil, err
+	}
+	return &checkout, nil
+}
+
+func (r *PaymentRepo) ListCheckouts(customerID uuid.UUID) ([]types.Checkout, error) {
+	var checkouts []types.Checkout
+	if err := r.db.Where("customer_id = ?", customerID).Order("created_at DESC").Find(&checkouts).Error; err != nil {
+		r.logger.WithError(err).Error("Failed to list checkouts")
+		return nil, err
+	}
+	return checkouts, nil
+}
+
+// UpdateCheckout saves the checkout if it still has status from.
+func (r *PaymentRepo) UpdateCheckout(checkout *types.Checkout, from types.CheckoutStatus) (bool, error) {
+	checkout.UpdatedAt = time.Now()
+	result := r.db.Model(&types.Checkout{}).
+		Where("checkout_id = ? AND status = ?", checkout.CheckoutID, from).
+		Updates(map[string]interface{}{
+			"status":          checkout.Status,
+			"payment_id":      checkout.PaymentID,
+			"subscription_id": checkout.SubscriptionID,
+			"completed_at":    checkout.CompletedAt,
+			"updated_at":      checkout.UpdatedAt,
+		})
+	if result.Error != nil {
+		r.logger.WithError(result.Error).Error("Failed to update checkout")
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// CreatePayment records a payment unless the provider's payment is already
+// on file, in which case it reports false.
+func (r *PaymentRepo) CreatePayment(payment *types.Payment) (bool, error) {
+	if payment.PaymentID == uuid.Nil {
+		payment.PaymentID = uuid.New()
+	}
+	result := r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(payment)
+	if result.Error != nil {
+		r.logger.WithError(result.Error).Error("Failed to create payment")
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+func (r *PaymentRepo) GetPayment(id uuid.UUID) (*types.Payment, error) {
+	return r.firstPayment(r.db.Where("payment_id = ?", id))
+}
+
+// GetPaymentByExternal loads a payment by the provider's ID and locks it for
+// the rest of the transaction.
+func (r *PaymentRepo) GetPaymentByExternal(provider, externalID string) (*types.Payment, error) {
+	return r.firstPayment(r.db.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("provider = ? AND external_id = ?", provider, externalID))
+}
+
+func (r *PaymentRepo) firstPayment(query *gorm.DB) (*types.Payment, error) {
+	var payment types.Payment
+	if err := query.First(&payment).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrPaymentNotFound
+		}
+		r.logger.WithError(err).Error("Failed to get payment")
+		return nil, err
+	}
+	return &payment, nil
+}
+
+func (r *PaymentRepo) ListPayments(customerID *uuid.UUID) ([]types.Payment, error) {
+	var payments []types.Payment
+	query := r.db.Order("created_at DESC")
+	if customerID != nil {
+		query = query.Where("customer_id = ?", *customerID)
+	}
+	if err := query.Find(&payments).Error; err != nil {
+		r.logger.WithError(err).Error("Failed to list payments")
+		return nil, err
+	}
+	return payments, nil
+}
+
+// ApplyRefund raises the refunded total of a payment. Totals only grow, so
+// an older refund event arriving late reports false and changes nothing.
+func (r *PaymentRepo) ApplyRefund(payment *types.Payment, refundedCents int64) (bool, error) {
+	status := types.PaymentPartiallyRefunded
+	if refundedCents >= payment.AmountCents {
+		status = types.PaymentRefunded
+	}
+	now := time.Now()
+	result := r.db.Model(&types.Payment{}).
+		Where("payment_id = ? AND refunded_cents < ?", payment.PaymentID, refundedCents).
+		Updates(map[string]interface{}{
+			"refunded_cents": refundedCents,
+			"status":         status,
+			"updated_at":     now,
+		})
+	if result.Error != nil {
+		r.logger.WithError(result.Error).Error("Failed to apply refund")
+		return false, result.Error
+	}
+	if result.RowsAffected == 1 {
+		payment.RefundedCents = refundedCents
+		payment.Status = status
+		payment.UpdatedAt = now
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// RecordEvent remembers a webhook event. It reports false when the event was
+// recorded before, which means it has already been processed.
+func (r *PaymentRepo) RecordEvent(event *types.PaymentEvent) (bool, error) {
+	result := r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(event)
+	if result.Error != nil {
+		r.logger.WithError(result.Error).Error("Failed to record payment event")
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
@@ -0,0 +1,146 @@
+package repository
+
+import (
+	"errors"
+	"github.com/google/uuid"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/types"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+var ErrPlanNotFound = errors.New("plan not found")
+
+type PlanRepository interface {
+	CreatePlan(plan *types.Plan) error
+	GetPlan(id uuid.UUID) (*types.Plan, error)
+	GetPlanByCode(code string) (*types.Plan, error)
+	ListPlans(activeOnly bool) ([]types.Plan, error)
+	ReplacePlan(plan *types.Plan) error
+	SetPlanActive(id uuid.UUID, active bool) (bool, error)
+}
+
+type PlanRepo struct {
+	logger *logrus.Logger
+	db     *gorm.DB
+}
+
+var _ PlanRepository = (*PlanRepo)(nil)
+
+func NewPlanRepo(logger *logrus.Logger, db *gorm.DB) *PlanRepo {
+	return &PlanRepo{
+		logger: logger,
+		db:     db,
+	}
+}
+
+// CreatePlan inserts the plan together with its systems and quotas.
+func (r *PlanRepo) CreatePlan(plan *types.Plan) error {
+	if plan.PlanID == uuid.Nil {
+		plan.PlanID = uuid.New()
+	}
+	if err := r.db.Create(plan).Error; err != nil {
+		r.logger.WithError(err).Error("Failed to create plan")
+		return err
+	}
+	return nil
+}
+
+func (r *PlanRepo) GetPlan(id uuid.UUID) (*types.Plan, error) {
+	return r.getPlan("plan_id = ?", id)
+}
+
+func (r *PlanRepo) GetPlanByCode(code string) (*types.Plan, error) {
+	return r.getPlan("code = ?", code)
+}
+
+func (r *PlanRepo) getPlan(query string, arg interface{}) (*types.Plan, error) {
+	var plan types.Plan
+	err := r.db.Preload("Systems").Preload("Quotas").Where(query, arg).First(&plan).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrPlanNotFound
+		}
+		r.logger.WithError(err).Error("Failed to get plan")
+		return nil, err
+	}
+	return &plan, nil
+}
+
+func (r *PlanRepo) ListPlans(activeOnly bool) ([]types.Plan, error) {
+	var plans []types.Plan
+	query := r.db.Preload("Systems").Preload("Quotas").Order("price_cents, code")
+	if activeOnly {
+		query = query.Where("active = ?", true)
+	}
+	if err := query.Find(&plans).Error; err != nil {
+		r.logger.WithError(err).Error("Failed to list plans")
+		return nil, err
+	}
+	return plans, nil
+}
+
+// ReplacePlan overwrites the plan's fields and swaps its systems and quotas
+// for the ones given, in one transaction.
+func (r *PlanRepo) ReplacePlan(plan *types.Plan) error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&types.Plan{}).Where("plan_id = ?", plan.PlanID).Updates(map[string]interface{}{
+			"code":        plan.Code,
+			"name":        plan.Name,
+			"description": plan.Description,
+			"price_cents": plan.PriceCents,
+			"currency":    plan.Currency,
+			"interval":    plan.Interval,
+			"trial_days":  plan.TrialDays,
+			"grace_days":  plan.GraceDays,
+			"updated_at":  plan.UpdatedAt,
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrPlanNotFound
+		}
+
+		if err := tx.Where("plan_id = ?", plan.PlanID).Delete(&types.PlanSystem{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("plan_id = ?", plan.PlanID).Delete(&types.PlanQuota{}).Error; err != nil {
+			return err
+		}
+		for i := range plan.Systems {
+			plan.Systems[i].PlanID = plan.PlanID
+		}
+		for i := range plan.Quotas {
+			plan.Quotas[i].PlanID = plan.PlanID
+		}
+		if len(plan.Systems) > 0 {
+			if err := tx.Create(&plan.Systems).Error; err != nil {
+				return err
+			}
+		}
+		if len(plan.Quotas) > 0 {
+			if err := tx.Create(&plan.Quotas).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, ErrPlanNotFound) {
+		r.logger.WithError(err).Error("Failed to replace plan")
+	}
+	return err
+}
+
+// SetPlanActive opens or closes the plan to new subscriptions. It reports
+// false when the plan does not exist.
+func (r *PlanRepo) SetPlanActive(id uuid.UUID, active bool) (bool, error) {
+	result := r.db.Model(&types.Plan{}).Where("plan_id = ?", id).Updates(map[string]interface{}{
+		"active":     active,
+		"updated_at": gorm.Expr("NOW()"),
+	})
+	if result.Error != nil {
+		r.logger.WithError(result.Error).Error("Failed to update plan status")
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
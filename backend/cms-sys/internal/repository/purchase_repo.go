@@ -0,0 +1,109 @@
+package repository
+
+import (
+	"errors"
+	"github.com/google/uuid"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/types"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"time"
+)
+
+var ErrPurchaseNotFound = errors.New("purchase not found")
+
+type PurchaseRepository interface {
+	GetPurchase(customerID uuid.UUID, system types.SystemType) (*types.CMSCusPurchase, error)
+	ListPurchases(customerID uuid.UUID) ([]types.CMSCusPurchase, error)
+	ActivatePurchase(purchase *types.CMSCusPurchase) (bool, error)
+	CancelPurchase(customerID uuid.UUID, system types.SystemType, actorID *uuid.UUID, at time.Time) (bool, error)
+	CancelSubscribed(sub *types.Subscription, system types.SystemType, at time.Time) (bool, error)
+}
+
+type PurchaseRepo struct {
+	logger *logrus.Logger
+	db     *gorm.DB
+}
+
+var _ PurchaseRepository = (*PurchaseRepo)(nil)
+
+func NewPurchaseRepo(logger *logrus.Logger, db *gorm.DB) *PurchaseRepo {
+	return &PurchaseRepo{
+		logger: logger,
+		db:     db,
+	}
+}
+
+func (r *PurchaseRepo) GetPurchase(customerID uuid.UUID, system types.SystemType) (*types.CMSCusPurchase, error) {
+	var purchase types.CMSCusPurchase
+	err := r.db.Where("cms_cus_id = ? AND system_name = ?", customerID, string(system)).First(&purchase).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrPurchaseNotFound
+		}
+		r.logger.WithError(err).Error("Failed to get purchase")
+		return nil, err
+	}
+	return &purchase, nil
+}
+
+func (r *PurchaseRepo) ListPurchases(customerID uuid.UUID) ([]types.CMSCusPurchase, error) {
+	var purchases []types.CMSCusPurchase
+	if err := r.db.Where("cms_cus_id = ?", customerID).Order("purchase_date").Find(&purchases).Error; err != nil {
+		r.logger.WithError(err).Error("Failed to list purchases")
+		return nil, err
+	}
+	return purchases, nil
+}
+
+// ActivatePurchase inserts the purchase or reactivates a cancelled one. It
+// reports false, changing nothing, when the customer already holds an active
+// purchase of the system.
+func (r *PurchaseRepo) ActivatePurchase(purchase *types.CMSCusPurchase) (bool, error) {
+	if purchase.RelationID == uuid.Nil {
+		purchase.RelationID = uuid.New()
+	}
+	result := r.db.Exec(`INSERT INTO cms_cus_purchase (relation_id, cms_cus_id, system_name, purchase_date, granted_by, subscription_id, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, NOW())
+		ON CONFLICT (cms_cus_id, system_name) DO UPDATE
+		SET purchase_date = EXCLUDED.purchase_date, granted_by = EXCLUDED.granted_by, subscription_id = EXCLUDED.subscription_id,
+			canceled_at = NULL, canceled_by = NULL
+		WHERE cms_cus_purchase.canceled_at IS NOT NULL`,
+		purchase.RelationID, purchase.CMSCusID, purchase.SystemName, purchase.PurchaseDate, purchase.GrantedBy, purchase.SubscriptionID)
+	if result.Error != nil {
+		r.logger.WithError(result.Error).Error("Failed to activate purchase")
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// CancelPurchase marks an active purchase cancelled. It reports false when
+// there is no active purchase of the system.
+func (r *PurchaseRepo) CancelPurchase(customerID uuid.UUID, system types.SystemType, actorID *uuid.UUID, at time.Time) (bool, error) {
+	result := r.db.Model(&types.CMSCusPurchase{}).
+		Where("cms_cus_id = ? AND system_name = ? AND canceled_at IS NULL", customerID, string(system)).
+		Updates(map[string]interface{}{
+			"canceled_at": at,
+			"canceled_by": actorID,
+		})
+	if result.Error != nil {
+		r.logger.WithError(result.Error).Error("Failed to cancel purchase")
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// CancelSubscribed cancels an active purchase that came with a subscription,
+// including one that moved to another customer with a tenant. Purchases
+// granted by an admin are left alone; purchases recorded before subscriptions
+// were tracked are matched by customer.
+func (r *PurchaseRepo) CancelSubscribed(sub *types.Subscription, system types.SystemType, at time.Time) (bool, error) {
+	result := r.db.Model(&types.CMSCusPurchase{}).
+		Where("system_name = ? AND canceled_at IS NULL AND granted_by IS NULL", string(system)).
+		Where("subscription_id = ? OR (subscription_id IS NULL AND cms_cus_id = ?)", sub.SubscriptionID, sub.CustomerID).
+		Update("canceled_at", at)
+	if result.Error != nil {
+		r.logger.WithError(result.Error).Error("Failed to cancel subscribed purchase")
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
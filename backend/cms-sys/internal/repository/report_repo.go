@@ -0,0 +1,180 @@
+package repository
+
+import (
+	"context"
+	"maps"
+	"slices"
+
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/types"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// DefaultCustomerPurchaseSort orders the customer purchase report when no sort
+// is given.
+const DefaultCustomerPurchaseSort = "purchase_date"
+
+// customerPurchaseColumns maps the sorts of the customer purchase report to
+// columns. Only these ever reach ORDER BY.
+var customerPurchaseColumns = map[string]string{
+	"purchase_date":  "cp.purchase_date",
+	"customer_name":  "cu.cms_user_name",
+	"customer_email": "cu.cms_user_email",
+	"system":         "cp.system_name",
+	"signed_up":      "cu.created_at",
+}
+
+// CustomerPurchaseSorts lists the sorts the customer purchase report accepts.
+func CustomerPurchaseSorts() []string {
+	return slices.Sorted(maps.Keys(customerPurchaseColumns))
+}
+
+type ReportRepository interface {
+	CustomerPurchases(filter *types.ReportFilter) ([]types.CustomerPurchaseRow, int64, error)
+	CountCustomerPurchases(filter *types.ReportFilter) (int64, error)
+	EachCustomerPurchase(ctx context.Context, filter *types.ReportFilter, fn func(row *types.CustomerPurchaseRow) error) error
+	SystemUsage(filter *types.ReportFilter) ([]types.SystemUsageRow, error)
+}
+
+type ReportRepo struct {
+	logger *logrus.Logger
+	db     *gorm.DB
+}
+
+var _ ReportRepository = (*ReportRepo)(nil)
+
+func NewReportRepo(logger *logrus.Logger, db *gorm.DB) *ReportRepo {
+	return &ReportRepo{
+		logger: logger,
+		db:     db,
+	}
+}
+
+// CustomerPurchases pages through the purchases of customers matching the
+// filter and counts them all.
+func (r *ReportRepo) CustomerPurchases(filter *types.ReportFilter) ([]types.CustomerPurchaseRow, int64, error) {
+	total, err := r.CountCustomerPurchases(filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var rows []types.CustomerPurchaseRow
+	err = r.customerPurchases(filter).
+		Limit(filter.Limit).
+		Offset(filter.Offset).
+		Scan(&rows).Error
+	if err != nil {
+		r.logger.WithError(err).Error("Failed to list customer purchases")
+		return nil, 0, err
+	}
+	return rows, total, nil
+}
+
+func (r *ReportRepo) CountCustomerPurchases(filter *types.ReportFilter) (int64, error) {
+	var total int64
+	if err := r.purchases(filter).Count(&total).Error; err != nil {
+		r.logger.WithError(err).Error("Failed to count customer purchases")
+		return 0, err
+	}
+	return total, nil
+}
+
+// EachCustomerPurchase hands every matching purchase to fn in report order,
+// reading rows as the database sends them instead of loading the report.
+// Limit and Offset are ignored. An error from fn stops the scan and is
+// returned.
+func (r *ReportRepo) EachCustomerPurchase(ctx context.Context, filter *types.ReportFilter, fn func(row *types.CustomerPurchaseRow) error) error {
+	rows, err := r.customerPurchases(filter).WithContext(ctx).Rows()
+	if err != nil {
+		r.logger.WithError(err).Error("Failed to read customer purchases")
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var row types.CustomerPurchaseRow
+		if err := r.db.ScanRows(rows, &row); err != nil {
+			r.logger.WithError(err).Error("Failed to scan customer purchase")
+			return err
+		}
+		if err := fn(&row); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		r.logger.WithError(err).Error("Failed to read customer purchases")
+		return err
+	}
+	return nil
+}
+
+// SystemUsage counts the customers and purchases of each system bought by
+// customers matching the filter. Sort, Limit and Offset are ignored.
+func (r *ReportRepo) SystemUsage(filter *types.ReportFilter) ([]types.SystemUsageRow, error) {
+	var rows []types.SystemUsageRow
+	err := r.purchases(filter).
+		Select(`cp.system_name,
+			COUNT(DISTINCT cp.cms_cus_id) AS customers,
+			COUNT(*) FILTER (WHERE cp.canceled_at IS NULL) AS active,
+			COUNT(*) FILTER (WHERE cp.canceled_at IS NOT NULL) AS canceled,
+			COUNT(*) FILTER (WHERE cp.granted_by IS NOT NULL) AS granted,
+			MIN(cp.purchase_date) AS first_purchase,
+			MAX(cp.purchase_date) AS last_purchase`).
+		Group("cp.system_name").
+		Order("cp.system_name").
+		Scan(&rows).Error
+	if err != nil {
+		r.logger.WithError(err).Error("Failed to report system usage")
+		return nil, err
+	}
+	return rows, nil
+}
+
+// customerPurchases selects the rows of the customer purchase report in
+// order. Sorts missing from the whitelist fall back to the purchase date.
+func (r *ReportRepo) customerPurchases(filter *types.ReportFilter) *gorm.DB {
+	column, ok := customerPurchaseColumns[filter.Sort]
+	if !ok {
+		column = customerPurchaseColumns[DefaultCustomerPurchaseSort]
+	}
+	direction := " ASC"
+	if filter.Desc {
+		direction = " DESC"
+	}
+	return r.purchases(filter).
+		Select(`cu.cms_user_id AS customer_id, cu.cms_user_name, cu.cms_user_email, cu.cms_name_space AS namespace,
+			cu.verified, cu.created_at AS signed_up_at, cp.system_name, cp.purchase_date,
+			cp.granted_by IS NOT NULL AS granted, cp.canceled_at`).
+		Order(column + direction).
+		Order("cp.relation_id")
+}
+
+// purchases joins customers to their purchases and applies the filter.
+func (r *ReportRepo) purchases(filter *types.ReportFilter) *gorm.DB {
+	query := r.db.Table("cms_user cu").
+		Joins("JOIN cms_cus_purchase cp ON cp.cms_cus_id = cu.cms_user_id").
+		Where("cu.cms_user_role = ?", string(types.CMSCustomer))
+	if filter.System != "" {
+		query = query.Where("cp.system_name = ?", string(filter.System))
+	}
+	if filter.Namespace != "" {
+		query = query.Where("cu.cms_name_space = ?", filter.Namespace)
+	}
+	if !filter.From.IsZero() {
+		query = query.Where("cp.purchase_date >= ?", filter.From)
+	}
+	if !filter.To.IsZero() {
+		query = query.Where("cp.purchase_date < ?", filter.To)
+	}
+	if filter.Verified != nil {
+		query = query.Where("cu.verified = ?", *filter.Verified)
+	}
+	if filter.Active != nil {
+		if *filter.Active {
+			query = query.Where("cp.canceled_at IS NULL")
+		} else {
+			query = query.Where("cp.canceled_at IS NOT NULL")
+		}
+	}
+	return query
+}
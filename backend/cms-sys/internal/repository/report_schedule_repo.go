@@ -0,0 +1,286 @@
+package repository
+
+import (
+	"errors"
+	"github.com/google/uuid"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/types"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+var (
+	ErrReportScheduleNotFound = errors.New("report schedule not found")
+	ErrReportSnapshotNotFound = errors.New("report snapshot not found")
+	ErrReportLeaseLost        = errors.New("report schedule lease lost")
+)
+
+type ReportScheduleRepository interface {
+	CreateSchedule(schedule *types.ReportSchedule) error
+	GetSchedule(id uuid.UUID) (*types.ReportSchedule, error)
+	ListSchedules() ([]types.ReportSchedule, error)
+	UpdateSchedule(schedule *types.ReportSchedule) error
+	DeleteSchedule(id uuid.UUID) (bool, error)
+
+	ClaimDue(now time.Time, owner string, lease time.Duration, limit int) ([]types.ReportSchedule, error)
+	Claim(id uuid.UUID, now time.Time, owner string, lease time.Duration) (*types.ReportSchedule, error)
+	Release(id uuid.UUID, owner string, nextRunAt *time.Time, lastError string) error
+	SaveSnapshot(snapshot *types.ReportSnapshot, owner string, nextRunAt *time.Time, keep int) error
+
+	LatestSnapshot(scheduleID uuid.UUID) (*types.ReportSnapshot, error)
+	GetSnapshot(scheduleID uuid.UUID, version int) (*types.ReportSnapshot, error)
+	ListSnapshots(scheduleID uuid.UUID, page, limit int) ([]types.ReportSnapshot, int64, error)
+	SetTenantReport(snapshotID, reportID uuid.UUID) error
+	SetDeliveryError(snapshotID uuid.UUID, message string) error
+}
+
+type ReportScheduleRepo struct {
+	logger *logrus.Logger
+	db     *gorm.DB
+}
+
+var _ ReportScheduleRepository = (*ReportScheduleRepo)(nil)
+
+func NewReportScheduleRepo(logger *logrus.Logger, db *gorm.DB) *ReportScheduleRepo {
+	return &ReportScheduleRepo{
+		logger: logger,
+		db:     db,
+	}
+}
+
+func (r *ReportScheduleRepo) CreateSchedule(schedule *types.ReportSchedule) error {
+	if err := r.db.Create(schedule).Error; err != nil {
+		r.logger.WithError(err).Error("Failed to create report schedule")
+		return err
+	}
+	return nil
+}
+
+func (r *ReportScheduleRepo) GetSchedule(id uuid.UUID) (*types.ReportSchedule, error) {
+	var schedule types.ReportSchedule
+	if err := r.db.Where("schedule_id = ?", id).First(&schedule).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrReportScheduleNotFound
+		}
+		r.logger.WithError(err).Error("Failed to get report schedule")
+		return nil, err
+	}
+	return &schedule, nil
+}
+
+func (r *ReportScheduleRepo) ListSchedules() ([]types.ReportSchedule, error) {
+	var schedules []types.ReportSchedule
+	if err := r.db.Order("name, created_at").Find(&schedules).Error; err != nil {
+		r.logger.WithError(err).Error("Failed to list report schedules")
+		return nil, err
+	}
+	return schedules, nil
+}
+
+// UpdateSchedule overwrites the definition of a schedule and its next run. The
+// run history and lease are left alone.
+func (r *ReportScheduleRepo) UpdateSchedule(schedule *types.ReportSchedule) error {
+	result := r.db.Model(&types.ReportSchedule{}).Where("schedule_id = ?", schedule.ScheduleID).
+		Select("name", "report", "filter", "namespace", "format", "cron", "timezone", "recipients", "webhook_url", "enabled", "next_run_at", "updated_at").
+		Updates(schedule)
+	if result.Error != nil {
+		r.logger.WithError(result.Error).Error("Failed to update report schedule")
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrReportScheduleNotFound
+	}
+	return nil
+}
+
+// DeleteSchedule removes a schedule with its snapshots. It reports false when
+// the schedule does not exist.
+func (r *ReportScheduleRepo) DeleteSchedule(id uuid.UUID) (bool, error) {
+	result := r.db.Where("schedule_id = ?", id).Delete(&types.ReportSchedule{})
+	if result.Error != nil {
+		r.logger.WithError(result.Error).Error("Failed to delete report schedule")
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// ClaimDue leases up to limit enabled schedules whose next run has come to
+// owner. Rows another instance is claiming are skipped rather than waited
+// for, and a schedule stays claimed until it is released or the lease runs
+// out, so each run happens on one instance only.
+func (r *ReportScheduleRepo) ClaimDue(now time.Time, owner string, lease time.Duration, limit int) ([]types.ReportSchedule, error) {
+	due := r.db.Model(&types.ReportSchedule{}).
+		Select("schedule_id").
+		Where("enabled AND next_run_at <= ?", now).
+		Where("locked_until IS NULL OR locked_until < ?", now).
+		Order("next_run_at").
+		Limit(limit).
+		Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"})
+
+	var schedules []types.ReportSchedule
+	err := r.db.Model(&schedules).
+		Clauses(clause.Returning{}).
+		Where("schedule_id IN (?)", due).
+		Updates(map[string]interface{}{
+			"locked_by":    owner,
+			"locked_until": now.Add(lease),
+		}).Error
+	if err != nil {
+		r.logger.WithError(err).Error("Failed to claim due report schedules")
+		return nil, err
+	}
+	return schedules, nil
+}
+
+// Claim leases one schedule to owner, due or not. It returns nil when another
+// instance holds the schedule.
+func (r *ReportScheduleRepo) Claim(id uuid.UUID, now time.Time, owner string, lease time.Duration) (*types.ReportSchedule, error) {
+	var schedules []types.ReportSchedule
+	result := r.db.Model(&schedules).
+		Clauses(clause.Returning{}).
+		Where("schedule_id = ?", id).
+		Where("locked_until IS NULL OR locked_until < ?", now).
+		Updates(map[string]interface{}{
+			"locked_by":    owner,
+			"locked_until": now.Add(lease),
+		})
+	if result.Error != nil {
+		r.logger.WithError(result.Error).Error("Failed to claim report schedule")
+		return nil, result.Error
+	}
+	if len(schedules) == 0 {
+		return nil, nil
+	}
+	return &schedules[0], nil
+}
+
+// Release gives up owner's lease after a failed run, recording the error and
+// when to try again.
+func (r *ReportScheduleRepo) Release(id uuid.UUID, owner string, nextRunAt *time.Time, lastError string) error {
+	err := r.db.Model(&types.ReportSchedule{}).
+		Where("schedule_id = ? AND locked_by = ?", id, owner).
+		Updates(map[string]interface{}{
+			"locked_by":    "",
+			"locked_until": nil,
+			"next_run_at":  nextRunAt,
+			"last_error":   lastError,
+		}).Error
+	if err != nil {
+		r.logger.WithError(err).Error("Failed to release report schedule")
+		return err
+	}
+	return nil
+}
+
+// SaveSnapshot stores the next version of a schedule's snapshot and releases
+// owner's lease in one transaction, then drops all but the newest keep
+// snapshots when keep is positive. It returns ErrReportLeaseLost when the
+// lease has passed to another instance.
+func (r *ReportScheduleRepo) SaveSnapshot(snapshot *types.ReportSnapshot, owner string, nextRunAt *time.Time, keep int) error {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var schedule types.ReportSchedule
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("schedule_id = ?", snapshot.ScheduleID).
+			First(&schedule).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrReportScheduleNotFound
+			}
+			return err
+		}
+		if schedule.LockedBy != owner {
+			return ErrReportLeaseLost
+		}
+
+		snapshot.Version = schedule.LastVersion + 1
+		if err := tx.Create(snapshot).Error; err != nil {
+			return err
+		}
+		err = tx.Model(&types.ReportSchedule{}).Where("schedule_id = ?", schedule.ScheduleID).Updates(map[string]interface{}{
+			"last_version": snapshot.Version,
+			"last_run_at":  snapshot.GeneratedAt,
+			"next_run_at":  nextRunAt,
+			"last_error":   "",
+			"locked_by":    "",
+			"locked_until": nil,
+		}).Error
+		if err != nil {
+			return err
+		}
+
+		if keep > 0 {
+			return tx.Where("schedule_id = ? AND version <= ?", schedule.ScheduleID, snapshot.Version-keep).
+				Delete(&types.ReportSnapshot{}).Error
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, ErrReportLeaseLost) && !errors.Is(err, ErrReportScheduleNotFound) {
+		r.logger.WithError(err).Error("Failed to save report snapshot")
+	}
+	return err
+}
+
+func (r *ReportScheduleRepo) LatestSnapshot(scheduleID uuid.UUID) (*types.ReportSnapshot, error) {
+	return r.snapshot(r.db.Where("schedule_id = ?", scheduleID).Order("version DESC"))
+}
+
+func (r *ReportScheduleRepo) GetSnapshot(scheduleID uuid.UUID, version int) (*types.ReportSnapshot, error) {
+	return r.snapshot(r.db.Where("schedule_id = ? AND version = ?", scheduleID, version))
+}
+
+func (r *ReportScheduleRepo) snapshot(query *gorm.DB) (*types.ReportSnapshot, error) {
+	var snapshot types.ReportSnapshot
+	if err := query.First(&snapshot).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrReportSnapshotNotFound
+		}
+		r.logger.WithError(err).Error("Failed to get report snapshot")
+		return nil, err
+	}
+	return &snapshot, nil
+}
+
+// ListSnapshots pages through a schedule's snapshots, newest first, without
+// their data.
+func (r *ReportScheduleRepo) ListSnapshots(scheduleID uuid.UUID, page, limit int) ([]types.ReportSnapshot, int64, error) {
+	var snapshots []types.ReportSnapshot
+	var total int64
+
+	query := r.db.Model(&types.ReportSnapshot{}).Where("schedule_id = ?", scheduleID)
+	if err := query.Count(&total).Error; err != nil {
+		r.logger.WithError(err).Error("Failed to count report snapshots")
+		return nil, 0, err
+	}
+	err := query.Omit("data", "diff").
+		Order("version DESC").
+		Offset((page - 1) * limit).
+		Limit(limit).
+		Find(&snapshots).Error
+	if err != nil {
+		r.logger.WithError(err).Error("Failed to list report snapshots")
+		return nil, 0, err
+	}
+	return snapshots, total, nil
+}
+
+func (r *ReportScheduleRepo) SetDeliveryError(snapshotID uuid.UUID, message string) error {
+	err := r.db.Model(&types.ReportSnapshot{}).Where("snapshot_id = ?", snapshotID).
+		Update("delivery_error", message).Error
+	if err != nil {
+		r.logger.WithError(err).Error("Failed to record report delivery error")
+		return err
+	}
+	return nil
+}
+
+// SetTenantReport records the tenant Report row a snapshot was written to.
+func (r *ReportScheduleRepo) SetTenantReport(snapshotID, reportID uuid.UUID) error {
+	err := r.db.Model(&types.ReportSnapshot{}).Where("snapshot_id = ?", snapshotID).
+		Update("tenant_report_id", reportID).Error
+	if err != nil {
+		r.logger.WithError(err).Error("Failed to link report snapshot to tenant report")
+		return err
+	}
+	return nil
+}
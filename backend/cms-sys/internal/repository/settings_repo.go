@@ -0,0 +1,106 @@
+package repository
+
+import (
+	"github.com/google/uuid"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/types"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+type SettingsRepository interface {
+	ListGlobal() ([]types.GlobalSetting, error)
+	SetGlobal(key, value string, actorID *uuid.UUID) error
+	DeleteGlobal(key string) error
+	// The tenant methods run on a handle scoped to the tenant, see
+	// isolation.Selector.WithTenant, so they work in every isolation mode.
+	ListTenant(tx *gorm.DB) ([]types.TenantSetting, error)
+	SetTenant(tx *gorm.DB, key, value string, actorID *uuid.UUID) error
+	DeleteTenant(tx *gorm.DB, key string) error
+}
+
+type SettingsRepo struct {
+	logger *logrus.Logger
+	db     *gorm.DB
+}
+
+var _ SettingsRepository = (*SettingsRepo)(nil)
+
+func NewSettingsRepo(logger *logrus.Logger, db *gorm.DB) *SettingsRepo {
+	return &SettingsRepo{
+		logger: logger,
+		db:     db,
+	}
+}
+
+func (r *SettingsRepo) ListGlobal() ([]types.GlobalSetting, error) {
+	var settings []types.GlobalSetting
+	if err := r.db.Order("setting_key").Find(&settings).Error; err != nil {
+		r.logger.WithError(err).Error("Failed to list global settings")
+		return nil, err
+	}
+	return settings, nil
+}
+
+func (r *SettingsRepo) SetGlobal(key, value string, actorID *uuid.UUID) error {
+	setting := &types.GlobalSetting{
+		Key:       key,
+		Value:     value,
+		UpdatedBy: actorID,
+		UpdatedAt: time.Now(),
+	}
+	err := r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "setting_key"}},
+		DoUpdates: clause.AssignmentColumns([]string{"value", "updated_by", "updated_at"}),
+	}).Create(setting).Error
+	if err != nil {
+		r.logger.WithError(err).Error("Failed to set global setting")
+		return err
+	}
+	return nil
+}
+
+func (r *SettingsRepo) DeleteGlobal(key string) error {
+	if err := r.db.Where("setting_key = ?", key).Delete(&types.GlobalSetting{}).Error; err != nil {
+		r.logger.WithError(err).Error("Failed to delete global setting")
+		return err
+	}
+	return nil
+}
+
+func (r *SettingsRepo) ListTenant(tx *gorm.DB) ([]types.TenantSetting, error) {
+	var settings []types.TenantSetting
+	err := tx.Table("tenant_setting").
+		Select("setting_key, value::text AS value, updated_by, updated_at").
+		Order("setting_key").
+		Scan(&settings).Error
+	if err != nil {
+		r.logger.WithError(err).Error("Failed to list tenant settings")
+		return nil, err
+	}
+	return settings, nil
+}
+
+// SetTenant names the primary key constraint because its columns differ
+// between dedicated schemas and the shared schema.
+func (r *SettingsRepo) SetTenant(tx *gorm.DB, key, value string, actorID *uuid.UUID) error {
+	err := tx.Exec(`INSERT INTO tenant_setting (setting_key, value, updated_by, updated_at)
+		VALUES (?, ?::jsonb, ?, NOW())
+		ON CONFLICT ON CONSTRAINT tenant_setting_pkey DO UPDATE
+		SET value = EXCLUDED.value, updated_by = EXCLUDED.updated_by, updated_at = EXCLUDED.updated_at`,
+		key, value, actorID).Error
+	if err != nil {
+		r.logger.WithError(err).Error("Failed to set tenant setting")
+		return err
+	}
+	return nil
+}
+
+func (r *SettingsRepo) DeleteTenant(tx *gorm.DB, key string) error {
+	if err := tx.Exec("DELETE FROM tenant_setting WHERE setting_key = ?", key).Error; err != nil {
+		r.logger.WithError(err).Error("Failed to delete tenant setting")
+		return err
+	}
+	return nil
+}
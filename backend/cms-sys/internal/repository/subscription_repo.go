@@ -0,0 +1,150 @@
+package repository
+
+import (
+	"errors"
+	"github.com/google/uuid"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/types"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"time"
+)
+
+var ErrSubscriptionNotFound = errors.New("subscription not found")
+
+var liveSubscriptionStatuses = []types.SubscriptionStatus{
+	types.SubscriptionTrialing,
+	types.SubscriptionActive,
+	types.SubscriptionPastDue,
+}
+
+type SubscriptionRepository interface {
+	CreateSubscription(sub *types.Subscription) (bool, error)
+	GetSubscription(id uuid.UUID) (*types.Subscription, error)
+	GetLiveSubscription(customerID uuid.UUID) (*types.Subscription, error)
+	HasSubscribed(customerID uuid.UUID) (bool, error)
+	ListSubscriptions(customerID *uuid.UUID, status types.SubscriptionStatus) ([]types.Subscription, error)
+	ListDue(now time.Time) ([]types.Subscription, error)
+	UpdateSubscription(sub *types.Subscription, from types.SubscriptionStatus) (bool, error)
+}
+
+type SubscriptionRepo struct {
+	logger *logrus.Logger
+	db     *gorm.DB
+}
+
+var _ SubscriptionRepository = (*SubscriptionRepo)(nil)
+
+func NewSubscriptionRepo(logger *logrus.Logger, db *gorm.DB) *SubscriptionRepo {
+	return &SubscriptionRepo{
+		logger: logger,
+		db:     db,
+	}
+}
+
+// CreateSubscription inserts the subscription. It reports false, inserting
+// nothing, when the customer already has a live subscription.
+func (r *SubscriptionRepo) CreateSubscription(sub *types.Subscription) (bool, error) {
+	if sub.SubscriptionID == uuid.Nil {
+		sub.SubscriptionID = uuid.New()
+	}
+	result := r.db.Exec(`INSERT INTO cms_subscription
+		(subscription_id, customer_id, plan_id, status, current_period_start, current_period_end, trial_ends_at, cancel_at_period_end, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, false, NOW(), NOW())
+		ON CONFLICT (customer_id) WHERE status <> 'CANCELED' AND status <> 'EXPIRED' DO NOTHING`,
+		sub.SubscriptionID, sub.CustomerID, sub.PlanID, sub.Status, sub.CurrentPeriodStart, sub.CurrentPeriodEnd, sub.TrialEndsAt)
+	if result.Error != nil {
+		r.logger.WithError(result.Error).Error("Failed to create subscription")
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+func (r *SubscriptionRepo) GetSubscription(id uuid.UUID) (*types.Subscription, error) {
+	return r.first(r.db.Where("subscription_id = ?", id))
+}
+
+func (r *SubscriptionRepo) GetLiveSubscription(customerID uuid.UUID) (*types.Subscription, error) {
+	return r.first(r.db.Where("customer_id = ? AND status IN ?", customerID, liveSubscriptionStatuses))
+}
+
+func (r *SubscriptionRepo) first(query *gorm.DB) (*types.Subscription, error) {
+	var sub types.Subscription
+	err := query.Preload("Plan.Systems").Preload("Plan.Quotas").First(&sub).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrSubscriptionNotFound
+		}
+		r.logger.WithError(err).Error("Failed to get subscription")
+		return nil, err
+	}
+	return &sub, nil
+}
+
+// HasSubscribed reports whether the customer ever had a subscription, which
+// rules out a second free trial.
+func (r *SubscriptionRepo) HasSubscribed(customerID uuid.UUID) (bool, error) {
+	var n int64
+	if err := r.db.Model(&types.Subscription{}).Where("customer_id = ?", customerID).Count(&n).Error; err != nil {
+		r.logger.WithError(err).Error("Failed to count subscriptions")
+		return false, err
+	}
+	return n > 0, nil
+}
+
+func (r *SubscriptionRepo) ListSubscriptions(customerID *uuid.UUID, status types.SubscriptionStatus) ([]types.Subscription, error) {
+	var subs []types.Subscription
+	query := r.db.Preload("Plan").Order("created_at DESC")
+	if customerID != nil {
+		query = query.Where("customer_id = ?", *customerID)
+	}
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if err := query.Find(&subs).Error; err != nil {
+		r.logger.WithError(err).Error("Failed to list subscriptions")
+		return nil, err
+	}
+	return subs, nil
+}
+
+// ListDue returns the live subscriptions the scheduler has to look at: trials
+// and periods that have ended, and everything past due.
+func (r *SubscriptionRepo) ListDue(now time.Time) ([]types.Subscription, error) {
+	var subs []types.Subscription
+	err := r.db.Preload("Plan.Systems").Preload("Plan.Quotas").
+		Where("(status = ? AND trial_ends_at <= ?) OR (status = ? AND current_period_end <= ?) OR status = ?",
+			types.SubscriptionTrialing, now, types.SubscriptionActive, now, types.SubscriptionPastDue).
+		Order("current_period_end").
+		Find(&subs).Error
+	if err != nil {
+		r.logger.WithError(err).Error("Failed to list due subscriptions")
+		return nil, err
+	}
+	return subs, nil
+}
+
+// UpdateSubscription saves the subscription if it is still in status from.
+// It reports false when another writer moved it first.
+func (r *SubscriptionRepo) UpdateSubscription(sub *types.Subscription, from types.SubscriptionStatus) (bool, error) {
+	sub.UpdatedAt = time.Now()
+	result := r.db.Model(&types.Subscription{}).
+		Where("subscription_id = ? AND status = ?", sub.SubscriptionID, from).
+		Updates(map[string]interface{}{
+			"plan_id":              sub.PlanID,
+			"status":               sub.Status,
+			"current_period_start": sub.CurrentPeriodStart,
+			"current_period_end":   sub.CurrentPeriodEnd,
+			"trial_ends_at":        sub.TrialEndsAt,
+			"cancel_at_period_end": sub.CancelAtPeriodEnd,
+			"past_due_since":       sub.PastDueSince,
+			"next_attempt_at":      sub.NextAttemptAt,
+			"canceled_at":          sub.CanceledAt,
+			"ended_at":             sub.EndedAt,
+			"updated_at":           sub.UpdatedAt,
+		})
+	if result.Error != nil {
+		r.logger.WithError(result.Error).Error("Failed to update subscription")
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
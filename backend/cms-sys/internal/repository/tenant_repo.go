@@ -0,0 +1,152 @@
+package repository
+
+import (
+	"errors"
+	"github.com/google/uuid"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/types"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"time"
+)
+
+var (
+	ErrTenantNotFound      = errors.New("tenant not found")
+	ErrTenantStatusChanged = errors.New("tenant status changed concurrently")
+)
+
+type TenantRepository interface {
+	CreateTenant(tenant *types.Tenant) error
+	GetTenantByNamespace(namespace string) (*types.Tenant, error)
+	GetTenantByID(id uuid.UUID) (*types.Tenant, error)
+	UpdateTenant(tenant *types.Tenant) error
+	UpdateTenantFrom(tenant *types.Tenant, from types.TenantStatus) error
+	ClaimPurge(namespace string, staleBefore time.Time) (bool, error)
+	DeleteTenant(id uuid.UUID) error
+	ListTenants() ([]types.Tenant, error)
+	ListDueForPurge(now, staleBefore time.Time) ([]types.Tenant, error)
+	SaveDeletionRecord(record *types.TenantDeletionRecord) error
+}
+
+type TenantRepo struct {
+	logger *logrus.Logger
+	db     *gorm.DB
+}
+
+var _ TenantRepository = (*TenantRepo)(nil)
+
+func NewTenantRepo(logger *logrus.Logger, db *gorm.DB) *TenantRepo {
+	return &TenantRepo{
+		logger: logger,
+		db:     db,
+	}
+}
+
+func (r *TenantRepo) CreateTenant(tenant *types.Tenant) error {
+	if err := r.db.Create(tenant).Error; err != nil {
+		r.logger.WithError(err).Error("Failed to create tenant")
+		return err
+	}
+	return nil
+}
+
+func (r *TenantRepo) GetTenantByNamespace(namespace string) (*types.Tenant, error) {
+	var tenant types.Tenant
+	if err := r.db.Where("namespace = ?", namespace).First(&tenant).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrTenantNotFound
+		}
+		r.logger.WithError(err).Error("Failed to get tenant by namespace")
+		return nil, err
+	}
+	return &tenant, nil
+}
+
+func (r *TenantRepo) GetTenantByID(id uuid.UUID) (*types.Tenant, error) {
+	var tenant types.Tenant
+	if err := r.db.Where("tenant_id = ?", id).First(&tenant).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrTenantNotFound
+		}
+		r.logger.WithError(err).Error("Failed to get tenant by ID")
+		return nil, err
+	}
+	return &tenant, nil
+}
+
+func (r *TenantRepo) UpdateTenant(tenant *types.Tenant) error {
+	if err := r.db.Save(tenant).Error; err != nil {
+		r.logger.WithError(err).Error("Failed to update tenant")
+		return err
+	}
+	return nil
+}
+
+// UpdateTenantFrom saves tenant only if its stored status is still from, and
+// returns ErrTenantStatusChanged otherwise.
+func (r *TenantRepo) UpdateTenantFrom(tenant *types.Tenant, from types.TenantStatus) error {
+	result := r.db.Model(tenant).Where("status = ?", from).Select("*").Updates(tenant)
+	if result.Error != nil {
+		r.logger.WithError(result.Error).Error("Failed to update tenant")
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrTenantStatusChanged
+	}
+	return nil
+}
+
+// ClaimPurge moves a tenant scheduled for deletion to PURGING and reports
+// whether this caller won it. A PURGING tenant last touched before
+// staleBefore belongs to a purge that failed part way and can be claimed
+// again.
+func (r *TenantRepo) ClaimPurge(namespace string, staleBefore time.Time) (bool, error) {
+	result := r.db.Model(&types.Tenant{}).
+		Where("namespace = ? AND (status = ? OR (status = ? AND updated_at < ?))",
+			namespace, types.TenantPendingDeletion, types.TenantPurging, staleBefore).
+		Updates(map[string]interface{}{"status": types.TenantPurging, "updated_at": time.Now()})
+	if result.Error != nil {
+		r.logger.WithError(result.Error).Error("Failed to claim tenant for purge")
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+func (r *TenantRepo) DeleteTenant(id uuid.UUID) error {
+	if err := r.db.Where("tenant_id = ?", id).Delete(&types.Tenant{}).Error; err != nil {
+		r.logger.WithError(err).Error("Failed to delete tenant")
+		return err
+	}
+	return nil
+}
+
+func (r *TenantRepo) ListTenants() ([]types.Tenant, error) {
+	var tenants []types.Tenant
+	if err := r.db.Order("namespace").Find(&tenants).Error; err != nil {
+		r.logger.WithError(err).Error("Failed to list tenants")
+		return nil, err
+	}
+	return tenants, nil
+}
+
+// ListDueForPurge lists tenants whose retention has elapsed and those left
+// PURGING by a purge that failed before staleBefore.
+func (r *TenantRepo) ListDueForPurge(now, staleBefore time.Time) ([]types.Tenant, error) {
+	var tenants []types.Tenant
+	err := r.db.Where("(status = ? AND purge_after <= ?) OR (status = ? AND updated_at < ?)",
+		types.TenantPendingDeletion, now, types.TenantPurging, staleBefore).
+		Order("purge_after").
+		Find(&tenants).Error
+	if err != nil {
+		r.logger.WithError(err).Error("Failed to list tenants due for purge")
+		return nil, err
+	}
+	return tenants, nil
+}
+
+func (r *TenantRepo) SaveDeletionRecord(record *types.TenantDeletionRecord) error {
+	if err := r.db.Create(record).Error; err != nil {
+		r.logger.WithError(err).Error("Failed to save tenant deletion record")
+		return err
+	}
+	return nil
+}
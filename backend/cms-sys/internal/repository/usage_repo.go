@@ -0,0 +1,153 @@
+package repository
+
+import (
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/types"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+type UsageRepository interface {
+	Add(namespace, metric, period string, delta int64, limit *int64) (int64, bool, error)
+	Subtract(namespace, metric, period string, delta int64) error
+	Set(namespace, metric, period string, value int64) error
+	Get(namespace, metric, period string) (int64, error)
+	ListCounters(namespace string, periods []string) ([]types.UsageCounter, error)
+	ListQuotas(namespace string) ([]types.TenantQuota, error)
+	SetQuota(quota *types.TenantQuota) error
+	DeleteQuota(namespace, metric string) error
+}
+
+type UsageRepo struct {
+	logger *logrus.Logger
+	db     *gorm.DB
+}
+
+var _ UsageRepository = (*UsageRepo)(nil)
+
+func NewUsageRepo(logger *logrus.Logger, db *gorm.DB) *UsageRepo {
+	return &UsageRepo{
+		logger: logger,
+		db:     db,
+	}
+}
+
+// Add increments a counter in a single statement and reports whether the
+// increment was applied. With a limit the row is only updated while the new
+// value stays within it, so concurrent callers on any instance can never push
+// a counter past its limit.
+func (r *UsageRepo) Add(namespace, metric, period string, delta int64, limit *int64) (int64, bool, error) {
+	var values []int64
+	var err error
+	if limit == nil {
+		err = r.db.Raw(`INSERT INTO cms_usage_counter AS u (namespace, metric, period, value, updated_at)
+			VALUES (?, ?, ?, ?, NOW())
+			ON CONFLICT (namespace, metric, period)
+			DO UPDATE SET value = u.value + EXCLUDED.value, updated_at = NOW()
+			RETURNING u.value`, namespace, metric, period, delta).Scan(&values).Error
+	} else {
+		// Bind parameters are untyped, so the comparisons cast them; compared
+		// as text, 9 <= 10 would be false.
+		err = r.db.Raw(`INSERT INTO cms_usage_counter AS u (namespace, metric, period, value, updated_at)
+			SELECT ?, ?, ?, ?::bigint, NOW() WHERE ?::bigint <= ?::bigint
+			ON CONFLICT (namespace, metric, period)
+			DO UPDATE SET value = u.value + EXCLUDED.value, updated_at = NOW()
+			WHERE u.value + EXCLUDED.value <= ?::bigint
+			RETURNING u.value`, namespace, metric, period, delta, delta, *limit, *limit).Scan(&values).Error
+	}
+	if err != nil {
+		r.logger.WithError(err).Error("Failed to increment usage counter")
+		return 0, false, err
+	}
+	if len(values) == 0 {
+		return 0, false, nil
+	}
+	return values[0], true, nil
+}
+
+func (r *UsageRepo) Subtract(namespace, metric, period string, delta int64) error {
+	err := r.db.Exec(`UPDATE cms_usage_counter SET value = GREATEST(value - ?, 0), updated_at = NOW()
+		WHERE namespace = ? AND metric = ? AND period = ?`, delta, namespace, metric, period).Error
+	if err != nil {
+		r.logger.WithError(err).Error("Failed to decrement usage counter")
+		return err
+	}
+	return nil
+}
+
+func (r *UsageRepo) Set(namespace, metric, period string, value int64) error {
+	counter := &types.UsageCounter{
+		Namespace: namespace,
+		Metric:    metric,
+		Period:    period,
+		Value:     value,
+		UpdatedAt: time.Now(),
+	}
+	err := r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "namespace"}, {Name: "metric"}, {Name: "period"}},
+		DoUpdates: clause.AssignmentColumns([]string{"value", "updated_at"}),
+	}).Create(counter).Error
+	if err != nil {
+		r.logger.WithError(err).Error("Failed to set usage counter")
+		return err
+	}
+	return nil
+}
+
+func (r *UsageRepo) Get(namespace, metric, period string) (int64, error) {
+	var values []int64
+	err := r.db.Model(&types.UsageCounter{}).
+		Where("namespace = ? AND metric = ? AND period = ?", namespace, metric, period).
+		Pluck("value", &values).Error
+	if err != nil {
+		r.logger.WithError(err).Error("Failed to get usage counter")
+		return 0, err
+	}
+	if len(values) == 0 {
+		return 0, nil
+	}
+	return values[0], nil
+}
+
+func (r *UsageRepo) ListCounters(namespace string, periods []string) ([]types.UsageCounter, error) {
+	var counters []types.UsageCounter
+	err := r.db.Where("namespace = ? AND period IN ?", namespace, periods).
+		Order("metric").
+		Find(&counters).Error
+	if err != nil {
+		r.logger.WithError(err).Error("Failed to list usage counters")
+		return nil, err
+	}
+	return counters, nil
+}
+
+func (r *UsageRepo) ListQuotas(namespace string) ([]types.TenantQuota, error) {
+	var quotas []types.TenantQuota
+	if err := r.db.Where("namespace = ?", namespace).Find(&quotas).Error; err != nil {
+		r.logger.WithError(err).Error("Failed to list tenant quotas")
+		return nil, err
+	}
+	return quotas, nil
+}
+
+func (r *UsageRepo) SetQuota(quota *types.TenantQuota) error {
+	err := r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "namespace"}, {Name: "metric"}},
+		DoUpdates: clause.AssignmentColumns([]string{"quota_limit", "updated_at"}),
+	}).Create(quota).Error
+	if err != nil {
+		r.logger.WithError(err).Error("Failed to set tenant quota")
+		return err
+	}
+	return nil
+}
+
+func (r *UsageRepo) DeleteQuota(namespace, metric string) error {
+	err := r.db.Where("namespace = ? AND metric = ?", namespace, metric).Delete(&types.TenantQuota{}).Error
+	if err != nil {
+		r.logger.WithError(err).Error("Failed to delete tenant quota")
+		return err
+	}
+	return nil
+}
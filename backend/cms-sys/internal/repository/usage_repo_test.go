@@ -0,0 +1,88 @@
+package repository
+
+import (
+	"io"
+	"os"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// testTx opens a transaction on the database named by TEST_DATABASE_DSN and
+// rolls it back when the test ends. Tests needing Postgres skip without it.
+func testTx(t *testing.T) *gorm.DB {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_DSN is not set")
+	}
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	tx := db.Begin()
+	if tx.Error != nil {
+		t.Fatalf("begin: %v", tx.Error)
+	}
+	t.Cleanup(func() { tx.Rollback() })
+	return tx
+}
+
+func quietLogger() *logrus.Logger {
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+	return log
+}
+
+func TestUsageRepoAddWithLimit(t *testing.T) {
+	tx := testTx(t)
+	// A temporary table shadows any real counters for this transaction.
+	err := tx.Exec(`CREATE TEMP TABLE cms_usage_counter (
+		namespace varchar(100), metric varchar(50), period varchar(20),
+		value bigint NOT NULL DEFAULT 0, updated_at timestamptz DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (namespace, metric, period)) ON COMMIT DROP`).Error
+	if err != nil {
+		t.Fatalf("create table: %v", err)
+	}
+	repo := NewUsageRepo(quietLogger(), tx)
+
+	limit := int64(10)
+	steps := []struct {
+		name    string
+		delta   int64
+		applied bool
+		value   int64
+	}{
+		// Compared as text, "9" <= "10" is false and the first insert fails.
+		{"first insert below the limit", 9, true, 9},
+		{"increment up to the limit", 1, true, 10},
+		{"increment past the limit", 1, false, 10},
+	}
+	for _, step := range steps {
+		value, applied, err := repo.Add("acme", "api_calls", "2025-01", step.delta, &limit)
+		if err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		if applied != step.applied {
+			t.Fatalf("%s: applied = %v, want %v", step.name, applied, step.applied)
+		}
+		got, err := repo.Get("acme", "api_calls", "2025-01")
+		if err != nil {
+			t.Fatalf("%s: get: %v", step.name, err)
+		}
+		if got != step.value || (applied && value != step.value) {
+			t.Fatalf("%s: value = %d (returned %d), want %d", step.name, got, value, step.value)
+		}
+	}
+
+	if _, applied, err := repo.Add("acme", "users", "total", 11, &limit); err != nil || applied {
+		t.Fatalf("first insert over the limit: applied = %v, err = %v", applied, err)
+	}
+	limit = 100
+	if value, applied, err := repo.Add("acme", "users", "total", 20, &limit); err != nil || !applied || value != 20 {
+		t.Fatalf("first insert below a limit of 100: value = %d, applied = %v, err = %v", value, applied, err)
+	}
+}
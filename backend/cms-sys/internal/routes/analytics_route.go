@@ -0,0 +1,25 @@
+package routes
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/handler"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/middleware"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/types"
+)
+
+// SetupAnalyticsRoutes mounts the tenant usage analytics and the customer
+// growth analytics side by side.
+func SetupAnalyticsRoutes(app *fiber.App, handler handler.AnalyticsHandle, growth handler.GrowthHandle) {
+	analytics := app.Group("/admin/analytics", middleware.RequireAuth(), middleware.RequireRole(types.RootAdmin))
+	analytics.Get("/", handler.Summary)
+	analytics.Get("/series", handler.Series)
+	analytics.Get("/tenants", handler.Tenants)
+	analytics.Post("/collect", handler.Collect)
+
+	analytics.Get("/cohorts", growth.Cohorts)
+	analytics.Get("/funnel", growth.Funnel)
+	analytics.Get("/mrr", growth.MRR)
+	analytics.Get("/churn", growth.Churn)
+	analytics.Get("/revenue", growth.Revenue)
+	analytics.Post("/aggregates/refresh", growth.Refresh)
+}
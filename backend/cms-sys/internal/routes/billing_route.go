@@ -0,0 +1,68 @@
+package routes
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/handler"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/middleware"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/types"
+)
+
+// BillingHandlers groups the handlers serving plans, subscriptions,
+// invoices and coupons.
+type BillingHandlers struct {
+	Plans         handler.PlanHandle
+	Subscriptions handler.SubscriptionHandle
+	Invoices      handler.InvoiceHandle
+	Coupons       handler.CouponHandle
+}
+
+func SetupBillingRoutes(app *fiber.App, handlers BillingHandlers) {
+	plans, subscriptions, invoices, coupons := handlers.Plans, handlers.Subscriptions, handlers.Invoices, handlers.Coupons
+
+	// The catalogue of open plans is public, like a pricing page.
+	app.Get("/plans", plans.List)
+
+	subscription := app.Group("/subscription", middleware.RequireAuth(), middleware.RequireRole(types.CMSCustomer))
+	subscription.Get("/", subscriptions.Get)
+	subscription.Post("/", subscriptions.Subscribe)
+	subscription.Put("/plan", subscriptions.ChangePlan)
+	subscription.Post("/cancel", subscriptions.Cancel)
+	subscription.Post("/resume", subscriptions.Resume)
+
+	customerInvoices := app.Group("/invoices", middleware.RequireAuth(), middleware.RequireRole(types.CMSCustomer))
+	customerInvoices.Get("/", invoices.List)
+	customerInvoices.Get("/:id", invoices.Get)
+	customerInvoices.Get("/:id/pdf", invoices.Download)
+
+	app.Get("/coupons/:code", middleware.RequireAuth(), middleware.RequireRole(types.CMSCustomer), coupons.Quote)
+
+	admin := app.Group("/admin/plans", middleware.RequireAuth(), middleware.RequireRole(types.RootAdmin))
+	admin.Get("/", plans.AdminList)
+	admin.Post("/", plans.Create)
+	admin.Get("/:id", plans.Get)
+	admin.Put("/:id", plans.Update)
+	admin.Delete("/:id", plans.Retire)
+
+	adminSubs := app.Group("/admin/subscriptions", middleware.RequireAuth(), middleware.RequireRole(types.RootAdmin))
+	adminSubs.Get("/", subscriptions.List)
+	adminSubs.Post("/process", subscriptions.Process)
+
+	adminInvoices := app.Group("/admin/invoices", middleware.RequireAuth(), middleware.RequireRole(types.RootAdmin))
+	adminInvoices.Get("/", invoices.AdminList)
+	adminInvoices.Get("/:id", invoices.AdminGet)
+	adminInvoices.Get("/:id/pdf", invoices.AdminDownload)
+	adminInvoices.Post("/:id/resend", invoices.Resend)
+
+	adminCoupons := app.Group("/admin/coupons", middleware.RequireAuth(), middleware.RequireRole(types.RootAdmin))
+	adminCoupons.Get("/", coupons.List)
+	adminCoupons.Post("/", coupons.Create)
+	adminCoupons.Get("/:id", coupons.Get)
+	adminCoupons.Put("/:id", coupons.Update)
+	adminCoupons.Delete("/:id", coupons.Disable)
+	adminCoupons.Get("/:id/redemptions", coupons.Report)
+
+	customer := app.Group("/admin/customers/:userID/subscription", middleware.RequireAuth(), middleware.RequireRole(types.RootAdmin))
+	customer.Get("/", subscriptions.CustomerSubscription)
+	customer.Post("/", subscriptions.CustomerSubscribe)
+	customer.Post("/cancel", subscriptions.CustomerCancel)
+}
@@ -0,0 +1,35 @@
+package routes
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/handler"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/middleware"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/types"
+)
+
+// SetupPaymentRoutes mounts checkout, payment history, refunds and the
+// provider webhook. The simulator is only mounted when sim is set, and only
+// for the root admin.
+func SetupPaymentRoutes(app *fiber.App, handler handler.PaymentHandle, sim handler.PaymentSimHandle) {
+	// Authenticated by its signature, not a token.
+	app.Post("/webhooks/payments", handler.Webhook)
+
+	payments := app.Group("/payments", middleware.RequireAuth(), middleware.RequireRole(types.CMSCustomer))
+	payments.Get("/", handler.Payments)
+	payments.Post("/checkout", handler.Checkout)
+	payments.Get("/checkouts", handler.Checkouts)
+
+	admin := app.Group("/admin/payments", middleware.RequireAuth(), middleware.RequireRole(types.RootAdmin))
+	admin.Get("/", handler.AdminPayments)
+	admin.Post("/:id/refund", handler.Refund)
+
+	if sim == nil {
+		return
+	}
+	simulator := app.Group("/simulator", middleware.RequireAuth(), middleware.RequireRole(types.RootAdmin))
+	simulator.Get("/checkout/:id", sim.Session)
+	simulator.Post("/checkout/:id/complete", sim.Complete)
+	simulator.Post("/checkout/:id/expire", sim.Expire)
+	simulator.Post("/events/:id/replay", sim.Replay)
+	simulator.Put("/customers/:id/decline", sim.Decline)
+}
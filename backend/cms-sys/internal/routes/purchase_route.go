@@ -0,0 +1,21 @@
+package routes
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/handler"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/middleware"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/types"
+)
+
+func SetupPurchaseRoutes(app *fiber.App, handler handler.PurchaseHandle) {
+	purchases := app.Group("/purchases", middleware.RequireAuth(), middleware.RequireRole(types.CMSCustomer))
+	purchases.Get("/", handler.List)
+	purchases.Post("/", handler.Purchase)
+	purchases.Delete("/:system", handler.Cancel)
+	purchases.Get("/entitlements/:system", handler.Entitlement)
+
+	admin := app.Group("/admin/customers/:userID/purchases", middleware.RequireAuth(), middleware.RequireRole(types.RootAdmin))
+	admin.Get("/", handler.CustomerPurchases)
+	admin.Post("/", handler.Grant)
+	admin.Delete("/:system", handler.Revoke)
+}
@@ -0,0 +1,26 @@
+package routes
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/handler"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/middleware"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/types"
+)
+
+func SetupReportRoutes(app *fiber.App, handler handler.ReportHandle) {
+	reports := app.Group("/admin/reports", middleware.RequireAuth(), middleware.RequireRole(types.RootAdmin))
+	reports.Get("/customer-purchases", handler.CustomerPurchases)
+	reports.Get("/systems", handler.SystemUsage)
+	reports.Get("/exports/:id", handler.ExportStatus)
+	reports.Get("/exports/:id/download", handler.DownloadExport)
+
+	schedules := reports.Group("/schedules")
+	schedules.Get("/", handler.ListSchedules)
+	schedules.Post("/", handler.CreateSchedule)
+	schedules.Get("/:id", handler.GetSchedule)
+	schedules.Put("/:id", handler.UpdateSchedule)
+	schedules.Delete("/:id", handler.DeleteSchedule)
+	schedules.Post("/:id/run", handler.RunSchedule)
+	schedules.Get("/:id/snapshots", handler.Snapshots)
+	schedules.Get("/:id/snapshots/:version", handler.Snapshot)
+}
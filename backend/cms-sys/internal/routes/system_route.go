@@ -0,0 +1,26 @@
+package routes
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/handler"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/middleware"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/types"
+)
+
+// SetupSystemRoutes mounts the system catalog and /systems/:system/... for
+// every system in it behind its entitlement gate. Routes of a system belong
+// in the gated group.
+func SetupSystemRoutes(app *fiber.App, gate *middleware.SystemGate, catalog handler.CatalogHandle, purchases handler.PurchaseHandle) {
+	// The catalog of systems on sale is public, like the plans.
+	app.Get("/systems", catalog.List)
+
+	system := app.Group("/systems/:system", gate.RequireNamedSystem("system"))
+	system.Get("/access", purchases.SystemAccess)
+
+	admin := app.Group("/admin/systems", middleware.RequireAuth(), middleware.RequireRole(types.RootAdmin))
+	admin.Get("/", catalog.AdminList)
+	admin.Post("/", catalog.Create)
+	admin.Get("/:system", catalog.Get)
+	admin.Put("/:system", catalog.Update)
+	admin.Delete("/:system", catalog.Disable)
+}
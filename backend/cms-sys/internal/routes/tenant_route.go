@@ -0,0 +1,105 @@
+package routes
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/handler"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/middleware"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/types"
+)
+
+// TenantHandlers groups the handlers serving tenant routes.
+type TenantHandlers struct {
+	Tenant      handler.TenantHandle
+	Usage       handler.UsageHandle
+	Settings    handler.SettingsHandle
+	Domains     handler.DomainHandle
+	Members     handler.MemberHandle
+	Invitations handler.InvitationHandle
+}
+
+func SetupTenantRoutes(app *fiber.App, tenantScope, metering fiber.Handler, memberships middleware.Memberships, handlers TenantHandlers) {
+	handler, usage, settings, domains, members := handlers.Tenant, handlers.Usage, handlers.Settings, handlers.Domains, handlers.Members
+	invitations := handlers.Invitations
+
+	// Fiber matches group middleware by plain path prefix, so "/tenant" also
+	// catches "/tenants/...". Routes under "/tenants" are registered first and
+	// end the chain before the tenant scope runs.
+	tenants := app.Group("/tenants/:namespace", middleware.RequireAuth(), middleware.RequireNamespaceAccess("namespace", memberships))
+	tenants.Get("/usage", usage.Usage)
+	tenants.Get("/settings", settings.ListTenant)
+	tenants.Put("/settings/:key", settings.SetTenant)
+	tenants.Delete("/settings/:key", settings.ResetTenant)
+	tenants.Get("/domains", domains.List)
+	tenants.Post("/domains", domains.Add)
+	tenants.Post("/domains/:domain/verify", domains.Verify)
+	tenants.Delete("/domains/:domain", domains.Remove)
+	tenants.Get("/members", members.List)
+	tenants.Post("/members", members.Add)
+	tenants.Put("/members/:userID", members.Update)
+	tenants.Delete("/members/:userID", members.Remove)
+	tenants.Get("/transfers", members.ListTransfers)
+	tenants.Post("/transfers", members.InitiateTransfer)
+	tenants.Delete("/transfers/:id", members.CancelTransfer)
+	tenants.Get("/invitations", invitations.List)
+	tenants.Post("/invitations", invitations.Invite)
+	tenants.Post("/invitations/:id/resend", invitations.Resend)
+	tenants.Delete("/invitations/:id", invitations.Revoke)
+
+	// Transfers offered to the caller, whichever tenant they are for.
+	transfers := app.Group("/transfers", middleware.RequireAuth())
+	transfers.Get("/", members.Incoming)
+	transfers.Post("/:id/accept", members.Accept)
+	transfers.Post("/:id/decline", members.Decline)
+
+	// Invite links are redeemed without an account; the token authorises.
+	invites := app.Group("/invitations")
+	invites.Get("/", invitations.Preview)
+	invites.Post("/accept", invitations.Accept)
+
+	// The scope checks the caller may use the tenant they named, so API calls
+	// are only metered against tenants the caller belongs to.
+	tenant := app.Group("/tenant", middleware.RequireAuth(), tenantScope, metering)
+	tenant.Get("/", handler.Current)
+
+	exports := tenant.Group("/exports", middleware.RequireTenantOwner(memberships))
+	exports.Post("/", handler.StartExport)
+	exports.Get("/:id", handler.ExportStatus)
+	exports.Get("/:id/download", handler.DownloadExport)
+
+	admin := app.Group("/admin/tenants", middleware.RequireAuth(), middleware.RequireRole(types.RootAdmin))
+	admin.Post("/", handler.Create)
+	admin.Get("/", handler.List)
+	admin.Get("/templates", handler.ListTemplates)
+	admin.Post("/:namespace/template", handler.MarkTemplate)
+	admin.Delete("/:namespace/template", handler.UnmarkTemplate)
+	admin.Post("/:namespace/suspend", handler.Suspend)
+	admin.Post("/:namespace/reactivate", handler.Reactivate)
+	admin.Post("/:namespace/isolate", handler.Isolate)
+	admin.Post("/:namespace/schedule-deletion", handler.ScheduleDeletion)
+	admin.Post("/:namespace/purge", handler.Purge)
+	admin.Get("/:namespace/audit", handler.AuditTrail)
+	admin.Get("/:namespace/usage", usage.Usage)
+	admin.Put("/:namespace/quotas", usage.SetQuota)
+	admin.Get("/:namespace/settings", settings.ListTenant)
+	admin.Put("/:namespace/settings/:key", settings.SetTenant)
+	admin.Delete("/:namespace/settings/:key", settings.ResetTenant)
+	admin.Get("/:namespace/domains", domains.List)
+	admin.Post("/:namespace/domains", domains.Add)
+	admin.Post("/:namespace/domains/:domain/verify", domains.Verify)
+	admin.Delete("/:namespace/domains/:domain", domains.Remove)
+	admin.Get("/:namespace/members", members.List)
+	admin.Post("/:namespace/members", members.Add)
+	admin.Put("/:namespace/members/:userID", members.Update)
+	admin.Delete("/:namespace/members/:userID", members.Remove)
+	admin.Get("/:namespace/transfers", members.ListTransfers)
+	admin.Post("/:namespace/transfer", members.ForceTransfer)
+	admin.Get("/:namespace/invitations", invitations.List)
+	admin.Post("/:namespace/invitations", invitations.Invite)
+	admin.Post("/:namespace/invitations/:id/resend", invitations.Resend)
+	admin.Delete("/:namespace/invitations/:id", invitations.Revoke)
+
+	global := app.Group("/admin/settings", middleware.RequireAuth(), middleware.RequireRole(types.RootAdmin))
+	global.Get("/", settings.ListGlobal)
+	global.Put("/:key", settings.SetGlobal)
+	global.Delete("/:key", settings.ResetGlobal)
+}
@@ -0,0 +1,181 @@
+package seed
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/stdlib"
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/utils"
+	"gorm.io/gorm"
+)
+
+// copyTx runs fn in a transaction on a single connection, where rows are
+// loaded with COPY rather than INSERT. COPY fires the same row triggers as
+// INSERT, so rows the triggers derive are left to them.
+func copyTx(ctx context.Context, db *gorm.DB, batchSize int, fn func(c *copier) error) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return conn.Raw(func(driverConn interface{}) error {
+		stdConn, ok := driverConn.(*stdlib.Conn)
+		if !ok {
+			return errors.New("COPY needs the pgx driver")
+		}
+		pg := stdConn.Conn().PgConn()
+
+		if err := pg.Exec(ctx, "BEGIN").Close(); err != nil {
+			return err
+		}
+		c := &copier{ctx: ctx, conn: pg, batchSize: batchSize, counts: make(map[string]int)}
+		if err := fn(c); err != nil {
+			// The error that aborted the transaction matters more than the
+			// rollback's.
+			_ = pg.Exec(context.Background(), "ROLLBACK").Close()
+			return err
+		}
+		return pg.Exec(ctx, "COMMIT").Close()
+	})
+}
+
+// copier buffers rows per table and sends each full batch as one COPY.
+type copier struct {
+	ctx       context.Context
+	conn      *pgconn.PgConn
+	batchSize int
+	counts    map[string]int
+}
+
+type copyTable struct {
+	c       *copier
+	name    string
+	stmt    string
+	columns int
+	rows    int
+	buf     bytes.Buffer
+}
+
+func (c *copier) table(schema, name string, columns ...string) *copyTable {
+	quoted := make([]string, len(columns))
+	for i, col := range columns {
+		quoted[i] = utils.QuoteIdent(col)
+	}
+	return &copyTable{
+		c:       c,
+		name:    schema + "." + name,
+		stmt:    fmt.Sprintf("COPY %s.%s (%s) FROM STDIN", utils.QuoteIdent(schema), utils.QuoteIdent(name), strings.Join(quoted, ", ")),
+		columns: len(columns),
+	}
+}
+
+// row adds one row in the text format of COPY, flushing a full batch.
+func (t *copyTable) row(values ...interface{}) error {
+	if len(values) != t.columns {
+		return fmt.Errorf("%s: %d values for %d columns", t.name, len(values), t.columns)
+	}
+	for i, v := range values {
+		if i > 0 {
+			t.buf.WriteByte('\t')
+		}
+		writeCopyValue(&t.buf, v)
+	}
+	t.buf.WriteByte('\n')
+	t.rows++
+
+	if t.rows >= t.c.batchSize {
+		return t.flush()
+	}
+	return nil
+}
+
+func (t *copyTable) flush() error {
+	if t.rows == 0 {
+		return nil
+	}
+	if _, err := t.c.conn.CopyFrom(t.c.ctx, &t.buf, t.stmt); err != nil {
+		return fmt.Errorf("copying into %s: %w", t.name, err)
+	}
+	t.c.counts[t.name] += t.rows
+	t.rows = 0
+	t.buf.Reset()
+	return nil
+}
+
+const copyTimeLayout = "2006-01-02 15:04:05.999999"
+
+func writeCopyValue(buf *bytes.Buffer, v interface{}) {
+	switch v := v.(type) {
+	case nil:
+		buf.WriteString(`\N`)
+	case string:
+		writeCopyText(buf, v)
+	case *string:
+		if v == nil {
+			buf.WriteString(`\N`)
+			return
+		}
+		writeCopyText(buf, *v)
+	case uuid.UUID:
+		buf.WriteString(v.String())
+	case *uuid.UUID:
+		if v == nil {
+			buf.WriteString(`\N`)
+			return
+		}
+		buf.WriteString(v.String())
+	case time.Time:
+		buf.WriteString(v.UTC().Format(copyTimeLayout))
+		buf.WriteString("+00")
+	case *time.Time:
+		if v == nil {
+			buf.WriteString(`\N`)
+			return
+		}
+		writeCopyValue(buf, *v)
+	case bool:
+		if v {
+			buf.WriteByte('t')
+		} else {
+			buf.WriteByte('f')
+		}
+	case int:
+		buf.WriteString(strconv.Itoa(v))
+	case int64:
+		buf.WriteString(strconv.FormatInt(v, 10))
+	case float64:
+		buf.WriteString(strconv.FormatFloat(v, 'f', -1, 64))
+	default:
+		writeCopyText(buf, fmt.Sprint(v))
+	}
+}
+
+// writeCopyText escapes the characters the text format of COPY gives meaning.
+func writeCopyText(buf *bytes.Buffer, s string) {
+	for i := 0; i < len(s); i++ {
+		switch ch := s[i]; ch {
+		case '\\':
+			buf.WriteString(`\\`)
+		case '\t':
+			buf.WriteString(`\t`)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\r':
+			buf.WriteString(`\r`)
+		default:
+			buf.WriteByte(ch)
+		}
+	}
+}
@@ -0,0 +1,331 @@
+package seed
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/isolation"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/repository"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/types"
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/utils"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrAlreadySeeded = errors.New("the database already holds data generated from this profile and seed")
+	ErrNoLMS         = errors.New("tenants need an active LMS entry in the system catalog")
+)
+
+// platformSchema holds the CMS tables the server auto-migrates.
+const platformSchema = "public"
+
+// Generator fills a migrated database with fake but consistent data: customers
+// and their purchases on the platform, granted by a generated root admin, and
+// tenants with LMS users, courses,
+// enrollments, quiz attempts and submissions in their own schemas.
+type Generator struct {
+	log       *logrus.Logger
+	db        *gorm.DB
+	isolation *isolation.Selector
+	tenants   repository.TenantRepository
+}
+
+func NewGenerator(log *logrus.Logger, db *gorm.DB, selector *isolation.Selector, tenants repository.TenantRepository) *Generator {
+	return &Generator{
+		log:       log,
+		db:        db,
+		isolation: selector,
+		tenants:   tenants,
+	}
+}
+
+// Report counts the rows loaded per table. Rows the LMS triggers derive, such
+// as namespace_consumer entries for students, are not included.
+type Report struct {
+	Tenants []string     `json:"tenants"`
+	Tables  []TableCount `json:"tables"`
+}
+
+type TableCount struct {
+	Table string `json:"table"`
+	Rows  int    `json:"rows"`
+}
+
+type customer struct {
+	id        uuid.UUID
+	name      string
+	email     string
+	verified  bool
+	createdAt time.Time
+	namespace *string
+}
+
+type purchase struct {
+	id         uuid.UUID
+	customerID uuid.UUID
+	system     string
+	namespace  *string
+	date       time.Time
+}
+
+// Run generates everything p describes. Every user, customers included, gets
+// a bcrypt hash of password so any of them can sign in. Platform rows load in
+// one transaction and each tenant in its own; a tenant whose data fails to
+// load is dropped before it is registered.
+func (g *Generator) Run(ctx context.Context, p *Profile, password string) (*Report, error) {
+	gen := newGenerator(p)
+	counts := make(map[string]int)
+
+	systems, err := g.activeSystems(p)
+	if err != nil {
+		return nil, err
+	}
+
+	customers := g.customers(gen, p)
+	adminEmail := fmt.Sprintf("admin.%d@%s", p.Seed, p.EmailDomain)
+	if err := g.checkFresh(p, adminEmail, customers); err != nil {
+		return nil, err
+	}
+
+	tp := p.Tenant
+	usersPerTenant := 1 + tp.Instructors + tp.Students
+	hashes, err := hashPasswords(ctx, password, p.Customers+1+p.Tenants*usersPerTenant, p.BcryptCost)
+	if err != nil {
+		return nil, err
+	}
+	g.log.WithField("hashes", len(hashes)).Info("Hashed generated passwords")
+
+	purchases := g.purchases(gen, p, customers, systems)
+	// The purchases have no subscription paying for them, so they are
+	// granted; otherwise none would entitle.
+	adminID := gen.uuid()
+	err = copyTx(ctx, g.db, p.BatchSize, func(c *copier) error {
+		users := c.table(platformSchema, "cms_user",
+			"cms_user_id", "cms_user_name", "cms_user_email", "cms_name_space", "password",
+			"cms_user_role", "verified", "created_at", "updated_at")
+		err := users.row(adminID, "Seed Administrator", adminEmail, nil, hashes[p.Customers],
+			string(types.RootAdmin), true, gen.start, gen.start)
+		if err != nil {
+			return err
+		}
+		for i, cu := range customers {
+			err := users.row(cu.id, cu.name, cu.email, cu.namespace, hashes[i],
+				string(types.CMSCustomer), cu.verified, cu.createdAt, cu.createdAt)
+			if err != nil {
+				return err
+			}
+		}
+		if err := users.flush(); err != nil {
+			return err
+		}
+
+		rows := c.table(platformSchema, "cms_cus_purchase",
+			"relation_id", "cms_cus_id", "system_name", "namespace", "purchase_date", "granted_by", "created_at")
+		for _, pu := range purchases {
+			if err := rows.row(pu.id, pu.customerID, pu.system, pu.namespace, pu.date, adminID, pu.date); err != nil {
+				return err
+			}
+		}
+		if err := rows.flush(); err != nil {
+			return err
+		}
+		mergeCounts(counts, c.counts)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	hashes = hashes[p.Customers+1:]
+
+	report := &Report{}
+	for i := 0; i < p.Tenants; i++ {
+		owner := customers[i]
+		tenant := &types.Tenant{
+			TenantID:   gen.uuid(),
+			Namespace:  *owner.namespace,
+			SchemaName: utils.TenantSchemaName(*owner.namespace),
+			OwnerID:    owner.id,
+			Status:     types.TenantActive,
+			Isolation:  types.IsolationSchema,
+			CreatedAt:  lmsPurchaseDate(purchases, owner.id),
+		}
+		tenant.UpdatedAt = tenant.CreatedAt
+
+		loaded, err := g.tenant(ctx, gen, p, tenant, hashes[:usersPerTenant])
+		if err != nil {
+			return nil, fmt.Errorf("tenant %s: %w", tenant.Namespace, err)
+		}
+		hashes = hashes[usersPerTenant:]
+		mergeCounts(counts, loaded)
+		report.Tenants = append(report.Tenants, tenant.Namespace)
+		g.log.WithField("namespace", tenant.Namespace).Info("Generated tenant")
+	}
+
+	for table, rows := range counts {
+		report.Tables = append(report.Tables, TableCount{Table: table, Rows: rows})
+	}
+	sort.Slice(report.Tables, func(i, j int) bool { return report.Tables[i].Table < report.Tables[j].Table })
+	return report, nil
+}
+
+func (g *Generator) activeSystems(p *Profile) ([]string, error) {
+	var systems []string
+	err := g.db.Model(&types.SystemCatalog{}).
+		Where("status = ?", types.SystemActive).
+		Order("code").
+		Pluck("code", &systems).Error
+	if err != nil {
+		return nil, err
+	}
+	if p.Tenants > 0 && !slices.Contains(systems, string(types.LMS)) {
+		return nil, ErrNoLMS
+	}
+	return systems, nil
+}
+
+// customers draws the customers in order. The first p.Tenants become tenant
+// owners, so they are verified and carry their tenant's namespace.
+func (g *Generator) customers(gen *generator, p *Profile) []customer {
+	customers := make([]customer, p.Customers)
+	for i := range customers {
+		first, last := gen.name()
+		cu := customer{
+			id:        gen.uuid(),
+			name:      first + " " + last,
+			email:     fmt.Sprintf("%s.%s.%d@%s", strings.ToLower(first), strings.ToLower(last), i+1, p.EmailDomain),
+			verified:  gen.chance(p.VerifiedRate),
+			createdAt: gen.between(gen.start, gen.end),
+		}
+		if i < p.Tenants {
+			ns := p.Namespace(i + 1)
+			cu.verified = true
+			cu.namespace = &ns
+		}
+		customers[i] = cu
+	}
+	return customers
+}
+
+// purchases gives tenant owners the LMS, attached to their tenant, and every
+// other customer each system with the profile's purchase rate.
+func (g *Generator) purchases(gen *generator, p *Profile, customers []customer, systems []string) []purchase {
+	var purchases []purchase
+	for i, cu := range customers {
+		for _, system := range systems {
+			owner := i < p.Tenants && system == string(types.LMS)
+			if !owner && !gen.chance(p.PurchaseRate) {
+				continue
+			}
+			pu := purchase{
+				id:         gen.uuid(),
+				customerID: cu.id,
+				system:     system,
+				date:       gen.after(cu.createdAt, 90*24*time.Hour),
+			}
+			if owner {
+				pu.namespace = cu.namespace
+			}
+			purchases = append(purchases, pu)
+		}
+	}
+	return purchases
+}
+
+// checkFresh refuses to run twice with the same profile and seed, which would
+// collide on unique emails and namespaces halfway through.
+func (g *Generator) checkFresh(p *Profile, adminEmail string, customers []customer) error {
+	emails := []string{adminEmail}
+	if len(customers) > 0 {
+		emails = append(emails, customers[0].email)
+	}
+	var count int64
+	if err := g.db.Model(&types.CMSUser{}).Where("cms_user_email IN ?", emails).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrAlreadySeeded
+	}
+	for i := 1; i <= p.Tenants; i++ {
+		_, err := g.tenants.GetTenantByNamespace(p.Namespace(i))
+		if err == nil {
+			return fmt.Errorf("%w: tenant %s exists", ErrAlreadySeeded, p.Namespace(i))
+		}
+		if !errors.Is(err, repository.ErrTenantNotFound) {
+			return err
+		}
+	}
+	return nil
+}
+
+// hashPasswords hashes password n times, each with its own salt, spreading
+// the work over every CPU.
+func hashPasswords(ctx context.Context, password string, n, cost int) ([]string, error) {
+	hashes := make([]string, n)
+	next := make(chan int)
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+	)
+	for w := 0; w < runtime.NumCPU(); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				hash, err := bcrypt.GenerateFromPassword([]byte(password), cost)
+				if err != nil {
+					mu.Lock()
+					if firstErr == nil {
+						firstErr = err
+					}
+					mu.Unlock()
+					continue
+				}
+				hashes[i] = string(hash)
+			}
+		}()
+	}
+
+	var err error
+feed:
+	for i := 0; i < n; i++ {
+		select {
+		case next <- i:
+		case <-ctx.Done():
+			err = ctx.Err()
+			break feed
+		}
+	}
+	close(next)
+	wg.Wait()
+
+	if err != nil {
+		return nil, err
+	}
+	return hashes, firstErr
+}
+
+func lmsPurchaseDate(purchases []purchase, customerID uuid.UUID) time.Time {
+	for _, pu := range purchases {
+		if pu.customerID == customerID && pu.system == string(types.LMS) {
+			return pu.date
+		}
+	}
+	return time.Time{}
+}
+
+func mergeCounts(into, from map[string]int) {
+	for table, rows := range from {
+		into[table] += rows
+	}
+}
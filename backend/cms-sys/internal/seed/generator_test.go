@@ -0,0 +1,126 @@
+package seed
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/isolation"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/migration"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/repository"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/service"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/types"
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/events"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// testDB connects to the database named by TEST_DATABASE_DSN. The generator
+// commits through its own connection, so tests clean up after themselves.
+func testDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_DSN is not set")
+	}
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	if !db.Migrator().HasTable(&types.Tenant{}) {
+		t.Skip("TEST_DATABASE_DSN has no CMS schema; run cmsctl migrate up")
+	}
+	return db
+}
+
+func TestGeneratedOwnersAreEntitled(t *testing.T) {
+	db := testDB(t)
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+
+	for _, role := range []types.RoleType{types.RootAdmin, types.CMSCustomer} {
+		if err := db.Exec(`INSERT INTO cms_whole_sys_role (role_name) VALUES (?) ON CONFLICT DO NOTHING`, string(role)).Error; err != nil {
+			t.Fatalf("seed roles: %v", err)
+		}
+	}
+	if _, err := repository.NewCatalogRepo(log, db).SeedSystems(types.BuiltinSystems()); err != nil {
+		t.Fatalf("seed catalog: %v", err)
+	}
+
+	tenantMigrations, err := migration.TenantMigrations()
+	if err != nil {
+		t.Fatalf("tenant migrations: %v", err)
+	}
+	runner, err := migration.NewRunner(db, log, tenantMigrations)
+	if err != nil {
+		t.Fatalf("runner: %v", err)
+	}
+	schemas := isolation.NewSchemaStrategy(db, runner)
+	selector, err := isolation.NewSelector(types.IsolationSchema, schemas)
+	if err != nil {
+		t.Fatalf("selector: %v", err)
+	}
+
+	run := time.Now().UnixNano()
+	p := defaultProfile()
+	p.Seed = uint64(run)
+	p.Months = 1
+	p.BcryptCost = bcrypt.MinCost
+	p.EmailDomain = fmt.Sprintf("gen%x.test", run)
+	p.Customers = 3
+	p.PurchaseRate = 1
+	p.Tenants = 1
+	p.NamespacePrefix = fmt.Sprintf("gen%x", run)
+	if err := p.Validate(); err != nil {
+		t.Fatalf("profile: %v", err)
+	}
+
+	tenants := repository.NewTenantRepo(log, db)
+	t.Cleanup(func() {
+		if tenant, err := tenants.GetTenantByNamespace(p.Namespace(1)); err == nil {
+			schemas.Drop(context.Background(), tenant)
+			db.Where("tenant_id = ?", tenant.TenantID).Delete(&types.Tenant{})
+		}
+		users := db.Model(&types.CMSUser{}).Select("cms_user_id").Where("cms_user_email LIKE ?", "%@"+p.EmailDomain)
+		db.Where("cms_cus_id IN (?)", users).Delete(&types.CMSCusPurchase{})
+		db.Where("cms_user_email LIKE ?", "%@"+p.EmailDomain).Delete(&types.CMSUser{})
+	})
+
+	if _, err := NewGenerator(log, db, selector, tenants).Run(context.Background(), p, "password"); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+
+	tenant, err := tenants.GetTenantByNamespace(p.Namespace(1))
+	if err != nil {
+		t.Fatalf("load tenant: %v", err)
+	}
+	bus := events.NewInProcessBus(log)
+	catalog := service.NewCatalogService(log, service.CatalogDeps{
+		Repo:  repository.NewCatalogRepo(log, db),
+		Audit: repository.NewAuditRepo(log, db),
+		Bus:   bus,
+	}, service.CatalogConfig{})
+	entitlements := service.NewEntitlementService(log, service.EntitlementDeps{
+		Catalog:       catalog,
+		Purchases:     repository.NewPurchaseRepo(log, db),
+		Subscriptions: repository.NewSubscriptionRepo(log, db),
+		Bus:           bus,
+	}, service.EntitlementConfig{})
+
+	entitlement, err := entitlements.Entitlement(tenant.OwnerID, types.LMS)
+	if err != nil {
+		t.Fatalf("entitlement: %v", err)
+	}
+	if !entitlement.Entitled {
+		t.Fatalf("tenant owner is not entitled to the LMS: %+v", entitlement)
+	}
+	if entitlement.Namespace == nil || *entitlement.Namespace != tenant.Namespace {
+		t.Fatalf("LMS purchase is not attached to %s: %+v", tenant.Namespace, entitlement)
+	}
+}
@@ -0,0 +1,188 @@
+package seed
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/utils"
+	"golang.org/x/crypto/bcrypt"
+)
+
+//go:embed profiles/*.json
+var builtinProfiles embed.FS
+
+var ErrInvalidProfile = errors.New("invalid seed profile")
+
+const profileDateLayout = "2006-01-02"
+
+// Profile sets the volumes the generator produces. The same profile and Seed
+// always produce the same rows; only the bcrypt salts differ between runs.
+type Profile struct {
+	Seed uint64 `json:"seed"`
+	// Start and Months bound every generated timestamp, so the data does not
+	// depend on the day it is generated.
+	Start  string `json:"start"`
+	Months int    `json:"months"`
+	// BcryptCost trades hashing time for realism; every cost produces a hash
+	// the login endpoints accept.
+	BcryptCost  int    `json:"bcrypt_cost"`
+	BatchSize   int    `json:"batch_size"`
+	EmailDomain string `json:"email_domain"`
+
+	Customers    int     `json:"customers"`
+	VerifiedRate float64 `json:"verified_rate"`
+	// PurchaseRate is the share of customers who buy each active system.
+	PurchaseRate float64 `json:"purchase_rate"`
+
+	// Tenants are owned by the first customers, who always buy the LMS.
+	Tenants         int           `json:"tenants"`
+	NamespacePrefix string        `json:"namespace_prefix"`
+	Tenant          TenantProfile `json:"tenant"`
+}
+
+// TenantProfile sets the LMS volumes of every generated tenant.
+type TenantProfile struct {
+	Instructors           int     `json:"instructors"`
+	Students              int     `json:"students"`
+	Categories            int     `json:"categories"`
+	Courses               int     `json:"courses"`
+	ModulesPerCourse      int     `json:"modules_per_course"`
+	LessonsPerModule      int     `json:"lessons_per_module"`
+	QuizzesPerModule      int     `json:"quizzes_per_module"`
+	AssignmentsPerCourse  int     `json:"assignments_per_course"`
+	EnrollmentsPerStudent int     `json:"enrollments_per_student"`
+	QuizAttemptRate       float64 `json:"quiz_attempt_rate"`
+	MaxQuizAttempts       int     `json:"max_quiz_attempts"`
+	SubmissionRate        float64 `json:"submission_rate"`
+	RatingRate            float64 `json:"rating_rate"`
+}
+
+// BuiltinProfiles lists the profiles LoadProfile resolves by name.
+func BuiltinProfiles() []string {
+	entries, err := fs.ReadDir(builtinProfiles, "profiles")
+	if err != nil {
+		return nil
+	}
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		names = append(names, strings.TrimSuffix(entry.Name(), ".json"))
+	}
+	return names
+}
+
+// LoadProfile reads a built-in profile by name or a profile file by path.
+func LoadProfile(nameOrPath string) (*Profile, error) {
+	body, err := builtinProfiles.ReadFile(path.Join("profiles", nameOrPath+".json"))
+	if err != nil {
+		if body, err = os.ReadFile(nameOrPath); err != nil {
+			return nil, err
+		}
+	}
+
+	profile := defaultProfile()
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(profile); err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrInvalidProfile, nameOrPath, err)
+	}
+	if err := profile.Validate(); err != nil {
+		return nil, err
+	}
+	return profile, nil
+}
+
+func defaultProfile() *Profile {
+	return &Profile{
+		Seed:            1,
+		Start:           "2025-01-01",
+		Months:          12,
+		BcryptCost:      bcrypt.DefaultCost,
+		BatchSize:       1000,
+		EmailDomain:     "example.test",
+		VerifiedRate:    0.85,
+		PurchaseRate:    0.4,
+		NamespacePrefix: "seed",
+		Tenant: TenantProfile{
+			MaxQuizAttempts: 3,
+		},
+	}
+}
+
+func (p *Profile) StartTime() time.Time {
+	start, _ := time.Parse(profileDateLayout, p.Start)
+	return start.UTC()
+}
+
+// Namespace is the namespace of the i-th generated tenant, counting from 1.
+func (p *Profile) Namespace(i int) string {
+	return fmt.Sprintf("%s_%d", p.NamespacePrefix, i)
+}
+
+func (p *Profile) Validate() error {
+	invalid := func(format string, args ...interface{}) error {
+		return fmt.Errorf("%w: %s", ErrInvalidProfile, fmt.Sprintf(format, args...))
+	}
+
+	if _, err := time.Parse(profileDateLayout, p.Start); err != nil {
+		return invalid("start must be YYYY-MM-DD")
+	}
+	if p.Months < 1 {
+		return invalid("months must be at least 1")
+	}
+	if p.BcryptCost < bcrypt.MinCost || p.BcryptCost > bcrypt.MaxCost {
+		return invalid("bcrypt_cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+	}
+	if p.BatchSize < 1 {
+		return invalid("batch_size must be at least 1")
+	}
+	if p.EmailDomain == "" || strings.ContainsAny(p.EmailDomain, "@ ") {
+		return invalid("email_domain must be a bare domain")
+	}
+	if p.Customers < 0 || p.Tenants < 0 {
+		return invalid("customers and tenants cannot be negative")
+	}
+	if p.Tenants > p.Customers {
+		return invalid("every tenant needs its own customer, so tenants cannot exceed customers")
+	}
+	if p.Tenants > 0 {
+		if ns, err := utils.NormalizeNamespace(p.Namespace(p.Tenants)); err != nil || ns != p.Namespace(p.Tenants) {
+			return invalid("namespace_prefix must be lower case letters, digits and underscores")
+		}
+	}
+	for name, rate := range map[string]float64{
+		"verified_rate":     p.VerifiedRate,
+		"purchase_rate":     p.PurchaseRate,
+		"quiz_attempt_rate": p.Tenant.QuizAttemptRate,
+		"submission_rate":   p.Tenant.SubmissionRate,
+		"rating_rate":       p.Tenant.RatingRate,
+	} {
+		if rate < 0 || rate > 1 {
+			return invalid("%s must be between 0 and 1", name)
+		}
+	}
+
+	t := p.Tenant
+	if t.Instructors < 0 || t.Students < 0 || t.Categories < 0 || t.Courses < 0 ||
+		t.ModulesPerCourse < 0 || t.LessonsPerModule < 0 || t.QuizzesPerModule < 0 ||
+		t.AssignmentsPerCourse < 0 || t.EnrollmentsPerStudent < 0 {
+		return invalid("tenant volumes cannot be negative")
+	}
+	if t.Courses > 0 && (t.Instructors == 0 || t.Categories == 0) {
+		return invalid("courses need at least one instructor and one category")
+	}
+	if t.EnrollmentsPerStudent > t.Courses {
+		return invalid("enrollments_per_student cannot exceed courses")
+	}
+	if t.MaxQuizAttempts < 1 {
+		return invalid("max_quiz_attempts must be at least 1")
+	}
+	return nil
+}
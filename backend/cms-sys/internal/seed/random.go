@@ -0,0 +1,105 @@
+package seed
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	firstNames = []string{
+		"Aung", "Hnin", "Kyaw", "Thida", "Min", "Su", "Zaw", "Ei", "James", "Maria",
+		"Chen", "Aisha", "Lucas", "Sofia", "Kenji", "Amara", "Noah", "Priya", "Omar", "Lena",
+	}
+	lastNames = []string{
+		"Htet", "Win", "Oo", "Naing", "Soe", "Lwin", "Smith", "Garcia", "Wang", "Khan",
+		"Silva", "Rossi", "Tanaka", "Okafor", "Miller", "Patel", "Haddad", "Novak", "Kim", "Berg",
+	}
+	subjects = []string{
+		"Go", "Databases", "Statistics", "Design", "Accounting", "Marketing", "Biology",
+		"Chemistry", "History", "Writing", "Networking", "Security", "Algebra", "Physics",
+	}
+	courseLevels = []string{"Introduction to", "Practical", "Advanced", "Applied", "Foundations of"}
+	categories   = []string{
+		"Programming", "Data", "Business", "Science", "Humanities", "Languages",
+		"Mathematics", "Engineering", "Design", "Health", "Finance", "Operations",
+	}
+	materialTypes = []string{"Video", "PDF", "Slide", "Link"}
+)
+
+// generator draws every value from one seeded stream, so the rows depend on
+// nothing but the profile and the order they are drawn in.
+type generator struct {
+	rng   *rand.Rand
+	start time.Time
+	end   time.Time
+}
+
+func newGenerator(p *Profile) *generator {
+	var seed [32]byte
+	binary.LittleEndian.PutUint64(seed[:], p.Seed)
+	start := p.StartTime()
+	return &generator{
+		rng:   rand.New(rand.NewChaCha8(seed)),
+		start: start,
+		end:   start.AddDate(0, p.Months, 0),
+	}
+}
+
+// uuid is a version 4 UUID made from the seeded stream.
+func (g *generator) uuid() uuid.UUID {
+	var id uuid.UUID
+	binary.LittleEndian.PutUint64(id[:8], g.rng.Uint64())
+	binary.LittleEndian.PutUint64(id[8:], g.rng.Uint64())
+	id[6] = (id[6] & 0x0f) | 0x40
+	id[8] = (id[8] & 0x3f) | 0x80
+	return id
+}
+
+func (g *generator) chance(rate float64) bool {
+	return g.rng.Float64() < rate
+}
+
+func (g *generator) intn(n int) int {
+	return g.rng.IntN(n)
+}
+
+// between returns a time in [from, to), truncated to the second. A range
+// that is empty or inverted yields from.
+func (g *generator) between(from, to time.Time) time.Time {
+	span := to.Sub(from)
+	if span <= time.Second {
+		return from
+	}
+	return from.Add(time.Duration(g.rng.Int64N(int64(span)))).Truncate(time.Second)
+}
+
+// after returns a time up to within after from, but never past the end of
+// the profile's range.
+func (g *generator) after(from time.Time, within time.Duration) time.Time {
+	to := from.Add(within)
+	if to.After(g.end) {
+		to = g.end
+	}
+	return g.between(from, to)
+}
+
+func (g *generator) name() (string, string) {
+	return firstNames[g.intn(len(firstNames))], lastNames[g.intn(len(lastNames))]
+}
+
+func (g *generator) courseTitle(i int) string {
+	return fmt.Sprintf("%s %s %d", courseLevels[g.intn(len(courseLevels))], subjects[g.intn(len(subjects))], i)
+}
+
+func (g *generator) phone() string {
+	return fmt.Sprintf("+95 9 %03d %04d", g.intn(1000), g.intn(10000))
+}
+
+// pick returns k distinct indexes below n in random order.
+func (g *generator) pick(n, k int) []int {
+	return g.rng.Perm(n)[:k]
+}
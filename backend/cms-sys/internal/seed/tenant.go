@@ -0,0 +1,375 @@
+package seed
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/types"
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/utils"
+	"gorm.io/gorm"
+)
+
+const day = 24 * time.Hour
+
+type lmsUser struct {
+	id        uuid.UUID
+	createdAt time.Time
+}
+
+type course struct {
+	id          uuid.UUID
+	createdAt   time.Time
+	durationDay int
+	published   bool
+	quizzes     []uuid.UUID
+	assignments []uuid.UUID
+}
+
+type enrollment struct {
+	id        uuid.UUID
+	studentID uuid.UUID
+	course    *course
+	status    string
+	date      time.Time
+}
+
+// tenant provisions a dedicated schema the way tenant creation does, loads
+// the tenant's LMS data into it and only then registers the tenant.
+func (g *Generator) tenant(ctx context.Context, gen *generator, p *Profile, tenant *types.Tenant, hashes []string) (map[string]int, error) {
+	strategy, err := g.isolation.Mode(tenant.Isolation)
+	if err != nil {
+		return nil, err
+	}
+	if err := strategy.Provision(ctx, tenant); err != nil {
+		return nil, err
+	}
+
+	counts, err := g.loadTenant(ctx, gen, p, tenant, hashes)
+	if err == nil {
+		err = g.tenants.CreateTenant(tenant)
+	}
+	if err != nil {
+		if dropErr := strategy.Drop(ctx, tenant); dropErr != nil {
+			g.log.WithError(dropErr).WithField("namespace", tenant.Namespace).Error("Failed to drop tenant data")
+		}
+		return nil, err
+	}
+	return counts, nil
+}
+
+func (g *Generator) loadTenant(ctx context.Context, gen *generator, p *Profile, tenant *types.Tenant, hashes []string) (map[string]int, error) {
+	// The LMS tables reference their own Tenants row; the roles come from the
+	// tenant migrations.
+	err := g.isolation.WithTenant(ctx, g.db, tenant, func(tx *gorm.DB) error {
+		return tx.Exec(
+			"INSERT INTO Tenants (tenant_id, namespace, cms_owner_id, is_active, created_at) VALUES (?, ?, ?, TRUE, ?)",
+			tenant.TenantID, tenant.Namespace, tenant.OwnerID, tenant.CreatedAt,
+		).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	roles, err := g.lmsRoles(tenant.SchemaName)
+	if err != nil {
+		return nil, err
+	}
+
+	schema := tenant.SchemaName
+	tp := p.Tenant
+	host := strings.ReplaceAll(tenant.Namespace, "_", "-") + "." + p.EmailDomain
+	var counts map[string]int
+
+	err = copyTx(ctx, g.db, p.BatchSize, func(c *copier) error {
+		// Students get their namespace_consumer row from the insert trigger,
+		// and the membership trigger rejects them, so only staff are members.
+		users := c.table(schema, "lms_user",
+			"lms_user_id", "lms_user_email", "password", "lms_role_id", "tenant_id",
+			"phone_number", "registration_date", "created_at", "updated_at")
+		members := c.table(schema, "tenants_members", "tm_id", "lms_user_id", "tenant_id", "joined_date", "is_active")
+
+		newUser := func(email, role string, hash string) (lmsUser, error) {
+			u := lmsUser{id: gen.uuid(), createdAt: gen.between(tenant.CreatedAt, gen.end)}
+			err := users.row(u.id, email, hash, roles[role], tenant.TenantID,
+				gen.phone(), u.createdAt.Format(profileDateLayout), u.createdAt, u.createdAt)
+			return u, err
+		}
+
+		admin, err := newUser("admin@"+host, "LMS_ADMIN", hashes[0])
+		if err != nil {
+			return err
+		}
+		staff := []lmsUser{admin}
+		instructors := make([]lmsUser, tp.Instructors)
+		for i := range instructors {
+			if instructors[i], err = newUser(fmt.Sprintf("instructor%d@%s", i+1, host), "INSTRUCTOR", hashes[1+i]); err != nil {
+				return err
+			}
+		}
+		staff = append(staff, instructors...)
+		students := make([]lmsUser, tp.Students)
+		for i := range students {
+			if students[i], err = newUser(fmt.Sprintf("student%d@%s", i+1, host), "STUDENT", hashes[1+tp.Instructors+i]); err != nil {
+				return err
+			}
+		}
+		if err := users.flush(); err != nil {
+			return err
+		}
+
+		for _, u := range staff {
+			if err := members.row(gen.uuid(), u.id, tenant.TenantID, u.createdAt, true); err != nil {
+				return err
+			}
+		}
+		if err := members.flush(); err != nil {
+			return err
+		}
+
+		courses, err := g.loadCourses(c, gen, schema, tenant, tp, instructors)
+		if err != nil {
+			return err
+		}
+		enrollments, err := g.loadEnrollments(c, gen, schema, tp, students, courses)
+		if err != nil {
+			return err
+		}
+		if err := g.loadActivity(c, gen, schema, host, tp, enrollments); err != nil {
+			return err
+		}
+
+		counts = c.counts
+		return nil
+	})
+	return counts, err
+}
+
+func (g *Generator) lmsRoles(schema string) (map[string]uuid.UUID, error) {
+	var rows []struct {
+		LmsRoleID   uuid.UUID
+		LmsRoleName string
+	}
+	err := g.db.Raw("SELECT lms_role_id, lms_role_name FROM " + utils.QuoteIdent(schema) + ".lms_user_role").Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	roles := make(map[string]uuid.UUID, len(rows))
+	for _, r := range rows {
+		roles[r.LmsRoleName] = r.LmsRoleID
+	}
+	for _, name := range []string{"LMS_ADMIN", "INSTRUCTOR", "STUDENT"} {
+		if _, ok := roles[name]; !ok {
+			return nil, fmt.Errorf("role %s is missing from %s", name, schema)
+		}
+	}
+	return roles, nil
+}
+
+// loadCourses writes categories, courses and their modules, lessons, quizzes
+// and assignments, each table complete before the tables referencing it.
+func (g *Generator) loadCourses(c *copier, gen *generator, schema string, tenant *types.Tenant, tp TenantProfile, instructors []lmsUser) ([]*course, error) {
+	categoryRows := c.table(schema, "course_category", "category_id", "category_name", "description", "created_at")
+	categoryIDs := make([]uuid.UUID, tp.Categories)
+	for i := range categoryIDs {
+		categoryIDs[i] = gen.uuid()
+		name := categories[i%len(categories)]
+		if i >= len(categories) {
+			name = fmt.Sprintf("%s %d", name, i/len(categories)+1)
+		}
+		if err := categoryRows.row(categoryIDs[i], name, "Courses about "+strings.ToLower(name), tenant.CreatedAt); err != nil {
+			return nil, err
+		}
+	}
+	if err := categoryRows.flush(); err != nil {
+		return nil, err
+	}
+
+	courseRows := c.table(schema, "course",
+		"course_id", "course_title", "description", "instructor_id", "course_category",
+		"status", "duration_day_count", "created_at", "owned_by")
+	courses := make([]*course, tp.Courses)
+	for i := range courses {
+		instructor := instructors[gen.intn(len(instructors))]
+		co := &course{
+			id:          gen.uuid(),
+			createdAt:   gen.after(instructor.createdAt, 60*day),
+			durationDay: 14 + 7*gen.intn(9),
+		}
+		status := "Published"
+		if !gen.chance(0.85) {
+			status = []string{"Pending", "Unpublished", "Archived"}[gen.intn(3)]
+		}
+		co.published = status == "Published"
+		title := gen.courseTitle(i + 1)
+		err := courseRows.row(co.id, title, "A course on "+strings.ToLower(title), instructor.id,
+			categoryIDs[gen.intn(len(categoryIDs))], status, co.durationDay, co.createdAt, tenant.TenantID)
+		if err != nil {
+			return nil, err
+		}
+		courses[i] = co
+	}
+	if err := courseRows.flush(); err != nil {
+		return nil, err
+	}
+
+	moduleRows := c.table(schema, "module", "module_id", "module_name", "course_id", "description", "created_at")
+	type module struct {
+		id     uuid.UUID
+		course *course
+	}
+	var modules []module
+	for _, co := range courses {
+		for m := 0; m < tp.ModulesPerCourse; m++ {
+			mod := module{id: gen.uuid(), course: co}
+			if err := moduleRows.row(mod.id, fmt.Sprintf("Module %d", m+1), co.id, nil, co.createdAt); err != nil {
+				return nil, err
+			}
+			modules = append(modules, mod)
+		}
+	}
+	if err := moduleRows.flush(); err != nil {
+		return nil, err
+	}
+
+	lessonRows := c.table(schema, "lesson", "lesson_id", "title", "content", "material_type", "module_id", "created_at")
+	quizRows := c.table(schema, "quiz", "quiz_id", "question", "answer", "module_id", "created_at")
+	for _, mod := range modules {
+		for l := 0; l < tp.LessonsPerModule; l++ {
+			err := lessonRows.row(gen.uuid(), fmt.Sprintf("Lesson %d", l+1), "Lesson content.",
+				materialTypes[gen.intn(len(materialTypes))], mod.id, mod.course.createdAt)
+			if err != nil {
+				return nil, err
+			}
+		}
+		for q := 0; q < tp.QuizzesPerModule; q++ {
+			id := gen.uuid()
+			a, b := 1+gen.intn(50), 1+gen.intn(50)
+			err := quizRows.row(id, fmt.Sprintf("What is %d + %d?", a, b), fmt.Sprint(a+b), mod.id, mod.course.createdAt)
+			if err != nil {
+				return nil, err
+			}
+			mod.course.quizzes = append(mod.course.quizzes, id)
+		}
+	}
+	if err := lessonRows.flush(); err != nil {
+		return nil, err
+	}
+	if err := quizRows.flush(); err != nil {
+		return nil, err
+	}
+
+	assignmentRows := c.table(schema, "assignment", "assignment_id", "course_id", "title", "instructions", "created_at")
+	for _, co := range courses {
+		for a := 0; a < tp.AssignmentsPerCourse; a++ {
+			id := gen.uuid()
+			if err := assignmentRows.row(id, co.id, fmt.Sprintf("Assignment %d", a+1), "Upload your work as a PDF.", co.createdAt); err != nil {
+				return nil, err
+			}
+			co.assignments = append(co.assignments, id)
+		}
+	}
+	return courses, assignmentRows.flush()
+}
+
+// loadEnrollments enrolls every student in distinct published courses, no
+// earlier than both the student and the course exist.
+func (g *Generator) loadEnrollments(c *copier, gen *generator, schema string, tp TenantProfile, students []lmsUser, courses []*course) ([]enrollment, error) {
+	var published []*course
+	for _, co := range courses {
+		if co.published {
+			published = append(published, co)
+		}
+	}
+	perStudent := min(tp.EnrollmentsPerStudent, len(published))
+
+	rows := c.table(schema, "enrollment",
+		"enrollment_id", "student_id", "course_id", "enrollment_date", "progress", "status", "due_date", "created_at")
+	var enrollments []enrollment
+	for _, student := range students {
+		for _, idx := range gen.pick(len(published), perStudent) {
+			co := published[idx]
+			from := student.createdAt
+			if co.createdAt.After(from) {
+				from = co.createdAt
+			}
+			e := enrollment{id: gen.uuid(), studentID: student.id, course: co, date: gen.after(from, 30*day)}
+
+			var progress float64
+			switch roll := gen.rng.Float64(); {
+			case roll < 0.3:
+				e.status, progress = "COMPLETED", 100
+			case roll < 0.4:
+				e.status, progress = "DROPPED", float64(gen.intn(50))
+			default:
+				e.status, progress = "ENROLLED", float64(gen.intn(100))
+			}
+			due := e.date.Add(time.Duration(co.durationDay) * day)
+			if err := rows.row(e.id, e.studentID, co.id, e.date, progress, e.status, due, e.date); err != nil {
+				return nil, err
+			}
+			enrollments = append(enrollments, e)
+		}
+	}
+	return enrollments, rows.flush()
+}
+
+// loadActivity writes what students did in their courses: certificates and
+// ratings for completed enrollments, quiz attempts and submissions.
+func (g *Generator) loadActivity(c *copier, gen *generator, schema, host string, tp TenantProfile, enrollments []enrollment) error {
+	certificates := c.table(schema, "certificate", "certificate_id", "enrollment_id", "issue_date", "certificate_url", "created_at")
+	ratings := c.table(schema, "rating", "rating_id", "user_id", "course_id", "rating_count", "created_at")
+	attempts := c.table(schema, "student_quiz", "student_quiz_id", "student_id", "quiz_id", "score", "attempt", "created_at")
+	submissions := c.table(schema, "submission", "submission_id", "assignment_id", "student_id", "submitted_at", "file_url", "created_at")
+
+	for _, e := range enrollments {
+		within := time.Duration(e.course.durationDay) * day
+
+		if e.status == "COMPLETED" {
+			id := gen.uuid()
+			issued := gen.after(e.date, within)
+			if err := certificates.row(id, e.id, issued, fmt.Sprintf("https://%s/certificates/%s", host, id), issued); err != nil {
+				return err
+			}
+			if gen.chance(tp.RatingRate) {
+				// Most ratings are favourable.
+				stars := 5 - min(gen.intn(5), gen.intn(5))
+				if err := ratings.row(gen.uuid(), e.studentID, e.course.id, stars, issued); err != nil {
+					return err
+				}
+			}
+		}
+
+		for _, quiz := range e.course.quizzes {
+			if !gen.chance(tp.QuizAttemptRate) {
+				continue
+			}
+			taken, tries := e.date, 1+gen.intn(tp.MaxQuizAttempts)
+			for n := 1; n <= tries; n++ {
+				taken = gen.after(taken, within/2)
+				if err := attempts.row(gen.uuid(), e.studentID, quiz, gen.intn(101), n, taken); err != nil {
+					return err
+				}
+			}
+		}
+
+		for _, assignment := range e.course.assignments {
+			if !gen.chance(tp.SubmissionRate) {
+				continue
+			}
+			id := gen.uuid()
+			at := gen.after(e.date, within)
+			if err := submissions.row(id, assignment, e.studentID, at, fmt.Sprintf("https://%s/submissions/%s.pdf", host, id), at); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, t := range []*copyTable{certificates, ratings, attempts, submissions} {
+		if err := t.flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
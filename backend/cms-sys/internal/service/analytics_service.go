@@ -0,0 +1,315 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/isolation"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/repository"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/types"
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/storage"
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/utils"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	ErrInvalidMetric = errors.New("unknown analytics metric")
+	ErrInvalidRange  = errors.New("invalid date range")
+)
+
+// AnalyticsService snapshots every tenant's data once a day and answers
+// platform-wide questions from the snapshots, so reports never query tenant
+// schemas directly.
+type AnalyticsService interface {
+	Collect(ctx context.Context) (*types.AnalyticsCollectReport, error)
+	Summary(from, to time.Time) (*types.AnalyticsSummary, error)
+	Series(metric types.PlatformMetricName, namespace string, from, to time.Time) (*types.AnalyticsSeries, error)
+	Tenants(day time.Time) ([]types.TenantAnalytics, error)
+}
+
+type AnalyticsConfig struct {
+	// Concurrency bounds how many tenants are measured at once.
+	Concurrency int
+	// ActiveWindow is how far back activity makes a user count as active.
+	ActiveWindow time.Duration
+	// Retention is how long daily snapshots are kept; zero keeps them forever.
+	Retention time.Duration
+	// MaxRange caps the number of days a query may span.
+	MaxRange int
+}
+
+type AnalyticsDeps struct {
+	Repo      repository.AnalyticsRepository
+	Tenants   repository.TenantRepository
+	DB        *gorm.DB
+	Isolation *isolation.Selector
+	Files     storage.TenantFiles
+}
+
+type AnalyticsSvc struct {
+	log       *logrus.Logger
+	repo      repository.AnalyticsRepository
+	tenants   repository.TenantRepository
+	db        *gorm.DB
+	isolation *isolation.Selector
+	files     storage.TenantFiles
+	cfg       AnalyticsConfig
+}
+
+var _ AnalyticsService = (*AnalyticsSvc)(nil)
+
+func NewAnalyticsService(log *logrus.Logger, deps AnalyticsDeps, cfg AnalyticsConfig) *AnalyticsSvc {
+	return &AnalyticsSvc{
+		log:       log,
+		repo:      deps.Repo,
+		tenants:   deps.Tenants,
+		db:        deps.DB,
+		isolation: deps.Isolation,
+		files:     deps.Files,
+		cfg:       cfg,
+	}
+}
+
+// Collect measures every live tenant and stores today's snapshot. Tenants are
+// measured in parallel; one failing tenant is reported and skipped.
+func (s *AnalyticsSvc) Collect(ctx context.Context) (*types.AnalyticsCollectReport, error) {
+	all, err := s.tenants.ListTenants()
+	if err != nil {
+		return nil, errors.New("failed to list tenants")
+	}
+	tenants := make([]types.Tenant, 0, len(all))
+	for _, tenant := range all {
+		if tenant.Status != types.TenantPurged {
+			tenants = append(tenants, tenant)
+		}
+	}
+
+	now := time.Now().UTC()
+	report := &types.AnalyticsCollectReport{Day: analyticsDay(now)}
+	var mu sync.Mutex
+	utils.RunBounded(ctx, len(tenants), s.cfg.Concurrency, func(ctx context.Context, i int) {
+		tenant := &tenants[i]
+		err := ctx.Err()
+		if err == nil {
+			err = s.collectTenant(ctx, tenant, report.Day, now)
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			s.log.WithError(err).WithField("namespace", tenant.Namespace).Warn("Failed to collect tenant analytics")
+			report.Failed = append(report.Failed, tenant.Namespace)
+			return
+		}
+		report.Collected++
+	})
+	sort.Strings(report.Failed)
+
+	if s.cfg.Retention > 0 {
+		if _, err := s.repo.DeleteBefore(analyticsDay(now.Add(-s.cfg.Retention))); err != nil {
+			s.log.WithError(err).Warn("Failed to prune platform metrics")
+		}
+	}
+	return report, nil
+}
+
+func (s *AnalyticsSvc) collectTenant(ctx context.Context, tenant *types.Tenant, day, now time.Time) error {
+	since := now.Add(-s.cfg.ActiveWindow)
+	counts := map[types.PlatformMetricName]string{
+		types.AnalyticsUsers:       "SELECT count(*) FROM lms_user",
+		types.AnalyticsCourses:     "SELECT count(*) FROM course",
+		types.AnalyticsEnrollments: "SELECT count(*) FROM enrollment",
+	}
+
+	values := make(map[types.PlatformMetricName]int64, len(types.CollectedMetrics))
+	err := s.isolation.WithTenant(ctx, s.db, tenant, func(tx *gorm.DB) error {
+		for metric, query := range counts {
+			var n int64
+			if err := tx.Raw(query).Scan(&n).Error; err != nil {
+				return fmt.Errorf("failed to count %s: %w", metric, err)
+			}
+			values[metric] = n
+		}
+
+		// The LMS records no logins, so a user is active when they enrolled,
+		// progressed, took a quiz or submitted work within the window.
+		var active int64
+		err := tx.Raw(`SELECT count(*) FROM (
+			SELECT student_id FROM enrollment WHERE COALESCE(updated_at, created_at) >= ?
+			UNION SELECT student_id FROM student_quiz WHERE COALESCE(updated_at, created_at) >= ?
+			UNION SELECT student_id FROM submission WHERE submitted_at >= ?
+		) active`, since, since, since).Scan(&active).Error
+		if err != nil {
+			return fmt.Errorf("failed to count %s: %w", types.AnalyticsActiveUsers, err)
+		}
+		values[types.AnalyticsActiveUsers] = active
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	files, err := s.files.Usage(tenant.Namespace)
+	if err != nil {
+		return fmt.Errorf("failed to measure storage: %w", err)
+	}
+	values[types.AnalyticsStorageBytes] = files.Bytes
+
+	metrics := make([]types.PlatformMetric, 0, len(values))
+	for _, metric := range types.CollectedMetrics {
+		metrics = append(metrics, types.PlatformMetric{
+			Day:         day,
+			Namespace:   tenant.Namespace,
+			Metric:      string(metric),
+			Value:       values[metric],
+			CollectedAt: now,
+		})
+	}
+	return s.repo.SaveMetrics(metrics)
+}
+
+// Summary reports the platform totals at the first and the last snapshot in
+// the range and how much each metric grew in between.
+func (s *AnalyticsSvc) Summary(from, to time.Time) (*types.AnalyticsSummary, error) {
+	from, to, err := s.checkRange(from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	summary := &types.AnalyticsSummary{
+		From:    from,
+		To:      to,
+		Start:   make(map[types.PlatformMetricName]int64),
+		End:     make(map[types.PlatformMetricName]int64),
+		Growth:  make(map[types.PlatformMetricName]int64),
+		Percent: make(map[types.PlatformMetricName]*float64),
+	}
+	days, err := s.repo.SnapshotDays(from, to)
+	if err != nil {
+		return nil, errors.New("failed to load analytics")
+	}
+	if len(days) == 0 {
+		return summary, nil
+	}
+
+	first, err := s.totals(days[0])
+	if err != nil {
+		return nil, err
+	}
+	last, err := s.totals(days[len(days)-1])
+	if err != nil {
+		return nil, err
+	}
+	summary.From, summary.To = days[0], days[len(days)-1]
+	for _, metric := range append([]types.PlatformMetricName{types.AnalyticsTenants}, types.CollectedMetrics...) {
+		start, end := first[metric], last[metric]
+		summary.Start[metric] = start
+		summary.End[metric] = end
+		summary.Growth[metric] = end - start
+		if start > 0 {
+			percent := float64(end-start) / float64(start) * 100
+			summary.Percent[metric] = &percent
+		} else {
+			summary.Percent[metric] = nil
+		}
+	}
+	return summary, nil
+}
+
+func (s *AnalyticsSvc) Series(metric types.PlatformMetricName, namespace string, from, to time.Time) (*types.AnalyticsSeries, error) {
+	if !metric.Valid() {
+		return nil, ErrInvalidMetric
+	}
+	from, to, err := s.checkRange(from, to)
+	if err != nil {
+		return nil, err
+	}
+	if namespace != "" {
+		ns, err := utils.NormalizeNamespace(namespace)
+		if err != nil {
+			return nil, ErrUnknownTenant
+		}
+		namespace = ns
+	}
+
+	points, err := s.repo.Series(metric, namespace, from, to)
+	if err != nil {
+		return nil, errors.New("failed to load analytics")
+	}
+	if points == nil {
+		points = []types.AnalyticsPoint{}
+	}
+	return &types.AnalyticsSeries{Metric: metric, Namespace: namespace, Points: points}, nil
+}
+
+// Tenants breaks a day's snapshot down by tenant, largest by users first.
+func (s *AnalyticsSvc) Tenants(day time.Time) ([]types.TenantAnalytics, error) {
+	rows, err := s.repo.Snapshot(analyticsDay(day))
+	if err != nil {
+		return nil, errors.New("failed to load analytics")
+	}
+
+	byTenant := make(map[string]map[types.PlatformMetricName]int64)
+	for _, row := range rows {
+		if byTenant[row.Namespace] == nil {
+			byTenant[row.Namespace] = make(map[types.PlatformMetricName]int64)
+		}
+		byTenant[row.Namespace][types.PlatformMetricName(row.Metric)] = row.Value
+	}
+
+	result := make([]types.TenantAnalytics, 0, len(byTenant))
+	for ns, metrics := range byTenant {
+		result = append(result, types.TenantAnalytics{Namespace: ns, Metrics: metrics})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		ui, uj := result[i].Metrics[types.AnalyticsUsers], result[j].Metrics[types.AnalyticsUsers]
+		if ui != uj {
+			return ui > uj
+		}
+		return result[i].Namespace < result[j].Namespace
+	})
+	return result, nil
+}
+
+func (s *AnalyticsSvc) totals(day time.Time) (map[types.PlatformMetricName]int64, error) {
+	rows, err := s.repo.Snapshot(day)
+	if err != nil {
+		return nil, errors.New("failed to load analytics")
+	}
+	totals := make(map[types.PlatformMetricName]int64)
+	tenants := make(map[string]bool)
+	for _, row := range rows {
+		totals[types.PlatformMetricName(row.Metric)] += row.Value
+		tenants[row.Namespace] = true
+	}
+	totals[types.AnalyticsTenants] = int64(len(tenants))
+	return totals, nil
+}
+
+// checkRange normalises a range to whole days. A zero bound defaults to the
+// last 30 days ending today.
+func (s *AnalyticsSvc) checkRange(from, to time.Time) (time.Time, time.Time, error) {
+	if to.IsZero() {
+		to = time.Now()
+	}
+	if from.IsZero() {
+		from = to.AddDate(0, 0, -30)
+	}
+	from, to = analyticsDay(from), analyticsDay(to)
+	if to.Before(from) {
+		return from, to, ErrInvalidRange
+	}
+	if s.cfg.MaxRange > 0 && to.Sub(from) > time.Duration(s.cfg.MaxRange)*24*time.Hour {
+		return from, to, fmt.Errorf("%w: at most %d days", ErrInvalidRange, s.cfg.MaxRange)
+	}
+	return from, to, nil
+}
+
+func analyticsDay(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
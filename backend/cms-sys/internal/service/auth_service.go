@@ -18,16 +18,20 @@ type AuthService interface {
 }
 
 type Service struct {
-	log  *logrus.Logger
-	repo repository.AuthRepository
+	log          *logrus.Logger
+	repo         repository.AuthRepository
+	tenants      repository.TenantRepository
+	entitlements EntitlementService
 }
 
 var _ AuthService = (*Service)(nil)
 
-func NewService(log *logrus.Logger, repo repository.AuthRepository) *Service {
+func NewService(log *logrus.Logger, repo repository.AuthRepository, tenants repository.TenantRepository, entitlements EntitlementService) *Service {
 	return &Service{
-		log:  log,
-		repo: repo,
+		log:          log,
+		repo:         repo,
+		tenants:      tenants,
+		entitlements: entitlements,
 	}
 }
 
@@ -43,13 +47,17 @@ func (s *Service) Login(email, password string) (*types.AuthResponse, error) {
 		return nil, errors.New("invalid credentials")
 	}
 
-	accessToken, err := utils.GenerateAccessToken(user.CMSUserID, user.CMSUserEmail, user.CMSUserRole)
+	if err := s.checkTenantAccess(user); err != nil {
+		return nil, err
+	}
+
+	accessToken, err := utils.GenerateAccessToken(user.CMSUserID, user.CMSUserEmail, user.CMSUserRole, user.NameSpace(), s.tokenSystems(user))
 	if err != nil {
 		s.log.WithError(err).Error("Failed to generate access token")
 		return nil, errors.New("failed to generate access token")
 	}
 
-	refreshToken, err := utils.GenerateRefreshToken(user.CMSUserID, user.CMSUserEmail, user.CMSUserRole)
+	refreshToken, err := utils.GenerateRefreshToken(user.CMSUserID, user.CMSUserEmail, user.CMSUserRole, user.NameSpace())
 	if err != nil {
 		s.log.WithError(err).Error("Failed to generate refresh token")
 		return nil, errors.New("failed to generate refresh token")
@@ -90,17 +98,12 @@ func (s *Service) Register(req *types.RegisterRequest) (*types.AuthResponse, err
 		return nil, errors.New("failed to process password")
 	}
 
-	role := req.Role
-	if role == "" {
-		role = string(types.CMSCustomer)
-	}
-
 	user := &types.CMSUser{
 		CMSUserID:    uuid.New(),
 		CMSUserName:  req.Name,
 		CMSUserEmail: req.Email,
 		Password:     hashedPassword,
-		CMSUserRole:  role,
+		CMSUserRole:  string(types.CMSCustomer),
 		Verified:     false,
 		CreatedAt:    time.Now(),
 		UpdatedAt:    time.Now(),
@@ -111,13 +114,13 @@ func (s *Service) Register(req *types.RegisterRequest) (*types.AuthResponse, err
 		return nil, errors.New("failed to create user")
 	}
 
-	accessToken, err := utils.GenerateAccessToken(user.CMSUserID, user.CMSUserEmail, user.CMSUserRole)
+	accessToken, err := utils.GenerateAccessToken(user.CMSUserID, user.CMSUserEmail, user.CMSUserRole, user.NameSpace(), s.tokenSystems(user))
 	if err != nil {
 		s.log.WithError(err).Error("Failed to generate access token")
 		return nil, errors.New("failed to generate access token")
 	}
 
-	refreshToken, err := utils.GenerateRefreshToken(user.CMSUserID, user.CMSUserEmail, user.CMSUserRole)
+	refreshToken, err := utils.GenerateRefreshToken(user.CMSUserID, user.CMSUserEmail, user.CMSUserRole, user.NameSpace())
 	if err != nil {
 		s.log.WithError(err).Error("Failed to generate refresh token")
 		return nil, errors.New("failed to generate refresh token")
@@ -158,13 +161,17 @@ func (s *Service) RefreshToken(refreshToken string) (*types.TokenResponse, error
 		return nil, errors.New("user not found")
 	}
 
-	newAccessToken, err := utils.GenerateAccessToken(user.CMSUserID, user.CMSUserEmail, user.CMSUserRole)
+	if err := s.checkTenantAccess(user); err != nil {
+		return nil, err
+	}
+
+	newAccessToken, err := utils.GenerateAccessToken(user.CMSUserID, user.CMSUserEmail, user.CMSUserRole, user.NameSpace(), s.tokenSystems(user))
 	if err != nil {
 		s.log.WithError(err).Error("Failed to generate new access token")
 		return nil, errors.New("failed to generate access token")
 	}
 
-	newRefreshToken, err := utils.GenerateRefreshToken(user.CMSUserID, user.CMSUserEmail, user.CMSUserRole)
+	newRefreshToken, err := utils.GenerateRefreshToken(user.CMSUserID, user.CMSUserEmail, user.CMSUserRole, user.NameSpace())
 	if err != nil {
 		s.log.WithError(err).Error("Failed to generate new refresh token")
 		return nil, errors.New("failed to generate refresh token")
@@ -194,3 +201,46 @@ func (s *Service) GetUserProfile(userID uuid.UUID) (*types.UserResponse, error)
 		UpdatedAt: user.UpdatedAt,
 	}, nil
 }
+
+// checkTenantAccess blocks users whose tenant is suspended or awaiting
+// deletion. Platform admins are never tied to a tenant.
+func (s *Service) checkTenantAccess(user *types.CMSUser) error {
+	if user.IsAdmin() || user.NameSpace() == "" {
+		return nil
+	}
+
+	tenant, err := s.tenants.GetTenantByNamespace(user.NameSpace())
+	if err != nil {
+		if errors.Is(err, repository.ErrTenantNotFound) {
+			return nil
+		}
+		return errors.New("failed to verify tenant status")
+	}
+
+	switch tenant.Status {
+	case types.TenantSuspended, types.TenantPendingDeletion, types.TenantPurging:
+		return ErrTenantSuspended
+	case types.TenantPurged:
+		return ErrUnknownTenant
+	}
+	return nil
+}
+
+// tokenSystems lists the systems a customer may use, for the access token's
+// systems claim. A failed lookup leaves the claim empty; RequireSystem then
+// falls back to the database.
+func (s *Service) tokenSystems(user *types.CMSUser) []string {
+	if !user.IsCustomer() {
+		return nil
+	}
+	systems, err := s.entitlements.Systems(user.CMSUserID)
+	if err != nil {
+		s.log.WithError(err).WithField("user_id", user.CMSUserID).Warn("Failed to list entitled systems for token")
+		return nil
+	}
+	names := make([]string, len(systems))
+	for i, system := range systems {
+		names[i] = string(system)
+	}
+	return names
+}
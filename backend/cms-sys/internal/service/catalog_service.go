@@ -0,0 +1,341 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/repository"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/types"
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/events"
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/hooks"
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/utils"
+	"github.com/sirupsen/logrus"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrSystemNotFound = errors.New("system not found")
+	ErrSystemCodeUsed = errors.New("system code is already in use")
+	ErrSystemNotSold  = errors.New("system is no longer sold")
+)
+
+// Catalog tells other services which systems exist. Codes are matched
+// case-insensitively; unknown codes give ErrInvalidSystem.
+type Catalog interface {
+	// Known returns the catalog entry of code, on sale or not.
+	Known(code types.SystemType) (*types.SystemCatalog, error)
+	// Sellable is Known for systems still on sale; disabled ones give
+	// ErrSystemNotSold.
+	Sellable(code types.SystemType) (*types.SystemCatalog, error)
+	// Codes lists every system in the catalog, in order.
+	Codes() ([]types.SystemType, error)
+}
+
+// CatalogService manages the systems the platform sells. Systems are
+// disabled rather than deleted since purchases, plans and coupons refer to
+// them.
+type CatalogService interface {
+	Catalog
+	ListSystems(includeDisabled bool) ([]types.SystemCatalog, error)
+	Listings() ([]types.SystemListing, error)
+	GetSystem(code types.SystemType) (*types.SystemCatalog, error)
+	CreateSystem(actorID *uuid.UUID, req *types.CreateSystemRequest) (*types.SystemCatalog, error)
+	UpdateSystem(code types.SystemType, actorID *uuid.UUID, req *types.SystemRequest) (*types.SystemCatalog, error)
+	DisableSystem(code types.SystemType, actorID *uuid.UUID) error
+}
+
+type CatalogDeps struct {
+	Repo  repository.CatalogRepository
+	Audit repository.AuditRepository
+	Bus   events.Bus
+	// Jobs is optional; without it hooks are called before the purchase
+	// request returns.
+	Jobs *JobRunner
+	// Hooks is optional; without it provisioning hooks are not called.
+	Hooks *hooks.Sender
+}
+
+type CatalogConfig struct {
+	// CacheTTL is how long Known, Sellable and Codes reuse the catalog.
+	// Changes made through this service apply straight away; the TTL bounds
+	// what other instances may still serve. Zero disables the cache.
+	CacheTTL time.Duration
+}
+
+type CatalogSvc struct {
+	log   *logrus.Logger
+	repo  repository.CatalogRepository
+	audit repository.AuditRepository
+	bus   events.Bus
+	jobs  *JobRunner
+	hooks *hooks.Sender
+	cfg   CatalogConfig
+
+	mu      sync.Mutex
+	cached  map[types.SystemType]types.SystemCatalog
+	expires time.Time
+}
+
+var _ CatalogService = (*CatalogSvc)(nil)
+
+func NewCatalogService(log *logrus.Logger, deps CatalogDeps, cfg CatalogConfig) *CatalogSvc {
+	s := &CatalogSvc{
+		log:   log,
+		repo:  deps.Repo,
+		audit: deps.Audit,
+		bus:   deps.Bus,
+		jobs:  deps.Jobs,
+		hooks: deps.Hooks,
+		cfg:   cfg,
+	}
+	deps.Bus.Subscribe(events.PurchaseCreated, s.provision)
+	deps.Bus.Subscribe(events.PurchaseCanceled, s.provision)
+	return s
+}
+
+func (s *CatalogSvc) Known(code types.SystemType) (*types.SystemCatalog, error) {
+	catalog, err := s.catalog()
+	if err != nil {
+		return nil, err
+	}
+	system, ok := catalog[normalizeSystem(code)]
+	if !ok {
+		return nil, ErrInvalidSystem
+	}
+	return &system, nil
+}
+
+func (s *CatalogSvc) Sellable(code types.SystemType) (*types.SystemCatalog, error) {
+	system, err := s.Known(code)
+	if err != nil {
+		return nil, err
+	}
+	if !system.Active() {
+		return nil, ErrSystemNotSold
+	}
+	return system, nil
+}
+
+func (s *CatalogSvc) Codes() ([]types.SystemType, error) {
+	catalog, err := s.catalog()
+	if err != nil {
+		return nil, err
+	}
+	codes := make([]types.SystemType, 0, len(catalog))
+	for code := range catalog {
+		codes = append(codes, code)
+	}
+	slices.Sort(codes)
+	return codes, nil
+}
+
+func (s *CatalogSvc) ListSystems(includeDisabled bool) ([]types.SystemCatalog, error) {
+	systems, err := s.repo.ListSystems(!includeDisabled)
+	if err != nil {
+		return nil, errors.New("failed to list systems")
+	}
+	return systems, nil
+}
+
+// Listings shows the systems on sale without their hooks.
+func (s *CatalogSvc) Listings() ([]types.SystemListing, error) {
+	systems, err := s.ListSystems(false)
+	if err != nil {
+		return nil, err
+	}
+	listings := make([]types.SystemListing, 0, len(systems))
+	for _, system := range systems {
+		listings = append(listings, types.SystemListing{
+			Code:        system.Code,
+			Name:        system.Name,
+			Description: system.Description,
+			BaseURL:     system.BaseURL,
+		})
+	}
+	return listings, nil
+}
+
+func (s *CatalogSvc) GetSystem(code types.SystemType) (*types.SystemCatalog, error) {
+	system, err := s.repo.GetSystem(normalizeSystem(code))
+	if err != nil {
+		if errors.Is(err, repository.ErrSystemNotFound) {
+			return nil, ErrSystemNotFound
+		}
+		return nil, errors.New("failed to load system")
+	}
+	return system, nil
+}
+
+func (s *CatalogSvc) CreateSystem(actorID *uuid.UUID, req *types.CreateSystemRequest) (*types.SystemCatalog, error) {
+	system := systemFromRequest(&req.SystemRequest)
+	system.Code = normalizeSystem(req.Code)
+	if err := s.repo.CreateSystem(system); err != nil {
+		if errors.Is(err, repository.ErrSystemExists) {
+			return nil, ErrSystemCodeUsed
+		}
+		return nil, errors.New("failed to create system")
+	}
+	s.forget()
+	s.record(actorID, events.SystemCreated, system)
+	return system, nil
+}
+
+// UpdateSystem replaces everything but the code. Disabling a system stops
+// new sales; customers holding it keep it.
+func (s *CatalogSvc) UpdateSystem(code types.SystemType, actorID *uuid.UUID, req *types.SystemRequest) (*types.SystemCatalog, error) {
+	system := systemFromRequest(req)
+	system.Code = normalizeSystem(code)
+	system.UpdatedAt = time.Now()
+	if err := s.repo.UpdateSystem(system); err != nil {
+		if errors.Is(err, repository.ErrSystemNotFound) {
+			return nil, ErrSystemNotFound
+		}
+		return nil, errors.New("failed to update system")
+	}
+	s.forget()
+
+	updated, err := s.GetSystem(system.Code)
+	if err != nil {
+		return nil, err
+	}
+	s.record(actorID, events.SystemUpdated, updated)
+	return updated, nil
+}
+
+func (s *CatalogSvc) DisableSystem(code types.SystemType, actorID *uuid.UUID) error {
+	system, err := s.GetSystem(code)
+	if err != nil {
+		return err
+	}
+	if _, err := s.repo.SetSystemStatus(system.Code, types.SystemDisabled); err != nil {
+		return errors.New("failed to disable system")
+	}
+	s.forget()
+	system.Status = types.SystemDisabled
+	s.record(actorID, events.SystemDisabled, system)
+	return nil
+}
+
+// catalog returns every system by code, from the cache while it is fresh.
+func (s *CatalogSvc) catalog() (map[types.SystemType]types.SystemCatalog, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cached != nil && time.Now().Before(s.expires) {
+		return s.cached, nil
+	}
+
+	systems, err := s.repo.ListSystems(false)
+	if err != nil {
+		return nil, errors.New("failed to load system catalog")
+	}
+	catalog := make(map[types.SystemType]types.SystemCatalog, len(systems))
+	for _, system := range systems {
+		catalog[system.Code] = system
+	}
+	if s.cfg.CacheTTL > 0 {
+		s.cached = catalog
+		s.expires = time.Now().Add(s.cfg.CacheTTL)
+	}
+	return catalog, nil
+}
+
+func (s *CatalogSvc) forget() {
+	s.mu.Lock()
+	s.cached = nil
+	s.mu.Unlock()
+}
+
+// provision calls the system's provisioning hook when a customer gains it
+// and its deprovisioning hook when they lose it. Failures are logged; the
+// purchase stands either way.
+func (s *CatalogSvc) provision(e events.Event) {
+	if s.hooks == nil {
+		return
+	}
+	customerID, ok := e.Payload["customer_id"].(uuid.UUID)
+	if !ok {
+		return
+	}
+	code, _ := e.Payload["system"].(string)
+	system, err := s.Known(types.SystemType(code))
+	if err != nil {
+		return
+	}
+
+	call := &types.ProvisioningEvent{
+		Event:      "provision",
+		System:     system.Code,
+		CustomerID: customerID,
+		Namespace:  e.Namespace,
+		OccurredAt: e.OccurredAt,
+	}
+	url := system.ProvisionHook
+	if e.Type == events.PurchaseCanceled {
+		call.Event = "deprovision"
+		url = system.DeprovisionHook
+	}
+	if url == "" {
+		return
+	}
+
+	fields := logrus.Fields{"system": system.Code, "customer_id": customerID, "hook": call.Event}
+	if s.jobs == nil {
+		if err := s.hooks.Post(utils.GetContext(), url, call); err != nil {
+			s.log.WithError(err).WithFields(fields).Warn("Failed to call provisioning hook")
+		}
+		return
+	}
+	job := &types.Job{
+		JobID:       uuid.New(),
+		Kind:        types.JobSystemProvisioning,
+		RequestedBy: e.ActorID,
+	}
+	if e.Namespace != "" {
+		job.Namespace = &e.Namespace
+	}
+	err = s.jobs.Submit(job, func(ctx context.Context, job *types.Job) error {
+		return s.hooks.Post(ctx, url, call)
+	})
+	if err != nil {
+		s.log.WithError(err).WithFields(fields).Warn("Failed to schedule provisioning hook")
+	}
+}
+
+func (s *CatalogSvc) record(actorID *uuid.UUID, action string, system *types.SystemCatalog) {
+	details := map[string]interface{}{
+		"code":     system.Code,
+		"name":     system.Name,
+		"base_url": system.BaseURL,
+		"status":   system.Status,
+	}
+	if err := s.audit.Record(actorID, action, "system", string(system.Code), nil, details); err != nil {
+		s.log.WithError(err).Warn("Failed to audit system change")
+	}
+	s.bus.Publish(events.Event{
+		Type:    action,
+		ActorID: actorID,
+		Payload: details,
+	})
+}
+
+func systemFromRequest(req *types.SystemRequest) *types.SystemCatalog {
+	status := req.Status
+	if status == "" {
+		status = types.SystemActive
+	}
+	return &types.SystemCatalog{
+		Name:            strings.TrimSpace(req.Name),
+		Description:     req.Description,
+		BaseURL:         req.BaseURL,
+		Status:          status,
+		ProvisionHook:   req.ProvisionHook,
+		DeprovisionHook: req.DeprovisionHook,
+	}
+}
+
+func normalizeSystem(code types.SystemType) types.SystemType {
+	return types.SystemType(strings.ToUpper(strings.TrimSpace(string(code))))
+}
@@ -0,0 +1,440 @@
+package service
+
+import (
+	"errors"
+	"github.com/google/uuid"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/repository"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/types"
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/events"
+	"github.com/sirupsen/logrus"
+	"slices"
+	"strings"
+	"time"
+)
+
+var (
+	ErrCouponNotFound    = errors.New("coupon not found")
+	ErrCouponCodeUsed    = errors.New("coupon code is already in use")
+	ErrInvalidCoupon     = errors.New("percent coupons need percent_off from 1 to 100; fixed coupons need amount_off_cents and currency")
+	ErrCouponExpired     = errors.New("coupon has expired")
+	ErrCouponUnavailable = errors.New("coupon is no longer available")
+	ErrCouponNotEligible = errors.New("coupon does not apply to this plan")
+	ErrCouponRedeemed    = errors.New("coupon has already been redeemed")
+)
+
+// Discounts redeems coupons on subscriptions. A redemption is made before
+// anything is charged and released again if the subscription does not come
+// about; its discount is taken off the first charged period only.
+type Discounts interface {
+	Redeem(customerID uuid.UUID, code string, plan *types.Plan, checkoutID *uuid.UUID) (*types.CouponRedemption, error)
+	Release(redemption *types.CouponRedemption)
+	Attach(redemption *types.CouponRedemption, sub *types.Subscription, applied bool)
+	Pending(subscriptionID uuid.UUID) *types.CouponRedemption
+	MarkApplied(redemption *types.CouponRedemption)
+}
+
+// CouponService manages promo codes and reports on their use. Coupons are
+// disabled rather than deleted so redemptions keep pointing at their terms.
+type CouponService interface {
+	Discounts
+	ListCoupons() ([]types.Coupon, error)
+	GetCoupon(id uuid.UUID) (*types.Coupon, error)
+	CreateCoupon(actorID *uuid.UUID, req *types.CouponRequest) (*types.Coupon, error)
+	UpdateCoupon(id uuid.UUID, actorID *uuid.UUID, req *types.CouponRequest) (*types.Coupon, error)
+	DisableCoupon(id uuid.UUID, actorID *uuid.UUID) error
+	Report(id uuid.UUID) (*types.CouponReport, error)
+	Quote(customerID uuid.UUID, code, planCode string) (*types.CouponQuote, error)
+}
+
+type CouponDeps struct {
+	Catalog   Catalog
+	Repo      repository.CouponRepository
+	Plans     repository.PlanRepository
+	Purchases repository.PurchaseRepository
+	Audit     repository.AuditRepository
+	Bus       events.Bus
+}
+
+type CouponSvc struct {
+	log       *logrus.Logger
+	catalog   Catalog
+	repo      repository.CouponRepository
+	plans     repository.PlanRepository
+	purchases repository.PurchaseRepository
+	audit     repository.AuditRepository
+	bus       events.Bus
+}
+
+var _ CouponService = (*CouponSvc)(nil)
+
+func NewCouponService(log *logrus.Logger, deps CouponDeps) *CouponSvc {
+	return &CouponSvc{
+		log:       log,
+		catalog:   deps.Catalog,
+		repo:      deps.Repo,
+		plans:     deps.Plans,
+		purchases: deps.Purchases,
+		audit:     deps.Audit,
+		bus:       deps.Bus,
+	}
+}
+
+func (s *CouponSvc) ListCoupons() ([]types.Coupon, error) {
+	coupons, err := s.repo.ListCoupons()
+	if err != nil {
+		return nil, errors.New("failed to list coupons")
+	}
+	return coupons, nil
+}
+
+func (s *CouponSvc) GetCoupon(id uuid.UUID) (*types.Coupon, error) {
+	coupon, err := s.repo.GetCoupon(id)
+	if err != nil {
+		if errors.Is(err, repository.ErrCouponNotFound) {
+			return nil, ErrCouponNotFound
+		}
+		return nil, errors.New("failed to load coupon")
+	}
+	return coupon, nil
+}
+
+func (s *CouponSvc) CreateCoupon(actorID *uuid.UUID, req *types.CouponRequest) (*types.Coupon, error) {
+	coupon, err := s.couponFromRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.codeAvailable(coupon.Code, uuid.Nil); err != nil {
+		return nil, err
+	}
+
+	coupon.Active = req.Active == nil || *req.Active
+	if err := s.repo.CreateCoupon(coupon); err != nil {
+		return nil, errors.New("failed to create coupon")
+	}
+	s.record(actorID, events.CouponCreated, coupon.CouponID, couponDetails(coupon))
+	return coupon, nil
+}
+
+// UpdateCoupon replaces the coupon's terms. Redemptions already made keep
+// the discount they were given.
+func (s *CouponSvc) UpdateCoupon(id uuid.UUID, actorID *uuid.UUID, req *types.CouponRequest) (*types.Coupon, error) {
+	existing, err := s.GetCoupon(id)
+	if err != nil {
+		return nil, err
+	}
+	coupon, err := s.couponFromRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	coupon.CouponID = id
+	if err := s.codeAvailable(coupon.Code, id); err != nil {
+		return nil, err
+	}
+
+	coupon.Active = existing.Active
+	if req.Active != nil {
+		coupon.Active = *req.Active
+	}
+	coupon.UpdatedAt = time.Now()
+	if err := s.repo.ReplaceCoupon(coupon); err != nil {
+		if errors.Is(err, repository.ErrCouponNotFound) {
+			return nil, ErrCouponNotFound
+		}
+		return nil, errors.New("failed to update coupon")
+	}
+
+	updated, err := s.GetCoupon(id)
+	if err != nil {
+		return nil, err
+	}
+	s.record(actorID, events.CouponUpdated, id, couponDetails(updated))
+	return updated, nil
+}
+
+func (s *CouponSvc) DisableCoupon(id uuid.UUID, actorID *uuid.UUID) error {
+	coupon, err := s.GetCoupon(id)
+	if err != nil {
+		return err
+	}
+	if _, err := s.repo.SetCouponActive(id, false); err != nil {
+		return errors.New("failed to disable coupon")
+	}
+	coupon.Active = false
+	s.record(actorID, events.CouponDisabled, id, couponDetails(coupon))
+	return nil
+}
+
+// Report lists the coupon's redemptions with their totals.
+func (s *CouponSvc) Report(id uuid.UUID) (*types.CouponReport, error) {
+	coupon, err := s.GetCoupon(id)
+	if err != nil {
+		return nil, err
+	}
+	redemptions, err := s.repo.ListRedemptions(id)
+	if err != nil {
+		return nil, errors.New("failed to list coupon redemptions")
+	}
+
+	report := &types.CouponReport{
+		Coupon:        coupon,
+		Redemptions:   len(redemptions),
+		DiscountCents: map[string]int64{},
+		Items:         redemptions,
+	}
+	for _, r := range redemptions {
+		if r.AppliedAt == nil {
+			report.Pending++
+			continue
+		}
+		report.Applied++
+		report.DiscountCents[r.Currency] += r.DiscountCents
+	}
+	return report, nil
+}
+
+// Quote tells a customer what the coupon would take off a plan without
+// redeeming it.
+func (s *CouponSvc) Quote(customerID uuid.UUID, code, planCode string) (*types.CouponQuote, error) {
+	plan, err := s.plans.GetPlanByCode(strings.ToLower(planCode))
+	if err != nil {
+		if errors.Is(err, repository.ErrPlanNotFound) {
+			return nil, ErrPlanNotFound
+		}
+		return nil, errors.New("failed to load plan")
+	}
+	coupon, system, err := s.usable(code, plan, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.repo.GetCustomerRedemption(coupon.CouponID, customerID); err == nil {
+		return nil, ErrCouponRedeemed
+	} else if !errors.Is(err, repository.ErrRedemptionNotFound) {
+		return nil, errors.New("failed to check coupon redemptions")
+	}
+
+	discount := coupon.Discount(plan.PriceCents)
+	return &types.CouponQuote{
+		Code:          coupon.Code,
+		Plan:          plan.Code,
+		System:        system,
+		PriceCents:    plan.PriceCents,
+		DiscountCents: discount,
+		DueCents:      plan.PriceCents - discount,
+		Currency:      plan.Currency,
+	}, nil
+}
+
+// Redeem takes up the coupon for the customer on plan, counting it against
+// the coupon's limit straight away so concurrent redemptions cannot exceed
+// it. checkoutID links the redemption to a hosted checkout.
+func (s *CouponSvc) Redeem(customerID uuid.UUID, code string, plan *types.Plan, checkoutID *uuid.UUID) (*types.CouponRedemption, error) {
+	now := time.Now()
+	coupon, system, err := s.usable(code, plan, now)
+	if err != nil {
+		return nil, err
+	}
+
+	redemption := &types.CouponRedemption{
+		CouponID:      coupon.CouponID,
+		CustomerID:    customerID,
+		PlanID:        plan.PlanID,
+		System:        system,
+		CheckoutID:    checkoutID,
+		PriceCents:    plan.PriceCents,
+		DiscountCents: coupon.Discount(plan.PriceCents),
+		Currency:      plan.Currency,
+		RedeemedAt:    now,
+	}
+	if err := s.repo.Redeem(redemption); err != nil {
+		switch {
+		case errors.Is(err, repository.ErrCouponUnavailable):
+			return nil, ErrCouponUnavailable
+		case errors.Is(err, repository.ErrCouponRedeemed):
+			return nil, ErrCouponRedeemed
+		}
+		return nil, errors.New("failed to redeem coupon")
+	}
+
+	s.record(&customerID, events.CouponRedeemed, coupon.CouponID, redemptionDetails(coupon.Code, redemption))
+	return redemption, nil
+}
+
+// Release gives back a redemption that did not lead to a subscription. A
+// failure is logged; the redemption then stays counted.
+func (s *CouponSvc) Release(redemption *types.CouponRedemption) {
+	if redemption == nil {
+		return
+	}
+	released, err := s.repo.ReleaseRedemption(redemption.RedemptionID)
+	if err != nil {
+		s.log.WithError(err).WithField("redemption_id", redemption.RedemptionID).Error("Failed to release coupon redemption")
+		return
+	}
+	if released {
+		s.record(&redemption.CustomerID, events.CouponReleased, redemption.CouponID, redemptionDetails("", redemption))
+	}
+}
+
+// Attach links the redemption to the subscription it was made for and, for
+// a coupon limited to systems, to the customer's purchase of the matched
+// system. applied says whether the subscription's first charge already used
+// the discount.
+func (s *CouponSvc) Attach(redemption *types.CouponRedemption, sub *types.Subscription, applied bool) {
+	if redemption == nil {
+		return
+	}
+	redemption.SubscriptionID = &sub.SubscriptionID
+	if redemption.System != "" {
+		if purchase, err := s.purchases.GetPurchase(sub.CustomerID, redemption.System); err == nil {
+			redemption.PurchaseID = &purchase.RelationID
+		}
+	}
+	if applied {
+		now := time.Now()
+		redemption.AppliedAt = &now
+	}
+	if err := s.repo.AttachRedemption(redemption); err != nil {
+		s.log.WithError(err).WithField("redemption_id", redemption.RedemptionID).Error("Failed to attach coupon redemption")
+	}
+}
+
+// Pending returns the subscription's redemption whose discount is still to
+// be charged, or nil.
+func (s *CouponSvc) Pending(subscriptionID uuid.UUID) *types.CouponRedemption {
+	redemption, err := s.repo.GetSubscriptionRedemption(subscriptionID)
+	if err != nil || redemption.AppliedAt != nil {
+		return nil
+	}
+	return redemption
+}
+
+func (s *CouponSvc) MarkApplied(redemption *types.CouponRedemption) {
+	if _, err := s.repo.MarkApplied(redemption.RedemptionID, time.Now()); err != nil {
+		s.log.WithError(err).WithField("redemption_id", redemption.RedemptionID).Error("Failed to mark coupon redemption applied")
+	}
+}
+
+// usable loads the coupon and checks it can be redeemed on plan now. It
+// returns the system that made a system-limited coupon apply.
+func (s *CouponSvc) usable(code string, plan *types.Plan, now time.Time) (*types.Coupon, types.SystemType, error) {
+	coupon, err := s.repo.GetCouponByCode(strings.ToUpper(code))
+	if err != nil {
+		if errors.Is(err, repository.ErrCouponNotFound) {
+			return nil, "", ErrCouponNotFound
+		}
+		return nil, "", errors.New("failed to load coupon")
+	}
+	if !coupon.Active {
+		return nil, "", ErrCouponUnavailable
+	}
+	if coupon.ExpiresAt != nil && !now.Before(*coupon.ExpiresAt) {
+		return nil, "", ErrCouponExpired
+	}
+	if coupon.MaxRedemptions != nil && coupon.Redemptions >= *coupon.MaxRedemptions {
+		return nil, "", ErrCouponUnavailable
+	}
+	system, ok := coupon.Eligible(plan)
+	if !ok || plan.PriceCents == 0 {
+		return nil, "", ErrCouponNotEligible
+	}
+	return coupon, system, nil
+}
+
+func (s *CouponSvc) codeAvailable(code string, self uuid.UUID) error {
+	existing, err := s.repo.GetCouponByCode(code)
+	if err != nil {
+		if errors.Is(err, repository.ErrCouponNotFound) {
+			return nil
+		}
+		return errors.New("failed to check coupon code")
+	}
+	if existing.CouponID != self {
+		return ErrCouponCodeUsed
+	}
+	return nil
+}
+
+func (s *CouponSvc) couponFromRequest(req *types.CouponRequest) (*types.Coupon, error) {
+	coupon := &types.Coupon{
+		Code:           strings.ToUpper(req.Code),
+		Description:    req.Description,
+		Kind:           req.Kind,
+		MaxRedemptions: req.MaxRedemptions,
+		ExpiresAt:      req.ExpiresAt,
+	}
+	switch req.Kind {
+	case types.CouponPercent:
+		if req.PercentOff < 1 {
+			return nil, ErrInvalidCoupon
+		}
+		coupon.PercentOff = req.PercentOff
+	case types.CouponFixed:
+		if req.AmountOffCents < 1 || req.Currency == "" {
+			return nil, ErrInvalidCoupon
+		}
+		coupon.AmountOffCents = req.AmountOffCents
+		coupon.Currency = strings.ToUpper(req.Currency)
+	default:
+		return nil, ErrInvalidCoupon
+	}
+
+	for _, system := range req.Systems {
+		entry, err := s.catalog.Known(system)
+		if err != nil {
+			return nil, err
+		}
+		if !slices.ContainsFunc(coupon.Systems, func(c types.CouponSystem) bool { return c.System == entry.Code }) {
+			coupon.Systems = append(coupon.Systems, types.CouponSystem{System: entry.Code})
+		}
+	}
+	for _, code := range req.Plans {
+		plan, err := s.plans.GetPlanByCode(strings.ToLower(code))
+		if err != nil {
+			if errors.Is(err, repository.ErrPlanNotFound) {
+				return nil, ErrPlanNotFound
+			}
+			return nil, errors.New("failed to load plan")
+		}
+		coupon.Plans = append(coupon.Plans, types.CouponPlan{PlanID: plan.PlanID})
+	}
+	return coupon, nil
+}
+
+func (s *CouponSvc) record(actorID *uuid.UUID, action string, couponID uuid.UUID, details map[string]interface{}) {
+	if err := s.audit.Record(actorID, action, "coupon", couponID.String(), nil, details); err != nil {
+		s.log.WithError(err).Warn("Failed to audit coupon change")
+	}
+	s.bus.Publish(events.Event{
+		Type:    action,
+		ActorID: actorID,
+		Payload: details,
+	})
+}
+
+func couponDetails(coupon *types.Coupon) map[string]interface{} {
+	return map[string]interface{}{
+		"code":             coupon.Code,
+		"kind":             coupon.Kind,
+		"percent_off":      coupon.PercentOff,
+		"amount_off_cents": coupon.AmountOffCents,
+		"currency":         coupon.Currency,
+		"max_redemptions":  coupon.MaxRedemptions,
+		"expires_at":       coupon.ExpiresAt,
+		"active":           coupon.Active,
+	}
+}
+
+func redemptionDetails(code string, redemption *types.CouponRedemption) map[string]interface{} {
+	details := map[string]interface{}{
+		"redemption_id":  redemption.RedemptionID,
+		"coupon_id":      redemption.CouponID,
+		"customer_id":    redemption.CustomerID,
+		"plan_id":        redemption.PlanID,
+		"discount_cents": redemption.DiscountCents,
+		"currency":       redemption.Currency,
+	}
+	if code != "" {
+		details["code"] = code
+	}
+	return details
+}
@@ -0,0 +1,459 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/repository"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/types"
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/dns"
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/events"
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/utils"
+	"github.com/sirupsen/logrus"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrDomainNotFound    = errors.New("domain not found")
+	ErrDomainTaken       = errors.New("domain is already claimed")
+	ErrDomainReserved    = errors.New("domain belongs to the platform")
+	ErrDomainLimit       = errors.New("tenant has reached its custom domain limit")
+	ErrChallengeNotFound = errors.New("verification record not found")
+)
+
+// DomainService manages custom domains. A tenant claims a domain, publishes
+// the TXT challenge and asks for verification; only verified domains resolve
+// to the tenant and are admitted as browser origins.
+type DomainService interface {
+	AddDomain(namespace, domain string, actorID *uuid.UUID) (*types.DomainResponse, error)
+	ListDomains(namespace string) ([]types.DomainResponse, error)
+	VerifyDomain(namespace, domain string, actorID *uuid.UUID) (*types.DomainResponse, error)
+	RemoveDomain(namespace, domain string, actorID *uuid.UUID) error
+	VerifyPending() int
+	RecheckVerified() int
+	ResolveHost(host string) string
+}
+
+type DomainConfig struct {
+	// BaseDomain is the shared parent domain; it and its subdomains cannot be
+	// claimed.
+	BaseDomain string
+	// MaxPerTenant caps the domains one tenant can claim, 0 means unlimited.
+	MaxPerTenant int
+	// PendingTTL is how long an unverified claim blocks other tenants.
+	PendingTTL time.Duration
+	// CacheTTL bounds how long a verification or removal on another instance
+	// takes to reach host resolution here.
+	CacheTTL time.Duration
+}
+
+type DomainDeps struct {
+	Repo     repository.DomainRepository
+	Tenants  repository.TenantRepository
+	Audit    repository.AuditRepository
+	Bus      events.Bus
+	Resolver dns.Resolver
+}
+
+type domainSnapshot struct {
+	hosts   map[string]string
+	expires time.Time
+}
+
+type DomainSvc struct {
+	log      *logrus.Logger
+	repo     repository.DomainRepository
+	tenants  repository.TenantRepository
+	audit    repository.AuditRepository
+	bus      events.Bus
+	resolver dns.Resolver
+	cfg      DomainConfig
+
+	mu       sync.RWMutex
+	verified *domainSnapshot
+}
+
+var _ DomainService = (*DomainSvc)(nil)
+
+func NewDomainService(log *logrus.Logger, deps DomainDeps, cfg DomainConfig) *DomainSvc {
+	cfg.BaseDomain = strings.ToLower(strings.Trim(cfg.BaseDomain, "."))
+	s := &DomainSvc{
+		log:      log,
+		repo:     deps.Repo,
+		tenants:  deps.Tenants,
+		audit:    deps.Audit,
+		bus:      deps.Bus,
+		resolver: deps.Resolver,
+		cfg:      cfg,
+	}
+
+	invalidate := func(events.Event) { s.invalidate() }
+	deps.Bus.Subscribe(events.TenantDomainVerified, invalidate)
+	deps.Bus.Subscribe(events.TenantDomainUnverified, invalidate)
+	deps.Bus.Subscribe(events.TenantDomainRemoved, invalidate)
+	// A purged tenant releases its domains for other tenants.
+	deps.Bus.Subscribe(events.TenantPurged, func(e events.Event) {
+		if err := s.repo.DeleteNamespace(e.Namespace); err != nil {
+			s.log.WithError(err).WithField("namespace", e.Namespace).Warn("Failed to release tenant domains")
+		}
+		s.invalidate()
+	})
+	return s
+}
+
+func (s *DomainSvc) AddDomain(namespace, domain string, actorID *uuid.UUID) (*types.DomainResponse, error) {
+	tenant, err := s.domainTenant(namespace)
+	if err != nil {
+		return nil, err
+	}
+	name, err := s.normalize(domain)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.cfg.MaxPerTenant > 0 {
+		n, err := s.repo.CountDomains(tenant.Namespace)
+		if err != nil {
+			return nil, errors.New("failed to count domains")
+		}
+		if n >= int64(s.cfg.MaxPerTenant) {
+			return nil, ErrDomainLimit
+		}
+	}
+
+	token, err := challengeToken()
+	if err != nil {
+		return nil, errors.New("failed to generate challenge")
+	}
+	d := &types.TenantDomain{Domain: name, Namespace: tenant.Namespace, Token: token}
+	claimed, err := s.repo.ClaimDomain(d, time.Now().Add(-s.cfg.PendingTTL))
+	if err != nil {
+		return nil, errors.New("failed to add domain")
+	}
+	if !claimed {
+		return nil, ErrDomainTaken
+	}
+
+	s.record(actorID, events.TenantDomainAdded, tenant, name)
+	return toDomainResponse(d), nil
+}
+
+func (s *DomainSvc) ListDomains(namespace string) ([]types.DomainResponse, error) {
+	tenant, err := s.domainTenant(namespace)
+	if err != nil {
+		return nil, err
+	}
+	domains, err := s.repo.ListDomains(tenant.Namespace)
+	if err != nil {
+		return nil, errors.New("failed to list domains")
+	}
+
+	responses := make([]types.DomainResponse, 0, len(domains))
+	for i := range domains {
+		responses = append(responses, *toDomainResponse(&domains[i]))
+	}
+	return responses, nil
+}
+
+// VerifyDomain checks the TXT challenge now. A failed check is recorded on the
+// domain and returned as ErrChallengeNotFound.
+func (s *DomainSvc) VerifyDomain(namespace, domain string, actorID *uuid.UUID) (*types.DomainResponse, error) {
+	tenant, d, err := s.tenantDomain(namespace, domain)
+	if err != nil {
+		return nil, err
+	}
+	if d.Status == types.DomainVerified {
+		return toDomainResponse(d), nil
+	}
+
+	verified, err := s.check(d)
+	if err != nil {
+		return nil, err
+	}
+	if !verified {
+		return nil, fmt.Errorf("%w: %s", ErrChallengeNotFound, d.LastError)
+	}
+
+	s.record(actorID, events.TenantDomainVerified, tenant, d.Domain)
+	return toDomainResponse(d), nil
+}
+
+func (s *DomainSvc) RemoveDomain(namespace, domain string, actorID *uuid.UUID) error {
+	tenant, d, err := s.tenantDomain(namespace, domain)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.DeleteDomain(d.Domain); err != nil {
+		return errors.New("failed to remove domain")
+	}
+
+	s.record(actorID, events.TenantDomainRemoved, tenant, d.Domain)
+	return nil
+}
+
+// VerifyPending checks every pending claim and drops claims that stayed
+// unverified past PendingTTL. It returns the number of domains verified.
+func (s *DomainSvc) VerifyPending() int {
+	if n, err := s.repo.DeletePendingBefore(time.Now().Add(-s.cfg.PendingTTL)); err == nil && n > 0 {
+		s.log.WithField("domains", n).Info("Dropped expired domain claims")
+	}
+
+	pending, err := s.repo.ListByStatus(types.DomainPending)
+	if err != nil {
+		return 0
+	}
+
+	verified := 0
+	for i := range pending {
+		d := &pending[i]
+		ok, err := s.check(d)
+		if err != nil {
+			s.log.WithError(err).WithField("domain", d.Domain).Warn("Failed to check domain")
+			continue
+		}
+		if !ok {
+			continue
+		}
+		tenant, err := s.tenants.GetTenantByNamespace(d.Namespace)
+		if err != nil {
+			continue
+		}
+		s.record(nil, events.TenantDomainVerified, tenant, d.Domain)
+		verified++
+	}
+	return verified
+}
+
+// RecheckVerified looks the challenge of every verified domain up again, so a
+// domain stops routing to its tenant once the record is removed. A domain
+// whose record is gone goes back to pending and the owner has PendingTTL to
+// publish it again before the claim is dropped; a failed lookup leaves the
+// domain verified until the next run. It returns the number of domains
+// unverified.
+func (s *DomainSvc) RecheckVerified() int {
+	verified, err := s.repo.ListByStatus(types.DomainVerified)
+	if err != nil {
+		return 0
+	}
+
+	unverified := 0
+	for i := range verified {
+		d := &verified[i]
+		found, err := s.lookup(d)
+		now := time.Now()
+		d.LastCheckedAt = &now
+		d.LastError = checkError(d, found, err)
+		gone := err == nil && !found
+		if gone {
+			d.Status = types.DomainPending
+			d.VerifiedAt = nil
+			d.CreatedAt = now
+		}
+		if err := s.repo.UpdateDomain(d); err != nil {
+			s.log.WithError(err).WithField("domain", d.Domain).Warn("Failed to update domain")
+			continue
+		}
+		if !gone {
+			continue
+		}
+		tenant, err := s.tenants.GetTenantByNamespace(d.Namespace)
+		if err != nil {
+			continue
+		}
+		s.record(nil, events.TenantDomainUnverified, tenant, d.Domain)
+		unverified++
+	}
+	return unverified
+}
+
+// ResolveHost returns the namespace a verified custom domain belongs to, or
+// "" for any other host.
+func (s *DomainSvc) ResolveHost(host string) string {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if host == "" {
+		return ""
+	}
+
+	s.mu.RLock()
+	snap := s.verified
+	s.mu.RUnlock()
+	if snap == nil || time.Now().After(snap.expires) {
+		var err error
+		if snap, err = s.loadVerified(); err != nil {
+			s.log.WithError(err).Warn("Failed to load verified domains")
+			return ""
+		}
+	}
+	return snap.hosts[host]
+}
+
+// check looks up the challenge record and stores the outcome on the domain.
+func (s *DomainSvc) check(d *types.TenantDomain) (bool, error) {
+	found, err := s.lookup(d)
+
+	now := time.Now()
+	d.LastCheckedAt = &now
+	d.LastError = checkError(d, found, err)
+	if found {
+		d.Status = types.DomainVerified
+		d.VerifiedAt = &now
+	}
+
+	if err := s.repo.UpdateDomain(d); err != nil {
+		return false, errors.New("failed to update domain")
+	}
+	return d.Status == types.DomainVerified, nil
+}
+
+// lookup reports whether the challenge record is published. It only fails
+// when DNS could not be asked.
+func (s *DomainSvc) lookup(d *types.TenantDomain) (bool, error) {
+	challenge := d.Challenge()
+	records, err := s.resolver.LookupTXT(utils.GetContext(), challenge.Name)
+	if err != nil {
+		return false, err
+	}
+	return containsRecord(records, challenge.Value), nil
+}
+
+// checkError is the LastError a check stores; it is empty when the record
+// was found.
+func checkError(d *types.TenantDomain, found bool, lookupErr error) string {
+	var msg string
+	switch challenge := d.Challenge(); {
+	case lookupErr != nil:
+		msg = "lookup failed: " + lookupErr.Error()
+	case !found:
+		msg = fmt.Sprintf("no TXT record %q at %s", challenge.Value, challenge.Name)
+	default:
+		return ""
+	}
+	if len(msg) > 255 {
+		msg = msg[:255]
+	}
+	return msg
+}
+
+func (s *DomainSvc) loadVerified() (*domainSnapshot, error) {
+	domains, err := s.repo.ListByStatus(types.DomainVerified)
+	if err != nil {
+		return nil, err
+	}
+	snap := &domainSnapshot{
+		hosts:   make(map[string]string, len(domains)),
+		expires: time.Now().Add(s.cfg.CacheTTL),
+	}
+	for _, d := range domains {
+		snap.hosts[d.Domain] = d.Namespace
+	}
+
+	s.mu.Lock()
+	s.verified = snap
+	s.mu.Unlock()
+	return snap, nil
+}
+
+func (s *DomainSvc) invalidate() {
+	s.mu.Lock()
+	s.verified = nil
+	s.mu.Unlock()
+}
+
+func (s *DomainSvc) record(actorID *uuid.UUID, action string, tenant *types.Tenant, domain string) {
+	details := map[string]interface{}{"domain": domain}
+	if err := s.audit.Record(actorID, action, "tenant", tenant.TenantID.String(), &tenant.Namespace, details); err != nil {
+		s.log.WithError(err).Warn("Failed to audit domain change")
+	}
+	s.bus.Publish(events.Event{
+		Type:      action,
+		Namespace: tenant.Namespace,
+		ActorID:   actorID,
+		Payload:   details,
+	})
+}
+
+func (s *DomainSvc) normalize(domain string) (string, error) {
+	name := strings.ToLower(strings.TrimSuffix(strings.TrimSpace(domain), "."))
+	if !strings.Contains(name, ".") {
+		return "", ErrDomainReserved
+	}
+	if base := s.cfg.BaseDomain; base != "" && (name == base || strings.HasSuffix(name, "."+base)) {
+		return "", ErrDomainReserved
+	}
+	return name, nil
+}
+
+func (s *DomainSvc) domainTenant(namespace string) (*types.Tenant, error) {
+	ns, err := utils.NormalizeNamespace(namespace)
+	if err != nil {
+		return nil, ErrUnknownTenant
+	}
+	tenant, err := s.tenants.GetTenantByNamespace(ns)
+	if err != nil {
+		if errors.Is(err, repository.ErrTenantNotFound) {
+			return nil, ErrUnknownTenant
+		}
+		return nil, errors.New("failed to load tenant")
+	}
+	if tenant.Status == types.TenantPurged {
+		return nil, ErrUnknownTenant
+	}
+	return tenant, nil
+}
+
+// tenantDomain loads a domain and makes sure it belongs to the tenant, so one
+// tenant cannot learn about or act on another tenant's claims.
+func (s *DomainSvc) tenantDomain(namespace, domain string) (*types.Tenant, *types.TenantDomain, error) {
+	tenant, err := s.domainTenant(namespace)
+	if err != nil {
+		return nil, nil, err
+	}
+	d, err := s.repo.GetDomain(strings.ToLower(strings.TrimSuffix(domain, ".")))
+	if err != nil {
+		if errors.Is(err, repository.ErrDomainNotFound) {
+			return nil, nil, ErrDomainNotFound
+		}
+		return nil, nil, errors.New("failed to load domain")
+	}
+	if d.Namespace != tenant.Namespace {
+		return nil, nil, ErrDomainNotFound
+	}
+	return tenant, d, nil
+}
+
+func challengeToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func containsRecord(records []string, want string) bool {
+	for _, r := range records {
+		if strings.TrimSpace(r) == want {
+			return true
+		}
+	}
+	return false
+}
+
+func toDomainResponse(d *types.TenantDomain) *types.DomainResponse {
+	response := &types.DomainResponse{
+		Domain:        d.Domain,
+		Status:        d.Status,
+		VerifiedAt:    d.VerifiedAt,
+		LastCheckedAt: d.LastCheckedAt,
+		LastError:     d.LastError,
+		CreatedAt:     d.CreatedAt,
+	}
+	if d.Status == types.DomainPending {
+		challenge := d.Challenge()
+		response.Challenge = &challenge
+	}
+	return response
+}
@@ -0,0 +1,255 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/repository"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/types"
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/dns"
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/events"
+	"github.com/sirupsen/logrus"
+)
+
+func quietLogger() *logrus.Logger {
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+	return log
+}
+
+// memoryDomains keeps domains in memory. It copies on the way in and out like
+// a database would.
+type memoryDomains struct {
+	mu      sync.Mutex
+	domains map[string]types.TenantDomain
+}
+
+var _ repository.DomainRepository = (*memoryDomains)(nil)
+
+func newMemoryDomains() *memoryDomains {
+	return &memoryDomains{domains: make(map[string]types.TenantDomain)}
+}
+
+func (m *memoryDomains) ClaimDomain(d *types.TenantDomain, staleBefore time.Time) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if held, ok := m.domains[d.Domain]; ok && !(held.Status == types.DomainPending && held.CreatedAt.Before(staleBefore)) {
+		return false, nil
+	}
+	d.DomainID = uuid.New()
+	d.Status = types.DomainPending
+	d.CreatedAt, d.UpdatedAt = time.Now(), time.Now()
+	m.domains[d.Domain] = *d
+	return true, nil
+}
+
+func (m *memoryDomains) GetDomain(domain string) (*types.TenantDomain, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	d, ok := m.domains[domain]
+	if !ok {
+		return nil, repository.ErrDomainNotFound
+	}
+	return &d, nil
+}
+
+func (m *memoryDomains) list(keep func(types.TenantDomain) bool) []types.TenantDomain {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var domains []types.TenantDomain
+	for _, d := range m.domains {
+		if keep(d) {
+			domains = append(domains, d)
+		}
+	}
+	sort.Slice(domains, func(i, j int) bool { return domains[i].Domain < domains[j].Domain })
+	return domains
+}
+
+func (m *memoryDomains) ListDomains(namespace string) ([]types.TenantDomain, error) {
+	return m.list(func(d types.TenantDomain) bool { return d.Namespace == namespace }), nil
+}
+
+func (m *memoryDomains) ListByStatus(status types.DomainStatus) ([]types.TenantDomain, error) {
+	return m.list(func(d types.TenantDomain) bool { return d.Status == status }), nil
+}
+
+func (m *memoryDomains) CountDomains(namespace string) (int64, error) {
+	domains, _ := m.ListDomains(namespace)
+	return int64(len(domains)), nil
+}
+
+func (m *memoryDomains) UpdateDomain(d *types.TenantDomain) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.domains[d.Domain] = *d
+	return nil
+}
+
+func (m *memoryDomains) DeleteDomain(domain string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.domains, domain)
+	return nil
+}
+
+func (m *memoryDomains) DeleteNamespace(namespace string) error {
+	for _, d := range m.list(func(d types.TenantDomain) bool { return d.Namespace == namespace }) {
+		_ = m.DeleteDomain(d.Domain)
+	}
+	return nil
+}
+
+func (m *memoryDomains) DeletePendingBefore(t time.Time) (int64, error) {
+	stale := m.list(func(d types.TenantDomain) bool { return d.Status == types.DomainPending && d.CreatedAt.Before(t) })
+	for _, d := range stale {
+		_ = m.DeleteDomain(d.Domain)
+	}
+	return int64(len(stale)), nil
+}
+
+// fixedTenants serves lookups by namespace; other methods are not used here.
+type fixedTenants struct {
+	repository.TenantRepository
+	tenants map[string]*types.Tenant
+}
+
+func (f fixedTenants) GetTenantByNamespace(namespace string) (*types.Tenant, error) {
+	if tenant, ok := f.tenants[namespace]; ok {
+		copied := *tenant
+		return &copied, nil
+	}
+	return nil, repository.ErrTenantNotFound
+}
+
+type discardAudit struct{}
+
+func (discardAudit) Record(*uuid.UUID, string, string, string, *string, map[string]interface{}) error {
+	return nil
+}
+
+func (discardAudit) ListByNamespace(string, int, int) ([]types.AuditLog, int64, error) {
+	return nil, 0, nil
+}
+
+// flakyResolver fails every lookup while down is set.
+type flakyResolver struct {
+	*dns.StaticResolver
+	down bool
+}
+
+func (r *flakyResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	if r.down {
+		return nil, errors.New("i/o timeout")
+	}
+	return r.StaticResolver.LookupTXT(ctx, name)
+}
+
+func newTestDomainService(resolver dns.Resolver) (*DomainSvc, *memoryDomains) {
+	log := quietLogger()
+	domains := newMemoryDomains()
+	svc := NewDomainService(log, DomainDeps{
+		Repo: domains,
+		Tenants: fixedTenants{tenants: map[string]*types.Tenant{
+			"acme": {TenantID: uuid.New(), Namespace: "acme", Status: types.TenantActive},
+		}},
+		Audit:    discardAudit{},
+		Bus:      events.NewInProcessBus(log),
+		Resolver: resolver,
+	}, DomainConfig{
+		BaseDomain: "cms.example.com",
+		PendingTTL: time.Hour,
+		CacheTTL:   time.Minute,
+	})
+	return svc, domains
+}
+
+func TestDomainVerificationLifecycle(t *testing.T) {
+	resolver := &flakyResolver{StaticResolver: dns.NewStaticResolver()}
+	svc, domains := newTestDomainService(resolver)
+
+	added, err := svc.AddDomain("acme", "Learn.Acme.com.", nil)
+	if err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	if added.Domain != "learn.acme.com" || added.Challenge == nil {
+		t.Fatalf("add returned %+v", added)
+	}
+	if ns := svc.ResolveHost("learn.acme.com"); ns != "" {
+		t.Fatalf("pending domain resolved to %q", ns)
+	}
+
+	if _, err := svc.VerifyDomain("acme", "learn.acme.com", nil); !errors.Is(err, ErrChallengeNotFound) {
+		t.Fatalf("verify without a record: err = %v", err)
+	}
+
+	resolver.Set(added.Challenge.Name, "unrelated", added.Challenge.Value)
+	verified, err := svc.VerifyDomain("acme", "learn.acme.com", nil)
+	if err != nil || verified.Status != types.DomainVerified {
+		t.Fatalf("verify with the record: %+v, %v", verified, err)
+	}
+	if ns := svc.ResolveHost("LEARN.acme.com."); ns != "acme" {
+		t.Fatalf("verified domain resolved to %q", ns)
+	}
+
+	// A failed lookup is not evidence the record is gone.
+	resolver.down = true
+	if n := svc.RecheckVerified(); n != 0 {
+		t.Fatalf("recheck during a DNS outage unverified %d domains", n)
+	}
+	if ns := svc.ResolveHost("learn.acme.com"); ns != "acme" {
+		t.Fatalf("domain stopped resolving during a DNS outage: %q", ns)
+	}
+	resolver.down = false
+
+	if n := svc.RecheckVerified(); n != 0 {
+		t.Fatalf("recheck with the record unverified %d domains", n)
+	}
+
+	resolver.Set(added.Challenge.Name)
+	if n := svc.RecheckVerified(); n != 1 {
+		t.Fatalf("recheck after removing the record unverified %d domains, want 1", n)
+	}
+	if ns := svc.ResolveHost("learn.acme.com"); ns != "" {
+		t.Fatalf("domain without its record still resolves to %q", ns)
+	}
+	d, _ := domains.GetDomain("learn.acme.com")
+	if d.Status != types.DomainPending || d.VerifiedAt != nil || d.LastError == "" {
+		t.Fatalf("unverified domain stored as %+v", d)
+	}
+
+	// The owner can publish the record again within the pending window.
+	resolver.Set(added.Challenge.Name, added.Challenge.Value)
+	if n := svc.VerifyPending(); n != 1 {
+		t.Fatalf("verify pending found %d domains, want 1", n)
+	}
+	if ns := svc.ResolveHost("learn.acme.com"); ns != "acme" {
+		t.Fatalf("reverified domain resolved to %q", ns)
+	}
+}
+
+func TestDomainReservedAndTaken(t *testing.T) {
+	svc, _ := newTestDomainService(dns.NewStaticResolver())
+
+	for _, domain := range []string{"cms.example.com", "acme.cms.example.com", "localhost"} {
+		if _, err := svc.AddDomain("acme", domain, nil); !errors.Is(err, ErrDomainReserved) {
+			t.Errorf("add %s: err = %v, want ErrDomainReserved", domain, err)
+		}
+	}
+
+	if _, err := svc.AddDomain("acme", "learn.acme.com", nil); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	if _, err := svc.AddDomain("acme", "learn.acme.com", nil); !errors.Is(err, ErrDomainTaken) {
+		t.Fatalf("second claim: err = %v, want ErrDomainTaken", err)
+	}
+	if _, err := svc.AddDomain("nobody", "other.example.org", nil); !errors.Is(err, ErrUnknownTenant) {
+		t.Fatalf("unknown tenant: err = %v, want ErrUnknownTenant", err)
+	}
+}
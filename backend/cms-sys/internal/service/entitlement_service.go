@@ -0,0 +1,236 @@
+package service
+
+import (
+	"errors"
+	"github.com/google/uuid"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/repository"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/types"
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/events"
+	"github.com/sirupsen/logrus"
+	"sync"
+	"time"
+)
+
+// EntitlementService answers whether a customer may use a system.
+// HasSystem and Systems may answer from a short-lived cache; Entitlement
+// always reads the database.
+type EntitlementService interface {
+	HasSystem(customerID uuid.UUID, system types.SystemType) (bool, error)
+	Systems(customerID uuid.UUID) ([]types.SystemType, error)
+	Entitlement(customerID uuid.UUID, system types.SystemType) (*types.Entitlement, error)
+}
+
+type EntitlementDeps struct {
+	Catalog       Catalog
+	Purchases     repository.PurchaseRepository
+	Subscriptions repository.SubscriptionRepository
+	Bus           events.Bus
+}
+
+type EntitlementConfig struct {
+	// CacheTTL is how long HasSystem reuses an answer. Purchase, subscription
+	// and ownership changes drop the affected answers straight away; the TTL
+	// bounds what other instances may still serve. Zero disables the cache.
+	CacheTTL time.Duration
+}
+
+// entitlementCacheSize bounds the cached answers. A full cache first drops
+// expired answers and starts over if none had expired.
+const entitlementCacheSize = 10000
+
+type entitlementKey struct {
+	customerID uuid.UUID
+	system     types.SystemType
+}
+
+type cachedEntitlement struct {
+	entitled bool
+	expires  time.Time
+}
+
+type EntitlementSvc struct {
+	log           *logrus.Logger
+	catalog       Catalog
+	purchases     repository.PurchaseRepository
+	subscriptions repository.SubscriptionRepository
+	cfg           EntitlementConfig
+
+	mu    sync.Mutex
+	cache map[entitlementKey]cachedEntitlement
+}
+
+var _ EntitlementService = (*EntitlementSvc)(nil)
+
+func NewEntitlementService(log *logrus.Logger, deps EntitlementDeps, cfg EntitlementConfig) *EntitlementSvc {
+	s := &EntitlementSvc{
+		log:           log,
+		catalog:       deps.Catalog,
+		purchases:     deps.Purchases,
+		subscriptions: deps.Subscriptions,
+		cfg:           cfg,
+		cache:         make(map[entitlementKey]cachedEntitlement),
+	}
+
+	// Purchase changes name the customer. A subscription also pays for
+	// purchases that moved to other customers with their tenants, and a plan
+	// change may affect every subscriber, so those drop every answer.
+	deps.Bus.Subscribe(events.PurchaseCreated, s.forgetCustomer)
+	deps.Bus.Subscribe(events.PurchaseCanceled, s.forgetCustomer)
+	for _, event := range []string{
+		events.SubscriptionCreated, events.SubscriptionActivated, events.SubscriptionPlanChanged,
+		events.SubscriptionCanceled, events.SubscriptionExpired, events.PlanUpdated,
+	} {
+		deps.Bus.Subscribe(event, func(events.Event) { s.forgetAll() })
+	}
+	deps.Bus.Subscribe(events.TenantOwnershipTransferred, s.forgetTransfer)
+	return s
+}
+
+func (s *EntitlementSvc) HasSystem(customerID uuid.UUID, system types.SystemType) (bool, error) {
+	key := entitlementKey{customerID: customerID, system: system}
+	if s.cfg.CacheTTL > 0 {
+		s.mu.Lock()
+		cached, ok := s.cache[key]
+		s.mu.Unlock()
+		if ok && time.Now().Before(cached.expires) {
+			return cached.entitled, nil
+		}
+	}
+
+	entitlement, err := s.Entitlement(customerID, system)
+	if err != nil {
+		return false, err
+	}
+	if s.cfg.CacheTTL > 0 {
+		s.remember(key, entitlement.Entitled)
+	}
+	return entitlement.Entitled, nil
+}
+
+// Systems lists the systems the customer may use.
+func (s *EntitlementSvc) Systems(customerID uuid.UUID) ([]types.SystemType, error) {
+	codes, err := s.catalog.Codes()
+	if err != nil {
+		return nil, err
+	}
+	var systems []types.SystemType
+	for _, system := range codes {
+		entitled, err := s.HasSystem(customerID, system)
+		if err != nil {
+			return nil, err
+		}
+		if entitled {
+			systems = append(systems, system)
+		}
+	}
+	return systems, nil
+}
+
+// Entitlement reports whether the customer may use the system. An active
+// purchase granted by an admin entitles on its own; any other purchase only
+// counts while the subscription paying for it is live and includes the
+// system. That subscription may belong to a previous owner of the tenant the
+// purchase is attached to. Purchases recorded without a subscription fall
+// back to the customer's live subscription.
+func (s *EntitlementSvc) Entitlement(customerID uuid.UUID, system types.SystemType) (*types.Entitlement, error) {
+	known, err := s.catalog.Known(system)
+	if err != nil {
+		return nil, err
+	}
+	system = known.Code
+	entitlement := &types.Entitlement{System: system}
+	purchase, err := s.purchases.GetPurchase(customerID, system)
+	if err != nil {
+		if errors.Is(err, repository.ErrPurchaseNotFound) {
+			return entitlement, nil
+		}
+		return nil, errors.New("failed to check entitlement")
+	}
+	if !purchase.Active() {
+		return entitlement, nil
+	}
+	entitlement.Namespace = purchase.Namespace
+	if purchase.GrantedBy != nil {
+		entitlement.Entitled = true
+		entitlement.Source = types.EntitlementGrant
+		return entitlement, nil
+	}
+
+	var sub *types.Subscription
+	if purchase.SubscriptionID != nil {
+		sub, err = s.subscriptions.GetSubscription(*purchase.SubscriptionID)
+	} else {
+		sub, err = s.subscriptions.GetLiveSubscription(customerID)
+	}
+	if err != nil {
+		if errors.Is(err, repository.ErrSubscriptionNotFound) {
+			return entitlement, nil
+		}
+		return nil, errors.New("failed to check entitlement")
+	}
+	if !sub.Status.Live() {
+		return entitlement, nil
+	}
+	entitlement.SubscriptionStatus = sub.Status
+	if sub.Plan.Includes(system) {
+		entitlement.Entitled = true
+		entitlement.Source = types.EntitlementSubscription
+	}
+	return entitlement, nil
+}
+
+func (s *EntitlementSvc) remember(key entitlementKey, entitled bool) {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.cache) >= entitlementCacheSize {
+		for k, cached := range s.cache {
+			if !now.Before(cached.expires) {
+				delete(s.cache, k)
+			}
+		}
+		if len(s.cache) >= entitlementCacheSize {
+			s.cache = make(map[entitlementKey]cachedEntitlement)
+		}
+	}
+	s.cache[key] = cachedEntitlement{entitled: entitled, expires: now.Add(s.cfg.CacheTTL)}
+}
+
+func (s *EntitlementSvc) forgetCustomer(e events.Event) {
+	customerID, ok := e.Payload["customer_id"].(uuid.UUID)
+	if !ok {
+		s.forgetAll()
+		return
+	}
+	s.forget(customerID)
+}
+
+// forgetTransfer drops the answers of both owners, whose purchases just
+// moved between them.
+func (s *EntitlementSvc) forgetTransfer(e events.Event) {
+	from, okFrom := e.Payload["from"].(uuid.UUID)
+	to, okTo := e.Payload["to"].(uuid.UUID)
+	if !okFrom || !okTo {
+		s.forgetAll()
+		return
+	}
+	s.forget(from, to)
+}
+
+func (s *EntitlementSvc) forget(customerIDs ...uuid.UUID) {
+	s.mu.Lock()
+	for key := range s.cache {
+		for _, id := range customerIDs {
+			if key.customerID == id {
+				delete(s.cache, key)
+			}
+		}
+	}
+	s.mu.Unlock()
+}
+
+func (s *EntitlementSvc) forgetAll() {
+	s.mu.Lock()
+	s.cache = make(map[entitlementKey]cachedEntitlement)
+	s.mu.Unlock()
+}
@@ -0,0 +1,524 @@
+package service
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/repository"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/types"
+	"github.com/sirupsen/logrus"
+	"math"
+	"slices"
+	"time"
+)
+
+// GrowthService answers how customers convert, stay and pay: signup cohorts,
+// the conversion funnel, recurring revenue, churn and revenue by system.
+// Results are computed in the database and kept as aggregates, so repeated
+// requests for the same months are served without scanning the tables again.
+type GrowthService interface {
+	Cohorts(query types.GrowthQuery, fresh bool) (*types.CohortMatrix, error)
+	Funnel(query types.GrowthQuery, fresh bool) (*types.GrowthFunnel, error)
+	MRR(query types.GrowthQuery, fresh bool) (*types.MRRSeries, error)
+	Churn(query types.GrowthQuery, fresh bool) (*types.ChurnSeries, error)
+	Revenue(query types.GrowthQuery, fresh bool) (*types.RevenueBySystem, error)
+	Refresh(ctx context.Context) (*types.GrowthRefreshReport, error)
+}
+
+type GrowthConfig struct {
+	// CacheTTL is how long a computed aggregate answers requests before it
+	// is computed again.
+	CacheTTL time.Duration
+	// DefaultMonths is the span of a query without from, and of the
+	// aggregates Refresh keeps warm.
+	DefaultMonths int
+	// MaxMonths caps the number of months a query may span.
+	MaxMonths int
+	// Retention drops aggregates not computed for this long; zero keeps them.
+	Retention time.Duration
+}
+
+type GrowthDeps struct {
+	Repo    repository.GrowthRepository
+	Catalog Catalog
+}
+
+type GrowthSvc struct {
+	log     *logrus.Logger
+	repo    repository.GrowthRepository
+	catalog Catalog
+	cfg     GrowthConfig
+}
+
+var _ GrowthService = (*GrowthSvc)(nil)
+
+func NewGrowthService(log *logrus.Logger, deps GrowthDeps, cfg GrowthConfig) *GrowthSvc {
+	return &GrowthSvc{
+		log:     log,
+		repo:    deps.Repo,
+		catalog: deps.Catalog,
+		cfg:     cfg,
+	}
+}
+
+// Cohorts builds the conversion and retention matrix of the customers who
+// signed up in each month of the query.
+func (s *GrowthSvc) Cohorts(query types.GrowthQuery, fresh bool) (*types.CohortMatrix, error) {
+	query, err := s.checkQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	query.System = ""
+
+	var matrix types.CohortMatrix
+	computedAt, err := s.cached(types.AggregateCohorts, query, fresh, &matrix, func() (interface{}, error) {
+		return s.cohorts(query)
+	})
+	if err != nil {
+		return nil, err
+	}
+	matrix.ComputedAt = computedAt
+	return &matrix, nil
+}
+
+func (s *GrowthSvc) cohorts(query types.GrowthQuery) (*types.CohortMatrix, error) {
+	sizes, err := s.repo.CohortSizes(query.From, query.To)
+	if err != nil {
+		return nil, errors.New("failed to count cohorts")
+	}
+	conversions, err := s.repo.CohortConversions(query.From, query.To)
+	if err != nil {
+		return nil, errors.New("failed to count cohort conversions")
+	}
+	retention, err := s.repo.CohortRetention(query.From, query.To)
+	if err != nil {
+		return nil, errors.New("failed to count cohort retention")
+	}
+
+	matrix := &types.CohortMatrix{From: query.From, To: query.To, Cohorts: []types.CohortRow{}}
+	rows := make(map[time.Time]*types.CohortRow)
+	for month := query.From; !month.After(query.To); month = month.AddDate(0, 1, 0) {
+		periods := monthsApart(month, query.To) + 1
+		matrix.Cohorts = append(matrix.Cohorts, types.CohortRow{
+			Cohort:    month,
+			Converted: make([]int64, periods),
+			Retained:  make([]int64, periods),
+		})
+	}
+	for i := range matrix.Cohorts {
+		rows[matrix.Cohorts[i].Cohort] = &matrix.Cohorts[i]
+	}
+
+	for _, cell := range sizes {
+		if row := rows[growthMonth(cell.Cohort)]; row != nil {
+			row.Size = cell.Count
+		}
+	}
+	for _, cell := range conversions {
+		row := rows[growthMonth(cell.Cohort)]
+		if row == nil || cell.Period >= len(row.Converted) {
+			continue
+		}
+		// A purchase dated before the signup counts as converting at once.
+		row.Converted[max(cell.Period, 0)] += cell.Count
+	}
+	for _, cell := range retention {
+		if row := rows[growthMonth(cell.Cohort)]; row != nil && cell.Period >= 0 && cell.Period < len(row.Retained) {
+			row.Retained[cell.Period] = cell.Count
+		}
+	}
+
+	for i := range matrix.Cohorts {
+		row := &matrix.Cohorts[i]
+		row.ConversionRate = make([]float64, len(row.Converted))
+		row.RetentionRate = make([]float64, len(row.Retained))
+		for period := range row.Converted {
+			if period > 0 {
+				row.Converted[period] += row.Converted[period-1]
+			}
+			row.ConversionRate[period] = ratio(row.Converted[period], row.Size)
+			row.RetentionRate[period] = ratio(row.Retained[period], row.Size)
+		}
+	}
+	return matrix, nil
+}
+
+// Funnel follows the customers who signed up in the query's months through
+// verification, their first purchase and first payment to still holding a
+// purchase today.
+func (s *GrowthSvc) Funnel(query types.GrowthQuery, fresh bool) (*types.GrowthFunnel, error) {
+	query, err := s.checkQuery(query)
+	if err != nil {
+		return nil, err
+	}
+
+	var funnel types.GrowthFunnel
+	computedAt, err := s.cached(types.AggregateFunnel, query, fresh, &funnel, func() (interface{}, error) {
+		counts, err := s.repo.Funnel(query.From, query.To, query.System)
+		if err != nil {
+			return nil, errors.New("failed to count conversion funnel")
+		}
+		return funnelOf(query, counts), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	funnel.ComputedAt = computedAt
+	return &funnel, nil
+}
+
+func funnelOf(query types.GrowthQuery, counts *types.FunnelCounts) *types.GrowthFunnel {
+	funnel := &types.GrowthFunnel{
+		From:   query.From,
+		To:     query.To,
+		System: query.System,
+		TimeToConvert: types.ConversionTimes{
+			MedianDays: roundDays(counts.MedianDays),
+			P75Days:    roundDays(counts.P75Days),
+			P90Days:    roundDays(counts.P90Days),
+			Buckets: []types.ConversionBucket{
+				{Label: "under 1 day", Count: counts.WithinDay},
+				{Label: "1-7 days", Count: counts.WithinWeek},
+				{Label: "7-30 days", Count: counts.WithinMonth},
+				{Label: "30-90 days", Count: counts.WithinQuarter},
+				{Label: "90 days or more", Count: counts.Later},
+			},
+		},
+	}
+
+	stages := []struct {
+		name  string
+		count int64
+	}{
+		{types.FunnelRegistered, counts.Registered},
+		{types.FunnelVerified, counts.Verified},
+		{types.FunnelPurchased, counts.Purchased},
+		{types.FunnelPaid, counts.Paid},
+		{types.FunnelActive, counts.Active},
+	}
+	previous := counts.Registered
+	for _, stage := range stages {
+		funnel.Stages = append(funnel.Stages, types.FunnelStage{
+			Stage:    stage.name,
+			Count:    stage.count,
+			Rate:     ratio(stage.count, counts.Registered),
+			StepRate: ratio(stage.count, previous),
+		})
+		previous = stage.count
+	}
+	return funnel
+}
+
+// MRR reports the recurring revenue of paying subscriptions at the end of
+// each month, per currency, and how much was won and lost in the month.
+func (s *GrowthSvc) MRR(query types.GrowthQuery, fresh bool) (*types.MRRSeries, error) {
+	query, err := s.checkQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	months, computedAt, err := s.subscriptionMonths(query, fresh)
+	if err != nil {
+		return nil, err
+	}
+
+	series := &types.MRRSeries{From: query.From, To: query.To, Points: []types.MRRPoint{}, ComputedAt: computedAt}
+	for _, month := range months {
+		point := types.MRRPoint{
+			Month:           month.Month,
+			Currency:        month.Currency,
+			MRRCents:        month.MRRCents,
+			ARRCents:        month.MRRCents * 12,
+			NewMRRCents:     month.NewMRRCents,
+			ChurnedMRRCents: month.ChurnedMRRCents,
+			NetNewMRRCents:  month.NewMRRCents - month.ChurnedMRRCents,
+			Customers:       month.Customers,
+		}
+		if month.Customers > 0 {
+			point.ARPACents = month.MRRCents / month.Customers
+		}
+		series.Points = append(series.Points, point)
+	}
+	return series, nil
+}
+
+// Churn reports, per month and currency, the paying customers and recurring
+// revenue lost in the month against those at its start.
+func (s *GrowthSvc) Churn(query types.GrowthQuery, fresh bool) (*types.ChurnSeries, error) {
+	query, err := s.checkQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	months, computedAt, err := s.subscriptionMonths(query, fresh)
+	if err != nil {
+		return nil, err
+	}
+
+	series := &types.ChurnSeries{From: query.From, To: query.To, Points: []types.ChurnPoint{}, ComputedAt: computedAt}
+	for _, month := range months {
+		point := types.ChurnPoint{
+			Month:            month.Month,
+			Currency:         month.Currency,
+			StartCustomers:   month.StartCustomers,
+			NewCustomers:     month.NewCustomers,
+			ChurnedCustomers: month.ChurnedCustomers,
+			EndCustomers:     month.Customers,
+		}
+		if month.StartCustomers > 0 {
+			rate := ratio(month.ChurnedCustomers, month.StartCustomers)
+			point.CustomerChurnRate = &rate
+		}
+		if month.StartMRRCents > 0 {
+			rate := ratio(month.ChurnedMRRCents, month.StartMRRCents)
+			point.RevenueChurnRate = &rate
+		}
+		series.Points = append(series.Points, point)
+	}
+	return series, nil
+}
+
+// subscriptionMonths is the aggregate MRR and Churn are both read from.
+func (s *GrowthSvc) subscriptionMonths(query types.GrowthQuery, fresh bool) ([]types.SubscriptionMonth, time.Time, error) {
+	query.System = ""
+	var months []types.SubscriptionMonth
+	computedAt, err := s.cached(types.AggregateSubscriptions, query, fresh, &months, func() (interface{}, error) {
+		months, err := s.repo.SubscriptionMonths(query.From, query.To)
+		if err != nil {
+			return nil, errors.New("failed to sum subscriptions")
+		}
+		return months, nil
+	})
+	return months, computedAt, err
+}
+
+// Revenue splits the money collected in each month over the systems it paid
+// for and totals it per system over the query.
+func (s *GrowthSvc) Revenue(query types.GrowthQuery, fresh bool) (*types.RevenueBySystem, error) {
+	query, err := s.checkQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	query.System = ""
+
+	var revenue types.RevenueBySystem
+	computedAt, err := s.cached(types.AggregateRevenue, query, fresh, &revenue, func() (interface{}, error) {
+		return s.revenue(query)
+	})
+	if err != nil {
+		return nil, err
+	}
+	revenue.ComputedAt = computedAt
+	return &revenue, nil
+}
+
+func (s *GrowthSvc) revenue(query types.GrowthQuery) (*types.RevenueBySystem, error) {
+	byPlan, err := s.repo.RevenueByPlan(query.From, query.To)
+	if err != nil {
+		return nil, errors.New("failed to sum revenue")
+	}
+	planSystems, err := s.repo.PlanSystems()
+	if err != nil {
+		return nil, errors.New("failed to list plan systems")
+	}
+
+	type key struct {
+		month    time.Time
+		system   types.SystemType
+		currency string
+	}
+	months := make(map[key]*types.SystemRevenue)
+	totals := make(map[key]*types.SystemRevenue)
+	add := func(into map[key]*types.SystemRevenue, k key, cents, payments int64) {
+		row := into[k]
+		if row == nil {
+			row = &types.SystemRevenue{System: k.system, Currency: k.currency}
+			if !k.month.IsZero() {
+				month := k.month
+				row.Month = &month
+			}
+			into[k] = row
+		}
+		row.RevenueCents += cents
+		row.Payments += payments
+	}
+
+	for _, row := range byPlan {
+		var systems []types.SystemType
+		if row.PlanID != nil {
+			systems = planSystems[*row.PlanID]
+		}
+		if len(systems) == 0 {
+			systems = []types.SystemType{""}
+		}
+		// Split evenly; the first systems take the cents that do not divide.
+		share, rest := row.RevenueCents/int64(len(systems)), row.RevenueCents%int64(len(systems))
+		for i, system := range systems {
+			cents := share
+			if int64(i) < rest {
+				cents++
+			}
+			month := growthMonth(row.Month)
+			add(months, key{month, system, row.Currency}, cents, row.Payments)
+			add(totals, key{time.Time{}, system, row.Currency}, cents, row.Payments)
+		}
+	}
+
+	result := &types.RevenueBySystem{
+		From:   query.From,
+		To:     query.To,
+		Months: make([]types.SystemRevenue, 0, len(months)),
+		Totals: make([]types.SystemRevenue, 0, len(totals)),
+	}
+	for _, row := range months {
+		result.Months = append(result.Months, *row)
+	}
+	for _, row := range totals {
+		result.Totals = append(result.Totals, *row)
+	}
+	slices.SortFunc(result.Months, func(a, b types.SystemRevenue) int {
+		return cmp.Or(a.Month.Compare(*b.Month), cmp.Compare(a.Currency, b.Currency), cmp.Compare(a.System, b.System))
+	})
+	slices.SortFunc(result.Totals, func(a, b types.SystemRevenue) int {
+		return cmp.Or(cmp.Compare(a.Currency, b.Currency), cmp.Compare(b.RevenueCents, a.RevenueCents), cmp.Compare(a.System, b.System))
+	})
+	return result, nil
+}
+
+// Refresh computes the aggregates of the default query again so requests for
+// it never wait, and drops aggregates past their retention. One failing
+// aggregate does not stop the others.
+func (s *GrowthSvc) Refresh(ctx context.Context) (*types.GrowthRefreshReport, error) {
+	query, err := s.checkQuery(types.GrowthQuery{})
+	if err != nil {
+		return nil, err
+	}
+
+	report := &types.GrowthRefreshReport{}
+	refreshers := []struct {
+		kind types.GrowthAggregateKind
+		run  func() error
+	}{
+		{types.AggregateCohorts, func() error { _, err := s.Cohorts(query, true); return err }},
+		{types.AggregateFunnel, func() error { _, err := s.Funnel(query, true); return err }},
+		{types.AggregateSubscriptions, func() error { _, _, err := s.subscriptionMonths(query, true); return err }},
+		{types.AggregateRevenue, func() error { _, err := s.Revenue(query, true); return err }},
+	}
+	for _, refresher := range refreshers {
+		if ctx.Err() != nil {
+			break
+		}
+		if err := refresher.run(); err != nil {
+			s.log.WithError(err).WithField("kind", refresher.kind).Warn("Failed to refresh growth aggregate")
+			report.Failed = append(report.Failed, string(refresher.kind))
+			continue
+		}
+		report.Refreshed++
+	}
+
+	if s.cfg.Retention > 0 {
+		if _, err := s.repo.DeleteAggregatesBefore(time.Now().Add(-s.cfg.Retention)); err != nil {
+			s.log.WithError(err).Warn("Failed to prune growth aggregates")
+		}
+	}
+	return report, nil
+}
+
+// cached answers from the stored aggregate of kind for query unless fresh is
+// set or it is older than the cache TTL; otherwise it computes the result,
+// stores it and decodes it into out, so both paths return the same JSON. It
+// returns when the result was computed.
+func (s *GrowthSvc) cached(kind types.GrowthAggregateKind, query types.GrowthQuery, fresh bool, out interface{}, compute func() (interface{}, error)) (time.Time, error) {
+	key := growthKey(query)
+	if !fresh {
+		aggregate, err := s.repo.GetAggregate(kind, key)
+		if err == nil && time.Since(aggregate.ComputedAt) < s.cfg.CacheTTL {
+			if err := json.Unmarshal([]byte(aggregate.Data), out); err == nil {
+				return aggregate.ComputedAt, nil
+			}
+			s.log.WithField("kind", kind).Warn("Discarding unreadable growth aggregate")
+		}
+	}
+
+	value, err := compute()
+	if err != nil {
+		return time.Time{}, err
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return time.Time{}, err
+	}
+	computedAt := time.Now().UTC()
+	err = s.repo.SaveAggregate(&types.GrowthAggregate{
+		Kind:       string(kind),
+		Key:        key,
+		Data:       string(data),
+		ComputedAt: computedAt,
+	})
+	if err != nil {
+		// The result is still good; the next request computes it again.
+		s.log.WithError(err).WithField("kind", kind).Warn("Failed to store growth aggregate")
+	}
+	return computedAt, json.Unmarshal(data, out)
+}
+
+// checkQuery normalises a query to whole months. A zero To is the current
+// month and a zero From reaches DefaultMonths back from To.
+func (s *GrowthSvc) checkQuery(query types.GrowthQuery) (types.GrowthQuery, error) {
+	if query.To.IsZero() {
+		query.To = time.Now()
+	}
+	query.To = growthMonth(query.To)
+	if query.From.IsZero() {
+		query.From = query.To.AddDate(0, 1-max(s.cfg.DefaultMonths, 1), 0)
+	}
+	query.From = growthMonth(query.From)
+	if query.To.Before(query.From) {
+		return query, ErrInvalidRange
+	}
+	if s.cfg.MaxMonths > 0 && monthsApart(query.From, query.To) >= s.cfg.MaxMonths {
+		return query, fmt.Errorf("%w: at most %d months", ErrInvalidRange, s.cfg.MaxMonths)
+	}
+	if query.System != "" {
+		system, err := s.catalog.Known(query.System)
+		if err != nil {
+			return query, err
+		}
+		query.System = system.Code
+	}
+	return query, nil
+}
+
+func growthKey(query types.GrowthQuery) string {
+	key := query.From.Format("2006-01") + ".." + query.To.Format("2006-01")
+	if query.System != "" {
+		key += "/" + string(query.System)
+	}
+	return key
+}
+
+// growthMonth is the first instant of t's month in UTC.
+func growthMonth(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+func monthsApart(from, to time.Time) int {
+	return (to.Year()-from.Year())*12 + int(to.Month()) - int(from.Month())
+}
+
+// ratio is part over whole to four decimals, or zero without a whole.
+func ratio(part, whole int64) float64 {
+	if whole == 0 {
+		return 0
+	}
+	return math.Round(float64(part)/float64(whole)*10000) / 10000
+}
+
+func roundDays(days *float64) *float64 {
+	if days == nil {
+		return nil
+	}
+	rounded := math.Round(*days*10) / 10
+	return &rounded
+}
@@ -0,0 +1,530 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/isolation"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/repository"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/types"
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/events"
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/mailer"
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/utils"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvitationNotFound  = errors.New("invitation not found")
+	ErrInvitationPending   = errors.New("address already has a pending invitation, resend it instead")
+	ErrInvitationInvalid   = errors.New("invitation link is invalid, used or expired")
+	ErrInvitationsDisabled = errors.New("invitation signing key is not configured")
+	ErrStudentMembership   = errors.New("students cannot become tenant members")
+	ErrPasswordRequired    = errors.New("a password is required to create the account")
+	// ErrAccountCredentials is returned when an invitation names an existing
+	// LMS account and the password given is not that account's.
+	ErrAccountCredentials = errors.New("the password of the existing account is required")
+	ErrAccountOtherTenant = errors.New("the account belongs to another tenant")
+)
+
+const invitationSecretSize = 16
+
+// InvitationService invites staff into a tenant's LMS. An invite link carries
+// a signed token naming the invitation and a secret; the invitation row only
+// stores a hash of the secret, so links cannot be rebuilt from the database.
+type InvitationService interface {
+	Invite(namespace string, actorID *uuid.UUID, req *types.InviteMemberRequest) (*types.TenantInvitation, error)
+	ListInvitations(namespace string, actorID *uuid.UUID) ([]types.TenantInvitation, error)
+	Resend(namespace string, id uuid.UUID, actorID *uuid.UUID) (*types.TenantInvitation, error)
+	Revoke(namespace string, id uuid.UUID, actorID *uuid.UUID) error
+	Preview(token string) (*types.InvitationPreview, error)
+	Accept(req *types.AcceptInvitationRequest) (*types.InvitationAcceptance, error)
+	ExpireInvitations() int
+}
+
+type InvitationConfig struct {
+	// SigningKey signs invite tokens. Invitations are refused without it.
+	SigningKey []byte
+	// TTL is how long an invite link stays valid after it was last sent.
+	TTL time.Duration
+	// AcceptURL is the page invitees land on; the token is appended as the
+	// "token" query parameter.
+	AcceptURL string
+}
+
+type InvitationDeps struct {
+	Repo      repository.InvitationRepository
+	Tenants   repository.TenantRepository
+	Members   MemberService
+	Metering  MeteringService
+	Audit     repository.AuditRepository
+	DB        *gorm.DB
+	Isolation *isolation.Selector
+	Mailer    mailer.Mailer
+	Bus       events.Bus
+}
+
+type InvitationSvc struct {
+	log       *logrus.Logger
+	repo      repository.InvitationRepository
+	tenants   repository.TenantRepository
+	members   MemberService
+	metering  MeteringService
+	audit     repository.AuditRepository
+	db        *gorm.DB
+	isolation *isolation.Selector
+	mailer    mailer.Mailer
+	bus       events.Bus
+	cfg       InvitationConfig
+}
+
+var _ InvitationService = (*InvitationSvc)(nil)
+
+func NewInvitationService(log *logrus.Logger, deps InvitationDeps, cfg InvitationConfig) *InvitationSvc {
+	s := &InvitationSvc{
+		log:       log,
+		repo:      deps.Repo,
+		tenants:   deps.Tenants,
+		members:   deps.Members,
+		metering:  deps.Metering,
+		audit:     deps.Audit,
+		db:        deps.DB,
+		isolation: deps.Isolation,
+		mailer:    deps.Mailer,
+		bus:       deps.Bus,
+		cfg:       cfg,
+	}
+
+	deps.Bus.Subscribe(events.TenantPurged, func(e events.Event) {
+		if err := s.repo.DeleteNamespace(e.Namespace); err != nil {
+			s.log.WithError(err).WithField("namespace", e.Namespace).Warn("Failed to remove tenant invitations")
+		}
+	})
+	return s
+}
+
+func (s *InvitationSvc) Invite(namespace string, actorID *uuid.UUID, req *types.InviteMemberRequest) (*types.TenantInvitation, error) {
+	if len(s.cfg.SigningKey) == 0 {
+		return nil, ErrInvitationsDisabled
+	}
+	tenant, err := s.ownedTenant(namespace, actorID)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, hash, err := newInvitationSecret()
+	if err != nil {
+		return nil, errors.New("failed to create invitation")
+	}
+	invitation := &types.TenantInvitation{
+		Namespace: tenant.Namespace,
+		Email:     strings.ToLower(strings.TrimSpace(req.Email)),
+		Role:      req.Role,
+		TokenHash: hash,
+		InvitedBy: actorID,
+		ExpiresAt: time.Now().Add(s.cfg.TTL),
+	}
+	created, err := s.repo.CreateInvitation(invitation)
+	if err != nil {
+		return nil, errors.New("failed to create invitation")
+	}
+	if !created {
+		return nil, ErrInvitationPending
+	}
+
+	s.send(invitation, secret)
+	s.record(actorID, events.TenantInvitationSent, tenant, invitationDetails(invitation))
+	return invitation, nil
+}
+
+func (s *InvitationSvc) ListInvitations(namespace string, actorID *uuid.UUID) ([]types.TenantInvitation, error) {
+	tenant, err := s.ownedTenant(namespace, actorID)
+	if err != nil {
+		return nil, err
+	}
+	s.ExpireInvitations()
+	invitations, err := s.repo.ListInvitations(tenant.Namespace)
+	if err != nil {
+		return nil, errors.New("failed to list invitations")
+	}
+	return invitations, nil
+}
+
+// Resend mails a fresh link and restarts the expiry. Earlier links for the
+// invitation stop working.
+func (s *InvitationSvc) Resend(namespace string, id uuid.UUID, actorID *uuid.UUID) (*types.TenantInvitation, error) {
+	if len(s.cfg.SigningKey) == 0 {
+		return nil, ErrInvitationsDisabled
+	}
+	tenant, invitation, err := s.tenantInvitation(namespace, id, actorID)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, hash, err := newInvitationSecret()
+	if err != nil {
+		return nil, errors.New("failed to resend invitation")
+	}
+	invitation.TokenHash = hash
+	invitation.ExpiresAt = time.Now().Add(s.cfg.TTL)
+	rotated, err := s.repo.RotateToken(invitation)
+	if err != nil {
+		return nil, errors.New("failed to resend invitation")
+	}
+	if !rotated {
+		return nil, ErrInvitationInvalid
+	}
+
+	s.send(invitation, secret)
+	s.record(actorID, events.TenantInvitationSent, tenant, invitationDetails(invitation))
+	return invitation, nil
+}
+
+func (s *InvitationSvc) Revoke(namespace string, id uuid.UUID, actorID *uuid.UUID) error {
+	tenant, invitation, err := s.tenantInvitation(namespace, id, actorID)
+	if err != nil {
+		return err
+	}
+	revoked, err := s.repo.RevokeInvitation(invitation.InvitationID)
+	if err != nil {
+		return errors.New("failed to revoke invitation")
+	}
+	if !revoked {
+		return ErrInvitationInvalid
+	}
+
+	invitation.Status = types.InvitationRevoked
+	s.record(actorID, events.TenantInvitationRevoked, tenant, invitationDetails(invitation))
+	return nil
+}
+
+// Preview describes the invitation behind a token without redeeming it.
+func (s *InvitationSvc) Preview(token string) (*types.InvitationPreview, error) {
+	invitation, tenant, _, err := s.redeemable(token)
+	if err != nil {
+		return nil, err
+	}
+
+	preview := &types.InvitationPreview{
+		Namespace: invitation.Namespace,
+		Email:     invitation.Email,
+		Role:      invitation.Role,
+		ExpiresAt: invitation.ExpiresAt,
+	}
+	err = s.isolation.WithTenant(context.Background(), s.db, tenant, func(tx *gorm.DB) error {
+		account, err := findLMSAccount(tx, invitation.Email)
+		preview.HasAccount = account != nil
+		return err
+	})
+	if err != nil {
+		return nil, errors.New("failed to load invitation")
+	}
+	return preview, nil
+}
+
+// Accept redeems an invite link. It links the invitee's existing LMS account
+// or creates one, makes it a tenant member and uses up the invitation, all in
+// one transaction. Students are refused here rather than by the
+// prevent_student_tenant_membership trigger, so callers get a clear error.
+//
+// The route is public and a link may be forwarded, so linking an existing
+// account takes that account's password. Its role is only ever raised; an
+// LMS admin invited as an instructor stays an admin.
+func (s *InvitationSvc) Accept(req *types.AcceptInvitationRequest) (*types.InvitationAcceptance, error) {
+	invitation, tenant, hash, err := s.redeemable(req.Token)
+	if err != nil {
+		return nil, err
+	}
+
+	acceptance := &types.InvitationAcceptance{Namespace: tenant.Namespace, Role: invitation.Role}
+	reserved := false
+	err = s.isolation.WithTenant(context.Background(), s.db, tenant, func(tx *gorm.DB) error {
+		claimed, err := repository.NewInvitationRepo(s.log, tx).ClaimInvitation(invitation.InvitationID, hash, time.Now())
+		if err != nil {
+			return err
+		}
+		if !claimed {
+			return ErrInvitationInvalid
+		}
+
+		account, err := findLMSAccount(tx, invitation.Email)
+		if err != nil {
+			return err
+		}
+		switch {
+		case account != nil && account.Role == "STUDENT":
+			return ErrStudentMembership
+		case account != nil && account.TenantID != nil && *account.TenantID != tenant.TenantID:
+			return ErrAccountOtherTenant
+		case account != nil:
+			if req.Password == "" || utils.CheckPassword(req.Password, account.Password) != nil {
+				return ErrAccountCredentials
+			}
+			acceptance.LMSUserID = account.ID
+			if inviteRank[types.InviteRole(account.Role)] >= inviteRank[invitation.Role] {
+				acceptance.Role = types.InviteRole(account.Role)
+				break
+			}
+			err = tx.Exec(`UPDATE LMS_USER SET lms_role_id = (SELECT lms_role_id FROM LMS_USER_Role WHERE lms_role_name = ?),
+				updated_at = CURRENT_TIMESTAMP WHERE lms_user_id = ?`, string(invitation.Role), account.ID).Error
+		default:
+			if req.Password == "" {
+				return ErrPasswordRequired
+			}
+			if err := s.metering.Reserve(tenant.Namespace, types.MetricUsers, 1); err != nil {
+				return err
+			}
+			reserved = true
+			acceptance.LMSUserID, err = createLMSAccount(tx, tenant, invitation, req.Password)
+			acceptance.Created = true
+		}
+		if err != nil {
+			return err
+		}
+
+		err = tx.Exec(`INSERT INTO Tenants_Members (lms_user_id, tenant_id) VALUES (?, ?)
+			ON CONFLICT (lms_user_id, tenant_id) DO UPDATE SET is_active = TRUE`,
+			acceptance.LMSUserID, tenant.TenantID).Error
+		if err != nil {
+			return err
+		}
+		if err := repository.NewInvitationRepo(s.log, tx).SetLMSUser(invitation.InvitationID, acceptance.LMSUserID); err != nil {
+			return err
+		}
+
+		details := invitationDetails(invitation)
+		details["lms_user_id"] = acceptance.LMSUserID
+		details["created"] = acceptance.Created
+		details["role"] = acceptance.Role
+		return repository.NewAuditRepo(s.log, tx).Record(nil, events.TenantInvitationAccepted, "tenant", tenant.TenantID.String(), &tenant.Namespace, details)
+	})
+	if err != nil {
+		if reserved {
+			s.metering.Release(tenant.Namespace, types.MetricUsers, 1)
+		}
+		var quota *types.QuotaError
+		if errors.Is(err, ErrInvitationInvalid) || errors.Is(err, ErrStudentMembership) ||
+			errors.Is(err, ErrPasswordRequired) || errors.Is(err, ErrAccountCredentials) ||
+			errors.Is(err, ErrAccountOtherTenant) || errors.As(err, &quota) {
+			return nil, err
+		}
+		s.log.WithError(err).WithField("namespace", tenant.Namespace).Error("Failed to accept invitation")
+		return nil, errors.New("failed to accept invitation")
+	}
+
+	s.bus.Publish(events.Event{
+		Type:      events.TenantInvitationAccepted,
+		Namespace: tenant.Namespace,
+		Payload: map[string]interface{}{
+			"invitation_id": invitation.InvitationID,
+			"lms_user_id":   acceptance.LMSUserID,
+			"role":          acceptance.Role,
+		},
+	})
+	return acceptance, nil
+}
+
+func (s *InvitationSvc) ExpireInvitations() int {
+	n, err := s.repo.ExpireInvitations(time.Now())
+	if err != nil {
+		return 0
+	}
+	return int(n)
+}
+
+// redeemable resolves a token to a pending invitation of an active tenant
+// and the hash its secret must match.
+func (s *InvitationSvc) redeemable(token string) (*types.TenantInvitation, *types.Tenant, string, error) {
+	if len(s.cfg.SigningKey) == 0 {
+		return nil, nil, "", ErrInvitationsDisabled
+	}
+	id, hash, ok := s.parseToken(token)
+	if !ok {
+		return nil, nil, "", ErrInvitationInvalid
+	}
+	invitation, err := s.repo.GetInvitation(id)
+	if err != nil {
+		if errors.Is(err, repository.ErrInvitationNotFound) {
+			return nil, nil, "", ErrInvitationInvalid
+		}
+		return nil, nil, "", errors.New("failed to load invitation")
+	}
+	if invitation.Status != types.InvitationPending || invitation.TokenHash != hash || time.Now().After(invitation.ExpiresAt) {
+		return nil, nil, "", ErrInvitationInvalid
+	}
+
+	tenant, err := s.tenants.GetTenantByNamespace(invitation.Namespace)
+	if err != nil {
+		return nil, nil, "", ErrInvitationInvalid
+	}
+	if !tenant.IsActive() {
+		return nil, nil, "", ErrTenantSuspended
+	}
+	return invitation, tenant, hash, nil
+}
+
+// token is base64url(invitation id || secret) "." hex(HMAC of those bytes).
+func (s *InvitationSvc) token(id uuid.UUID, secret []byte) string {
+	raw := append(id[:], secret...)
+	return base64.RawURLEncoding.EncodeToString(raw) + "." + utils.HMACSign(s.cfg.SigningKey, raw)
+}
+
+func (s *InvitationSvc) parseToken(token string) (uuid.UUID, string, bool) {
+	payload, signature, found := strings.Cut(token, ".")
+	if !found {
+		return uuid.Nil, "", false
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil || len(raw) != len(uuid.Nil)+invitationSecretSize {
+		return uuid.Nil, "", false
+	}
+	if !utils.HMACVerify(s.cfg.SigningKey, raw, signature) {
+		return uuid.Nil, "", false
+	}
+	id, err := uuid.FromBytes(raw[:len(uuid.Nil)])
+	if err != nil {
+		return uuid.Nil, "", false
+	}
+	return id, hashSecret(raw[len(uuid.Nil):]), true
+}
+
+// send mails the invite link. Delivery failures are logged rather than
+// returned: the invitation exists and can be resent.
+func (s *InvitationSvc) send(invitation *types.TenantInvitation, secret []byte) {
+	link := s.cfg.AcceptURL + "?token=" + url.QueryEscape(s.token(invitation.InvitationID, secret))
+	msg := mailer.Message{
+		To:      invitation.Email,
+		Subject: fmt.Sprintf("You have been invited to join %s", invitation.Namespace),
+		Body: fmt.Sprintf("You have been invited to join %s as %s.\n\nAccept the invitation here:\n%s\n\nThe link can be used once and expires on %s.\n",
+			invitation.Namespace, invitation.Role, link, invitation.ExpiresAt.UTC().Format(time.RFC1123)),
+	}
+
+	ctx, cancel := utils.GetContextWithTimeout(30 * time.Second)
+	defer cancel()
+	if err := s.mailer.Send(ctx, msg); err != nil {
+		s.log.WithError(err).WithField("namespace", invitation.Namespace).Warn("Failed to send invitation")
+		return
+	}
+	now := time.Now()
+	invitation.LastSentAt = &now
+	invitation.SendCount++
+	if err := s.repo.MarkSent(invitation.InvitationID, now); err != nil {
+		s.log.WithError(err).Warn("Failed to record invitation send")
+	}
+}
+
+func (s *InvitationSvc) tenantInvitation(namespace string, id uuid.UUID, actorID *uuid.UUID) (*types.Tenant, *types.TenantInvitation, error) {
+	tenant, err := s.ownedTenant(namespace, actorID)
+	if err != nil {
+		return nil, nil, err
+	}
+	invitation, err := s.repo.GetInvitation(id)
+	if err != nil {
+		if errors.Is(err, repository.ErrInvitationNotFound) {
+			return nil, nil, ErrInvitationNotFound
+		}
+		return nil, nil, errors.New("failed to load invitation")
+	}
+	if invitation.Namespace != tenant.Namespace {
+		return nil, nil, ErrInvitationNotFound
+	}
+	return tenant, invitation, nil
+}
+
+func (s *InvitationSvc) ownedTenant(namespace string, actorID *uuid.UUID) (*types.Tenant, error) {
+	if err := s.members.RequireOwner(namespace, actorID); err != nil {
+		return nil, err
+	}
+	ns, _ := utils.NormalizeNamespace(namespace)
+	tenant, err := s.tenants.GetTenantByNamespace(ns)
+	if err != nil {
+		return nil, ErrUnknownTenant
+	}
+	return tenant, nil
+}
+
+func (s *InvitationSvc) record(actorID *uuid.UUID, action string, tenant *types.Tenant, details map[string]interface{}) {
+	if err := s.audit.Record(actorID, action, "tenant", tenant.TenantID.String(), &tenant.Namespace, details); err != nil {
+		s.log.WithError(err).Warn("Failed to audit invitation")
+	}
+	s.bus.Publish(events.Event{
+		Type:      action,
+		Namespace: tenant.Namespace,
+		ActorID:   actorID,
+		Payload:   details,
+	})
+}
+
+type lmsAccount struct {
+	ID       uuid.UUID
+	Role     string
+	Password string
+	TenantID *uuid.UUID
+}
+
+// inviteRank orders the roles an invitation can grant. Other roles rank
+// lowest.
+var inviteRank = map[types.InviteRole]int{
+	types.InviteInstructor: 1,
+	types.InviteLMSAdmin:   2,
+}
+
+func findLMSAccount(tx *gorm.DB, email string) (*lmsAccount, error) {
+	var accounts []lmsAccount
+	err := tx.Raw(`SELECT u.lms_user_id AS id, r.lms_role_name::text AS role, u.password, u.tenant_id
+		FROM LMS_USER u JOIN LMS_USER_Role r ON r.lms_role_id = u.lms_role_id
+		WHERE lower(u.lms_user_email) = ?
+		LIMIT 1`, strings.ToLower(email)).Scan(&accounts).Error
+	if err != nil || len(accounts) == 0 {
+		return nil, err
+	}
+	return &accounts[0], nil
+}
+
+func createLMSAccount(tx *gorm.DB, tenant *types.Tenant, invitation *types.TenantInvitation, password string) (uuid.UUID, error) {
+	hashed, err := utils.HashPassword(password)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	var id string
+	err = tx.Raw(`INSERT INTO LMS_USER (lms_user_email, password, lms_role_id, tenant_id, registration_date)
+		SELECT ?, ?, lms_role_id, ?, CURRENT_DATE FROM LMS_USER_Role WHERE lms_role_name = ?
+		RETURNING lms_user_id::text`, invitation.Email, hashed, tenant.TenantID, string(invitation.Role)).Scan(&id).Error
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if id == "" {
+		return uuid.Nil, fmt.Errorf("role %s is missing from the tenant schema", invitation.Role)
+	}
+	return uuid.Parse(id)
+}
+
+func newInvitationSecret() ([]byte, string, error) {
+	secret := make([]byte, invitationSecretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, "", err
+	}
+	return secret, hashSecret(secret), nil
+}
+
+func hashSecret(secret []byte) string {
+	sum := sha256.Sum256(secret)
+	return hex.EncodeToString(sum[:])
+}
+
+func invitationDetails(invitation *types.TenantInvitation) map[string]interface{} {
+	return map[string]interface{}{
+		"invitation_id": invitation.InvitationID,
+		"email":         invitation.Email,
+		"role":          invitation.Role,
+		"status":        invitation.Status,
+	}
+}
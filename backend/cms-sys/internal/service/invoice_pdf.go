@@ -0,0 +1,138 @@
+package service
+
+import (
+	"fmt"
+	"github.com/jung-kurt/gofpdf"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/types"
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/pdfdraw"
+	"io"
+	"strings"
+)
+
+// renderInvoice draws the invoice on a portrait A4 page with the same frame
+// and header as the course certificates.
+func renderInvoice(w io.Writer, invoice *types.Invoice, brand pdfdraw.Brand, issuer []string) error {
+	pdf := pdfdraw.New("P")
+	pdf.SetTitle("Invoice "+invoice.Number, true)
+	pdf.SetAuthor(brand.Name, true)
+
+	pdfdraw.DrawMainBorder(pdf, brand)
+	pdfdraw.DrawHeader(pdf, brand)
+	pdfdraw.DrawTitle(pdf, "INVOICE", 52)
+
+	// Issuer on the left, invoice details on the right.
+	top := pdf.GetY() + 4
+	pdf.SetFont("Arial", "", 10)
+	pdf.SetXY(30, top)
+	for _, line := range issuer {
+		pdf.SetX(30)
+		pdfdraw.Text(pdf, 80, 5, line, "", 2, "L")
+	}
+
+	details := [][2]string{
+		{"Invoice number", invoice.Number},
+		{"Issue date", invoice.IssuedAt.Format("2 Jan 2006")},
+	}
+	if invoice.PeriodStart != nil && invoice.PeriodEnd != nil {
+		details = append(details, [2]string{"Service period", invoice.PeriodStart.Format("2 Jan 2006") + " - " + invoice.PeriodEnd.Format("2 Jan 2006")})
+	}
+	pdf.SetY(top)
+	for _, d := range details {
+		pdf.SetX(110)
+		pdf.SetFont("Arial", "B", 10)
+		pdfdraw.Text(pdf, 32, 5, d[0], "", 0, "L")
+		pdf.SetFont("Arial", "", 10)
+		pdfdraw.Text(pdf, 38, 5, d[1], "", 1, "R")
+	}
+
+	// Bill to.
+	y := max(pdf.GetY(), top+float64(len(issuer))*5) + 8
+	pdf.SetXY(30, y)
+	pdf.SetFont("Arial", "B", 11)
+	pdfdraw.SetAccent(pdf, brand)
+	pdfdraw.Text(pdf, 0, 6, "Bill to", "", 1, "L")
+	pdf.SetTextColor(45, 45, 45)
+	pdf.SetFont("Arial", "", 10)
+	pdf.SetX(30)
+	pdfdraw.Text(pdf, 0, 5, invoice.BillToName, "", 1, "L")
+	pdf.SetX(30)
+	pdfdraw.Text(pdf, 0, 5, invoice.BillToEmail, "", 1, "L")
+
+	drawInvoiceLines(pdf, invoice, brand)
+
+	// Footer.
+	pdf.SetFont("Arial", "", 9)
+	pdf.SetTextColor(110, 110, 110)
+	pdf.SetY(-42)
+	pdfdraw.Text(pdf, 0, 5, "Thank you for your business.", "", 1, "C")
+	pdfdraw.Text(pdf, 0, 5, fmt.Sprintf("Invoice ID: %s", invoice.InvoiceID), "", 1, "C")
+
+	return pdf.Output(w)
+}
+
+// drawInvoiceLines prints the item table followed by subtotal, tax lines and
+// total.
+func drawInvoiceLines(pdf *gofpdf.Fpdf, invoice *types.Invoice, brand pdfdraw.Brand) {
+	const left, descW, qtyW, unitW, amountW = 30.0, 80.0, 15.0, 27.5, 27.5
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+
+	y := pdf.GetY() + 10
+	pdf.SetXY(left, y)
+	pdf.SetFont("Arial", "B", 10)
+	pdf.SetFillColor(brand.Color[0], brand.Color[1], brand.Color[2])
+	pdf.SetTextColor(255, 255, 255)
+	pdf.CellFormat(descW, 8, "Description", "", 0, "L", true, 0, "")
+	pdf.CellFormat(qtyW, 8, "Qty", "", 0, "R", true, 0, "")
+	pdf.CellFormat(unitW, 8, "Unit price", "", 0, "R", true, 0, "")
+	pdf.CellFormat(amountW, 8, "Amount", "", 1, "R", true, 0, "")
+
+	pdf.SetTextColor(45, 45, 45)
+	pdf.SetFont("Arial", "", 10)
+	for _, line := range invoice.Lines {
+		if line.Kind == types.InvoiceLineTax {
+			continue
+		}
+		pdf.SetX(left)
+		pdf.CellFormat(descW, 8, tr(line.Description), "B", 0, "L", false, 0, "")
+		pdf.CellFormat(qtyW, 8, fmt.Sprint(line.Quantity), "B", 0, "R", false, 0, "")
+		pdf.CellFormat(unitW, 8, formatMoney(line.UnitCents, invoice.Currency), "B", 0, "R", false, 0, "")
+		pdf.CellFormat(amountW, 8, formatMoney(line.AmountCents, invoice.Currency), "B", 1, "R", false, 0, "")
+	}
+
+	labelX, labelW := left+descW-30, 30+qtyW+unitW
+	total := func(label string, cents int64) {
+		pdf.SetX(labelX)
+		pdf.CellFormat(labelW, 7, tr(label), "", 0, "R", false, 0, "")
+		pdf.CellFormat(amountW, 7, formatMoney(cents, invoice.Currency), "", 1, "R", false, 0, "")
+	}
+	pdf.SetXY(labelX, pdf.GetY()+2)
+	total("Subtotal", invoice.SubtotalCents)
+	for _, line := range invoice.Lines {
+		if line.Kind == types.InvoiceLineTax {
+			total(line.Description, line.AmountCents)
+		}
+	}
+
+	y = pdf.GetY() + 1
+	pdf.SetDrawColor(brand.Color[0], brand.Color[1], brand.Color[2])
+	pdf.SetLineWidth(0.6)
+	pdf.Line(labelX, y, labelX+labelW+amountW, y)
+	pdf.SetXY(labelX, y+1)
+	pdf.SetFont("Arial", "B", 11)
+	total("Total", invoice.TotalCents)
+}
+
+// formatMoney prints cents as a decimal amount with the currency code.
+func formatMoney(cents int64, currency string) string {
+	sign := ""
+	if cents < 0 {
+		sign, cents = "-", -cents
+	}
+	return fmt.Sprintf("%s%d.%02d %s", sign, cents/100, cents%100, currency)
+}
+
+// formatBasisPoints prints 750 as "7.5".
+func formatBasisPoints(bp int64) string {
+	s := fmt.Sprintf("%d.%02d", bp/100, bp%100)
+	return strings.TrimSuffix(strings.TrimRight(s, "0"), ".")
+}
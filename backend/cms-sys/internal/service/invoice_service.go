@@ -0,0 +1,397 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/repository"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/types"
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/events"
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/mailer"
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/pdfdraw"
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/utils"
+	"github.com/sirupsen/logrus"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+var (
+	ErrInvoiceNotFound  = errors.New("invoice not found")
+	ErrInvoicesDisabled = errors.New("invoice storage is not configured")
+)
+
+// InvoiceService issues invoices for subscription payments, renders them as
+// PDF and mails them to the customer. Invoices are issued from subscription
+// events, so every charged start, activation and renewal gets exactly one.
+type InvoiceService interface {
+	ListInvoices(customerID *uuid.UUID) ([]types.Invoice, error)
+	GetInvoice(id uuid.UUID, customerID *uuid.UUID) (*types.Invoice, error)
+	InvoiceFile(id uuid.UUID, customerID *uuid.UUID) (*types.Invoice, string, error)
+	Resend(id uuid.UUID, actorID *uuid.UUID) error
+	IssueForSubscription(subscriptionID uuid.UUID) (*types.Invoice, error)
+}
+
+// InvoiceTax is a tax added on top of the subtotal, in basis points.
+type InvoiceTax struct {
+	Label       string
+	BasisPoints int64
+}
+
+type InvoiceConfig struct {
+	// Dir holds rendered PDFs, one folder per year.
+	Dir string
+	// Taxes are applied to every invoice, each on the subtotal.
+	Taxes []InvoiceTax
+	// Brand is printed in the header; Issuer lines go under it.
+	Brand  string
+	Issuer []string
+}
+
+type InvoiceDeps struct {
+	Repo          repository.InvoiceRepository
+	Subscriptions repository.SubscriptionRepository
+	Users         repository.AuthRepository
+	Audit         repository.AuditRepository
+	Mailer        mailer.Mailer
+	Jobs          *JobRunner
+	Bus           events.Bus
+	// Coupons is optional; without it invoices carry no discounts.
+	Coupons repository.CouponRepository
+}
+
+type InvoiceSvc struct {
+	log           *logrus.Logger
+	repo          repository.InvoiceRepository
+	subscriptions repository.SubscriptionRepository
+	users         repository.AuthRepository
+	audit         repository.AuditRepository
+	mailer        mailer.Mailer
+	jobs          *JobRunner
+	bus           events.Bus
+	coupons       repository.CouponRepository
+	cfg           InvoiceConfig
+}
+
+var _ InvoiceService = (*InvoiceSvc)(nil)
+
+func NewInvoiceService(log *logrus.Logger, deps InvoiceDeps, cfg InvoiceConfig) *InvoiceSvc {
+	s := &InvoiceSvc{
+		log:           log,
+		repo:          deps.Repo,
+		subscriptions: deps.Subscriptions,
+		users:         deps.Users,
+		audit:         deps.Audit,
+		mailer:        deps.Mailer,
+		jobs:          deps.Jobs,
+		bus:           deps.Bus,
+		coupons:       deps.Coupons,
+		cfg:           cfg,
+	}
+
+	// A subscription is charged when it starts without a trial, when a trial
+	// or past-due subscription becomes active, and on every renewal.
+	issue := func(e events.Event) {
+		if status, _ := e.Payload["status"].(types.SubscriptionStatus); status != types.SubscriptionActive {
+			return
+		}
+		id, err := uuid.Parse(fmt.Sprint(e.Payload["subscription_id"]))
+		if err != nil {
+			return
+		}
+		if _, err := s.IssueForSubscription(id); err != nil {
+			s.log.WithError(err).WithField("subscription_id", id).Error("Failed to issue invoice")
+		}
+	}
+	deps.Bus.Subscribe(events.SubscriptionCreated, issue)
+	deps.Bus.Subscribe(events.SubscriptionActivated, issue)
+	deps.Bus.Subscribe(events.SubscriptionRenewed, issue)
+	return s
+}
+
+func (s *InvoiceSvc) ListInvoices(customerID *uuid.UUID) ([]types.Invoice, error) {
+	invoices, err := s.repo.ListInvoices(customerID)
+	if err != nil {
+		return nil, errors.New("failed to list invoices")
+	}
+	return invoices, nil
+}
+
+// GetInvoice loads an invoice. A non-nil customerID hides other customers'
+// invoices.
+func (s *InvoiceSvc) GetInvoice(id uuid.UUID, customerID *uuid.UUID) (*types.Invoice, error) {
+	invoice, err := s.repo.GetInvoice(id)
+	if err != nil {
+		if errors.Is(err, repository.ErrInvoiceNotFound) {
+			return nil, ErrInvoiceNotFound
+		}
+		return nil, errors.New("failed to load invoice")
+	}
+	if customerID != nil && invoice.CustomerID != *customerID {
+		return nil, ErrInvoiceNotFound
+	}
+	return invoice, nil
+}
+
+// InvoiceFile returns the path of the invoice PDF, rendering it first if the
+// delivery job has not done so yet.
+func (s *InvoiceSvc) InvoiceFile(id uuid.UUID, customerID *uuid.UUID) (*types.Invoice, string, error) {
+	invoice, err := s.GetInvoice(id, customerID)
+	if err != nil {
+		return nil, "", err
+	}
+	path, err := s.ensureFile(invoice)
+	if err != nil {
+		return nil, "", err
+	}
+	return invoice, path, nil
+}
+
+func (s *InvoiceSvc) Resend(id uuid.UUID, actorID *uuid.UUID) error {
+	invoice, err := s.GetInvoice(id, nil)
+	if err != nil {
+		return err
+	}
+	if err := s.deliver(utils.GetContext(), invoice); err != nil {
+		return err
+	}
+	if err := s.audit.Record(actorID, events.InvoiceResent, "invoice", invoice.InvoiceID.String(), nil, map[string]interface{}{
+		"number": invoice.Number,
+	}); err != nil {
+		s.log.WithError(err).Warn("Failed to audit invoice resend")
+	}
+	return nil
+}
+
+// IssueForSubscription invoices the subscription's current period at its
+// plan's price, less the coupon discount on the first invoice. A period that
+// is already invoiced, or a free plan, yields no invoice and no number.
+func (s *InvoiceSvc) IssueForSubscription(subscriptionID uuid.UUID) (*types.Invoice, error) {
+	sub, err := s.subscriptions.GetSubscription(subscriptionID)
+	if err != nil {
+		return nil, errors.New("failed to load subscription")
+	}
+	plan := &sub.Plan
+	if plan.PriceCents == 0 {
+		return nil, nil
+	}
+	customer, err := s.users.GetUserByID(sub.CustomerID)
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+	previous, err := s.repo.CountSubscriptionInvoices(sub.SubscriptionID)
+	if err != nil {
+		return nil, errors.New("failed to check previous invoices")
+	}
+
+	kind := types.InvoiceRenewal
+	if previous == 0 {
+		kind = types.InvoicePurchase
+	}
+	start, end := sub.CurrentPeriodStart, sub.CurrentPeriodEnd
+	invoice := &types.Invoice{
+		Kind:           kind,
+		CustomerID:     sub.CustomerID,
+		SubscriptionID: &sub.SubscriptionID,
+		PlanID:         &plan.PlanID,
+		BillToName:     customer.CMSUserName,
+		BillToEmail:    customer.CMSUserEmail,
+		Currency:       plan.Currency,
+		PeriodStart:    &start,
+		PeriodEnd:      &end,
+		IssuedAt:       time.Now(),
+	}
+	s.addLines(invoice, fmt.Sprintf("%s plan, %s to %s", plan.Name, start.Format("2 Jan 2006"), end.Format("2 Jan 2006")), plan.PriceCents)
+	if kind == types.InvoicePurchase {
+		if err := s.addDiscount(invoice, sub.SubscriptionID); err != nil {
+			return nil, err
+		}
+	}
+
+	created, err := s.repo.CreateInvoice(invoice)
+	if err != nil {
+		return nil, errors.New("failed to create invoice")
+	}
+	if !created {
+		return nil, nil
+	}
+
+	details := map[string]interface{}{
+		"number":          invoice.Number,
+		"customer_id":     invoice.CustomerID,
+		"subscription_id": sub.SubscriptionID,
+		"total_cents":     invoice.TotalCents,
+		"currency":        invoice.Currency,
+	}
+	if err := s.audit.Record(nil, events.InvoiceIssued, "invoice", invoice.InvoiceID.String(), nil, details); err != nil {
+		s.log.WithError(err).Warn("Failed to audit invoice")
+	}
+	s.bus.Publish(events.Event{Type: events.InvoiceIssued, Payload: details})
+
+	s.scheduleDelivery(invoice)
+	return invoice, nil
+}
+
+// addLines adds the billed item and one tax line per configured tax, and sets
+// the totals. Taxes round half up to the cent.
+func (s *InvoiceSvc) addLines(invoice *types.Invoice, description string, amount int64) {
+	invoice.Lines = append(invoice.Lines, types.InvoiceLine{
+		Position:    1,
+		Kind:        types.InvoiceLineItem,
+		Description: description,
+		Quantity:    1,
+		UnitCents:   amount,
+		AmountCents: amount,
+	})
+	invoice.SubtotalCents = amount
+	s.addTaxes(invoice)
+}
+
+// addDiscount takes the charged coupon discount of the subscription off the
+// subtotal and works the taxes out again.
+func (s *InvoiceSvc) addDiscount(invoice *types.Invoice, subscriptionID uuid.UUID) error {
+	if s.coupons == nil {
+		return nil
+	}
+	redemption, err := s.coupons.GetSubscriptionRedemption(subscriptionID)
+	if errors.Is(err, repository.ErrRedemptionNotFound) {
+		return nil
+	}
+	if err != nil {
+		return errors.New("failed to load coupon redemption")
+	}
+	if redemption.AppliedAt == nil || redemption.DiscountCents == 0 {
+		return nil
+	}
+	coupon := "coupon"
+	if c, err := s.coupons.GetCoupon(redemption.CouponID); err == nil {
+		coupon = c.Code
+	}
+
+	discount := min(redemption.DiscountCents, invoice.SubtotalCents)
+	s.dropTaxes(invoice)
+	invoice.Lines = append(invoice.Lines, types.InvoiceLine{
+		Position:    len(invoice.Lines) + 1,
+		Kind:        types.InvoiceLineDiscount,
+		Description: fmt.Sprintf("Discount (%s)", coupon),
+		Quantity:    1,
+		UnitCents:   -discount,
+		AmountCents: -discount,
+	})
+	invoice.SubtotalCents -= discount
+	s.addTaxes(invoice)
+	return nil
+}
+
+// addTaxes replaces the tax lines with ones on the current subtotal and sets
+// the totals.
+func (s *InvoiceSvc) addTaxes(invoice *types.Invoice) {
+	s.dropTaxes(invoice)
+	amount, first := invoice.SubtotalCents, len(invoice.Lines)+1
+	for i, tax := range s.cfg.Taxes {
+		cents := (amount*tax.BasisPoints + 5000) / 10000
+		invoice.Lines = append(invoice.Lines, types.InvoiceLine{
+			Position:        first + i,
+			Kind:            types.InvoiceLineTax,
+			Description:     fmt.Sprintf("%s (%s%%)", tax.Label, formatBasisPoints(tax.BasisPoints)),
+			Quantity:        1,
+			UnitCents:       cents,
+			RateBasisPoints: tax.BasisPoints,
+			AmountCents:     cents,
+		})
+		invoice.TaxCents += cents
+	}
+	invoice.TotalCents = invoice.SubtotalCents + invoice.TaxCents
+}
+
+func (s *InvoiceSvc) dropTaxes(invoice *types.Invoice) {
+	invoice.Lines = slices.DeleteFunc(invoice.Lines, func(line types.InvoiceLine) bool {
+		return line.Kind == types.InvoiceLineTax
+	})
+	invoice.TaxCents = 0
+}
+
+// scheduleDelivery renders and mails the invoice in the background so the
+// request that caused the charge does not wait for SMTP.
+func (s *InvoiceSvc) scheduleDelivery(invoice *types.Invoice) {
+	if s.jobs == nil {
+		if err := s.deliver(utils.GetContext(), invoice); err != nil {
+			s.log.WithError(err).WithField("invoice", invoice.Number).Warn("Failed to deliver invoice")
+		}
+		return
+	}
+	job := &types.Job{
+		JobID:       uuid.New(),
+		Kind:        types.JobInvoiceDelivery,
+		RequestedBy: &invoice.CustomerID,
+	}
+	err := s.jobs.Submit(job, func(ctx context.Context, job *types.Job) error {
+		return s.deliver(ctx, invoice)
+	})
+	if err != nil {
+		s.log.WithError(err).WithField("invoice", invoice.Number).Warn("Failed to queue invoice delivery")
+	}
+}
+
+func (s *InvoiceSvc) deliver(ctx context.Context, invoice *types.Invoice) error {
+	path, err := s.ensureFile(invoice)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read invoice file: %w", err)
+	}
+
+	err = s.mailer.Send(ctx, mailer.Message{
+		To:      invoice.BillToEmail,
+		Subject: fmt.Sprintf("Invoice %s from %s", invoice.Number, s.cfg.Brand),
+		Body: fmt.Sprintf("Hello %s,\n\nPlease find attached invoice %s for %s.\n\nThank you for your business.\n",
+			invoice.BillToName, invoice.Number, formatMoney(invoice.TotalCents, invoice.Currency)),
+		Attachments: []mailer.Attachment{{
+			Filename:    invoice.Number + ".pdf",
+			ContentType: "application/pdf",
+			Data:        data,
+		}},
+	})
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	invoice.EmailedAt = &now
+	return s.repo.MarkEmailed(invoice.InvoiceID, now)
+}
+
+// ensureFile renders the invoice unless its PDF is already on disk. Invoices
+// never change once issued, so a stored file is always current.
+func (s *InvoiceSvc) ensureFile(invoice *types.Invoice) (string, error) {
+	if invoice.FilePath != "" {
+		if _, err := os.Stat(invoice.FilePath); err == nil {
+			return invoice.FilePath, nil
+		}
+	}
+	if s.cfg.Dir == "" {
+		return "", ErrInvoicesDisabled
+	}
+
+	dir := filepath.Join(s.cfg.Dir, fmt.Sprint(invoice.Year))
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := renderInvoice(&buf, invoice, pdfdraw.NewBrand(s.cfg.Brand), s.cfg.Issuer); err != nil {
+		return "", fmt.Errorf("failed to render invoice: %w", err)
+	}
+	target := filepath.Join(dir, invoice.Number+".pdf")
+	if err := os.WriteFile(target, buf.Bytes(), 0o600); err != nil {
+		return "", err
+	}
+	if err := s.repo.SetFile(invoice.InvoiceID, target); err != nil {
+		return "", err
+	}
+	invoice.FilePath = target
+	return target, nil
+}
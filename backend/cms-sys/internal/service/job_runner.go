@@ -0,0 +1,139 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/repository"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/types"
+	"github.com/sirupsen/logrus"
+)
+
+var ErrJobNotFound = errors.New("job not found")
+
+// JobFunc does the work for a job. It may set ResultPath and ResultSize on the
+// job; the runner persists status transitions around it.
+type JobFunc func(ctx context.Context, job *types.Job) error
+
+// JobRunner executes jobs in background goroutines, at most concurrency at a
+// time, and records their progress in the job table.
+type JobRunner struct {
+	log    *logrus.Logger
+	repo   repository.JobRepository
+	slots  chan struct{}
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func NewJobRunner(log *logrus.Logger, repo repository.JobRepository, concurrency int) *JobRunner {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &JobRunner{
+		log:    log,
+		repo:   repo,
+		slots:  make(chan struct{}, concurrency),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// Recover fails jobs a previous process left unfinished.
+func (r *JobRunner) Recover() {
+	n, err := r.repo.FailInterrupted("interrupted by server restart")
+	if err != nil {
+		return
+	}
+	if n > 0 {
+		r.log.WithField("jobs", n).Warn("Marked interrupted jobs as failed")
+	}
+}
+
+func (r *JobRunner) Submit(job *types.Job, fn JobFunc) error {
+	job.Status = types.JobPending
+	if err := r.repo.CreateJob(job); err != nil {
+		return errors.New("failed to create job")
+	}
+
+	r.wg.Add(1)
+	go r.run(job, fn)
+	return nil
+}
+
+func (r *JobRunner) Get(id uuid.UUID) (*types.Job, error) {
+	job, err := r.repo.GetJobByID(id)
+	if err != nil {
+		if errors.Is(err, repository.ErrJobNotFound) {
+			return nil, ErrJobNotFound
+		}
+		return nil, errors.New("failed to load job")
+	}
+	return job, nil
+}
+
+// Shutdown cancels running jobs and waits for them to record their outcome.
+func (r *JobRunner) Shutdown() {
+	r.cancel()
+	r.wg.Wait()
+}
+
+func (r *JobRunner) run(job *types.Job, fn JobFunc) {
+	defer r.wg.Done()
+
+	select {
+	case r.slots <- struct{}{}:
+		defer func() { <-r.slots }()
+	case <-r.ctx.Done():
+		r.finish(job, r.ctx.Err())
+		return
+	}
+
+	now := time.Now()
+	job.Status = types.JobRunning
+	job.StartedAt = &now
+	if err := r.repo.UpdateJob(job); err != nil {
+		return
+	}
+
+	r.finish(job, r.call(job, fn))
+}
+
+func (r *JobRunner) call(job *types.Job, fn JobFunc) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("job panicked: %v", p)
+		}
+	}()
+	return fn(r.ctx, job)
+}
+
+func (r *JobRunner) finish(job *types.Job, err error) {
+	now := time.Now()
+	job.FinishedAt = &now
+	job.Status = types.JobSucceeded
+	if err != nil {
+		job.Status = types.JobFailed
+		job.Error = err.Error()
+	}
+
+	entry := r.log.WithFields(logrus.Fields{
+		"job_id": job.JobID,
+		"kind":   job.Kind,
+		"status": job.Status,
+	})
+	if err != nil {
+		entry.WithError(err).Error("Job failed")
+	} else {
+		entry.Info("Job finished")
+	}
+
+	if err := r.repo.UpdateJob(job); err != nil {
+		entry.WithError(err).Error("Failed to record job outcome")
+	}
+}
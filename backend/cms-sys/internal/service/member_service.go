@@ -0,0 +1,695 @@
+package service
+
+import (
+	"errors"
+	"github.com/google/uuid"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/isolation"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/repository"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/types"
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/events"
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/utils"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"time"
+)
+
+var (
+	ErrMemberNotFound   = errors.New("member not found")
+	ErrUserNotFound     = errors.New("user not found")
+	ErrNotTenantOwner   = errors.New("only a tenant owner can perform this action")
+	ErrPrimaryOwner     = errors.New("the primary owner can only change through an ownership transfer")
+	ErrTransferNotFound = errors.New("transfer not found")
+	ErrTransferPending  = errors.New("tenant already has a pending ownership transfer")
+	ErrTransferClosed   = errors.New("transfer is no longer pending")
+	ErrTransferSelf     = errors.New("recipient is already the primary owner")
+)
+
+// MemberService manages who can act on a tenant. The primary owner is the
+// tenant's OwnerID; further owners and admins are members. Primary ownership
+// changes hands in two steps, the owner offering and the recipient accepting,
+// or at once when the root admin forces it.
+type MemberService interface {
+	MemberRole(namespace string, userID uuid.UUID) (types.TenantMemberRole, bool)
+	RequireOwner(namespace string, actorID *uuid.UUID) error
+	ListMembers(namespace string) ([]types.MemberResponse, error)
+	AddMember(namespace string, actorID *uuid.UUID, req *types.AddMemberRequest) (*types.MemberResponse, error)
+	UpdateMember(namespace string, userID uuid.UUID, actorID *uuid.UUID, req *types.UpdateMemberRequest) (*types.MemberResponse, error)
+	RemoveMember(namespace string, userID uuid.UUID, actorID *uuid.UUID) error
+
+	InitiateTransfer(namespace string, actorID *uuid.UUID, req *types.TransferOwnershipRequest) (*types.OwnershipTransfer, error)
+	ListTransfers(namespace string) ([]types.OwnershipTransfer, error)
+	IncomingTransfers(userID uuid.UUID) ([]types.OwnershipTransfer, error)
+	AcceptTransfer(id uuid.UUID, actorID *uuid.UUID) (*types.OwnershipTransfer, error)
+	DeclineTransfer(id uuid.UUID, actorID *uuid.UUID) (*types.OwnershipTransfer, error)
+	CancelTransfer(namespace string, id uuid.UUID, actorID *uuid.UUID) (*types.OwnershipTransfer, error)
+	ForceTransfer(namespace string, actorID *uuid.UUID, req *types.TransferOwnershipRequest) (*types.OwnershipTransfer, error)
+	ExpireTransfers() int
+}
+
+type MemberConfig struct {
+	// TransferTTL is how long a recipient has to accept a transfer.
+	TransferTTL time.Duration
+}
+
+type MemberDeps struct {
+	Repo      repository.MemberRepository
+	Tenants   repository.TenantRepository
+	Users     repository.AuthRepository
+	Audit     repository.AuditRepository
+	DB        *gorm.DB
+	Isolation *isolation.Selector
+	Bus       events.Bus
+}
+
+type MemberSvc struct {
+	log       *logrus.Logger
+	repo      repository.MemberRepository
+	tenants   repository.TenantRepository
+	users     repository.AuthRepository
+	audit     repository.AuditRepository
+	db        *gorm.DB
+	isolation *isolation.Selector
+	bus       events.Bus
+	cfg       MemberConfig
+}
+
+var _ MemberService = (*MemberSvc)(nil)
+
+func NewMemberService(log *logrus.Logger, deps MemberDeps, cfg MemberConfig) *MemberSvc {
+	s := &MemberSvc{
+		log:       log,
+		repo:      deps.Repo,
+		tenants:   deps.Tenants,
+		users:     deps.Users,
+		audit:     deps.Audit,
+		db:        deps.DB,
+		isolation: deps.Isolation,
+		bus:       deps.Bus,
+		cfg:       cfg,
+	}
+
+	// The LMS purchase that pays for a tenant belongs to the tenant from the
+	// start, so it follows later ownership transfers.
+	deps.Bus.Subscribe(events.TenantProvisioned, func(e events.Event) {
+		tenant, err := s.tenants.GetTenantByNamespace(e.Namespace)
+		if err != nil {
+			return
+		}
+		if _, err := s.repo.AttachPurchase(tenant.Namespace, tenant.OwnerID, types.LMS); err != nil {
+			s.log.WithError(err).WithField("namespace", tenant.Namespace).Warn("Failed to attach purchase to tenant")
+		}
+	})
+	// A purchase made after the tenant exists, e.g. a later subscription or a
+	// reactivation, belongs to the tenant too.
+	deps.Bus.Subscribe(events.PurchaseCreated, s.attachPurchase)
+	deps.Bus.Subscribe(events.TenantPurged, func(e events.Event) {
+		if err := s.repo.DeleteNamespace(e.Namespace); err != nil {
+			s.log.WithError(err).WithField("namespace", e.Namespace).Warn("Failed to remove tenant members")
+		}
+	})
+	return s
+}
+
+// MemberRole reports the user's role on the tenant. Lookup failures deny
+// access.
+func (s *MemberSvc) MemberRole(namespace string, userID uuid.UUID) (types.TenantMemberRole, bool) {
+	tenant, err := s.memberTenant(namespace)
+	if err != nil {
+		return "", false
+	}
+	if tenant.OwnerID == userID {
+		return types.MemberOwner, true
+	}
+	member, err := s.repo.GetMember(tenant.Namespace, userID)
+	if err != nil {
+		return "", false
+	}
+	return member.Role, true
+}
+
+// RequireOwner returns ErrNotTenantOwner unless the actor is an owner of the
+// tenant or the root admin.
+func (s *MemberSvc) RequireOwner(namespace string, actorID *uuid.UUID) error {
+	_, err := s.ownedTenant(namespace, actorID)
+	return err
+}
+
+func (s *MemberSvc) ListMembers(namespace string) ([]types.MemberResponse, error) {
+	tenant, err := s.memberTenant(namespace)
+	if err != nil {
+		return nil, err
+	}
+	members, err := s.repo.ListMembers(tenant.Namespace)
+	if err != nil {
+		return nil, errors.New("failed to list members")
+	}
+
+	responses := make([]types.MemberResponse, 0, len(members)+1)
+	if owner, err := s.users.GetUserByID(tenant.OwnerID); err == nil {
+		responses = append(responses, types.MemberResponse{
+			UserID:    owner.CMSUserID,
+			Email:     owner.CMSUserEmail,
+			Name:      owner.CMSUserName,
+			Role:      types.MemberOwner,
+			Primary:   true,
+			CreatedAt: tenant.CreatedAt,
+		})
+	}
+	for i := range members {
+		if members[i].UserID == tenant.OwnerID {
+			continue
+		}
+		if response := s.toMemberResponse(&members[i]); response != nil {
+			responses = append(responses, *response)
+		}
+	}
+	return responses, nil
+}
+
+func (s *MemberSvc) AddMember(namespace string, actorID *uuid.UUID, req *types.AddMemberRequest) (*types.MemberResponse, error) {
+	tenant, err := s.ownedTenant(namespace, actorID)
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.users.GetUserByEmail(req.Email)
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+	if user.CMSUserID == tenant.OwnerID {
+		return nil, ErrPrimaryOwner
+	}
+
+	member := &types.TenantMember{
+		Namespace: tenant.Namespace,
+		UserID:    user.CMSUserID,
+		Role:      req.Role,
+		AddedBy:   actorID,
+		CreatedAt: time.Now(),
+	}
+	if err := s.repo.SaveMember(member); err != nil {
+		return nil, errors.New("failed to add member")
+	}
+	s.bindNamespace(user, tenant.Namespace)
+
+	s.record(actorID, events.TenantMemberAdded, tenant, map[string]interface{}{
+		"user_id": user.CMSUserID,
+		"role":    member.Role,
+	})
+	return s.toMemberResponse(member), nil
+}
+
+func (s *MemberSvc) UpdateMember(namespace string, userID uuid.UUID, actorID *uuid.UUID, req *types.UpdateMemberRequest) (*types.MemberResponse, error) {
+	tenant, err := s.ownedTenant(namespace, actorID)
+	if err != nil {
+		return nil, err
+	}
+	if userID == tenant.OwnerID {
+		return nil, ErrPrimaryOwner
+	}
+	member, err := s.repo.GetMember(tenant.Namespace, userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrMemberNotFound) {
+			return nil, ErrMemberNotFound
+		}
+		return nil, errors.New("failed to load member")
+	}
+
+	from := member.Role
+	member.Role = req.Role
+	if err := s.repo.SaveMember(member); err != nil {
+		return nil, errors.New("failed to update member")
+	}
+
+	s.record(actorID, events.TenantMemberUpdated, tenant, map[string]interface{}{
+		"user_id": userID,
+		"from":    from,
+		"to":      member.Role,
+	})
+	return s.toMemberResponse(member), nil
+}
+
+// RemoveMember is allowed to owners and to members leaving on their own.
+func (s *MemberSvc) RemoveMember(namespace string, userID uuid.UUID, actorID *uuid.UUID) error {
+	tenant, err := s.memberTenant(namespace)
+	if err != nil {
+		return err
+	}
+	if actorID == nil || *actorID != userID {
+		if err := s.requireOwner(tenant, actorID); err != nil {
+			return err
+		}
+	}
+	if userID == tenant.OwnerID {
+		return ErrPrimaryOwner
+	}
+	member, err := s.repo.GetMember(tenant.Namespace, userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrMemberNotFound) {
+			return ErrMemberNotFound
+		}
+		return errors.New("failed to load member")
+	}
+	if err := s.repo.DeleteMember(tenant.Namespace, userID); err != nil {
+		return errors.New("failed to remove member")
+	}
+	if user, err := s.users.GetUserByID(userID); err == nil {
+		s.unbindNamespace(user, tenant.Namespace)
+	}
+
+	s.record(actorID, events.TenantMemberRemoved, tenant, map[string]interface{}{
+		"user_id": userID,
+		"role":    member.Role,
+	})
+	return nil
+}
+
+// InitiateTransfer offers primary ownership to another user. Only the primary
+// owner, or the root admin on their behalf, can offer it.
+func (s *MemberSvc) InitiateTransfer(namespace string, actorID *uuid.UUID, req *types.TransferOwnershipRequest) (*types.OwnershipTransfer, error) {
+	tenant, err := s.memberTenant(namespace)
+	if err != nil {
+		return nil, err
+	}
+	if actorID == nil || (*actorID != tenant.OwnerID && !s.isRootAdmin(*actorID)) {
+		return nil, ErrNotTenantOwner
+	}
+	recipient, err := s.recipient(tenant, req.Email)
+	if err != nil {
+		return nil, err
+	}
+
+	transfer := &types.OwnershipTransfer{
+		Namespace:  tenant.Namespace,
+		FromUserID: tenant.OwnerID,
+		ToUserID:   recipient.CMSUserID,
+		KeepAccess: keepAccess(req),
+		Message:    req.Message,
+		ExpiresAt:  time.Now().Add(s.cfg.TransferTTL),
+		CreatedAt:  time.Now(),
+	}
+	created, err := s.repo.CreateTransfer(transfer)
+	if err != nil {
+		return nil, errors.New("failed to start transfer")
+	}
+	if !created {
+		return nil, ErrTransferPending
+	}
+
+	s.record(actorID, events.TenantTransferInitiated, tenant, transferDetails(transfer))
+	return transfer, nil
+}
+
+func (s *MemberSvc) ListTransfers(namespace string) ([]types.OwnershipTransfer, error) {
+	tenant, err := s.memberTenant(namespace)
+	if err != nil {
+		return nil, err
+	}
+	s.ExpireTransfers()
+	transfers, err := s.repo.ListTransfers(tenant.Namespace)
+	if err != nil {
+		return nil, errors.New("failed to list transfers")
+	}
+	return transfers, nil
+}
+
+func (s *MemberSvc) IncomingTransfers(userID uuid.UUID) ([]types.OwnershipTransfer, error) {
+	s.ExpireTransfers()
+	transfers, err := s.repo.ListIncoming(userID)
+	if err != nil {
+		return nil, errors.New("failed to list transfers")
+	}
+	return transfers, nil
+}
+
+// AcceptTransfer completes a transfer. Only the recipient can accept it.
+func (s *MemberSvc) AcceptTransfer(id uuid.UUID, actorID *uuid.UUID) (*types.OwnershipTransfer, error) {
+	transfer, tenant, err := s.pendingTransfer(id)
+	if err != nil {
+		return nil, err
+	}
+	if actorID == nil || *actorID != transfer.ToUserID {
+		return nil, ErrTransferNotFound
+	}
+	if tenant.OwnerID != transfer.FromUserID {
+		// Ownership moved some other way since the offer was made.
+		s.close(transfer, types.TransferCancelled, nil)
+		return nil, ErrTransferClosed
+	}
+
+	if err := s.transfer(tenant, transfer, actorID, types.TransferAccepted); err != nil {
+		return nil, err
+	}
+	return transfer, nil
+}
+
+func (s *MemberSvc) DeclineTransfer(id uuid.UUID, actorID *uuid.UUID) (*types.OwnershipTransfer, error) {
+	transfer, tenant, err := s.pendingTransfer(id)
+	if err != nil {
+		return nil, err
+	}
+	if actorID == nil || *actorID != transfer.ToUserID {
+		return nil, ErrTransferNotFound
+	}
+	if !s.close(transfer, types.TransferDeclined, actorID) {
+		return nil, ErrTransferClosed
+	}
+
+	s.record(actorID, events.TenantTransferDeclined, tenant, transferDetails(transfer))
+	return transfer, nil
+}
+
+// CancelTransfer withdraws a pending offer. Any owner of the tenant can.
+func (s *MemberSvc) CancelTransfer(namespace string, id uuid.UUID, actorID *uuid.UUID) (*types.OwnershipTransfer, error) {
+	transfer, tenant, err := s.pendingTransfer(id)
+	if err != nil {
+		return nil, err
+	}
+	ns, err := utils.NormalizeNamespace(namespace)
+	if err != nil || ns != transfer.Namespace {
+		return nil, ErrTransferNotFound
+	}
+	if err := s.requireOwner(tenant, actorID); err != nil {
+		return nil, err
+	}
+	if !s.close(transfer, types.TransferCancelled, actorID) {
+		return nil, ErrTransferClosed
+	}
+
+	s.record(actorID, events.TenantTransferCancelled, tenant, transferDetails(transfer))
+	return transfer, nil
+}
+
+// ForceTransfer is the root admin override for tenants whose owner cannot
+// act, e.g. because they left the customer. It applies at once and cancels
+// any pending offer.
+func (s *MemberSvc) ForceTransfer(namespace string, actorID *uuid.UUID, req *types.TransferOwnershipRequest) (*types.OwnershipTransfer, error) {
+	tenant, err := s.memberTenant(namespace)
+	if err != nil {
+		return nil, err
+	}
+	recipient, err := s.recipient(tenant, req.Email)
+	if err != nil {
+		return nil, err
+	}
+
+	pending, err := s.repo.ListTransfers(tenant.Namespace)
+	if err != nil {
+		return nil, errors.New("failed to load transfers")
+	}
+	for i := range pending {
+		if pending[i].Status == types.TransferPending {
+			s.close(&pending[i], types.TransferCancelled, actorID)
+		}
+	}
+
+	transfer := &types.OwnershipTransfer{
+		Namespace:  tenant.Namespace,
+		FromUserID: tenant.OwnerID,
+		ToUserID:   recipient.CMSUserID,
+		KeepAccess: keepAccess(req),
+		Message:    req.Message,
+		ExpiresAt:  time.Now(),
+		CreatedAt:  time.Now(),
+	}
+	created, err := s.repo.CreateTransfer(transfer)
+	if err != nil {
+		return nil, errors.New("failed to start transfer")
+	}
+	if !created {
+		return nil, ErrTransferPending
+	}
+	if err := s.transfer(tenant, transfer, actorID, types.TransferAccepted); err != nil {
+		return nil, err
+	}
+	return transfer, nil
+}
+
+// ExpireTransfers closes offers that were not accepted in time.
+func (s *MemberSvc) ExpireTransfers() int {
+	n, err := s.repo.ExpireTransfers(time.Now())
+	if err != nil {
+		return 0
+	}
+	return int(n)
+}
+
+// transfer makes the recipient primary owner in one transaction: registry,
+// memberships, purchases, audit entry and the LMS Tenants row.
+func (s *MemberSvc) transfer(tenant *types.Tenant, transfer *types.OwnershipTransfer, actorID *uuid.UUID, status types.TransferStatus) error {
+	now := time.Now()
+	transfer.Status = status
+	transfer.ResolvedAt = &now
+	transfer.ResolvedBy = actorID
+	tenant.OwnerID = transfer.ToUserID
+	tenant.UpdatedAt = now
+
+	details := transferDetails(transfer)
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		members := repository.NewMemberRepo(s.log, tx)
+		resolved, err := members.ResolveTransfer(transfer, types.TransferPending)
+		if err != nil {
+			return err
+		}
+		if !resolved {
+			return ErrTransferClosed
+		}
+
+		if err := repository.NewTenantRepo(s.log, tx).UpdateTenant(tenant); err != nil {
+			return err
+		}
+		if err := members.SaveMember(&types.TenantMember{
+			Namespace: tenant.Namespace,
+			UserID:    transfer.ToUserID,
+			Role:      types.MemberOwner,
+			AddedBy:   actorID,
+			CreatedAt: now,
+		}); err != nil {
+			return err
+		}
+		if transfer.KeepAccess {
+			err = members.SaveMember(&types.TenantMember{
+				Namespace: tenant.Namespace,
+				UserID:    transfer.FromUserID,
+				Role:      types.MemberAdmin,
+				AddedBy:   actorID,
+				CreatedAt: now,
+			})
+		} else {
+			err = members.DeleteMember(tenant.Namespace, transfer.FromUserID)
+		}
+		if err != nil {
+			return err
+		}
+
+		moved, err := members.MovePurchases(tenant.Namespace, transfer.ToUserID)
+		if err != nil {
+			return err
+		}
+		details["purchases_moved"] = moved
+
+		if err := repository.NewAuditRepo(s.log, tx).Record(actorID, events.TenantOwnershipTransferred, "tenant", tenant.TenantID.String(), &tenant.Namespace, details); err != nil {
+			return err
+		}
+
+		// Last, because scoping changes the transaction's search_path.
+		strategy, err := s.isolation.For(tenant)
+		if err != nil {
+			return err
+		}
+		if err := strategy.Scope(tx, tenant); err != nil {
+			return err
+		}
+		return tx.Exec("UPDATE Tenants SET cms_owner_id = ? WHERE tenant_id = ?", transfer.ToUserID, tenant.TenantID).Error
+	})
+	if err != nil {
+		if errors.Is(err, ErrTransferClosed) {
+			return err
+		}
+		s.log.WithError(err).WithField("namespace", tenant.Namespace).Error("Failed to transfer tenant ownership")
+		return errors.New("failed to transfer ownership")
+	}
+
+	if user, err := s.users.GetUserByID(transfer.ToUserID); err == nil {
+		s.bindNamespace(user, tenant.Namespace)
+	}
+	if !transfer.KeepAccess {
+		if user, err := s.users.GetUserByID(transfer.FromUserID); err == nil {
+			s.unbindNamespace(user, tenant.Namespace)
+		}
+	}
+
+	s.bus.Publish(events.Event{
+		Type:      events.TenantOwnershipTransferred,
+		Namespace: tenant.Namespace,
+		ActorID:   actorID,
+		Payload:   details,
+	})
+	s.log.WithFields(logrus.Fields{
+		"namespace": tenant.Namespace,
+		"from":      transfer.FromUserID,
+		"to":        transfer.ToUserID,
+	}).Info("Tenant ownership transferred")
+	return nil
+}
+
+func (s *MemberSvc) pendingTransfer(id uuid.UUID) (*types.OwnershipTransfer, *types.Tenant, error) {
+	transfer, err := s.repo.GetTransfer(id)
+	if err != nil {
+		if errors.Is(err, repository.ErrTransferNotFound) {
+			return nil, nil, ErrTransferNotFound
+		}
+		return nil, nil, errors.New("failed to load transfer")
+	}
+	if transfer.Status != types.TransferPending {
+		return nil, nil, ErrTransferClosed
+	}
+	if time.Now().After(transfer.ExpiresAt) {
+		s.close(transfer, types.TransferExpired, nil)
+		return nil, nil, ErrTransferClosed
+	}
+	tenant, err := s.memberTenant(transfer.Namespace)
+	if err != nil {
+		return nil, nil, err
+	}
+	return transfer, tenant, nil
+}
+
+// close resolves a pending transfer without transferring. It reports false if
+// the transfer was resolved concurrently.
+func (s *MemberSvc) close(transfer *types.OwnershipTransfer, status types.TransferStatus, actorID *uuid.UUID) bool {
+	now := time.Now()
+	transfer.Status = status
+	transfer.ResolvedAt = &now
+	transfer.ResolvedBy = actorID
+	closed, err := s.repo.ResolveTransfer(transfer, types.TransferPending)
+	return err == nil && closed
+}
+
+func (s *MemberSvc) recipient(tenant *types.Tenant, email string) (*types.CMSUser, error) {
+	user, err := s.users.GetUserByEmail(email)
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+	if user.CMSUserID == tenant.OwnerID {
+		return nil, ErrTransferSelf
+	}
+	return user, nil
+}
+
+func (s *MemberSvc) ownedTenant(namespace string, actorID *uuid.UUID) (*types.Tenant, error) {
+	tenant, err := s.memberTenant(namespace)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.requireOwner(tenant, actorID); err != nil {
+		return nil, err
+	}
+	return tenant, nil
+}
+
+func (s *MemberSvc) requireOwner(tenant *types.Tenant, actorID *uuid.UUID) error {
+	if actorID == nil {
+		return ErrNotTenantOwner
+	}
+	if role, ok := s.MemberRole(tenant.Namespace, *actorID); ok && role == types.MemberOwner {
+		return nil
+	}
+	if s.isRootAdmin(*actorID) {
+		return nil
+	}
+	return ErrNotTenantOwner
+}
+
+func (s *MemberSvc) isRootAdmin(userID uuid.UUID) bool {
+	user, err := s.users.GetUserByID(userID)
+	return err == nil && user.IsAdmin()
+}
+
+// bindNamespace makes the tenant the user's token namespace unless they are
+// already bound to another one.
+func (s *MemberSvc) bindNamespace(user *types.CMSUser, namespace string) {
+	if user.CMSNameSpace != nil {
+		return
+	}
+	user.CMSNameSpace = &namespace
+	if err := s.users.UpdateUser(user); err != nil {
+		s.log.WithError(err).Warn("Failed to link user to tenant namespace")
+	}
+}
+
+func (s *MemberSvc) unbindNamespace(user *types.CMSUser, namespace string) {
+	if user.NameSpace() != namespace {
+		return
+	}
+	user.CMSNameSpace = nil
+	if err := s.users.UpdateUser(user); err != nil {
+		s.log.WithError(err).Warn("Failed to unlink user from tenant namespace")
+	}
+}
+
+func (s *MemberSvc) memberTenant(namespace string) (*types.Tenant, error) {
+	ns, err := utils.NormalizeNamespace(namespace)
+	if err != nil {
+		return nil, ErrUnknownTenant
+	}
+	tenant, err := s.tenants.GetTenantByNamespace(ns)
+	if err != nil {
+		if errors.Is(err, repository.ErrTenantNotFound) {
+			return nil, ErrUnknownTenant
+		}
+		return nil, errors.New("failed to load tenant")
+	}
+	if tenant.Status == types.TenantPurged {
+		return nil, ErrUnknownTenant
+	}
+	return tenant, nil
+}
+
+func (s *MemberSvc) record(actorID *uuid.UUID, action string, tenant *types.Tenant, details map[string]interface{}) {
+	if err := s.audit.Record(actorID, action, "tenant", tenant.TenantID.String(), &tenant.Namespace, details); err != nil {
+		s.log.WithError(err).Warn("Failed to audit membership change")
+	}
+	s.bus.Publish(events.Event{
+		Type:      action,
+		Namespace: tenant.Namespace,
+		ActorID:   actorID,
+		Payload:   details,
+	})
+}
+
+func (s *MemberSvc) toMemberResponse(member *types.TenantMember) *types.MemberResponse {
+	user, err := s.users.GetUserByID(member.UserID)
+	if err != nil {
+		return nil
+	}
+	return &types.MemberResponse{
+		UserID:    member.UserID,
+		Email:     user.CMSUserEmail,
+		Name:      user.CMSUserName,
+		Role:      member.Role,
+		CreatedAt: member.CreatedAt,
+	}
+}
+
+func transferDetails(t *types.OwnershipTransfer) map[string]interface{} {
+	return map[string]interface{}{
+		"transfer_id": t.TransferID,
+		"from":        t.FromUserID,
+		"to":          t.ToUserID,
+		"keep_access": t.KeepAccess,
+	}
+}
+
+func keepAccess(req *types.TransferOwnershipRequest) bool {
+	return req.KeepAccess == nil || *req.KeepAccess
+}
+
+func (s *MemberSvc) attachPurchase(e events.Event) {
+	customerID, ok := e.Payload["customer_id"].(uuid.UUID)
+	if !ok || e.Payload["system"] != string(types.LMS) {
+		return
+	}
+	if _, err := s.repo.AttachToOwnedTenant(customerID, types.LMS); err != nil {
+		s.log.WithError(err).WithField("customer_id", customerID).Warn("Failed to attach purchase to tenant")
+	}
+}
@@ -0,0 +1,378 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/isolation"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/repository"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/types"
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/events"
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/storage"
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/utils"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"sync"
+	"time"
+)
+
+// MeteringService counts what tenants use and enforces their quotas. Services
+// call Reserve before creating a resource and Release if the creation fails
+// or the resource is deleted later.
+type MeteringService interface {
+	Reserve(namespace string, metric types.UsageMetric, n int64) error
+	Release(namespace string, metric types.UsageMetric, n int64)
+	Record(namespace string, metric types.UsageMetric, n int64)
+	Reconcile(namespace string) error
+	ReconcileAll() int
+	Usage(namespace string) (*types.UsageReport, error)
+	SetQuota(namespace string, actorID *uuid.UUID, req *types.SetQuotaRequest) (*types.UsageReport, error)
+}
+
+// PlanLimits supplies the quotas of the plan a customer subscribes to. A nil
+// map means the customer has no plan.
+type PlanLimits interface {
+	CustomerLimits(customerID uuid.UUID) (map[types.UsageMetric]int64, error)
+}
+
+type MeteringConfig struct {
+	// Defaults are the platform-wide limits; a metric without a default and
+	// without a tenant override is unlimited.
+	Defaults map[types.UsageMetric]int64
+	// LimitCacheTTL is how long resolved limits are reused before the quota
+	// table is read again.
+	LimitCacheTTL time.Duration
+}
+
+type MeteringDeps struct {
+	Usage     repository.UsageRepository
+	Tenants   repository.TenantRepository
+	Audit     repository.AuditRepository
+	DB        *gorm.DB
+	Isolation *isolation.Selector
+	Files     storage.TenantFiles
+	Bus       events.Bus
+	// Plans is optional; without it tenants get the platform defaults.
+	Plans PlanLimits
+}
+
+type cachedLimits struct {
+	limits  map[types.UsageMetric]int64
+	expires time.Time
+}
+
+type MeteringSvc struct {
+	log       *logrus.Logger
+	usage     repository.UsageRepository
+	tenants   repository.TenantRepository
+	audit     repository.AuditRepository
+	db        *gorm.DB
+	isolation *isolation.Selector
+	files     storage.TenantFiles
+	plans     PlanLimits
+	cfg       MeteringConfig
+
+	mu     sync.Mutex
+	limits map[string]cachedLimits
+}
+
+var _ MeteringService = (*MeteringSvc)(nil)
+
+func NewMeteringService(log *logrus.Logger, deps MeteringDeps, cfg MeteringConfig) *MeteringSvc {
+	s := &MeteringSvc{
+		log:       log,
+		usage:     deps.Usage,
+		tenants:   deps.Tenants,
+		audit:     deps.Audit,
+		db:        deps.DB,
+		isolation: deps.Isolation,
+		files:     deps.Files,
+		plans:     deps.Plans,
+		cfg:       cfg,
+		limits:    make(map[string]cachedLimits),
+	}
+
+	// Tenants created from a template, clone or archive start with content,
+	// so their counters are brought in line as soon as they exist.
+	reconcile := func(e events.Event) {
+		if err := s.Reconcile(e.Namespace); err != nil {
+			s.log.WithError(err).WithField("namespace", e.Namespace).Warn("Failed to reconcile tenant usage")
+		}
+	}
+	deps.Bus.Subscribe(events.TenantProvisioned, reconcile)
+	deps.Bus.Subscribe(events.TenantImported, reconcile)
+
+	// Plan quotas follow the tenant owner's subscription, so any change to a
+	// plan, a subscription or an owner can move the limits of many tenants.
+	reset := func(events.Event) { s.invalidateAll() }
+	for _, event := range []string{
+		events.PlanUpdated, events.SubscriptionCreated, events.SubscriptionPlanChanged,
+		events.SubscriptionCanceled, events.SubscriptionExpired, events.TenantOwnershipTransferred,
+	} {
+		deps.Bus.Subscribe(event, reset)
+	}
+	return s
+}
+
+// Reserve records n units of metric for the tenant, or returns a
+// *types.QuotaError without recording anything if that would exceed the limit.
+func (s *MeteringSvc) Reserve(namespace string, metric types.UsageMetric, n int64) error {
+	period := metric.Period(time.Now())
+
+	limit, err := s.limit(namespace, metric)
+	if err != nil {
+		return err
+	}
+
+	if _, ok, err := s.usage.Add(namespace, string(metric), period, n, limit); err != nil {
+		return errors.New("failed to record usage")
+	} else if ok {
+		return nil
+	}
+
+	used, _ := s.usage.Get(namespace, string(metric), period)
+	return &types.QuotaError{
+		Namespace: namespace,
+		Metric:    metric,
+		Period:    period,
+		Limit:     *limit,
+		Used:      used,
+		Requested: n,
+	}
+}
+
+func (s *MeteringSvc) Release(namespace string, metric types.UsageMetric, n int64) {
+	if err := s.usage.Subtract(namespace, string(metric), metric.Period(time.Now()), n); err != nil {
+		s.log.WithError(err).WithField("namespace", namespace).Warn("Failed to release usage")
+	}
+}
+
+// Record counts usage that already happened and is not subject to a check,
+// such as bytes written by an upload.
+func (s *MeteringSvc) Record(namespace string, metric types.UsageMetric, n int64) {
+	if _, _, err := s.usage.Add(namespace, string(metric), metric.Period(time.Now()), n, nil); err != nil {
+		s.log.WithError(err).WithField("namespace", namespace).Warn("Failed to record usage")
+	}
+}
+
+// Reconcile recounts the point-in-time metrics from the tenant's data. The
+// LMS writes to tenant schemas directly, so counters can drift from reality.
+func (s *MeteringSvc) Reconcile(namespace string) error {
+	tenant, err := s.tenants.GetTenantByNamespace(namespace)
+	if err != nil {
+		return err
+	}
+	if tenant.Status == types.TenantPurging || tenant.Status == types.TenantPurged {
+		return nil
+	}
+
+	counts := map[types.UsageMetric]string{
+		types.MetricUsers:   "lms_user",
+		types.MetricCourses: "course",
+	}
+	totals := make(map[types.UsageMetric]int64, len(counts))
+	err = s.isolation.WithTenant(utils.GetContext(), s.db, tenant, func(tx *gorm.DB) error {
+		for metric, table := range counts {
+			var n int64
+			if err := tx.Raw("SELECT count(*) FROM " + table).Scan(&n).Error; err != nil {
+				return fmt.Errorf("failed to count %s: %w", metric, err)
+			}
+			totals[metric] = n
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for metric, n := range totals {
+		if err := s.usage.Set(tenant.Namespace, string(metric), types.UsagePeriodTotal, n); err != nil {
+			return err
+		}
+	}
+
+	files, err := s.files.Usage(tenant.Namespace)
+	if err != nil {
+		return fmt.Errorf("failed to measure storage: %w", err)
+	}
+	return s.usage.Set(tenant.Namespace, string(types.MetricStorageBytes), types.UsagePeriodTotal, files.Bytes)
+}
+
+func (s *MeteringSvc) ReconcileAll() int {
+	tenants, err := s.tenants.ListTenants()
+	if err != nil {
+		return 0
+	}
+
+	reconciled := 0
+	for _, tenant := range tenants {
+		if tenant.Status == types.TenantPurging || tenant.Status == types.TenantPurged {
+			continue
+		}
+		if err := s.Reconcile(tenant.Namespace); err != nil {
+			s.log.WithError(err).WithField("namespace", tenant.Namespace).Warn("Failed to reconcile tenant usage")
+			continue
+		}
+		reconciled++
+	}
+	return reconciled
+}
+
+func (s *MeteringSvc) Usage(namespace string) (*types.UsageReport, error) {
+	ns, err := utils.NormalizeNamespace(namespace)
+	if err != nil {
+		return nil, ErrUnknownTenant
+	}
+	if _, err := s.tenants.GetTenantByNamespace(ns); err != nil {
+		if errors.Is(err, repository.ErrTenantNotFound) {
+			return nil, ErrUnknownTenant
+		}
+		return nil, errors.New("failed to load tenant")
+	}
+
+	now := time.Now()
+	periods := []string{types.UsagePeriodTotal, types.MetricAPICalls.Period(now)}
+	counters, err := s.usage.ListCounters(ns, periods)
+	if err != nil {
+		return nil, errors.New("failed to load usage")
+	}
+	used := make(map[string]int64, len(counters))
+	for _, c := range counters {
+		used[c.Metric+"/"+c.Period] = c.Value
+	}
+
+	limits, err := s.resolveLimits(ns)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &types.UsageReport{Namespace: ns, Metrics: make([]types.UsageItem, 0, len(types.UsageMetrics))}
+	for _, metric := range types.UsageMetrics {
+		period := metric.Period(now)
+		item := types.UsageItem{
+			Metric: metric,
+			Period: period,
+			Used:   used[string(metric)+"/"+period],
+		}
+		if limit, ok := limits[metric]; ok {
+			remaining := max(limit-item.Used, 0)
+			item.Limit = &limit
+			item.Remaining = &remaining
+		}
+		report.Metrics = append(report.Metrics, item)
+	}
+	return report, nil
+}
+
+func (s *MeteringSvc) SetQuota(namespace string, actorID *uuid.UUID, req *types.SetQuotaRequest) (*types.UsageReport, error) {
+	ns, err := utils.NormalizeNamespace(namespace)
+	if err != nil {
+		return nil, ErrUnknownTenant
+	}
+	tenant, err := s.tenants.GetTenantByNamespace(ns)
+	if err != nil {
+		if errors.Is(err, repository.ErrTenantNotFound) {
+			return nil, ErrUnknownTenant
+		}
+		return nil, errors.New("failed to load tenant")
+	}
+
+	if req.Limit == nil {
+		err = s.usage.DeleteQuota(ns, req.Metric)
+	} else {
+		err = s.usage.SetQuota(&types.TenantQuota{
+			Namespace: ns,
+			Metric:    req.Metric,
+			Limit:     *req.Limit,
+			UpdatedAt: time.Now(),
+		})
+	}
+	if err != nil {
+		return nil, errors.New("failed to update quota")
+	}
+	s.invalidate(ns)
+
+	if err := s.audit.Record(actorID, events.TenantQuotaChanged, "tenant", tenant.TenantID.String(), &tenant.Namespace, map[string]interface{}{
+		"metric": req.Metric,
+		"limit":  req.Limit,
+	}); err != nil {
+		s.log.WithError(err).Warn("Failed to audit quota change")
+	}
+	return s.Usage(ns)
+}
+
+func (s *MeteringSvc) limit(namespace string, metric types.UsageMetric) (*int64, error) {
+	limits, err := s.resolveLimits(namespace)
+	if err != nil {
+		return nil, err
+	}
+	if limit, ok := limits[metric]; ok {
+		return &limit, nil
+	}
+	return nil, nil
+}
+
+// resolveLimits merges the owner's plan quotas over the platform defaults and
+// tenant overrides over both.
+func (s *MeteringSvc) resolveLimits(namespace string) (map[types.UsageMetric]int64, error) {
+	s.mu.Lock()
+	cached, ok := s.limits[namespace]
+	s.mu.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.limits, nil
+	}
+
+	quotas, err := s.usage.ListQuotas(namespace)
+	if err != nil {
+		return nil, errors.New("failed to load quotas")
+	}
+
+	limits := make(map[types.UsageMetric]int64, len(s.cfg.Defaults)+len(quotas))
+	for metric, limit := range s.cfg.Defaults {
+		limits[metric] = limit
+	}
+	planLimits, err := s.planLimits(namespace)
+	if err != nil {
+		return nil, err
+	}
+	for metric, limit := range planLimits {
+		limits[metric] = limit
+	}
+	for _, q := range quotas {
+		limits[types.UsageMetric(q.Metric)] = q.Limit
+	}
+
+	s.mu.Lock()
+	s.limits[namespace] = cachedLimits{limits: limits, expires: time.Now().Add(s.cfg.LimitCacheTTL)}
+	s.mu.Unlock()
+	return limits, nil
+}
+
+func (s *MeteringSvc) planLimits(namespace string) (map[types.UsageMetric]int64, error) {
+	if s.plans == nil {
+		return nil, nil
+	}
+	tenant, err := s.tenants.GetTenantByNamespace(namespace)
+	if err != nil {
+		if errors.Is(err, repository.ErrTenantNotFound) {
+			return nil, nil
+		}
+		return nil, errors.New("failed to load tenant")
+	}
+	limits, err := s.plans.CustomerLimits(tenant.OwnerID)
+	if err != nil {
+		return nil, errors.New("failed to load plan quotas")
+	}
+	return limits, nil
+}
+
+func (s *MeteringSvc) invalidateAll() {
+	s.mu.Lock()
+	s.limits = make(map[string]cachedLimits)
+	s.mu.Unlock()
+}
+
+func (s *MeteringSvc) invalidate(namespace string) {
+	s.mu.Lock()
+	delete(s.limits, namespace)
+	s.mu.Unlock()
+}
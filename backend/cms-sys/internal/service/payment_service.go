@@ -0,0 +1,730 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/repository"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/types"
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/events"
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/payments"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"strings"
+	"time"
+)
+
+var (
+	ErrPaymentsDisabled = errors.New("payments are not configured")
+	ErrPaymentProvider  = errors.New("payment provider request failed")
+	ErrInvalidWebhook   = errors.New("invalid payment webhook")
+	ErrFreePlan         = errors.New("plan is free; subscribe without checkout")
+	ErrPaymentNotFound  = errors.New("payment not found")
+	ErrRefundNotAllowed = errors.New("payment cannot be refunded by this amount")
+	ErrNothingDue       = errors.New("coupon covers the full price; subscribe without checkout")
+)
+
+// providerTimeout bounds every call to the payment provider.
+const providerTimeout = 30 * time.Second
+
+// PaymentService takes money through a PaymentProvider. Customers pay the
+// first period of a plan at a hosted checkout; the provider's webhook then
+// creates the subscription. Renewals are charged off-session through Charge,
+// which makes the service the subscription Charger.
+type PaymentService interface {
+	Charger
+	Checkout(customerID uuid.UUID, req *types.SubscribeRequest) (*types.Checkout, error)
+	ListCheckouts(customerID uuid.UUID) ([]types.Checkout, error)
+	ListPayments(customerID *uuid.UUID) ([]types.Payment, error)
+	Refund(paymentID uuid.UUID, actorID *uuid.UUID, req *types.RefundRequest) (*payments.Refund, error)
+	HandleWebhook(payload []byte, signature string) (bool, error)
+}
+
+type PaymentConfig struct {
+	// SuccessURL and CancelURL are where the hosted checkout sends the
+	// customer back to.
+	SuccessURL string
+	CancelURL  string
+}
+
+type PaymentDeps struct {
+	Repo repository.PaymentRepository
+	// Provider is optional; without one payments are disabled.
+	Provider      payments.PaymentProvider
+	DB            *gorm.DB
+	Plans         repository.PlanRepository
+	Subscriptions repository.SubscriptionRepository
+	Users         repository.AuthRepository
+	Audit         repository.AuditRepository
+	Bus           events.Bus
+	// Coupons is optional; without it checkouts take no coupons.
+	Coupons Discounts
+}
+
+type PaymentSvc struct {
+	log           *logrus.Logger
+	repo          repository.PaymentRepository
+	provider      payments.PaymentProvider
+	db            *gorm.DB
+	plans         repository.PlanRepository
+	subscriptions repository.SubscriptionRepository
+	users         repository.AuthRepository
+	audit         repository.AuditRepository
+	bus           events.Bus
+	coupons       Discounts
+	cfg           PaymentConfig
+}
+
+var _ PaymentService = (*PaymentSvc)(nil)
+
+func NewPaymentService(log *logrus.Logger, deps PaymentDeps, cfg PaymentConfig) *PaymentSvc {
+	return &PaymentSvc{
+		log:           log,
+		repo:          deps.Repo,
+		provider:      deps.Provider,
+		db:            deps.DB,
+		plans:         deps.Plans,
+		subscriptions: deps.Subscriptions,
+		users:         deps.Users,
+		audit:         deps.Audit,
+		bus:           deps.Bus,
+		coupons:       deps.Coupons,
+		cfg:           cfg,
+	}
+}
+
+// Checkout opens a hosted payment page for the first period of a paid plan.
+// Checkout always charges up front; trials start through Subscribe. A coupon
+// is redeemed on the checkout and given back if it expires.
+func (s *PaymentSvc) Checkout(customerID uuid.UUID, req *types.SubscribeRequest) (*types.Checkout, error) {
+	if s.provider == nil {
+		return nil, ErrPaymentsDisabled
+	}
+	user, err := s.customer(customerID)
+	if err != nil {
+		return nil, err
+	}
+	plan, err := s.plans.GetPlanByCode(strings.ToLower(req.Plan))
+	if err != nil {
+		if errors.Is(err, repository.ErrPlanNotFound) {
+			return nil, ErrPlanNotFound
+		}
+		return nil, errors.New("failed to load plan")
+	}
+	if !plan.Active {
+		return nil, ErrPlanRetired
+	}
+	if plan.PriceCents == 0 {
+		return nil, ErrFreePlan
+	}
+	if _, err := s.subscriptions.GetLiveSubscription(customerID); err == nil {
+		return nil, ErrAlreadySubscribed
+	} else if !errors.Is(err, repository.ErrSubscriptionNotFound) {
+		return nil, errors.New("failed to load subscription")
+	}
+
+	checkout := &types.Checkout{
+		CheckoutID:  uuid.New(),
+		CustomerID:  customerID,
+		PlanID:      plan.PlanID,
+		Provider:    s.provider.Name(),
+		AmountCents: plan.PriceCents,
+		Currency:    plan.Currency,
+		Status:      types.CheckoutOpen,
+	}
+	var redemption *types.CouponRedemption
+	if req.Coupon != "" {
+		if s.coupons == nil {
+			return nil, ErrCouponNotFound
+		}
+		if redemption, err = s.coupons.Redeem(customerID, req.Coupon, plan, &checkout.CheckoutID); err != nil {
+			return nil, err
+		}
+		checkout.AmountCents = max(plan.PriceCents-redemption.DiscountCents, 0)
+		if checkout.AmountCents == 0 {
+			// Nothing to pay at the provider; the customer subscribes with
+			// the coupon instead, so it is not used up here.
+			s.releaseCoupon(redemption)
+			return nil, ErrNothingDue
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), providerTimeout)
+	defer cancel()
+	externalID, err := s.providerCustomer(ctx, user)
+	if err != nil {
+		s.releaseCoupon(redemption)
+		return nil, err
+	}
+
+	session, err := s.provider.CreateCheckoutSession(ctx, payments.CheckoutParams{
+		CustomerID:  externalID,
+		Reference:   checkout.CheckoutID.String(),
+		Description: plan.Name,
+		AmountCents: checkout.AmountCents,
+		Currency:    plan.Currency,
+		SuccessURL:  s.cfg.SuccessURL,
+		CancelURL:   s.cfg.CancelURL,
+	})
+	if err != nil {
+		s.releaseCoupon(redemption)
+		s.log.WithError(err).WithField("customer_id", customerID).Error("Failed to create checkout session")
+		return nil, fmt.Errorf("%w: %v", ErrPaymentProvider, err)
+	}
+	checkout.ExternalID = session.ID
+	checkout.URL = session.URL
+	checkout.ExpiresAt = session.ExpiresAt
+	if err := s.repo.CreateCheckout(checkout); err != nil {
+		s.releaseCoupon(redemption)
+		return nil, errors.New("failed to save checkout")
+	}
+
+	details := map[string]interface{}{
+		"checkout_id":  checkout.CheckoutID,
+		"customer_id":  customerID,
+		"plan_id":      plan.PlanID,
+		"amount_cents": checkout.AmountCents,
+		"currency":     checkout.Currency,
+	}
+	if redemption != nil {
+		details["redemption_id"] = redemption.RedemptionID
+	}
+	s.record(&customerID, events.CheckoutCreated, "checkout", checkout.CheckoutID.String(), details)
+	return checkout, nil
+}
+
+func (s *PaymentSvc) releaseCoupon(redemption *types.CouponRedemption) {
+	if redemption != nil {
+		s.coupons.Release(redemption)
+	}
+}
+
+func (s *PaymentSvc) ListCheckouts(customerID uuid.UUID) ([]types.Checkout, error) {
+	checkouts, err := s.repo.ListCheckouts(customerID)
+	if err != nil {
+		return nil, errors.New("failed to list checkouts")
+	}
+	return checkouts, nil
+}
+
+func (s *PaymentSvc) ListPayments(customerID *uuid.UUID) ([]types.Payment, error) {
+	list, err := s.repo.ListPayments(customerID)
+	if err != nil {
+		return nil, errors.New("failed to list payments")
+	}
+	return list, nil
+}
+
+// Charge collects a subscription period from the customer's saved payment
+// method.
+func (s *PaymentSvc) Charge(sub *types.Subscription, plan *types.Plan, amountCents int64) error {
+	if s.provider == nil {
+		return ErrPaymentsDisabled
+	}
+	user, err := s.users.GetUserByID(sub.CustomerID)
+	if err != nil {
+		return ErrUserNotFound
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), providerTimeout)
+	defer cancel()
+	externalID, err := s.providerCustomer(ctx, user)
+	if err != nil {
+		return err
+	}
+	charged, err := s.provider.Charge(ctx, payments.ChargeParams{
+		CustomerID:  externalID,
+		Reference:   sub.SubscriptionID.String(),
+		Description: plan.Name,
+		AmountCents: amountCents,
+		Currency:    plan.Currency,
+	})
+	if err != nil {
+		return err
+	}
+
+	payment := &types.Payment{
+		CustomerID:     sub.CustomerID,
+		SubscriptionID: &sub.SubscriptionID,
+		Provider:       s.provider.Name(),
+		ExternalID:     charged.ID,
+		AmountCents:    charged.AmountCents,
+		Currency:       strings.ToUpper(charged.Currency),
+		Status:         types.PaymentSucceeded,
+	}
+	if _, err := s.repo.CreatePayment(payment); err != nil {
+		// The money is collected; failing the period now would only
+		// charge the customer again on the next attempt.
+		s.log.WithError(err).WithField("external_id", charged.ID).Error("Failed to record collected payment")
+	}
+	return nil
+}
+
+// Refund asks the provider to return money, all that is left when the amount
+// is zero. The payment is updated when the provider confirms the refund with
+// a payment.refunded event.
+func (s *PaymentSvc) Refund(paymentID uuid.UUID, actorID *uuid.UUID, req *types.RefundRequest) (*payments.Refund, error) {
+	if s.provider == nil {
+		return nil, ErrPaymentsDisabled
+	}
+	payment, err := s.repo.GetPayment(paymentID)
+	if err != nil {
+		if errors.Is(err, repository.ErrPaymentNotFound) {
+			return nil, ErrPaymentNotFound
+		}
+		return nil, errors.New("failed to load payment")
+	}
+	left := payment.AmountCents - payment.RefundedCents
+	if payment.Provider != s.provider.Name() || left <= 0 || req.AmountCents > left {
+		return nil, ErrRefundNotAllowed
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), providerTimeout)
+	defer cancel()
+	refund, err := s.provider.Refund(ctx, payments.RefundParams{
+		PaymentID:   payment.ExternalID,
+		AmountCents: req.AmountCents,
+		Reason:      req.Reason,
+	})
+	if err != nil {
+		s.log.WithError(err).WithField("payment_id", paymentID).Error("Failed to refund payment")
+		return nil, fmt.Errorf("%w: %v", ErrPaymentProvider, err)
+	}
+
+	s.record(actorID, events.PaymentRefundRequested, "payment", paymentID.String(), map[string]interface{}{
+		"payment_id":   paymentID,
+		"customer_id":  payment.CustomerID,
+		"refund_id":    refund.ID,
+		"amount_cents": refund.AmountCents,
+		"reason":       req.Reason,
+	})
+	return refund, nil
+}
+
+// HandleWebhook verifies a provider event and applies it. The record that the
+// event was seen commits in one transaction with everything the event
+// changes, so a redelivered event is acknowledged without effect and a
+// failed one leaves nothing behind for the provider's retry. It reports true
+// for an event that was already processed.
+func (s *PaymentSvc) HandleWebhook(payload []byte, signature string) (bool, error) {
+	if s.provider == nil {
+		return false, ErrPaymentsDisabled
+	}
+	event, err := s.provider.ParseWebhook(payload, signature)
+	if err != nil {
+		s.log.WithError(err).Warn("Rejected payment webhook")
+		return false, ErrInvalidWebhook
+	}
+
+	var w *webhookTx
+	duplicate := false
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		w = s.newWebhookTx(tx)
+		recorded, err := w.payments.RecordEvent(&types.PaymentEvent{
+			Provider:   s.provider.Name(),
+			EventID:    event.ID,
+			Type:       string(event.Type),
+			ReceivedAt: time.Now(),
+		})
+		if err != nil {
+			return err
+		}
+		if !recorded {
+			duplicate = true
+			return nil
+		}
+
+		switch event.Type {
+		case payments.EventCheckoutCompleted:
+			return s.completeCheckout(w, event)
+		case payments.EventCheckoutExpired:
+			return s.expireCheckout(w, event)
+		case payments.EventPaymentRefunded:
+			return s.applyRefund(w, event)
+		}
+		s.log.WithField("type", event.Type).Debug("Ignoring payment event")
+		return nil
+	})
+	if err != nil {
+		s.log.WithError(err).WithField("event_id", event.ID).Error("Failed to process payment webhook")
+		return false, errors.New("failed to process payment event")
+	}
+
+	for _, change := range w.changes {
+		s.bus.Publish(change)
+	}
+	for _, payment := range w.refunds {
+		s.refundDuplicate(payment)
+	}
+	return duplicate, nil
+}
+
+// webhookTx holds the repositories bound to a webhook's transaction and the
+// events to publish once it commits.
+type webhookTx struct {
+	payments      *repository.PaymentRepo
+	plans         *repository.PlanRepo
+	subscriptions *repository.SubscriptionRepo
+	purchases     *repository.PurchaseRepo
+	coupons       *repository.CouponRepo
+	audit         *repository.AuditRepo
+	changes       []events.Event
+	// refunds are payments to give back after commit.
+	refunds []*types.Payment
+}
+
+func (s *PaymentSvc) newWebhookTx(tx *gorm.DB) *webhookTx {
+	return &webhookTx{
+		payments:      repository.NewPaymentRepo(s.log, tx),
+		plans:         repository.NewPlanRepo(s.log, tx),
+		subscriptions: repository.NewSubscriptionRepo(s.log, tx),
+		purchases:     repository.NewPurchaseRepo(s.log, tx),
+		coupons:       repository.NewCouponRepo(s.log, tx),
+		audit:         repository.NewAuditRepo(s.log, tx),
+	}
+}
+
+// record audits within the transaction and queues the event for publishing.
+func (w *webhookTx) record(action, targetType, targetID string, details map[string]interface{}) error {
+	if err := w.audit.Record(nil, action, targetType, targetID, nil, details); err != nil {
+		return err
+	}
+	w.changes = append(w.changes, events.Event{Type: action, Payload: details})
+	return nil
+}
+
+// releaseCoupon gives back the coupon redeemed on a checkout that did not
+// start a subscription.
+func (w *webhookTx) releaseCoupon(redemption *types.CouponRedemption) error {
+	if redemption == nil {
+		return nil
+	}
+	released, err := w.coupons.ReleaseRedemption(redemption.RedemptionID)
+	if err != nil || !released {
+		return err
+	}
+	return w.record(events.CouponReleased, "coupon", redemption.CouponID.String(), redemptionDetails("", redemption))
+}
+
+// completeCheckout records the payment, starts the subscription and activates
+// the plan's systems. A coupon redeemed on the checkout is attached to the
+// subscription as applied. A customer who meanwhile subscribed otherwise
+// keeps that subscription, this payment is refunded and the coupon given
+// back.
+func (s *PaymentSvc) completeCheckout(w *webhookTx, event *payments.Event) error {
+	checkout, err := w.payments.GetCheckoutByExternal(s.provider.Name(), event.Data.SessionID)
+	if errors.Is(err, repository.ErrCheckoutNotFound) {
+		s.log.WithField("session_id", event.Data.SessionID).Warn("Payment event for unknown checkout")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if checkout.Status == types.CheckoutCompleted {
+		return nil
+	}
+	if checkout.Status != types.CheckoutOpen {
+		return s.refundLateCheckout(w, checkout, event)
+	}
+
+	// Claimed before anything is created: a concurrent delivery waits on the
+	// row, then finds the checkout completed and leaves it alone.
+	now := time.Now()
+	checkout.Status = types.CheckoutCompleted
+	checkout.CompletedAt = &now
+	claimed, err := w.payments.UpdateCheckout(checkout, types.CheckoutOpen)
+	if err != nil {
+		return err
+	}
+	if !claimed {
+		return nil
+	}
+
+	plan, err := w.plans.GetPlan(checkout.PlanID)
+	if err != nil {
+		return err
+	}
+	sub := &types.Subscription{
+		SubscriptionID:     uuid.New(),
+		CustomerID:         checkout.CustomerID,
+		PlanID:             plan.PlanID,
+		Status:             types.SubscriptionActive,
+		CurrentPeriodStart: now,
+		CurrentPeriodEnd:   plan.Interval.Next(now),
+	}
+	created, err := w.subscriptions.CreateSubscription(sub)
+	if err != nil {
+		return err
+	}
+
+	payment := &types.Payment{
+		CustomerID:  checkout.CustomerID,
+		Provider:    s.provider.Name(),
+		ExternalID:  event.Data.PaymentID,
+		AmountCents: event.Data.AmountCents,
+		Currency:    strings.ToUpper(event.Data.Currency),
+		Status:      types.PaymentSucceeded,
+	}
+	if created {
+		payment.SubscriptionID = &sub.SubscriptionID
+		checkout.SubscriptionID = &sub.SubscriptionID
+	}
+	if _, err := w.payments.CreatePayment(payment); err != nil {
+		return err
+	}
+	checkout.PaymentID = &payment.PaymentID
+	if _, err := w.payments.UpdateCheckout(checkout, types.CheckoutCompleted); err != nil {
+		return err
+	}
+
+	details := map[string]interface{}{
+		"checkout_id":  checkout.CheckoutID,
+		"payment_id":   payment.PaymentID,
+		"customer_id":  checkout.CustomerID,
+		"plan_id":      plan.PlanID,
+		"amount_cents": payment.AmountCents,
+		"currency":     payment.Currency,
+	}
+	redemption, err := w.coupons.GetRedemptionByCheckout(checkout.CheckoutID)
+	if err != nil && !errors.Is(err, repository.ErrRedemptionNotFound) {
+		return err
+	}
+	if !created {
+		details["refund_due"] = true
+		w.refunds = append(w.refunds, payment)
+		if err := w.releaseCoupon(redemption); err != nil {
+			return err
+		}
+		return w.record(events.CheckoutCompleted, "checkout", checkout.CheckoutID.String(), details)
+	}
+
+	for _, system := range plan.Systems {
+		activated, err := w.purchases.ActivatePurchase(&types.CMSCusPurchase{
+			CMSCusID:       checkout.CustomerID,
+			SystemName:     string(system.System),
+			PurchaseDate:   now,
+			SubscriptionID: &sub.SubscriptionID,
+		})
+		if err != nil {
+			return err
+		}
+		if activated {
+			w.changes = append(w.changes, events.Event{Type: events.PurchaseCreated, Payload: subscribedPurchase(sub, system.System)})
+		}
+	}
+	if redemption != nil {
+		redemption.SubscriptionID = &sub.SubscriptionID
+		redemption.AppliedAt = &now
+		if redemption.System != "" {
+			purchase, err := w.purchases.GetPurchase(sub.CustomerID, redemption.System)
+			if err != nil {
+				return err
+			}
+			redemption.PurchaseID = &purchase.RelationID
+		}
+		if err := w.coupons.AttachRedemption(redemption); err != nil {
+			return err
+		}
+		details["redemption_id"] = redemption.RedemptionID
+	}
+	details["subscription_id"] = sub.SubscriptionID
+	if err := w.record(events.CheckoutCompleted, "checkout", checkout.CheckoutID.String(), details); err != nil {
+		return err
+	}
+	return w.record(events.SubscriptionCreated, "subscription", sub.SubscriptionID.String(), subscriptionDetails(sub, nil))
+}
+
+// refundLateCheckout handles a payment for a checkout that had already
+// expired: the customer is charged but gets no subscription, so the payment
+// is recorded and refunded once the transaction commits.
+func (s *PaymentSvc) refundLateCheckout(w *webhookTx, checkout *types.Checkout, event *payments.Event) error {
+	payment := &types.Payment{
+		CustomerID:  checkout.CustomerID,
+		Provider:    s.provider.Name(),
+		ExternalID:  event.Data.PaymentID,
+		AmountCents: event.Data.AmountCents,
+		Currency:    strings.ToUpper(event.Data.Currency),
+		Status:      types.PaymentSucceeded,
+	}
+	created, err := w.payments.CreatePayment(payment)
+	if err != nil || !created {
+		return err
+	}
+	from := checkout.Status
+	checkout.PaymentID = &payment.PaymentID
+	if _, err := w.payments.UpdateCheckout(checkout, from); err != nil {
+		return err
+	}
+	w.refunds = append(w.refunds, payment)
+	return w.record(events.CheckoutCompleted, "checkout", checkout.CheckoutID.String(), map[string]interface{}{
+		"checkout_id":  checkout.CheckoutID,
+		"payment_id":   payment.PaymentID,
+		"customer_id":  checkout.CustomerID,
+		"plan_id":      checkout.PlanID,
+		"status":       from,
+		"amount_cents": payment.AmountCents,
+		"currency":     payment.Currency,
+		"refund_due":   true,
+	})
+}
+
+func (s *PaymentSvc) expireCheckout(w *webhookTx, event *payments.Event) error {
+	checkout, err := w.payments.GetCheckoutByExternal(s.provider.Name(), event.Data.SessionID)
+	if errors.Is(err, repository.ErrCheckoutNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if checkout.Status != types.CheckoutOpen {
+		return nil
+	}
+
+	checkout.Status = types.CheckoutExpired
+	expired, err := w.payments.UpdateCheckout(checkout, types.CheckoutOpen)
+	if err != nil || !expired {
+		return err
+	}
+	redemption, err := w.coupons.GetRedemptionByCheckout(checkout.CheckoutID)
+	if err != nil && !errors.Is(err, repository.ErrRedemptionNotFound) {
+		return err
+	}
+	if err := w.releaseCoupon(redemption); err != nil {
+		return err
+	}
+	return w.record(events.CheckoutExpired, "checkout", checkout.CheckoutID.String(), map[string]interface{}{
+		"checkout_id": checkout.CheckoutID,
+		"customer_id": checkout.CustomerID,
+		"plan_id":     checkout.PlanID,
+	})
+}
+
+// applyRefund raises the payment's refunded total. Refunding a subscription
+// payment in full cancels the subscription at once and revokes its systems.
+func (s *PaymentSvc) applyRefund(w *webhookTx, event *payments.Event) error {
+	payment, err := w.payments.GetPaymentByExternal(s.provider.Name(), event.Data.PaymentID)
+	if errors.Is(err, repository.ErrPaymentNotFound) {
+		s.log.WithField("external_id", event.Data.PaymentID).Warn("Refund event for unknown payment")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	applied, err := w.payments.ApplyRefund(payment, event.Data.RefundedCents)
+	if err != nil || !applied {
+		return err
+	}
+
+	err = w.record(events.PaymentRefunded, "payment", payment.PaymentID.String(), map[string]interface{}{
+		"payment_id":     payment.PaymentID,
+		"customer_id":    payment.CustomerID,
+		"amount_cents":   payment.AmountCents,
+		"refunded_cents": payment.RefundedCents,
+		"status":         payment.Status,
+	})
+	if err != nil || payment.Status != types.PaymentRefunded || payment.SubscriptionID == nil {
+		return err
+	}
+
+	sub, err := w.subscriptions.GetSubscription(*payment.SubscriptionID)
+	if err != nil {
+		return err
+	}
+	if !sub.Status.Live() {
+		return nil
+	}
+	from := sub.Status
+	now := time.Now()
+	sub.Status = types.SubscriptionCanceled
+	sub.EndedAt = &now
+	sub.NextAttemptAt = nil
+	if sub.CanceledAt == nil {
+		sub.CanceledAt = &now
+	}
+	saved, err := w.subscriptions.UpdateSubscription(sub, from)
+	if err != nil {
+		return err
+	}
+	if !saved {
+		return ErrSubscriptionTransition
+	}
+	for _, system := range sub.Plan.Systems {
+		if _, err := w.purchases.CancelSubscribed(sub, system.System, now); err != nil {
+			return err
+		}
+	}
+	details := subscriptionDetails(sub, map[string]interface{}{"reason": "refunded", "payment_id": payment.PaymentID})
+	return w.record(events.SubscriptionCanceled, "subscription", sub.SubscriptionID.String(), details)
+}
+
+// refundDuplicate gives back a checkout payment that could not start a
+// subscription. A failure is logged for an admin to refund by hand.
+func (s *PaymentSvc) refundDuplicate(payment *types.Payment) {
+	if _, err := s.Refund(payment.PaymentID, nil, &types.RefundRequest{Reason: "customer already subscribed"}); err != nil {
+		s.log.WithError(err).WithField("payment_id", payment.PaymentID).Error("Failed to refund duplicate checkout payment")
+	}
+}
+
+// providerCustomer returns the customer's ID at the provider, creating the
+// record there on first use.
+func (s *PaymentSvc) providerCustomer(ctx context.Context, user *types.CMSUser) (string, error) {
+	name := s.provider.Name()
+	existing, err := s.repo.GetCustomer(user.CMSUserID, name)
+	if err == nil {
+		return existing.ExternalID, nil
+	}
+	if !errors.Is(err, repository.ErrPaymentCustomerNotFound) {
+		return "", errors.New("failed to load payment customer")
+	}
+
+	customer, err := s.provider.CreateCustomer(ctx, payments.CustomerParams{
+		Email:     user.CMSUserEmail,
+		Name:      user.CMSUserName,
+		Reference: user.CMSUserID.String(),
+	})
+	if err != nil {
+		s.log.WithError(err).WithField("customer_id", user.CMSUserID).Error("Failed to create payment customer")
+		return "", fmt.Errorf("%w: %v", ErrPaymentProvider, err)
+	}
+	created, err := s.repo.CreateCustomer(&types.PaymentCustomer{
+		CustomerID: user.CMSUserID,
+		Provider:   name,
+		ExternalID: customer.ID,
+		CreatedAt:  time.Now(),
+	})
+	if err != nil {
+		return "", errors.New("failed to save payment customer")
+	}
+	if !created {
+		// A concurrent request linked the customer first; use its record.
+		existing, err := s.repo.GetCustomer(user.CMSUserID, name)
+		if err != nil {
+			return "", errors.New("failed to load payment customer")
+		}
+		return existing.ExternalID, nil
+	}
+	return customer.ID, nil
+}
+
+func (s *PaymentSvc) customer(id uuid.UUID) (*types.CMSUser, error) {
+	user, err := s.users.GetUserByID(id)
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+	if !user.IsCustomer() {
+		return nil, ErrNotCustomer
+	}
+	return user, nil
+}
+
+func (s *PaymentSvc) record(actorID *uuid.UUID, action, targetType, targetID string, details map[string]interface{}) {
+	if err := s.audit.Record(actorID, action, targetType, targetID, nil, details); err != nil {
+		s.log.WithError(err).Warn("Failed to audit payment change")
+	}
+	s.bus.Publish(events.Event{
+		Type:    action,
+		ActorID: actorID,
+		Payload: details,
+	})
+}
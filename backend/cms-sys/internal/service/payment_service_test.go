@@ -0,0 +1,241 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/repository"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/types"
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/events"
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/payments"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// testTx opens a transaction on the database named by TEST_DATABASE_DSN and
+// rolls it back when the test ends. The database needs the CMS schema
+// (cmsctl migrate up); tests skip without it.
+func testTx(t *testing.T) *gorm.DB {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_DSN is not set")
+	}
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	if !db.Migrator().HasTable(&types.Checkout{}) {
+		t.Skip("TEST_DATABASE_DSN has no CMS schema; run cmsctl migrate up")
+	}
+	tx := db.Begin()
+	if tx.Error != nil {
+		t.Fatalf("begin: %v", tx.Error)
+	}
+	t.Cleanup(func() { tx.Rollback() })
+	return tx
+}
+
+type paymentFixture struct {
+	svc      *PaymentSvc
+	provider *payments.FakeProvider
+	tx       *gorm.DB
+	plan     *types.Plan
+}
+
+func newPaymentFixture(t *testing.T) *paymentFixture {
+	t.Helper()
+	tx := testTx(t)
+	log := quietLogger()
+	err := tx.Exec(`INSERT INTO cms_whole_sys_role (role_name) VALUES (?) ON CONFLICT DO NOTHING`, string(types.CMSCustomer)).Error
+	if err == nil {
+		err = tx.Exec(`INSERT INTO system_catalog (code, name) VALUES (?, 'LMS') ON CONFLICT DO NOTHING`, string(types.LMS)).Error
+	}
+	if err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+
+	plan := &types.Plan{
+		Code:       "test-" + uuid.NewString()[:8],
+		Name:       "Test",
+		PriceCents: 1500,
+		Currency:   "USD",
+		Interval:   types.IntervalMonth,
+		Active:     true,
+		Systems:    []types.PlanSystem{{System: types.LMS}},
+	}
+	if err := repository.NewPlanRepo(log, tx).CreatePlan(plan); err != nil {
+		t.Fatalf("create plan: %v", err)
+	}
+
+	provider := payments.NewFakeProvider("whsec_test", "http://checkout.test", time.Minute)
+	svc := NewPaymentService(log, PaymentDeps{
+		Repo:          repository.NewPaymentRepo(log, tx),
+		Provider:      provider,
+		DB:            tx,
+		Plans:         repository.NewPlanRepo(log, tx),
+		Subscriptions: repository.NewSubscriptionRepo(log, tx),
+		Users:         repository.NewRepo(log, tx),
+		Audit:         repository.NewAuditRepo(log, tx),
+		Bus:           events.NewInProcessBus(log),
+	}, PaymentConfig{})
+	return &paymentFixture{svc: svc, provider: provider, tx: tx, plan: plan}
+}
+
+func (f *paymentFixture) customer(t *testing.T) uuid.UUID {
+	t.Helper()
+	user := &types.CMSUser{
+		CMSUserName:  "Customer",
+		CMSUserEmail: uuid.NewString() + "@example.com",
+		Password:     "x",
+		CMSUserRole:  string(types.CMSCustomer),
+	}
+	if err := repository.NewRepo(quietLogger(), f.tx).CreateUser(user); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	return user.CMSUserID
+}
+
+// deliver signs event the way the gateway does and hands it to the webhook.
+func (f *paymentFixture) deliver(t *testing.T, event *payments.Event) bool {
+	t.Helper()
+	payload, _ := json.Marshal(event)
+	duplicate, err := f.svc.HandleWebhook(payload, f.provider.Signature(payload, time.Now()))
+	if err != nil {
+		t.Fatalf("webhook %s: %v", event.Type, err)
+	}
+	return duplicate
+}
+
+func (f *paymentFixture) checkout(t *testing.T, customerID uuid.UUID) *types.Checkout {
+	t.Helper()
+	checkout, err := f.svc.Checkout(customerID, &types.SubscribeRequest{Plan: f.plan.Code})
+	if err != nil {
+		t.Fatalf("checkout: %v", err)
+	}
+	return checkout
+}
+
+func (f *paymentFixture) checkoutStatus(t *testing.T, checkout *types.Checkout) types.CheckoutStatus {
+	t.Helper()
+	stored, err := repository.NewPaymentRepo(quietLogger(), f.tx).GetCheckoutByExternal(f.provider.Name(), checkout.ExternalID)
+	if err != nil {
+		t.Fatalf("load checkout: %v", err)
+	}
+	return stored.Status
+}
+
+func TestPaymentWebhookCompletesCheckout(t *testing.T) {
+	f := newPaymentFixture(t)
+	customerID := f.customer(t)
+	checkout := f.checkout(t, customerID)
+
+	event, err := f.provider.CompleteCheckout(checkout.ExternalID)
+	if err != nil {
+		t.Fatalf("complete: %v", err)
+	}
+	payload, _ := json.Marshal(event)
+	forged := payments.Sign([]byte("whsec_other"), payload, time.Now())
+	if _, err := f.svc.HandleWebhook(payload, forged); !errors.Is(err, ErrInvalidWebhook) {
+		t.Fatalf("forged signature: err = %v, want ErrInvalidWebhook", err)
+	}
+	if status := f.checkoutStatus(t, checkout); status != types.CheckoutOpen {
+		t.Fatalf("forged event moved the checkout to %s", status)
+	}
+
+	if f.deliver(t, event) {
+		t.Fatal("first delivery reported as duplicate")
+	}
+	if status := f.checkoutStatus(t, checkout); status != types.CheckoutCompleted {
+		t.Fatalf("checkout is %s, want COMPLETED", status)
+	}
+	subs := repository.NewSubscriptionRepo(quietLogger(), f.tx)
+	sub, err := subs.GetLiveSubscription(customerID)
+	if err != nil || sub.Status != types.SubscriptionActive || sub.PlanID != f.plan.PlanID {
+		t.Fatalf("subscription after checkout: %+v, %v", sub, err)
+	}
+	purchase, err := repository.NewPurchaseRepo(quietLogger(), f.tx).GetPurchase(customerID, types.LMS)
+	if err != nil || !purchase.Active() || purchase.SubscriptionID == nil || *purchase.SubscriptionID != sub.SubscriptionID {
+		t.Fatalf("purchase after checkout: %+v, %v", purchase, err)
+	}
+	if _, err := f.svc.Checkout(customerID, &types.SubscribeRequest{Plan: f.plan.Code}); !errors.Is(err, ErrAlreadySubscribed) {
+		t.Fatalf("second checkout: err = %v, want ErrAlreadySubscribed", err)
+	}
+
+	// A redelivered event is acknowledged without effect.
+	if !f.deliver(t, event) {
+		t.Fatal("redelivery not reported as duplicate")
+	}
+
+	// A full refund ends the subscription and its systems.
+	var refunded payments.Event
+	f.provider.OnEvent(func(e payments.Event) { refunded = e })
+	if _, err := f.provider.Refund(t.Context(), payments.RefundParams{PaymentID: event.Data.PaymentID}); err != nil {
+		t.Fatalf("refund: %v", err)
+	}
+	f.deliver(t, &refunded)
+	sub, err = subs.GetSubscription(sub.SubscriptionID)
+	if err != nil || sub.Status != types.SubscriptionCanceled {
+		t.Fatalf("subscription after refund: %+v, %v", sub, err)
+	}
+	purchase, _ = repository.NewPurchaseRepo(quietLogger(), f.tx).GetPurchase(customerID, types.LMS)
+	if purchase.Active() {
+		t.Fatal("purchase still active after a full refund")
+	}
+}
+
+func TestPaymentWebhookExpiresCheckout(t *testing.T) {
+	f := newPaymentFixture(t)
+	customerID := f.customer(t)
+	checkout := f.checkout(t, customerID)
+
+	event, err := f.provider.ExpireCheckout(checkout.ExternalID)
+	if err != nil {
+		t.Fatalf("expire: %v", err)
+	}
+	f.deliver(t, event)
+	if status := f.checkoutStatus(t, checkout); status != types.CheckoutExpired {
+		t.Fatalf("checkout is %s, want EXPIRED", status)
+	}
+	if _, err := repository.NewSubscriptionRepo(quietLogger(), f.tx).GetLiveSubscription(customerID); !errors.Is(err, repository.ErrSubscriptionNotFound) {
+		t.Fatalf("expired checkout left a subscription: %v", err)
+	}
+
+	// The customer can start over.
+	f.checkout(t, customerID)
+}
+
+func TestPaymentWebhookRefundsLateCompletion(t *testing.T) {
+	f := newPaymentFixture(t)
+	customerID := f.customer(t)
+	checkout := f.checkout(t, customerID)
+
+	// The customer pays just as the checkout expires on our side.
+	event, err := f.provider.CompleteCheckout(checkout.ExternalID)
+	if err != nil {
+		t.Fatalf("complete: %v", err)
+	}
+	if err := f.tx.Model(&types.Checkout{}).Where("checkout_id = ?", checkout.CheckoutID).Update("status", types.CheckoutExpired).Error; err != nil {
+		t.Fatalf("expire: %v", err)
+	}
+	f.deliver(t, event)
+
+	if status := f.checkoutStatus(t, checkout); status != types.CheckoutExpired {
+		t.Fatalf("checkout is %s, want EXPIRED", status)
+	}
+	if _, err := repository.NewSubscriptionRepo(quietLogger(), f.tx).GetLiveSubscription(customerID); !errors.Is(err, repository.ErrSubscriptionNotFound) {
+		t.Fatalf("late payment created a subscription: %v", err)
+	}
+	payment, err := repository.NewPaymentRepo(quietLogger(), f.tx).GetPaymentByExternal(f.provider.Name(), event.Data.PaymentID)
+	if err != nil {
+		t.Fatalf("late payment was not recorded: %v", err)
+	}
+	if payment.SubscriptionID != nil {
+		t.Fatalf("late payment is linked to subscription %s", payment.SubscriptionID)
+	}
+}
@@ -0,0 +1,210 @@
+package service
+
+import (
+	"errors"
+	"github.com/google/uuid"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/repository"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/types"
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/events"
+	"github.com/sirupsen/logrus"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	ErrPlanNotFound = errors.New("plan not found")
+	ErrPlanCodeUsed = errors.New("plan code is already in use")
+)
+
+// PlanService manages the plans customers subscribe to. Plans are retired
+// rather than deleted so existing subscriptions keep their terms.
+type PlanService interface {
+	ListPlans(includeRetired bool) ([]types.Plan, error)
+	GetPlan(id uuid.UUID) (*types.Plan, error)
+	CreatePlan(actorID *uuid.UUID, req *types.PlanRequest) (*types.Plan, error)
+	UpdatePlan(id uuid.UUID, actorID *uuid.UUID, req *types.PlanRequest) (*types.Plan, error)
+	RetirePlan(id uuid.UUID, actorID *uuid.UUID) error
+}
+
+type PlanDeps struct {
+	Catalog Catalog
+	Repo    repository.PlanRepository
+	Audit   repository.AuditRepository
+	Bus     events.Bus
+}
+
+type PlanSvc struct {
+	log     *logrus.Logger
+	catalog Catalog
+	repo    repository.PlanRepository
+	audit   repository.AuditRepository
+	bus     events.Bus
+}
+
+var _ PlanService = (*PlanSvc)(nil)
+
+func NewPlanService(log *logrus.Logger, deps PlanDeps) *PlanSvc {
+	return &PlanSvc{
+		log:     log,
+		catalog: deps.Catalog,
+		repo:    deps.Repo,
+		audit:   deps.Audit,
+		bus:     deps.Bus,
+	}
+}
+
+func (s *PlanSvc) ListPlans(includeRetired bool) ([]types.Plan, error) {
+	plans, err := s.repo.ListPlans(!includeRetired)
+	if err != nil {
+		return nil, errors.New("failed to list plans")
+	}
+	return plans, nil
+}
+
+func (s *PlanSvc) GetPlan(id uuid.UUID) (*types.Plan, error) {
+	plan, err := s.repo.GetPlan(id)
+	if err != nil {
+		if errors.Is(err, repository.ErrPlanNotFound) {
+			return nil, ErrPlanNotFound
+		}
+		return nil, errors.New("failed to load plan")
+	}
+	return plan, nil
+}
+
+func (s *PlanSvc) CreatePlan(actorID *uuid.UUID, req *types.PlanRequest) (*types.Plan, error) {
+	plan := planFromRequest(req)
+	if err := s.checkSystems(plan, nil); err != nil {
+		return nil, err
+	}
+	if err := s.codeAvailable(plan.Code, uuid.Nil); err != nil {
+		return nil, err
+	}
+
+	plan.Active = true
+	if err := s.repo.CreatePlan(plan); err != nil {
+		return nil, errors.New("failed to create plan")
+	}
+	s.record(actorID, events.PlanCreated, plan)
+	return plan, nil
+}
+
+// UpdatePlan replaces the plan's terms. Existing subscribers move to the new
+// price at their next renewal; systems and quotas apply right away.
+func (s *PlanSvc) UpdatePlan(id uuid.UUID, actorID *uuid.UUID, req *types.PlanRequest) (*types.Plan, error) {
+	existing, err := s.GetPlan(id)
+	if err != nil {
+		return nil, err
+	}
+	plan := planFromRequest(req)
+	plan.PlanID = id
+	if err := s.checkSystems(plan, existing); err != nil {
+		return nil, err
+	}
+	if err := s.codeAvailable(plan.Code, id); err != nil {
+		return nil, err
+	}
+
+	plan.UpdatedAt = time.Now()
+	if err := s.repo.ReplacePlan(plan); err != nil {
+		if errors.Is(err, repository.ErrPlanNotFound) {
+			return nil, ErrPlanNotFound
+		}
+		return nil, errors.New("failed to update plan")
+	}
+
+	updated, err := s.GetPlan(id)
+	if err != nil {
+		return nil, err
+	}
+	s.record(actorID, events.PlanUpdated, updated)
+	return updated, nil
+}
+
+func (s *PlanSvc) RetirePlan(id uuid.UUID, actorID *uuid.UUID) error {
+	plan, err := s.GetPlan(id)
+	if err != nil {
+		return err
+	}
+	if _, err := s.repo.SetPlanActive(id, false); err != nil {
+		return errors.New("failed to retire plan")
+	}
+	plan.Active = false
+	s.record(actorID, events.PlanRetired, plan)
+	return nil
+}
+
+// checkSystems resolves the plan's systems against the catalog. Systems no
+// longer sold cannot be added, though a plan already including one keeps it.
+func (s *PlanSvc) checkSystems(plan *types.Plan, existing *types.Plan) error {
+	systems := plan.Systems[:0]
+	for _, system := range plan.Systems {
+		entry, err := s.catalog.Known(system.System)
+		if err != nil {
+			return err
+		}
+		if !entry.Active() && (existing == nil || !existing.Includes(entry.Code)) {
+			return ErrSystemNotSold
+		}
+		if !slices.ContainsFunc(systems, func(p types.PlanSystem) bool { return p.System == entry.Code }) {
+			systems = append(systems, types.PlanSystem{System: entry.Code})
+		}
+	}
+	plan.Systems = systems
+	return nil
+}
+
+func (s *PlanSvc) codeAvailable(code string, self uuid.UUID) error {
+	existing, err := s.repo.GetPlanByCode(code)
+	if err != nil {
+		if errors.Is(err, repository.ErrPlanNotFound) {
+			return nil
+		}
+		return errors.New("failed to check plan code")
+	}
+	if existing.PlanID != self {
+		return ErrPlanCodeUsed
+	}
+	return nil
+}
+
+func (s *PlanSvc) record(actorID *uuid.UUID, action string, plan *types.Plan) {
+	details := map[string]interface{}{
+		"code":        plan.Code,
+		"price_cents": plan.PriceCents,
+		"currency":    plan.Currency,
+		"interval":    plan.Interval,
+		"active":      plan.Active,
+	}
+	if err := s.audit.Record(actorID, action, "plan", plan.PlanID.String(), nil, details); err != nil {
+		s.log.WithError(err).Warn("Failed to audit plan change")
+	}
+	s.bus.Publish(events.Event{
+		Type:    action,
+		ActorID: actorID,
+		Payload: details,
+	})
+}
+
+func planFromRequest(req *types.PlanRequest) *types.Plan {
+	plan := &types.Plan{
+		Code:        strings.ToLower(req.Code),
+		Name:        req.Name,
+		Description: req.Description,
+		PriceCents:  req.PriceCents,
+		Currency:    strings.ToUpper(req.Currency),
+		Interval:    req.Interval,
+		TrialDays:   req.TrialDays,
+		GraceDays:   req.GraceDays,
+	}
+	for _, system := range req.Systems {
+		plan.Systems = append(plan.Systems, types.PlanSystem{System: system})
+	}
+	for metric, limit := range req.Quotas {
+		plan.Quotas = append(plan.Quotas, types.PlanQuota{Metric: metric, Limit: limit})
+	}
+	sort.Slice(plan.Quotas, func(i, j int) bool { return plan.Quotas[i].Metric < plan.Quotas[j].Metric })
+	return plan
+}
@@ -0,0 +1,197 @@
+package service
+
+import (
+	"errors"
+	"github.com/google/uuid"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/repository"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/types"
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/events"
+	"github.com/sirupsen/logrus"
+	"time"
+)
+
+var (
+	ErrNotCustomer      = errors.New("purchases are only available to customer accounts")
+	ErrInvalidSystem    = errors.New("unknown system")
+	ErrAlreadyPurchased = errors.New("customer already owns this system")
+	ErrPurchaseNotFound = errors.New("no active purchase of this system")
+	// ErrSubscriptionRequired is returned when a customer buys a system their
+	// plan does not include.
+	ErrSubscriptionRequired = errors.New("a subscription that includes this system is required")
+)
+
+// PurchaseService lets customers take up and cancel the systems of their
+// subscription and lets the root admin grant and revoke systems outright. A
+// customer holds at most one purchase per system.
+type PurchaseService interface {
+	Purchase(customerID uuid.UUID, req *types.PurchaseRequest) (*types.CMSCusPurchase, error)
+	ListPurchases(customerID uuid.UUID) ([]types.CMSCusPurchase, error)
+	Cancel(customerID uuid.UUID, system types.SystemType, actorID *uuid.UUID) error
+	Grant(customerID uuid.UUID, actorID *uuid.UUID, req *types.PurchaseRequest) (*types.CMSCusPurchase, error)
+}
+
+type PurchaseDeps struct {
+	Catalog       Catalog
+	Repo          repository.PurchaseRepository
+	Subscriptions repository.SubscriptionRepository
+	Users         repository.AuthRepository
+	Audit         repository.AuditRepository
+	Bus           events.Bus
+}
+
+type PurchaseSvc struct {
+	log           *logrus.Logger
+	catalog       Catalog
+	repo          repository.PurchaseRepository
+	subscriptions repository.SubscriptionRepository
+	users         repository.AuthRepository
+	audit         repository.AuditRepository
+	bus           events.Bus
+}
+
+var _ PurchaseService = (*PurchaseSvc)(nil)
+
+func NewPurchaseService(log *logrus.Logger, deps PurchaseDeps) *PurchaseSvc {
+	return &PurchaseSvc{
+		log:           log,
+		catalog:       deps.Catalog,
+		repo:          deps.Repo,
+		subscriptions: deps.Subscriptions,
+		users:         deps.Users,
+		audit:         deps.Audit,
+		bus:           deps.Bus,
+	}
+}
+
+// Purchase takes up a system included in the customer's live subscription,
+// e.g. after cancelling it earlier. Subscribing already activates the plan's
+// systems. Systems no longer sold cannot be taken up.
+func (s *PurchaseSvc) Purchase(customerID uuid.UUID, req *types.PurchaseRequest) (*types.CMSCusPurchase, error) {
+	system, err := s.catalog.Sellable(req.System)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.customer(customerID); err != nil {
+		return nil, err
+	}
+	sub, err := s.subscriptions.GetLiveSubscription(customerID)
+	if err != nil && !errors.Is(err, repository.ErrSubscriptionNotFound) {
+		return nil, errors.New("failed to load subscription")
+	}
+	if sub == nil || !sub.Plan.Includes(system.Code) {
+		return nil, ErrSubscriptionRequired
+	}
+	return s.activate(customerID, nil, &sub.SubscriptionID, system.Code)
+}
+
+// Grant gives a customer a system without a sale, e.g. for a trial or after
+// an offline payment. Systems no longer sold may still be granted.
+func (s *PurchaseSvc) Grant(customerID uuid.UUID, actorID *uuid.UUID, req *types.PurchaseRequest) (*types.CMSCusPurchase, error) {
+	system, err := s.catalog.Known(req.System)
+	if err != nil {
+		return nil, err
+	}
+	return s.activate(customerID, actorID, nil, system.Code)
+}
+
+func (s *PurchaseSvc) ListPurchases(customerID uuid.UUID) ([]types.CMSCusPurchase, error) {
+	if _, err := s.customer(customerID); err != nil {
+		return nil, err
+	}
+	purchases, err := s.repo.ListPurchases(customerID)
+	if err != nil {
+		return nil, errors.New("failed to list purchases")
+	}
+	return purchases, nil
+}
+
+// Cancel ends a purchase. Customers cancel their own; the root admin revokes
+// anyone's. The row is kept so the history survives.
+func (s *PurchaseSvc) Cancel(customerID uuid.UUID, system types.SystemType, actorID *uuid.UUID) error {
+	known, err := s.catalog.Known(system)
+	if err != nil {
+		return err
+	}
+	if _, err := s.customer(customerID); err != nil {
+		return err
+	}
+	canceled, err := s.repo.CancelPurchase(customerID, known.Code, actorID, time.Now())
+	if err != nil {
+		return errors.New("failed to cancel purchase")
+	}
+	if !canceled {
+		return ErrPurchaseNotFound
+	}
+
+	purchase, err := s.repo.GetPurchase(customerID, known.Code)
+	if err != nil {
+		return nil
+	}
+	s.record(actorID, events.PurchaseCanceled, purchase)
+	return nil
+}
+
+func (s *PurchaseSvc) activate(customerID uuid.UUID, grantedBy, subscriptionID *uuid.UUID, system types.SystemType) (*types.CMSCusPurchase, error) {
+	if _, err := s.customer(customerID); err != nil {
+		return nil, err
+	}
+
+	purchase := &types.CMSCusPurchase{
+		CMSCusID:       customerID,
+		SystemName:     string(system),
+		PurchaseDate:   time.Now(),
+		GrantedBy:      grantedBy,
+		SubscriptionID: subscriptionID,
+	}
+	activated, err := s.repo.ActivatePurchase(purchase)
+	if err != nil {
+		return nil, errors.New("failed to record purchase")
+	}
+	if !activated {
+		return nil, ErrAlreadyPurchased
+	}
+
+	// Reactivation keeps the original row, so read back what was stored.
+	stored, err := s.repo.GetPurchase(customerID, system)
+	if err != nil {
+		return nil, errors.New("failed to load purchase")
+	}
+	actor := grantedBy
+	if actor == nil {
+		actor = &customerID
+	}
+	s.record(actor, events.PurchaseCreated, stored)
+	return stored, nil
+}
+
+func (s *PurchaseSvc) customer(id uuid.UUID) (*types.CMSUser, error) {
+	user, err := s.users.GetUserByID(id)
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+	if !user.IsCustomer() {
+		return nil, ErrNotCustomer
+	}
+	return user, nil
+}
+
+func (s *PurchaseSvc) record(actorID *uuid.UUID, action string, purchase *types.CMSCusPurchase) {
+	details := map[string]interface{}{
+		"customer_id": purchase.CMSCusID,
+		"system":      purchase.SystemName,
+		"granted":     purchase.GrantedBy != nil,
+	}
+	if err := s.audit.Record(actorID, action, "purchase", purchase.RelationID.String(), purchase.Namespace, details); err != nil {
+		s.log.WithError(err).Warn("Failed to audit purchase")
+	}
+	namespace := ""
+	if purchase.Namespace != nil {
+		namespace = *purchase.Namespace
+	}
+	s.bus.Publish(events.Event{
+		Type:      action,
+		Namespace: namespace,
+		ActorID:   actorID,
+		Payload:   details,
+	})
+}
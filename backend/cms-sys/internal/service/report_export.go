@@ -0,0 +1,236 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/types"
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/events"
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/mailer"
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/tabular"
+	"github.com/sirupsen/logrus"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+var (
+	customerPurchaseHeader = []string{"customer_id", "customer_name", "customer_email", "namespace", "verified",
+		"signed_up_at", "system", "purchase_date", "granted", "canceled_at"}
+	systemUsageHeader = []string{"system", "customers", "active", "canceled", "granted", "first_purchase", "last_purchase"}
+)
+
+// ReportExport is either a background job or a report ready to be streamed.
+type ReportExport struct {
+	// Job is set when the export runs in the background.
+	Job *types.Job `json:"job,omitempty"`
+	// Filename and ContentType describe the file Write produces.
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type"`
+	// Write streams the report, reading rows from the database as they are
+	// written. It is nil for background exports.
+	Write func(ctx context.Context, w io.Writer) error `json:"-"`
+}
+
+// Export checks the filter and prepares a whole report, ignoring pagination.
+// Exports are streamed unless async is set or the report has more than
+// SyncRows rows, in which case a job writes the file and mails the requester
+// a download link when it is done.
+func (s *ReportSvc) Export(report types.ReportName, filter types.ReportFilter, format tabular.Format, actorID *uuid.UUID, async bool) (*ReportExport, error) {
+	switch report {
+	case types.ReportCustomerPurchases:
+		if err := s.checkSort(&filter); err != nil {
+			return nil, err
+		}
+	case types.ReportSystemUsage:
+	default:
+		return nil, fmt.Errorf("unknown report %q", report)
+	}
+	if err := s.checkFilter(&filter); err != nil {
+		return nil, err
+	}
+	filter.Limit, filter.Offset = 0, 0
+
+	export := &ReportExport{
+		Filename:    string(report) + "-" + time.Now().UTC().Format("20060102T150405Z") + format.Extension(),
+		ContentType: format.ContentType(),
+	}
+	background := async
+	if !background && report == types.ReportCustomerPurchases && s.cfg.SyncRows > 0 && s.exportsEnabled() {
+		total, err := s.repo.CountCustomerPurchases(&filter)
+		if err != nil {
+			return nil, errors.New("failed to count report rows")
+		}
+		background = total > s.cfg.SyncRows
+	}
+
+	if !background {
+		export.Write = func(ctx context.Context, w io.Writer) error {
+			if err := s.write(ctx, report, &filter, format, w); err != nil {
+				s.log.WithError(err).WithField("report", report).Warn("Failed to stream report export")
+				return err
+			}
+			s.recordExport(actorID, report, format, nil)
+			return nil
+		}
+		return export, nil
+	}
+
+	if !s.exportsEnabled() {
+		return nil, ErrExportsDisabled
+	}
+	job := &types.Job{
+		JobID:       uuid.New(),
+		Kind:        types.JobReportExport,
+		RequestedBy: actorID,
+	}
+	err := s.jobs.Submit(job, func(ctx context.Context, job *types.Job) error {
+		return s.exportToFile(ctx, job, report, &filter, format, export.Filename)
+	})
+	if err != nil {
+		return nil, err
+	}
+	export.Job = job
+	return export, nil
+}
+
+// ExportJob returns a report export job; other jobs are not found.
+func (s *ReportSvc) ExportJob(jobID uuid.UUID) (*types.Job, error) {
+	if s.jobs == nil {
+		return nil, ErrExportsDisabled
+	}
+	job, err := s.jobs.Get(jobID)
+	if err != nil {
+		return nil, err
+	}
+	if job.Kind != types.JobReportExport {
+		return nil, ErrJobNotFound
+	}
+	return job, nil
+}
+
+func (s *ReportSvc) exportsEnabled() bool {
+	return s.jobs != nil && s.cfg.ExportDir != ""
+}
+
+// exportToFile writes the report to a folder of its own, named after the job,
+// so the download keeps the report's filename.
+func (s *ReportSvc) exportToFile(ctx context.Context, job *types.Job, report types.ReportName, filter *types.ReportFilter, format tabular.Format, filename string) error {
+	dir := filepath.Join(s.cfg.ExportDir, job.JobID.String())
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return err
+	}
+
+	target := filepath.Join(dir, filename)
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	err = s.write(ctx, report, filter, format, f)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.RemoveAll(dir)
+		return err
+	}
+
+	info, err := os.Stat(target)
+	if err != nil {
+		return err
+	}
+	job.ResultPath = target
+	job.ResultSize = info.Size()
+	s.recordExport(job.RequestedBy, report, format, &job.JobID)
+	s.notify(ctx, job, filename)
+	return nil
+}
+
+func (s *ReportSvc) write(ctx context.Context, report types.ReportName, filter *types.ReportFilter, format tabular.Format, w io.Writer) error {
+	tw, err := tabular.NewWriter(format, w, reportHeader(report))
+	if err != nil {
+		return err
+	}
+	if err := s.rows(ctx, report, filter, tw.Write); err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// rows hands every row of the report to fn, with values in the order of
+// reportHeader. Customer purchases are read as the database sends them.
+func (s *ReportSvc) rows(ctx context.Context, report types.ReportName, filter *types.ReportFilter, fn func(values []interface{}) error) error {
+	if report == types.ReportSystemUsage {
+		rows, err := s.SystemUsage(*filter)
+		if err != nil {
+			return err
+		}
+		for _, row := range rows {
+			err := fn([]interface{}{row.SystemName, row.Customers, row.Active, row.Canceled, row.Granted,
+				row.FirstPurchase, row.LastPurchase})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	return s.repo.EachCustomerPurchase(ctx, filter, func(row *types.CustomerPurchaseRow) error {
+		return fn([]interface{}{row.CustomerID, row.CMSUserName, row.CMSUserEmail, row.Namespace, row.Verified,
+			row.SignedUpAt, row.SystemName, row.PurchaseDate, row.Granted, row.CanceledAt})
+	})
+}
+
+func reportHeader(report types.ReportName) []string {
+	if report == types.ReportSystemUsage {
+		return systemUsageHeader
+	}
+	return customerPurchaseHeader
+}
+
+// notify mails the requester where to download a finished export. Failures
+// are logged; the file can still be fetched through the job.
+func (s *ReportSvc) notify(ctx context.Context, job *types.Job, filename string) {
+	if job.RequestedBy == nil {
+		return
+	}
+	fields := logrus.Fields{"job_id": job.JobID, "user_id": *job.RequestedBy}
+	user, err := s.users.GetUserByID(*job.RequestedBy)
+	if err != nil {
+		s.log.WithError(err).WithFields(fields).Warn("Failed to load report export requester")
+		return
+	}
+
+	link := fmt.Sprintf("%s/%s/download", s.cfg.DownloadURL, job.JobID)
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	err = s.mailer.Send(ctx, mailer.Message{
+		To:      user.CMSUserEmail,
+		Subject: "Your report export is ready",
+		Body: fmt.Sprintf("Hello %s,\n\nYour export %s (%d bytes) is ready. Download it here:\n%s\n",
+			user.CMSUserName, filename, job.ResultSize, link),
+	})
+	if err != nil {
+		s.log.WithError(err).WithFields(fields).Warn("Failed to notify report export requester")
+	}
+}
+
+func (s *ReportSvc) recordExport(actorID *uuid.UUID, report types.ReportName, format tabular.Format, jobID *uuid.UUID) {
+	details := map[string]interface{}{
+		"report": report,
+		"format": format,
+	}
+	if jobID != nil {
+		details["job_id"] = *jobID
+	}
+	if err := s.audit.Record(actorID, events.ReportExported, "report", string(report), nil, details); err != nil {
+		s.log.WithError(err).Warn("Failed to audit report export")
+	}
+	s.bus.Publish(events.Event{
+		Type:    events.ReportExported,
+		ActorID: actorID,
+		Payload: details,
+	})
+}
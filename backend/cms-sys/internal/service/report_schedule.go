@@ -0,0 +1,622 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/repository"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/types"
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/cron"
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/events"
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/mailer"
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/tabular"
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/utils"
+	"gorm.io/gorm"
+	"strings"
+	"time"
+)
+
+var (
+	ErrReportScheduleNotFound = errors.New("report schedule not found")
+	ErrReportSnapshotNotFound = errors.New("report snapshot not found")
+	ErrInvalidSchedule        = errors.New("invalid report schedule")
+	ErrScheduleRunning        = errors.New("report schedule is already running")
+	ErrSnapshotTooLarge       = errors.New("report has too many rows to snapshot")
+)
+
+const (
+	// scheduleBatch bounds how many due schedules one pass claims.
+	scheduleBatch = 10
+	// reportDiffRows bounds the row changes listed in a diff.
+	reportDiffRows = 100
+)
+
+// reportKeys are the columns identifying a row across snapshots.
+var reportKeys = map[types.ReportName][]string{
+	types.ReportCustomerPurchases: {"customer_id", "system"},
+	types.ReportSystemUsage:       {"system"},
+}
+
+// reportHook is the body posted to a schedule's webhook after each run.
+type reportHook struct {
+	Event       string            `json:"event"`
+	ScheduleID  uuid.UUID         `json:"schedule_id"`
+	Name        string            `json:"name"`
+	Report      types.ReportName  `json:"report"`
+	Version     int               `json:"version"`
+	GeneratedAt time.Time         `json:"generated_at"`
+	RowCount    int               `json:"row_count"`
+	Checksum    string            `json:"checksum"`
+	Diff        *types.ReportDiff `json:"diff"`
+}
+
+func (s *ReportSvc) ListSchedules() ([]types.ReportSchedule, error) {
+	schedules, err := s.schedules.ListSchedules()
+	if err != nil {
+		return nil, errors.New("failed to list report schedules")
+	}
+	return schedules, nil
+}
+
+func (s *ReportSvc) GetSchedule(id uuid.UUID) (*types.ReportSchedule, error) {
+	schedule, err := s.schedules.GetSchedule(id)
+	if err != nil {
+		if errors.Is(err, repository.ErrReportScheduleNotFound) {
+			return nil, ErrReportScheduleNotFound
+		}
+		return nil, errors.New("failed to load report schedule")
+	}
+	return schedule, nil
+}
+
+func (s *ReportSvc) CreateSchedule(actorID *uuid.UUID, req *types.ReportScheduleRequest) (*types.ReportSchedule, error) {
+	schedule := &types.ReportSchedule{ScheduleID: uuid.New(), CreatedBy: actorID}
+	if err := s.applySchedule(schedule, req, time.Now()); err != nil {
+		return nil, err
+	}
+	if err := s.schedules.CreateSchedule(schedule); err != nil {
+		return nil, errors.New("failed to create report schedule")
+	}
+	s.recordSchedule(actorID, events.ReportScheduleCreated, schedule)
+	return schedule, nil
+}
+
+// UpdateSchedule replaces the definition of a schedule and works out its next
+// run afresh. Snapshots already taken are kept.
+func (s *ReportSvc) UpdateSchedule(id uuid.UUID, actorID *uuid.UUID, req *types.ReportScheduleRequest) (*types.ReportSchedule, error) {
+	schedule, err := s.GetSchedule(id)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if err := s.applySchedule(schedule, req, now); err != nil {
+		return nil, err
+	}
+	schedule.UpdatedAt = now
+	if err := s.schedules.UpdateSchedule(schedule); err != nil {
+		if errors.Is(err, repository.ErrReportScheduleNotFound) {
+			return nil, ErrReportScheduleNotFound
+		}
+		return nil, errors.New("failed to update report schedule")
+	}
+	s.recordSchedule(actorID, events.ReportScheduleUpdated, schedule)
+	return schedule, nil
+}
+
+func (s *ReportSvc) DeleteSchedule(id uuid.UUID, actorID *uuid.UUID) error {
+	schedule, err := s.GetSchedule(id)
+	if err != nil {
+		return err
+	}
+	if _, err := s.schedules.DeleteSchedule(id); err != nil {
+		return errors.New("failed to delete report schedule")
+	}
+	s.recordSchedule(actorID, events.ReportScheduleDeleted, schedule)
+	return nil
+}
+
+// RunSchedule runs a schedule now, outside its cron times, as a background
+// job when jobs are available. Its next scheduled run is unchanged.
+func (s *ReportSvc) RunSchedule(id uuid.UUID, actorID *uuid.UUID) (*types.Job, error) {
+	if _, err := s.GetSchedule(id); err != nil {
+		return nil, err
+	}
+	schedule, err := s.schedules.Claim(id, time.Now(), s.owner, s.cfg.ScheduleLease)
+	if err != nil {
+		return nil, errors.New("failed to claim report schedule")
+	}
+	if schedule == nil {
+		return nil, ErrScheduleRunning
+	}
+
+	run := func(ctx context.Context) error {
+		if err := s.run(ctx, schedule, time.Now(), schedule.NextRunAt, actorID); err != nil {
+			s.schedules.Release(schedule.ScheduleID, s.owner, schedule.NextRunAt, err.Error())
+			return err
+		}
+		return nil
+	}
+	if s.jobs == nil {
+		return nil, run(context.Background())
+	}
+	job := &types.Job{
+		JobID:       uuid.New(),
+		Kind:        types.JobReportSchedule,
+		RequestedBy: actorID,
+	}
+	err = s.jobs.Submit(job, func(ctx context.Context, job *types.Job) error {
+		return run(ctx)
+	})
+	if err != nil {
+		s.schedules.Release(schedule.ScheduleID, s.owner, schedule.NextRunAt, "")
+		return nil, err
+	}
+	return job, nil
+}
+
+// RunDue runs every schedule whose time has come. Schedules are leased to this
+// instance first, so any number of instances can call RunDue on the same
+// database and each run still happens once. A failed run is recorded on the
+// schedule and retried at its next cron time.
+func (s *ReportSvc) RunDue(ctx context.Context, now time.Time) (*types.ReportScheduleRunReport, error) {
+	report := &types.ReportScheduleRunReport{}
+	for ctx.Err() == nil {
+		claimed, err := s.schedules.ClaimDue(now, s.owner, s.cfg.ScheduleLease, scheduleBatch)
+		if err != nil {
+			return report, errors.New("failed to claim due report schedules")
+		}
+		for i := range claimed {
+			schedule := &claimed[i]
+			next := s.nextRun(schedule, now)
+			if err := s.run(ctx, schedule, now, next, nil); err != nil {
+				s.log.WithError(err).WithField("schedule_id", schedule.ScheduleID).Warn("Failed to run report schedule")
+				s.schedules.Release(schedule.ScheduleID, s.owner, next, err.Error())
+				report.Failed++
+				continue
+			}
+			report.Ran++
+		}
+		if len(claimed) < scheduleBatch {
+			break
+		}
+	}
+	return report, nil
+}
+
+func (s *ReportSvc) Snapshots(scheduleID uuid.UUID, page, limit int) ([]types.ReportSnapshot, int64, error) {
+	if _, err := s.GetSchedule(scheduleID); err != nil {
+		return nil, 0, err
+	}
+	snapshots, total, err := s.schedules.ListSnapshots(scheduleID, page, limit)
+	if err != nil {
+		return nil, 0, errors.New("failed to list report snapshots")
+	}
+	return snapshots, total, nil
+}
+
+func (s *ReportSvc) Snapshot(scheduleID uuid.UUID, version int) (*types.ReportSnapshotDetail, error) {
+	snapshot, err := s.schedules.GetSnapshot(scheduleID, version)
+	if err != nil {
+		if errors.Is(err, repository.ErrReportSnapshotNotFound) {
+			return nil, ErrReportSnapshotNotFound
+		}
+		return nil, errors.New("failed to load report snapshot")
+	}
+	return &types.ReportSnapshotDetail{
+		ReportSnapshot: *snapshot,
+		Data:           json.RawMessage(snapshot.Data),
+		Diff:           json.RawMessage(snapshot.Diff),
+	}, nil
+}
+
+// applySchedule checks a request and copies it onto schedule, including the
+// next run after now.
+func (s *ReportSvc) applySchedule(schedule *types.ReportSchedule, req *types.ReportScheduleRequest, now time.Time) error {
+	expr, err := cron.Parse(req.Cron)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSchedule, err)
+	}
+	timezone := req.Timezone
+	if timezone == "" {
+		timezone = "UTC"
+	}
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return fmt.Errorf("%w: unknown timezone %q", ErrInvalidSchedule, timezone)
+	}
+	next := expr.Next(now.In(loc))
+	if next.IsZero() {
+		return fmt.Errorf("%w: cron expression never fires", ErrInvalidSchedule)
+	}
+
+	var namespace *string
+	if req.Namespace != "" {
+		ns, err := utils.NormalizeNamespace(req.Namespace)
+		if err != nil {
+			return ErrUnknownTenant
+		}
+		if _, err := s.tenants.GetTenantByNamespace(ns); err != nil {
+			if errors.Is(err, repository.ErrTenantNotFound) {
+				return ErrUnknownTenant
+			}
+			return errors.New("failed to load tenant")
+		}
+		namespace = &ns
+	}
+
+	filter := req.Filter.At(now)
+	if req.Report == types.ReportCustomerPurchases {
+		if err := s.checkSort(&filter); err != nil {
+			return err
+		}
+	} else {
+		filter.Sort = ""
+	}
+	if err := s.checkFilter(&filter); err != nil {
+		return err
+	}
+
+	format := req.Format
+	if format == "" {
+		format = string(tabular.CSV)
+	}
+	next = next.UTC()
+	schedule.Name = strings.TrimSpace(req.Name)
+	schedule.Report = req.Report
+	schedule.Filter = req.Filter
+	schedule.Filter.System = filter.System
+	schedule.Filter.Sort = filter.Sort
+	schedule.Namespace = namespace
+	schedule.Format = format
+	schedule.Cron = strings.TrimSpace(req.Cron)
+	schedule.Timezone = timezone
+	schedule.Recipients = req.Recipients
+	schedule.WebhookURL = req.WebhookURL
+	schedule.Enabled = req.Enabled == nil || *req.Enabled
+	schedule.NextRunAt = &next
+	return nil
+}
+
+// nextRun is the first cron time after now, or nil if there is none.
+func (s *ReportSvc) nextRun(schedule *types.ReportSchedule, now time.Time) *time.Time {
+	expr, err := cron.Parse(schedule.Cron)
+	if err != nil {
+		return nil
+	}
+	loc, err := time.LoadLocation(schedule.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	next := expr.Next(now.In(loc))
+	if next.IsZero() {
+		return nil
+	}
+	next = next.UTC()
+	return &next
+}
+
+// run takes a snapshot of the schedule's report, stores it as the next
+// version with its diff against the previous one and delivers it. The caller
+// must hold the schedule's lease; storing the snapshot releases it.
+func (s *ReportSvc) run(ctx context.Context, schedule *types.ReportSchedule, now time.Time, next *time.Time, actorID *uuid.UUID) error {
+	filter := schedule.Filter.At(now)
+	if err := s.checkFilter(&filter); err != nil {
+		return err
+	}
+	if schedule.Namespace != nil {
+		filter.Namespace = *schedule.Namespace
+	}
+
+	columns := reportHeader(schedule.Report)
+	data := &types.ReportSnapshotData{
+		FormatVersion: types.ReportSnapshotFormat,
+		Report:        schedule.Report,
+		Columns:       columns,
+		Rows:          []map[string]interface{}{},
+	}
+	if !filter.From.IsZero() {
+		data.From, data.To = &filter.From, &filter.To
+	}
+	var records [][]interface{}
+	err := s.rows(ctx, schedule.Report, &filter, func(values []interface{}) error {
+		if s.cfg.SnapshotMaxRows > 0 && len(records) >= s.cfg.SnapshotMaxRows {
+			return fmt.Errorf("%w: more than %d", ErrSnapshotTooLarge, s.cfg.SnapshotMaxRows)
+		}
+		row := make(map[string]interface{}, len(columns))
+		for i, column := range columns {
+			row[column] = tabular.Normalize(values[i])
+		}
+		records = append(records, values)
+		data.Rows = append(data.Rows, row)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	rows, err := json.Marshal(data.Rows)
+	if err != nil {
+		return err
+	}
+	checksum := sha256.Sum256(rows)
+
+	diff, err := s.diffSnapshot(schedule, encoded)
+	if err != nil {
+		return err
+	}
+	encodedDiff, err := json.Marshal(diff)
+	if err != nil {
+		return err
+	}
+
+	snapshot := &types.ReportSnapshot{
+		SnapshotID:  uuid.New(),
+		ScheduleID:  schedule.ScheduleID,
+		GeneratedAt: now,
+		RowCount:    len(data.Rows),
+		Checksum:    hex.EncodeToString(checksum[:]),
+		Data:        string(encoded),
+		Diff:        string(encodedDiff),
+	}
+	if err := s.schedules.SaveSnapshot(snapshot, s.owner, next, s.cfg.SnapshotKeep); err != nil {
+		return err
+	}
+
+	details := map[string]interface{}{
+		"name":      schedule.Name,
+		"report":    schedule.Report,
+		"version":   snapshot.Version,
+		"row_count": snapshot.RowCount,
+		"added":     diff.Added,
+		"removed":   diff.Removed,
+		"changed":   diff.Changed,
+	}
+	if err := s.audit.Record(actorID, events.ReportSnapshotCreated, "report_schedule", schedule.ScheduleID.String(), nil, details); err != nil {
+		s.log.WithError(err).Warn("Failed to audit report snapshot")
+	}
+	s.bus.Publish(events.Event{
+		Type:    events.ReportSnapshotCreated,
+		ActorID: actorID,
+		Payload: details,
+	})
+
+	if err := s.deliver(ctx, schedule, snapshot, diff, records); err != nil {
+		s.log.WithError(err).WithField("schedule_id", schedule.ScheduleID).Warn("Failed to deliver report snapshot")
+		s.schedules.SetDeliveryError(snapshot.SnapshotID, err.Error())
+	}
+	return nil
+}
+
+// diffSnapshot compares the encoded data of a new snapshot with the latest one
+// stored for the schedule. Rows are matched on the report's key columns and
+// values compared as JSON. Without a previous snapshot every row is added.
+func (s *ReportSvc) diffSnapshot(schedule *types.ReportSchedule, encoded []byte) (*types.ReportDiff, error) {
+	type stored struct {
+		Rows []map[string]json.RawMessage `json:"rows"`
+	}
+	var current, previous stored
+	if err := json.Unmarshal(encoded, &current); err != nil {
+		return nil, err
+	}
+
+	diff := &types.ReportDiff{}
+	latest, err := s.schedules.LatestSnapshot(schedule.ScheduleID)
+	switch {
+	case errors.Is(err, repository.ErrReportSnapshotNotFound):
+	case err != nil:
+		return nil, errors.New("failed to load previous report snapshot")
+	default:
+		diff.PreviousVersion = latest.Version
+		if err := json.Unmarshal([]byte(latest.Data), &previous); err != nil {
+			return nil, fmt.Errorf("failed to read snapshot %d: %w", latest.Version, err)
+		}
+	}
+
+	keys := reportKeys[schedule.Report]
+	keyOf := func(row map[string]json.RawMessage) string {
+		parts := make([]string, len(keys))
+		for i, key := range keys {
+			parts[i] = string(row[key])
+		}
+		return strings.Join(parts, "|")
+	}
+	note := func(change types.ReportRowChange) {
+		if len(diff.Rows) < reportDiffRows {
+			diff.Rows = append(diff.Rows, change)
+		}
+	}
+
+	before := make(map[string]map[string]json.RawMessage, len(previous.Rows))
+	for _, row := range previous.Rows {
+		before[keyOf(row)] = row
+	}
+	seen := make(map[string]bool, len(current.Rows))
+	for _, row := range current.Rows {
+		key := keyOf(row)
+		seen[key] = true
+		old, ok := before[key]
+		if !ok {
+			diff.Added++
+			note(types.ReportRowChange{Key: key, Change: "added"})
+			continue
+		}
+		fields := map[string]types.ReportFieldChange{}
+		for column, value := range row {
+			if !bytes.Equal(old[column], value) {
+				fields[column] = types.ReportFieldChange{From: old[column], To: value}
+			}
+		}
+		if len(fields) > 0 {
+			diff.Changed++
+			note(types.ReportRowChange{Key: key, Change: "changed", Fields: fields})
+		}
+	}
+	for _, row := range previous.Rows {
+		if key := keyOf(row); !seen[key] {
+			diff.Removed++
+			note(types.ReportRowChange{Key: key, Change: "removed"})
+		}
+	}
+	return diff, nil
+}
+
+// deliver writes the snapshot to the LMS Report table of the schedule's
+// tenant, mails it to the recipients as an attachment in the schedule's format
+// and posts a summary to the webhook. Every destination is tried; the errors
+// are returned together.
+func (s *ReportSvc) deliver(ctx context.Context, schedule *types.ReportSchedule, snapshot *types.ReportSnapshot, diff *types.ReportDiff, records [][]interface{}) error {
+	var failures []string
+
+	if schedule.Namespace != nil {
+		if err := s.storeInTenant(ctx, schedule, snapshot); err != nil {
+			failures = append(failures, "tenant report: "+err.Error())
+		}
+	}
+
+	if len(schedule.Recipients) > 0 {
+		format, err := tabular.ParseFormat(schedule.Format)
+		if err != nil {
+			format = tabular.CSV
+		}
+		var buf bytes.Buffer
+		tw, err := tabular.NewWriter(format, &buf, reportHeader(schedule.Report))
+		if err == nil {
+			for _, values := range records {
+				if err = tw.Write(values); err != nil {
+					break
+				}
+			}
+		}
+		if err == nil {
+			err = tw.Close()
+		}
+		if err != nil {
+			return fmt.Errorf("failed to render report: %w", err)
+		}
+
+		msg := mailer.Message{
+			Subject: fmt.Sprintf("%s: report version %d", schedule.Name, snapshot.Version),
+			Body:    reportSummary(schedule, snapshot, diff),
+			Attachments: []mailer.Attachment{{
+				Filename:    fmt.Sprintf("%s-v%d%s", schedule.Report, snapshot.Version, format.Extension()),
+				ContentType: format.ContentType(),
+				Data:        buf.Bytes(),
+			}},
+		}
+		for _, to := range schedule.Recipients {
+			msg.To = to
+			sendCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+			if err := s.mailer.Send(sendCtx, msg); err != nil {
+				failures = append(failures, err.Error())
+			}
+			cancel()
+		}
+	}
+
+	if schedule.WebhookURL != "" && s.hooks != nil {
+		err := s.hooks.Post(ctx, schedule.WebhookURL, &reportHook{
+			Event:       events.ReportSnapshotCreated,
+			ScheduleID:  schedule.ScheduleID,
+			Name:        schedule.Name,
+			Report:      schedule.Report,
+			Version:     snapshot.Version,
+			GeneratedAt: snapshot.GeneratedAt,
+			RowCount:    snapshot.RowCount,
+			Checksum:    snapshot.Checksum,
+			Diff:        diff,
+		})
+		if err != nil {
+			failures = append(failures, "webhook: "+err.Error())
+		}
+	}
+
+	if len(failures) > 0 {
+		return errors.New(strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+// storeInTenant adds the snapshot to the tenant's LMS Report table as
+// generated by the owner's LMS account, or else by the tenant's first LMS
+// admin, and links the row to the snapshot.
+func (s *ReportSvc) storeInTenant(ctx context.Context, schedule *types.ReportSchedule, snapshot *types.ReportSnapshot) error {
+	tenant, err := s.tenants.GetTenantByNamespace(*schedule.Namespace)
+	if err != nil {
+		return err
+	}
+	owner, err := s.users.GetUserByID(tenant.OwnerID)
+	if err != nil {
+		return err
+	}
+
+	var reportID string
+	err = s.isolation.WithTenant(ctx, s.db, tenant, func(tx *gorm.DB) error {
+		var generatedBy []string
+		err := tx.Raw(`SELECT u.lms_user_id::text
+			FROM LMS_USER u JOIN LMS_USER_Role r ON r.lms_role_id = u.lms_role_id
+			WHERE lower(u.lms_user_email) = ? OR r.lms_role_name::text = 'LMS_ADMIN'
+			ORDER BY lower(u.lms_user_email) = ? DESC, u.created_at
+			LIMIT 1`, strings.ToLower(owner.CMSUserEmail), strings.ToLower(owner.CMSUserEmail)).Scan(&generatedBy).Error
+		if err != nil {
+			return err
+		}
+		if len(generatedBy) == 0 {
+			return errors.New("the tenant has no LMS admin to generate the report")
+		}
+		return tx.Raw(`INSERT INTO Report (report_name, generated_by_user_id, generated_date, data_snapshot)
+			VALUES (?, ?, ?, ?)
+			RETURNING report_id::text`, schedule.Name, generatedBy[0], snapshot.GeneratedAt, snapshot.Data).Scan(&reportID).Error
+	})
+	if err != nil {
+		return err
+	}
+	id, err := uuid.Parse(reportID)
+	if err != nil {
+		return err
+	}
+	snapshot.TenantReportID = &id
+	return s.schedules.SetTenantReport(snapshot.SnapshotID, id)
+}
+
+func reportSummary(schedule *types.ReportSchedule, snapshot *types.ReportSnapshot, diff *types.ReportDiff) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s (%s) ran at %s with %d rows.\n\n", schedule.Name, schedule.Report,
+		snapshot.GeneratedAt.UTC().Format(time.RFC1123), snapshot.RowCount)
+	switch {
+	case diff.PreviousVersion == 0:
+		b.WriteString("This is the first version of the report.\n")
+	case diff.Empty():
+		fmt.Fprintf(&b, "Nothing changed since version %d.\n", diff.PreviousVersion)
+	default:
+		fmt.Fprintf(&b, "Since version %d: %d rows added, %d removed, %d changed.\n",
+			diff.PreviousVersion, diff.Added, diff.Removed, diff.Changed)
+	}
+	b.WriteString("\nThe full report is attached.\n")
+	return b.String()
+}
+
+func (s *ReportSvc) recordSchedule(actorID *uuid.UUID, action string, schedule *types.ReportSchedule) {
+	details := map[string]interface{}{
+		"name":    schedule.Name,
+		"report":  schedule.Report,
+		"cron":    schedule.Cron,
+		"enabled": schedule.Enabled,
+	}
+	if err := s.audit.Record(actorID, action, "report_schedule", schedule.ScheduleID.String(), nil, details); err != nil {
+		s.log.WithError(err).Warn("Failed to audit report schedule change")
+	}
+	s.bus.Publish(events.Event{
+		Type:    action,
+		ActorID: actorID,
+		Payload: details,
+	})
+}
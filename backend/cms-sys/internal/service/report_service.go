@@ -0,0 +1,210 @@
+package service
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/isolation"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/repository"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/types"
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/events"
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/hooks"
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/mailer"
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/tabular"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+var ErrInvalidSort = errors.New("unknown sort column")
+
+// ReportService answers the admin reports on customers and the systems they
+// bought, exports them as spreadsheets and runs them on schedules.
+type ReportService interface {
+	CustomerPurchases(filter types.ReportFilter) ([]types.CustomerPurchaseRow, int64, error)
+	SystemUsage(filter types.ReportFilter) ([]types.SystemUsageRow, error)
+	Export(report types.ReportName, filter types.ReportFilter, format tabular.Format, actorID *uuid.UUID, async bool) (*ReportExport, error)
+	ExportJob(jobID uuid.UUID) (*types.Job, error)
+
+	ListSchedules() ([]types.ReportSchedule, error)
+	GetSchedule(id uuid.UUID) (*types.ReportSchedule, error)
+	CreateSchedule(actorID *uuid.UUID, req *types.ReportScheduleRequest) (*types.ReportSchedule, error)
+	UpdateSchedule(id uuid.UUID, actorID *uuid.UUID, req *types.ReportScheduleRequest) (*types.ReportSchedule, error)
+	DeleteSchedule(id uuid.UUID, actorID *uuid.UUID) error
+	RunSchedule(id uuid.UUID, actorID *uuid.UUID) (*types.Job, error)
+	RunDue(ctx context.Context, now time.Time) (*types.ReportScheduleRunReport, error)
+	Snapshots(scheduleID uuid.UUID, page, limit int) ([]types.ReportSnapshot, int64, error)
+	Snapshot(scheduleID uuid.UUID, version int) (*types.ReportSnapshotDetail, error)
+}
+
+type ReportDeps struct {
+	Repo    repository.ReportRepository
+	Catalog Catalog
+	Users   repository.AuthRepository
+	Audit   repository.AuditRepository
+	Bus     events.Bus
+	Mailer  mailer.Mailer
+	// Jobs is optional; without it every export is streamed and schedules
+	// run on request before the request returns.
+	Jobs      *JobRunner
+	Schedules repository.ReportScheduleRepository
+	// Hooks is optional; without it schedule webhooks are not called.
+	Hooks *hooks.Sender
+	// Tenants, DB and Isolation reach the LMS Report table of the tenant a
+	// schedule reports on.
+	Tenants   repository.TenantRepository
+	DB        *gorm.DB
+	Isolation *isolation.Selector
+}
+
+type ReportConfig struct {
+	// ExportDir holds the files of background exports; empty streams every
+	// export.
+	ExportDir string
+	// SyncRows is the most rows streamed straight to the client; larger
+	// exports run in the background. Zero streams every export.
+	SyncRows int64
+	// DownloadURL is where requesters are sent for finished exports; the
+	// job ID and "/download" are appended.
+	DownloadURL string
+	// ScheduleLease is how long an instance may hold a schedule it runs
+	// before another instance may take it over; it must outlast a run.
+	ScheduleLease time.Duration
+	// SnapshotMaxRows fails scheduled runs with more rows; zero is no limit.
+	SnapshotMaxRows int
+	// SnapshotKeep is how many snapshots are kept per schedule; zero keeps
+	// all of them.
+	SnapshotKeep int
+}
+
+type ReportSvc struct {
+	log     *logrus.Logger
+	repo    repository.ReportRepository
+	catalog Catalog
+	users   repository.AuthRepository
+	audit   repository.AuditRepository
+	bus     events.Bus
+	mailer  mailer.Mailer
+	jobs    *JobRunner
+	cfg     ReportConfig
+
+	schedules repository.ReportScheduleRepository
+	hooks     *hooks.Sender
+	tenants   repository.TenantRepository
+	db        *gorm.DB
+	isolation *isolation.Selector
+	// owner names this instance on the schedules it leases.
+	owner string
+}
+
+var _ ReportService = (*ReportSvc)(nil)
+
+func NewReportService(log *logrus.Logger, deps ReportDeps, cfg ReportConfig) *ReportSvc {
+	return &ReportSvc{
+		log:     log,
+		repo:    deps.Repo,
+		catalog: deps.Catalog,
+		users:   deps.Users,
+		audit:   deps.Audit,
+		bus:     deps.Bus,
+		mailer:  deps.Mailer,
+		jobs:    deps.Jobs,
+		cfg:     cfg,
+
+		schedules: deps.Schedules,
+		hooks:     deps.Hooks,
+		tenants:   deps.Tenants,
+		db:        deps.DB,
+		isolation: deps.Isolation,
+		owner:     instanceName(),
+	}
+}
+
+func (s *ReportSvc) CustomerPurchases(filter types.ReportFilter) ([]types.CustomerPurchaseRow, int64, error) {
+	if err := s.checkSort(&filter); err != nil {
+		return nil, 0, err
+	}
+	if err := s.checkFilter(&filter); err != nil {
+		return nil, 0, err
+	}
+
+	rows, total, err := s.repo.CustomerPurchases(&filter)
+	if err != nil {
+		return nil, 0, errors.New("failed to load customer purchases")
+	}
+	return rows, total, nil
+}
+
+// SystemUsage reports every system in the catalog, including those nobody
+// bought, unless the filter names one.
+func (s *ReportSvc) SystemUsage(filter types.ReportFilter) ([]types.SystemUsageRow, error) {
+	if err := s.checkFilter(&filter); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.repo.SystemUsage(&filter)
+	if err != nil {
+		return nil, errors.New("failed to load system usage")
+	}
+	if filter.System != "" {
+		if len(rows) == 0 {
+			rows = append(rows, types.SystemUsageRow{SystemName: filter.System})
+		}
+		return rows, nil
+	}
+
+	codes, err := s.catalog.Codes()
+	if err != nil {
+		return nil, err
+	}
+	for _, code := range codes {
+		if !slices.ContainsFunc(rows, func(row types.SystemUsageRow) bool { return row.SystemName == code }) {
+			rows = append(rows, types.SystemUsageRow{SystemName: code})
+		}
+	}
+	slices.SortFunc(rows, func(a, b types.SystemUsageRow) int {
+		return cmp.Compare(a.SystemName, b.SystemName)
+	})
+	return rows, nil
+}
+
+// instanceName identifies this process among the instances sharing the
+// database.
+func instanceName() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "cms"
+	}
+	return fmt.Sprintf("%s-%d-%s", host, os.Getpid(), uuid.NewString()[:8])
+}
+
+func (s *ReportSvc) checkSort(filter *types.ReportFilter) error {
+	if filter.Sort == "" {
+		filter.Sort = repository.DefaultCustomerPurchaseSort
+	}
+	if sorts := repository.CustomerPurchaseSorts(); !slices.Contains(sorts, filter.Sort) {
+		return fmt.Errorf("%w, sort by one of %s", ErrInvalidSort, strings.Join(sorts, ", "))
+	}
+	return nil
+}
+
+// checkFilter resolves the system to its catalog code and rejects ranges that
+// end before they start.
+func (s *ReportSvc) checkFilter(filter *types.ReportFilter) error {
+	if filter.System != "" {
+		system, err := s.catalog.Known(filter.System)
+		if err != nil {
+			return err
+		}
+		filter.System = system.Code
+	}
+	if !filter.From.IsZero() && !filter.To.IsZero() && !filter.From.Before(filter.To) {
+		return ErrInvalidRange
+	}
+	return nil
+}
@@ -0,0 +1,409 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/isolation"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/repository"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/settings"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/types"
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/events"
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/utils"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"sync"
+	"time"
+)
+
+// SettingsService resolves settings as tenant override, then global value,
+// then registry default. Reads are served from an in-process cache so
+// middleware can call the typed getters on every request.
+type SettingsService interface {
+	Get(namespace, key string) (interface{}, error)
+	Bool(namespace, key string) bool
+	String(namespace, key string) string
+	Strings(namespace, key string) []string
+
+	ListGlobal() ([]types.SettingResponse, error)
+	SetGlobal(key string, raw []byte, actorID *uuid.UUID) (*types.SettingResponse, error)
+	ResetGlobal(key string, actorID *uuid.UUID) (*types.SettingResponse, error)
+	ListTenant(namespace string) ([]types.SettingResponse, error)
+	SetTenant(namespace, key string, raw []byte, actorID *uuid.UUID) (*types.SettingResponse, error)
+	ResetTenant(namespace, key string, actorID *uuid.UUID) (*types.SettingResponse, error)
+}
+
+type SettingsConfig struct {
+	// CacheTTL bounds how stale a cached value can be. Changes made on this
+	// instance invalidate the cache immediately; the TTL covers changes made
+	// by other instances.
+	CacheTTL time.Duration
+}
+
+type SettingsDeps struct {
+	Repo      repository.SettingsRepository
+	Tenants   repository.TenantRepository
+	Audit     repository.AuditRepository
+	DB        *gorm.DB
+	Isolation *isolation.Selector
+	Bus       events.Bus
+	Registry  *settings.Registry
+}
+
+type settingsSnapshot struct {
+	values  map[string]interface{}
+	expires time.Time
+}
+
+type SettingsSvc struct {
+	log       *logrus.Logger
+	repo      repository.SettingsRepository
+	tenants   repository.TenantRepository
+	audit     repository.AuditRepository
+	db        *gorm.DB
+	isolation *isolation.Selector
+	bus       events.Bus
+	registry  *settings.Registry
+	cfg       SettingsConfig
+
+	mu     sync.RWMutex
+	global *settingsSnapshot
+	tenant map[string]*settingsSnapshot
+}
+
+var _ SettingsService = (*SettingsSvc)(nil)
+
+func NewSettingsService(log *logrus.Logger, deps SettingsDeps, cfg SettingsConfig) *SettingsSvc {
+	s := &SettingsSvc{
+		log:       log,
+		repo:      deps.Repo,
+		tenants:   deps.Tenants,
+		audit:     deps.Audit,
+		db:        deps.DB,
+		isolation: deps.Isolation,
+		bus:       deps.Bus,
+		registry:  deps.Registry,
+		cfg:       cfg,
+		tenant:    make(map[string]*settingsSnapshot),
+	}
+	deps.Bus.Subscribe(events.SettingsChanged, func(e events.Event) {
+		s.invalidate(e.Namespace)
+	})
+	// A purged tenant must not keep serving cached values for its dropped
+	// schema.
+	deps.Bus.Subscribe(events.TenantPurged, func(e events.Event) {
+		s.invalidate(e.Namespace)
+	})
+	return s
+}
+
+func (s *SettingsSvc) Get(namespace, key string) (interface{}, error) {
+	def, ok := s.registry.Lookup(key)
+	if !ok {
+		return nil, settings.ErrUnknownKey
+	}
+	value, _, err := s.resolve(namespace, def)
+	return value, err
+}
+
+// Bool, String and Strings fall back to the registry default when the value
+// cannot be loaded, so hot paths never fail on a settings lookup.
+func (s *SettingsSvc) Bool(namespace, key string) bool {
+	v, _ := s.getOrDefault(namespace, key).(bool)
+	return v
+}
+
+func (s *SettingsSvc) String(namespace, key string) string {
+	v, _ := s.getOrDefault(namespace, key).(string)
+	return v
+}
+
+func (s *SettingsSvc) Strings(namespace, key string) []string {
+	v, _ := s.getOrDefault(namespace, key).([]string)
+	return v
+}
+
+func (s *SettingsSvc) ListGlobal() ([]types.SettingResponse, error) {
+	return s.list("")
+}
+
+func (s *SettingsSvc) SetGlobal(key string, raw []byte, actorID *uuid.UUID) (*types.SettingResponse, error) {
+	value, encoded, err := s.decode(key, raw)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.SetGlobal(key, encoded, actorID); err != nil {
+		return nil, errors.New("failed to save setting")
+	}
+	s.changed("", key, value, actorID, nil)
+
+	def, _ := s.registry.Lookup(key)
+	response := toSettingResponse(def, value, types.SettingFromGlobal)
+	return &response, nil
+}
+
+func (s *SettingsSvc) ResetGlobal(key string, actorID *uuid.UUID) (*types.SettingResponse, error) {
+	def, ok := s.registry.Lookup(key)
+	if !ok {
+		return nil, settings.ErrUnknownKey
+	}
+	if err := s.repo.DeleteGlobal(key); err != nil {
+		return nil, errors.New("failed to reset setting")
+	}
+	s.changed("", key, nil, actorID, nil)
+
+	response := toSettingResponse(def, def.Default, types.SettingFromDefault)
+	return &response, nil
+}
+
+func (s *SettingsSvc) ListTenant(namespace string) ([]types.SettingResponse, error) {
+	if _, err := s.settingsTenant(namespace); err != nil {
+		return nil, err
+	}
+	return s.list(namespace)
+}
+
+func (s *SettingsSvc) SetTenant(namespace, key string, raw []byte, actorID *uuid.UUID) (*types.SettingResponse, error) {
+	tenant, err := s.settingsTenant(namespace)
+	if err != nil {
+		return nil, err
+	}
+	value, encoded, err := s.decode(key, raw)
+	if err != nil {
+		return nil, err
+	}
+	err = s.isolation.WithTenant(utils.GetContext(), s.db, tenant, func(tx *gorm.DB) error {
+		return s.repo.SetTenant(tx, key, encoded, actorID)
+	})
+	if err != nil {
+		return nil, errors.New("failed to save setting")
+	}
+	s.changed(tenant.Namespace, key, value, actorID, tenant)
+
+	def, _ := s.registry.Lookup(key)
+	response := toSettingResponse(def, value, types.SettingFromTenant)
+	return &response, nil
+}
+
+func (s *SettingsSvc) ResetTenant(namespace, key string, actorID *uuid.UUID) (*types.SettingResponse, error) {
+	tenant, err := s.settingsTenant(namespace)
+	if err != nil {
+		return nil, err
+	}
+	def, ok := s.registry.Lookup(key)
+	if !ok {
+		return nil, settings.ErrUnknownKey
+	}
+	err = s.isolation.WithTenant(utils.GetContext(), s.db, tenant, func(tx *gorm.DB) error {
+		return s.repo.DeleteTenant(tx, key)
+	})
+	if err != nil {
+		return nil, errors.New("failed to reset setting")
+	}
+	s.changed(tenant.Namespace, key, nil, actorID, tenant)
+
+	value, source, err := s.resolve(tenant.Namespace, def)
+	if err != nil {
+		return nil, err
+	}
+	response := toSettingResponse(def, value, source)
+	return &response, nil
+}
+
+// resolve walks tenant override, global value and default for one key. An
+// empty namespace resolves the platform-wide value.
+func (s *SettingsSvc) resolve(namespace string, key settings.Key) (interface{}, types.SettingSource, error) {
+	if namespace != "" {
+		snap, err := s.tenantSnapshot(namespace)
+		if err != nil {
+			return nil, "", err
+		}
+		if v, ok := snap.values[key.Name]; ok {
+			return v, types.SettingFromTenant, nil
+		}
+	}
+
+	global, err := s.globalSnapshot()
+	if err != nil {
+		return nil, "", err
+	}
+	if v, ok := global.values[key.Name]; ok {
+		return v, types.SettingFromGlobal, nil
+	}
+	return key.Default, types.SettingFromDefault, nil
+}
+
+func (s *SettingsSvc) list(namespace string) ([]types.SettingResponse, error) {
+	keys := s.registry.Keys()
+	responses := make([]types.SettingResponse, 0, len(keys))
+	for _, key := range keys {
+		value, source, err := s.resolve(namespace, key)
+		if err != nil {
+			return nil, err
+		}
+		responses = append(responses, toSettingResponse(key, value, source))
+	}
+	return responses, nil
+}
+
+func (s *SettingsSvc) getOrDefault(namespace, key string) interface{} {
+	v, err := s.Get(namespace, key)
+	if err != nil {
+		def, _ := s.registry.Lookup(key)
+		return def.Default
+	}
+	return v
+}
+
+func (s *SettingsSvc) decode(key string, raw []byte) (interface{}, string, error) {
+	value, err := s.registry.Decode(key, raw)
+	if err != nil {
+		return nil, "", err
+	}
+	// Store the canonical encoding rather than the caller's bytes.
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return nil, "", err
+	}
+	return value, string(encoded), nil
+}
+
+// changed records the change and tells every cache, including this one, to
+// drop the affected snapshot.
+func (s *SettingsSvc) changed(namespace, key string, value interface{}, actorID *uuid.UUID, tenant *types.Tenant) {
+	details := map[string]interface{}{"key": key, "value": value}
+
+	targetType, targetID := "setting", key
+	var ns *string
+	if tenant != nil {
+		targetType, targetID, ns = "tenant", tenant.TenantID.String(), &tenant.Namespace
+	}
+	if err := s.audit.Record(actorID, events.SettingsChanged, targetType, targetID, ns, details); err != nil {
+		s.log.WithError(err).Warn("Failed to audit settings change")
+	}
+
+	s.bus.Publish(events.Event{
+		Type:      events.SettingsChanged,
+		Namespace: namespace,
+		ActorID:   actorID,
+		Payload:   details,
+	})
+}
+
+// invalidate drops the snapshot of one tenant, or the global snapshot when
+// namespace is empty.
+func (s *SettingsSvc) invalidate(namespace string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if namespace == "" {
+		s.global = nil
+		return
+	}
+	delete(s.tenant, namespace)
+}
+
+func (s *SettingsSvc) globalSnapshot() (*settingsSnapshot, error) {
+	s.mu.RLock()
+	snap := s.global
+	s.mu.RUnlock()
+	if snap != nil && time.Now().Before(snap.expires) {
+		return snap, nil
+	}
+
+	rows, err := s.repo.ListGlobal()
+	if err != nil {
+		return nil, errors.New("failed to load settings")
+	}
+	values := make(map[string]string, len(rows))
+	for _, row := range rows {
+		values[row.Key] = row.Value
+	}
+
+	snap = &settingsSnapshot{values: s.decodeStored(values), expires: time.Now().Add(s.cfg.CacheTTL)}
+	s.mu.Lock()
+	s.global = snap
+	s.mu.Unlock()
+	return snap, nil
+}
+
+func (s *SettingsSvc) tenantSnapshot(namespace string) (*settingsSnapshot, error) {
+	namespace, err := utils.NormalizeNamespace(namespace)
+	if err != nil {
+		return nil, ErrUnknownTenant
+	}
+
+	s.mu.RLock()
+	snap := s.tenant[namespace]
+	s.mu.RUnlock()
+	if snap != nil && time.Now().Before(snap.expires) {
+		return snap, nil
+	}
+
+	tenant, err := s.settingsTenant(namespace)
+	if err != nil {
+		return nil, err
+	}
+	var rows []types.TenantSetting
+	err = s.isolation.WithTenant(utils.GetContext(), s.db, tenant, func(tx *gorm.DB) error {
+		rows, err = s.repo.ListTenant(tx)
+		return err
+	})
+	if err != nil {
+		return nil, errors.New("failed to load settings")
+	}
+	values := make(map[string]string, len(rows))
+	for _, row := range rows {
+		values[row.Key] = row.Value
+	}
+
+	snap = &settingsSnapshot{values: s.decodeStored(values), expires: time.Now().Add(s.cfg.CacheTTL)}
+	s.mu.Lock()
+	s.tenant[tenant.Namespace] = snap
+	s.mu.Unlock()
+	return snap, nil
+}
+
+// decodeStored skips values that no longer pass the registry, e.g. after a
+// key was removed or its validation tightened, so they fall back to the next
+// level instead of breaking reads.
+func (s *SettingsSvc) decodeStored(raw map[string]string) map[string]interface{} {
+	values := make(map[string]interface{}, len(raw))
+	for key, encoded := range raw {
+		value, err := s.registry.Decode(key, []byte(encoded))
+		if err != nil {
+			s.log.WithError(err).WithField("key", key).Warn("Ignoring stored setting")
+			continue
+		}
+		values[key] = value
+	}
+	return values
+}
+
+func (s *SettingsSvc) settingsTenant(namespace string) (*types.Tenant, error) {
+	ns, err := utils.NormalizeNamespace(namespace)
+	if err != nil {
+		return nil, ErrUnknownTenant
+	}
+	tenant, err := s.tenants.GetTenantByNamespace(ns)
+	if err != nil {
+		if errors.Is(err, repository.ErrTenantNotFound) {
+			return nil, ErrUnknownTenant
+		}
+		return nil, errors.New("failed to load tenant")
+	}
+	if tenant.Status == types.TenantPurged {
+		return nil, ErrUnknownTenant
+	}
+	return tenant, nil
+}
+
+func toSettingResponse(key settings.Key, value interface{}, source types.SettingSource) types.SettingResponse {
+	return types.SettingResponse{
+		Key:         key.Name,
+		Kind:        string(key.Kind),
+		Description: key.Description,
+		Value:       value,
+		Default:     key.Default,
+		Source:      source,
+	}
+}
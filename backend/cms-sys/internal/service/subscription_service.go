@@ -0,0 +1,548 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/repository"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/types"
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/events"
+	"github.com/sirupsen/logrus"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNoSubscription         = errors.New("customer has no active subscription")
+	ErrAlreadySubscribed      = errors.New("customer already has an active subscription")
+	ErrPlanRetired            = errors.New("plan is not open to new subscriptions")
+	ErrSamePlan               = errors.New("subscription is already on this plan")
+	ErrPaymentFailed          = errors.New("payment failed")
+	ErrSubscriptionTransition = errors.New("subscription status does not allow this operation")
+)
+
+// SubscriptionService puts customers on plans and moves subscriptions
+// through their lifecycle: trialing, active, past due, and finally canceled
+// or expired. ProcessDue is the scheduler's entry point for renewals.
+type SubscriptionService interface {
+	GetSubscription(customerID uuid.UUID) (*types.Subscription, error)
+	ListSubscriptions(customerID *uuid.UUID, status types.SubscriptionStatus) ([]types.Subscription, error)
+	Subscribe(customerID uuid.UUID, actorID *uuid.UUID, req *types.SubscribeRequest) (*types.Subscription, error)
+	ChangePlan(customerID uuid.UUID, actorID *uuid.UUID, req *types.SubscribeRequest) (*types.Subscription, error)
+	Cancel(customerID uuid.UUID, actorID *uuid.UUID, req *types.CancelSubscriptionRequest) (*types.Subscription, error)
+	Resume(customerID uuid.UUID, actorID *uuid.UUID) (*types.Subscription, error)
+	ProcessDue(now time.Time) (*types.SubscriptionRunReport, error)
+	CustomerLimits(customerID uuid.UUID) (map[types.UsageMetric]int64, error)
+}
+
+// Charger collects the payment for a subscription period: the plan's price
+// less any coupon discount.
+type Charger interface {
+	Charge(sub *types.Subscription, plan *types.Plan, amountCents int64) error
+}
+
+type SubscriptionConfig struct {
+	// GracePeriod is how long a past-due subscription keeps its systems
+	// before it expires, unless its plan sets its own.
+	GracePeriod time.Duration
+	// RetryInterval spaces out charge attempts while past due.
+	RetryInterval time.Duration
+}
+
+type SubscriptionDeps struct {
+	Repo      repository.SubscriptionRepository
+	Plans     repository.PlanRepository
+	Purchases repository.PurchaseRepository
+	Users     repository.AuthRepository
+	Audit     repository.AuditRepository
+	Bus       events.Bus
+	// Charger is optional; without one every charge succeeds.
+	Charger Charger
+	// Coupons is optional; without it coupons cannot be redeemed.
+	Coupons Discounts
+}
+
+type SubscriptionSvc struct {
+	log       *logrus.Logger
+	repo      repository.SubscriptionRepository
+	plans     repository.PlanRepository
+	purchases repository.PurchaseRepository
+	users     repository.AuthRepository
+	audit     repository.AuditRepository
+	bus       events.Bus
+	charger   Charger
+	coupons   Discounts
+	cfg       SubscriptionConfig
+}
+
+var _ SubscriptionService = (*SubscriptionSvc)(nil)
+
+func NewSubscriptionService(log *logrus.Logger, deps SubscriptionDeps, cfg SubscriptionConfig) *SubscriptionSvc {
+	return &SubscriptionSvc{
+		log:       log,
+		repo:      deps.Repo,
+		plans:     deps.Plans,
+		purchases: deps.Purchases,
+		users:     deps.Users,
+		audit:     deps.Audit,
+		bus:       deps.Bus,
+		charger:   deps.Charger,
+		coupons:   deps.Coupons,
+		cfg:       cfg,
+	}
+}
+
+func (s *SubscriptionSvc) GetSubscription(customerID uuid.UUID) (*types.Subscription, error) {
+	if err := s.customer(customerID); err != nil {
+		return nil, err
+	}
+	return s.live(customerID)
+}
+
+func (s *SubscriptionSvc) ListSubscriptions(customerID *uuid.UUID, status types.SubscriptionStatus) ([]types.Subscription, error) {
+	subs, err := s.repo.ListSubscriptions(customerID, status)
+	if err != nil {
+		return nil, errors.New("failed to list subscriptions")
+	}
+	return subs, nil
+}
+
+// Subscribe starts a subscription. A customer's first subscription to a plan
+// with trial days starts trialing; otherwise the first period is charged
+// straight away and nothing is created if the charge fails. A coupon in the
+// request is redeemed first and discounts the first charged period; it is
+// given back if the subscription is not created.
+func (s *SubscriptionSvc) Subscribe(customerID uuid.UUID, actorID *uuid.UUID, req *types.SubscribeRequest) (*types.Subscription, error) {
+	if err := s.customer(customerID); err != nil {
+		return nil, err
+	}
+	plan, err := s.openPlan(req.Plan)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.live(customerID); err == nil {
+		return nil, ErrAlreadySubscribed
+	} else if !errors.Is(err, ErrNoSubscription) {
+		return nil, err
+	}
+	subscribed, err := s.repo.HasSubscribed(customerID)
+	if err != nil {
+		return nil, errors.New("failed to check subscription history")
+	}
+	var redemption *types.CouponRedemption
+	if req.Coupon != "" {
+		if s.coupons == nil {
+			return nil, ErrCouponNotFound
+		}
+		if redemption, err = s.coupons.Redeem(customerID, req.Coupon, plan, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	now := time.Now()
+	sub := &types.Subscription{
+		// Set up front so the first charge can refer to it.
+		SubscriptionID:     uuid.New(),
+		CustomerID:         customerID,
+		PlanID:             plan.PlanID,
+		CurrentPeriodStart: now,
+	}
+	if plan.TrialDays > 0 && !subscribed {
+		trialEnd := now.AddDate(0, 0, plan.TrialDays)
+		sub.Status = types.SubscriptionTrialing
+		sub.TrialEndsAt = &trialEnd
+		sub.CurrentPeriodEnd = trialEnd
+	} else {
+		if err := s.charge(sub, plan, redemption); err != nil {
+			s.release(redemption)
+			return nil, err
+		}
+		sub.Status = types.SubscriptionActive
+		sub.CurrentPeriodEnd = plan.Interval.Next(now)
+	}
+
+	created, err := s.repo.CreateSubscription(sub)
+	if err != nil {
+		s.release(redemption)
+		return nil, errors.New("failed to create subscription")
+	}
+	if !created {
+		s.release(redemption)
+		return nil, ErrAlreadySubscribed
+	}
+	sub.Plan = *plan
+	s.grantSystems(sub, plan.Systems)
+	if redemption != nil {
+		s.coupons.Attach(redemption, sub, sub.Status == types.SubscriptionActive)
+	}
+
+	if actorID == nil {
+		actorID = &customerID
+	}
+	s.record(actorID, events.SubscriptionCreated, sub, nil)
+	return s.live(customerID)
+}
+
+// ChangePlan moves the subscription to another plan at once. Systems and
+// quotas follow immediately; the new price is charged from the next renewal.
+func (s *SubscriptionSvc) ChangePlan(customerID uuid.UUID, actorID *uuid.UUID, req *types.SubscribeRequest) (*types.Subscription, error) {
+	sub, err := s.GetSubscription(customerID)
+	if err != nil {
+		return nil, err
+	}
+	plan, err := s.openPlan(req.Plan)
+	if err != nil {
+		return nil, err
+	}
+	if plan.PlanID == sub.PlanID {
+		return nil, ErrSamePlan
+	}
+
+	previous := sub.Plan
+	sub.PlanID = plan.PlanID
+	details := map[string]interface{}{"from_plan": previous.Code}
+	if err := s.save(sub, sub.Status, actorID, events.SubscriptionPlanChanged, details); err != nil {
+		return nil, err
+	}
+
+	var added, removed []types.PlanSystem
+	for _, system := range plan.Systems {
+		if !previous.Includes(system.System) {
+			added = append(added, system)
+		}
+	}
+	for _, system := range previous.Systems {
+		if !plan.Includes(system.System) {
+			removed = append(removed, system)
+		}
+	}
+	s.grantSystems(sub, added)
+	s.revokeSystems(sub, removed)
+	return s.live(customerID)
+}
+
+// Cancel stops the subscription from renewing. It stays live until the end
+// of the current period unless Immediately is set, in which case the plan's
+// systems are revoked at once.
+func (s *SubscriptionSvc) Cancel(customerID uuid.UUID, actorID *uuid.UUID, req *types.CancelSubscriptionRequest) (*types.Subscription, error) {
+	sub, err := s.GetSubscription(customerID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if req.Immediately {
+		if err := s.end(sub, types.SubscriptionCanceled, now, actorID, events.SubscriptionCanceled); err != nil {
+			return nil, err
+		}
+		return sub, nil
+	}
+
+	if sub.CancelAtPeriodEnd {
+		return sub, nil
+	}
+	sub.CancelAtPeriodEnd = true
+	sub.CanceledAt = &now
+	if err := s.save(sub, sub.Status, actorID, events.SubscriptionCancelScheduled, nil); err != nil {
+		return nil, err
+	}
+	return sub, nil
+}
+
+// Resume withdraws a cancellation scheduled for the end of the period.
+func (s *SubscriptionSvc) Resume(customerID uuid.UUID, actorID *uuid.UUID) (*types.Subscription, error) {
+	sub, err := s.GetSubscription(customerID)
+	if err != nil {
+		return nil, err
+	}
+	if !sub.CancelAtPeriodEnd {
+		return nil, ErrSubscriptionTransition
+	}
+
+	sub.CancelAtPeriodEnd = false
+	sub.CanceledAt = nil
+	if err := s.save(sub, sub.Status, actorID, events.SubscriptionResumed, nil); err != nil {
+		return nil, err
+	}
+	return sub, nil
+}
+
+// ProcessDue renews, cancels and expires the subscriptions whose trial or
+// period has ended, and retries past-due charges. A subscription that fails
+// to process is counted and left for the next pass.
+func (s *SubscriptionSvc) ProcessDue(now time.Time) (*types.SubscriptionRunReport, error) {
+	subs, err := s.repo.ListDue(now)
+	if err != nil {
+		return nil, errors.New("failed to list due subscriptions")
+	}
+
+	report := &types.SubscriptionRunReport{}
+	for i := range subs {
+		action, err := s.process(&subs[i], now)
+		if err != nil {
+			s.log.WithError(err).WithField("subscription_id", subs[i].SubscriptionID).Warn("Failed to process subscription")
+			report.Failed++
+			continue
+		}
+		switch action {
+		case events.SubscriptionRenewed, events.SubscriptionActivated:
+			report.Renewed++
+		case events.SubscriptionPastDue:
+			report.PastDue++
+		case events.SubscriptionCanceled:
+			report.Canceled++
+		case events.SubscriptionExpired:
+			report.Expired++
+		}
+	}
+	return report, nil
+}
+
+// CustomerLimits returns the quotas of the customer's live plan, or nil when
+// the customer has no live subscription.
+func (s *SubscriptionSvc) CustomerLimits(customerID uuid.UUID) (map[types.UsageMetric]int64, error) {
+	sub, err := s.repo.GetLiveSubscription(customerID)
+	if err != nil {
+		if errors.Is(err, repository.ErrSubscriptionNotFound) {
+			return nil, nil
+		}
+		return nil, errors.New("failed to load subscription")
+	}
+	limits := make(map[types.UsageMetric]int64, len(sub.Plan.Quotas))
+	for _, q := range sub.Plan.Quotas {
+		limits[q.Metric] = q.Limit
+	}
+	return limits, nil
+}
+
+// process handles one due subscription and returns the event it produced, if
+// any.
+func (s *SubscriptionSvc) process(sub *types.Subscription, now time.Time) (string, error) {
+	plan := &sub.Plan
+	from := sub.Status
+
+	if sub.CancelAtPeriodEnd {
+		return events.SubscriptionCanceled, s.end(sub, types.SubscriptionCanceled, now, nil, events.SubscriptionCanceled)
+	}
+
+	if from == types.SubscriptionPastDue {
+		if sub.PastDueSince != nil && !now.Before(sub.PastDueSince.Add(s.grace(plan))) {
+			return events.SubscriptionExpired, s.end(sub, types.SubscriptionExpired, now, nil, events.SubscriptionExpired)
+		}
+		if sub.NextAttemptAt != nil && now.Before(*sub.NextAttemptAt) {
+			return "", nil
+		}
+	}
+
+	// A coupon redeemed on a trial discounts the first charge after it.
+	var redemption *types.CouponRedemption
+	if s.coupons != nil && from != types.SubscriptionActive {
+		redemption = s.coupons.Pending(sub.SubscriptionID)
+	}
+	if err := s.charge(sub, plan, redemption); err != nil {
+		next := now.Add(s.cfg.RetryInterval)
+		sub.NextAttemptAt = &next
+		if from == types.SubscriptionPastDue {
+			// Still failing within the grace period; only the retry moves.
+			return "", s.save(sub, from, nil, "", nil)
+		}
+		sub.Status = types.SubscriptionPastDue
+		sub.PastDueSince = &now
+		return events.SubscriptionPastDue, s.save(sub, from, nil, events.SubscriptionPastDue, map[string]interface{}{"error": err.Error()})
+	}
+
+	// A renewal continues from the previous period end; a recovered or long
+	// overdue subscription starts a fresh period now.
+	start := sub.CurrentPeriodEnd
+	if from == types.SubscriptionPastDue || !plan.Interval.Next(start).After(now) {
+		start = now
+	}
+	sub.Status = types.SubscriptionActive
+	sub.CurrentPeriodStart = start
+	sub.CurrentPeriodEnd = plan.Interval.Next(start)
+	sub.PastDueSince = nil
+	sub.NextAttemptAt = nil
+	if redemption != nil {
+		s.coupons.MarkApplied(redemption)
+	}
+
+	action := events.SubscriptionRenewed
+	if from != types.SubscriptionActive {
+		action = events.SubscriptionActivated
+	}
+	return action, s.save(sub, from, nil, action, nil)
+}
+
+// end moves the subscription to a final status and revokes its systems.
+func (s *SubscriptionSvc) end(sub *types.Subscription, status types.SubscriptionStatus, now time.Time, actorID *uuid.UUID, action string) error {
+	from := sub.Status
+	sub.Status = status
+	sub.EndedAt = &now
+	sub.NextAttemptAt = nil
+	if status == types.SubscriptionCanceled && sub.CanceledAt == nil {
+		sub.CanceledAt = &now
+	}
+	if err := s.save(sub, from, actorID, action, nil); err != nil {
+		return err
+	}
+	s.revokeSystems(sub, sub.Plan.Systems)
+	return nil
+}
+
+// save stores the subscription if it may move from its previous status and
+// nobody else moved it first, then records action unless it is empty.
+func (s *SubscriptionSvc) save(sub *types.Subscription, from types.SubscriptionStatus, actorID *uuid.UUID, action string, details map[string]interface{}) error {
+	if sub.Status != from && !from.CanTransitionTo(sub.Status) {
+		sub.Status = from
+		return ErrSubscriptionTransition
+	}
+	saved, err := s.repo.UpdateSubscription(sub, from)
+	if err != nil {
+		return errors.New("failed to update subscription")
+	}
+	if !saved {
+		return ErrSubscriptionTransition
+	}
+	if action != "" {
+		s.record(actorID, action, sub, details)
+	}
+	return nil
+}
+
+// charge collects the plan's price less the redemption's discount, if any.
+func (s *SubscriptionSvc) charge(sub *types.Subscription, plan *types.Plan, redemption *types.CouponRedemption) error {
+	amount := plan.PriceCents
+	if redemption != nil {
+		amount = max(amount-redemption.DiscountCents, 0)
+	}
+	if s.charger == nil || amount == 0 {
+		return nil
+	}
+	if err := s.charger.Charge(sub, plan, amount); err != nil {
+		return fmt.Errorf("%w: %v", ErrPaymentFailed, err)
+	}
+	return nil
+}
+
+func (s *SubscriptionSvc) release(redemption *types.CouponRedemption) {
+	if redemption != nil {
+		s.coupons.Release(redemption)
+	}
+}
+
+func (s *SubscriptionSvc) grace(plan *types.Plan) time.Duration {
+	if plan.GraceDays != nil {
+		return time.Duration(*plan.GraceDays) * 24 * time.Hour
+	}
+	return s.cfg.GracePeriod
+}
+
+// grantSystems activates the customer's purchases of the plan's systems so
+// the systems can be attached to tenants. Purchases the customer already
+// holds are left as they are.
+func (s *SubscriptionSvc) grantSystems(sub *types.Subscription, systems []types.PlanSystem) {
+	for _, system := range systems {
+		activated, err := s.purchases.ActivatePurchase(&types.CMSCusPurchase{
+			CMSCusID:       sub.CustomerID,
+			SystemName:     string(system.System),
+			PurchaseDate:   time.Now(),
+			SubscriptionID: &sub.SubscriptionID,
+		})
+		if err != nil {
+			s.log.WithError(err).WithField("system", system.System).Warn("Failed to activate subscribed system")
+			continue
+		}
+		if activated {
+			s.bus.Publish(events.Event{Type: events.PurchaseCreated, Payload: subscribedPurchase(sub, system.System)})
+		}
+	}
+}
+
+// revokeSystems cancels the purchases that came with the subscription.
+// Systems an admin granted separately are kept.
+func (s *SubscriptionSvc) revokeSystems(sub *types.Subscription, systems []types.PlanSystem) {
+	for _, system := range systems {
+		canceled, err := s.purchases.CancelSubscribed(sub, system.System, time.Now())
+		if err != nil {
+			s.log.WithError(err).WithField("system", system.System).Warn("Failed to cancel subscribed system")
+			continue
+		}
+		if canceled {
+			s.bus.Publish(events.Event{Type: events.PurchaseCanceled, Payload: subscribedPurchase(sub, system.System)})
+		}
+	}
+}
+
+// subscribedPurchase is the payload of the purchase events raised when a
+// subscription starts or stops a system. The subscription's own event is
+// what gets audited.
+func subscribedPurchase(sub *types.Subscription, system types.SystemType) map[string]interface{} {
+	return map[string]interface{}{
+		"customer_id":     sub.CustomerID,
+		"system":          string(system),
+		"granted":         false,
+		"subscription_id": sub.SubscriptionID,
+	}
+}
+
+func (s *SubscriptionSvc) openPlan(code string) (*types.Plan, error) {
+	plan, err := s.plans.GetPlanByCode(strings.ToLower(code))
+	if err != nil {
+		if errors.Is(err, repository.ErrPlanNotFound) {
+			return nil, ErrPlanNotFound
+		}
+		return nil, errors.New("failed to load plan")
+	}
+	if !plan.Active {
+		return nil, ErrPlanRetired
+	}
+	return plan, nil
+}
+
+func (s *SubscriptionSvc) live(customerID uuid.UUID) (*types.Subscription, error) {
+	sub, err := s.repo.GetLiveSubscription(customerID)
+	if err != nil {
+		if errors.Is(err, repository.ErrSubscriptionNotFound) {
+			return nil, ErrNoSubscription
+		}
+		return nil, errors.New("failed to load subscription")
+	}
+	return sub, nil
+}
+
+func (s *SubscriptionSvc) customer(id uuid.UUID) error {
+	user, err := s.users.GetUserByID(id)
+	if err != nil {
+		return ErrUserNotFound
+	}
+	if !user.IsCustomer() {
+		return ErrNotCustomer
+	}
+	return nil
+}
+
+func (s *SubscriptionSvc) record(actorID *uuid.UUID, action string, sub *types.Subscription, details map[string]interface{}) {
+	details = subscriptionDetails(sub, details)
+	if err := s.audit.Record(actorID, action, "subscription", sub.SubscriptionID.String(), nil, details); err != nil {
+		s.log.WithError(err).Warn("Failed to audit subscription change")
+	}
+	s.bus.Publish(events.Event{
+		Type:    action,
+		ActorID: actorID,
+		Payload: details,
+	})
+}
+
+// subscriptionDetails adds the fields every subscription event carries to
+// details; subscribers such as invoicing rely on them.
+func subscriptionDetails(sub *types.Subscription, details map[string]interface{}) map[string]interface{} {
+	if details == nil {
+		details = map[string]interface{}{}
+	}
+	details["subscription_id"] = sub.SubscriptionID
+	details["customer_id"] = sub.CustomerID
+	details["plan_id"] = sub.PlanID
+	details["status"] = sub.Status
+	details["current_period_end"] = sub.CurrentPeriodEnd
+	return details
+}
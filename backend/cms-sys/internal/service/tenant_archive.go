@@ -0,0 +1,445 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/tenantdata"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/types"
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/events"
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/utils"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidArchive  = errors.New("invalid tenant archive")
+	ErrArchiveTooNew   = errors.New("archive was exported from a newer schema version")
+	ErrOwnerUnresolved = errors.New("archive owner does not exist, provide owner_id")
+	ErrExportsDisabled = errors.New("asynchronous exports are not configured")
+	ErrExportNotReady  = errors.New("export is not ready")
+	ErrImportFailed    = errors.New("failed to import tenant")
+)
+
+// ExportTenant writes a portable archive of the tenant: one NDJSON file per
+// table, its stored files and a manifest with checksums for all of them.
+// Tables are read in a single repeatable-read transaction so the archive is a
+// consistent snapshot.
+func (s *TenantSvc) ExportTenant(namespace string, w io.Writer) (*tenantdata.Manifest, error) {
+	tenant, err := s.exportableTenant(namespace)
+	if err != nil {
+		return nil, err
+	}
+	return s.export(utils.GetContext(), tenant, w)
+}
+
+// StartExport queues an export and returns immediately. The archive is written
+// to the export directory and can be downloaded once the job has succeeded.
+func (s *TenantSvc) StartExport(namespace string, actorID *uuid.UUID) (*types.Job, error) {
+	if s.jobs == nil || s.cfg.ExportDir == "" {
+		return nil, ErrExportsDisabled
+	}
+	tenant, err := s.exportableTenant(namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	job := &types.Job{
+		JobID:       uuid.New(),
+		Kind:        types.JobTenantExport,
+		Namespace:   &tenant.Namespace,
+		RequestedBy: actorID,
+	}
+	err = s.jobs.Submit(job, func(ctx context.Context, job *types.Job) error {
+		return s.exportToFile(ctx, tenant, job)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// ExportJob returns an export job, hiding jobs that belong to other tenants.
+func (s *TenantSvc) ExportJob(namespace string, jobID uuid.UUID) (*types.Job, error) {
+	if s.jobs == nil {
+		return nil, ErrExportsDisabled
+	}
+	ns, err := utils.NormalizeNamespace(namespace)
+	if err != nil {
+		return nil, ErrUnknownTenant
+	}
+
+	job, err := s.jobs.Get(jobID)
+	if err != nil {
+		return nil, err
+	}
+	if job.Kind != types.JobTenantExport || job.Namespace == nil || *job.Namespace != ns {
+		return nil, ErrJobNotFound
+	}
+	return job, nil
+}
+
+// ImportTenant restores an archive into a freshly provisioned namespace. Every
+// row gets a new ID and foreign keys are rewritten to match, so an archive can
+// be imported next to the tenant it came from. A failed import removes the
+// partially created tenant.
+func (s *TenantSvc) ImportTenant(r io.Reader, req *types.ImportTenantRequest) (*types.TenantResponse, error) {
+	dir, err := os.MkdirTemp("", "tenant-import-*")
+	if err != nil {
+		return nil, ErrImportFailed
+	}
+	defer os.RemoveAll(dir)
+
+	manifest, err := tenantdata.ExtractArchive(r, dir, s.cfg.ImportMaxBytes)
+	if err != nil {
+		s.log.WithError(err).Warn("Rejected tenant archive")
+		return nil, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+	}
+	source, err := s.isolation.Mode(types.IsolationMode(manifest.Isolation))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+	}
+	if manifest.SchemaVersion > source.Migrator().Latest() {
+		return nil, ErrArchiveTooNew
+	}
+
+	namespace := req.Namespace
+	if namespace == "" {
+		namespace = manifest.Namespace
+	}
+
+	ownerID, err := s.archiveOwner(manifest, req.OwnerID)
+	if err != nil {
+		return nil, err
+	}
+
+	created, err := s.CreateTenant(&types.CreateTenantRequest{Namespace: namespace, OwnerID: ownerID, Isolation: req.Isolation})
+	if err != nil {
+		return nil, err
+	}
+	tenant, err := s.repo.GetTenantByID(created.TenantID)
+	if err != nil {
+		return nil, ErrImportFailed
+	}
+
+	rows, err := s.loadArchive(dir, manifest, tenant)
+	if err != nil {
+		s.log.WithError(err).WithField("namespace", tenant.Namespace).Error("Failed to import tenant archive")
+		s.discardTenant(tenant)
+		return nil, ErrImportFailed
+	}
+
+	details := map[string]interface{}{
+		"source_namespace": manifest.Namespace,
+		"source_tenant_id": manifest.TenantID,
+		"exported_at":      manifest.ExportedAt,
+		"rows":             rows,
+		"files":            len(manifest.Files),
+	}
+	if err := s.audit.Record(nil, events.TenantImported, "tenant", tenant.TenantID.String(), &tenant.Namespace, details); err != nil {
+		s.log.WithError(err).Warn("Failed to audit tenant import")
+	}
+	s.bus.Publish(events.Event{
+		Type:      events.TenantImported,
+		Namespace: tenant.Namespace,
+		Payload:   details,
+	})
+
+	s.log.WithFields(logrus.Fields{
+		"namespace": tenant.Namespace,
+		"source":    manifest.Namespace,
+		"rows":      rows,
+	}).Info("Tenant imported")
+
+	return created, nil
+}
+
+func (s *TenantSvc) exportableTenant(namespace string) (*types.Tenant, error) {
+	tenant, err := s.findTenant(namespace)
+	if err != nil {
+		return nil, err
+	}
+	if tenant.Status == types.TenantPurged {
+		return nil, ErrUnknownTenant
+	}
+	return tenant, nil
+}
+
+func (s *TenantSvc) exportToFile(ctx context.Context, tenant *types.Tenant, job *types.Job) error {
+	if err := os.MkdirAll(s.cfg.ExportDir, 0o750); err != nil {
+		return err
+	}
+
+	target := filepath.Join(s.cfg.ExportDir, job.JobID.String()+".tar.gz")
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+
+	counter := tenantdata.NewHashingWriter(f)
+	_, err = s.export(ctx, tenant, counter)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(target)
+		return err
+	}
+
+	job.ResultPath = target
+	job.ResultSize = counter.Size()
+	if err := s.audit.Record(job.RequestedBy, events.TenantExported, "tenant", tenant.TenantID.String(), &tenant.Namespace, map[string]interface{}{
+		"job_id": job.JobID,
+		"bytes":  job.ResultSize,
+	}); err != nil {
+		s.log.WithError(err).Warn("Failed to audit tenant export")
+	}
+	s.bus.Publish(events.Event{
+		Type:      events.TenantExported,
+		Namespace: tenant.Namespace,
+		ActorID:   job.RequestedBy,
+		Payload:   map[string]interface{}{"job_id": job.JobID},
+	})
+	return nil
+}
+
+func (s *TenantSvc) export(ctx context.Context, tenant *types.Tenant, w io.Writer) (*tenantdata.Manifest, error) {
+	dir, err := os.MkdirTemp("", "tenant-export-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	strategy, err := s.isolation.For(tenant)
+	if err != nil {
+		return nil, err
+	}
+	schema := strategy.Schema(tenant)
+	version, err := strategy.Migrator().Current(ctx, schema)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema version: %w", err)
+	}
+
+	manifest := &tenantdata.Manifest{
+		FormatVersion: tenantdata.ArchiveFormatVersion,
+		Namespace:     tenant.Namespace,
+		TenantID:      tenant.TenantID,
+		SchemaVersion: version,
+		Isolation:     string(strategy.Mode()),
+		ExportedAt:    time.Now().UTC(),
+	}
+	if owner, err := s.users.GetUserByID(tenant.OwnerID); err == nil {
+		manifest.OwnerEmail = owner.CMSUserEmail
+	}
+
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := strategy.Scope(tx, tenant); err != nil {
+			return err
+		}
+		catalog, err := tenantdata.LoadCatalog(tx, schema)
+		if err != nil {
+			return err
+		}
+		for _, table := range catalog.Tables {
+			entry, err := exportTable(tx, dir, schema, table)
+			if err != nil {
+				return fmt.Errorf("table %s: %w", table.Name, err)
+			}
+			manifest.Tables = append(manifest.Tables, entry)
+		}
+		return nil
+	}, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.files.Walk(tenant.Namespace, func(rel string, size int64) error {
+		entry, err := s.exportFile(dir, tenant.Namespace, rel)
+		if err != nil {
+			return fmt.Errorf("file %s: %w", rel, err)
+		}
+		manifest.Files = append(manifest.Files, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tenantdata.WriteArchive(w, dir, manifest); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+func exportTable(tx *gorm.DB, dir, schema string, table tenantdata.Table) (tenantdata.TableEntry, error) {
+	name := path.Join(tenantdata.TablesDir, table.Name+".ndjson")
+	target := filepath.Join(dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(target), 0o750); err != nil {
+		return tenantdata.TableEntry{}, err
+	}
+	f, err := os.Create(target)
+	if err != nil {
+		return tenantdata.TableEntry{}, err
+	}
+	defer f.Close()
+
+	h := tenantdata.NewHashingWriter(f)
+	rows, err := tenantdata.WriteTable(tx, schema, table, h)
+	if err != nil {
+		return tenantdata.TableEntry{}, err
+	}
+	return tenantdata.TableEntry{Name: table.Name, File: name, Rows: rows, SHA256: h.Sum()}, nil
+}
+
+func (s *TenantSvc) exportFile(dir, namespace, rel string) (tenantdata.FileEntry, error) {
+	src, err := s.files.Open(namespace, rel)
+	if err != nil {
+		return tenantdata.FileEntry{}, err
+	}
+	defer src.Close()
+
+	name := path.Join(tenantdata.FilesDir, rel)
+	target := filepath.Join(dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(target), 0o750); err != nil {
+		return tenantdata.FileEntry{}, err
+	}
+	dst, err := os.Create(target)
+	if err != nil {
+		return tenantdata.FileEntry{}, err
+	}
+	defer dst.Close()
+
+	h := tenantdata.NewHashingWriter(dst)
+	if _, err := io.Copy(h, src); err != nil {
+		return tenantdata.FileEntry{}, err
+	}
+	return tenantdata.FileEntry{Path: name, Size: h.Size(), SHA256: h.Sum()}, nil
+}
+
+func (s *TenantSvc) archiveOwner(manifest *tenantdata.Manifest, ownerID *uuid.UUID) (uuid.UUID, error) {
+	if ownerID != nil {
+		return *ownerID, nil
+	}
+	if manifest.OwnerEmail == "" {
+		return uuid.Nil, ErrOwnerUnresolved
+	}
+	owner, err := s.users.GetUserByEmail(manifest.OwnerEmail)
+	if err != nil {
+		return uuid.Nil, ErrOwnerUnresolved
+	}
+	return owner.CMSUserID, nil
+}
+
+func (s *TenantSvc) loadArchive(dir string, manifest *tenantdata.Manifest, tenant *types.Tenant) (int, error) {
+	remap := tenantdata.NewRemapper()
+	remap.Map(manifest.TenantID.String(), tenant.TenantID.String())
+
+	entries := make(map[string]tenantdata.TableEntry, len(manifest.Tables))
+	for _, entry := range manifest.Tables {
+		entries[entry.Name] = entry
+	}
+
+	total := 0
+	ctx := utils.GetContext()
+	strategy, err := s.isolation.For(tenant)
+	if err != nil {
+		return 0, err
+	}
+	err = s.isolation.WithTenant(ctx, s.db, tenant, func(tx *gorm.DB) error {
+		catalog, err := tenantdata.LoadCatalog(tx, strategy.Schema(tenant))
+		if err != nil {
+			return err
+		}
+		loader := tenantdata.NewLoader(tx, catalog, remap, tenantdata.LoadOptions{
+			FreshIDs:      true,
+			Merge:         seededRows,
+			NamespaceFrom: manifest.Namespace,
+			NamespaceTo:   tenant.Namespace,
+			Set:           strategy.Columns(tenant),
+		})
+
+		for _, table := range catalog.Tables {
+			entry, ok := entries[table.Name]
+			if !ok {
+				continue
+			}
+			delete(entries, table.Name)
+
+			n, err := loadTableFile(loader, dir, entry)
+			if err != nil {
+				return err
+			}
+			total += n
+		}
+
+		for name := range entries {
+			s.log.WithField("table", name).Warn("Archive table no longer exists, skipping")
+		}
+		return nil
+	})
+	if err != nil {
+		return total, err
+	}
+
+	for _, file := range manifest.Files {
+		if err := s.importFile(dir, tenant.Namespace, file); err != nil {
+			return total, fmt.Errorf("file %s: %w", file.Path, err)
+		}
+	}
+	return total, nil
+}
+
+func loadTableFile(loader *tenantdata.Loader, dir string, entry tenantdata.TableEntry) (int, error) {
+	f, err := os.Open(filepath.Join(dir, filepath.FromSlash(entry.File)))
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return loader.LoadTable(entry.Name, f)
+}
+
+func (s *TenantSvc) importFile(dir, namespace string, file tenantdata.FileEntry) error {
+	rel := strings.TrimPrefix(file.Path, tenantdata.FilesDir+"/")
+	src, err := os.Open(filepath.Join(dir, filepath.FromSlash(file.Path)))
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := s.files.Create(namespace, rel)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
+}
+
+// discardTenant undoes CreateTenant for an import that could not complete.
+func (s *TenantSvc) discardTenant(tenant *types.Tenant) {
+	s.dropData(tenant)
+	if _, err := s.files.RemoveAll(tenant.Namespace); err != nil {
+		s.log.WithError(err).WithField("namespace", tenant.Namespace).Warn("Failed to remove imported files")
+	}
+	if err := s.repo.DeleteTenant(tenant.TenantID); err != nil {
+		s.log.WithError(err).WithField("namespace", tenant.Namespace).Error("Failed to unregister tenant")
+	}
+
+	owner, err := s.users.GetUserByID(tenant.OwnerID)
+	if err == nil && owner.CMSNameSpace != nil && *owner.CMSNameSpace == tenant.Namespace {
+		owner.CMSNameSpace = nil
+		if err := s.users.UpdateUser(owner); err != nil {
+			s.log.WithError(err).Warn("Failed to unlink owner from tenant namespace")
+		}
+	}
+}
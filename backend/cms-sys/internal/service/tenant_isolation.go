@@ -0,0 +1,139 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/isolation"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/repository"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/tenantdata"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/types"
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/events"
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/utils"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"time"
+)
+
+var ErrAlreadyDedicated = errors.New("tenant already has a dedicated schema")
+
+// IsolateTenant moves a tenant from the shared schema into a dedicated one.
+// The tenant must be suspended so nothing writes while its rows are copied.
+// Row IDs are kept, so archives and links made before the move stay valid.
+func (s *TenantSvc) IsolateTenant(namespace string, actorID *uuid.UUID) (*types.TenantResponse, error) {
+	tenant, err := s.findTenant(namespace)
+	if err != nil {
+		return nil, err
+	}
+	if tenant.Isolation != types.IsolationShared {
+		return nil, ErrAlreadyDedicated
+	}
+	if tenant.Status != types.TenantSuspended {
+		return nil, ErrInvalidTransition
+	}
+
+	ctx := utils.GetContext()
+	shared, err := s.isolation.For(tenant)
+	if err != nil {
+		return nil, err
+	}
+	current, err := shared.Migrator().Current(ctx, shared.Schema(tenant))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read shared schema version: %w", err)
+	}
+	if current != shared.Migrator().Latest() {
+		return nil, ErrSourceOutdated
+	}
+
+	dedicated, err := s.isolation.Mode(types.IsolationSchema)
+	if err != nil {
+		return nil, err
+	}
+	moved := *tenant
+	moved.Isolation = types.IsolationSchema
+	moved.UpdatedAt = time.Now()
+
+	if err := dedicated.Provision(ctx, &moved); err != nil {
+		s.log.WithError(err).WithField("namespace", tenant.Namespace).Error("Failed to provision dedicated schema")
+		s.dropData(&moved)
+		return nil, errors.New("failed to provision dedicated schema")
+	}
+
+	rows := 0
+	details := map[string]interface{}{
+		"from":   types.IsolationShared,
+		"to":     types.IsolationSchema,
+		"schema": moved.SchemaName,
+	}
+	err = s.isolation.WithTenant(ctx, s.db, &moved, func(tx *gorm.DB) error {
+		n, err := s.copyShared(tx, tenant, &moved, shared, dedicated)
+		if err != nil {
+			return err
+		}
+		rows = n
+		details["rows"] = n
+
+		if err := repository.NewTenantRepo(s.log, tx).UpdateTenant(&moved); err != nil {
+			return err
+		}
+		return repository.NewAuditRepo(s.log, tx).Record(actorID, events.TenantIsolated, "tenant", tenant.TenantID.String(), &tenant.Namespace, details)
+	})
+	if err != nil {
+		s.log.WithError(err).WithField("namespace", tenant.Namespace).Error("Failed to move tenant to a dedicated schema")
+		s.dropData(&moved)
+		return nil, errors.New("failed to move tenant to a dedicated schema")
+	}
+
+	// The registry already points at the new schema; leftover shared rows are
+	// invisible to the tenant and only cost space.
+	if err := shared.Drop(ctx, tenant); err != nil {
+		s.log.WithError(err).WithField("namespace", tenant.Namespace).Error("Failed to delete shared rows of isolated tenant")
+	}
+
+	s.bus.Publish(events.Event{
+		Type:      events.TenantIsolated,
+		Namespace: tenant.Namespace,
+		ActorID:   actorID,
+		Payload:   details,
+	})
+	s.log.WithFields(logrus.Fields{
+		"namespace": tenant.Namespace,
+		"schema":    moved.SchemaName,
+		"rows":      rows,
+	}).Info("Tenant moved to a dedicated schema")
+
+	return toTenantResponse(&moved), nil
+}
+
+// copyShared copies every table of the tenant from the shared schema into its
+// dedicated schema, switching the transaction's scope between the two.
+func (s *TenantSvc) copyShared(tx *gorm.DB, from, to *types.Tenant, shared, dedicated isolation.Strategy) (int, error) {
+	scopes := tenantdata.Scopes{
+		Source: func() error { return shared.Scope(tx, from) },
+		Target: func() error { return dedicated.Scope(tx, to) },
+	}
+	source, err := tenantdata.LoadCatalog(tx, shared.Schema(from))
+	if err != nil {
+		return 0, err
+	}
+	target, err := tenantdata.LoadCatalog(tx, dedicated.Schema(to))
+	if err != nil {
+		return 0, err
+	}
+
+	loader := tenantdata.NewLoader(tx, target, tenantdata.NewRemapper(), tenantdata.LoadOptions{
+		Merge: seededRows,
+	})
+	total := 0
+	for _, table := range source.Tables {
+		if _, ok := target.Table(table.Name); !ok {
+			continue
+		}
+		n, err := tenantdata.CopyTable(tx, shared.Schema(from), table, loader, scopes)
+		if err != nil {
+			return total, fmt.Errorf("table %s: %w", table.Name, err)
+		}
+		total += n
+	}
+	return total, nil
+}
@@ -0,0 +1,310 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/repository"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/types"
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/events"
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/utils"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"time"
+)
+
+const deletionReportSigning = "HMAC-SHA256"
+
+// purgeRetryAfter is how long a tenant may stay PURGING before another run
+// takes over, on the assumption that the purge holding it failed.
+const purgeRetryAfter = 6 * time.Hour
+
+var (
+	ErrInvalidTransition = errors.New("tenant status does not allow this operation")
+	ErrPurgeNotDue       = errors.New("tenant retention period has not elapsed")
+	ErrSigningKeyMissing = errors.New("deletion report signing key is not configured")
+)
+
+func (s *TenantSvc) SuspendTenant(namespace string, actorID *uuid.UUID, reason string) (*types.TenantResponse, error) {
+	return s.transition(namespace, actorID, events.TenantSuspended, map[string]interface{}{"reason": reason}, func(t *types.Tenant) error {
+		if t.Status != types.TenantActive {
+			return ErrInvalidTransition
+		}
+		now := time.Now()
+		t.Status = types.TenantSuspended
+		t.StatusReason = reason
+		t.SuspendedAt = &now
+		return nil
+	})
+}
+
+// ReactivateTenant brings a suspended tenant back and also cancels a pending
+// deletion, as long as the tenant has not been purged yet.
+func (s *TenantSvc) ReactivateTenant(namespace string, actorID *uuid.UUID) (*types.TenantResponse, error) {
+	return s.transition(namespace, actorID, events.TenantReactivated, nil, func(t *types.Tenant) error {
+		if t.Status != types.TenantSuspended && t.Status != types.TenantPendingDeletion {
+			return ErrInvalidTransition
+		}
+		t.Status = types.TenantActive
+		t.StatusReason = ""
+		t.SuspendedAt = nil
+		t.DeletionScheduledAt = nil
+		t.PurgeAfter = nil
+		return nil
+	})
+}
+
+func (s *TenantSvc) ScheduleDeletion(namespace string, actorID *uuid.UUID, req *types.ScheduleDeletionRequest) (*types.TenantResponse, error) {
+	grace := s.cfg.DeletionGrace
+	if req.RetentionDays != nil {
+		grace = time.Duration(*req.RetentionDays) * 24 * time.Hour
+	}
+
+	details := map[string]interface{}{
+		"reason":         req.Reason,
+		"retention_days": int(grace.Hours() / 24),
+	}
+	return s.transition(namespace, actorID, events.TenantDeletionScheduled, details, func(t *types.Tenant) error {
+		if t.Status != types.TenantActive && t.Status != types.TenantSuspended {
+			return ErrInvalidTransition
+		}
+		now := time.Now()
+		purgeAfter := now.Add(grace)
+		t.Status = types.TenantPendingDeletion
+		t.StatusReason = req.Reason
+		t.DeletionScheduledAt = &now
+		t.PurgeAfter = &purgeAfter
+		details["purge_after"] = purgeAfter
+		return nil
+	})
+}
+
+// PurgeTenant irreversibly removes a tenant scheduled for deletion: its
+// schema, stored files and search indices. The registry row is kept with
+// status PURGED so the namespace cannot be silently reused.
+//
+// The tenant is first claimed by moving it to PURGING with a conditional
+// update, so a purge on another instance or a concurrent reactivation loses
+// instead of racing the destructive steps. Those steps are idempotent; a purge
+// that fails part way leaves the tenant PURGING and PurgeExpired finishes it
+// once purgeRetryAfter has passed.
+func (s *TenantSvc) PurgeTenant(namespace string, actorID *uuid.UUID, force bool) (*types.DeletionReport, error) {
+	if len(s.cfg.ReportSigningKey) == 0 {
+		return nil, ErrSigningKeyMissing
+	}
+
+	tenant, err := s.findTenant(namespace)
+	if err != nil {
+		return nil, err
+	}
+	switch tenant.Status {
+	case types.TenantPendingDeletion:
+		if !force && tenant.PurgeAfter != nil && time.Now().Before(*tenant.PurgeAfter) {
+			return nil, ErrPurgeNotDue
+		}
+	case types.TenantPurging:
+	default:
+		return nil, ErrInvalidTransition
+	}
+
+	strategy, err := s.isolation.For(tenant)
+	if err != nil {
+		s.log.WithError(err).Error("Cannot purge tenant")
+		return nil, errors.New("failed to drop tenant data")
+	}
+
+	claimed, err := s.repo.ClaimPurge(tenant.Namespace, time.Now().Add(-purgeRetryAfter))
+	if err != nil {
+		return nil, errors.New("failed to claim tenant for purge")
+	}
+	if !claimed {
+		return nil, ErrInvalidTransition
+	}
+	tenant.Status = types.TenantPurging
+
+	ctx := utils.GetContext()
+	report := &types.DeletionReport{
+		ReportID:            uuid.New(),
+		TenantID:            tenant.TenantID,
+		Namespace:           tenant.Namespace,
+		SchemaName:          strategy.Schema(tenant),
+		RequestedBy:         actorID,
+		DeletionScheduledAt: tenant.DeletionScheduledAt,
+		Forced:              force,
+		SigningAlgorithm:    deletionReportSigning,
+	}
+
+	// In shared mode this deletes the tenant's rows rather than a schema.
+	if err := strategy.Drop(ctx, tenant); err != nil {
+		s.log.WithError(err).WithField("namespace", tenant.Namespace).Error("Failed to drop tenant data")
+		return nil, errors.New("failed to drop tenant data")
+	}
+	report.SchemaDropped = true
+
+	usage, err := s.files.RemoveAll(tenant.Namespace)
+	if err != nil {
+		s.log.WithError(err).WithField("namespace", tenant.Namespace).Error("Failed to remove tenant files")
+		return nil, errors.New("failed to remove tenant files")
+	}
+	report.FilesRemoved = usage.Files
+	report.BytesRemoved = usage.Bytes
+
+	indices, err := s.indexer.DeleteTenantIndices(ctx, tenant.Namespace)
+	if err != nil {
+		s.log.WithError(err).WithField("namespace", tenant.Namespace).Error("Failed to remove tenant search indices")
+		return nil, errors.New("failed to remove tenant search indices")
+	}
+	report.SearchIndicesRemoved = append([]string{}, indices...)
+
+	now := time.Now()
+	report.PurgedAt = now.UTC()
+	tenant.Status = types.TenantPurged
+	tenant.PurgedAt = &now
+	tenant.UpdatedAt = now
+
+	payload, err := json.Marshal(report)
+	if err != nil {
+		return nil, err
+	}
+	report.Signature = utils.HMACSign(s.cfg.ReportSigningKey, payload)
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		tenants := repository.NewTenantRepo(s.log, tx)
+		if err := tenants.UpdateTenantFrom(tenant, types.TenantPurging); err != nil {
+			return err
+		}
+		if err := tenants.SaveDeletionRecord(&types.TenantDeletionRecord{
+			ReportID:  report.ReportID,
+			TenantID:  tenant.TenantID,
+			Namespace: tenant.Namespace,
+			Report:    string(payload),
+			Signature: report.Signature,
+		}); err != nil {
+			return err
+		}
+		return repository.NewAuditRepo(s.log, tx).Record(actorID, events.TenantPurged, "tenant", tenant.TenantID.String(), &tenant.Namespace, map[string]interface{}{
+			"report_id": report.ReportID,
+			"forced":    force,
+		})
+	})
+	if err != nil {
+		return nil, errors.New("failed to record tenant purge")
+	}
+
+	s.bus.Publish(events.Event{
+		Type:      events.TenantPurged,
+		Namespace: tenant.Namespace,
+		ActorID:   actorID,
+		Payload: map[string]interface{}{
+			"tenant_id": tenant.TenantID,
+			"report_id": report.ReportID,
+		},
+	})
+	return report, nil
+}
+
+// PurgeExpired purges every tenant whose retention period has elapsed and
+// returns how many were purged. Failures are logged and retried next run.
+func (s *TenantSvc) PurgeExpired() int {
+	now := time.Now()
+	due, err := s.repo.ListDueForPurge(now, now.Add(-purgeRetryAfter))
+	if err != nil {
+		return 0
+	}
+
+	purged := 0
+	for _, tenant := range due {
+		if _, err := s.PurgeTenant(tenant.Namespace, nil, false); err != nil {
+			s.log.WithError(err).WithField("namespace", tenant.Namespace).Error("Scheduled tenant purge failed")
+			continue
+		}
+		purged++
+	}
+	return purged
+}
+
+func (s *TenantSvc) AuditTrail(namespace string, page, limit int) ([]types.AuditLog, int64, error) {
+	tenant, err := s.findTenant(namespace)
+	if err != nil {
+		return nil, 0, err
+	}
+	entries, total, err := s.audit.ListByNamespace(tenant.Namespace, limit, (page-1)*limit)
+	if err != nil {
+		return nil, 0, errors.New("failed to load audit trail")
+	}
+	return entries, total, nil
+}
+
+// transition applies mutate to the tenant and persists the new state together
+// with its audit entry, then emits eventType.
+func (s *TenantSvc) transition(namespace string, actorID *uuid.UUID, eventType string, details map[string]interface{}, mutate func(t *types.Tenant) error) (*types.TenantResponse, error) {
+	tenant, err := s.findTenant(namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	from := tenant.Status
+	if err := mutate(tenant); err != nil {
+		return nil, err
+	}
+	tenant.UpdatedAt = time.Now()
+
+	if details == nil {
+		details = map[string]interface{}{}
+	}
+	details["from"] = from
+	details["to"] = tenant.Status
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		// Conditional on the status read above, so a concurrent transition or
+		// purge claim is not overwritten.
+		if err := repository.NewTenantRepo(s.log, tx).UpdateTenantFrom(tenant, from); err != nil {
+			return err
+		}
+		if err := repository.NewAuditRepo(s.log, tx).Record(actorID, eventType, "tenant", tenant.TenantID.String(), &tenant.Namespace, details); err != nil {
+			return err
+		}
+		// Keep the tenant's own Tenants row in step; the LMS triggers read it.
+		strategy, err := s.isolation.For(tenant)
+		if err != nil {
+			return err
+		}
+		if err := strategy.Scope(tx, tenant); err != nil {
+			return err
+		}
+		return tx.Exec("UPDATE Tenants SET is_active = ? WHERE tenant_id = ?", tenant.IsActive(), tenant.TenantID).Error
+	})
+	if errors.Is(err, repository.ErrTenantStatusChanged) {
+		return nil, ErrInvalidTransition
+	}
+	if err != nil {
+		s.log.WithError(err).WithFields(logrus.Fields{
+			"namespace": tenant.Namespace,
+			"event":     eventType,
+		}).Error("Failed to change tenant status")
+		return nil, errors.New("failed to update tenant status")
+	}
+
+	s.bus.Publish(events.Event{
+		Type:      eventType,
+		Namespace: tenant.Namespace,
+		ActorID:   actorID,
+		Payload:   details,
+	})
+	return toTenantResponse(tenant), nil
+}
+
+func (s *TenantSvc) findTenant(namespace string) (*types.Tenant, error) {
+	ns, err := utils.NormalizeNamespace(namespace)
+	if err != nil {
+		return nil, ErrUnknownTenant
+	}
+	tenant, err := s.repo.GetTenantByNamespace(ns)
+	if err != nil {
+		if errors.Is(err, repository.ErrTenantNotFound) {
+			return nil, ErrUnknownTenant
+		}
+		return nil, errors.New("failed to load tenant")
+	}
+	return tenant, nil
+}
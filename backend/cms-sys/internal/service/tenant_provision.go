@@ -0,0 +1,174 @@
+package service
+
+import (
+	"errors"
+	"github.com/google/uuid"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/repository"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/types"
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/events"
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/utils"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"time"
+)
+
+var ErrTenantExists = errors.New("tenant already exists")
+
+// CreateTenant provisions storage in the requested isolation mode, brings it
+// to the latest migration and only then registers the tenant, so half-built
+// storage is never resolvable by the tenant middleware.
+func (s *TenantSvc) CreateTenant(req *types.CreateTenantRequest) (*types.TenantResponse, error) {
+	ns, err := utils.NormalizeNamespace(req.Namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := s.repo.GetTenantByNamespace(ns); err == nil {
+		return nil, ErrTenantExists
+	} else if !errors.Is(err, repository.ErrTenantNotFound) {
+		return nil, errors.New("failed to check namespace availability")
+	}
+
+	owner, err := s.users.GetUserByID(req.OwnerID)
+	if err != nil {
+		return nil, errors.New("owner not found")
+	}
+
+	source, err := s.seedSource(req)
+	if err != nil {
+		return nil, err
+	}
+
+	mode := req.Isolation
+	if mode == "" {
+		mode = s.isolation.Default()
+	}
+	if _, err := s.isolation.Mode(mode); err != nil {
+		return nil, err
+	}
+
+	tenant := &types.Tenant{
+		TenantID:   uuid.New(),
+		Namespace:  ns,
+		SchemaName: utils.TenantSchemaName(ns),
+		OwnerID:    owner.CMSUserID,
+		Status:     types.TenantActive,
+		Isolation:  mode,
+		CreatedAt:  time.Now(),
+		UpdatedAt:  time.Now(),
+	}
+
+	if err := s.provision(tenant); err != nil {
+		s.log.WithError(err).WithField("namespace", ns).Error("Failed to provision tenant storage")
+		s.dropData(tenant)
+		return nil, errors.New("failed to provision tenant")
+	}
+
+	if source != nil {
+		rows, err := s.seedFrom(tenant, source, req.IncludeUsers)
+		if err != nil {
+			s.log.WithError(err).WithFields(logrus.Fields{
+				"namespace": ns,
+				"source":    source.Namespace,
+			}).Error("Failed to copy tenant content")
+			s.dropData(tenant)
+			if _, err := s.files.RemoveAll(ns); err != nil {
+				s.log.WithError(err).WithField("namespace", ns).Warn("Failed to remove copied files")
+			}
+			return nil, errors.New("failed to copy tenant content")
+		}
+		s.log.WithFields(logrus.Fields{
+			"namespace":     ns,
+			"source":        source.Namespace,
+			"rows":          rows,
+			"include_users": req.IncludeUsers,
+		}).Info("Tenant seeded from source")
+	}
+
+	if err := s.repo.CreateTenant(tenant); err != nil {
+		s.dropData(tenant)
+		return nil, errors.New("failed to register tenant")
+	}
+
+	if owner.CMSNameSpace == nil {
+		owner.CMSNameSpace = &tenant.Namespace
+		if err := s.users.UpdateUser(owner); err != nil {
+			s.log.WithError(err).Warn("Failed to link owner to tenant namespace")
+		}
+	}
+
+	payload := map[string]interface{}{"tenant_id": tenant.TenantID}
+	if source != nil {
+		payload["source"] = source.Namespace
+	}
+	s.bus.Publish(events.Event{
+		Type:      events.TenantProvisioned,
+		Namespace: tenant.Namespace,
+		Payload:   payload,
+	})
+
+	fields := logrus.Fields{"namespace": tenant.Namespace, "isolation": tenant.Isolation}
+	if strategy, err := s.isolation.For(tenant); err == nil {
+		fields["schema"] = strategy.Schema(tenant)
+	}
+	s.log.WithFields(fields).Info("Tenant provisioned")
+
+	return toTenantResponse(tenant), nil
+}
+
+func (s *TenantSvc) ListTenants() ([]types.TenantResponse, error) {
+	tenants, err := s.repo.ListTenants()
+	if err != nil {
+		return nil, errors.New("failed to list tenants")
+	}
+
+	responses := make([]types.TenantResponse, 0, len(tenants))
+	for i := range tenants {
+		responses = append(responses, *toTenantResponse(&tenants[i]))
+	}
+	return responses, nil
+}
+
+func (s *TenantSvc) provision(tenant *types.Tenant) error {
+	ctx := utils.GetContext()
+	strategy, err := s.isolation.For(tenant)
+	if err != nil {
+		return err
+	}
+	if err := strategy.Provision(ctx, tenant); err != nil {
+		return err
+	}
+
+	// The LMS tables reference their own Tenants row, so every tenant carries
+	// a single row mirroring the registry entry.
+	return s.isolation.WithTenant(ctx, s.db, tenant, func(tx *gorm.DB) error {
+		return tx.Exec(
+			"INSERT INTO Tenants (tenant_id, namespace, cms_owner_id, is_active) VALUES (?, ?, ?, TRUE)",
+			tenant.TenantID, tenant.Namespace, tenant.OwnerID,
+		).Error
+	})
+}
+
+// dropData removes whatever storage a failed provisioning left behind.
+func (s *TenantSvc) dropData(tenant *types.Tenant) {
+	strategy, err := s.isolation.For(tenant)
+	if err == nil {
+		err = strategy.Drop(utils.GetContext(), tenant)
+	}
+	if err != nil {
+		s.log.WithError(err).WithField("namespace", tenant.Namespace).Error("Failed to drop tenant data")
+	}
+}
+
+func toTenantResponse(tenant *types.Tenant) *types.TenantResponse {
+	return &types.TenantResponse{
+		TenantID:     tenant.TenantID,
+		Namespace:    tenant.Namespace,
+		Status:       tenant.Status,
+		Isolation:    tenant.Isolation,
+		StatusReason: tenant.StatusReason,
+		IsTemplate:   tenant.IsTemplate,
+		PurgeAfter:   tenant.PurgeAfter,
+		CreatedAt:    tenant.CreatedAt,
+	}
+}
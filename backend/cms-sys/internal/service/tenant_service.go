@@ -0,0 +1,142 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/isolation"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/repository"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/tenantdata"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/types"
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/events"
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/search"
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/storage"
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/utils"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"io"
+	"time"
+)
+
+var (
+	ErrUnknownTenant   = errors.New("unknown tenant")
+	ErrTenantSuspended = errors.New("tenant is suspended")
+)
+
+type TenantService interface {
+	ResolveTenant(namespace string) (*types.Tenant, error)
+	// Content counts the LMS data visible through db, a handle already scoped
+	// to one tenant such as middleware.TenantDB.
+	Content(db *gorm.DB) (*types.TenantContent, error)
+	CreateTenant(req *types.CreateTenantRequest) (*types.TenantResponse, error)
+	ListTenants() ([]types.TenantResponse, error)
+	SetTemplate(namespace string, actorID *uuid.UUID, template bool) (*types.TenantResponse, error)
+	ListTemplates() ([]types.TenantResponse, error)
+
+	SuspendTenant(namespace string, actorID *uuid.UUID, reason string) (*types.TenantResponse, error)
+	ReactivateTenant(namespace string, actorID *uuid.UUID) (*types.TenantResponse, error)
+	ScheduleDeletion(namespace string, actorID *uuid.UUID, req *types.ScheduleDeletionRequest) (*types.TenantResponse, error)
+	PurgeTenant(namespace string, actorID *uuid.UUID, force bool) (*types.DeletionReport, error)
+	PurgeExpired() int
+	AuditTrail(namespace string, page, limit int) ([]types.AuditLog, int64, error)
+
+	ExportTenant(namespace string, w io.Writer) (*tenantdata.Manifest, error)
+	ImportTenant(r io.Reader, req *types.ImportTenantRequest) (*types.TenantResponse, error)
+	StartExport(namespace string, actorID *uuid.UUID) (*types.Job, error)
+	ExportJob(namespace string, jobID uuid.UUID) (*types.Job, error)
+
+	IsolateTenant(namespace string, actorID *uuid.UUID) (*types.TenantResponse, error)
+}
+
+type TenantConfig struct {
+	// DeletionGrace is how long a tenant scheduled for deletion is kept before
+	// it can be purged, unless the request overrides it.
+	DeletionGrace time.Duration
+	// ReportSigningKey signs deletion reports. Purging is refused without it.
+	ReportSigningKey []byte
+	// ExportDir holds archives produced by asynchronous exports.
+	ExportDir string
+	// ImportMaxBytes caps the unpacked size of an archive being imported.
+	ImportMaxBytes int64
+}
+
+type TenantDeps struct {
+	Repo      repository.TenantRepository
+	Users     repository.AuthRepository
+	Audit     repository.AuditRepository
+	DB        *gorm.DB
+	Isolation *isolation.Selector
+	Bus       events.Bus
+	Files     storage.TenantFiles
+	Indexer   search.Indexer
+	Jobs      *JobRunner
+}
+
+type TenantSvc struct {
+	log       *logrus.Logger
+	repo      repository.TenantRepository
+	users     repository.AuthRepository
+	audit     repository.AuditRepository
+	db        *gorm.DB
+	isolation *isolation.Selector
+	bus       events.Bus
+	files     storage.TenantFiles
+	indexer   search.Indexer
+	jobs      *JobRunner
+	cfg       TenantConfig
+}
+
+var _ TenantService = (*TenantSvc)(nil)
+
+func NewTenantService(log *logrus.Logger, deps TenantDeps, cfg TenantConfig) *TenantSvc {
+	return &TenantSvc{
+		log:       log,
+		repo:      deps.Repo,
+		users:     deps.Users,
+		audit:     deps.Audit,
+		db:        deps.DB,
+		isolation: deps.Isolation,
+		bus:       deps.Bus,
+		files:     deps.Files,
+		indexer:   deps.Indexer,
+		jobs:      deps.Jobs,
+		cfg:       cfg,
+	}
+}
+
+// ResolveTenant looks a namespace up in the registry and only hands back
+// tenants that are allowed to serve traffic.
+func (s *TenantSvc) ResolveTenant(namespace string) (*types.Tenant, error) {
+	ns, err := utils.NormalizeNamespace(namespace)
+	if err != nil {
+		return nil, ErrUnknownTenant
+	}
+
+	tenant, err := s.repo.GetTenantByNamespace(ns)
+	if err != nil {
+		if errors.Is(err, repository.ErrTenantNotFound) {
+			return nil, ErrUnknownTenant
+		}
+		s.log.WithError(err).Error("Failed to resolve tenant")
+		return nil, errors.New("failed to resolve tenant")
+	}
+
+	if tenant.Status == types.TenantPurged {
+		return nil, ErrUnknownTenant
+	}
+	if !tenant.IsActive() {
+		return nil, ErrTenantSuspended
+	}
+	return tenant, nil
+}
+
+func (s *TenantSvc) Content(db *gorm.DB) (*types.TenantContent, error) {
+	content := &types.TenantContent{}
+	if err := db.Raw("SELECT count(*) FROM lms_user").Scan(&content.Users).Error; err != nil {
+		return nil, fmt.Errorf("failed to count users: %w", err)
+	}
+	if err := db.Raw("SELECT count(*) FROM course").Scan(&content.Courses).Error; err != nil {
+		return nil, fmt.Errorf("failed to count courses: %w", err)
+	}
+	return content, nil
+}
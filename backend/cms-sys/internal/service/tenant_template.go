@@ -0,0 +1,223 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/tenantdata"
+	"github.com/multi-tenants-cms-golang/cms-sys/internal/types"
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/events"
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/utils"
+	"gorm.io/gorm"
+	"io"
+)
+
+var (
+	ErrNotTemplate    = errors.New("source tenant is not a template")
+	ErrSourceOutdated = errors.New("source tenant schema is behind, migrate it first")
+)
+
+// contentTables are copied from templates and from clones that exclude users:
+// course content, pages and settings. None of them hold personal data; course
+// instructors are reassigned to the new tenant's owner.
+var contentTables = map[string]bool{
+	"course_category": true,
+	"course":          true,
+	"module":          true,
+	"quiz":            true,
+	"lesson":          true,
+	"assignment":      true,
+	"page":            true,
+	"tenant_setting":  true,
+}
+
+// seededRows lists tables whose rows are matched to rows a new schema already
+// has (seeded roles and the schema's own Tenants row) instead of being
+// inserted again.
+var seededRows = map[string][]string{
+	"lms_user_role": {"lms_role_name"},
+	"tenants":       {"namespace"},
+}
+
+// SetTemplate marks or unmarks a tenant as a template.
+func (s *TenantSvc) SetTemplate(namespace string, actorID *uuid.UUID, template bool) (*types.TenantResponse, error) {
+	details := map[string]interface{}{"is_template": template}
+	return s.transition(namespace, actorID, events.TenantTemplateChanged, details, func(t *types.Tenant) error {
+		if t.Status == types.TenantPurged {
+			return ErrInvalidTransition
+		}
+		t.IsTemplate = template
+		return nil
+	})
+}
+
+func (s *TenantSvc) ListTemplates() ([]types.TenantResponse, error) {
+	tenants, err := s.repo.ListTenants()
+	if err != nil {
+		return nil, errors.New("failed to list tenants")
+	}
+
+	responses := make([]types.TenantResponse, 0)
+	for i := range tenants {
+		if tenants[i].IsTemplate && tenants[i].Status != types.TenantPurged {
+			responses = append(responses, *toTenantResponse(&tenants[i]))
+		}
+	}
+	return responses, nil
+}
+
+// seedSource returns the tenant a create request copies from, if any.
+func (s *TenantSvc) seedSource(req *types.CreateTenantRequest) (*types.Tenant, error) {
+	name := req.CloneFrom
+	if req.Template != "" {
+		name = req.Template
+	}
+	if name == "" {
+		return nil, nil
+	}
+
+	source, err := s.exportableTenant(name)
+	if err != nil {
+		return nil, err
+	}
+	if req.Template != "" && !source.IsTemplate {
+		return nil, ErrNotTemplate
+	}
+
+	strategy, err := s.isolation.For(source)
+	if err != nil {
+		return nil, err
+	}
+	current, err := strategy.Migrator().Current(utils.GetContext(), strategy.Schema(source))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read source schema version: %w", err)
+	}
+	if current != strategy.Migrator().Latest() {
+		return nil, ErrSourceOutdated
+	}
+	return source, nil
+}
+
+// seedFrom copies rows from source into the freshly provisioned tenant. Every
+// row gets a new UUID and foreign keys are rewritten to the copies. Source and
+// target may use different isolation modes, so the transaction switches scope
+// between reading and writing.
+func (s *TenantSvc) seedFrom(tenant, source *types.Tenant, includeUsers bool) (int, error) {
+	remap := tenantdata.NewRemapper()
+	remap.Map(source.TenantID.String(), tenant.TenantID.String())
+
+	from, err := s.isolation.For(source)
+	if err != nil {
+		return 0, err
+	}
+	to, err := s.isolation.For(tenant)
+	if err != nil {
+		return 0, err
+	}
+	total := 0
+	err = s.isolation.WithTenant(utils.GetContext(), s.db, tenant, func(tx *gorm.DB) error {
+		scopes := tenantdata.Scopes{
+			Source: func() error { return from.Scope(tx, source) },
+			Target: func() error { return to.Scope(tx, tenant) },
+		}
+		fromCatalog, err := tenantdata.LoadCatalog(tx, from.Schema(source))
+		if err != nil {
+			return err
+		}
+		toCatalog, err := tenantdata.LoadCatalog(tx, to.Schema(tenant))
+		if err != nil {
+			return err
+		}
+
+		if !includeUsers {
+			if err := s.reassignUsers(tx, tenant, from.Schema(source), remap, scopes); err != nil {
+				return err
+			}
+		}
+
+		loader := tenantdata.NewLoader(tx, toCatalog, remap, tenantdata.LoadOptions{
+			FreshIDs:      true,
+			Merge:         seededRows,
+			NamespaceFrom: source.Namespace,
+			NamespaceTo:   tenant.Namespace,
+			Set:           to.Columns(tenant),
+		})
+		for _, table := range fromCatalog.Tables {
+			if !includeUsers && !contentTables[table.Name] {
+				continue
+			}
+			if _, ok := toCatalog.Table(table.Name); !ok {
+				continue
+			}
+			n, err := tenantdata.CopyTable(tx, from.Schema(source), table, loader, scopes)
+			if err != nil {
+				return fmt.Errorf("table %s: %w", table.Name, err)
+			}
+			total += n
+		}
+		return nil
+	})
+	if err != nil {
+		return total, err
+	}
+
+	return total, s.copyFiles(source.Namespace, tenant.Namespace)
+}
+
+// reassignUsers creates an instructor account for the new owner and maps
+// every user of the source onto it, so copied courses keep a valid instructor
+// without carrying over anyone's personal data.
+func (s *TenantSvc) reassignUsers(tx *gorm.DB, tenant *types.Tenant, sourceSchema string, remap *tenantdata.Remapper, scopes tenantdata.Scopes) error {
+	owner, err := s.users.GetUserByID(tenant.OwnerID)
+	if err != nil {
+		return err
+	}
+
+	// The password is unusable until the owner sets one through the LMS.
+	var instructorID string
+	err = tx.Raw(`INSERT INTO LMS_USER (lms_user_email, password, lms_role_id, tenant_id)
+		SELECT ?, '!', lms_role_id, ? FROM LMS_USER_Role WHERE lms_role_name = 'INSTRUCTOR'
+		RETURNING lms_user_id::text`, owner.CMSUserEmail, tenant.TenantID).Scan(&instructorID).Error
+	if err != nil {
+		return err
+	}
+	if instructorID == "" {
+		return errors.New("instructor role is missing from the tenant schema")
+	}
+
+	if err := scopes.Source(); err != nil {
+		return err
+	}
+	var userIDs []string
+	query := fmt.Sprintf("SELECT lms_user_id::text FROM %s.LMS_USER", utils.QuoteIdent(sourceSchema))
+	if err := tx.Raw(query).Scan(&userIDs).Error; err != nil {
+		return err
+	}
+	if err := scopes.Target(); err != nil {
+		return err
+	}
+	for _, id := range userIDs {
+		remap.Map(id, instructorID)
+	}
+	return nil
+}
+
+func (s *TenantSvc) copyFiles(from, to string) error {
+	return s.files.Walk(from, func(rel string, size int64) error {
+		src, err := s.files.Open(from, rel)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+
+		dst, err := s.files.Create(to, rel)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(dst, src); err != nil {
+			dst.Close()
+			return err
+		}
+		return dst.Close()
+	})
+}
@@ -0,0 +1,133 @@
+package settings
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+const (
+	BrandingDisplayName  = "branding.display_name"
+	BrandingPrimaryColor = "branding.primary_color"
+	BrandingLogoURL      = "branding.logo_url"
+	LocaleDefault        = "locale.default"
+	SignupAllowedDomains = "signup.allowed_domains"
+	SecurityMFARequired  = "security.mfa_required"
+	CORSAllowedOrigins   = "cors.allowed_origins"
+)
+
+var (
+	hexColorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+	localePattern   = regexp.MustCompile(`^[a-z]{2}(-[A-Z]{2})?$`)
+	domainPattern   = regexp.MustCompile(`^([a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?\.)+[a-z]{2,}$`)
+)
+
+// Default returns the registry of every setting the platform understands.
+func Default() *Registry {
+	r := NewRegistry()
+	r.Register(Key{
+		Name:        BrandingDisplayName,
+		Kind:        KindString,
+		Default:     "",
+		Description: "Name shown in the tenant's UI instead of the namespace",
+		Validate:    maxLength(100),
+	})
+	r.Register(Key{
+		Name:        BrandingPrimaryColor,
+		Kind:        KindString,
+		Default:     "#1F6FEB",
+		Description: "Primary brand color as #RRGGBB",
+		Validate:    matches(hexColorPattern, "a #RRGGBB color"),
+	})
+	r.Register(Key{
+		Name:        BrandingLogoURL,
+		Kind:        KindString,
+		Default:     "",
+		Description: "HTTPS URL of the tenant logo",
+		Validate:    optionalURL("https"),
+	})
+	r.Register(Key{
+		Name:        LocaleDefault,
+		Kind:        KindString,
+		Default:     "en",
+		Description: "Default locale, e.g. en or pt-BR",
+		Validate:    matches(localePattern, "a locale such as en or pt-BR"),
+	})
+	r.Register(Key{
+		Name:        SignupAllowedDomains,
+		Kind:        KindStringList,
+		Default:     []string{},
+		Description: "Email domains allowed to sign up; empty allows any",
+		Validate:    eachString(matches(domainPattern, "a lower-case domain name")),
+	})
+	r.Register(Key{
+		Name:        SecurityMFARequired,
+		Kind:        KindBool,
+		Default:     false,
+		Description: "Require multi-factor authentication for every user",
+	})
+	r.Register(Key{
+		Name:        CORSAllowedOrigins,
+		Kind:        KindStringList,
+		Default:     []string{},
+		Description: "Extra browser origins allowed to call the API",
+		Validate:    eachString(origin),
+	})
+	return r
+}
+
+func maxLength(n int) func(interface{}) error {
+	return func(v interface{}) error {
+		if len(v.(string)) > n {
+			return fmt.Errorf("must be at most %d characters", n)
+		}
+		return nil
+	}
+}
+
+func matches(pattern *regexp.Regexp, what string) func(interface{}) error {
+	return func(v interface{}) error {
+		if !pattern.MatchString(v.(string)) {
+			return fmt.Errorf("must be %s", what)
+		}
+		return nil
+	}
+}
+
+func optionalURL(scheme string) func(interface{}) error {
+	return func(v interface{}) error {
+		s := v.(string)
+		if s == "" {
+			return nil
+		}
+		u, err := url.Parse(s)
+		if err != nil || u.Scheme != scheme || u.Host == "" {
+			return fmt.Errorf("must be an %s URL", scheme)
+		}
+		return nil
+	}
+}
+
+func eachString(check func(interface{}) error) func(interface{}) error {
+	return func(v interface{}) error {
+		for _, s := range v.([]string) {
+			if err := check(s); err != nil {
+				return fmt.Errorf("%q %v", s, err)
+			}
+		}
+		return nil
+	}
+}
+
+func origin(v interface{}) error {
+	u, err := url.Parse(v.(string))
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return errors.New("must be an origin such as https://app.example.com")
+	}
+	if u.Path != "" || u.RawQuery != "" || strings.HasSuffix(v.(string), "/") {
+		return errors.New("must not contain a path")
+	}
+	return nil
+}
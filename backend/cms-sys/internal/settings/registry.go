@@ -0,0 +1,122 @@
+package settings
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+type Kind string
+
+const (
+	KindString     Kind = "string"
+	KindBool       Kind = "bool"
+	KindInt        Kind = "int"
+	KindStringList Kind = "string_list"
+)
+
+var (
+	ErrUnknownKey   = errors.New("unknown setting")
+	ErrInvalidValue = errors.New("invalid setting value")
+)
+
+// Key describes one setting: its type, the value used when neither the tenant
+// nor the platform set it, and an optional check applied to decoded values.
+type Key struct {
+	Name        string
+	Kind        Kind
+	Default     interface{}
+	Description string
+	Validate    func(value interface{}) error
+}
+
+type Registry struct {
+	keys map[string]Key
+}
+
+func NewRegistry() *Registry {
+	return &Registry{keys: make(map[string]Key)}
+}
+
+// Register adds a key. It panics on programmer errors such as duplicates or a
+// default that fails its own validation, so they surface at startup.
+func (r *Registry) Register(key Key) {
+	if _, exists := r.keys[key.Name]; exists {
+		panic("settings: duplicate key " + key.Name)
+	}
+	if err := r.check(key, key.Default); err != nil {
+		panic(fmt.Sprintf("settings: invalid default for %s: %v", key.Name, err))
+	}
+	r.keys[key.Name] = key
+}
+
+func (r *Registry) Lookup(name string) (Key, bool) {
+	key, ok := r.keys[name]
+	return key, ok
+}
+
+// Keys returns every registered key ordered by name.
+func (r *Registry) Keys() []Key {
+	keys := make([]Key, 0, len(r.keys))
+	for _, key := range r.keys {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].Name < keys[j].Name })
+	return keys
+}
+
+// Decode parses a raw JSON value for the named key into its Go type (string,
+// bool, int64 or []string) and validates it.
+func (r *Registry) Decode(name string, raw []byte) (interface{}, error) {
+	key, ok := r.keys[name]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+
+	value, err := decode(key.Kind, raw)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s must be %s", ErrInvalidValue, name, key.Kind)
+	}
+	if err := r.check(key, value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+func (r *Registry) check(key Key, value interface{}) error {
+	if key.Validate == nil {
+		return nil
+	}
+	if err := key.Validate(value); err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrInvalidValue, key.Name, err)
+	}
+	return nil
+}
+
+func decode(kind Kind, raw []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	switch kind {
+	case KindString:
+		var v string
+		return v, dec.Decode(&v)
+	case KindBool:
+		var v bool
+		return v, dec.Decode(&v)
+	case KindInt:
+		var v int64
+		return v, dec.Decode(&v)
+	case KindStringList:
+		var v []string
+		if err := dec.Decode(&v); err != nil {
+			return nil, err
+		}
+		if v == nil {
+			v = []string{}
+		}
+		return v, nil
+	default:
+		return nil, fmt.Errorf("unsupported kind %s", kind)
+	}
+}
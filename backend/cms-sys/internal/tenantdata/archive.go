@@ -0,0 +1,255 @@
+package tenantdata
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	ArchiveFormatVersion = 1
+	ManifestFile         = "manifest.json"
+	TablesDir            = "tables"
+	FilesDir             = "files"
+)
+
+var ErrChecksumMismatch = errors.New("archive checksum mismatch")
+
+type TableEntry struct {
+	Name   string `json:"name"`
+	File   string `json:"file"`
+	Rows   int    `json:"rows"`
+	SHA256 string `json:"sha256"`
+}
+
+type FileEntry struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Manifest describes a tenant archive. Every table and file listed here is
+// stored in the archive under its File/Path and verified on import.
+type Manifest struct {
+	FormatVersion int       `json:"format_version"`
+	Namespace     string    `json:"namespace"`
+	TenantID      uuid.UUID `json:"tenant_id"`
+	OwnerEmail    string    `json:"owner_email,omitempty"`
+	SchemaVersion int64     `json:"schema_version"`
+	// Isolation is the mode the tenant was exported from; SchemaVersion
+	// counts migrations of that mode's set.
+	Isolation  string       `json:"isolation,omitempty"`
+	ExportedAt time.Time    `json:"exported_at"`
+	Tables     []TableEntry `json:"tables"`
+	Files      []FileEntry  `json:"files"`
+}
+
+// HashingWriter records the SHA-256 and size of everything written through it.
+type HashingWriter struct {
+	w    io.Writer
+	hash hashState
+	n    int64
+}
+
+type hashState interface {
+	io.Writer
+	Sum(b []byte) []byte
+}
+
+func NewHashingWriter(w io.Writer) *HashingWriter {
+	return &HashingWriter{w: w, hash: sha256.New()}
+}
+
+func (h *HashingWriter) Write(p []byte) (int, error) {
+	n, err := h.w.Write(p)
+	_, _ = h.hash.Write(p[:n])
+	h.n += int64(n)
+	return n, err
+}
+
+func (h *HashingWriter) Sum() string {
+	return hex.EncodeToString(h.hash.Sum(nil))
+}
+
+func (h *HashingWriter) Size() int64 {
+	return h.n
+}
+
+// WriteArchive packs a staged export directory into a gzip'd tarball with the
+// manifest as the first entry.
+func WriteArchive(w io.Writer, dir string, m *Manifest) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	manifest, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeTarEntry(tw, ManifestFile, int64(len(manifest)), strings.NewReader(string(manifest))); err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(m.Tables)+len(m.Files))
+	for _, t := range m.Tables {
+		names = append(names, t.File)
+	}
+	for _, f := range m.Files {
+		names = append(names, f.Path)
+	}
+
+	for _, name := range names {
+		if err := addFile(tw, dir, name); err != nil {
+			return err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// ExtractArchive unpacks an archive into dir, refusing entries that would
+// escape it or push the total size past maxBytes.
+func ExtractArchive(r io.Reader, dir string, maxBytes int64) (*Manifest, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("archive is not gzip compressed: %w", err)
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	var total int64
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		target, err := safeJoin(dir, hdr.Name)
+		if err != nil {
+			return nil, err
+		}
+		total += hdr.Size
+		if total > maxBytes {
+			return nil, fmt.Errorf("archive exceeds %d bytes", maxBytes)
+		}
+
+		if err := os.MkdirAll(filepath.Dir(target), 0o750); err != nil {
+			return nil, err
+		}
+		f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+		if err != nil {
+			return nil, err
+		}
+		_, err = io.CopyN(f, tr, hdr.Size)
+		closeErr := f.Close()
+		if err != nil {
+			return nil, err
+		}
+		if closeErr != nil {
+			return nil, closeErr
+		}
+	}
+
+	raw, err := os.ReadFile(filepath.Join(dir, ManifestFile))
+	if err != nil {
+		return nil, fmt.Errorf("archive has no manifest: %w", err)
+	}
+	var m Manifest
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %w", err)
+	}
+	if m.FormatVersion != ArchiveFormatVersion {
+		return nil, fmt.Errorf("unsupported archive format version %d", m.FormatVersion)
+	}
+	return &m, verify(dir, &m)
+}
+
+func verify(dir string, m *Manifest) error {
+	check := func(name, want string) error {
+		target, err := safeJoin(dir, name)
+		if err != nil {
+			return err
+		}
+		f, err := os.Open(target)
+		if err != nil {
+			return fmt.Errorf("archive entry %s missing: %w", name, err)
+		}
+		defer f.Close()
+
+		h := NewHashingWriter(io.Discard)
+		if _, err := io.Copy(h, f); err != nil {
+			return err
+		}
+		if h.Sum() != want {
+			return fmt.Errorf("%w: %s", ErrChecksumMismatch, name)
+		}
+		return nil
+	}
+
+	for _, t := range m.Tables {
+		if err := check(t.File, t.SHA256); err != nil {
+			return err
+		}
+	}
+	for _, f := range m.Files {
+		if err := check(f.Path, f.SHA256); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func addFile(tw *tar.Writer, dir, name string) error {
+	f, err := os.Open(filepath.Join(dir, filepath.FromSlash(name)))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	return writeTarEntry(tw, name, info.Size(), f)
+}
+
+func writeTarEntry(tw *tar.Writer, name string, size int64, r io.Reader) error {
+	if err := tw.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0o600,
+		Size:    size,
+		ModTime: time.Now().UTC(),
+	}); err != nil {
+		return err
+	}
+	_, err := io.Copy(tw, r)
+	return err
+}
+
+func safeJoin(dir, name string) (string, error) {
+	clean := path.Clean("/" + name)[1:]
+	if clean == "" || clean != strings.TrimPrefix(name, "./") {
+		return "", fmt.Errorf("invalid archive entry name %q", name)
+	}
+	return filepath.Join(dir, filepath.FromSlash(clean)), nil
+}
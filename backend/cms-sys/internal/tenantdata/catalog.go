@@ -0,0 +1,202 @@
+package tenantdata
+
+import (
+	"fmt"
+	"sort"
+
+	"gorm.io/gorm"
+)
+
+// Column describes one column of a tenant table.
+type Column struct {
+	Name     string
+	DataType string
+}
+
+// ForeignKey is a single-column reference to another table in the schema.
+type ForeignKey struct {
+	Column    string
+	RefTable  string
+	RefColumn string
+}
+
+type Table struct {
+	Name        string
+	Columns     []Column
+	PrimaryKey  []string
+	ForeignKeys []ForeignKey
+}
+
+func (t Table) HasColumn(column string) bool {
+	for _, c := range t.Columns {
+		if c.Name == column {
+			return true
+		}
+	}
+	return false
+}
+
+func (t Table) IsUUID(column string) bool {
+	for _, c := range t.Columns {
+		if c.Name == column {
+			return c.DataType == "uuid"
+		}
+	}
+	return false
+}
+
+// Catalog is the table layout of one schema, ordered so that every table
+// comes after the tables it references.
+type Catalog struct {
+	Schema string
+	Tables []Table
+}
+
+func (c *Catalog) Table(name string) (Table, bool) {
+	for _, t := range c.Tables {
+		if t.Name == name {
+			return t, true
+		}
+	}
+	return Table{}, false
+}
+
+// skipTables are bookkeeping tables that are never part of tenant data.
+var skipTables = map[string]bool{
+	"schema_migrations": true,
+}
+
+type columnRow struct {
+	TableName  string
+	ColumnName string
+	DataType   string
+}
+
+type constraintRow struct {
+	ConType    string
+	TableName  string
+	ColumnName string
+	RefTable   *string
+	RefColumn  *string
+}
+
+func LoadCatalog(db *gorm.DB, schema string) (*Catalog, error) {
+	var columns []columnRow
+	err := db.Raw(`
+		SELECT c.table_name, c.column_name, c.data_type
+		FROM information_schema.columns c
+		JOIN information_schema.tables t
+		  ON t.table_schema = c.table_schema AND t.table_name = c.table_name
+		WHERE c.table_schema = ? AND t.table_type = 'BASE TABLE'
+		ORDER BY c.table_name, c.ordinal_position`, schema).Scan(&columns).Error
+	if err != nil {
+		return nil, fmt.Errorf("reading columns of %s: %w", schema, err)
+	}
+
+	var constraints []constraintRow
+	err = db.Raw(`
+		SELECT con.contype AS con_type,
+		       rel.relname AS table_name,
+		       att.attname AS column_name,
+		       frel.relname AS ref_table,
+		       fatt.attname AS ref_column
+		FROM pg_constraint con
+		JOIN pg_class rel ON rel.oid = con.conrelid
+		JOIN pg_namespace nsp ON nsp.oid = rel.relnamespace
+		CROSS JOIN LATERAL unnest(con.conkey, con.confkey) AS k(attnum, fattnum)
+		JOIN pg_attribute att ON att.attrelid = con.conrelid AND att.attnum = k.attnum
+		LEFT JOIN pg_class frel ON frel.oid = con.confrelid
+		LEFT JOIN pg_attribute fatt ON fatt.attrelid = con.confrelid AND fatt.attnum = k.fattnum
+		WHERE nsp.nspname = ? AND con.contype IN ('p', 'f')`, schema).Scan(&constraints).Error
+	if err != nil {
+		return nil, fmt.Errorf("reading constraints of %s: %w", schema, err)
+	}
+
+	tables := make(map[string]*Table)
+	var names []string
+	for _, col := range columns {
+		if skipTables[col.TableName] {
+			continue
+		}
+		t, ok := tables[col.TableName]
+		if !ok {
+			t = &Table{Name: col.TableName}
+			tables[col.TableName] = t
+			names = append(names, col.TableName)
+		}
+		t.Columns = append(t.Columns, Column{Name: col.ColumnName, DataType: col.DataType})
+	}
+
+	for _, con := range constraints {
+		t, ok := tables[con.TableName]
+		if !ok {
+			continue
+		}
+		switch con.ConType {
+		case "p":
+			t.PrimaryKey = append(t.PrimaryKey, con.ColumnName)
+		case "f":
+			if con.RefTable != nil && con.RefColumn != nil {
+				t.ForeignKeys = append(t.ForeignKeys, ForeignKey{
+					Column:    con.ColumnName,
+					RefTable:  *con.RefTable,
+					RefColumn: *con.RefColumn,
+				})
+			}
+		}
+	}
+
+	ordered, err := topoSort(names, tables)
+	if err != nil {
+		return nil, err
+	}
+	return &Catalog{Schema: schema, Tables: ordered}, nil
+}
+
+// topoSort orders tables parents-first; ties are broken by name so the order
+// is stable between runs.
+func topoSort(names []string, tables map[string]*Table) ([]Table, error) {
+	sort.Strings(names)
+
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := make(map[string]int, len(names))
+	ordered := make([]Table, 0, len(names))
+
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case done:
+			return nil
+		case visiting:
+			return fmt.Errorf("foreign key cycle through table %s", name)
+		}
+		state[name] = visiting
+
+		t := tables[name]
+		for _, fk := range t.ForeignKeys {
+			if fk.RefTable == name {
+				continue
+			}
+			if _, ok := tables[fk.RefTable]; ok {
+				if err := visit(fk.RefTable); err != nil {
+					return err
+				}
+			}
+		}
+
+		state[name] = done
+		ordered = append(ordered, *t)
+		return nil
+	}
+
+	for _, name := range names {
+		if err := visit(name); err != nil {
+			return nil, err
+		}
+	}
+	return ordered, nil
+}
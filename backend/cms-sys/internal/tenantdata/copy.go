@@ -0,0 +1,50 @@
+package tenantdata
+
+import (
+	"io"
+	"os"
+
+	"gorm.io/gorm"
+)
+
+// Scopes switch the copying transaction between the source and the target
+// tenant. Row-level security in the shared schema only shows the rows of the
+// tenant a transaction is scoped to, so reads and writes need their own scope.
+// Either may be nil.
+type Scopes struct {
+	Source func() error
+	Target func() error
+}
+
+// CopyTable copies table from schema fromSchema into the loader's target. The
+// rows are staged in a temporary file because the source cursor and the
+// inserts share one connection, which cannot run both at once.
+func CopyTable(db *gorm.DB, fromSchema string, table Table, loader *Loader, scopes Scopes) (int, error) {
+	f, err := os.CreateTemp("", "tenant-copy-*.ndjson")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	if err := scopes.enter(scopes.Source); err != nil {
+		return 0, err
+	}
+	if _, err := WriteTable(db, fromSchema, table, f); err != nil {
+		return 0, err
+	}
+	if err := scopes.enter(scopes.Target); err != nil {
+		return 0, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	return loader.LoadTable(table.Name, f)
+}
+
+func (Scopes) enter(scope func() error) error {
+	if scope == nil {
+		return nil
+	}
+	return scope()
+}
@@ -0,0 +1,255 @@
+package tenantdata
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/utils"
+	"gorm.io/gorm"
+)
+
+const insertBatchSize = 500
+
+func qualified(schema, table string) string {
+	return utils.QuoteIdent(schema) + "." + utils.QuoteIdent(table)
+}
+
+// WriteTable streams every row of table as one JSON object per line, reading
+// through a cursor so the table is never held in memory.
+func WriteTable(db *gorm.DB, schema string, table Table, w io.Writer) (int, error) {
+	order := "1"
+	if len(table.PrimaryKey) > 0 {
+		quoted := make([]string, len(table.PrimaryKey))
+		for i, col := range table.PrimaryKey {
+			quoted[i] = "t." + utils.QuoteIdent(col)
+		}
+		order = strings.Join(quoted, ", ")
+	}
+
+	rows, err := db.Raw(fmt.Sprintf("SELECT row_to_json(t)::text FROM %s t ORDER BY %s", qualified(schema, table.Name), order)).Rows()
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	bw := bufio.NewWriter(w)
+	count := 0
+	for rows.Next() {
+		var line string
+		if err := rows.Scan(&line); err != nil {
+			return count, err
+		}
+		if _, err := bw.WriteString(line); err != nil {
+			return count, err
+		}
+		if err := bw.WriteByte('\n'); err != nil {
+			return count, err
+		}
+		count++
+	}
+	if err := rows.Err(); err != nil {
+		return count, err
+	}
+	return count, bw.Flush()
+}
+
+// Remapper tracks which new ID replaced each old ID while rows are copied, so
+// foreign keys loaded later point at the copies.
+type Remapper struct {
+	ids map[string]string
+}
+
+func NewRemapper() *Remapper {
+	return &Remapper{ids: make(map[string]string)}
+}
+
+func (r *Remapper) Map(oldID, newID string) {
+	r.ids[oldID] = newID
+}
+
+func (r *Remapper) Lookup(oldID string) (string, bool) {
+	id, ok := r.ids[oldID]
+	return id, ok
+}
+
+type LoadOptions struct {
+	// FreshIDs gives every row with a single UUID primary key a new ID.
+	FreshIDs bool
+	// Merge maps a table to natural-key columns. Rows matching an existing row
+	// in the target are not inserted; their ID is mapped to the existing one.
+	Merge map[string][]string
+	// Namespace rewrites "namespace" columns holding From to To.
+	NamespaceFrom string
+	NamespaceTo   string
+	// Set overwrites columns of every row whose table has them, e.g. the
+	// owning tenant of rows loaded into the shared schema.
+	Set map[string]interface{}
+}
+
+// Loader inserts NDJSON rows into a target schema, remapping IDs on the way.
+// Rows that collide with rows created as a side effect of earlier inserts
+// (for example by triggers) are skipped.
+type Loader struct {
+	db     *gorm.DB
+	target *Catalog
+	remap  *Remapper
+	opts   LoadOptions
+}
+
+func NewLoader(db *gorm.DB, target *Catalog, remap *Remapper, opts LoadOptions) *Loader {
+	return &Loader{
+		db:     db,
+		target: target,
+		remap:  remap,
+		opts:   opts,
+	}
+}
+
+func (l *Loader) LoadTable(name string, r io.Reader) (int, error) {
+	table, ok := l.target.Table(name)
+	if !ok {
+		return 0, fmt.Errorf("table %s does not exist in %s", name, l.target.Schema)
+	}
+
+	br := bufio.NewReader(r)
+	batch := make([]map[string]interface{}, 0, insertBatchSize)
+	loaded := 0
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := l.insert(table, batch); err != nil {
+			return err
+		}
+		loaded += len(batch)
+		batch = batch[:0]
+		return nil
+	}
+
+	for {
+		line, err := br.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			row, decodeErr := decodeRow(line)
+			if decodeErr != nil {
+				return loaded, fmt.Errorf("table %s: %w", name, decodeErr)
+			}
+
+			keep, mapErr := l.prepare(table, row)
+			if mapErr != nil {
+				return loaded, fmt.Errorf("table %s: %w", name, mapErr)
+			}
+			if keep {
+				batch = append(batch, row)
+				if len(batch) == insertBatchSize {
+					if err := flush(); err != nil {
+						return loaded, err
+					}
+				}
+			}
+		}
+
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return loaded, err
+		}
+	}
+	return loaded, flush()
+}
+
+func (l *Loader) prepare(table Table, row map[string]interface{}) (bool, error) {
+	for _, fk := range table.ForeignKeys {
+		if old, ok := row[fk.Column].(string); ok {
+			if mapped, ok := l.remap.Lookup(old); ok {
+				row[fk.Column] = mapped
+			}
+		}
+	}
+
+	if l.opts.NamespaceFrom != "" {
+		if ns, ok := row["namespace"].(string); ok && ns == l.opts.NamespaceFrom {
+			row["namespace"] = l.opts.NamespaceTo
+		}
+	}
+
+	if keys, ok := l.opts.Merge[table.Name]; ok {
+		merged, err := l.mergeExisting(table, keys, row)
+		if err != nil || merged {
+			return false, err
+		}
+	}
+
+	if l.opts.FreshIDs && len(table.PrimaryKey) == 1 && table.IsUUID(table.PrimaryKey[0]) {
+		pk := table.PrimaryKey[0]
+		if old, ok := row[pk].(string); ok {
+			fresh := uuid.New().String()
+			l.remap.Map(old, fresh)
+			row[pk] = fresh
+		}
+	}
+
+	for column, value := range l.opts.Set {
+		if table.HasColumn(column) {
+			row[column] = value
+		}
+	}
+	return true, nil
+}
+
+// mergeExisting maps row onto the target row with the same natural key.
+func (l *Loader) mergeExisting(table Table, keys []string, row map[string]interface{}) (bool, error) {
+	if len(table.PrimaryKey) != 1 {
+		return false, nil
+	}
+	pk := table.PrimaryKey[0]
+
+	conds := make([]string, len(keys))
+	args := make([]interface{}, len(keys))
+	for i, key := range keys {
+		conds[i] = utils.QuoteIdent(key) + "::text = ?"
+		args[i] = fmt.Sprint(row[key])
+	}
+
+	var existing []string
+	query := fmt.Sprintf("SELECT %s::text FROM %s WHERE %s LIMIT 1",
+		utils.QuoteIdent(pk), qualified(l.target.Schema, table.Name), strings.Join(conds, " AND "))
+	if err := l.db.Raw(query, args...).Scan(&existing).Error; err != nil {
+		return false, err
+	}
+	if len(existing) == 0 {
+		return false, nil
+	}
+
+	if old, ok := row[pk].(string); ok {
+		l.remap.Map(old, existing[0])
+	}
+	return true, nil
+}
+
+func (l *Loader) insert(table Table, rows []map[string]interface{}) error {
+	payload, err := json.Marshal(rows)
+	if err != nil {
+		return err
+	}
+	name := qualified(l.target.Schema, table.Name)
+	stmt := fmt.Sprintf("INSERT INTO %s SELECT * FROM json_populate_recordset(NULL::%s, ?::json) ON CONFLICT DO NOTHING", name, name)
+	return l.db.Exec(stmt, string(payload)).Error
+}
+
+func decodeRow(line []byte) (map[string]interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(line))
+	dec.UseNumber()
+	var row map[string]interface{}
+	if err := dec.Decode(&row); err != nil {
+		return nil, err
+	}
+	return row, nil
+}
@@ -0,0 +1,79 @@
+package types
+
+import "time"
+
+type PlatformMetricName string
+
+const (
+	AnalyticsUsers        PlatformMetricName = "users"
+	AnalyticsActiveUsers  PlatformMetricName = "active_users"
+	AnalyticsCourses      PlatformMetricName = "courses"
+	AnalyticsEnrollments  PlatformMetricName = "enrollments"
+	AnalyticsStorageBytes PlatformMetricName = "storage_bytes"
+	// AnalyticsTenants is derived from the snapshots rather than collected:
+	// it counts the tenants that have a snapshot on a day.
+	AnalyticsTenants PlatformMetricName = "tenants"
+)
+
+// CollectedMetrics are measured in every tenant by the analytics job.
+var CollectedMetrics = []PlatformMetricName{AnalyticsUsers, AnalyticsActiveUsers, AnalyticsCourses, AnalyticsEnrollments, AnalyticsStorageBytes}
+
+func (m PlatformMetricName) Valid() bool {
+	if m == AnalyticsTenants {
+		return true
+	}
+	for _, known := range CollectedMetrics {
+		if m == known {
+			return true
+		}
+	}
+	return false
+}
+
+// PlatformMetric is one tenant's value of a metric on a day. The collector
+// overwrites the day's row on every run, so the last run of a day wins.
+type PlatformMetric struct {
+	Day         time.Time `gorm:"type:date;primaryKey" json:"day"`
+	Namespace   string    `gorm:"size:100;primaryKey;index" json:"namespace"`
+	Metric      string    `gorm:"size:50;primaryKey" json:"metric"`
+	Value       int64     `gorm:"not null;default:0" json:"value"`
+	CollectedAt time.Time `gorm:"not null" json:"collected_at"`
+}
+
+func (PlatformMetric) TableName() string {
+	return "cms_platform_metric"
+}
+
+type AnalyticsPoint struct {
+	Day   time.Time `json:"day"`
+	Value int64     `json:"value"`
+}
+
+type AnalyticsSeries struct {
+	Metric    PlatformMetricName `json:"metric"`
+	Namespace string             `json:"namespace,omitempty"`
+	Points    []AnalyticsPoint   `json:"points"`
+}
+
+// AnalyticsSummary compares the platform totals on the first and last day of
+// a range that have snapshots.
+type AnalyticsSummary struct {
+	From    time.Time                       `json:"from"`
+	To      time.Time                       `json:"to"`
+	Start   map[PlatformMetricName]int64    `json:"start"`
+	End     map[PlatformMetricName]int64    `json:"end"`
+	Growth  map[PlatformMetricName]int64    `json:"growth"`
+	Percent map[PlatformMetricName]*float64 `json:"growth_percent"`
+}
+
+// TenantAnalytics is one tenant's snapshot on a day.
+type TenantAnalytics struct {
+	Namespace string                       `json:"namespace"`
+	Metrics   map[PlatformMetricName]int64 `json:"metrics"`
+}
+
+type AnalyticsCollectReport struct {
+	Day       time.Time `json:"day"`
+	Collected int       `json:"collected"`
+	Failed    []string  `json:"failed,omitempty"`
+}
@@ -0,0 +1,32 @@
+package types
+
+import (
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"time"
+)
+
+type AuditLog struct {
+	AuditID    uuid.UUID  `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"audit_id"`
+	ActorID    *uuid.UUID `gorm:"type:uuid;index" json:"actor_id,omitempty"`
+	Action     string     `gorm:"size:100;not null;index" json:"action"`
+	TargetType string     `gorm:"size:50;not null" json:"target_type"`
+	TargetID   string     `gorm:"size:100;not null;index" json:"target_id"`
+	Namespace  *string    `gorm:"size:100;index" json:"namespace,omitempty"`
+	Details    string     `gorm:"type:jsonb;not null;default:'{}'" json:"details"`
+	CreatedAt  time.Time  `gorm:"default:CURRENT_TIMESTAMP;index" json:"created_at"`
+}
+
+func (AuditLog) TableName() string {
+	return "cms_audit_log"
+}
+
+func (a *AuditLog) BeforeCreate(tx *gorm.DB) error {
+	if a.AuditID == uuid.Nil {
+		a.AuditID = uuid.New()
+	}
+	if a.Details == "" {
+		a.Details = "{}"
+	}
+	return nil
+}
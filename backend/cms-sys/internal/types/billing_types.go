@@ -0,0 +1,147 @@
+package types
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+type PlanInterval string
+
+const (
+	IntervalMonth PlanInterval = "MONTH"
+	IntervalYear  PlanInterval = "YEAR"
+)
+
+// Next returns the end of a billing period that starts at t.
+func (i PlanInterval) Next(t time.Time) time.Time {
+	if i == IntervalYear {
+		return t.AddDate(1, 0, 0)
+	}
+	return t.AddDate(0, 1, 0)
+}
+
+// Plan is a recurring offer: what it costs, how often it renews, which
+// systems it includes and which quotas apply to the subscriber's tenants.
+type Plan struct {
+	PlanID      uuid.UUID    `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"plan_id"`
+	Code        string       `gorm:"size:50;not null;unique" json:"code"`
+	Name        string       `gorm:"size:100;not null" json:"name"`
+	Description string       `gorm:"size:500" json:"description,omitempty"`
+	PriceCents  int64        `gorm:"not null;default:0" json:"price_cents"`
+	Currency    string       `gorm:"size:3;not null;default:'USD'" json:"currency"`
+	Interval    PlanInterval `gorm:"type:varchar(10);not null" json:"interval"`
+	TrialDays   int          `gorm:"not null;default:0" json:"trial_days"`
+	// GraceDays overrides how long a past-due subscription keeps its
+	// entitlements before it expires; nil uses the platform default.
+	GraceDays *int `json:"grace_days,omitempty"`
+	// Active plans can be subscribed to. Retired plans keep serving their
+	// existing subscriptions.
+	Active    bool         `gorm:"not null;default:true" json:"active"`
+	Systems   []PlanSystem `gorm:"foreignKey:PlanID;constraint:OnDelete:CASCADE" json:"systems"`
+	Quotas    []PlanQuota  `gorm:"foreignKey:PlanID;constraint:OnDelete:CASCADE" json:"quotas"`
+	CreatedAt time.Time    `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+	UpdatedAt time.Time    `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
+}
+
+func (Plan) TableName() string {
+	return "cms_plan"
+}
+
+func (p *Plan) Includes(system SystemType) bool {
+	for _, s := range p.Systems {
+		if s.System == system {
+			return true
+		}
+	}
+	return false
+}
+
+type PlanSystem struct {
+	PlanID  uuid.UUID     `gorm:"type:uuid;primaryKey" json:"-"`
+	System  SystemType    `gorm:"type:varchar(100);primaryKey" json:"system"`
+	Catalog SystemCatalog `gorm:"foreignKey:System;references:Code" json:"-"`
+}
+
+func (PlanSystem) TableName() string {
+	return "cms_plan_system"
+}
+
+// PlanQuota is the limit of one usage metric for tenants of a plan's
+// subscribers. Tenant overrides still take precedence.
+type PlanQuota struct {
+	PlanID uuid.UUID   `gorm:"type:uuid;primaryKey" json:"-"`
+	Metric UsageMetric `gorm:"size:50;primaryKey" json:"metric"`
+	Limit  int64       `gorm:"column:quota_limit;not null" json:"limit"`
+}
+
+func (PlanQuota) TableName() string {
+	return "cms_plan_quota"
+}
+
+type SubscriptionStatus string
+
+const (
+	SubscriptionTrialing SubscriptionStatus = "TRIALING"
+	SubscriptionActive   SubscriptionStatus = "ACTIVE"
+	SubscriptionPastDue  SubscriptionStatus = "PAST_DUE"
+	SubscriptionCanceled SubscriptionStatus = "CANCELED"
+	SubscriptionExpired  SubscriptionStatus = "EXPIRED"
+)
+
+// subscriptionTransitions lists the states each state may move to. Canceled
+// and expired are final; a customer who returns starts a new subscription.
+var subscriptionTransitions = map[SubscriptionStatus][]SubscriptionStatus{
+	SubscriptionTrialing: {SubscriptionActive, SubscriptionPastDue, SubscriptionCanceled},
+	SubscriptionActive:   {SubscriptionActive, SubscriptionPastDue, SubscriptionCanceled},
+	SubscriptionPastDue:  {SubscriptionActive, SubscriptionCanceled, SubscriptionExpired},
+}
+
+func (s SubscriptionStatus) CanTransitionTo(next SubscriptionStatus) bool {
+	for _, allowed := range subscriptionTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// Live reports whether the subscription still grants its plan's systems.
+func (s SubscriptionStatus) Live() bool {
+	return s == SubscriptionTrialing || s == SubscriptionActive || s == SubscriptionPastDue
+}
+
+// Subscription puts a customer on a plan. A customer has at most one live
+// subscription, enforced by the partial unique index.
+type Subscription struct {
+	SubscriptionID     uuid.UUID          `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"subscription_id"`
+	CustomerID         uuid.UUID          `gorm:"type:uuid;not null;index;uniqueIndex:idx_subscription_live,where:status <> 'CANCELED' AND status <> 'EXPIRED'" json:"customer_id"`
+	PlanID             uuid.UUID          `gorm:"type:uuid;not null;index" json:"plan_id"`
+	Status             SubscriptionStatus `gorm:"type:varchar(20);not null;index" json:"status"`
+	CurrentPeriodStart time.Time          `gorm:"not null" json:"current_period_start"`
+	CurrentPeriodEnd   time.Time          `gorm:"not null;index" json:"current_period_end"`
+	TrialEndsAt        *time.Time         `json:"trial_ends_at,omitempty"`
+	// CancelAtPeriodEnd stops the next renewal; the subscription stays live
+	// until the current period ends.
+	CancelAtPeriodEnd bool       `gorm:"not null;default:false" json:"cancel_at_period_end"`
+	PastDueSince      *time.Time `json:"past_due_since,omitempty"`
+	// NextAttemptAt is when a past-due subscription is charged again.
+	NextAttemptAt *time.Time `json:"next_attempt_at,omitempty"`
+	CanceledAt    *time.Time `json:"canceled_at,omitempty"`
+	EndedAt       *time.Time `json:"ended_at,omitempty"`
+	CreatedAt     time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+	UpdatedAt     time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
+	Plan          Plan       `gorm:"foreignKey:PlanID;references:PlanID" json:"plan,omitempty"`
+}
+
+func (Subscription) TableName() string {
+	return "cms_subscription"
+}
+
+// SubscriptionRunReport summarises one pass of the renewal scheduler.
+type SubscriptionRunReport struct {
+	Renewed  int `json:"renewed"`
+	PastDue  int `json:"past_due"`
+	Canceled int `json:"canceled"`
+	Expired  int `json:"expired"`
+	Failed   int `json:"failed"`
+}
@@ -0,0 +1,67 @@
+package types
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+type SystemStatus string
+
+const (
+	SystemActive SystemStatus = "ACTIVE"
+	// SystemDisabled systems are no longer sold; customers holding one keep
+	// using it.
+	SystemDisabled SystemStatus = "DISABLED"
+)
+
+// SystemCatalog is a product the platform sells. Purchases, plans and coupons
+// reference it by Code, which never changes once created.
+type SystemCatalog struct {
+	Code        SystemType `gorm:"type:varchar(100);primaryKey" json:"code"`
+	Name        string     `gorm:"size:100;not null" json:"name"`
+	Description string     `gorm:"size:500" json:"description,omitempty"`
+	// BaseURL is where the backing service is reached.
+	BaseURL string       `gorm:"size:255" json:"base_url,omitempty"`
+	Status  SystemStatus `gorm:"type:varchar(20);not null;default:'ACTIVE'" json:"status"`
+	// ProvisionHook and DeprovisionHook are posted a signed
+	// types.ProvisioningEvent when a customer gains or loses the system.
+	ProvisionHook   string    `gorm:"size:255" json:"provision_hook,omitempty"`
+	DeprovisionHook string    `gorm:"size:255" json:"deprovision_hook,omitempty"`
+	CreatedAt       time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+	UpdatedAt       time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
+}
+
+func (SystemCatalog) TableName() string {
+	return "system_catalog"
+}
+
+func (s *SystemCatalog) Active() bool {
+	return s.Status == SystemActive
+}
+
+// BuiltinSystems are the systems sold before the catalog existed. They are
+// added on startup when missing; admins may edit them like any other.
+func BuiltinSystems() []SystemCatalog {
+	return []SystemCatalog{
+		{Code: LMS, Name: "Learning Management System", Status: SystemActive},
+		{Code: EMS, Name: "EMS", Status: SystemActive},
+	}
+}
+
+// SystemListing is what customers see of a catalog entry.
+type SystemListing struct {
+	Code        SystemType `json:"code"`
+	Name        string     `json:"name"`
+	Description string     `json:"description,omitempty"`
+	BaseURL     string     `json:"base_url,omitempty"`
+}
+
+// ProvisioningEvent is the body of a provisioning hook call. Event is
+// "provision" or "deprovision".
+type ProvisioningEvent struct {
+	Event      string     `json:"event"`
+	System     SystemType `json:"system"`
+	CustomerID uuid.UUID  `json:"customer_id"`
+	Namespace  string     `json:"namespace,omitempty"`
+	OccurredAt time.Time  `json:"occurred_at"`
+}
@@ -0,0 +1,155 @@
+package types
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+type CouponKind string
+
+const (
+	CouponPercent CouponKind = "PERCENT"
+	CouponFixed   CouponKind = "FIXED"
+)
+
+// Coupon is a promo code taking money off the first charged period of a
+// subscription. Each customer redeems a coupon at most once.
+type Coupon struct {
+	CouponID    uuid.UUID  `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"coupon_id"`
+	Code        string     `gorm:"size:50;not null;unique" json:"code"`
+	Description string     `gorm:"size:500" json:"description,omitempty"`
+	Kind        CouponKind `gorm:"type:varchar(10);not null" json:"kind"`
+	// PercentOff is the discount of a PERCENT coupon, 1 to 100.
+	PercentOff int `gorm:"not null;default:0" json:"percent_off,omitempty"`
+	// AmountOffCents is the discount of a FIXED coupon, which only applies
+	// to plans priced in its Currency.
+	AmountOffCents int64  `gorm:"not null;default:0" json:"amount_off_cents,omitempty"`
+	Currency       string `gorm:"size:3" json:"currency,omitempty"`
+	// MaxRedemptions caps redemptions across all customers; nil is
+	// unlimited. Redemptions counts the ones made so far.
+	MaxRedemptions *int       `json:"max_redemptions,omitempty"`
+	Redemptions    int        `gorm:"not null;default:0" json:"redemptions"`
+	ExpiresAt      *time.Time `json:"expires_at,omitempty"`
+	// Disabled coupons can no longer be redeemed; redemptions made keep
+	// their discount.
+	Active bool `gorm:"not null;default:true" json:"active"`
+	// Systems and Plans restrict the coupon; when empty it applies to any.
+	Systems   []CouponSystem `gorm:"foreignKey:CouponID;constraint:OnDelete:CASCADE" json:"systems"`
+	Plans     []CouponPlan   `gorm:"foreignKey:CouponID;constraint:OnDelete:CASCADE" json:"plans"`
+	CreatedAt time.Time      `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+	UpdatedAt time.Time      `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
+}
+
+func (Coupon) TableName() string {
+	return "cms_coupon"
+}
+
+// Eligible reports whether the coupon applies to plan. For a coupon limited
+// to systems it also returns the first of them the plan includes.
+func (c *Coupon) Eligible(plan *Plan) (SystemType, bool) {
+	if len(c.Plans) > 0 {
+		listed := false
+		for _, p := range c.Plans {
+			if p.PlanID == plan.PlanID {
+				listed = true
+				break
+			}
+		}
+		if !listed {
+			return "", false
+		}
+	}
+	if c.Kind == CouponFixed && c.Currency != plan.Currency {
+		return "", false
+	}
+	if len(c.Systems) == 0 {
+		return "", true
+	}
+	for _, s := range c.Systems {
+		if plan.Includes(s.System) {
+			return s.System, true
+		}
+	}
+	return "", false
+}
+
+// Discount returns how much the coupon takes off price, never more than the
+// price. Percentages round half up to the cent.
+func (c *Coupon) Discount(price int64) int64 {
+	var off int64
+	switch c.Kind {
+	case CouponPercent:
+		off = (price*int64(c.PercentOff) + 50) / 100
+	case CouponFixed:
+		off = c.AmountOffCents
+	}
+	if off > price {
+		return price
+	}
+	return off
+}
+
+type CouponSystem struct {
+	CouponID uuid.UUID     `gorm:"type:uuid;primaryKey" json:"-"`
+	System   SystemType    `gorm:"type:varchar(100);primaryKey" json:"system"`
+	Catalog  SystemCatalog `gorm:"foreignKey:System;references:Code" json:"-"`
+}
+
+func (CouponSystem) TableName() string {
+	return "cms_coupon_system"
+}
+
+type CouponPlan struct {
+	CouponID uuid.UUID `gorm:"type:uuid;primaryKey" json:"-"`
+	PlanID   uuid.UUID `gorm:"type:uuid;primaryKey" json:"plan_id"`
+}
+
+func (CouponPlan) TableName() string {
+	return "cms_coupon_plan"
+}
+
+// CouponRedemption is a customer's use of a coupon. It is made when the
+// customer subscribes or opens a checkout, and is linked to the subscription,
+// and to the purchase of the system the coupon is limited to, once the
+// subscription exists. AppliedAt is set when a charge used the discount.
+type CouponRedemption struct {
+	RedemptionID   uuid.UUID  `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"redemption_id"`
+	CouponID       uuid.UUID  `gorm:"type:uuid;not null;uniqueIndex:idx_coupon_customer" json:"coupon_id"`
+	CustomerID     uuid.UUID  `gorm:"type:uuid;not null;uniqueIndex:idx_coupon_customer;index" json:"customer_id"`
+	PlanID         uuid.UUID  `gorm:"type:uuid;not null" json:"plan_id"`
+	System         SystemType `gorm:"type:varchar(100)" json:"system,omitempty"`
+	CheckoutID     *uuid.UUID `gorm:"type:uuid;index" json:"checkout_id,omitempty"`
+	SubscriptionID *uuid.UUID `gorm:"type:uuid;index" json:"subscription_id,omitempty"`
+	PurchaseID     *uuid.UUID `gorm:"type:uuid" json:"purchase_id,omitempty"`
+	PriceCents     int64      `gorm:"not null" json:"price_cents"`
+	DiscountCents  int64      `gorm:"not null" json:"discount_cents"`
+	Currency       string     `gorm:"size:3;not null" json:"currency"`
+	RedeemedAt     time.Time  `gorm:"not null" json:"redeemed_at"`
+	AppliedAt      *time.Time `json:"applied_at,omitempty"`
+}
+
+func (CouponRedemption) TableName() string {
+	return "cms_coupon_redemption"
+}
+
+// CouponQuote is what a coupon would take off a plan for a customer.
+type CouponQuote struct {
+	Code          string     `json:"code"`
+	Plan          string     `json:"plan"`
+	System        SystemType `json:"system,omitempty"`
+	PriceCents    int64      `json:"price_cents"`
+	DiscountCents int64      `json:"discount_cents"`
+	DueCents      int64      `json:"due_cents"`
+	Currency      string     `json:"currency"`
+}
+
+// CouponReport summarises a coupon's redemptions. Discounts are totalled per
+// currency; Pending counts redemptions whose discount is not charged yet.
+type CouponReport struct {
+	Coupon        *Coupon            `json:"coupon"`
+	Redemptions   int                `json:"redemptions"`
+	Applied       int                `json:"applied"`
+	Pending       int                `json:"pending"`
+	DiscountCents map[string]int64   `json:"discount_cents"`
+	Items         []CouponRedemption `json:"items"`
+}
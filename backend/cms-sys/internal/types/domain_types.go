@@ -0,0 +1,73 @@
+package types
+
+import (
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"time"
+)
+
+type DomainStatus string
+
+const (
+	DomainPending  DomainStatus = "PENDING"
+	DomainVerified DomainStatus = "VERIFIED"
+)
+
+const (
+	// DomainChallengePrefix is prepended to a custom domain to name the TXT
+	// record that proves control of it.
+	DomainChallengePrefix = "_cms-challenge."
+	// DomainChallengeValue prefixes the token in the TXT record.
+	DomainChallengeValue = "cms-verification="
+)
+
+// TenantDomain is a custom domain claimed by a tenant. Only verified domains
+// resolve to the tenant.
+type TenantDomain struct {
+	DomainID      uuid.UUID    `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"domain_id"`
+	Domain        string       `gorm:"size:253;not null;unique" json:"domain"`
+	Namespace     string       `gorm:"size:100;not null;index" json:"namespace"`
+	Status        DomainStatus `gorm:"type:varchar(20);not null;default:'PENDING';index" json:"status"`
+	Token         string       `gorm:"size:64;not null" json:"-"`
+	VerifiedAt    *time.Time   `json:"verified_at,omitempty"`
+	LastCheckedAt *time.Time   `json:"last_checked_at,omitempty"`
+	LastError     string       `gorm:"size:255" json:"last_error,omitempty"`
+	CreatedAt     time.Time    `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+	UpdatedAt     time.Time    `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
+}
+
+func (TenantDomain) TableName() string {
+	return "cms_tenant_domain"
+}
+
+func (d *TenantDomain) BeforeCreate(tx *gorm.DB) error {
+	if d.DomainID == uuid.Nil {
+		d.DomainID = uuid.New()
+	}
+	return nil
+}
+
+// DomainChallenge tells the owner which DNS record to publish.
+type DomainChallenge struct {
+	Type  string `json:"type"`
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+func (d *TenantDomain) Challenge() DomainChallenge {
+	return DomainChallenge{
+		Type:  "TXT",
+		Name:  DomainChallengePrefix + d.Domain,
+		Value: DomainChallengeValue + d.Token,
+	}
+}
+
+type DomainResponse struct {
+	Domain        string           `json:"domain"`
+	Status        DomainStatus     `json:"status"`
+	Challenge     *DomainChallenge `json:"challenge,omitempty"`
+	VerifiedAt    *time.Time       `json:"verified_at,omitempty"`
+	LastCheckedAt *time.Time       `json:"last_checked_at,omitempty"`
+	LastError     string           `json:"last_error,omitempty"`
+	CreatedAt     time.Time        `json:"created_at"`
+}
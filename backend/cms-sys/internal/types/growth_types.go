@@ -0,0 +1,221 @@
+package types
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+// GrowthAggregateKind names a cached growth computation.
+type GrowthAggregateKind string
+
+const (
+	AggregateCohorts       GrowthAggregateKind = "cohorts"
+	AggregateFunnel        GrowthAggregateKind = "funnel"
+	AggregateSubscriptions GrowthAggregateKind = "subscriptions"
+	AggregateRevenue       GrowthAggregateKind = "revenue"
+)
+
+// GrowthAggregate is a computed growth result kept so that repeated requests
+// are answered without scanning customers, purchases and payments again. Key
+// identifies the query it answers.
+type GrowthAggregate struct {
+	Kind       string    `gorm:"size:30;primaryKey" json:"kind"`
+	Key        string    `gorm:"size:200;primaryKey" json:"key"`
+	Data       string    `gorm:"type:jsonb;not null" json:"-"`
+	ComputedAt time.Time `gorm:"not null;index" json:"computed_at"`
+}
+
+func (GrowthAggregate) TableName() string {
+	return "cms_growth_aggregate"
+}
+
+// GrowthQuery selects the calendar months From through To, both the first
+// day of a month in UTC. System narrows the funnel to one system.
+type GrowthQuery struct {
+	From   time.Time
+	To     time.Time
+	System SystemType
+}
+
+// CohortMatrix follows the customers who signed up in each month. Period k of
+// a cohort is the k-th month after its signup month, which is period 0;
+// periods run up to the last month of the query.
+type CohortMatrix struct {
+	From       time.Time   `json:"from"`
+	To         time.Time   `json:"to"`
+	Cohorts    []CohortRow `json:"cohorts"`
+	ComputedAt time.Time   `json:"computed_at"`
+}
+
+type CohortRow struct {
+	Cohort time.Time `json:"cohort"`
+	Size   int64     `json:"size"`
+	// Converted counts, per period, the customers who had made their first
+	// purchase by the end of it.
+	Converted      []int64   `json:"converted"`
+	ConversionRate []float64 `json:"conversion_rate"`
+	// Retained counts, per period, the customers who held a purchased system
+	// or a paying subscription at some point in it.
+	Retained      []int64   `json:"retained"`
+	RetentionRate []float64 `json:"retention_rate"`
+}
+
+// CohortCell is one count of a cohort's matrix as the database returns it.
+type CohortCell struct {
+	Cohort time.Time
+	Period int
+	Count  int64
+}
+
+// GrowthFunnel follows the customers who signed up in the query's months
+// from registration to a paid, still active customer.
+type GrowthFunnel struct {
+	From          time.Time       `json:"from"`
+	To            time.Time       `json:"to"`
+	System        SystemType      `json:"system,omitempty"`
+	Stages        []FunnelStage   `json:"stages"`
+	TimeToConvert ConversionTimes `json:"time_to_convert"`
+	ComputedAt    time.Time       `json:"computed_at"`
+}
+
+const (
+	FunnelRegistered = "registered"
+	FunnelVerified   = "verified"
+	FunnelPurchased  = "purchased"
+	FunnelPaid       = "paid"
+	FunnelActive     = "active"
+)
+
+// FunnelStage counts the customers who reached a stage and every stage before
+// it. Rate is relative to registrations, StepRate to the stage before.
+type FunnelStage struct {
+	Stage    string  `json:"stage"`
+	Count    int64   `json:"count"`
+	Rate     float64 `json:"rate"`
+	StepRate float64 `json:"step_rate"`
+}
+
+// ConversionTimes describes how long every customer who bought took from
+// signing up to their first purchase, verified or not. The percentiles are
+// nil when nobody bought.
+type ConversionTimes struct {
+	MedianDays *float64           `json:"median_days"`
+	P75Days    *float64           `json:"p75_days"`
+	P90Days    *float64           `json:"p90_days"`
+	Buckets    []ConversionBucket `json:"buckets"`
+}
+
+type ConversionBucket struct {
+	Label string `json:"label"`
+	Count int64  `json:"count"`
+}
+
+// FunnelCounts is the funnel as the database returns it.
+type FunnelCounts struct {
+	Registered    int64
+	Verified      int64
+	Purchased     int64
+	Paid          int64
+	Active        int64
+	MedianDays    *float64
+	P75Days       *float64 `gorm:"column:p75_days"`
+	P90Days       *float64 `gorm:"column:p90_days"`
+	WithinDay     int64
+	WithinWeek    int64
+	WithinMonth   int64
+	WithinQuarter int64
+	Later         int64
+}
+
+// SubscriptionMonth sums the paying subscriptions of one currency over a
+// month. Start figures are at the first instant of the month, end figures at
+// the first instant of the next. A subscription pays from the end of its
+// trial until it ends, at its plan's current price per month.
+type SubscriptionMonth struct {
+	Month            time.Time `json:"month"`
+	Currency         string    `json:"currency"`
+	StartMRRCents    int64     `json:"start_mrr_cents"`
+	MRRCents         int64     `json:"mrr_cents"`
+	NewMRRCents      int64     `json:"new_mrr_cents"`
+	ChurnedMRRCents  int64     `json:"churned_mrr_cents"`
+	StartCustomers   int64     `json:"start_customers"`
+	Customers        int64     `json:"customers"`
+	NewCustomers     int64     `json:"new_customers"`
+	ChurnedCustomers int64     `json:"churned_customers"`
+}
+
+type MRRSeries struct {
+	From       time.Time  `json:"from"`
+	To         time.Time  `json:"to"`
+	Points     []MRRPoint `json:"points"`
+	ComputedAt time.Time  `json:"computed_at"`
+}
+
+// MRRPoint is the monthly recurring revenue in one currency at the end of a
+// month and how it moved during the month.
+type MRRPoint struct {
+	Month           time.Time `json:"month"`
+	Currency        string    `json:"currency"`
+	MRRCents        int64     `json:"mrr_cents"`
+	ARRCents        int64     `json:"arr_cents"`
+	NewMRRCents     int64     `json:"new_mrr_cents"`
+	ChurnedMRRCents int64     `json:"churned_mrr_cents"`
+	NetNewMRRCents  int64     `json:"net_new_mrr_cents"`
+	Customers       int64     `json:"customers"`
+	// ARPACents is the average MRR per paying customer.
+	ARPACents int64 `json:"arpa_cents"`
+}
+
+type ChurnSeries struct {
+	From       time.Time    `json:"from"`
+	To         time.Time    `json:"to"`
+	Points     []ChurnPoint `json:"points"`
+	ComputedAt time.Time    `json:"computed_at"`
+}
+
+// ChurnPoint relates the paying customers and revenue lost in a month to
+// those at its start. The rates are nil when the month started with none.
+type ChurnPoint struct {
+	Month             time.Time `json:"month"`
+	Currency          string    `json:"currency"`
+	StartCustomers    int64     `json:"start_customers"`
+	NewCustomers      int64     `json:"new_customers"`
+	ChurnedCustomers  int64     `json:"churned_customers"`
+	EndCustomers      int64     `json:"end_customers"`
+	CustomerChurnRate *float64  `json:"customer_churn_rate"`
+	RevenueChurnRate  *float64  `json:"revenue_churn_rate"`
+}
+
+// PlanRevenue is the money collected on one plan in a month, net of refunds.
+// PlanID is nil for payments outside a subscription.
+type PlanRevenue struct {
+	Month        time.Time
+	Currency     string
+	PlanID       *uuid.UUID
+	RevenueCents int64
+	Payments     int64
+}
+
+// RevenueBySystem splits collected revenue over the systems of the plans it
+// was paid for, evenly between a plan's systems. System is empty for money
+// not tied to a plan.
+type RevenueBySystem struct {
+	From       time.Time       `json:"from"`
+	To         time.Time       `json:"to"`
+	Months     []SystemRevenue `json:"months"`
+	Totals     []SystemRevenue `json:"totals"`
+	ComputedAt time.Time       `json:"computed_at"`
+}
+
+type SystemRevenue struct {
+	Month        *time.Time `json:"month,omitempty"`
+	System       SystemType `json:"system"`
+	Currency     string     `json:"currency"`
+	RevenueCents int64      `json:"revenue_cents"`
+	Payments     int64      `json:"payments"`
+}
+
+type GrowthRefreshReport struct {
+	Refreshed int      `json:"refreshed"`
+	Failed    []string `json:"failed,omitempty"`
+}
@@ -0,0 +1,67 @@
+package types
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+// InviteRole is the LMS role an invited staff member joins with. Students
+// sign up through the LMS and cannot be invited.
+type InviteRole string
+
+const (
+	InviteInstructor InviteRole = "INSTRUCTOR"
+	InviteLMSAdmin   InviteRole = "LMS_ADMIN"
+)
+
+type InvitationStatus string
+
+const (
+	InvitationPending  InvitationStatus = "PENDING"
+	InvitationAccepted InvitationStatus = "ACCEPTED"
+	InvitationRevoked  InvitationStatus = "REVOKED"
+	InvitationExpired  InvitationStatus = "EXPIRED"
+)
+
+// TenantInvitation invites an email address to join a tenant's LMS as staff.
+// Only a hash of the token's secret part is stored; resending rotates it, so
+// earlier links stop working. The partial unique index keeps one pending
+// invitation per address and tenant.
+type TenantInvitation struct {
+	InvitationID uuid.UUID        `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"invitation_id"`
+	Namespace    string           `gorm:"size:100;not null;index;uniqueIndex:idx_invitation_pending,where:status = 'PENDING'" json:"namespace"`
+	Email        string           `gorm:"size:255;not null;uniqueIndex:idx_invitation_pending" json:"email"`
+	Role         InviteRole       `gorm:"type:varchar(20);not null" json:"role"`
+	Status       InvitationStatus `gorm:"type:varchar(20);not null;default:'PENDING'" json:"status"`
+	TokenHash    string           `gorm:"size:64;not null" json:"-"`
+	InvitedBy    *uuid.UUID       `gorm:"type:uuid" json:"invited_by,omitempty"`
+	SendCount    int              `gorm:"not null;default:0" json:"send_count"`
+	LastSentAt   *time.Time       `json:"last_sent_at,omitempty"`
+	ExpiresAt    time.Time        `gorm:"not null" json:"expires_at"`
+	AcceptedAt   *time.Time       `json:"accepted_at,omitempty"`
+	// LMSUserID is the LMS account the invitation was accepted with.
+	LMSUserID *uuid.UUID `gorm:"type:uuid" json:"lms_user_id,omitempty"`
+	CreatedAt time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+}
+
+func (TenantInvitation) TableName() string {
+	return "cms_tenant_invitation"
+}
+
+// InvitationPreview is what the accept page shows before the invitee commits.
+type InvitationPreview struct {
+	Namespace string     `json:"namespace"`
+	Email     string     `json:"email"`
+	Role      InviteRole `json:"role"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	// HasAccount tells the page whether to ask for a new password or the
+	// existing account's.
+	HasAccount bool `json:"has_account"`
+}
+
+type InvitationAcceptance struct {
+	Namespace string     `json:"namespace"`
+	LMSUserID uuid.UUID  `json:"lms_user_id"`
+	Role      InviteRole `json:"role"`
+	Created   bool       `json:"created"`
+}
@@ -0,0 +1,91 @@
+package types
+
+import (
+	"fmt"
+	"github.com/google/uuid"
+	"time"
+)
+
+type InvoiceKind string
+
+const (
+	// InvoicePurchase bills the first paid period of a subscription.
+	InvoicePurchase InvoiceKind = "PURCHASE"
+	InvoiceRenewal  InvoiceKind = "RENEWAL"
+)
+
+type InvoiceLineKind string
+
+const (
+	InvoiceLineItem InvoiceLineKind = "ITEM"
+	// InvoiceLineDiscount lines carry a negative amount.
+	InvoiceLineDiscount InvoiceLineKind = "DISCOUNT"
+	InvoiceLineTax      InvoiceLineKind = "TAX"
+)
+
+// Invoice is an issued bill. Numbers are sequential per calendar year with no
+// gaps; a subscription is invoiced at most once per period.
+type Invoice struct {
+	InvoiceID      uuid.UUID   `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"invoice_id"`
+	Number         string      `gorm:"size:30;not null;unique" json:"number"`
+	Year           int         `gorm:"not null;uniqueIndex:idx_invoice_sequence" json:"year"`
+	Sequence       int         `gorm:"not null;uniqueIndex:idx_invoice_sequence" json:"sequence"`
+	Kind           InvoiceKind `gorm:"type:varchar(20);not null" json:"kind"`
+	CustomerID     uuid.UUID   `gorm:"type:uuid;not null;index" json:"customer_id"`
+	SubscriptionID *uuid.UUID  `gorm:"type:uuid;uniqueIndex:idx_invoice_period" json:"subscription_id,omitempty"`
+	PlanID         *uuid.UUID  `gorm:"type:uuid" json:"plan_id,omitempty"`
+	BillToName     string      `gorm:"size:100;not null" json:"bill_to_name"`
+	BillToEmail    string      `gorm:"size:150;not null" json:"bill_to_email"`
+	Currency       string      `gorm:"size:3;not null" json:"currency"`
+	SubtotalCents  int64       `gorm:"not null" json:"subtotal_cents"`
+	TaxCents       int64       `gorm:"not null" json:"tax_cents"`
+	TotalCents     int64       `gorm:"not null" json:"total_cents"`
+	PeriodStart    *time.Time  `gorm:"uniqueIndex:idx_invoice_period" json:"period_start,omitempty"`
+	PeriodEnd      *time.Time  `json:"period_end,omitempty"`
+	IssuedAt       time.Time   `gorm:"not null" json:"issued_at"`
+	// FilePath is the rendered PDF on local disk; it is never returned to
+	// clients.
+	FilePath  string        `gorm:"size:500" json:"-"`
+	EmailedAt *time.Time    `json:"emailed_at,omitempty"`
+	CreatedAt time.Time     `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+	Lines     []InvoiceLine `gorm:"foreignKey:InvoiceID;constraint:OnDelete:CASCADE" json:"lines"`
+}
+
+func (Invoice) TableName() string {
+	return "cms_invoice"
+}
+
+// InvoiceNumber formats the number of the seq-th invoice of year.
+func InvoiceNumber(year, seq int) string {
+	return fmt.Sprintf("INV-%d-%06d", year, seq)
+}
+
+// InvoiceLine is a billed item or a tax on the subtotal. Tax lines carry the
+// rate in basis points (1/100 of a percent).
+type InvoiceLine struct {
+	LineID          uuid.UUID       `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"-"`
+	InvoiceID       uuid.UUID       `gorm:"type:uuid;not null;index" json:"-"`
+	Position        int             `gorm:"not null" json:"position"`
+	Kind            InvoiceLineKind `gorm:"type:varchar(10);not null" json:"kind"`
+	Description     string          `gorm:"size:255;not null" json:"description"`
+	Quantity        int64           `gorm:"not null;default:1" json:"quantity"`
+	UnitCents       int64           `gorm:"not null" json:"unit_cents"`
+	RateBasisPoints int64           `gorm:"not null;default:0" json:"rate_basis_points,omitempty"`
+	AmountCents     int64           `gorm:"not null" json:"amount_cents"`
+}
+
+func (InvoiceLine) TableName() string {
+	return "cms_invoice_line"
+}
+
+// InvoiceSequence holds the last number issued in a year. Incrementing it
+// locks the row until the invoice's transaction ends, so a rolled-back
+// invoice gives its number back.
+type InvoiceSequence struct {
+	Year       int `gorm:"primaryKey;autoIncrement:false" json:"year"`
+	LastNumber int `gorm:"not null" json:"last_number"`
+}
+
+func (InvoiceSequence) TableName() string {
+	return "cms_invoice_sequence"
+}
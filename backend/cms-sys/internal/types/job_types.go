@@ -0,0 +1,59 @@
+package types
+
+import (
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"time"
+)
+
+type JobStatus string
+
+const (
+	JobPending   JobStatus = "PENDING"
+	JobRunning   JobStatus = "RUNNING"
+	JobSucceeded JobStatus = "SUCCEEDED"
+	JobFailed    JobStatus = "FAILED"
+)
+
+const (
+	JobTenantExport    = "tenant_export"
+	JobInvoiceDelivery = "invoice_delivery"
+	// JobSystemProvisioning calls a catalog system's provisioning hook.
+	JobSystemProvisioning = "system_provisioning"
+	// JobReportExport writes an admin report to a downloadable file.
+	JobReportExport = "report_export"
+	// JobReportSchedule runs a scheduled report on request.
+	JobReportSchedule = "report_schedule"
+)
+
+// Job tracks background work requested through the API. ResultPath points at
+// the produced artifact on local disk and is never returned to clients.
+type Job struct {
+	JobID       uuid.UUID  `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"job_id"`
+	Kind        string     `gorm:"size:50;not null;index" json:"kind"`
+	Status      JobStatus  `gorm:"type:varchar(20);not null;default:'PENDING';index" json:"status"`
+	Namespace   *string    `gorm:"size:100;index" json:"namespace,omitempty"`
+	RequestedBy *uuid.UUID `gorm:"type:uuid" json:"requested_by,omitempty"`
+	ResultPath  string     `gorm:"size:500" json:"-"`
+	ResultSize  int64      `json:"result_size,omitempty"`
+	Error       string     `gorm:"type:text" json:"error,omitempty"`
+	StartedAt   *time.Time `json:"started_at,omitempty"`
+	FinishedAt  *time.Time `json:"finished_at,omitempty"`
+	CreatedAt   time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+	UpdatedAt   time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
+}
+
+func (Job) TableName() string {
+	return "cms_job"
+}
+
+func (j *Job) BeforeCreate(tx *gorm.DB) error {
+	if j.JobID == uuid.Nil {
+		j.JobID = uuid.New()
+	}
+	return nil
+}
+
+func (j *Job) Done() bool {
+	return j.Status == JobSucceeded || j.Status == JobFailed
+}
@@ -0,0 +1,71 @@
+package types
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+type TenantMemberRole string
+
+const (
+	// MemberOwner may manage members, transfer ownership and delete data.
+	MemberOwner TenantMemberRole = "OWNER"
+	// MemberAdmin may manage the tenant's configuration.
+	MemberAdmin TenantMemberRole = "ADMIN"
+)
+
+// TenantMember grants a CMS user access to a tenant. The tenant's primary
+// owner (Tenant.OwnerID) is always an owner, with or without a row here.
+type TenantMember struct {
+	Namespace string           `gorm:"size:100;primaryKey" json:"namespace"`
+	UserID    uuid.UUID        `gorm:"type:uuid;primaryKey;index" json:"user_id"`
+	Role      TenantMemberRole `gorm:"type:varchar(20);not null" json:"role"`
+	AddedBy   *uuid.UUID       `gorm:"type:uuid" json:"added_by,omitempty"`
+	CreatedAt time.Time        `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+	UpdatedAt time.Time        `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
+}
+
+func (TenantMember) TableName() string {
+	return "cms_tenant_member"
+}
+
+type MemberResponse struct {
+	UserID    uuid.UUID        `json:"user_id"`
+	Email     string           `json:"email"`
+	Name      string           `json:"name"`
+	Role      TenantMemberRole `json:"role"`
+	Primary   bool             `json:"primary"`
+	CreatedAt time.Time        `json:"created_at"`
+}
+
+type TransferStatus string
+
+const (
+	TransferPending   TransferStatus = "PENDING"
+	TransferAccepted  TransferStatus = "ACCEPTED"
+	TransferDeclined  TransferStatus = "DECLINED"
+	TransferCancelled TransferStatus = "CANCELLED"
+	TransferExpired   TransferStatus = "EXPIRED"
+)
+
+// OwnershipTransfer hands primary ownership from one user to another. It only
+// takes effect once the recipient accepts. The partial unique index keeps one
+// pending transfer per tenant.
+type OwnershipTransfer struct {
+	TransferID uuid.UUID      `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"transfer_id"`
+	Namespace  string         `gorm:"size:100;not null;uniqueIndex:idx_transfer_pending,where:status = 'PENDING'" json:"namespace"`
+	FromUserID uuid.UUID      `gorm:"type:uuid;not null" json:"from_user_id"`
+	ToUserID   uuid.UUID      `gorm:"type:uuid;not null;index" json:"to_user_id"`
+	Status     TransferStatus `gorm:"type:varchar(20);not null;default:'PENDING'" json:"status"`
+	// KeepAccess leaves the previous owner on the tenant as an admin.
+	KeepAccess bool       `gorm:"not null;default:true" json:"keep_access"`
+	Message    string     `gorm:"size:500" json:"message,omitempty"`
+	ExpiresAt  time.Time  `gorm:"not null" json:"expires_at"`
+	ResolvedAt *time.Time `json:"resolved_at,omitempty"`
+	ResolvedBy *uuid.UUID `gorm:"type:uuid" json:"resolved_by,omitempty"`
+	CreatedAt  time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+}
+
+func (OwnershipTransfer) TableName() string {
+	return "cms_tenant_transfer"
+}
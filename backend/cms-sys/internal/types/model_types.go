@@ -14,6 +14,7 @@ const (
 	CMSCustomer RoleType = "CMS_CUSTOMER"
 )
 
+// Systems are listed in the system catalog; these are the built-in ones.
 const (
 	LMS SystemType = "LMS"
 	EMS SystemType = "EMS"
@@ -55,19 +56,55 @@ func (u *CMSUser) BeforeCreate(tx *gorm.DB) error {
 	return nil
 }
 
+func (u *CMSUser) IsAdmin() bool {
+	return u.CMSUserRole == string(RootAdmin)
+}
+
+func (u *CMSUser) IsCustomer() bool {
+	return u.CMSUserRole == string(CMSCustomer)
+}
+
+func (u *CMSUser) NameSpace() string {
+	if u.CMSNameSpace == nil {
+		return ""
+	}
+	return *u.CMSNameSpace
+}
+
+// CMSCusPurchase records that a customer bought a system. A customer holds at
+// most one row per system; cancelling keeps the row and buying again
+// reactivates it.
 type CMSCusPurchase struct {
-	RelationID   uuid.UUID `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"relation_id"`
-	CMSCusID     uuid.UUID `gorm:"type:uuid;not null" json:"cms_cus_id"`
-	SystemName   string    `gorm:"type:varchar(100);not null" json:"system_name"`
+	RelationID uuid.UUID `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"relation_id"`
+	CMSCusID   uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_purchase_customer_system" json:"cms_cus_id"`
+	SystemName string    `gorm:"type:varchar(100);not null;uniqueIndex:idx_purchase_customer_system" json:"system_name"`
+	// Namespace is the tenant the purchase is used by. A purchase attached to
+	// a tenant moves to the new owner when ownership is transferred.
+	Namespace    *string   `gorm:"size:100;index" json:"namespace,omitempty"`
 	PurchaseDate time.Time `gorm:"not null;default:CURRENT_TIMESTAMP" json:"purchase_date"`
-	CreatedAt    time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
-	Customer     CMSUser   `gorm:"foreignKey:CMSCusID;references:CMSUserID" json:"customer,omitempty"`
+	// GrantedBy is the root admin who granted the purchase, nil if the
+	// customer bought it.
+	GrantedBy *uuid.UUID `gorm:"type:uuid" json:"granted_by,omitempty"`
+	// SubscriptionID is the subscription that pays for the purchase. It stays
+	// when the purchase moves with a tenant to a new owner, so the tenant
+	// keeps the subscription it was bought with.
+	SubscriptionID *uuid.UUID `gorm:"type:uuid;index" json:"subscription_id,omitempty"`
+	CanceledAt     *time.Time `json:"canceled_at,omitempty"`
+	CanceledBy     *uuid.UUID `gorm:"type:uuid" json:"canceled_by,omitempty"`
+	CreatedAt      time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+	Customer       CMSUser    `gorm:"foreignKey:CMSCusID;references:CMSUserID" json:"customer,omitempty"`
+	// Catalog is only declared for the foreign key to the system catalog.
+	Catalog SystemCatalog `gorm:"foreignKey:SystemName;references:Code" json:"-"`
 }
 
 func (CMSCusPurchase) TableName() string {
 	return "cms_cus_purchase"
 }
 
+func (p *CMSCusPurchase) Active() bool {
+	return p.CanceledAt == nil
+}
+
 func (p *CMSCusPurchase) BeforeCreate(tx *gorm.DB) error {
 	if p.RelationID == uuid.Nil {
 		p.RelationID = uuid.New()
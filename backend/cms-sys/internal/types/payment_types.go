@@ -0,0 +1,93 @@
+package types
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+// PaymentCustomer links a CMS customer to their record at a payment
+// provider.
+type PaymentCustomer struct {
+	CustomerID uuid.UUID `gorm:"type:uuid;primaryKey" json:"customer_id"`
+	Provider   string    `gorm:"size:30;primaryKey;uniqueIndex:idx_payment_customer_external" json:"provider"`
+	ExternalID string    `gorm:"size:100;not null;uniqueIndex:idx_payment_customer_external" json:"external_id"`
+	CreatedAt  time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+}
+
+func (PaymentCustomer) TableName() string {
+	return "cms_payment_customer"
+}
+
+type CheckoutStatus string
+
+const (
+	CheckoutOpen      CheckoutStatus = "OPEN"
+	CheckoutCompleted CheckoutStatus = "COMPLETED"
+	CheckoutExpired   CheckoutStatus = "EXPIRED"
+)
+
+// Checkout is a hosted payment page opened for a customer to pay the first
+// period of a plan. The subscription is created when the provider reports
+// the checkout completed.
+type Checkout struct {
+	CheckoutID     uuid.UUID      `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"checkout_id"`
+	CustomerID     uuid.UUID      `gorm:"type:uuid;not null;index" json:"customer_id"`
+	PlanID         uuid.UUID      `gorm:"type:uuid;not null" json:"plan_id"`
+	Provider       string         `gorm:"size:30;not null;uniqueIndex:idx_checkout_external" json:"provider"`
+	ExternalID     string         `gorm:"size:100;not null;uniqueIndex:idx_checkout_external" json:"external_id"`
+	URL            string         `gorm:"size:500;not null" json:"url"`
+	AmountCents    int64          `gorm:"not null" json:"amount_cents"`
+	Currency       string         `gorm:"size:3;not null" json:"currency"`
+	Status         CheckoutStatus `gorm:"type:varchar(20);not null;index" json:"status"`
+	PaymentID      *uuid.UUID     `gorm:"type:uuid" json:"payment_id,omitempty"`
+	SubscriptionID *uuid.UUID     `gorm:"type:uuid" json:"subscription_id,omitempty"`
+	ExpiresAt      time.Time      `json:"expires_at"`
+	CompletedAt    *time.Time     `json:"completed_at,omitempty"`
+	CreatedAt      time.Time      `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+	UpdatedAt      time.Time      `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
+}
+
+func (Checkout) TableName() string {
+	return "cms_payment_checkout"
+}
+
+type PaymentStatus string
+
+const (
+	PaymentSucceeded         PaymentStatus = "SUCCEEDED"
+	PaymentPartiallyRefunded PaymentStatus = "PARTIALLY_REFUNDED"
+	PaymentRefunded          PaymentStatus = "REFUNDED"
+)
+
+// Payment is money collected from a customer, through a checkout or an
+// off-session charge for a subscription period.
+type Payment struct {
+	PaymentID      uuid.UUID     `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"payment_id"`
+	CustomerID     uuid.UUID     `gorm:"type:uuid;not null;index" json:"customer_id"`
+	SubscriptionID *uuid.UUID    `gorm:"type:uuid;index" json:"subscription_id,omitempty"`
+	Provider       string        `gorm:"size:30;not null;uniqueIndex:idx_payment_external" json:"provider"`
+	ExternalID     string        `gorm:"size:100;not null;uniqueIndex:idx_payment_external" json:"external_id"`
+	AmountCents    int64         `gorm:"not null" json:"amount_cents"`
+	RefundedCents  int64         `gorm:"not null;default:0" json:"refunded_cents"`
+	Currency       string        `gorm:"size:3;not null" json:"currency"`
+	Status         PaymentStatus `gorm:"type:varchar(20);not null;index" json:"status"`
+	CreatedAt      time.Time     `gorm:"default:CURRENT_TIMESTAMP;index" json:"created_at"`
+	UpdatedAt      time.Time     `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
+}
+
+func (Payment) TableName() string {
+	return "cms_payment"
+}
+
+// PaymentEvent remembers a processed webhook event so a redelivery is
+// acknowledged without being applied twice.
+type PaymentEvent struct {
+	Provider   string    `gorm:"size:30;primaryKey" json:"provider"`
+	EventID    string    `gorm:"size:100;primaryKey" json:"event_id"`
+	Type       string    `gorm:"size:50;not null" json:"type"`
+	ReceivedAt time.Time `gorm:"not null;default:CURRENT_TIMESTAMP" json:"received_at"`
+}
+
+func (PaymentEvent) TableName() string {
+	return "cms_payment_event"
+}
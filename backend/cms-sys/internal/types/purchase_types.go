@@ -0,0 +1,54 @@
+package types
+
+import "fmt"
+
+// EntitlementSource says what entitles a customer to a system.
+type EntitlementSource string
+
+const (
+	EntitlementSubscription EntitlementSource = "SUBSCRIPTION"
+	EntitlementGrant        EntitlementSource = "GRANT"
+)
+
+// Entitlement answers whether a customer may use a system.
+type Entitlement struct {
+	System   SystemType        `json:"system"`
+	Entitled bool              `json:"entitled"`
+	Source   EntitlementSource `json:"source,omitempty"`
+	// SubscriptionStatus is the status of the live subscription paying for
+	// the purchase, if any. A past-due subscription still entitles during its
+	// grace period.
+	SubscriptionStatus SubscriptionStatus `json:"subscription_status,omitempty"`
+	// Namespace is the tenant the entitling purchase is attached to, if any.
+	Namespace *string `json:"namespace,omitempty"`
+}
+
+// SystemAccessError explains why a caller was refused a system and how they
+// can get it.
+type SystemAccessError struct {
+	Code   string     `json:"code"`
+	System SystemType `json:"system"`
+	// SubscriptionStatus is set when the caller has a live subscription that
+	// does not include the system.
+	SubscriptionStatus SubscriptionStatus `json:"subscription_status,omitempty"`
+	Upgrade            *UpgradeHint       `json:"upgrade,omitempty"`
+}
+
+func (e *SystemAccessError) Error() string {
+	return fmt.Sprintf("%s is not included in your subscription", e.System)
+}
+
+// UpgradeHint points a refused caller at the plans that include the system.
+type UpgradeHint struct {
+	Plans       []string `json:"plans,omitempty"`
+	PlansURL    string   `json:"plans_url"`
+	CheckoutURL string   `json:"checkout_url"`
+}
+
+// SystemAccess confirms a caller was admitted to a system.
+type SystemAccess struct {
+	System    SystemType `json:"system"`
+	UserID    string     `json:"user_id"`
+	Role      string     `json:"role"`
+	Namespace string     `json:"namespace,omitempty"`
+}
@@ -0,0 +1,212 @@
+package types
+
+import (
+	"encoding/json"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"time"
+)
+
+// ReportName names an admin report in URLs, exports and audit entries.
+type ReportName string
+
+const (
+	ReportCustomerPurchases ReportName = "customer-purchases"
+	ReportSystemUsage       ReportName = "systems"
+)
+
+// ReportFilter narrows an admin report. Zero values leave a filter out.
+type ReportFilter struct {
+	System SystemType
+	// Namespace keeps only the customers of one tenant.
+	Namespace string
+	// From and To bound the purchase date; To is exclusive.
+	From     time.Time
+	To       time.Time
+	Verified *bool
+	// Active keeps only purchases that are (true) or are not (false)
+	// cancelled.
+	Active *bool
+	// Sort is one of repository.CustomerPurchaseSorts, purchase_date by
+	// default.
+	Sort   string
+	Desc   bool
+	Limit  int
+	Offset int
+}
+
+// CustomerPurchaseRow is one purchase of a customer.
+type CustomerPurchaseRow struct {
+	CustomerID   uuid.UUID  `json:"customer_id"`
+	CMSUserName  string     `json:"cms_user_name"`
+	CMSUserEmail string     `json:"cms_user_email"`
+	Namespace    *string    `json:"namespace,omitempty"`
+	Verified     bool       `json:"verified"`
+	SignedUpAt   time.Time  `json:"signed_up_at"`
+	SystemName   SystemType `json:"system_name"`
+	PurchaseDate time.Time  `json:"purchase_date"`
+	Granted      bool       `json:"granted"`
+	CanceledAt   *time.Time `json:"canceled_at,omitempty"`
+}
+
+// SystemUsageRow counts the customers of a system.
+type SystemUsageRow struct {
+	SystemName SystemType `json:"system_name"`
+	Customers  int64      `json:"customers"`
+	Active     int64      `json:"active"`
+	Canceled   int64      `json:"canceled"`
+	Granted    int64      `json:"granted"`
+	// FirstPurchase and LastPurchase are nil for a system nobody bought
+	// within the filter.
+	FirstPurchase *time.Time `json:"first_purchase,omitempty"`
+	LastPurchase  *time.Time `json:"last_purchase,omitempty"`
+}
+
+// ReportScheduleFilter is the filter of a scheduled report. Dates are relative
+// to each run: WindowDays > 0 covers the purchases of that many days before
+// the run, zero all of them.
+type ReportScheduleFilter struct {
+	System     SystemType `json:"system,omitempty" validate:"omitempty,max=100,alphanum"`
+	WindowDays int        `json:"window_days,omitempty" validate:"min=0,max=3660"`
+	Verified   *bool      `json:"verified,omitempty"`
+	Active     *bool      `json:"active,omitempty"`
+	Sort       string     `json:"sort,omitempty" validate:"max=50"`
+	Desc       bool       `json:"desc,omitempty"`
+}
+
+// At resolves the filter for a run at now.
+func (f ReportScheduleFilter) At(now time.Time) ReportFilter {
+	filter := ReportFilter{
+		System:   f.System,
+		Verified: f.Verified,
+		Active:   f.Active,
+		Sort:     f.Sort,
+		Desc:     f.Desc,
+	}
+	if f.WindowDays > 0 {
+		filter.To = now
+		filter.From = now.AddDate(0, 0, -f.WindowDays)
+	}
+	return filter
+}
+
+// ReportSchedule runs a report on a cron schedule, stores every result as a
+// snapshot and sends it to the recipients and the webhook. LockedBy and
+// LockedUntil are the lease of the instance running it.
+type ReportSchedule struct {
+	ScheduleID uuid.UUID            `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"schedule_id"`
+	Name       string               `gorm:"size:200;not null" json:"name"`
+	Report     ReportName           `gorm:"type:varchar(50);not null" json:"report"`
+	Filter     ReportScheduleFilter `gorm:"type:jsonb;serializer:json;not null" json:"filter"`
+	// Namespace names the tenant the schedule reports on. Its snapshots are
+	// also written to that tenant's LMS Report table.
+	Namespace   *string    `gorm:"size:100;index" json:"namespace,omitempty"`
+	Format      string     `gorm:"size:10;not null;default:'csv'" json:"format"`
+	Cron        string     `gorm:"size:100;not null" json:"cron"`
+	Timezone    string     `gorm:"size:64;not null;default:'UTC'" json:"timezone"`
+	Recipients  []string   `gorm:"type:jsonb;serializer:json" json:"recipients"`
+	WebhookURL  string     `gorm:"size:500" json:"webhook_url,omitempty"`
+	Enabled     bool       `gorm:"not null" json:"enabled"`
+	NextRunAt   *time.Time `gorm:"index" json:"next_run_at,omitempty"`
+	LastRunAt   *time.Time `json:"last_run_at,omitempty"`
+	LastVersion int        `gorm:"not null;default:0" json:"last_version"`
+	LastError   string     `gorm:"type:text" json:"last_error,omitempty"`
+	LockedBy    string     `gorm:"size:100" json:"-"`
+	LockedUntil *time.Time `json:"-"`
+	CreatedBy   *uuid.UUID `gorm:"type:uuid" json:"created_by,omitempty"`
+	CreatedAt   time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+	UpdatedAt   time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
+	// Snapshots is only declared for the cascading foreign key.
+	Snapshots []ReportSnapshot `gorm:"foreignKey:ScheduleID;constraint:OnDelete:CASCADE" json:"-"`
+}
+
+func (ReportSchedule) TableName() string {
+	return "cms_report_schedule"
+}
+
+func (s *ReportSchedule) BeforeCreate(tx *gorm.DB) error {
+	if s.ScheduleID == uuid.Nil {
+		s.ScheduleID = uuid.New()
+	}
+	return nil
+}
+
+// ReportSnapshot is the stored result of one run. Versions count up from 1 per
+// schedule. Data holds a ReportSnapshotData and Diff a ReportDiff, both JSON.
+type ReportSnapshot struct {
+	SnapshotID    uuid.UUID `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"snapshot_id"`
+	ScheduleID    uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_report_snapshot_version" json:"schedule_id"`
+	Version       int       `gorm:"not null;uniqueIndex:idx_report_snapshot_version" json:"version"`
+	GeneratedAt   time.Time `gorm:"not null" json:"generated_at"`
+	RowCount      int       `gorm:"not null" json:"row_count"`
+	Checksum      string    `gorm:"size:64;not null" json:"checksum"`
+	Data          string    `gorm:"type:jsonb;not null" json:"-"`
+	Diff          string    `gorm:"type:jsonb;not null;default:'{}'" json:"-"`
+	DeliveryError string    `gorm:"type:text" json:"delivery_error,omitempty"`
+	// TenantReportID is the row written to the tenant's LMS Report table,
+	// for schedules that report on a tenant.
+	TenantReportID *uuid.UUID `gorm:"type:uuid" json:"tenant_report_id,omitempty"`
+	CreatedAt      time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+}
+
+func (ReportSnapshot) TableName() string {
+	return "cms_report_snapshot"
+}
+
+func (s *ReportSnapshot) BeforeCreate(tx *gorm.DB) error {
+	if s.SnapshotID == uuid.Nil {
+		s.SnapshotID = uuid.New()
+	}
+	return nil
+}
+
+// ReportSnapshotFormat is the version of the ReportSnapshotData layout.
+const ReportSnapshotFormat = 1
+
+// ReportSnapshotData is the JSON stored in a snapshot.
+type ReportSnapshotData struct {
+	FormatVersion int                      `json:"format_version"`
+	Report        ReportName               `json:"report"`
+	From          *time.Time               `json:"from,omitempty"`
+	To            *time.Time               `json:"to,omitempty"`
+	Columns       []string                 `json:"columns"`
+	Rows          []map[string]interface{} `json:"rows"`
+}
+
+// ReportDiff compares a snapshot with the one before it. Rows lists at most a
+// bounded number of the changes; the counts cover all of them.
+type ReportDiff struct {
+	PreviousVersion int               `json:"previous_version,omitempty"`
+	Added           int               `json:"added"`
+	Removed         int               `json:"removed"`
+	Changed         int               `json:"changed"`
+	Rows            []ReportRowChange `json:"rows,omitempty"`
+}
+
+func (d *ReportDiff) Empty() bool {
+	return d.Added == 0 && d.Removed == 0 && d.Changed == 0
+}
+
+type ReportRowChange struct {
+	Key    string                       `json:"key"`
+	Change string                       `json:"change"`
+	Fields map[string]ReportFieldChange `json:"fields,omitempty"`
+}
+
+type ReportFieldChange struct {
+	From json.RawMessage `json:"from"`
+	To   json.RawMessage `json:"to"`
+}
+
+// ReportSnapshotDetail is a snapshot with its data and diff.
+type ReportSnapshotDetail struct {
+	ReportSnapshot
+	Data json.RawMessage `json:"data"`
+	Diff json.RawMessage `json:"diff"`
+}
+
+// ReportScheduleRunReport sums up one pass of the scheduler.
+type ReportScheduleRunReport struct {
+	Ran    int `json:"ran"`
+	Failed int `json:"failed"`
+}
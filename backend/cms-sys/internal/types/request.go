@@ -1,17 +1,191 @@
 package types
 
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
 type LoginRequest struct {
 	Email    string `json:"email" validate:"required,email"`
 	Password string `json:"password" validate:"required,min=6"`
 }
 
+// RegisterRequest signs up a customer. Registration is public, so it cannot
+// choose a role.
 type RegisterRequest struct {
 	Name     string `json:"name" validate:"required,min=2"`
 	Email    string `json:"email" validate:"required,email"`
 	Password string `json:"password" validate:"required,min=6"`
-	Role     string `json:"role,omitempty"`
 }
 
 type RefreshTokenRequest struct {
 	RefreshToken string `json:"refresh_token" validate:"required"`
 }
+
+// CreateTenantRequest provisions an empty tenant, or one seeded from a
+// template (content only) or a clone of another tenant (content, plus users
+// and their activity when IncludeUsers is set).
+type CreateTenantRequest struct {
+	Namespace    string    `json:"namespace" validate:"required,min=2,max=55"`
+	OwnerID      uuid.UUID `json:"owner_id" validate:"required"`
+	Template     string    `json:"template,omitempty" validate:"excluded_with=CloneFrom"`
+	CloneFrom    string    `json:"clone_from,omitempty"`
+	IncludeUsers bool      `json:"include_users,omitempty" validate:"excluded_without=CloneFrom"`
+	// Isolation overrides the platform default isolation mode.
+	Isolation IsolationMode `json:"isolation,omitempty" validate:"omitempty,oneof=schema shared"`
+}
+
+type TenantStatusRequest struct {
+	Reason string `json:"reason" validate:"max=255"`
+}
+
+type ScheduleDeletionRequest struct {
+	Reason        string `json:"reason" validate:"max=255"`
+	RetentionDays *int   `json:"retention_days,omitempty" validate:"omitempty,min=0,max=365"`
+}
+
+// ImportTenantRequest restores an archive into Namespace, defaulting to the
+// namespace it was exported from. Without OwnerID the archive's owner email
+// must match an existing user.
+type ImportTenantRequest struct {
+	Namespace string        `json:"namespace,omitempty" validate:"omitempty,min=2,max=55"`
+	OwnerID   *uuid.UUID    `json:"owner_id,omitempty"`
+	Isolation IsolationMode `json:"isolation,omitempty" validate:"omitempty,oneof=schema shared"`
+}
+
+// SetQuotaRequest overrides a tenant limit. A nil Limit falls back to the
+// owner's plan or the platform default; 0 blocks the metric entirely.
+type SetQuotaRequest struct {
+	Metric string `json:"metric" validate:"required,oneof=users courses storage_bytes api_calls"`
+	Limit  *int64 `json:"limit" validate:"omitempty,min=0"`
+}
+
+type AddDomainRequest struct {
+	Domain string `json:"domain" validate:"required,fqdn,max=253"`
+}
+
+// AddMemberRequest gives an existing CMS user access to a tenant.
+type AddMemberRequest struct {
+	Email string           `json:"email" validate:"required,email"`
+	Role  TenantMemberRole `json:"role" validate:"required,oneof=OWNER ADMIN"`
+}
+
+type UpdateMemberRequest struct {
+	Role TenantMemberRole `json:"role" validate:"required,oneof=OWNER ADMIN"`
+}
+
+// TransferOwnershipRequest names the new primary owner. KeepAccess defaults to
+// true, leaving the previous owner on the tenant as an admin.
+type TransferOwnershipRequest struct {
+	Email      string `json:"email" validate:"required,email"`
+	KeepAccess *bool  `json:"keep_access,omitempty"`
+	Message    string `json:"message,omitempty" validate:"max=500"`
+}
+
+// InviteMemberRequest invites someone to join the tenant's LMS as staff.
+type InviteMemberRequest struct {
+	Email string     `json:"email" validate:"required,email"`
+	Role  InviteRole `json:"role" validate:"required,oneof=INSTRUCTOR LMS_ADMIN"`
+}
+
+// AcceptInvitationRequest redeems an invite link. Password sets the password
+// of a new LMS account, or proves the invitee holds the existing one.
+type AcceptInvitationRequest struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password,omitempty" validate:"omitempty,min=6"`
+}
+
+// PurchaseRequest buys, grants or names a system.
+type PurchaseRequest struct {
+	System SystemType `json:"system" validate:"required,max=100,alphanum"`
+}
+
+// PlanRequest creates or replaces a plan. Quotas are keyed by usage metric;
+// metrics left out fall back to the platform defaults.
+type PlanRequest struct {
+	Code        string                `json:"code" validate:"required,max=50,alphanum"`
+	Name        string                `json:"name" validate:"required,max=100"`
+	Description string                `json:"description" validate:"max=500"`
+	PriceCents  int64                 `json:"price_cents" validate:"min=0"`
+	Currency    string                `json:"currency" validate:"required,len=3,alpha"`
+	Interval    PlanInterval          `json:"interval" validate:"required,oneof=MONTH YEAR"`
+	TrialDays   int                   `json:"trial_days" validate:"min=0,max=365"`
+	GraceDays   *int                  `json:"grace_days,omitempty" validate:"omitempty,min=0,max=90"`
+	Systems     []SystemType          `json:"systems" validate:"required,min=1,unique,dive,max=100,alphanum"`
+	Quotas      map[UsageMetric]int64 `json:"quotas" validate:"dive,keys,oneof=users courses storage_bytes api_calls,endkeys,min=0"`
+}
+
+// SubscribeRequest names a plan by its code, and optionally a coupon to
+// redeem on it.
+type SubscribeRequest struct {
+	Plan   string `json:"plan" validate:"required,max=50"`
+	Coupon string `json:"coupon,omitempty" validate:"max=50"`
+}
+
+// CouponRequest creates or replaces a coupon. PERCENT coupons need
+// PercentOff; FIXED ones need AmountOffCents and Currency. Plans are listed
+// by code. Active defaults to true on create and is kept on update when
+// left out.
+type CouponRequest struct {
+	Code           string       `json:"code" validate:"required,max=50,alphanum"`
+	Description    string       `json:"description" validate:"max=500"`
+	Kind           CouponKind   `json:"kind" validate:"required,oneof=PERCENT FIXED"`
+	PercentOff     int          `json:"percent_off" validate:"min=0,max=100"`
+	AmountOffCents int64        `json:"amount_off_cents" validate:"min=0"`
+	Currency       string       `json:"currency" validate:"omitempty,len=3,alpha"`
+	MaxRedemptions *int         `json:"max_redemptions,omitempty" validate:"omitempty,min=1"`
+	ExpiresAt      *time.Time   `json:"expires_at,omitempty"`
+	Systems        []SystemType `json:"systems" validate:"unique,dive,max=100,alphanum"`
+	Plans          []string     `json:"plans" validate:"unique,dive,max=50"`
+	Active         *bool        `json:"active,omitempty"`
+}
+
+// SystemRequest describes a catalog system. Status defaults to ACTIVE.
+type SystemRequest struct {
+	Name            string       `json:"name" validate:"required,max=100"`
+	Description     string       `json:"description" validate:"max=500"`
+	BaseURL         string       `json:"base_url" validate:"omitempty,url,max=255"`
+	Status          SystemStatus `json:"status" validate:"omitempty,oneof=ACTIVE DISABLED"`
+	ProvisionHook   string       `json:"provision_hook" validate:"omitempty,url,max=255"`
+	DeprovisionHook string       `json:"deprovision_hook" validate:"omitempty,url,max=255"`
+}
+
+// CreateSystemRequest adds a system to the catalog. The code is stored upper
+// case and cannot be changed later.
+type CreateSystemRequest struct {
+	Code SystemType `json:"code" validate:"required,max=100,alphanum"`
+	SystemRequest
+}
+
+// CancelSubscriptionRequest ends a subscription at the end of the current
+// period, or straight away when Immediately is set.
+type CancelSubscriptionRequest struct {
+	Immediately bool `json:"immediately"`
+}
+
+// RefundRequest refunds a payment, in full when AmountCents is zero.
+type RefundRequest struct {
+	AmountCents int64  `json:"amount_cents" validate:"min=0"`
+	Reason      string `json:"reason" validate:"max=200"`
+}
+
+// SimulateDeclineRequest switches a fake gateway customer's card between
+// declining and working.
+type SimulateDeclineRequest struct {
+	Decline bool `json:"decline"`
+}
+
+// ReportScheduleRequest defines a scheduled report. Format is the attachment
+// sent to the recipients, csv by default.
+type ReportScheduleRequest struct {
+	Name       string               `json:"name" validate:"required,max=200"`
+	Report     ReportName           `json:"report" validate:"required,oneof=customer-purchases systems"`
+	Filter     ReportScheduleFilter `json:"filter"`
+	Namespace  string               `json:"namespace,omitempty" validate:"max=100"`
+	Format     string               `json:"format,omitempty" validate:"omitempty,oneof=csv xlsx ndjson"`
+	Cron       string               `json:"cron" validate:"required,max=100"`
+	Timezone   string               `json:"timezone,omitempty" validate:"max=64"`
+	Recipients []string             `json:"recipients,omitempty" validate:"max=20,dive,email"`
+	WebhookURL string               `json:"webhook_url,omitempty" validate:"omitempty,url,max=500"`
+	Enabled    *bool                `json:"enabled,omitempty"`
+}
@@ -0,0 +1,49 @@
+package types
+
+import (
+	"encoding/json"
+	"github.com/google/uuid"
+	"time"
+)
+
+type SettingSource string
+
+const (
+	SettingFromTenant  SettingSource = "tenant"
+	SettingFromGlobal  SettingSource = "global"
+	SettingFromDefault SettingSource = "default"
+)
+
+// GlobalSetting holds a platform-wide value that tenants inherit unless they
+// override it.
+type GlobalSetting struct {
+	Key       string     `gorm:"column:setting_key;size:100;primaryKey" json:"key"`
+	Value     string     `gorm:"type:jsonb;not null" json:"value"`
+	UpdatedBy *uuid.UUID `gorm:"type:uuid" json:"updated_by,omitempty"`
+	UpdatedAt time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
+}
+
+func (GlobalSetting) TableName() string {
+	return "cms_global_setting"
+}
+
+// TenantSetting is a row of the tenant_setting table inside a tenant schema.
+type TenantSetting struct {
+	Key       string     `gorm:"column:setting_key" json:"key"`
+	Value     string     `json:"value"`
+	UpdatedBy *uuid.UUID `json:"updated_by,omitempty"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+type SettingResponse struct {
+	Key         string        `json:"key"`
+	Kind        string        `json:"kind"`
+	Description string        `json:"description"`
+	Value       interface{}   `json:"value"`
+	Default     interface{}   `json:"default"`
+	Source      SettingSource `json:"source"`
+}
+
+type SetSettingRequest struct {
+	Value json.RawMessage `json:"value" validate:"required"`
+}
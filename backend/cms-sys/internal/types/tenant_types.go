@@ -0,0 +1,131 @@
+package types
+
+import (
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"time"
+)
+
+type TenantStatus string
+
+const (
+	TenantActive          TenantStatus = "ACTIVE"
+	TenantSuspended       TenantStatus = "SUSPENDED"
+	TenantPendingDeletion TenantStatus = "PENDING_DELETION"
+	// TenantPurging is claimed by the instance purging the tenant, so no other
+	// instance or status change runs alongside it.
+	TenantPurging TenantStatus = "PURGING"
+	TenantPurged  TenantStatus = "PURGED"
+)
+
+// IsolationMode is how a tenant's LMS data is separated from other tenants.
+type IsolationMode string
+
+const (
+	// IsolationSchema gives the tenant a dedicated schema.
+	IsolationSchema IsolationMode = "schema"
+	// IsolationShared keeps the tenant's rows in the shared schema, separated
+	// by tenant_id and row-level security.
+	IsolationShared IsolationMode = "shared"
+)
+
+type TenantSource string
+
+const (
+	TenantFromSubdomain TenantSource = "subdomain"
+	TenantFromDomain    TenantSource = "domain"
+	TenantFromHeader    TenantSource = "header"
+	TenantFromToken     TenantSource = "token"
+)
+
+const TenantHeader = "X-Tenant"
+
+type Tenant struct {
+	TenantID   uuid.UUID    `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"tenant_id"`
+	Namespace  string       `gorm:"size:100;not null;unique" json:"namespace"`
+	SchemaName string       `gorm:"size:63;not null;unique" json:"schema_name"`
+	OwnerID    uuid.UUID    `gorm:"type:uuid;not null;index" json:"owner_id"`
+	Status     TenantStatus `gorm:"type:varchar(20);not null;default:'ACTIVE'" json:"status"`
+	// Isolation selects where the tenant's data lives. SchemaName is reserved
+	// for the tenant in either mode, so it can move to a dedicated schema.
+	Isolation IsolationMode `gorm:"type:varchar(20);not null;default:'schema'" json:"isolation"`
+	// IsTemplate marks a tenant whose content new tenants can be created from.
+	IsTemplate bool `gorm:"not null;default:false;index" json:"is_template"`
+	// StatusReason is the operator supplied reason for the last suspension or
+	// deletion request.
+	StatusReason        string     `gorm:"size:255" json:"status_reason,omitempty"`
+	SuspendedAt         *time.Time `json:"suspended_at,omitempty"`
+	DeletionScheduledAt *time.Time `json:"deletion_scheduled_at,omitempty"`
+	PurgeAfter          *time.Time `gorm:"index" json:"purge_after,omitempty"`
+	PurgedAt            *time.Time `json:"purged_at,omitempty"`
+	CreatedAt           time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+	UpdatedAt           time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
+	Owner               CMSUser    `gorm:"foreignKey:OwnerID;references:CMSUserID" json:"owner,omitempty"`
+}
+
+func (Tenant) TableName() string {
+	return "cms_tenant"
+}
+
+func (t *Tenant) BeforeCreate(tx *gorm.DB) error {
+	if t.TenantID == uuid.Nil {
+		t.TenantID = uuid.New()
+	}
+	return nil
+}
+
+func (t *Tenant) IsActive() bool {
+	return t.Status == TenantActive
+}
+
+type TenantResponse struct {
+	TenantID     uuid.UUID     `json:"tenant_id"`
+	Namespace    string        `json:"namespace"`
+	Status       TenantStatus  `json:"status"`
+	Isolation    IsolationMode `json:"isolation"`
+	StatusReason string        `json:"status_reason,omitempty"`
+	IsTemplate   bool          `json:"is_template,omitempty"`
+	Source       TenantSource  `json:"source,omitempty"`
+	PurgeAfter   *time.Time    `json:"purge_after,omitempty"`
+	// Content is only reported for the tenant a request is scoped to.
+	Content   *TenantContent `json:"content,omitempty"`
+	CreatedAt time.Time      `json:"created_at"`
+}
+
+// TenantContent counts what the tenant holds in its LMS storage.
+type TenantContent struct {
+	Users   int64 `json:"users"`
+	Courses int64 `json:"courses"`
+}
+
+// DeletionReport is the tamper-evident record produced when a tenant is
+// purged. Signature is an HMAC-SHA256 over the JSON of every other field.
+type DeletionReport struct {
+	ReportID             uuid.UUID  `json:"report_id"`
+	TenantID             uuid.UUID  `json:"tenant_id"`
+	Namespace            string     `json:"namespace"`
+	SchemaName           string     `json:"schema_name"`
+	RequestedBy          *uuid.UUID `json:"requested_by,omitempty"`
+	DeletionScheduledAt  *time.Time `json:"deletion_scheduled_at,omitempty"`
+	PurgedAt             time.Time  `json:"purged_at"`
+	Forced               bool       `json:"forced"`
+	SchemaDropped        bool       `json:"schema_dropped"`
+	FilesRemoved         int        `json:"files_removed"`
+	BytesRemoved         int64      `json:"bytes_removed"`
+	SearchIndicesRemoved []string   `json:"search_indices_removed"`
+	SigningAlgorithm     string     `json:"signing_algorithm"`
+	Signature            string     `json:"signature,omitempty"`
+}
+
+type TenantDeletionRecord struct {
+	ReportID  uuid.UUID `gorm:"type:uuid;primaryKey" json:"report_id"`
+	TenantID  uuid.UUID `gorm:"type:uuid;not null;index" json:"tenant_id"`
+	Namespace string    `gorm:"size:100;not null" json:"namespace"`
+	Report    string    `gorm:"type:jsonb;not null" json:"report"`
+	Signature string    `gorm:"size:128;not null" json:"signature"`
+	CreatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+}
+
+func (TenantDeletionRecord) TableName() string {
+	return "cms_tenant_deletion_report"
+}
@@ -0,0 +1,100 @@
+package types
+
+import (
+	"fmt"
+	"time"
+)
+
+type UsageMetric string
+
+const (
+	MetricUsers        UsageMetric = "users"
+	MetricCourses      UsageMetric = "courses"
+	MetricStorageBytes UsageMetric = "storage_bytes"
+	MetricAPICalls     UsageMetric = "api_calls"
+)
+
+// UsagePeriodTotal is the period of metrics that measure what a tenant holds
+// rather than what it did in a month.
+const UsagePeriodTotal = "total"
+
+var UsageMetrics = []UsageMetric{MetricUsers, MetricCourses, MetricStorageBytes, MetricAPICalls}
+
+// Monthly reports whether the metric resets every calendar month.
+func (m UsageMetric) Monthly() bool {
+	return m == MetricAPICalls
+}
+
+// Period returns the counter period the metric is recorded under at t.
+func (m UsageMetric) Period(t time.Time) string {
+	if m.Monthly() {
+		return t.UTC().Format("2006-01")
+	}
+	return UsagePeriodTotal
+}
+
+func (m UsageMetric) Valid() bool {
+	for _, known := range UsageMetrics {
+		if m == known {
+			return true
+		}
+	}
+	return false
+}
+
+type UsageCounter struct {
+	Namespace string    `gorm:"size:100;primaryKey" json:"namespace"`
+	Metric    string    `gorm:"size:50;primaryKey" json:"metric"`
+	Period    string    `gorm:"size:20;primaryKey" json:"period"`
+	Value     int64     `gorm:"not null;default:0" json:"value"`
+	UpdatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
+}
+
+func (UsageCounter) TableName() string {
+	return "cms_usage_counter"
+}
+
+// TenantQuota overrides the platform default limit of one metric for a tenant.
+type TenantQuota struct {
+	Namespace string    `gorm:"size:100;primaryKey" json:"namespace"`
+	Metric    string    `gorm:"size:50;primaryKey" json:"metric"`
+	Limit     int64     `gorm:"column:quota_limit;not null" json:"limit"`
+	UpdatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
+}
+
+func (TenantQuota) TableName() string {
+	return "cms_tenant_quota"
+}
+
+// QuotaError is returned when an operation would take a tenant past a limit.
+type QuotaError struct {
+	Namespace string      `json:"namespace"`
+	Metric    UsageMetric `json:"metric"`
+	Period    string      `json:"period"`
+	Limit     int64       `json:"limit"`
+	Used      int64       `json:"used"`
+	Requested int64       `json:"requested"`
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("quota exceeded for %s: %d of %d used, %d requested", e.Metric, e.Used, e.Limit, e.Requested)
+}
+
+// RateLimited distinguishes limits that lift by themselves at the end of the
+// period (HTTP 429) from limits that need a plan change (HTTP 402).
+func (e *QuotaError) RateLimited() bool {
+	return e.Metric.Monthly()
+}
+
+type UsageItem struct {
+	Metric    UsageMetric `json:"metric"`
+	Period    string      `json:"period"`
+	Used      int64       `json:"used"`
+	Limit     *int64      `json:"limit,omitempty"`
+	Remaining *int64      `json:"remaining,omitempty"`
+}
+
+type UsageReport struct {
+	Namespace string      `json:"namespace"`
+	Metrics   []UsageItem `json:"metrics"`
+}
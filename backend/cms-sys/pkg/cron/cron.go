@@ -0,0 +1,194 @@
+// Package cron parses five-field cron expressions (minute, hour, day of month,
+// month, day of week) and computes when they next fire.
+package cron
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is a parsed expression. Each field is a bit set of allowed values.
+type Schedule struct {
+	minute, hour, dom, month, dow uint64
+	// domAny and dowAny record a day field starting with "*", such as "*" or
+	// "*/2". As in classic cron, a time matches both day fields when either
+	// starts with "*", and either of them when neither does.
+	domAny, dowAny bool
+}
+
+var shorthands = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+var (
+	monthNames = map[string]int{"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12}
+	dayNames = map[string]int{"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6}
+)
+
+// Parse reads an expression such as "30 6 * * mon-fri" or a shorthand such as
+// "@daily". Fields take *, values, ranges, lists and /steps; months and days
+// of the week also take three-letter names, and 7 is Sunday.
+func Parse(expr string) (*Schedule, error) {
+	expr = strings.TrimSpace(strings.ToLower(expr))
+	if full, ok := shorthands[expr]; ok {
+		expr = full
+	}
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron: expected 5 fields, got %d", len(fields))
+	}
+
+	s := &Schedule{}
+	var err error
+	if s.minute, err = parseField(fields[0], 0, 59, nil); err != nil {
+		return nil, fmt.Errorf("cron: minute: %w", err)
+	}
+	if s.hour, err = parseField(fields[1], 0, 23, nil); err != nil {
+		return nil, fmt.Errorf("cron: hour: %w", err)
+	}
+	if s.dom, err = parseField(fields[2], 1, 31, nil); err != nil {
+		return nil, fmt.Errorf("cron: day of month: %w", err)
+	}
+	if s.month, err = parseField(fields[3], 1, 12, monthNames); err != nil {
+		return nil, fmt.Errorf("cron: month: %w", err)
+	}
+	if s.dow, err = parseField(fields[4], 0, 7, dayNames); err != nil {
+		return nil, fmt.Errorf("cron: day of week: %w", err)
+	}
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	s.domAny = unrestricted(fields[2])
+	s.dowAny = unrestricted(fields[4])
+	return s, nil
+}
+
+func unrestricted(field string) bool {
+	return strings.HasPrefix(field, "*") || strings.HasPrefix(field, "?")
+}
+
+func parseField(field string, min, max int, names map[string]int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rng, step := part, 1
+		if before, after, ok := strings.Cut(part, "/"); ok {
+			n, err := strconv.Atoi(after)
+			if err != nil || n < 1 {
+				return 0, fmt.Errorf("invalid step %q", after)
+			}
+			rng, step = before, n
+		}
+
+		lo, hi := min, max
+		switch {
+		case rng == "*" || rng == "?":
+		case strings.Contains(rng, "-"):
+			a, b, _ := strings.Cut(rng, "-")
+			var err error
+			if lo, err = parseValue(a, min, max, names); err != nil {
+				return 0, err
+			}
+			if hi, err = parseValue(b, min, max, names); err != nil {
+				return 0, err
+			}
+			if hi < lo {
+				return 0, fmt.Errorf("invalid range %q", rng)
+			}
+		default:
+			v, err := parseValue(rng, min, max, names)
+			if err != nil {
+				return 0, err
+			}
+			lo = v
+			if strings.Contains(part, "/") {
+				hi = max
+			} else {
+				hi = v
+			}
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func parseValue(raw string, min, max int, names map[string]int) (int, error) {
+	if v, ok := names[raw]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(raw)
+	if err != nil || v < min || v > max {
+		return 0, fmt.Errorf("value %q out of range %d-%d", raw, min, max)
+	}
+	return v, nil
+}
+
+// Next returns the first time strictly after t, to the minute, at which the
+// schedule fires, in t's location. It returns the zero time if the schedule
+// never fires, such as "0 0 31 2 *".
+//
+// Times are wall-clock times in t's location. A time skipped when clocks go
+// forward does not fire that day, and a time repeated when they go back fires
+// in both occurrences.
+func (s *Schedule) Next(t time.Time) time.Time {
+	loc := t.Location()
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	// Every valid expression fires within a leap-year cycle.
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = date(t.Year(), t.Month()+1, 1, 0, loc)
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = date(t.Year(), t.Month(), t.Day()+1, 0, loc)
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = date(t.Year(), t.Month(), t.Day(), t.Hour()+1, loc)
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// date is time.Date in loc, except that an hour skipped when clocks go
+// forward becomes the first time after the gap. time.Date may resolve such an
+// hour to a time before the gap, which Next would keep stepping back to.
+func date(year int, month time.Month, day, hour int, loc *time.Location) time.Time {
+	t := time.Date(year, month, day, hour, 0, 0, 0, loc)
+	want := time.Date(year, month, day, hour, 0, 0, 0, time.UTC)
+	for wallClock(t).Before(want) {
+		t = t.Add(time.Minute)
+	}
+	return t
+}
+
+func wallClock(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, time.UTC)
+}
+
+func (s *Schedule) dayMatches(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domAny || s.dowAny {
+		return dom && dow
+	}
+	return dom || dow
+}
@@ -0,0 +1,139 @@
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNext(t *testing.T) {
+	// 2025-01-01 is a Wednesday.
+	start := time.Date(2025, 1, 1, 10, 7, 0, 0, time.UTC)
+	at := func(month time.Month, day, hour, minute int) time.Time {
+		return time.Date(2025, month, day, hour, minute, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		expr string
+		from time.Time
+		want time.Time
+	}{
+		{"*/15 * * * *", start, at(1, 1, 10, 15)},
+		{"5-20/5 * * * *", start, at(1, 1, 10, 10)},
+		{"10/20 * * * *", at(1, 1, 10, 35), at(1, 1, 10, 50)},
+		{"0 9-17 * * *", at(1, 1, 17, 30), at(1, 2, 9, 0)},
+		{"0 6,18 * * *", start, at(1, 1, 18, 0)},
+		{"0 0 1 */3 *", start, at(4, 1, 0, 0)},
+		{"0 8 * mar mon-fri", start, at(3, 3, 8, 0)},
+		{"0 8 * JAN sat,sun", start, at(1, 4, 8, 0)},
+		{"0 0 * * 0", start, at(1, 5, 0, 0)},
+		{"0 0 * * 7", start, at(1, 5, 0, 0)},
+		{"0 0 * * 5-7", start, at(1, 3, 0, 0)},
+		{"@weekly", start, at(1, 5, 0, 0)},
+		{"@monthly", start, at(2, 1, 0, 0)},
+		// With both day fields restricted, either may match.
+		{"0 0 13 * fri", start, at(1, 3, 0, 0)},
+		{"0 0 13 * fri", at(1, 10, 0, 0), at(1, 13, 0, 0)},
+		{"0 0 1-31/2 * mon", start, at(1, 3, 0, 0)},
+		// A day field starting with "*" counts as unrestricted, so both apply:
+		// odd days that are Mondays.
+		{"0 0 */2 * mon", start, at(1, 13, 0, 0)},
+		{"0 0 ? * mon", start, at(1, 6, 0, 0)},
+		{"0 0 29 2 *", start, time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		// Never fires.
+		{"0 0 31 2 *", start, time.Time{}},
+		{"0 0 30 2 *", start, time.Time{}},
+	}
+	for _, tt := range tests {
+		s, err := Parse(tt.expr)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", tt.expr, err)
+		}
+		if got := s.Next(tt.from); !got.Equal(tt.want) {
+			t.Errorf("%q after %s = %s, want %s", tt.expr, tt.from, got, tt.want)
+		}
+	}
+}
+
+func TestNextIsStrictlyAfter(t *testing.T) {
+	s, _ := Parse("0 12 * * *")
+	noon := time.Date(2025, 1, 1, 12, 0, 30, 0, time.UTC)
+	if got, want := s.Next(noon), noon.Truncate(time.Minute).AddDate(0, 0, 1); !got.Equal(want) {
+		t.Fatalf("Next = %s, want %s", got, want)
+	}
+}
+
+func TestNextAcrossDaylightSaving(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("no time zone data: %v", err)
+	}
+	at := func(month time.Month, day, hour, minute int) time.Time {
+		return time.Date(2025, month, day, hour, minute, 0, 0, loc)
+	}
+
+	// Clocks go from 02:00 to 03:00 on 9 March 2025.
+	tests := []struct {
+		expr string
+		from time.Time
+		want time.Time
+	}{
+		{"30 2 * * *", at(3, 9, 0, 0), at(3, 10, 2, 30)},
+		{"0 3 * * *", at(3, 9, 0, 0), at(3, 9, 3, 0)},
+		{"*/30 * * * *", at(3, 9, 1, 45), at(3, 9, 3, 0)},
+	}
+	for _, tt := range tests {
+		s, _ := Parse(tt.expr)
+		if got := s.Next(tt.from); !got.Equal(tt.want) {
+			t.Errorf("%q after %s = %s, want %s", tt.expr, tt.from, got, tt.want)
+		}
+	}
+	if got := at(3, 9, 3, 0).Sub(at(3, 9, 1, 45)); got != 15*time.Minute {
+		t.Fatalf("03:00 is %s after 01:45; the gap was not skipped", got)
+	}
+
+	// Clocks go from 02:00 back to 01:00 on 2 November 2025, so 01:30 comes
+	// twice.
+	s, _ := Parse("30 1 * * *")
+	first := s.Next(at(11, 2, 0, 0))
+	second := s.Next(first)
+	if first.Hour() != 1 || first.Minute() != 30 || second.Sub(first) != time.Hour {
+		t.Fatalf("repeated hour fired at %s and %s", first, second)
+	}
+	if third := s.Next(second); !third.Equal(at(11, 3, 1, 30)) {
+		t.Fatalf("after the repeated hour: %s", third)
+	}
+
+	// Havana skips midnight itself on 9 March 2025.
+	havana, err := time.LoadLocation("America/Havana")
+	if err != nil {
+		t.Skipf("no time zone data: %v", err)
+	}
+	s, _ = Parse("0 12 * * *")
+	from := time.Date(2025, 3, 8, 13, 0, 0, 0, havana)
+	if got, want := s.Next(from), time.Date(2025, 3, 9, 12, 0, 0, 0, havana); !got.Equal(want) {
+		t.Fatalf("across a midnight gap: %s, want %s", got, want)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"0 0 0 * *",
+		"0 0 32 * *",
+		"0 0 * 13 *",
+		"0 0 * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"0 0 * foo *",
+		"a * * * *",
+		"@often",
+	} {
+		if _, err := Parse(expr); err == nil {
+			t.Errorf("Parse(%q) succeeded", expr)
+		}
+	}
+}
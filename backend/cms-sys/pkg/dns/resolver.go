@@ -0,0 +1,84 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Resolver looks up DNS TXT records. A name without records yields an empty
+// result rather than an error.
+type Resolver interface {
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+}
+
+// NetResolver queries DNS over the network. With an empty server it uses the
+// system resolver.
+type NetResolver struct {
+	resolver *net.Resolver
+	timeout  time.Duration
+}
+
+// NewNetResolver returns a resolver that sends queries to server ("host:port")
+// or, if server is empty, through the system configuration. Querying a public
+// server directly avoids waiting out negative caches on the local resolver
+// after a customer adds a record.
+func NewNetResolver(server string, timeout time.Duration) *NetResolver {
+	resolver := net.DefaultResolver
+	if server != "" {
+		resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, network, server)
+			},
+		}
+	}
+	return &NetResolver{resolver: resolver, timeout: timeout}
+}
+
+func (r *NetResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	if r.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.timeout)
+		defer cancel()
+	}
+
+	records, err := r.resolver.LookupTXT(ctx, name)
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+		return nil, nil
+	}
+	return records, err
+}
+
+// StaticResolver answers from records set in memory. It stands in for DNS in
+// tests and in local setups without public domains.
+type StaticResolver struct {
+	mu      sync.RWMutex
+	records map[string][]string
+}
+
+func NewStaticResolver() *StaticResolver {
+	return &StaticResolver{records: make(map[string][]string)}
+}
+
+// Set replaces the TXT records of name.
+func (r *StaticResolver) Set(name string, values ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.records[canonical(name)] = values
+}
+
+func (r *StaticResolver) LookupTXT(_ context.Context, name string) ([]string, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]string(nil), r.records[canonical(name)]...), nil
+}
+
+func canonical(name string) string {
+	return strings.TrimSuffix(strings.ToLower(name), ".")
+}
@@ -0,0 +1,148 @@
+package events
+
+import (
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	TenantProvisioned           = "tenant.provisioned"
+	TenantSuspended             = "tenant.suspended"
+	TenantReactivated           = "tenant.reactivated"
+	TenantDeletionScheduled     = "tenant.deletion_scheduled"
+	TenantPurged                = "tenant.purged"
+	TenantExported              = "tenant.exported"
+	TenantImported              = "tenant.imported"
+	TenantTemplateChanged       = "tenant.template_changed"
+	TenantQuotaChanged          = "tenant.quota_changed"
+	TenantDomainAdded           = "tenant.domain_added"
+	TenantDomainVerified        = "tenant.domain_verified"
+	TenantDomainUnverified      = "tenant.domain_unverified"
+	TenantDomainRemoved         = "tenant.domain_removed"
+	TenantIsolated              = "tenant.isolated"
+	TenantMemberAdded           = "tenant.member_added"
+	TenantMemberUpdated         = "tenant.member_updated"
+	TenantMemberRemoved         = "tenant.member_removed"
+	TenantTransferInitiated     = "tenant.transfer_initiated"
+	TenantTransferDeclined      = "tenant.transfer_declined"
+	TenantTransferCancelled     = "tenant.transfer_cancelled"
+	TenantOwnershipTransferred  = "tenant.ownership_transferred"
+	TenantInvitationSent        = "tenant.invitation_sent"
+	TenantInvitationRevoked     = "tenant.invitation_revoked"
+	TenantInvitationAccepted    = "tenant.invitation_accepted"
+	SettingsChanged             = "settings.changed"
+	PurchaseCreated             = "purchase.created"
+	PurchaseCanceled            = "purchase.canceled"
+	PlanCreated                 = "plan.created"
+	PlanUpdated                 = "plan.updated"
+	PlanRetired                 = "plan.retired"
+	SubscriptionCreated         = "subscription.created"
+	SubscriptionActivated       = "subscription.activated"
+	SubscriptionRenewed         = "subscription.renewed"
+	SubscriptionPlanChanged     = "subscription.plan_changed"
+	SubscriptionPastDue         = "subscription.past_due"
+	SubscriptionCancelScheduled = "subscription.cancel_scheduled"
+	SubscriptionResumed         = "subscription.resumed"
+	SubscriptionCanceled        = "subscription.canceled"
+	SubscriptionExpired         = "subscription.expired"
+	InvoiceIssued               = "invoice.issued"
+	InvoiceResent               = "invoice.resent"
+	CheckoutCreated             = "payment.checkout_created"
+	CheckoutCompleted           = "payment.checkout_completed"
+	CheckoutExpired             = "payment.checkout_expired"
+	PaymentRefundRequested      = "payment.refund_requested"
+	PaymentRefunded             = "payment.refunded"
+	CouponCreated               = "coupon.created"
+	CouponUpdated               = "coupon.updated"
+	CouponDisabled              = "coupon.disabled"
+	CouponRedeemed              = "coupon.redeemed"
+	CouponReleased              = "coupon.released"
+	SystemCreated               = "system.created"
+	SystemUpdated               = "system.updated"
+	SystemDisabled              = "system.disabled"
+	ReportExported              = "report.exported"
+	ReportScheduleCreated       = "report.schedule_created"
+	ReportScheduleUpdated       = "report.schedule_updated"
+	ReportScheduleDeleted       = "report.schedule_deleted"
+	ReportSnapshotCreated       = "report.snapshot_created"
+)
+
+// Event is a domain event. Payload must be JSON serialisable so subscribers
+// can forward events to external systems unchanged.
+type Event struct {
+	ID         uuid.UUID              `json:"id"`
+	Type       string                 `json:"type"`
+	Namespace  string                 `json:"namespace,omitempty"`
+	ActorID    *uuid.UUID             `json:"actor_id,omitempty"`
+	OccurredAt time.Time              `json:"occurred_at"`
+	Payload    map[string]interface{} `json:"payload,omitempty"`
+}
+
+type Handler func(Event)
+
+type Bus interface {
+	Publish(event Event)
+	Subscribe(eventType string, handler Handler)
+}
+
+// InProcessBus delivers events synchronously to subscribers in the order they
+// subscribed. A panicking subscriber is logged and does not affect the
+// publisher or other subscribers.
+type InProcessBus struct {
+	mu       sync.RWMutex
+	handlers map[string][]Handler
+	log      *logrus.Logger
+}
+
+var _ Bus = (*InProcessBus)(nil)
+
+func NewInProcessBus(log *logrus.Logger) *InProcessBus {
+	return &InProcessBus{
+		handlers: make(map[string][]Handler),
+		log:      log,
+	}
+}
+
+// Subscribe registers handler for eventType; "*" receives every event.
+func (b *InProcessBus) Subscribe(eventType string, handler Handler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers[eventType] = append(b.handlers[eventType], handler)
+}
+
+func (b *InProcessBus) Publish(event Event) {
+	if event.ID == uuid.Nil {
+		event.ID = uuid.New()
+	}
+	if event.OccurredAt.IsZero() {
+		event.OccurredAt = time.Now().UTC()
+	}
+
+	b.mu.RLock()
+	handlers := append(append([]Handler{}, b.handlers[event.Type]...), b.handlers["*"]...)
+	b.mu.RUnlock()
+
+	b.log.WithFields(logrus.Fields{
+		"event":     event.Type,
+		"namespace": event.Namespace,
+	}).Info("Domain event published")
+
+	for _, handler := range handlers {
+		b.dispatch(handler, event)
+	}
+}
+
+func (b *InProcessBus) dispatch(handler Handler, event Event) {
+	defer func() {
+		if r := recover(); r != nil {
+			b.log.WithFields(logrus.Fields{
+				"event": event.Type,
+				"panic": r,
+			}).Error("Event subscriber panicked")
+		}
+	}()
+	handler(event)
+}
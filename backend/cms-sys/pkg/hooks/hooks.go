@@ -0,0 +1,71 @@
+// Package hooks posts signed JSON notifications to URLs configured by admins,
+// such as the provisioning hooks of catalog systems.
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/utils"
+)
+
+// SignatureHeader is the request header carrying the hook signature.
+const SignatureHeader = "CMS-Signature"
+
+// Sender posts hook calls. Receivers check the signature with the shared
+// secret before acting on a call.
+type Sender struct {
+	secret []byte
+	client *http.Client
+}
+
+func NewSender(secret []byte, timeout time.Duration) *Sender {
+	return &Sender{
+		secret: secret,
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+// Sign returns the signature header value for payload sent at t, in the form
+// "t=<unix seconds>,v1=<hex HMAC-SHA256 of "<t>.<payload>">". Without a
+// secret there is nothing to sign with and it returns "".
+func (s *Sender) Sign(payload []byte, t time.Time) string {
+	if len(s.secret) == 0 {
+		return ""
+	}
+	ts := strconv.FormatInt(t.Unix(), 10)
+	return "t=" + ts + ",v1=" + utils.HMACSign(s.secret, append([]byte(ts+"."), payload...))
+}
+
+// Post sends body as JSON to url. A status other than 2xx is an error.
+func (s *Sender) Post(ctx context.Context, url string, body interface{}) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if sig := s.Sign(payload, time.Now()); sig != "" {
+		req.Header.Set(SignatureHeader, sig)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	answer, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("hook %s answered %d: %s", url, resp.StatusCode, bytes.TrimSpace(answer))
+	}
+	return nil
+}
@@ -0,0 +1,310 @@
+package payments
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// FakeProvider is an in-memory gateway for development and tests. Checkout
+// sessions stay open until CompleteCheckout or ExpireCheckout is called,
+// which is what the Simulator does on behalf of a customer. A completed
+// checkout saves a payment method, so later off-session charges succeed
+// unless the customer is set to decline.
+type FakeProvider struct {
+	secret      []byte
+	checkoutURL string
+	sessionTTL  time.Duration
+	tolerance   time.Duration
+
+	mu        sync.Mutex
+	customers map[string]*fakeCustomer
+	sessions  map[string]*FakeSession
+	payments  map[string]*fakePayment
+	events    map[string]Event
+	onEvent   func(Event)
+}
+
+// FakeSession is the state of a checkout session held by the FakeProvider.
+type FakeSession struct {
+	ID          string    `json:"id"`
+	CustomerID  string    `json:"customer_id"`
+	Reference   string    `json:"reference"`
+	Description string    `json:"description"`
+	AmountCents int64     `json:"amount_cents"`
+	Currency    string    `json:"currency"`
+	Status      string    `json:"status"`
+	PaymentID   string    `json:"payment_id,omitempty"`
+	SuccessURL  string    `json:"success_url,omitempty"`
+	CancelURL   string    `json:"cancel_url,omitempty"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+const (
+	fakeSessionOpen     = "open"
+	fakeSessionComplete = "complete"
+	fakeSessionExpired  = "expired"
+)
+
+type fakeCustomer struct {
+	customer  Customer
+	hasMethod bool
+	declines  bool
+}
+
+type fakePayment struct {
+	payment  Payment
+	refunded int64
+}
+
+// NewFakeProvider signs webhooks with secret and hands out checkout URLs
+// below checkoutURL.
+func NewFakeProvider(secret, checkoutURL string, tolerance time.Duration) *FakeProvider {
+	return &FakeProvider{
+		secret:      []byte(secret),
+		checkoutURL: strings.TrimRight(checkoutURL, "/"),
+		sessionTTL:  24 * time.Hour,
+		tolerance:   tolerance,
+		customers:   make(map[string]*fakeCustomer),
+		sessions:    make(map[string]*FakeSession),
+		payments:    make(map[string]*fakePayment),
+		events:      make(map[string]Event),
+	}
+}
+
+func (p *FakeProvider) Name() string {
+	return "fake"
+}
+
+// OnEvent registers fn to receive the events the provider raises by itself,
+// such as refund confirmations.
+func (p *FakeProvider) OnEvent(fn func(Event)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.onEvent = fn
+}
+
+func (p *FakeProvider) CreateCustomer(_ context.Context, params CustomerParams) (*Customer, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	c := &fakeCustomer{customer: Customer{ID: fakeID("cus"), Email: params.Email}}
+	p.customers[c.customer.ID] = c
+	customer := c.customer
+	return &customer, nil
+}
+
+func (p *FakeProvider) CreateCheckoutSession(_ context.Context, params CheckoutParams) (*CheckoutSession, error) {
+	if params.AmountCents <= 0 {
+		return nil, errors.New("checkout amount must be positive")
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.customers[params.CustomerID]; !ok {
+		return nil, ErrNotFound
+	}
+
+	session := &FakeSession{
+		ID:          fakeID("cs"),
+		CustomerID:  params.CustomerID,
+		Reference:   params.Reference,
+		Description: params.Description,
+		AmountCents: params.AmountCents,
+		Currency:    params.Currency,
+		Status:      fakeSessionOpen,
+		SuccessURL:  params.SuccessURL,
+		CancelURL:   params.CancelURL,
+		ExpiresAt:   time.Now().Add(p.sessionTTL),
+	}
+	p.sessions[session.ID] = session
+	return &CheckoutSession{
+		ID:        session.ID,
+		URL:       p.checkoutURL + "/" + session.ID,
+		ExpiresAt: session.ExpiresAt,
+	}, nil
+}
+
+func (p *FakeProvider) Charge(_ context.Context, params ChargeParams) (*Payment, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	c, ok := p.customers[params.CustomerID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if !c.hasMethod {
+		return nil, ErrNoPaymentMethod
+	}
+	if c.declines {
+		return nil, ErrCardDeclined
+	}
+	payment := p.newPayment(params.CustomerID, params.AmountCents, params.Currency)
+	return &payment, nil
+}
+
+func (p *FakeProvider) Refund(_ context.Context, params RefundParams) (*Refund, error) {
+	p.mu.Lock()
+	pay, ok := p.payments[params.PaymentID]
+	if !ok {
+		p.mu.Unlock()
+		return nil, ErrNotFound
+	}
+	left := pay.payment.AmountCents - pay.refunded
+	amount := params.AmountCents
+	if amount == 0 {
+		amount = left
+	}
+	if amount <= 0 || amount > left {
+		p.mu.Unlock()
+		return nil, fmt.Errorf("refund of %d exceeds the %d left on the payment", amount, left)
+	}
+	pay.refunded += amount
+
+	refund := &Refund{ID: fakeID("re"), PaymentID: pay.payment.ID, AmountCents: amount}
+	event := p.newEvent(EventPaymentRefunded, EventData{
+		PaymentID:     pay.payment.ID,
+		CustomerID:    pay.payment.CustomerID,
+		AmountCents:   pay.payment.AmountCents,
+		RefundedCents: pay.refunded,
+		Currency:      pay.payment.Currency,
+	})
+	notify := p.onEvent
+	p.mu.Unlock()
+
+	if notify != nil {
+		notify(event)
+	}
+	return refund, nil
+}
+
+func (p *FakeProvider) ParseWebhook(payload []byte, signature string) (*Event, error) {
+	if err := Verify(p.secret, payload, signature, p.tolerance, time.Now()); err != nil {
+		return nil, err
+	}
+	var event Event
+	if err := json.Unmarshal(payload, &event); err != nil || event.ID == "" || event.Type == "" {
+		return nil, ErrInvalidEvent
+	}
+	return &event, nil
+}
+
+// Session returns a copy of a checkout session.
+func (p *FakeProvider) Session(id string) (*FakeSession, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	session, ok := p.sessions[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	copied := *session
+	return &copied, nil
+}
+
+// CompleteCheckout pays an open session as if the customer had entered a
+// working card, and returns the checkout.completed event to deliver.
+func (p *FakeProvider) CompleteCheckout(id string) (*Event, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	session, err := p.openSession(id)
+	if err != nil {
+		return nil, err
+	}
+	c := p.customers[session.CustomerID]
+	if c.declines {
+		return nil, ErrCardDeclined
+	}
+	c.hasMethod = true
+
+	payment := p.newPayment(session.CustomerID, session.AmountCents, session.Currency)
+	session.Status = fakeSessionComplete
+	session.PaymentID = payment.ID
+	event := p.newEvent(EventCheckoutCompleted, EventData{
+		SessionID:   session.ID,
+		PaymentID:   payment.ID,
+		CustomerID:  session.CustomerID,
+		Reference:   session.Reference,
+		AmountCents: payment.AmountCents,
+		Currency:    payment.Currency,
+	})
+	return &event, nil
+}
+
+// ExpireCheckout abandons an open session and returns the checkout.expired
+// event to deliver.
+func (p *FakeProvider) ExpireCheckout(id string) (*Event, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	session, err := p.openSession(id)
+	if err != nil {
+		return nil, err
+	}
+	session.Status = fakeSessionExpired
+	event := p.newEvent(EventCheckoutExpired, EventData{
+		SessionID:  session.ID,
+		CustomerID: session.CustomerID,
+		Reference:  session.Reference,
+	})
+	return &event, nil
+}
+
+// SetDeclining makes the customer's card decline, or work again.
+func (p *FakeProvider) SetDeclining(customerID string, declines bool) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	c, ok := p.customers[customerID]
+	if !ok {
+		return ErrNotFound
+	}
+	c.declines = declines
+	return nil
+}
+
+// Event returns an event raised earlier, for redelivery.
+func (p *FakeProvider) Event(id string) (*Event, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	event, ok := p.events[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &event, nil
+}
+
+// Signature signs payload with the provider's webhook secret.
+func (p *FakeProvider) Signature(payload []byte, t time.Time) string {
+	return Sign(p.secret, payload, t)
+}
+
+func (p *FakeProvider) openSession(id string) (*FakeSession, error) {
+	session, ok := p.sessions[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if session.Status == fakeSessionOpen && time.Now().After(session.ExpiresAt) {
+		session.Status = fakeSessionExpired
+	}
+	if session.Status != fakeSessionOpen {
+		return nil, fmt.Errorf("checkout session is %s", session.Status)
+	}
+	return session, nil
+}
+
+func (p *FakeProvider) newPayment(customerID string, amount int64, currency string) Payment {
+	payment := Payment{ID: fakeID("pay"), CustomerID: customerID, AmountCents: amount, Currency: currency}
+	p.payments[payment.ID] = &fakePayment{payment: payment}
+	return payment
+}
+
+func (p *FakeProvider) newEvent(eventType EventType, data EventData) Event {
+	event := Event{ID: fakeID("evt"), Type: eventType, Created: time.Now().UTC(), Data: data}
+	p.events[event.ID] = event
+	return event
+}
+
+func fakeID(prefix string) string {
+	return prefix + "_fake_" + strings.ReplaceAll(uuid.NewString(), "-", "")
+}
@@ -0,0 +1,125 @@
+// Package payments abstracts the payment gateway: customer records, hosted
+// checkout sessions, off-session charges, refunds and the signed webhooks the
+// gateway sends back.
+package payments
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	ErrInvalidEvent     = errors.New("invalid webhook event")
+	ErrCardDeclined     = errors.New("card declined")
+	ErrNoPaymentMethod  = errors.New("customer has no payment method on file")
+	ErrNotFound         = errors.New("payment object not found")
+)
+
+// PaymentProvider is a payment gateway. Implementations must be safe for
+// concurrent use.
+type PaymentProvider interface {
+	// Name identifies the provider in stored records, e.g. "fake".
+	Name() string
+	CreateCustomer(ctx context.Context, params CustomerParams) (*Customer, error)
+	// CreateCheckoutSession starts a hosted payment page. The outcome
+	// arrives later as a checkout.completed or checkout.expired event.
+	CreateCheckoutSession(ctx context.Context, params CheckoutParams) (*CheckoutSession, error)
+	// Charge collects a payment off-session from the customer's saved
+	// payment method and reports the result synchronously.
+	Charge(ctx context.Context, params ChargeParams) (*Payment, error)
+	// Refund returns money for a payment. The refund is confirmed by a
+	// payment.refunded event.
+	Refund(ctx context.Context, params RefundParams) (*Refund, error)
+	// ParseWebhook verifies the signature of a webhook request and decodes
+	// its event.
+	ParseWebhook(payload []byte, signature string) (*Event, error)
+}
+
+type CustomerParams struct {
+	Email string
+	Name  string
+	// Reference is our ID for the customer.
+	Reference string
+}
+
+type Customer struct {
+	ID    string `json:"id"`
+	Email string `json:"email"`
+}
+
+type CheckoutParams struct {
+	CustomerID  string
+	Reference   string
+	Description string
+	AmountCents int64
+	Currency    string
+	SuccessURL  string
+	CancelURL   string
+}
+
+type CheckoutSession struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type ChargeParams struct {
+	CustomerID  string
+	Reference   string
+	Description string
+	AmountCents int64
+	Currency    string
+}
+
+type Payment struct {
+	ID          string `json:"id"`
+	CustomerID  string `json:"customer_id"`
+	AmountCents int64  `json:"amount_cents"`
+	Currency    string `json:"currency"`
+}
+
+type RefundParams struct {
+	PaymentID string
+	// AmountCents is the amount to refund; zero refunds what is left.
+	AmountCents int64
+	Reason      string
+}
+
+type Refund struct {
+	ID          string `json:"id"`
+	PaymentID   string `json:"payment_id"`
+	AmountCents int64  `json:"amount_cents"`
+}
+
+type EventType string
+
+const (
+	EventCheckoutCompleted EventType = "checkout.completed"
+	EventCheckoutExpired   EventType = "checkout.expired"
+	EventPaymentRefunded   EventType = "payment.refunded"
+)
+
+// Event is a webhook notification. IDs are unique per provider, and a
+// provider may deliver the same event more than once.
+type Event struct {
+	ID      string    `json:"id"`
+	Type    EventType `json:"type"`
+	Created time.Time `json:"created"`
+	Data    EventData `json:"data"`
+}
+
+// EventData carries the object the event is about; which fields are set
+// depends on the event type.
+type EventData struct {
+	SessionID  string `json:"session_id,omitempty"`
+	PaymentID  string `json:"payment_id,omitempty"`
+	CustomerID string `json:"customer_id,omitempty"`
+	Reference  string `json:"reference,omitempty"`
+	// AmountCents is the payment amount; RefundedCents the total refunded
+	// so far, so replaying an older refund event never lowers it.
+	AmountCents   int64  `json:"amount_cents,omitempty"`
+	RefundedCents int64  `json:"refunded_cents,omitempty"`
+	Currency      string `json:"currency,omitempty"`
+}
@@ -0,0 +1,65 @@
+package payments
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/utils"
+)
+
+// SignatureHeader is the request header carrying the webhook signature.
+const SignatureHeader = "Payment-Signature"
+
+// Sign returns the signature header value for payload sent at t, in the form
+// "t=<unix seconds>,v1=<hex HMAC-SHA256 of "<t>.<payload>">".
+func Sign(secret, payload []byte, t time.Time) string {
+	ts := strconv.FormatInt(t.Unix(), 10)
+	return "t=" + ts + ",v1=" + utils.HMACSign(secret, signed(ts, payload))
+}
+
+// Verify checks a signature header produced by Sign. Signatures older or
+// newer than tolerance are refused so a captured request cannot be replayed
+// later; a zero tolerance disables the check. Several v1 entries are allowed
+// so the secret can be rotated.
+func Verify(secret, payload []byte, header string, tolerance time.Duration, now time.Time) error {
+	var ts string
+	var sigs []string
+	for _, part := range strings.Split(header, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "t":
+			ts = value
+		case "v1":
+			sigs = append(sigs, value)
+		}
+	}
+	if ts == "" || len(sigs) == 0 || len(secret) == 0 {
+		return ErrInvalidSignature
+	}
+
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	if tolerance > 0 {
+		age := now.Sub(time.Unix(unix, 0))
+		if age > tolerance || age < -tolerance {
+			return ErrInvalidSignature
+		}
+	}
+
+	for _, sig := range sigs {
+		if utils.HMACVerify(secret, signed(ts, payload), sig) {
+			return nil
+		}
+	}
+	return ErrInvalidSignature
+}
+
+func signed(ts string, payload []byte) []byte {
+	return append([]byte(ts+"."), payload...)
+}
@@ -0,0 +1,54 @@
+package payments
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/multi-tenants-cms-golang/cms-sys/pkg/utils"
+)
+
+func TestVerify(t *testing.T) {
+	secret := []byte("whsec_test")
+	payload := []byte(`{"id":"evt_1","type":"checkout.completed"}`)
+	sent := time.Unix(1700000000, 0)
+	valid := Sign(secret, payload, sent)
+	ts := "t=1700000000"
+	sig := func(secret []byte) string {
+		return "v1=" + utils.HMACSign(secret, []byte("1700000000."+string(payload)))
+	}
+	if valid != ts+","+sig(secret) {
+		t.Fatalf("Sign = %q, want %q", valid, ts+","+sig(secret))
+	}
+
+	cases := []struct {
+		name      string
+		secret    []byte
+		payload   []byte
+		header    string
+		tolerance time.Duration
+		now       time.Time
+		ok        bool
+	}{
+		{"valid", secret, payload, valid, 5 * time.Minute, sent.Add(time.Minute), true},
+		{"tampered payload", secret, []byte(`{"id":"evt_2","type":"checkout.completed"}`), valid, 5 * time.Minute, sent, false},
+		{"other secret", []byte("whsec_other"), payload, valid, 5 * time.Minute, sent, false},
+		{"too old", secret, payload, valid, 5 * time.Minute, sent.Add(6 * time.Minute), false},
+		{"from the future", secret, payload, valid, 5 * time.Minute, sent.Add(-6 * time.Minute), false},
+		{"no tolerance accepts any age", secret, payload, valid, 0, sent.Add(24 * time.Hour), true},
+		{"rotated secret", secret, payload, ts + "," + sig([]byte("whsec_old")) + "," + sig(secret), 5 * time.Minute, sent, true},
+		{"missing timestamp", secret, payload, sig(secret), 5 * time.Minute, sent, false},
+		{"missing signature", secret, payload, ts, 5 * time.Minute, sent, false},
+		{"malformed timestamp", secret, payload, "t=soon," + sig(secret), 0, sent, false},
+		{"empty secret", nil, payload, valid, 5 * time.Minute, sent, false},
+	}
+	for _, tc := range cases {
+		err := Verify(tc.secret, tc.payload, tc.header, tc.tolerance, tc.now)
+		if tc.ok && err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+		}
+		if !tc.ok && !errors.Is(err, ErrInvalidSignature) {
+			t.Errorf("%s: err = %v, want ErrInvalidSignature", tc.name, err)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package payments
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// webhookReceiver stands in for the server's webhook endpoint: it verifies
+// each delivery with the provider and keeps the events it accepted.
+type webhookReceiver struct {
+	provider *FakeProvider
+
+	mu       sync.Mutex
+	events   []Event
+	failNext bool
+	received chan Event
+}
+
+func (r *webhookReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	payload, _ := io.ReadAll(req.Body)
+	event, err := r.provider.ParseWebhook(payload, req.Header.Get(SignatureHeader))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	r.mu.Lock()
+	fail := r.failNext
+	r.failNext = false
+	if !fail {
+		r.events = append(r.events, *event)
+	}
+	r.mu.Unlock()
+	if fail {
+		http.Error(w, "try again", http.StatusInternalServerError)
+		return
+	}
+	r.received <- *event
+	w.WriteHeader(http.StatusOK)
+}
+
+func (r *webhookReceiver) next(t *testing.T) Event {
+	t.Helper()
+	select {
+	case event := <-r.received:
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatal("no webhook delivered")
+		return Event{}
+	}
+}
+
+func newTestSimulator(t *testing.T) (*FakeProvider, *Simulator, *webhookReceiver) {
+	t.Helper()
+	provider := NewFakeProvider("whsec_test", "http://checkout.test/", time.Minute)
+	receiver := &webhookReceiver{provider: provider, received: make(chan Event, 8)}
+	server := httptest.NewServer(receiver)
+	t.Cleanup(server.Close)
+
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+	return provider, NewSimulator(log, provider, server.URL), receiver
+}
+
+func openSession(t *testing.T, provider *FakeProvider, customerID, reference string) *CheckoutSession {
+	t.Helper()
+	session, err := provider.CreateCheckoutSession(context.Background(), CheckoutParams{
+		CustomerID:  customerID,
+		Reference:   reference,
+		AmountCents: 1500,
+		Currency:    "usd",
+	})
+	if err != nil {
+		t.Fatalf("create session: %v", err)
+	}
+	return session
+}
+
+func TestSimulatorCheckoutLifecycle(t *testing.T) {
+	provider, sim, receiver := newTestSimulator(t)
+	ctx := context.Background()
+
+	customer, err := provider.CreateCustomer(ctx, CustomerParams{Email: "a@example.com"})
+	if err != nil {
+		t.Fatalf("create customer: %v", err)
+	}
+	if _, err := provider.Charge(ctx, ChargeParams{CustomerID: customer.ID, AmountCents: 100}); !errors.Is(err, ErrNoPaymentMethod) {
+		t.Fatalf("charge before checkout: err = %v, want ErrNoPaymentMethod", err)
+	}
+
+	paid := openSession(t, provider, customer.ID, "checkout-1")
+	if paid.URL != "http://checkout.test/"+paid.ID {
+		t.Fatalf("session URL = %q", paid.URL)
+	}
+	event, status, err := sim.Complete(ctx, paid.ID)
+	if err != nil || status != http.StatusOK {
+		t.Fatalf("complete: status %d, %v", status, err)
+	}
+	got := receiver.next(t)
+	if got.ID != event.ID || got.Type != EventCheckoutCompleted || got.Data.Reference != "checkout-1" ||
+		got.Data.AmountCents != 1500 || got.Data.PaymentID == "" {
+		t.Fatalf("delivered %+v", got)
+	}
+	session, _ := provider.Session(paid.ID)
+	if session.Status != fakeSessionComplete || session.PaymentID != got.Data.PaymentID {
+		t.Fatalf("completed session is %+v", session)
+	}
+
+	// A settled session cannot change again.
+	if _, _, err := sim.Complete(ctx, paid.ID); err == nil {
+		t.Fatal("completed a session twice")
+	}
+	if _, _, err := sim.Expire(ctx, paid.ID); err == nil {
+		t.Fatal("expired a completed session")
+	}
+
+	// Completing saved a card, so renewals charge until it declines.
+	if _, err := provider.Charge(ctx, ChargeParams{CustomerID: customer.ID, AmountCents: 1500}); err != nil {
+		t.Fatalf("renewal charge: %v", err)
+	}
+	if err := provider.SetDeclining(customer.ID, true); err != nil {
+		t.Fatalf("decline: %v", err)
+	}
+	if _, err := provider.Charge(ctx, ChargeParams{CustomerID: customer.ID, AmountCents: 1500}); !errors.Is(err, ErrCardDeclined) {
+		t.Fatalf("declining charge: err = %v, want ErrCardDeclined", err)
+	}
+	declined := openSession(t, provider, customer.ID, "checkout-2")
+	if _, _, err := sim.Complete(ctx, declined.ID); !errors.Is(err, ErrCardDeclined) {
+		t.Fatalf("declining checkout: err = %v, want ErrCardDeclined", err)
+	}
+	_ = provider.SetDeclining(customer.ID, false)
+
+	if _, status, err := sim.Expire(ctx, declined.ID); err != nil || status != http.StatusOK {
+		t.Fatalf("expire: status %d, %v", status, err)
+	}
+	if got := receiver.next(t); got.Type != EventCheckoutExpired || got.Data.SessionID != declined.ID {
+		t.Fatalf("delivered %+v", got)
+	}
+
+	// Gateways may deliver an event again; it keeps its ID.
+	if _, _, err := sim.Replay(ctx, event.ID); err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	if got := receiver.next(t); got.ID != event.ID || got.Type != EventCheckoutCompleted {
+		t.Fatalf("replayed %+v", got)
+	}
+
+	// Refunds are confirmed in the background with the running total.
+	if _, err := provider.Refund(ctx, RefundParams{PaymentID: got.Data.PaymentID, AmountCents: 500}); err != nil {
+		t.Fatalf("refund: %v", err)
+	}
+	if got := receiver.next(t); got.Type != EventPaymentRefunded || got.Data.RefundedCents != 500 {
+		t.Fatalf("refund delivered %+v", got)
+	}
+	if _, err := provider.Refund(ctx, RefundParams{PaymentID: got.Data.PaymentID, AmountCents: 1001}); err == nil {
+		t.Fatal("refunded more than was left")
+	}
+}
+
+func TestSimulatorSessionTimesOut(t *testing.T) {
+	provider, sim, _ := newTestSimulator(t)
+	provider.sessionTTL = -time.Second
+	customer, _ := provider.CreateCustomer(context.Background(), CustomerParams{Email: "a@example.com"})
+	session := openSession(t, provider, customer.ID, "checkout-1")
+
+	if _, _, err := sim.Complete(context.Background(), session.ID); err == nil {
+		t.Fatal("completed a session past its expiry")
+	}
+	if got, _ := provider.Session(session.ID); got.Status != fakeSessionExpired {
+		t.Fatalf("session status = %s, want expired", got.Status)
+	}
+}
+
+func TestSimulatorDeliveryErrors(t *testing.T) {
+	provider, sim, receiver := newTestSimulator(t)
+	customer, _ := provider.CreateCustomer(context.Background(), CustomerParams{Email: "a@example.com"})
+	session := openSession(t, provider, customer.ID, "checkout-1")
+
+	receiver.failNext = true
+	event, status, err := sim.Complete(context.Background(), session.ID)
+	if err == nil || status != http.StatusInternalServerError {
+		t.Fatalf("failing endpoint: status %d, err %v", status, err)
+	}
+	// The gateway retries what the endpoint did not take.
+	if _, status, err := sim.Replay(context.Background(), event.ID); err != nil || status != http.StatusOK {
+		t.Fatalf("retry: status %d, %v", status, err)
+	}
+	if got := receiver.next(t); got.ID != event.ID {
+		t.Fatalf("retried %+v", got)
+	}
+
+	// Deliveries signed with another secret are refused.
+	other := NewSimulator(logrus.New(), NewFakeProvider("whsec_other", "", time.Minute), sim.endpoint)
+	if status, err := other.Deliver(context.Background(), event); err == nil || status != http.StatusBadRequest {
+		t.Fatalf("foreign signature: status %d, err %v", status, err)
+	}
+	if _, err := provider.ParseWebhook([]byte(`{"id":""}`), provider.Signature([]byte(`{"id":""}`), time.Now())); !errors.Is(err, ErrInvalidEvent) {
+		t.Fatalf("signed but empty event: err = %v, want ErrInvalidEvent", err)
+	}
+}
@@ -0,0 +1,115 @@
+// Package pdfdraw holds the drawing helpers behind generated documents. They
+// follow the certificate layout in components-learning/certificate_signing, a
+// separate module that keeps its own copy, so invoices and certificates share
+// one look; coordinates are derived from the page size instead of assuming
+// landscape A4.
+package pdfdraw
+
+import (
+	"github.com/jung-kurt/gofpdf"
+)
+
+// Brand is the name and accent colour printed on every document.
+type Brand struct {
+	Name  string
+	Color [3]int
+}
+
+// DefaultColor is the certificate blue.
+var DefaultColor = [3]int{66, 103, 178}
+
+func NewBrand(name string) Brand {
+	return Brand{Name: name, Color: DefaultColor}
+}
+
+// New starts an A4 document in millimetres with one page.
+func New(orientation string) *gofpdf.Fpdf {
+	pdf := gofpdf.New(orientation, "mm", "A4", "")
+	pdf.SetMargins(25, 25, 25)
+	pdf.SetAutoPageBreak(true, 30)
+	pdf.AddPage()
+	return pdf
+}
+
+// DrawMainBorder draws the heavy outer frame, the light inner frame and the
+// corner flourishes.
+func DrawMainBorder(pdf *gofpdf.Fpdf, brand Brand) {
+	w, h := pdf.GetPageSize()
+
+	setDraw(pdf, brand.Color)
+	pdf.SetLineWidth(3)
+	pdf.Rect(10, 10, w-20, h-20, "D")
+
+	pdf.SetDrawColor(220, 230, 240)
+	pdf.SetLineWidth(1)
+	pdf.Rect(17, 17, w-34, h-34, "D")
+
+	drawCornerFlourishes(pdf, brand, w, h)
+}
+
+func drawCornerFlourishes(pdf *gofpdf.Fpdf, brand Brand, w, h float64) {
+	setDraw(pdf, brand.Color)
+	pdf.SetLineWidth(2)
+
+	// top-left
+	pdf.Line(17, 27, 37, 27)
+	pdf.Line(27, 17, 27, 37)
+
+	// top-right
+	pdf.Line(w-37, 27, w-17, 27)
+	pdf.Line(w-27, 17, w-27, 37)
+
+	// bottom-left
+	pdf.Line(17, h-27, 37, h-27)
+	pdf.Line(27, h-37, 27, h-17)
+
+	// bottom-right
+	pdf.Line(w-37, h-27, w-17, h-27)
+	pdf.Line(w-27, h-37, w-27, h-17)
+}
+
+// DrawHeader prints the brand name in a filled band with a rule running to
+// the right edge.
+func DrawHeader(pdf *gofpdf.Fpdf, brand Brand) {
+	w, _ := pdf.GetPageSize()
+
+	setFill(pdf, brand.Color)
+	pdf.Rect(40, 30, 60, 16, "F")
+
+	pdf.SetFont("Arial", "B", 13)
+	pdf.SetTextColor(255, 255, 255)
+	pdf.SetXY(40, 34)
+	Text(pdf, 60, 8, brand.Name, "", 0, "C")
+
+	setDraw(pdf, brand.Color)
+	pdf.SetLineWidth(2)
+	pdf.Line(108, 38, w-40, 38)
+	pdf.SetTextColor(45, 45, 45)
+}
+
+// DrawTitle prints a centred title at y.
+func DrawTitle(pdf *gofpdf.Fpdf, title string, y float64) {
+	pdf.SetFont("Arial", "B", 26)
+	pdf.SetTextColor(45, 45, 45)
+	pdf.SetY(y)
+	pdf.CellFormat(0, 14, title, "", 1, "C", false, 0, "")
+}
+
+// Text prints s in the current font, translating UTF-8 to the core fonts'
+// code page so accented names survive.
+func Text(pdf *gofpdf.Fpdf, w, h float64, s, border string, ln int, align string) {
+	pdf.CellFormat(w, h, pdf.UnicodeTranslatorFromDescriptor("")(s), border, ln, align, false, 0, "")
+}
+
+func setDraw(pdf *gofpdf.Fpdf, c [3]int) {
+	pdf.SetDrawColor(c[0], c[1], c[2])
+}
+
+func setFill(pdf *gofpdf.Fpdf, c [3]int) {
+	pdf.SetFillColor(c[0], c[1], c[2])
+}
+
+// SetAccent switches text to the brand colour.
+func SetAccent(pdf *gofpdf.Fpdf, brand Brand) {
+	pdf.SetTextColor(brand.Color[0], brand.Color[1], brand.Color[2])
+}
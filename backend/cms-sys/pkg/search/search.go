@@ -0,0 +1,59 @@
+package search
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Indexer owns the search indices built for tenants.
+type Indexer interface {
+	DeleteTenantIndices(ctx context.Context, namespace string) ([]string, error)
+}
+
+// NoopIndexer is used when no search backend is configured.
+type NoopIndexer struct{}
+
+func (NoopIndexer) DeleteTenantIndices(context.Context, string) ([]string, error) {
+	return nil, nil
+}
+
+// ElasticIndexer removes the per-tenant index "<prefix><namespace>" from an
+// Elasticsearch cluster.
+type ElasticIndexer struct {
+	baseURL string
+	prefix  string
+	client  *http.Client
+}
+
+func NewElasticIndexer(baseURL, prefix string) *ElasticIndexer {
+	return &ElasticIndexer{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		prefix:  prefix,
+		client:  &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (e *ElasticIndexer) DeleteTenantIndices(ctx context.Context, namespace string) ([]string, error) {
+	index := e.prefix + namespace
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, e.baseURL+"/"+index, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, nil
+	case resp.StatusCode >= 300:
+		return nil, fmt.Errorf("deleting index %s: unexpected status %d", index, resp.StatusCode)
+	}
+	return []string{index}, nil
+}
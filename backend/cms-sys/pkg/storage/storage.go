@@ -0,0 +1,112 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var ErrInvalidPath = errors.New("invalid tenant file path")
+
+type Usage struct {
+	Files int   `json:"files"`
+	Bytes int64 `json:"bytes"`
+}
+
+// TenantFiles stores files uploaded on behalf of a tenant. Paths are always
+// relative to the tenant's own area and use forward slashes.
+type TenantFiles interface {
+	Walk(namespace string, fn func(rel string, size int64) error) error
+	Open(namespace, rel string) (io.ReadCloser, error)
+	Create(namespace, rel string) (io.WriteCloser, error)
+	Usage(namespace string) (Usage, error)
+	RemoveAll(namespace string) (Usage, error)
+}
+
+type LocalStore struct {
+	root string
+}
+
+var _ TenantFiles = (*LocalStore)(nil)
+
+func NewLocalStore(root string) *LocalStore {
+	return &LocalStore{root: root}
+}
+
+func (s *LocalStore) Walk(namespace string, fn func(rel string, size int64) error) error {
+	base := s.tenantRoot(namespace)
+	err := filepath.WalkDir(base, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(base, path)
+		if err != nil {
+			return err
+		}
+		return fn(filepath.ToSlash(rel), info.Size())
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (s *LocalStore) Open(namespace, rel string) (io.ReadCloser, error) {
+	path, err := s.resolve(namespace, rel)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(path)
+}
+
+func (s *LocalStore) Create(namespace, rel string) (io.WriteCloser, error) {
+	path, err := s.resolve(namespace, rel)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return nil, err
+	}
+	return os.Create(path)
+}
+
+func (s *LocalStore) Usage(namespace string) (Usage, error) {
+	var usage Usage
+	err := s.Walk(namespace, func(_ string, size int64) error {
+		usage.Files++
+		usage.Bytes += size
+		return nil
+	})
+	return usage, err
+}
+
+func (s *LocalStore) RemoveAll(namespace string) (Usage, error) {
+	usage, err := s.Usage(namespace)
+	if err != nil {
+		return usage, err
+	}
+	return usage, os.RemoveAll(s.tenantRoot(namespace))
+}
+
+func (s *LocalStore) tenantRoot(namespace string) string {
+	return filepath.Join(s.root, namespace)
+}
+
+// resolve keeps rel inside the tenant's directory.
+func (s *LocalStore) resolve(namespace, rel string) (string, error) {
+	clean := filepath.Clean(filepath.FromSlash(rel))
+	if clean == "." || filepath.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return "", ErrInvalidPath
+	}
+	return filepath.Join(s.tenantRoot(namespace), clean), nil
+}
@@ -0,0 +1,201 @@
+// Package tabular writes rows of a report as CSV, XLSX or NDJSON, one row at a
+// time, so exports of any size stream in constant memory.
+package tabular
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Format string
+
+const (
+	CSV    Format = "csv"
+	XLSX   Format = "xlsx"
+	NDJSON Format = "ndjson"
+)
+
+var ErrUnknownFormat = errors.New("unknown export format")
+
+// ParseFormat accepts csv, xlsx and ndjson in any case.
+func ParseFormat(raw string) (Format, error) {
+	switch format := Format(strings.ToLower(strings.TrimSpace(raw))); format {
+	case CSV, XLSX, NDJSON:
+		return format, nil
+	}
+	return "", ErrUnknownFormat
+}
+
+func (f Format) ContentType() string {
+	switch f {
+	case CSV:
+		return "text/csv; charset=utf-8"
+	case XLSX:
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	default:
+		return "application/x-ndjson"
+	}
+}
+
+func (f Format) Extension() string {
+	return "." + string(f)
+}
+
+// Writer takes the rows of one table. Values may be nil, strings, booleans,
+// integers, floats, times, pointers to any of those or fmt.Stringers. Close
+// finishes the file but leaves the underlying writer open.
+type Writer interface {
+	Write(values []interface{}) error
+	Close() error
+}
+
+// NewWriter starts a table with the given columns. CSV and XLSX get a header
+// row; NDJSON uses the columns as keys.
+func NewWriter(format Format, w io.Writer, columns []string) (Writer, error) {
+	switch format {
+	case CSV:
+		return newCSVWriter(w, columns)
+	case XLSX:
+		return newXLSXWriter(w, columns)
+	case NDJSON:
+		return newNDJSONWriter(w, columns), nil
+	}
+	return nil, ErrUnknownFormat
+}
+
+type csvWriter struct {
+	w *csv.Writer
+}
+
+func newCSVWriter(w io.Writer, columns []string) (*csvWriter, error) {
+	cw := &csvWriter{w: csv.NewWriter(w)}
+	if err := cw.w.Write(columns); err != nil {
+		return nil, err
+	}
+	return cw, nil
+}
+
+func (w *csvWriter) Write(values []interface{}) error {
+	record := make([]string, len(values))
+	for i, value := range values {
+		record[i] = defuse(text(Normalize(value)))
+	}
+	return w.w.Write(record)
+}
+
+func (w *csvWriter) Close() error {
+	w.w.Flush()
+	return w.w.Error()
+}
+
+// defuse keeps spreadsheets from evaluating text that looks like a formula.
+func defuse(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+type ndjsonWriter struct {
+	w    *bufio.Writer
+	keys [][]byte
+}
+
+func newNDJSONWriter(w io.Writer, columns []string) *ndjsonWriter {
+	keys := make([][]byte, len(columns))
+	for i, column := range columns {
+		keys[i], _ = json.Marshal(column)
+	}
+	return &ndjsonWriter{w: bufio.NewWriter(w), keys: keys}
+}
+
+// Write emits one object with the keys in column order.
+func (w *ndjsonWriter) Write(values []interface{}) error {
+	if len(values) != len(w.keys) {
+		return fmt.Errorf("row has %d values for %d columns", len(values), len(w.keys))
+	}
+	w.w.WriteByte('{')
+	for i, value := range values {
+		if i > 0 {
+			w.w.WriteByte(',')
+		}
+		encoded, err := json.Marshal(Normalize(value))
+		if err != nil {
+			return err
+		}
+		w.w.Write(w.keys[i])
+		w.w.WriteByte(':')
+		w.w.Write(encoded)
+	}
+	w.w.WriteString("}\n")
+	return nil
+}
+
+func (w *ndjsonWriter) Close() error {
+	return w.w.Flush()
+}
+
+// Normalize reduces a value to nil, string, bool, int64, float64 or UTC
+// time.Time, the types every format writes.
+func Normalize(value interface{}) interface{} {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case string:
+		return v
+	case *string:
+		if v == nil {
+			return nil
+		}
+		return *v
+	case bool:
+		return v
+	case int:
+		return int64(v)
+	case int32:
+		return int64(v)
+	case int64:
+		return v
+	case float64:
+		return v
+	case time.Time:
+		if v.IsZero() {
+			return nil
+		}
+		return v.UTC()
+	case *time.Time:
+		if v == nil {
+			return nil
+		}
+		return Normalize(*v)
+	case fmt.Stringer:
+		return v.String()
+	}
+	return fmt.Sprint(value)
+}
+
+// text renders a normalized value for formats without types.
+func text(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case bool:
+		return strconv.FormatBool(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case time.Time:
+		return v.Format(time.RFC3339)
+	}
+	return fmt.Sprint(value)
+}
@@ -0,0 +1,28 @@
+package utils
+
+import (
+	"context"
+	"sync"
+)
+
+// RunBounded calls fn for every index in [0, n) with at most limit calls in
+// flight and waits for all of them. Indices not yet started when ctx is done
+// are still passed to fn so callers can record the cancellation.
+func RunBounded(ctx context.Context, n, limit int, fn func(ctx context.Context, i int)) {
+	if limit <= 0 {
+		limit = 1
+	}
+
+	sem := make(chan struct{}, limit)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			fn(ctx, i)
+		}(i)
+	}
+	wg.Wait()
+}
@@ -192,3 +192,21 @@ func GetDefaultDatabaseConfig() DatabaseConfig {
 		LogLevel:        logger.Info,
 	}
 }
+
+func LoadDatabaseConfig() DatabaseConfig {
+	return DatabaseConfig{
+		Host:            GetEnv("DB_HOST", "localhost"),
+		Port:            GetEnvAsInt("DB_PORT", 5432),
+		User:            GetEnv("DB_USER", "postgres"),
+		Password:        GetEnv("DB_PASSWORD", "Swanhtet12@"),
+		DBName:          GetEnv("DB_NAME", "cms_db"),
+		SSLMode:         GetEnv("DB_SSL_MODE", "disable"),
+		MaxOpenConns:    GetEnvAsInt("DB_MAX_OPEN_CONNS", 25),
+		MaxIdleConns:    GetEnvAsInt("DB_MAX_IDLE_CONNS", 10),
+		ConnMaxLifetime: GetEnvAsDuration("DB_CONN_MAX_LIFETIME", 5*time.Minute),
+		ConnMaxIdleTime: GetEnvAsDuration("DB_CONN_MAX_IDLE_TIME", 2*time.Minute),
+		RetryAttempts:   GetEnvAsInt("DB_RETRY_ATTEMPTS", 5),
+		RetryDelay:      GetEnvAsDuration("DB_RETRY_DELAY", 2*time.Second),
+		LogLevel:        logger.Info,
+	}
+}
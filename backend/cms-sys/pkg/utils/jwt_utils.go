@@ -23,7 +23,11 @@ type Claims struct {
 	UserID    uuid.UUID `json:"user_id"`
 	Email     string    `json:"email"`
 	Role      string    `json:"role"`
-	TokenType string    `json:"token_type"`
+	Namespace string    `json:"namespace,omitempty"`
+	// Systems are the systems the user was entitled to when the access
+	// token was issued.
+	Systems   []string `json:"systems,omitempty"`
+	TokenType string   `json:"token_type"`
 	jwt.RegisteredClaims
 }
 
@@ -78,11 +82,13 @@ func InitJWTKeysFromVault() error {
 	return nil
 }
 
-func GenerateAccessToken(userID uuid.UUID, email, role string) (string, error) {
+func GenerateAccessToken(userID uuid.UUID, email, role, namespace string, systems []string) (string, error) {
 	claims := &Claims{
 		UserID:    userID,
 		Email:     email,
 		Role:      role,
+		Namespace: namespace,
+		Systems:   systems,
 		TokenType: "access",
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(15 * time.Minute)),
@@ -95,11 +101,12 @@ func GenerateAccessToken(userID uuid.UUID, email, role string) (string, error) {
 	return token.SignedString(jwtSecret)
 }
 
-func GenerateRefreshToken(userID uuid.UUID, email, role string) (string, error) {
+func GenerateRefreshToken(userID uuid.UUID, email, role, namespace string) (string, error) {
 	claims := &Claims{
 		UserID:    userID,
 		Email:     email,
 		Role:      role,
+		Namespace: namespace,
 		TokenType: "refresh",
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(7 * 24 * time.Hour)),
@@ -42,6 +42,14 @@ func CreatedResponse(c *fiber.Ctx, message string, data interface{}) error {
 	})
 }
 
+func AcceptedResponse(c *fiber.Ctx, message string, data interface{}) error {
+	return c.Status(http.StatusAccepted).JSON(Response{
+		Success: true,
+		Message: message,
+		Data:    data,
+	})
+}
+
 func BadRequestResponse(c *fiber.Ctx, message string, err interface{}) error {
 	return c.Status(http.StatusBadRequest).JSON(Response{
 		Success: false,
@@ -57,6 +65,14 @@ func UnauthorizedResponse(c *fiber.Ctx, message string) error {
 	})
 }
 
+func PaymentRequiredResponse(c *fiber.Ctx, message string, err interface{}) error {
+	return c.Status(http.StatusPaymentRequired).JSON(Response{
+		Success: false,
+		Message: message,
+		Error:   err,
+	})
+}
+
 func ForbiddenResponse(c *fiber.Ctx, message string) error {
 	return c.Status(http.StatusForbidden).JSON(Response{
 		Success: false,
@@ -64,6 +80,16 @@ func ForbiddenResponse(c *fiber.Ctx, message string) error {
 	})
 }
 
+// ForbiddenErrorResponse is ForbiddenResponse with details on why access was
+// refused.
+func ForbiddenErrorResponse(c *fiber.Ctx, message string, err interface{}) error {
+	return c.Status(http.StatusForbidden).JSON(Response{
+		Success: false,
+		Message: message,
+		Error:   err,
+	})
+}
+
 func NotFoundResponse(c *fiber.Ctx, message string) error {
 	return c.Status(http.StatusNotFound).JSON(Response{
 		Success: false,
@@ -79,6 +105,14 @@ func ConflictResponse(c *fiber.Ctx, message string, err interface{}) error {
 	})
 }
 
+func TooManyRequestsResponse(c *fiber.Ctx, message string, err interface{}) error {
+	return c.Status(http.StatusTooManyRequests).JSON(Response{
+		Success: false,
+		Message: message,
+		Error:   err,
+	})
+}
+
 func InternalServerErrorResponse(c *fiber.Ctx, message string, err interface{}) error {
 	return c.Status(http.StatusInternalServerError).JSON(Response{
 		Success: false,
@@ -87,6 +121,21 @@ func InternalServerErrorResponse(c *fiber.Ctx, message string, err interface{})
 	})
 }
 
+func BadGatewayResponse(c *fiber.Ctx, message string, err interface{}) error {
+	return c.Status(http.StatusBadGateway).JSON(Response{
+		Success: false,
+		Message: message,
+		Error:   err,
+	})
+}
+
+func ServiceUnavailableResponse(c *fiber.Ctx, message string) error {
+	return c.Status(http.StatusServiceUnavailable).JSON(Response{
+		Success: false,
+		Message: message,
+	})
+}
+
 func PaginatedSuccessResponse(c *fiber.Ctx, message string, data interface{}, pagination Pagination) error {
 	return c.Status(http.StatusOK).JSON(PaginatedResponse{
 		Success:    true,
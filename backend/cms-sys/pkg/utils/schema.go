@@ -0,0 +1,61 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+const TenantSchemaPrefix = "tenant_"
+
+var namespacePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{1,54}$`)
+
+var ErrInvalidNamespace = errors.New("invalid tenant namespace")
+
+// NormalizeNamespace lower-cases a namespace and checks it is safe to use as
+// part of a Postgres identifier.
+func NormalizeNamespace(namespace string) (string, error) {
+	ns := strings.ToLower(strings.TrimSpace(namespace))
+	ns = strings.ReplaceAll(ns, "-", "_")
+	if !namespacePattern.MatchString(ns) {
+		return "", ErrInvalidNamespace
+	}
+	return ns, nil
+}
+
+func TenantSchemaName(namespace string) string {
+	return TenantSchemaPrefix + namespace
+}
+
+func QuoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// WithSchema runs fn inside a transaction whose search_path is pinned to the
+// given schema. SET LOCAL only lives as long as the transaction, so the
+// connection goes back to the shared pool with its original search_path on
+// both commit and rollback.
+func WithSchema(ctx context.Context, db *gorm.DB, schema string, fn func(tx *gorm.DB) error) error {
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := SetLocalSearchPath(tx, schema); err != nil {
+			return err
+		}
+		return fn(tx)
+	})
+}
+
+func SetLocalSearchPath(tx *gorm.DB, schema string) error {
+	stmt := fmt.Sprintf("SET LOCAL search_path TO %s, public", QuoteIdent(schema))
+	if err := tx.Exec(stmt).Error; err != nil {
+		return fmt.Errorf("failed to set search_path to %s: %w", schema, err)
+	}
+	return nil
+}
+
+func DropSchema(ctx context.Context, db *gorm.DB, schema string) error {
+	return db.WithContext(ctx).Exec("DROP SCHEMA IF EXISTS " + QuoteIdent(schema) + " CASCADE").Error
+}
@@ -1,21 +0,0 @@
-module github.com/SwanHtetAungPhyo/migration
-
-go 1.24
-
-require (
-	github.com/google/uuid v1.6.0
-	golang.org/x/crypto v0.39.0
-	gorm.io/driver/postgres v1.6.0
-	gorm.io/gorm v1.30.0
-)
-
-require (
-	github.com/jackc/pgpassfile v1.0.0 // indirect
-	github.com/jackc/pgservicefile v0.0.0-20240606120523-5a60cdf6a761 // indirect
-	github.com/jackc/pgx/v5 v5.6.0 // indirect
-	github.com/jackc/puddle/v2 v2.2.2 // indirect
-	github.com/jinzhu/inflection v1.0.0 // indirect
-	github.com/jinzhu/now v1.1.5 // indirect
-	golang.org/x/sync v0.15.0 // indirect
-	golang.org/x/text v0.26.0 // indirect
-)
@@ -3,6 +3,7 @@ CREATE  SCHEMA  IF NOT EXISTS  content_management_system;
 SET  search_path  to content_management_system,public;
 -- Drop existing tables if they exist
 DROP TABLE IF EXISTS cms_cus_purchase;
+DROP TABLE IF EXISTS system_catalog;
 DROP TABLE IF EXISTS cms_whole_sys_role;
 DROP TABLE IF EXISTS cms_user;
 
@@ -11,7 +12,6 @@ CREATE EXTENSION IF NOT EXISTS pgcrypto;
 
 -- Create custom types
 CREATE TYPE role_type AS ENUM ('ROOT_ADMIN', 'CMS_CUSTOMER');
-CREATE TYPE system_type AS ENUM ('LMS', 'EMS');
 
 -- Create tables
 CREATE TABLE cms_whole_sys_role (
@@ -34,15 +34,41 @@ CREATE TABLE cms_user (
                                   REFERENCES cms_whole_sys_role(role_id) ON DELETE CASCADE
 );
 
+-- Systems for sale; adding a product is an INSERT, not a type change
+CREATE TABLE system_catalog (
+                                code varchar(100) PRIMARY KEY,
+                                name varchar(100) NOT NULL,
+                                description varchar(500),
+                                base_url varchar(255),
+                                status varchar(20) NOT NULL DEFAULT 'ACTIVE',
+                                provision_hook varchar(255),
+                                deprovision_hook varchar(255),
+                                created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+                                updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO system_catalog (code, name)
+VALUES
+    ('LMS', 'Learning Management System'),
+    ('EMS', 'EMS');
+
 CREATE TABLE cms_cus_purchase (
                                   relation_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
                                   cms_cus_id UUID NOT NULL,
-                                  system_name system_type NOT NULL,
+                                  system_name varchar(100) NOT NULL,
+                                  namespace varchar(100),
                                   purchase_date TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                                  granted_by UUID,
+                                  subscription_id UUID,
+                                  canceled_at TIMESTAMP,
+                                  canceled_by UUID,
                                   created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
                                   CONSTRAINT fk_cms_purchase_user
                                       FOREIGN KEY (cms_cus_id)
-                                          REFERENCES cms_user(cms_user_id) ON DELETE CASCADE
+                                          REFERENCES cms_user(cms_user_id) ON DELETE CASCADE,
+                                  CONSTRAINT fk_cms_cus_purchase_catalog
+                                      FOREIGN KEY (system_name)
+                                          REFERENCES system_catalog(code)
 );
 
 -- Create indexes
@@ -53,6 +79,10 @@ CREATE INDEX idx_cms_user_role ON cms_user(cms_user_role_id);
 CREATE INDEX idx_purchase_user ON cms_cus_purchase(cms_cus_id);
 CREATE INDEX idx_purchase_date ON cms_cus_purchase(purchase_date);
 CREATE INDEX idx_purchase_system ON cms_cus_purchase USING HASH (system_name);
+-- One purchase per customer and system
+CREATE UNIQUE INDEX idx_purchase_customer_system ON cms_cus_purchase(cms_cus_id, system_name);
+CREATE INDEX idx_cms_cus_purchase_namespace ON cms_cus_purchase(namespace);
+CREATE INDEX idx_cms_cus_purchase_subscription_id ON cms_cus_purchase(subscription_id);
 CREATE INDEX idx_cms_user_role_lookup ON cms_user(cms_user_role_id);
 CREATE INDEX idx_role_name_filter ON cms_whole_sys_role(role_name);
 